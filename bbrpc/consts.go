@@ -0,0 +1,62 @@
+// Package bbrpc defines the peer-to-peer protocol spoken between nodes
+// over Tor. The message and service definitions live in bbrpc.proto; the
+// generated code is produced by go generate into the pb subpackage.
+package bbrpc
+
+// GRPCMaxMsgSize is the maximum size of a single gRPC message on peer
+// connections. Chunk payloads are streamed in frames below this limit so
+// that a slow Tor circuit never forces either side to buffer large
+// messages.
+const GRPCMaxMsgSize = 16 * 1024
+
+// MaxMessageSize is the maximum body size, in bytes, of a peer-to-peer
+// text message sent via SendMessage.
+const MaxMessageSize = 4 * 1024
+
+// HasChunksBatch is the maximum number of blob names in one HasChunks
+// request frame. Blob names are at most 128 bytes, so a full batch plus
+// its proto envelope stays under GRPCMaxMsgSize.
+const HasChunksBatch = 100
+
+// ProtocolVersion is the bbrpc protocol version this build speaks. It
+// is exchanged in HealthCheck responses; nodes reporting 0 predate the
+// exchange and support only the baseline RPC set.
+const ProtocolVersion = 1
+
+// Feature flags advertised alongside the protocol version. A caller
+// must check the bit before relying on the optional behavior instead of
+// waiting for an Unimplemented error mid-job.
+const (
+	// FeatureChunkResume: StoreChunk uploads can resume mid-chunk.
+	FeatureChunkResume uint64 = 1 << iota
+	// FeatureCDCChunking: the node understands manifests with
+	// content-defined chunking parameters.
+	FeatureCDCChunking
+	// FeatureCompression: chunk envelopes may be compressed.
+	FeatureCompression
+	// FeatureClientAuth: the node can require Tor client authorization.
+	FeatureClientAuth
+	// FeatureBatchHasChunks: the node answers the streaming HasChunks
+	// RPC.
+	FeatureBatchHasChunks
+	// FeatureDeleteChunks: the node lets a caller delete its own stored
+	// blobs.
+	FeatureDeleteChunks
+	// FeatureTracing: the node accepts W3C trace context metadata on
+	// incoming calls. Advertised only when the operator enabled tracing
+	// — off by default, so no peer receives correlation IDs unasked.
+	FeatureTracing
+	// FeatureMigration: the node accepts chunks migrated from another
+	// host on a third peer's behalf (HasOwnedChunks, MigrateChunks).
+	FeatureMigration
+	// FeatureRPCCompression: the node decodes gzip-compressed RPC
+	// payloads. Distinct from FeatureCompression, which is about chunk
+	// contents; this is transport-level and never applies to chunk
+	// frames.
+	FeatureRPCCompression
+)
+
+// LocalFeatures is the feature set this build implements. FeatureTracing
+// is deliberately absent: it joins the advertised set at runtime when
+// tracing is enabled.
+const LocalFeatures = FeatureCDCChunking | FeatureClientAuth | FeatureBatchHasChunks | FeatureDeleteChunks | FeatureMigration | FeatureRPCCompression
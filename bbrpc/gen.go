@@ -0,0 +1,3 @@
+package bbrpc
+
+//go:generate protoc --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative bbrpc.proto
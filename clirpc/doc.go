@@ -0,0 +1,8 @@
+// Package clirpc defines the control protocol between bbcli and the
+// daemon. It is served only on a loopback address with mutual TLS; the
+// daemon writes the client credentials into the cli-keys dir for bbcli to
+// pick up. The message and service definitions live in clirpc.proto; the
+// generated code is produced by go generate into the pb subpackage.
+package clirpc
+
+//go:generate protoc --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative clirpc.proto
@@ -0,0 +1,25 @@
+// Command bbcli is the barterbackup command line client. It talks to a
+// running bbd daemon over clirpc.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	flags "github.com/jessevdk/go-flags"
+
+	"github.com/starius/barterbackup/internal/bbcliapp"
+)
+
+func main() {
+	err := bbcliapp.Run(os.Args[1:])
+	if err == nil {
+		return
+	}
+	if flags.WroteHelp(err) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "bbcli: %v\n", err)
+	// See `bbcli help exit-codes` for the mapping.
+	os.Exit(bbcliapp.ExitCode(err))
+}
@@ -0,0 +1,117 @@
+// Command bbd is the barterbackup daemon. It serves the clirpc control
+// API for bbcli and, once unlocked, runs the node on Tor.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/starius/barterbackup/internal/bbdapp"
+	"github.com/starius/barterbackup/internal/chunkstore"
+	"github.com/starius/barterbackup/internal/netsocks"
+)
+
+// stringList collects a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	defaultDataDir := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		defaultDataDir = filepath.Join(home, ".barterbackup")
+	}
+	dataDir := flag.String("data-dir", defaultDataDir, "daemon state directory")
+	cliAddr := flag.String("cli-addr", bbdapp.DefaultCLIAddr, "clirpc bind address")
+	cliAllowRemote := flag.Bool("cli-allow-remote", false, "allow a non-loopback clirpc bind address (dangerous)")
+	dataDirUnsafeOK := flag.Bool("data-dir-unsafe-ok", false, "start even if the data dir filesystem fails the safety preflight (dangerous)")
+	network := flag.String("network", "tor", "node transport: tor (embedded), socks (externally-managed Tor), or local (loopback TCP, development only)")
+	socksProxy := flag.String("socks-proxy", "", "socks network: SOCKS5 proxy address, host:port")
+	socksListen := flag.String("socks-listen", "", "socks network: local TCP address the external onion service forwards to")
+	socksOnion := flag.String("socks-onion", "", "socks network: public onion hostname of the external service")
+	torBinary := flag.String("tor-binary", "", "tor network: tor executable to launch (default: tor from PATH)")
+	torLocalPort := flag.Int("tor-local-port", 0, "tor network: pin the onion service's local listener to this loopback port (default: ephemeral)")
+	torBootstrapTimeout := flag.Duration("tor-bootstrap-timeout", 0, "tor network: budget for Tor bootstrap during onion registration (default 4m)")
+	torPublishTimeout := flag.Duration("tor-publish-timeout", 0, "tor network: budget for onion descriptor publication once Tor is bootstrapped (default 2m)")
+	torMaxMemory := flag.Int64("tor-max-memory", 0, "tor network: restart tor when its RSS exceeds this many bytes (default: no cap; Linux only)")
+	localRegistry := flag.String("local-registry", "", "local network: shared registry file; point cooperating daemons at the same file (default: <data-dir>/netlocal.json)")
+	insecureLocalOK := flag.Bool("i-know-this-is-insecure", false, "acknowledge that the local network has no onion layer; required for --network local")
+	var backupRoots stringList
+	flag.Var(&backupRoots, "backup-root", "directory backups may read from; repeatable (default: none, meaning unrestricted)")
+	chunkBackend := flag.String("chunk-backend", "fs", "where peers' chunks are stored: fs or s3")
+	identityMode := flag.String("identity-mode", "", "onion identity mode: derived (from the password) or stored (random key sealed in the secstore); empty keeps the data dir's recorded mode")
+	warmConnections := flag.Int("warm-connections", 0, "pre-dial up to this many peers from the last session after unlock")
+	strictIdentity := flag.Bool("strict-identity", false, "stop serving if the self-check finds another daemon running with this node's identity")
+	requireOnionProof := flag.Bool("require-onion-proof", false, "refuse chunk and manifest RPCs from peers that have not proven onion ownership")
+	serverMaxStreams := flag.Int("server-max-streams", 0, "cap on concurrent streams per inbound peer connection (default 128)")
+	serverConnIdle := flag.Duration("server-conn-idle", 0, "close inbound peer connections idle for this long (default 15m)")
+	serverConnAge := flag.Duration("server-conn-age", 0, "retire inbound peer connections after this total age (default 12h)")
+	serverHandshakeTimeout := flag.Duration("server-handshake-timeout", 0, "budget for inbound connection setup, first byte through TLS handshake (default 2m)")
+	unlockMaxFailures := flag.Int("unlock-max-failures", 0, "failed unlock attempts before the cool-down kicks in (default 10)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "export OpenTelemetry traces to this OTLP/gRPC endpoint (empty: tracing off)")
+	debugReflection := flag.Bool("debug-reflection", false, "register gRPC reflection on the clirpc server, for bbcli rpc call")
+	s3Endpoint := flag.String("s3-endpoint", "", "s3 chunk backend: endpoint URL")
+	s3Bucket := flag.String("s3-bucket", "", "s3 chunk backend: bucket")
+	s3AccessKey := flag.String("s3-access-key", "", "s3 chunk backend: access key")
+	s3SecretKey := flag.String("s3-secret-key", os.Getenv("BB_S3_SECRET_KEY"), "s3 chunk backend: secret key (or BB_S3_SECRET_KEY)")
+	s3Region := flag.String("s3-region", "", "s3 chunk backend: signing region")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := bbdapp.Run(ctx, bbdapp.Config{
+		DataDir:         *dataDir,
+		CLIAddr:         *cliAddr,
+		CLIAllowRemote:  *cliAllowRemote,
+		DataDirUnsafeOK: *dataDirUnsafeOK,
+		NetworkBackend:  *network,
+		Socks: netsocks.Config{
+			Proxy:      *socksProxy,
+			ListenAddr: *socksListen,
+			Onion:      *socksOnion,
+		},
+		TorBinary:              *torBinary,
+		TorLocalPort:           *torLocalPort,
+		TorBootstrapTimeout:    *torBootstrapTimeout,
+		TorPublishTimeout:      *torPublishTimeout,
+		TorMaxMemory:           *torMaxMemory,
+		BackupRoots:            backupRoots,
+		LocalRegistry:          *localRegistry,
+		InsecureLocalOK:        *insecureLocalOK,
+		ChunkBackend:           *chunkBackend,
+		IdentityMode:           *identityMode,
+		WarmConnections:        *warmConnections,
+		StrictIdentity:         *strictIdentity,
+		RequireOnionProof:      *requireOnionProof,
+		ServerMaxStreams:       *serverMaxStreams,
+		ServerConnIdle:         *serverConnIdle,
+		ServerConnAge:          *serverConnAge,
+		ServerHandshakeTimeout: *serverHandshakeTimeout,
+		OTLPEndpoint:           *otlpEndpoint,
+		UnlockMaxFailures:      *unlockMaxFailures,
+		DebugReflection:        *debugReflection,
+		S3: chunkstore.S3Config{
+			Endpoint:  *s3Endpoint,
+			Bucket:    *s3Bucket,
+			AccessKey: *s3AccessKey,
+			SecretKey: *s3SecretKey,
+			Region:    *s3Region,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bbd: %v\n", err)
+		os.Exit(1)
+	}
+}
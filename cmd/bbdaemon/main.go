@@ -0,0 +1,60 @@
+// Command bbdaemon is the original single-process node runner: it takes
+// the password up front and serves the bbrpc server until interrupted,
+// with no control API. Superseded by bbd + bbcli for interactive use.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/starius/barterbackup/internal/bbnode"
+	"github.com/starius/barterbackup/internal/nettor"
+)
+
+func main() {
+	passwordFile := flag.String("password-file", "", "file containing the node password")
+	dataDir := flag.String("data-dir", "", "directory for the node state")
+	torDir := flag.String("tor-dir", "", "Tor state directory")
+	torBinary := flag.String("tor-binary", "", "tor executable to launch (default: tor from PATH)")
+	flag.Parse()
+
+	if *passwordFile == "" {
+		fmt.Fprintln(os.Stderr, "bbdaemon: -password-file is required")
+		os.Exit(2)
+	}
+	if *dataDir == "" {
+		fmt.Fprintln(os.Stderr, "bbdaemon: -data-dir is required")
+		os.Exit(2)
+	}
+	password, err := os.ReadFile(*passwordFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bbdaemon: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var torOpts []nettor.Option
+	if *torBinary != "" {
+		torOpts = append(torOpts, nettor.WithTorBinary(*torBinary))
+	}
+	network := nettor.New(*torDir, torOpts...)
+	defer network.Close()
+	n, err := bbnode.New(string(password), network, *dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bbdaemon: %v\n", err)
+		os.Exit(1)
+	}
+	if err := n.Start(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "bbdaemon: %v\n", err)
+		os.Exit(1)
+	}
+	defer n.Stop()
+	fmt.Printf("serving on %s\n", n.Address())
+	<-ctx.Done()
+}
@@ -0,0 +1,116 @@
+// Package atomicfile writes small state files so that a crash at any
+// point leaves either the previous content or the complete new content
+// at the final path — never a truncated mix, and never a missing file
+// that existed before. The write goes to a temp file in the same
+// directory, is fsynced, renamed over the final path, and the directory
+// is fsynced so the rename itself survives a power cut.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// failpoint is a test seam invoked before each stage of WriteFile
+// ("write", "sync", "rename"); returning an error aborts the write at
+// that point, simulating a crash mid-way.
+var failpoint = func(stage string) error { return nil }
+
+// WriteFile writes data to path atomically and durably. On error the
+// file at path is untouched.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err := failpoint("write"); err != nil {
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	if err := failpoint("sync"); err != nil {
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("atomicfile %s: sync: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("atomicfile %s: chmod: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("atomicfile %s: close: %w", path, err)
+	}
+	if err := failpoint("rename"); err != nil {
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("atomicfile %s: rename: %w", path, err)
+	}
+	tmp = nil
+	return syncDir(dir)
+}
+
+// WriteFileExclusive creates path with O_EXCL — failing if anything,
+// including a planted symlink, already sits there — writes data, and
+// fsyncs. Use it for fresh secrets in a just-verified directory; unlike
+// WriteFile it never replaces an existing file, so there is no rename a
+// concurrent attacker could race.
+func WriteFileExclusive(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("atomicfile %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("atomicfile %s: sync: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("atomicfile %s: close: %w", path, err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsyncs the directory so a just-renamed entry survives a
+// crash. Filesystems that cannot sync a directory (some network and
+// FAT mounts) degrade to a plain rename.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	d.Sync() // best effort; see above
+	return nil
+}
+
+// ReadOrInit returns the content of path. If the file does not exist
+// yet, it atomically writes init there and returns init, so concurrent
+// first readers settle on one complete value.
+func ReadOrInit(path string, init []byte, perm os.FileMode) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err := WriteFile(path, init, perm); err != nil {
+		return nil, err
+	}
+	return init, nil
+}
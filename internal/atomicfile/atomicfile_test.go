@@ -0,0 +1,116 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := WriteFile(path, []byte("v1"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "v1" {
+		t.Errorf("content = %q, want v1", got)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("perm = %v, want 0600", info.Mode().Perm())
+	}
+	if err := WriteFile(path, []byte("v2"), 0o600); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "v2" {
+		t.Errorf("content after overwrite = %q, want v2", got)
+	}
+}
+
+// TestWriteFileCrashSafety fails the write at every stage in turn and
+// verifies the final path always holds either the old complete content
+// or nothing — never a partial file — and that no temp files leak.
+func TestWriteFileCrashSafety(t *testing.T) {
+	injected := errors.New("injected fault")
+	for _, stage := range []string{"write", "sync", "rename"} {
+		t.Run(stage, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "state.json")
+			if err := WriteFile(path, []byte("old complete content"), 0o600); err != nil {
+				t.Fatalf("seed: %v", err)
+			}
+			failpoint = func(s string) error {
+				if s == stage {
+					return injected
+				}
+				return nil
+			}
+			defer func() { failpoint = func(string) error { return nil } }()
+
+			err := WriteFile(path, []byte("new content that must not appear"), 0o600)
+			if !errors.Is(err, injected) {
+				t.Fatalf("WriteFile with %s fault: %v, want injected error", stage, err)
+			}
+			got, readErr := os.ReadFile(path)
+			if readErr != nil || string(got) != "old complete content" {
+				t.Errorf("final path after %s fault: %q (%v), want old content intact", stage, got, readErr)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ReadDir: %v", err)
+			}
+			for _, e := range entries {
+				if strings.Contains(e.Name(), ".tmp-") {
+					t.Errorf("temp file %s leaked after %s fault", e.Name(), stage)
+				}
+			}
+		})
+	}
+}
+
+func TestReadOrInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	got, err := ReadOrInit(path, []byte("0"), 0o600)
+	if err != nil || string(got) != "0" {
+		t.Fatalf("ReadOrInit on missing file = %q, %v", got, err)
+	}
+	if err := WriteFile(path, []byte("7"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err = ReadOrInit(path, []byte("0"), 0o600)
+	if err != nil || string(got) != "7" {
+		t.Errorf("ReadOrInit on existing file = %q, %v, want 7", got, err)
+	}
+}
+
+func TestWriteFileExclusive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "client.key")
+	if err := WriteFileExclusive(path, []byte("secret"), 0o600); err != nil {
+		t.Fatalf("WriteFileExclusive: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "secret" {
+		t.Fatalf("read back %q, %v", data, err)
+	}
+	if err := WriteFileExclusive(path, []byte("other"), 0o600); err == nil {
+		t.Error("second exclusive write over an existing file succeeded")
+	}
+
+	// A planted symlink — even a dangling one — must abort the write
+	// instead of creating the file at the link's target.
+	link := filepath.Join(dir, "planted")
+	if err := os.Symlink(filepath.Join(dir, "elsewhere"), link); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileExclusive(link, []byte("secret"), 0o600); err == nil {
+		t.Error("exclusive write through a planted symlink succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "elsewhere")); err == nil {
+		t.Error("write escaped through the symlink")
+	}
+}
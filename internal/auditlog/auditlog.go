@@ -0,0 +1,226 @@
+// Package auditlog keeps an append-only trail of security-relevant
+// daemon events as hash-chained JSON lines: each record embeds the
+// SHA-256 of the previous record's serialized line, so any later edit or
+// deletion inside the retained history breaks the chain and is
+// detectable. The chain continues across rotated files.
+package auditlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// currentFile is the file records are appended to; rotation renames it
+// to rotatedPrefix<unix-nanos>.log and starts a fresh one.
+const (
+	currentFile   = "audit.log"
+	rotatedPrefix = "audit-"
+
+	// defaultRotateSize is how large the current file may grow before
+	// rotation.
+	defaultRotateSize = 1 << 20
+)
+
+// Record is one audit event. Its own hash is not a field — it is the
+// SHA-256 of the serialized line, which the next record carries in Prev.
+type Record struct {
+	TimeUnix int64             `json:"ts"`
+	Event    string            `json:"event"`
+	Details  map[string]string `json:"details,omitempty"`
+	// Prev is the hex SHA-256 of the previous record's line, empty only
+	// for the first record ever written.
+	Prev string `json:"prev"`
+}
+
+// Logger appends hash-chained records under dir.
+type Logger struct {
+	dir        string
+	rotateSize int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	prev string
+}
+
+// Open prepares the audit log under dir, picking up the hash chain where
+// the existing files left off.
+func Open(dir string) (*Logger, error) {
+	l := &Logger{dir: dir, rotateSize: defaultRotateSize}
+	files, err := logFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		lines, err := readLines(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) > 0 {
+			l.prev = lineHash(lines[len(lines)-1])
+		}
+	}
+	path := filepath.Join(dir, currentFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat audit log: %w", err)
+	}
+	l.f = f
+	l.size = st.Size()
+	return l, nil
+}
+
+// Append writes one event to the log. details must not contain secrets:
+// the log is plaintext by design, so it stays readable after the keys
+// are gone.
+func (l *Logger) Append(event string, details map[string]string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	line, err := json.Marshal(&Record{
+		TimeUnix: time.Now().Unix(),
+		Event:    event,
+		Details:  details,
+		Prev:     l.prev,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal audit record: %w", err)
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("append audit record: %w", err)
+	}
+	l.prev = lineHash(line)
+	l.size += int64(len(line)) + 1
+	if l.size >= l.rotateSize {
+		return l.rotateLocked()
+	}
+	return nil
+}
+
+// rotateLocked renames the current file aside and starts a fresh one.
+// The in-memory prev hash carries the chain into the new file.
+func (l *Logger) rotateLocked() error {
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("close audit log: %w", err)
+	}
+	cur := filepath.Join(l.dir, currentFile)
+	rotated := filepath.Join(l.dir, fmt.Sprintf("%s%d.log", rotatedPrefix, time.Now().UnixNano()))
+	if err := os.Rename(cur, rotated); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+	f, err := os.OpenFile(cur, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	l.f = f
+	l.size = 0
+	return nil
+}
+
+// Read returns raw record lines with timestamps inside [from, to],
+// oldest first. A zero bound is unbounded. Reading everything and
+// verifying with Verify proves the retained history is untampered.
+func (l *Logger) Read(from, to time.Time) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files, err := logFiles(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out [][]byte
+	for _, name := range files {
+		lines, err := readLines(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			var rec Record
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return nil, fmt.Errorf("%s: bad record: %w", filepath.Base(name), err)
+			}
+			ts := time.Unix(rec.TimeUnix, 0)
+			if !from.IsZero() && ts.Before(from) {
+				continue
+			}
+			if !to.IsZero() && ts.After(to) {
+				continue
+			}
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// Close closes the current log file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Verify checks the hash chain over raw record lines, oldest first. The
+// first record's Prev is taken as the chain root, so verification works
+// even after old files were pruned.
+func Verify(lines [][]byte) error {
+	prev := ""
+	for i, line := range lines {
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("record %d: bad JSON: %w", i, err)
+		}
+		if i > 0 && rec.Prev != prev {
+			return fmt.Errorf("record %d: hash chain broken: prev %s, want %s", i, rec.Prev, prev)
+		}
+		prev = lineHash(line)
+	}
+	return nil
+}
+
+// logFiles returns the audit log files under dir, oldest first. Rotated
+// names embed a fixed-width nanosecond timestamp, so the lexicographic
+// order is the chain order, with the current file last.
+func logFiles(dir string) ([]string, error) {
+	rotated, err := filepath.Glob(filepath.Join(dir, rotatedPrefix+"*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+	cur := filepath.Join(dir, currentFile)
+	if _, err := os.Stat(cur); err == nil {
+		rotated = append(rotated, cur)
+	}
+	return rotated, nil
+}
+
+// readLines returns the non-empty lines of one log file.
+func readLines(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	var out [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// lineHash is the hex SHA-256 of one serialized record line.
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+type addressCommand struct {
+	app *app
+
+	Offline      bool   `long:"offline" description:"Derive the address locally from the password, without a daemon or Tor"`
+	PasswordFile string `long:"password-file" description:"Read the password from a file instead of prompting (with --offline)"`
+}
+
+func (c *addressCommand) Execute(args []string) error {
+	if c.Offline {
+		password, err := readPassword(c.PasswordFile)
+		if err != nil {
+			return err
+		}
+		addr, err := keys.OnionAddressFromSeed(password)
+		if err != nil {
+			return err
+		}
+		c.app.println(addr)
+		return nil
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.GetStatusResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.GetStatus(ctx, &pb.GetStatusRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Onion == "" {
+		// The cached address is from the last unlock; good enough to
+		// answer "which identity lives in this data dir".
+		if resp.CachedOnion != "" {
+			c.app.println(resp.CachedOnion)
+			return nil
+		}
+		return fmt.Errorf("daemon is locked; run bbcli unlock, or use --offline")
+	}
+	c.app.println(resp.Onion)
+	return nil
+}
@@ -0,0 +1,116 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type agreementsCommand struct {
+	app *app
+
+	List    agreementsListCommand    `command:"list" description:"List agreements"`
+	Propose agreementsProposeCommand `command:"propose" description:"Propose a storage agreement to a peer"`
+	Accept  agreementsAcceptCommand  `command:"accept" description:"Accept a pending agreement"`
+}
+
+func (c *agreementsCommand) Execute(args []string) error { return nil }
+
+type agreementsListCommand struct {
+	app *app
+}
+
+func (c *agreementsListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListAgreementsResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListAgreements(ctx, &pb.ListAgreementsRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range resp.Agreements {
+		expiry := "-"
+		if a.ExpiresAtUnix != 0 {
+			expiry = time.Unix(a.ExpiresAtUnix, 0).Format("2006-01-02")
+		}
+		c.app.printf("%s\t%s\t%s -> %s\toffer %s / request %s\t%d days\texpires %s\n",
+			a.Id, a.State, a.Proposer, a.Acceptor,
+			formatBytes(a.OfferedBytes), formatBytes(a.RequestedBytes),
+			a.Days, expiry)
+	}
+	return nil
+}
+
+type agreementsProposeCommand struct {
+	app *app
+
+	OfferedBytes   int64 `long:"offer" required:"true" description:"Bytes you will store for the peer"`
+	RequestedBytes int64 `long:"request" required:"true" description:"Bytes the peer will store for you"`
+	Days           int32 `long:"days" default:"90" description:"Agreement duration in days"`
+	Args           struct {
+		Peer string `positional-arg-name:"peer" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *agreementsProposeCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	resp, err := client.ProposeAgreement(context.Background(), &pb.ProposeAgreementRequest{
+		Peer:           c.Args.Peer,
+		OfferedBytes:   c.OfferedBytes,
+		RequestedBytes: c.RequestedBytes,
+		Days:           c.Days,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("proposed agreement %s to %s\n", resp.Agreement.Id, resp.Agreement.Acceptor)
+	return nil
+}
+
+type agreementsAcceptCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *agreementsAcceptCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	resp, err := client.AcceptAgreement(context.Background(), &pb.AcceptAgreementRequest{Id: c.Args.ID})
+	if err != nil {
+		return err
+	}
+	c.app.printf("agreement %s is now %s\n", resp.Agreement.Id, resp.Agreement.State)
+	return nil
+}
+
+// formatBytes renders a byte count with a binary unit suffix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,542 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type backupCommand struct {
+	app *app
+
+	Create   backupCreateCommand   `command:"create" description:"Back up a directory to one or more peers"`
+	List     backupListCommand     `command:"list" description:"List backups"`
+	Delete   backupDeleteCommand   `command:"delete" description:"Move a backup to the trash; purged after a grace period"`
+	Undelete backupUndeleteCommand `command:"undelete" description:"Bring a backup back from the trash"`
+	Diff     backupDiffCommand     `command:"diff" description:"Show what changed between two backups"`
+	Restore  backupRestoreCommand  `command:"restore" description:"Restore a backup into a directory"`
+	Status   backupStatusCommand   `command:"status" description:"Check replication health per peer"`
+	Repair   backupRepairCommand   `command:"repair" description:"Re-upload chunks a replica peer is missing"`
+	Verify   backupVerifyCommand   `command:"verify" description:"Check a backup on its replicas without restoring it"`
+}
+
+func (c *backupCommand) Execute(args []string) error { return nil }
+
+type backupCreateCommand struct {
+	app *app
+
+	Peers   []string `long:"peer" description:"Group name, peer alias, or onion address to store the backup on; repeatable"`
+	Chunker string   `long:"chunker" choice:"cdc" choice:"fixed" description:"Chunking algorithm; cdc survives insertions, fixed is the legacy cut"`
+	Hash    string   `long:"hash" choice:"sha256" choice:"blake3" description:"Chunk hash algorithm; an incremental run defaults to the base backup's"`
+	Include []string `long:"include" description:"Glob pattern selecting files to back up; repeatable, default everything"`
+	Exclude []string `long:"exclude" description:"Glob pattern of files to skip; repeatable, wins over --include"`
+	DryRun  bool     `long:"dry-run" description:"List what would be backed up without transferring anything"`
+	Follow  bool     `long:"follow-symlinks" description:"Back up what symlinks point at instead of the links"`
+	Stdin   bool     `long:"stdin" description:"Back up a single stream read from stdin instead of a directory"`
+	Name    string   `long:"name" description:"File name the stdin stream appears under; required with --stdin"`
+
+	NoProgress bool `long:"no-progress" description:"Do not show the live progress bar"`
+	Args       struct {
+		SourceDir string `positional-arg-name:"source-dir"`
+	} `positional-args:"true"`
+}
+
+func (c *backupCreateCommand) Execute(args []string) error {
+	if !c.DryRun && len(c.Peers) == 0 {
+		return fmt.Errorf("at least one --peer is required (only --dry-run works without)")
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	if c.Stdin {
+		return c.createFromStdin(client)
+	}
+	if c.Args.SourceDir == "" {
+		return fmt.Errorf("source-dir is required unless --stdin is given")
+	}
+	var resp *pb.CreateBackupResponse
+	err = c.app.runWithProgress(client, "backup", c.NoProgress || c.DryRun, func() error {
+		resp, err = client.CreateBackup(context.Background(), &pb.CreateBackupRequest{
+			Peers:          c.Peers,
+			SourceDir:      c.Args.SourceDir,
+			Chunker:        c.Chunker,
+			Hash:           c.Hash,
+			Include:        c.Include,
+			Exclude:        c.Exclude,
+			DryRun:         c.DryRun,
+			FollowSymlinks: c.Follow,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if c.DryRun {
+		for _, f := range resp.Planned {
+			c.app.printf("%s\t%s\n", formatBytes(f.Size), f.Path)
+		}
+		c.app.printf("would back up %d files, %s\n", len(resp.Planned), formatBytes(resp.PlannedBytes))
+		return nil
+	}
+	b := resp.Backup
+	c.app.printf("backup %s: %d entries, %s total, %s uploaded\n",
+		b.Id, b.FileCount, formatBytes(b.TotalBytes), formatBytes(b.UploadedBytes))
+	for _, peer := range b.Peers {
+		c.app.printf("  %s: %s\n", peer, b.Replication[peer])
+	}
+	return nil
+}
+
+// createFromStdin streams stdin to the daemon in frames; the daemon
+// chunks and uploads on the fly, so `pg_dump | bbcli backup create
+// --stdin --name db.sql --peer bob` never touches the local disk.
+func (c *backupCreateCommand) createFromStdin(client pb.CLIClient) error {
+	if c.Name == "" {
+		return fmt.Errorf("--name is required with --stdin")
+	}
+	if c.Args.SourceDir != "" {
+		return fmt.Errorf("--stdin takes no source-dir")
+	}
+	if c.DryRun || c.Chunker != "" || c.Hash != "" || len(c.Include) > 0 || len(c.Exclude) > 0 || c.Follow {
+		return fmt.Errorf("--stdin backs up a single stream; the tree-walk options do not apply")
+	}
+	var resp *pb.CreateStreamBackupResponse
+	err := c.app.runWithProgress(client, "backup", c.NoProgress, func() error {
+		stream, err := client.CreateStreamBackup(context.Background())
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.CreateStreamBackupRequest{Name: c.Name, Peers: c.Peers}); err != nil {
+			return err
+		}
+		buf := make([]byte, 64<<10)
+		for {
+			m, err := os.Stdin.Read(buf)
+			if m > 0 {
+				if err := stream.Send(&pb.CreateStreamBackupRequest{Data: buf[:m]}); err != nil {
+					// The daemon hung up; CloseAndRecv surfaces the
+					// real error.
+					break
+				}
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("read stdin: %w", err)
+			}
+		}
+		resp, err = stream.CloseAndRecv()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	b := resp.Backup
+	c.app.printf("backup %s: %s from stdin as %q, %s uploaded\n",
+		b.Id, formatBytes(b.TotalBytes), c.Name, formatBytes(b.UploadedBytes))
+	for _, peer := range b.Peers {
+		c.app.printf("  %s: %s\n", peer, b.Replication[peer])
+	}
+	return nil
+}
+
+type backupListCommand struct {
+	app *app
+
+	All   bool   `long:"all" description:"Also list backups in the deletion grace period"`
+	Sort  string `long:"sort" choice:"date" choice:"name" choice:"size" description:"Order: by date (default, newest first), source dir, or size (largest first)"`
+	Limit int    `long:"limit" description:"Stop after this many backups (0 lists all)"`
+}
+
+func (c *backupListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var backups []*pb.BackupInfo
+	token := ""
+	for {
+		var resp *pb.ListBackupsResponse
+		err = c.app.retry(func(ctx context.Context) error {
+			resp, err = client.ListBackups(ctx, &pb.ListBackupsRequest{All: c.All, PageToken: token, Sort: c.Sort})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		backups = append(backups, resp.Backups...)
+		if c.Limit > 0 && len(backups) >= c.Limit {
+			backups = backups[:c.Limit]
+			break
+		}
+		token = resp.NextPageToken
+		if token == "" {
+			break
+		}
+	}
+	for _, b := range backups {
+		kind := "full"
+		if b.BaseId != "" {
+			kind = "incremental"
+		}
+		if b.LastVerifiedUnix != 0 {
+			kind += fmt.Sprintf(", verified %s",
+				time.Unix(b.LastVerifiedUnix, 0).Format("2006-01-02"))
+		}
+		if b.DeletedAtUnix != 0 {
+			kind += fmt.Sprintf(", deleted (purge %s)",
+				time.Unix(b.PurgeAtUnix, 0).Format("2006-01-02"))
+		}
+		c.app.printf("%s\t%s\t%s -> %s\t%d entries\t%s\t%s\n",
+			b.Id, time.Unix(b.CreatedAtUnix, 0).Format("2006-01-02 15:04"),
+			b.SourceDir, strings.Join(b.Peers, ","), b.FileCount, formatBytes(b.TotalBytes), kind)
+	}
+	return nil
+}
+
+type backupDeleteCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *backupDeleteCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.DeleteBackup(ctx, &pb.DeleteBackupRequest{Id: c.Args.ID})
+	if err != nil {
+		return err
+	}
+	c.app.printf("backup %s moved to the trash; purged on %s unless undeleted\n",
+		c.Args.ID, time.Unix(resp.PurgeAtUnix, 0).Format("2006-01-02"))
+	return nil
+}
+
+type backupUndeleteCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *backupUndeleteCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.UndeleteBackup(ctx, &pb.UndeleteBackupRequest{Id: c.Args.ID}); err != nil {
+		return err
+	}
+	c.app.printf("backup %s restored from the trash\n", c.Args.ID)
+	return nil
+}
+
+type backupDiffCommand struct {
+	app *app
+
+	Args struct {
+		OldID string `positional-arg-name:"old-id" required:"true"`
+		NewID string `positional-arg-name:"new-id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *backupDiffCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.DiffBackups(ctx, &pb.DiffBackupsRequest{
+		OldId: c.Args.OldID,
+		NewId: c.Args.NewID,
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range resp.Added {
+		c.app.printf("A %s\n", p)
+	}
+	for _, p := range resp.Modified {
+		c.app.printf("M %s\n", p)
+	}
+	for _, p := range resp.Deleted {
+		c.app.printf("D %s\n", p)
+	}
+	c.app.printf("%d added, %d modified, %d deleted\n",
+		len(resp.Added), len(resp.Modified), len(resp.Deleted))
+	return nil
+}
+
+type backupStatusCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *backupStatusCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	resp, err := client.BackupStatus(context.Background(), &pb.BackupStatusRequest{Id: c.Args.ID})
+	if err != nil {
+		return err
+	}
+	for _, p := range resp.Peers {
+		c.app.printf("%s\t%s\n", p.Peer, p.State)
+	}
+	if r := resp.LastRestore; r != nil {
+		c.app.printf("last restore %s into %s: %d ok, %d failed, %d skipped, %s verified\n",
+			time.Unix(r.FinishedAtUnix, 0).Format("2006-01-02 15:04"), r.DestDir,
+			r.FilesOk, r.FilesFailed, r.FilesSkipped, formatBytes(r.BytesVerified))
+		for _, f := range r.Files {
+			if f.Result == "ok" {
+				continue
+			}
+			c.app.printf("  %s: %s (%s)\n", f.Path, f.Result, f.Detail)
+		}
+	}
+	return nil
+}
+
+type backupRepairCommand struct {
+	app *app
+
+	Peer       string `long:"peer" required:"true" description:"Alias or onion address of the replica to repair"`
+	NoProgress bool   `long:"no-progress" description:"Do not show the live progress bar"`
+	Args       struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *backupRepairCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.RepairBackupResponse
+	err = c.app.runWithProgress(client, "repair", c.NoProgress, func() error {
+		resp, err = client.RepairBackup(context.Background(), &pb.RepairBackupRequest{
+			Id:   c.Args.ID,
+			Peer: c.Peer,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("checked %d blobs, %d missing, %d repaired\n",
+		resp.Checked, resp.Missing, resp.Repaired)
+	for _, name := range resp.Unrepaired {
+		c.app.printf("UNREPAIRED %s\n", name)
+	}
+	if len(resp.Unrepaired) > 0 {
+		return fmt.Errorf("%d blobs could not be repaired", len(resp.Unrepaired))
+	}
+	return nil
+}
+
+type backupVerifyCommand struct {
+	app *app
+
+	Sample     int   `long:"sample" description:"Percent of chunks to fetch back and authenticate (default 10)"`
+	Full       bool  `long:"full" description:"Fetch back and authenticate every chunk; same as --sample 100"`
+	Seed       int64 `long:"seed" description:"Reproduce a previous run's chunk sample (default: random)"`
+	Repair     bool  `long:"repair" description:"Run the repair flow against each replica that fails verification"`
+	NoProgress bool  `long:"no-progress" description:"Do not show the live progress bar"`
+	Args       struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *backupVerifyCommand) Execute(args []string) error {
+	sample := c.Sample
+	if c.Full {
+		sample = 100
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.VerifyBackupResponse
+	err = c.app.runWithProgress(client, "verify", c.NoProgress, func() error {
+		resp, err = client.VerifyBackup(context.Background(), &pb.VerifyBackupRequest{
+			Id:            c.Args.ID,
+			SamplePercent: int32(sample),
+			Seed:          c.Seed,
+			Repair:        c.Repair,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("sampled %d%% of chunks, seed %d\n", resp.SamplePercent, resp.Seed)
+	failing := 0
+	for _, p := range resp.Peers {
+		if p.Error != "" {
+			c.app.printf("%s: ERROR %s\n", p.Onion, p.Error)
+			failing++
+			continue
+		}
+		manifest := "ok"
+		if !p.ManifestOk {
+			manifest = p.ManifestError
+		}
+		c.app.printf("%s: %d blobs checked, %d missing, %d sampled, %d failed, manifest %s\n",
+			p.Onion, p.Checked, len(p.Missing), p.Sampled, len(p.Failed), manifest)
+		for _, name := range p.Missing {
+			c.app.printf("  MISSING %s\n", name)
+		}
+		for _, name := range p.Failed {
+			c.app.printf("  FAILED %s\n", name)
+		}
+		if p.Repaired > 0 || len(p.Unrepaired) > 0 {
+			c.app.printf("  repaired %d, %d unrepaired\n", p.Repaired, len(p.Unrepaired))
+		}
+		if len(p.Missing) > 0 || len(p.Failed) > 0 || !p.ManifestOk {
+			failing++
+		}
+	}
+	if failing > 0 {
+		return fmt.Errorf("verification failed on %d of %d replicas", failing, len(resp.Peers))
+	}
+	c.app.printf("backup %s verified on all %d replicas\n", c.Args.ID, len(resp.Peers))
+	return nil
+}
+
+type recoverCommand struct {
+	app *app
+
+	Peer string `long:"peer" required:"true" description:"Alias or onion address of the peer holding your manifests"`
+}
+
+func (c *recoverCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	resp, err := client.RecoverBackups(context.Background(), &pb.RecoverBackupsRequest{Peer: c.Peer})
+	if err != nil {
+		return err
+	}
+	if len(resp.Recovered) == 0 {
+		c.app.println("nothing to recover: all manifests on the peer are already known locally")
+		return nil
+	}
+	for _, b := range resp.Recovered {
+		c.app.printf("recovered backup %s of %s (%d entries, %s)\n",
+			b.Id, b.SourceDir, b.FileCount, formatBytes(b.TotalBytes))
+	}
+	c.app.println("run bbcli backup restore to get the files back")
+	return nil
+}
+
+type backupRestoreCommand struct {
+	app *app
+
+	Report     bool `long:"report" description:"Save the integrity report as <dest-dir>.restore-report.json"`
+	NoProgress bool `long:"no-progress" description:"Do not show the live progress bar"`
+	ToStdout   bool `long:"to-stdout" description:"Write the backup to stdout as a tar archive instead of a directory"`
+	Args       struct {
+		ID      string `positional-arg-name:"id" required:"true"`
+		DestDir string `positional-arg-name:"dest-dir"`
+	} `positional-args:"true"`
+}
+
+func (c *backupRestoreCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	if c.ToStdout {
+		return c.restoreToStdout(client)
+	}
+	if c.Args.DestDir == "" {
+		return fmt.Errorf("dest-dir is required unless --to-stdout is given")
+	}
+	err = c.app.runWithProgress(client, "restore", c.NoProgress, func() error {
+		_, err := client.RestoreBackup(context.Background(), &pb.RestoreBackupRequest{
+			Id:          c.Args.ID,
+			DestDir:     c.Args.DestDir,
+			WriteReport: c.Report,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("restored %s into %s\n", c.Args.ID, c.Args.DestDir)
+	if c.Report {
+		c.app.printf("integrity report: %s.restore-report.json\n", filepath.Clean(c.Args.DestDir))
+	}
+	return nil
+}
+
+// restoreToStdout streams the backup as a tar archive to stdout. All
+// chatter — progress, the final summary — stays on stderr so the
+// archive can be piped or checksummed.
+func (c *backupRestoreCommand) restoreToStdout(client pb.CLIClient) error {
+	if c.Args.DestDir != "" {
+		return fmt.Errorf("--to-stdout takes no dest-dir")
+	}
+	if c.Report {
+		return fmt.Errorf("--report needs a destination directory")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := c.app.runWithProgress(client, "restore", c.NoProgress, func() error {
+		stream, err := client.RestoreStream(ctx, &pb.RestoreStreamRequest{Id: c.Args.ID})
+		if err != nil {
+			return err
+		}
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if _, err := os.Stdout.Write(resp.Data); err != nil {
+				// The consumer hung up; cancelling the stream cancels
+				// the daemon-side job.
+				cancel()
+				return fmt.Errorf("write to stdout: %w", err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "restored %s to stdout\n", c.Args.ID)
+	return nil
+}
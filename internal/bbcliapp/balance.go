@@ -0,0 +1,49 @@
+package bbcliapp
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type balanceCommand struct {
+	app *app
+
+	JSON bool `long:"json" description:"Print the raw balance entries as JSON"`
+}
+
+func (c *balanceCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListBalancesResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListBalances(ctx, &pb.ListBalancesRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if c.JSON {
+		enc := json.NewEncoder(c.app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp.Balances)
+	}
+	if len(resp.Balances) == 0 {
+		c.app.println("no peers")
+		return nil
+	}
+	for _, b := range resp.Balances {
+		name := b.Onion
+		if b.Alias != "" {
+			name = b.Alias
+		}
+		c.app.printf("%s\tstoring %s for them\tthey store %s for me\tsent %s / received %s (30d)\n",
+			name, formatBytes(b.StoredForPeerBytes), formatBytes(b.StoredAtPeerBytes),
+			formatBytes(b.SentBytes), formatBytes(b.ReceivedBytes))
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+// Package bbcliapp implements the bbcli command line client. Commands
+// talk to the daemon over clirpc using the credentials the daemon wrote
+// into the cli-keys dir.
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	flags "github.com/jessevdk/go-flags"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/clitls"
+	"github.com/starius/barterbackup/internal/tracing"
+)
+
+// retryBaseDelay is the first backoff step between --retries attempts;
+// it doubles per attempt.
+const retryBaseDelay = 500 * time.Millisecond
+
+// defaultDaemonAddr is where the daemon listens unless told otherwise.
+const defaultDaemonAddr = "127.0.0.1:9911"
+
+// Config holds the global bbcli options.
+type Config struct {
+	DataDir        string        `long:"data-dir" env:"BB_DATA_DIR" description:"Daemon data dir, used to find the cli-keys dir"`
+	KeysDir        string        `long:"keys-dir" env:"BB_KEYS_DIR" description:"Credentials dir; defaults to <data-dir>/cli-keys. Point it at a dir written by bbcli auth create-readonly for a read-only session"`
+	DaemonAddr     string        `long:"daemon-addr" env:"BB_DAEMON_ADDR" description:"Daemon clirpc address; defaults to the one the daemon published in the cli-keys dir, then 127.0.0.1:9911"`
+	Timeout        time.Duration `long:"timeout" env:"BB_TIMEOUT" default:"5s" description:"Timeout for quick daemon RPCs; long-running operations are not bounded"`
+	ConnectTimeout time.Duration `long:"connect-timeout" env:"BB_CONNECT_TIMEOUT" default:"10s" description:"Timeout for connecting to the daemon"`
+	Retries        int           `long:"retries" env:"BB_RETRIES" default:"0" description:"Extra attempts with backoff for read-only calls"`
+	OTLPEndpoint   string        `long:"otlp-endpoint" env:"BB_OTLP_ENDPOINT" description:"Export OpenTelemetry traces of the command's RPCs to this OTLP/gRPC endpoint"`
+}
+
+// app carries the parsed config into command Execute methods.
+type app struct {
+	cfg Config
+	// out receives command output; os.Stdout unless WithOutput
+	// overrides it.
+	out io.Writer
+	// flushTraces flushes buffered spans when --otlp-endpoint is set;
+	// nil until the first connection sets tracing up.
+	flushTraces func(context.Context) error
+	// helpIndex maps a command path like "backup create" to its long
+	// description and examples; buildParser fills it.
+	helpIndex map[string]commandHelp
+}
+
+// Option customizes Run, for tests that drive bbcli in-process.
+type Option func(*app)
+
+// WithOutput sends command output to w instead of stdout.
+func WithOutput(w io.Writer) Option {
+	return func(a *app) { a.out = w }
+}
+
+// Run parses args (excluding the program name) and executes the selected
+// command.
+func Run(args []string, opts ...Option) error {
+	a := &app{out: os.Stdout}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		a.cfg.DataDir = filepath.Join(home, ".barterbackup")
+	}
+	parser := a.buildParser()
+	_, err := parser.ParseArgs(args)
+	if flags.WroteHelp(err) {
+		a.writeHelp(parser)
+	}
+	return err
+}
+
+// buildParser assembles the go-flags parser with every command
+// registered and fills the help index along the way. bbcli help <cmd>
+// builds a second parser to re-render another command's help.
+func (a *app) buildParser() *flags.Parser {
+	a.helpIndex = map[string]commandHelp{}
+	parser := flags.NewParser(&a.cfg, flags.HelpFlag|flags.PassDoubleDash)
+	parser.ShortDescription = "barterbackup command line client"
+
+	addCommand := func(name, short string, cmd flags.Commander) {
+		if _, err := parser.AddCommand(name, short, "", cmd); err != nil {
+			panic(err)
+		}
+		collectHelp(a.helpIndex, name, cmd)
+	}
+	addCommand("setup", "First-run wizard: unlock, wait for Tor, print the address", &setupCommand{app: a})
+	addCommand("unlock", "Unlock the daemon with the node password", &unlockCommand{app: a})
+	addCommand("lock", "Lock the daemon and wipe key material from memory", &lockCommand{app: a})
+	addCommand("status", "Show daemon and node status", &statusCommand{app: a})
+	addCommand("address", "Print the node's onion address", &addressCommand{app: a})
+	addCommand("healthcheck", "Check that the daemon is alive", &healthcheckCommand{app: a})
+	addCommand("doctor", "Diagnose common setup problems", &doctorCommand{app: a})
+	addCommand("audit", "Show or verify the security audit log", &auditCommand{app: a})
+	addCommand("mode", "Change the node's maintenance mode", &modeCommand{app: a})
+	addCommand("report", "Show daily activity summaries", &reportCommand{app: a})
+	addCommand("help", "Show help topics such as exit-codes", &helpCommand{app: a})
+	addCommand("peers", "Manage peers", &peersCommand{
+		app:    a,
+		Add:    peersAddCommand{app: a},
+		Invite: peersInviteCommand{app: a},
+		Invites: peersInvitesCommand{
+			app:    a,
+			List:   peersInvitesListCommand{app: a},
+			Revoke: peersInvitesRevokeCommand{app: a},
+		},
+		List: peersListCommand{app: a},
+		Show: peersShowCommand{app: a},
+		Group: peersGroupCommand{
+			app:    a,
+			Create: peersGroupCreateCommand{app: a},
+			List:   peersGroupListCommand{app: a},
+		},
+		Wipe:         peersWipeCommand{app: a},
+		Block:        peersBlockCommand{app: a},
+		Unblock:      peersUnblockCommand{app: a},
+		Blocked:      peersBlockedCommand{app: a},
+		Extend:       peersExtendCommand{app: a},
+		AnnounceMove: peersAnnounceMoveCommand{app: a},
+		SetOnionAuth: peersSetOnionAuthCommand{app: a},
+	})
+	addCommand("auth", "Manage clirpc credentials", &authCommand{
+		app:            a,
+		CreateReadonly: authCreateReadonlyCommand{app: a},
+	})
+	addCommand("identity", "Manage the node identity key", &identityCommand{
+		app:     a,
+		Migrate: identityMigrateCommand{app: a},
+	})
+	addCommand("msg", "Exchange text messages with peers", &msgCommand{
+		app:  a,
+		Send: msgSendCommand{app: a},
+		List: msgListCommand{app: a},
+	})
+	addCommand("backup", "Create, inspect, and restore backups", &backupCommand{
+		app:      a,
+		Create:   backupCreateCommand{app: a},
+		List:     backupListCommand{app: a},
+		Delete:   backupDeleteCommand{app: a},
+		Undelete: backupUndeleteCommand{app: a},
+		Diff:     backupDiffCommand{app: a},
+		Restore:  backupRestoreCommand{app: a},
+		Status:   backupStatusCommand{app: a},
+		Repair:   backupRepairCommand{app: a},
+		Verify:   backupVerifyCommand{app: a},
+	})
+	addCommand("recover", "Rebuild the backup index from a peer after data loss", &recoverCommand{app: a})
+	addCommand("job", "Control long-running backup, restore, and repair jobs", &jobCommand{
+		app:    a,
+		List:   jobListCommand{app: a},
+		Cancel: jobCancelCommand{app: a},
+		Pause:  jobPauseCommand{app: a},
+		Resume: jobResumeCommand{app: a},
+	})
+	addCommand("hosting", "Show what this node stores for peers", &hostingCommand{
+		app:     a,
+		List:    hostingListCommand{app: a},
+		Migrate: hostingMigrateCommand{app: a},
+	})
+	addCommand("balance", "Show the barter balance with each peer", &balanceCommand{app: a})
+	addCommand("storage", "Reconcile and acknowledge storage accounting", &storageCommand{
+		app:       a,
+		Reconcile: storageReconcileCommand{app: a},
+		AckDrift:  storageAckDriftCommand{app: a},
+	})
+	addCommand("config", "Change runtime daemon settings", &configCommand{
+		app: a,
+		Set: configSetCommand{app: a},
+	})
+	addCommand("agreements", "Manage storage agreements", &agreementsCommand{
+		app:     a,
+		List:    agreementsListCommand{app: a},
+		Propose: agreementsProposeCommand{app: a},
+		Accept:  agreementsAcceptCommand{app: a},
+	})
+
+	// rpc call is a debug escape hatch, not part of the supported
+	// surface; keep it out of --help.
+	rpcData := &rpcCommand{
+		app:  a,
+		Call: rpcCallCommand{app: a},
+	}
+	rpcCmd, err := parser.AddCommand("rpc", "Invoke raw clirpc methods (debug)", "", rpcData)
+	if err != nil {
+		panic(err)
+	}
+	rpcCmd.Hidden = true
+	collectHelp(a.helpIndex, "rpc", rpcData)
+	return parser
+}
+
+// openClient connects to the daemon and returns the clirpc client and a
+// close function.
+func (a *app) openClient(ctx context.Context) (pb.CLIClient, func(), error) {
+	cc, closeConn, err := a.openConn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pb.NewCLIClient(cc), closeConn, nil
+}
+
+// openConn connects to the daemon and returns the raw client connection,
+// for callers — like the rpc call escape hatch — that cannot use the
+// generated client.
+func (a *app) openConn(ctx context.Context) (*grpc.ClientConn, func(), error) {
+	if a.cfg.OTLPEndpoint != "" && a.flushTraces == nil {
+		shutdown, err := tracing.Setup(ctx, a.cfg.OTLPEndpoint, "bbcli")
+		if err != nil {
+			return nil, nil, fmt.Errorf("set up tracing: %w", err)
+		}
+		a.flushTraces = shutdown
+	}
+	keysDir := a.cfg.KeysDir
+	if keysDir == "" {
+		keysDir = filepath.Join(a.cfg.DataDir, "cli-keys")
+	}
+	tlsCfg, err := clitls.ReadKeys(keysDir)
+	if err != nil {
+		return nil, nil, &connectError{fmt.Errorf("load cli credentials (is bbd running?): %w", err)}
+	}
+	addr := a.cfg.DaemonAddr
+	if addr == "" {
+		// The daemon publishes its actual address next to the keys, so
+		// a daemon on an ephemeral --cli-addr port is found without
+		// flags.
+		if ep, err := clitls.ReadEndpoint(keysDir); err == nil {
+			addr = ep
+		} else {
+			addr = defaultDaemonAddr
+		}
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, a.cfg.ConnectTimeout)
+	defer cancel()
+	cc, err := grpc.DialContext(dialCtx, addr,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)),
+		grpc.WithBlock(),
+		// No-op interceptors unless --otlp-endpoint configured a
+		// tracer; the daemon continues the trace across the boundary.
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor()),
+	)
+	if err != nil {
+		return nil, nil, &connectError{fmt.Errorf("connect to daemon at %s: %w", addr, err)}
+	}
+	return cc, func() {
+		cc.Close()
+		if a.flushTraces != nil {
+			a.flushTraces(context.Background())
+			a.flushTraces = nil
+		}
+	}, nil
+}
+
+// rpcCtx returns a context bounded by the --timeout flag, for quick
+// daemon RPCs. Long-running operations use an unbounded context
+// instead.
+func (a *app) rpcCtx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), a.cfg.Timeout)
+}
+
+// printf, println, and print write command output to the configured
+// writer.
+func (a *app) printf(format string, v ...any) { fmt.Fprintf(a.out, format, v...) }
+func (a *app) println(v ...any)               { fmt.Fprintln(a.out, v...) }
+func (a *app) print(v ...any)                 { fmt.Fprint(a.out, v...) }
+
+// retry runs call up to 1+--retries times with doubling backoff, each
+// attempt under its own --timeout. Only idempotent read-only calls go
+// through here; anything with side effects — Unlock above all — must
+// not be auto-retried.
+func (a *app) retry(call func(ctx context.Context) error) error {
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := a.rpcCtx()
+		err := call(ctx)
+		cancel()
+		if err == nil || attempt >= a.cfg.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,1090 @@
+package bbcliapp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/clitls"
+)
+
+type unlockCommand struct {
+	app *app
+
+	PasswordFile string `long:"password-file" description:"Read the password from a file instead of prompting"`
+}
+
+func (c *unlockCommand) Execute(args []string) error {
+	password, err := readPassword(c.PasswordFile)
+	if err != nil {
+		return err
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	stopWatch := watchUnlockPhase(client)
+	resp, err := client.Unlock(context.Background(), &pb.UnlockRequest{Password: password})
+	stopWatch()
+	if err != nil {
+		return err
+	}
+	if resp.WasAlreadyUnlocked {
+		c.app.printf("already unlocked; onion address: %s\n", resp.Onion)
+	} else {
+		c.app.printf("unlocked; onion address: %s\n", resp.Onion)
+	}
+	return nil
+}
+
+// watchUnlockPhase polls GetStatus while an Unlock call is in flight
+// and notes on stderr which Tor registration phase the daemon is
+// waiting on, so a slow unlock is not silent. Display-only: polling
+// errors are swallowed. The returned func stops the watcher.
+func watchUnlockPhase(client pb.CLIClient) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		phase := ""
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			resp, err := client.GetStatus(ctx, &pb.GetStatusRequest{})
+			cancel()
+			if err != nil || resp.TorPhase == phase {
+				continue
+			}
+			phase = resp.TorPhase
+			switch phase {
+			case "bootstrap":
+				fmt.Fprintln(os.Stderr, "tor: bootstrapping...")
+			case "publish":
+				fmt.Fprintln(os.Stderr, "tor: publishing onion service...")
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// readPassword reads the node password from a file, or prompts on the
+// terminal without echo.
+func readPassword(passwordFile string) (string, error) {
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("read password file: %w", err)
+		}
+		return string(trimEOL(data)), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return string(raw), nil
+}
+
+// trimEOL removes one trailing newline (and optional carriage return).
+func trimEOL(data []byte) []byte {
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+		if n := len(data); n > 0 && data[n-1] == '\r' {
+			data = data[:n-1]
+		}
+	}
+	return data
+}
+
+type lockCommand struct {
+	app *app
+}
+
+func (c *lockCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.Lock(ctx, &pb.LockRequest{}); err != nil {
+		return err
+	}
+	c.app.println("locked; key material wiped from daemon memory")
+	return nil
+}
+
+type statusCommand struct {
+	app *app
+
+	JSON     bool          `long:"json" description:"Print the raw status as JSON; with --watch, one object per line"`
+	Watch    bool          `long:"watch" description:"Redraw the status every interval until interrupted"`
+	Interval time.Duration `long:"interval" default:"5s" description:"Refresh period for --watch"`
+}
+
+func (c *statusCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	if c.Watch {
+		return c.watch(client)
+	}
+	var resp *pb.GetStatusResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.GetStatus(ctx, &pb.GetStatusRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if c.JSON {
+		enc := json.NewEncoder(c.app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	c.printStatus(resp)
+	return nil
+}
+
+// printStatus writes the human-readable status block for one sample.
+func (c *statusCommand) printStatus(resp *pb.GetStatusResponse) {
+	c.app.printf("state: %s\n", resp.State)
+	if resp.Onion == "" && resp.CachedOnion != "" {
+		c.app.printf("onion: %s (cached, locked)\n", resp.CachedOnion)
+	}
+	if resp.Onion != "" {
+		c.app.printf("onion: %s\n", resp.Onion)
+		peers := fmt.Sprintf("peers: %d", resp.PeerCount)
+		if resp.UnreachablePeers > 0 {
+			peers += fmt.Sprintf(" (%d unreachable)", resp.UnreachablePeers)
+		}
+		c.app.println(peers)
+		if resp.ActiveStreams > 0 {
+			c.app.printf("active peer streams: %d\n", resp.ActiveStreams)
+		}
+		if resp.WarmConnections > 0 {
+			c.app.printf("warm connections: %d\n", resp.WarmConnections)
+		}
+		if resp.Mode != "" && resp.Mode != "normal" {
+			mode := fmt.Sprintf("mode: %s", resp.Mode)
+			if resp.DrainDeadlineUnix != 0 {
+				mode += fmt.Sprintf(" (fetches until %s)",
+					time.Unix(resp.DrainDeadlineUnix, 0).Format("15:04:05"))
+			}
+			c.app.println(mode)
+		}
+		if resp.TorVersion != "" {
+			c.app.printf("tor: %s\n", resp.TorVersion)
+		}
+		if resp.TorLocalListener != "" {
+			c.app.printf("onion listener: %s (onion port %d)\n",
+				resp.TorLocalListener, resp.TorOnionPort)
+		}
+		if resp.OnionStateWarning != "" {
+			c.app.printf("tor state: WARNING: %s\n", resp.OnionStateWarning)
+		}
+		if resp.TorPid != 0 {
+			c.app.printf("tor process: pid %d, %s RSS, %.0fs CPU\n",
+				resp.TorPid, formatBytes(resp.TorRssBytes), resp.TorCpuSeconds)
+		}
+	}
+	switch resp.Health {
+	case "ok":
+		c.app.printf("reachability: ok (self-dial %dms at %s)\n", resp.SelfCheckLatencyMs,
+			time.Unix(resp.LastSelfCheckUnix, 0).Format("15:04:05"))
+	case "degraded":
+		c.app.printf("reachability: DEGRADED: %s\n", resp.HealthError)
+	}
+	if resp.NetworkRecovering {
+		c.app.printf("network: down since %s, republish attempt %d: %s\n",
+			time.Unix(resp.NetworkLastFailureUnix, 0).Format("15:04:05"),
+			resp.NetworkRecoveryAttempts, resp.NetworkLastFailure)
+	} else if resp.NetworkRecoveryAttempts > 0 {
+		c.app.printf("network: recovered after %d attempts (last failure %s)\n",
+			resp.NetworkRecoveryAttempts,
+			time.Unix(resp.NetworkLastFailureUnix, 0).Format("15:04:05"))
+	}
+	if resp.OutboundAttempts >= outboundWarnMinAttempts && resp.OutboundSuccessRate < outboundWarnRate {
+		c.app.printf("outbound: only %.0f%% of %d peer contacts succeeded in 24h — if most peers are flaky at once, the local Tor connection is the likely problem\n",
+			100*resp.OutboundSuccessRate, resp.OutboundAttempts)
+	}
+	if resp.StorageDrift != "" {
+		c.app.printf("storage: drift detected at %s: %s (run bbcli storage ack-drift after checking)\n",
+			time.Unix(resp.StorageDriftDetectedUnix, 0).Format("2006-01-02 15:04"), resp.StorageDrift)
+	}
+	if resp.State == "unlocked" {
+		disk := fmt.Sprintf("disk: %s free", formatBytes(resp.DiskFreeBytes))
+		if resp.DiskThreshold != "" {
+			disk += fmt.Sprintf(" (below %s threshold, not accepting peer data)", resp.DiskThreshold)
+		}
+		c.app.println(disk)
+	}
+	for _, e := range resp.Expirations {
+		name := e.Onion
+		if e.Alias != "" {
+			name = fmt.Sprintf("%s (%s)", e.Alias, e.Onion)
+		}
+		line := fmt.Sprintf("stored data for %s expires %s", name,
+			time.Unix(e.ExpiresAtUnix, 0).Format("2006-01-02"))
+		if e.InGrace {
+			line = fmt.Sprintf("stored data for %s EXPIRED, deleted on %s unless renewed", name,
+				time.Unix(e.DeleteAtUnix, 0).Format("2006-01-02"))
+		}
+		c.app.println(line)
+	}
+	if resp.UnreadMessages > 0 {
+		c.app.printf("unread messages: %d (run bbcli msg list)\n", resp.UnreadMessages)
+	}
+	if resp.RunningJobs > 0 {
+		c.app.printf("running jobs: %d (run bbcli job list)\n", resp.RunningJobs)
+	}
+}
+
+type healthcheckCommand struct {
+	app *app
+}
+
+func (c *healthcheckCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.LocalHealthCheckResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.LocalHealthCheck(ctx, &pb.LocalHealthCheckRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	line := fmt.Sprintf("daemon ok, up %s", (time.Duration(resp.UptimeSeconds) * time.Second).String())
+	if resp.NodeUptimeSeconds > 0 {
+		line += fmt.Sprintf("; node up %s", (time.Duration(resp.NodeUptimeSeconds) * time.Second).String())
+	} else if resp.CachedOnion != "" {
+		line += fmt.Sprintf("; locked, cached onion %s", resp.CachedOnion)
+	}
+	c.app.println(line)
+	return nil
+}
+
+type peersCommand struct {
+	app *app
+
+	Add          peersAddCommand          `command:"add" description:"Authorize a peer by onion address"`
+	Invite       peersInviteCommand       `command:"invite" description:"Issue a single-use invite code"`
+	Invites      peersInvitesCommand      `command:"invites" description:"List or revoke issued invites"`
+	List         peersListCommand         `command:"list" description:"List registered peers"`
+	Show         peersShowCommand         `command:"show" description:"Show one peer's trust and storage breakdown"`
+	Group        peersGroupCommand        `command:"group" description:"Manage named peer groups"`
+	Wipe         peersWipeCommand         `command:"wipe" description:"Remove a peer and delete everything stored for them"`
+	Block        peersBlockCommand        `command:"block" description:"Refuse all contact from an onion address"`
+	Unblock      peersUnblockCommand      `command:"unblock" description:"Remove an address from the blocklist"`
+	Blocked      peersBlockedCommand      `command:"blocked" description:"List blocked addresses with contact attempts"`
+	Extend       peersExtendCommand       `command:"extend" description:"Propose renewing the storage agreement with a peer"`
+	AnnounceMove peersAnnounceMoveCommand `command:"announce-move" description:"Re-send the address-change notice to all peers"`
+	SetOnionAuth peersSetOnionAuthCommand `command:"set-onion-auth" description:"Require Tor client authorization on the onion service"`
+}
+
+func (c *peersCommand) Execute(args []string) error { return nil }
+
+type peersAddCommand struct {
+	app *app
+
+	Alias string `long:"alias" description:"Local name for the peer (overrides the URI's name parameter)"`
+	Args  struct {
+		Onion string `positional-arg-name:"onion-or-uri" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersAddCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	_, err = client.AddPeer(ctx, &pb.AddPeerRequest{
+		Onion: c.Args.Onion,
+		Alias: c.Alias,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("added peer %s\n", c.Args.Onion)
+	return nil
+}
+
+type peersInviteCommand struct {
+	app *app
+
+	TTL   time.Duration `long:"ttl" default:"24h" description:"How long the invite stays redeemable"`
+	Label string        `long:"label" description:"Note on who the invite is for"`
+}
+
+func (c *peersInviteCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.CreateInvite(ctx, &pb.CreateInviteRequest{
+		TtlSeconds: int64(c.TTL / time.Second),
+		Label:      c.Label,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.println(resp.Uri)
+	c.app.printf("invite %s can be redeemed once, until %s\n", resp.Id,
+		time.Unix(resp.ExpiresAtUnix, 0).Format("2006-01-02 15:04"))
+	return nil
+}
+
+type peersInvitesCommand struct {
+	app *app
+
+	List   peersInvitesListCommand   `command:"list" description:"List issued invites"`
+	Revoke peersInvitesRevokeCommand `command:"revoke" description:"Withdraw an unredeemed invite"`
+}
+
+func (c *peersInvitesCommand) Execute(args []string) error { return nil }
+
+type peersInvitesListCommand struct {
+	app *app
+}
+
+func (c *peersInvitesListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListInvitesResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListInvites(ctx, &pb.ListInvitesRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, inv := range resp.Invites {
+		label := inv.Label
+		if label == "" {
+			label = "-"
+		}
+		line := fmt.Sprintf("%s\t%s\t%s", inv.Id, inv.State, label)
+		switch inv.State {
+		case "used":
+			line += fmt.Sprintf("\tby %s at %s", inv.UsedBy,
+				time.Unix(inv.UsedAtUnix, 0).Format("2006-01-02 15:04"))
+		case "issued":
+			line += fmt.Sprintf("\texpires %s",
+				time.Unix(inv.ExpiresAtUnix, 0).Format("2006-01-02 15:04"))
+		}
+		c.app.println(line)
+	}
+	return nil
+}
+
+type peersInvitesRevokeCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"invite-id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersInvitesRevokeCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.RevokeInvite(ctx, &pb.RevokeInviteRequest{Id: c.Args.ID}); err != nil {
+		return err
+	}
+	c.app.printf("revoked invite %s\n", c.Args.ID)
+	return nil
+}
+
+type peersListCommand struct {
+	app *app
+
+	Sort  string `long:"sort" choice:"onion" choice:"name" choice:"date" description:"Order: by onion address (default), alias, or date added (newest first)"`
+	Limit int    `long:"limit" description:"Stop after this many peers (0 lists all)"`
+}
+
+func (c *peersListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var peers []*pb.PeerInfo
+	token := ""
+	for {
+		var resp *pb.ListPeersResponse
+		err = c.app.retry(func(ctx context.Context) error {
+			resp, err = client.ListPeers(ctx, &pb.ListPeersRequest{PageToken: token, Sort: c.Sort})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		peers = append(peers, resp.Peers...)
+		if c.Limit > 0 && len(peers) >= c.Limit {
+			peers = peers[:c.Limit]
+			break
+		}
+		token = resp.NextPageToken
+		if token == "" {
+			break
+		}
+	}
+	for _, p := range peers {
+		alias := p.Alias
+		if alias == "" {
+			alias = "-"
+		}
+		line := fmt.Sprintf("%s\t%s\tadded %s\tlast seen %s", alias, p.Onion,
+			time.Unix(p.AddedAtUnix, 0).Format("2006-01-02"),
+			formatAgo(p.LastSeenUnix))
+		if p.ActiveStreams > 0 {
+			line += fmt.Sprintf("\t%d active streams", p.ActiveStreams)
+		}
+		if p.Mode != "" && p.Mode != "normal" {
+			line += fmt.Sprintf("\tmaintenance: %s", p.Mode)
+		}
+		if p.ProbeFailures >= unreachableProbes {
+			line += fmt.Sprintf("\tUNREACHABLE (%d failed probes)", p.ProbeFailures)
+		}
+		if p.BreakerState != "" {
+			line += fmt.Sprintf("\tbreaker %s", p.BreakerState)
+		}
+		c.app.println(line)
+	}
+	return nil
+}
+
+type peersShowCommand struct {
+	app *app
+
+	JSON bool `long:"json" description:"Print the raw peer details as JSON"`
+	Args struct {
+		Peer string `positional-arg-name:"alias-or-onion" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersShowCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.GetPeerResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.GetPeer(ctx, &pb.GetPeerRequest{Peer: c.Args.Peer})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if c.JSON {
+		enc := json.NewEncoder(c.app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	p := resp.Peer
+	if p.Alias != "" {
+		c.app.printf("alias: %s\n", p.Alias)
+	}
+	c.app.printf("onion: %s\n", p.Onion)
+	c.app.printf("added: %s\n", time.Unix(p.AddedAtUnix, 0).Format("2006-01-02"))
+	c.app.printf("last seen: %s\n", formatAgo(p.LastSeenUnix))
+	if resp.AvgPingMs > 0 {
+		c.app.printf("avg ping: %dms\n", resp.AvgPingMs)
+	}
+	if a := resp.Agreement; a != nil {
+		expiry := ""
+		if a.ExpiresAtUnix != 0 {
+			expiry = fmt.Sprintf(", expires %s", time.Unix(a.ExpiresAtUnix, 0).Format("2006-01-02"))
+		}
+		c.app.printf("agreement: %s, offer %s / request %s, %d days%s\n",
+			a.State, formatBytes(a.OfferedBytes), formatBytes(a.RequestedBytes), a.Days, expiry)
+	} else {
+		c.app.println("agreement: none")
+	}
+	c.app.printf("stores here: %s\n", formatBytes(resp.StoredForPeerBytes))
+	c.app.printf("stores for me: %s\n", formatBytes(resp.StoredAtPeerBytes))
+	c.app.printf("uploaded to them (30d): %s\n", formatBytes(resp.UploadedBytes))
+	if total := resp.AuditsPassed + resp.AuditsFailed; total > 0 {
+		c.app.printf("audits (30d): %d passed / %d failed (%.0f%% pass rate)\n",
+			resp.AuditsPassed, resp.AuditsFailed, 100*float64(resp.AuditsPassed)/float64(total))
+	}
+	if resp.UnreadMessages > 0 {
+		c.app.printf("unread messages: %d\n", resp.UnreadMessages)
+	}
+	if p.ActiveStreams > 0 {
+		c.app.printf("active streams: %d\n", p.ActiveStreams)
+	}
+	if resp.RpcSentBytes > 0 || resp.RpcRecvBytes > 0 {
+		c.app.printf("rpc traffic: %s sent (%s on wire), %s received (%s on wire)\n",
+			formatBytes(resp.RpcSentBytes), formatBytes(resp.RpcSentWireBytes),
+			formatBytes(resp.RpcRecvBytes), formatBytes(resp.RpcRecvWireBytes))
+	}
+	if row := reachSparkline(resp.ReachHistory); row != "" {
+		c.app.printf("reachability (24h): %s  (█ ok ▁ failed ▄ mixed · idle)\n", row)
+	}
+	if p.Mode != "" && p.Mode != "normal" {
+		c.app.printf("maintenance: %s\n", p.Mode)
+	}
+	if p.ProbeFailures >= unreachableProbes {
+		c.app.printf("UNREACHABLE (%d failed probes)\n", p.ProbeFailures)
+	}
+	switch p.BreakerState {
+	case "open":
+		line := "breaker: open (background jobs skip this peer)"
+		if p.BreakerRetryAtUnix != 0 {
+			if wait := time.Until(time.Unix(p.BreakerRetryAtUnix, 0)); wait > 0 {
+				line += fmt.Sprintf(", next probe in %s", wait.Round(time.Minute))
+			}
+		}
+		c.app.println(line)
+	case "half-open":
+		c.app.println("breaker: half-open (trial call in flight)")
+	}
+	return nil
+}
+
+// unreachableProbes mirrors the daemon's threshold for flagging a peer
+// as unreachable.
+const unreachableProbes = 3
+
+// The outbound success warning needs a meaningful sample before it
+// blames the local transport.
+const (
+	outboundWarnMinAttempts = 10
+	outboundWarnRate        = 0.8
+)
+
+// reachSparkline compresses the daemon's five-minute reachability
+// buckets into one character per half hour: '█' all contacts succeeded,
+// '▁' all failed, '▄' mixed, '·' no contact. Empty when the whole
+// window is idle.
+func reachSparkline(states []int32) string {
+	const perChar = 6 // 6 five-minute buckets per character
+	var row []rune
+	sawContact := false
+	for start := 0; start < len(states); start += perChar {
+		var ok, fail bool
+		for i := start; i < start+perChar && i < len(states); i++ {
+			switch states[i] {
+			case 1:
+				ok = true
+			case 2:
+				fail = true
+			case 3:
+				ok, fail = true, true
+			}
+		}
+		switch {
+		case ok && fail:
+			row = append(row, '▄')
+		case ok:
+			row = append(row, '█')
+		case fail:
+			row = append(row, '▁')
+		default:
+			row = append(row, '·')
+		}
+		sawContact = sawContact || ok || fail
+	}
+	if !sawContact {
+		return ""
+	}
+	return string(row)
+}
+
+// formatAgo renders a unix timestamp as a rough age like "3d ago".
+func formatAgo(unix int64) string {
+	if unix == 0 {
+		return "never"
+	}
+	age := time.Since(time.Unix(unix, 0))
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
+}
+
+type peersGroupCommand struct {
+	app *app
+
+	Create peersGroupCreateCommand `command:"create" description:"Define a named group of peers"`
+	List   peersGroupListCommand   `command:"list" description:"List peer groups"`
+}
+
+func (c *peersGroupCommand) Execute(args []string) error { return nil }
+
+type peersGroupCreateCommand struct {
+	app *app
+
+	Args struct {
+		Name    string   `positional-arg-name:"name" required:"true"`
+		Members []string `positional-arg-name:"peer" required:"1"`
+	} `positional-args:"true"`
+}
+
+func (c *peersGroupCreateCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	_, err = client.CreatePeerGroup(ctx, &pb.CreatePeerGroupRequest{
+		Name:    c.Args.Name,
+		Members: c.Args.Members,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("group %s: %d members\n", c.Args.Name, len(c.Args.Members))
+	return nil
+}
+
+type peersGroupListCommand struct {
+	app *app
+}
+
+func (c *peersGroupListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListPeerGroupsResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListPeerGroups(ctx, &pb.ListPeerGroupsRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range resp.Groups {
+		c.app.printf("%s\t%d members\n", g.Name, len(g.Members))
+		for _, m := range g.Members {
+			c.app.printf("  %s\n", m)
+		}
+	}
+	return nil
+}
+
+type peersWipeCommand struct {
+	app *app
+
+	Yes  bool `long:"yes" description:"Skip the confirmation prompt"`
+	Args struct {
+		Peer string `positional-arg-name:"alias-or-onion" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersWipeCommand) Execute(args []string) error {
+	if !c.Yes {
+		c.app.printf("This permanently deletes %s's chunks, manifests, messages,\n", c.Args.Peer)
+		c.app.println("agreements, and report history, and removes them as a peer.")
+		c.app.print("Proceed? [y/N] ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+			return fmt.Errorf("aborted")
+		}
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.WipePeer(ctx, &pb.WipePeerRequest{Peer: c.Args.Peer})
+	if err != nil {
+		return err
+	}
+	c.app.printf("wiping peer %s in background job %s\n", resp.Onion, resp.JobId)
+	c.app.println("watch progress with bbcli job list")
+	return nil
+}
+
+type peersBlockCommand struct {
+	app *app
+
+	AndWipe bool `long:"and-wipe" description:"Also wipe a registered peer's data, as bbcli peers wipe would"`
+	Args    struct {
+		Peer string `positional-arg-name:"alias-or-onion" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersBlockCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.BlockPeer(ctx, &pb.BlockPeerRequest{
+		Peer:    c.Args.Peer,
+		AndWipe: c.AndWipe,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("blocked %s\n", resp.Onion)
+	if resp.WipeJobId != "" {
+		c.app.printf("wiping their data in background job %s\n", resp.WipeJobId)
+		c.app.println("watch progress with bbcli job list")
+	}
+	return nil
+}
+
+type peersUnblockCommand struct {
+	app *app
+
+	Args struct {
+		Onion string `positional-arg-name:"onion" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersUnblockCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.UnblockPeer(ctx, &pb.UnblockPeerRequest{Onion: c.Args.Onion}); err != nil {
+		return err
+	}
+	c.app.printf("unblocked %s\n", c.Args.Onion)
+	return nil
+}
+
+type peersBlockedCommand struct {
+	app *app
+}
+
+func (c *peersBlockedCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListBlockedPeersResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListBlockedPeers(ctx, &pb.ListBlockedPeersRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, b := range resp.Blocked {
+		c.app.printf("%s\tblocked %s\t%d attempts\tlast %s\n", b.Onion,
+			time.Unix(b.BlockedAtUnix, 0).Format("2006-01-02"),
+			b.Attempts, formatAgo(b.LastAttemptUnix))
+	}
+	return nil
+}
+
+type peersExtendCommand struct {
+	app *app
+
+	Days int32 `long:"days" default:"90" description:"Duration of the renewed agreement in days"`
+	Args struct {
+		Peer string `positional-arg-name:"alias-or-onion" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersExtendCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	resp, err := client.ExtendAgreement(context.Background(), &pb.ExtendAgreementRequest{
+		Peer: c.Args.Peer,
+		Days: c.Days,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("proposed renewal %s to %s (%d days)\n",
+		resp.Agreement.Id, resp.Agreement.Acceptor, resp.Agreement.Days)
+	c.app.println("the peer still has to accept it with bbcli agreements accept")
+	return nil
+}
+
+type peersAnnounceMoveCommand struct {
+	app *app
+}
+
+func (c *peersAnnounceMoveCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	// Reaching every peer over Tor can take a while; no --timeout here.
+	resp, err := client.AnnounceMove(context.Background(), &pb.AnnounceMoveRequest{})
+	if err != nil {
+		return err
+	}
+	acked := 0
+	for _, ack := range resp.Acks {
+		name := ack.Onion
+		if ack.Alias != "" {
+			name = fmt.Sprintf("%s (%s)", ack.Alias, ack.Onion)
+		}
+		if ack.Error == "" {
+			acked++
+			c.app.printf("%s: acknowledged\n", name)
+		} else {
+			c.app.printf("%s: %s\n", name, ack.Error)
+		}
+	}
+	c.app.printf("%d of %d peers acknowledged the move\n", acked, len(resp.Acks))
+	return nil
+}
+
+type authCommand struct {
+	app *app
+
+	CreateReadonly authCreateReadonlyCommand `command:"create-readonly" description:"Mint read-only credentials for a monitoring agent"`
+}
+
+func (c *authCommand) Execute(args []string) error { return nil }
+
+type authCreateReadonlyCommand struct {
+	app *app
+
+	Out string `long:"out" required:"true" description:"Directory to write the credentials into; pass it back as --keys-dir"`
+}
+
+func (c *authCreateReadonlyCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.CreateReadonlyCreds(ctx, &pb.CreateReadonlyCredsRequest{})
+	if err != nil {
+		return err
+	}
+	srcDir := c.app.cfg.KeysDir
+	if srcDir == "" {
+		srcDir = filepath.Join(c.app.cfg.DataDir, "cli-keys")
+	}
+	if err := clitls.WriteMintedKeys(c.Out, srcDir, resp.ClientCert, resp.ClientKey); err != nil {
+		return err
+	}
+	c.app.printf("read-only credentials written to %s\n", c.Out)
+	c.app.printf("use them with bbcli --keys-dir %s; they are valid until the daemon restarts\n", c.Out)
+	return nil
+}
+
+type identityCommand struct {
+	app *app
+
+	Migrate identityMigrateCommand `command:"migrate" description:"Switch to a stored identity key (one-way; the onion address changes)"`
+}
+
+func (c *identityCommand) Execute(args []string) error { return nil }
+
+type identityMigrateCommand struct {
+	app *app
+
+	Yes bool `long:"yes" description:"Skip the confirmation prompt"`
+}
+
+func (c *identityMigrateCommand) Execute(args []string) error {
+	if !c.Yes {
+		c.app.println("This replaces the password-derived onion key with a random one")
+		c.app.println("sealed in the data dir. The onion address changes, the migration")
+		c.app.println("cannot be undone, and the new address takes over at the next unlock.")
+		c.app.print("Proceed? [y/N] ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+			return fmt.Errorf("aborted")
+		}
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	// Notifying every peer over Tor can take a while; no --timeout here.
+	resp, err := client.MigrateIdentity(context.Background(), &pb.MigrateIdentityRequest{})
+	if err != nil {
+		return err
+	}
+	c.app.printf("new address: %s (%d peers notified)\n", resp.NewOnion, resp.PeersNotified)
+	c.app.println("it takes over at the next unlock; peers that missed the notice need it out of band")
+	return nil
+}
+
+type peersSetOnionAuthCommand struct {
+	app *app
+
+	Args struct {
+		Mode string `positional-arg-name:"on|off" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *peersSetOnionAuthCommand) Execute(args []string) error {
+	var enabled bool
+	switch c.Args.Mode {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return fmt.Errorf("expected \"on\" or \"off\", got %q", c.Args.Mode)
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.SetOnionAuth(ctx, &pb.SetOnionAuthRequest{Enabled: enabled}); err != nil {
+		return err
+	}
+	if enabled {
+		c.app.println("onion client authorization enabled; only registered peers can reach the node")
+	} else {
+		c.app.println("onion client authorization disabled")
+	}
+	return nil
+}
+
+type msgCommand struct {
+	app *app
+
+	Send msgSendCommand `command:"send" description:"Send a text message to a peer"`
+	List msgListCommand `command:"list" description:"List exchanged messages"`
+}
+
+func (c *msgCommand) Execute(args []string) error { return nil }
+
+type msgSendCommand struct {
+	app *app
+
+	Args struct {
+		Peer string `positional-arg-name:"peer" required:"true"`
+		Body string `positional-arg-name:"message" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *msgSendCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	_, err = client.SendMessage(context.Background(), &pb.SendMessageRequest{
+		Peer: c.Args.Peer,
+		Body: c.Args.Body,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.println("sent")
+	return nil
+}
+
+type msgListCommand struct {
+	app *app
+
+	Peer     string `long:"peer" description:"Filter by peer alias or onion address"`
+	MarkRead bool   `long:"mark-read" description:"Mark listed incoming messages as read"`
+}
+
+func (c *msgListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListMessagesResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListMessages(ctx, &pb.ListMessagesRequest{Peer: c.Peer})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var unreadIDs []string
+	for _, m := range resp.Messages {
+		direction := "->"
+		if m.Incoming {
+			direction = "<-"
+			if !m.Read {
+				unreadIDs = append(unreadIDs, m.Id)
+			}
+		}
+		marker := " "
+		if m.Incoming && !m.Read {
+			marker = "*"
+		}
+		c.app.printf("%s %s %s %s  %s\n", marker,
+			time.Unix(m.SentAtUnix, 0).Format("2006-01-02 15:04"),
+			direction, m.Peer, m.Body)
+	}
+	if c.MarkRead && len(unreadIDs) > 0 {
+		ctx, cancel := c.app.rpcCtx()
+		defer cancel()
+		if _, err := client.MarkRead(ctx, &pb.MarkReadRequest{Ids: unreadIDs}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package bbcliapp
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type configCommand struct {
+	app *app
+
+	Set configSetCommand `command:"set" description:"Change runtime daemon settings"`
+}
+
+func (c *configCommand) Execute(args []string) error { return nil }
+
+type configSetCommand struct {
+	app *app
+
+	DiskSoftBytes     int64         `long:"disk-soft-bytes" description:"Free-space soft threshold; below it the node stops accepting peer data"`
+	DiskHardBytes     int64         `long:"disk-hard-bytes" description:"Free-space hard threshold; below it running jobs are paused too"`
+	DiskCheckInterval time.Duration `long:"disk-check-interval" description:"How often free space is measured, e.g. 30s or 5m"`
+	TrashGraceDays    int32         `long:"trash-grace-days" description:"Days an expired peer's data is kept before deletion"`
+	BackupTrashDays   int32         `long:"backup-trash-days" description:"Days a deleted backup stays undeletable before its chunks are purged"`
+	BalanceNudgeRatio float64       `long:"balance-nudge-ratio" description:"Nudge a peer when it stores this many times more here than it holds for us; negative disables nudges"`
+}
+
+func (c *configSetCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.SetConfig(ctx, &pb.SetConfigRequest{
+		DiskSoftBytes:            c.DiskSoftBytes,
+		DiskHardBytes:            c.DiskHardBytes,
+		DiskCheckIntervalSeconds: int64(c.DiskCheckInterval / time.Second),
+		TrashGraceDays:           c.TrashGraceDays,
+		BackupTrashDays:          c.BackupTrashDays,
+		BalanceNudgeRatio:        c.BalanceNudgeRatio,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("disk watchdog: soft %s, hard %s, check every %s\n",
+		formatBytes(resp.DiskSoftBytes), formatBytes(resp.DiskHardBytes),
+		(time.Duration(resp.DiskCheckIntervalSeconds) * time.Second).String())
+	c.app.printf("retention: expired peer data kept %d days, deleted backups kept %d days\n",
+		resp.TrashGraceDays, resp.BackupTrashDays)
+	if resp.BalanceNudgeRatio > 0 {
+		c.app.printf("balance nudges: above %gx imbalance\n", resp.BalanceNudgeRatio)
+	} else {
+		c.app.println("balance nudges: disabled")
+	}
+	if len(resp.BackupRoots) > 0 {
+		c.app.printf("backup roots: %s\n", strings.Join(resp.BackupRoots, ", "))
+	} else {
+		c.app.println("backup roots: unrestricted")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+// doctorTimeout bounds the whole diagnostic run, dominated by the onion
+// self-dial on the daemon side.
+const doctorTimeout = 2 * time.Minute
+
+type doctorCommand struct {
+	app *app
+}
+
+func (c *doctorCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	resp, err := client.RunDiagnostics(ctx, &pb.RunDiagnosticsRequest{})
+	if err != nil {
+		return err
+	}
+
+	f, isFile := c.app.out.(*os.File)
+	colors := isFile && term.IsTerminal(int(f.Fd()))
+	failed := 0
+	for _, check := range resp.Checks {
+		if check.Status == "fail" {
+			failed++
+		}
+		c.app.printf("%s %-12s %s\n", statusBadge(check.Status, colors), check.Name, check.Details)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+func statusBadge(status string, colors bool) string {
+	if !colors {
+		return fmt.Sprintf("[%s]", status)
+	}
+	switch status {
+	case "pass":
+		return "\x1b[32m[pass]\x1b[0m"
+	case "warn":
+		return "\x1b[33m[warn]\x1b[0m"
+	default:
+		return "\x1b[31m[fail]\x1b[0m"
+	}
+}
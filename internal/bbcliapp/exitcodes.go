@@ -0,0 +1,123 @@
+package bbcliapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	flags "github.com/jessevdk/go-flags"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// connectError marks failures to reach the daemon at all — missing cli
+// credentials or a refused or failed dial — so they map to their own
+// exit code instead of a generic RPC failure.
+type connectError struct {
+	err error
+}
+
+func (e *connectError) Error() string { return e.err.Error() }
+func (e *connectError) Unwrap() error { return e.err }
+
+// exitCodeInfo is one row of the exit-code policy. The same table
+// drives both ExitCode and `bbcli help exit-codes`, so the docs cannot
+// drift from the behavior.
+type exitCodeInfo struct {
+	code int
+	desc string
+}
+
+var exitCodes = []exitCodeInfo{
+	{0, "success"},
+	{1, "generic RPC failure"},
+	{2, "usage error (bad flags or arguments)"},
+	{3, "cannot connect to the daemon (is bbd running?)"},
+	{4, "authentication or permission failure (e.g. wrong password)"},
+	{5, "operation not allowed in the current state (e.g. daemon locked)"},
+	{6, "requested item not found"},
+	{7, "operation timed out"},
+}
+
+// ExitCode maps the error Run returned to the documented exit code, so
+// scripts can tell a stopped daemon from a wrong password from an
+// unreachable peer.
+func ExitCode(err error) int {
+	if err == nil || flags.WroteHelp(err) {
+		return 0
+	}
+	var flagsErr *flags.Error
+	if errors.As(err, &flagsErr) {
+		return 2
+	}
+	var connErr *connectError
+	if errors.As(err, &connErr) {
+		return 3
+	}
+	switch grpcCode(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return 4
+	case codes.FailedPrecondition:
+		return 5
+	case codes.NotFound:
+		return 6
+	case codes.DeadlineExceeded:
+		return 7
+	}
+	return 1
+}
+
+// grpcCode extracts the gRPC status code from err, looking through
+// wrapping.
+func grpcCode(err error) codes.Code {
+	type grpcStatus interface{ GRPCStatus() *status.Status }
+	var gs grpcStatus
+	if errors.As(err, &gs) {
+		return gs.GRPCStatus().Code()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded
+	}
+	return codes.Unknown
+}
+
+type helpCommand struct {
+	app *app
+
+	Args struct {
+		Topic string   `positional-arg-name:"topic" description:"Help topic (e.g. exit-codes) or command (e.g. backup)"`
+		Sub   []string `positional-arg-name:"subcommand"`
+	} `positional-args:"yes"`
+}
+
+func (c *helpCommand) Execute(args []string) error {
+	switch c.Args.Topic {
+	case "exit-codes":
+		c.app.println("bbcli exit codes:")
+		for _, ec := range exitCodes {
+			c.app.printf("  %d  %s\n", ec.code, ec.desc)
+		}
+		return nil
+	case "":
+		return fmt.Errorf("missing help topic (available: exit-codes, or any command name)")
+	default:
+		return c.commandHelp(append([]string{c.Args.Topic}, c.Args.Sub...))
+	}
+}
+
+// commandHelp makes `bbcli help backup create` an alias for
+// `bbcli backup create --help`: a fresh parser re-parses the path with
+// --help appended and its help is rendered the usual way.
+func (c *helpCommand) commandHelp(parts []string) error {
+	if _, ok := c.app.helpIndex[strings.Join(parts, " ")]; !ok {
+		return fmt.Errorf("unknown help topic %q (available: exit-codes, or any command name)",
+			strings.Join(parts, " "))
+	}
+	parser := c.app.buildParser()
+	if _, err := parser.ParseArgs(append(parts, "--help")); !flags.WroteHelp(err) {
+		return err
+	}
+	c.app.writeHelp(parser)
+	return nil
+}
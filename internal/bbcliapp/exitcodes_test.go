@@ -0,0 +1,95 @@
+package bbcliapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/clitls"
+)
+
+func TestExitCodeMapping(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("something else"), 1},
+		{&connectError{errors.New("dial tcp: refused")}, 3},
+		{status.Error(codes.PermissionDenied, "wrong password"), 4},
+		{status.Error(codes.Unauthenticated, "no cert"), 4},
+		{status.Error(codes.FailedPrecondition, "locked"), 5},
+		{status.Error(codes.NotFound, "no such backup"), 6},
+		{status.Error(codes.DeadlineExceeded, "too slow"), 7},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), 7},
+		{fmt.Errorf("wrapped: %w", status.Error(codes.NotFound, "gone")), 6},
+	}
+	for _, tc := range cases {
+		if got := ExitCode(tc.err); got != tc.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+// slowCLI answers GetStatus slower than the test's --timeout.
+type slowCLI struct {
+	pb.UnimplementedCLIServer
+}
+
+func (s *slowCLI) GetStatus(ctx context.Context, req *pb.GetStatusRequest) (*pb.GetStatusResponse, error) {
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+	}
+	return &pb.GetStatusResponse{State: "locked"}, nil
+}
+
+func TestTimeoutMapsToDeadlineExitCode(t *testing.T) {
+	dir := t.TempDir()
+	serverKeys, err := clitls.WriteKeys(filepath.Join(dir, "cli-keys"))
+	if err != nil {
+		t.Fatalf("WriteKeys: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverKeys.TLSConfig())))
+	pb.RegisterCLIServer(srv, &slowCLI{})
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	a := &app{cfg: Config{
+		DataDir:        dir,
+		DaemonAddr:     ln.Addr().String(),
+		Timeout:        time.Millisecond,
+		ConnectTimeout: 5 * time.Second,
+		Retries:        1,
+	}}
+	client, closeClient, err := a.openClient(context.Background())
+	if err != nil {
+		t.Fatalf("openClient: %v", err)
+	}
+	defer closeClient()
+
+	err = a.retry(func(ctx context.Context) error {
+		_, err := client.GetStatus(ctx, &pb.GetStatusRequest{})
+		return err
+	})
+	if err == nil {
+		t.Fatal("GetStatus with 1ms timeout succeeded")
+	}
+	if got := ExitCode(err); got != 7 {
+		t.Errorf("ExitCode(%v) = %d, want 7", err, got)
+	}
+}
@@ -0,0 +1,97 @@
+package bbcliapp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	flags "github.com/jessevdk/go-flags"
+	"golang.org/x/term"
+)
+
+// commandHelp supplements the flag listing go-flags generates with a
+// longer description and complete example invocations. Every command
+// provides one via its help() method; TestEveryCommandHasExamples
+// enforces that so a new command cannot ship without examples.
+type commandHelp struct {
+	// long is shown as a wrapped paragraph under the flag listing.
+	long string
+	// examples are complete invocations, printed verbatim.
+	examples []string
+}
+
+type helpProvider interface{ help() commandHelp }
+
+// collectHelp records cmd's help under path and recurses into the
+// subcommands declared as `command:"..."` struct fields, mirroring how
+// go-flags discovers them.
+func collectHelp(index map[string]commandHelp, path string, cmd interface{}) {
+	if hp, ok := cmd.(helpProvider); ok {
+		index[path] = hp.help()
+	}
+	v := reflect.ValueOf(cmd).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("command")
+		if name == "" {
+			continue
+		}
+		collectHelp(index, path+" "+name, v.Field(i).Addr().Interface())
+	}
+}
+
+// writeHelp renders help for the command active in p: the go-flags
+// usage and flag listing, then the command's long description and
+// examples. The description wraps to the terminal width; without a
+// terminal a fixed 80 columns keeps piped output readable.
+func (a *app) writeHelp(p *flags.Parser) {
+	p.WriteHelp(a.out)
+	var parts []string
+	for cmd := p.Active; cmd != nil; cmd = cmd.Active {
+		parts = append(parts, cmd.Name)
+	}
+	h, ok := a.helpIndex[strings.Join(parts, " ")]
+	if !ok {
+		return
+	}
+	fmt.Fprintf(a.out, "\n%s\n", wrapText(h.long, helpWidth(a.out)))
+	fmt.Fprintf(a.out, "\nExamples:\n")
+	for _, ex := range h.examples {
+		fmt.Fprintf(a.out, "  %s\n", ex)
+	}
+}
+
+// helpWidth is the wrap width for help prose: the terminal width when
+// the output is one, 80 columns otherwise.
+func helpWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if cols, _, err := term.GetSize(int(f.Fd())); err == nil && cols > 20 {
+			return cols
+		}
+	}
+	return 80
+}
+
+// wrapText greedily wraps s to at most width columns. Examples are not
+// wrapped — a broken command line cannot be copy-pasted — only prose
+// goes through here.
+func wrapText(s string, width int) string {
+	var b strings.Builder
+	line := 0
+	for _, word := range strings.Fields(s) {
+		switch {
+		case line == 0:
+		case line+1+len(word) > width:
+			b.WriteByte('\n')
+			line = 0
+		default:
+			b.WriteByte(' ')
+			line++
+		}
+		b.WriteString(word)
+		line += len(word)
+	}
+	return b.String()
+}
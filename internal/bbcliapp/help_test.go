@@ -0,0 +1,74 @@
+package bbcliapp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	flags "github.com/jessevdk/go-flags"
+)
+
+// TestEveryCommandHasExamples walks the registered command tree and
+// fails for any command without a help() method, a long description,
+// and at least one example, so a new command cannot ship undocumented.
+func TestEveryCommandHasExamples(t *testing.T) {
+	a := &app{out: io.Discard}
+	parser := a.buildParser()
+	var walk func(path string, cmds []*flags.Command)
+	walk = func(path string, cmds []*flags.Command) {
+		for _, cmd := range cmds {
+			p := cmd.Name
+			if path != "" {
+				p = path + " " + cmd.Name
+			}
+			h, ok := a.helpIndex[p]
+			switch {
+			case !ok:
+				t.Errorf("command %q has no help() method; add one in helptext.go", p)
+			case h.long == "":
+				t.Errorf("command %q has an empty long description", p)
+			case len(h.examples) == 0:
+				t.Errorf("command %q has no examples", p)
+			}
+			walk(p, cmd.Commands())
+		}
+	}
+	walk("", parser.Commands())
+}
+
+func TestHelpCommandAlias(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Run([]string{"help", "backup", "create"}, WithOutput(&buf)); err != nil {
+		t.Fatalf("help backup create: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Examples:") {
+		t.Errorf("help output lacks an Examples section:\n%s", out)
+	}
+	if !strings.Contains(out, "bbcli backup create --peer bob") {
+		t.Errorf("help output lacks the create example:\n%s", out)
+	}
+
+	buf.Reset()
+	err := Run([]string{"help", "no-such-command"}, WithOutput(&buf))
+	if err == nil || !strings.Contains(err.Error(), "unknown help topic") {
+		t.Errorf("help no-such-command = %v, want unknown topic error", err)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	in := "one two three four five six seven"
+	got := wrapText(in, 10)
+	for i, line := range strings.Split(got, "\n") {
+		if len(line) > 10 {
+			t.Errorf("line %d is %d columns: %q", i, len(line), line)
+		}
+	}
+	if strings.Join(strings.Fields(got), " ") != in {
+		t.Errorf("wrapping lost words: %q", got)
+	}
+	if wrapText("short", 80) != "short" {
+		t.Errorf("wrapText(short) = %q", wrapText("short", 80))
+	}
+}
@@ -0,0 +1,585 @@
+package bbcliapp
+
+// This file holds every command's long description and examples,
+// rendered by writeHelp under the go-flags flag listing. Keeping them
+// together makes the tone and level of detail easy to compare;
+// TestEveryCommandHasExamples fails if a command here is missed.
+
+func (c *setupCommand) help() commandHelp {
+	return commandHelp{
+		long: "Walks a new user through first-time setup: unlocks the daemon, waits " +
+			"for the Tor address to come up, and prints what to share with peers. " +
+			"Safe to re-run; steps already done are skipped.",
+		examples: []string{
+			"bbcli setup",
+			"bbcli setup --non-interactive --password-file /etc/bb/password",
+		},
+	}
+}
+
+func (c *unlockCommand) help() commandHelp {
+	return commandHelp{
+		long: "Unlocks the daemon with the node password and starts the node. The " +
+			"password is prompted for unless --password-file is given.",
+		examples: []string{
+			"bbcli unlock",
+			"bbcli unlock --password-file /etc/bb/password",
+		},
+	}
+}
+
+func (c *lockCommand) help() commandHelp {
+	return commandHelp{
+		long: "Stops the node and wipes key material from daemon memory. Peers " +
+			"cannot fetch their data until the next unlock.",
+		examples: []string{"bbcli lock"},
+	}
+}
+
+func (c *statusCommand) help() commandHelp {
+	return commandHelp{
+		long: "Shows the daemon state, the Tor bootstrap progress, and the node's " +
+			"onion address once it is published. --watch redraws the status " +
+			"every --interval and highlights what changed; combined with " +
+			"--json it emits one JSON object per line for piping into jq.",
+		examples: []string{
+			"bbcli status",
+			"bbcli status --watch --interval 5s",
+			"bbcli status --watch --json | jq .peerCount",
+		},
+	}
+}
+
+func (c *addressCommand) help() commandHelp {
+	return commandHelp{
+		long: "Prints the node's onion address. With --offline the address is " +
+			"derived locally from the password, without a daemon or Tor — useful " +
+			"before the first unlock.",
+		examples: []string{
+			"bbcli address",
+			"bbcli address --offline --password-file /etc/bb/password",
+		},
+	}
+}
+
+func (c *healthcheckCommand) help() commandHelp {
+	return commandHelp{
+		long: "Checks that the daemon answers on the local clirpc socket. It works " +
+			"while locked, so monitoring can use it unconditionally.",
+		examples: []string{"bbcli healthcheck"},
+	}
+}
+
+func (c *doctorCommand) help() commandHelp {
+	return commandHelp{
+		long: "Runs the daemon-side diagnostics: data dir permissions, disk space, " +
+			"Tor reachability including a self-dial, and configuration warnings. " +
+			"Each check prints pass, warn, or fail with a hint.",
+		examples: []string{"bbcli doctor"},
+	}
+}
+
+func (c *auditCommand) help() commandHelp {
+	return commandHelp{
+		long: "Shows the security audit log: unlocks, peer changes, backups, and " +
+			"restores. --verify re-checks the hash chain over the whole retained " +
+			"history and fails loudly on any gap.",
+		examples: []string{
+			"bbcli audit --since 24h",
+			"bbcli audit --verify",
+		},
+	}
+}
+
+func (c *modeCommand) help() commandHelp {
+	return commandHelp{
+		long: "Changes the node's maintenance mode. read-only keeps serving peer " +
+			"fetches but accepts no new data; draining announces departure and " +
+			"serves fetches until the deadline. The mode survives restarts.",
+		examples: []string{
+			"bbcli mode read-only",
+			"bbcli mode draining --drain-deadline 48h",
+			"bbcli mode normal",
+		},
+	}
+}
+
+func (c *reportCommand) help() commandHelp {
+	return commandHelp{
+		long: "Shows daily activity summaries: bytes backed up and hosted, peer " +
+			"traffic, and notable events per day.",
+		examples: []string{
+			"bbcli report",
+			"bbcli report --days 30 --json",
+		},
+	}
+}
+
+func (c *helpCommand) help() commandHelp {
+	return commandHelp{
+		long: "Shows a help topic, or a command's help as an alias for " +
+			"`bbcli <command> --help`.",
+		examples: []string{
+			"bbcli help exit-codes",
+			"bbcli help backup create",
+		},
+	}
+}
+
+func (c *peersCommand) help() commandHelp {
+	return commandHelp{
+		long: "Manages the peer registry: who may store data here, whose nodes " +
+			"store yours, and how they are named and grouped.",
+		examples: []string{"bbcli peers list"},
+	}
+}
+
+func (c *peersAddCommand) help() commandHelp {
+	return commandHelp{
+		long: "Authorizes a peer by onion address or invite URI. The alias is the " +
+			"local name used everywhere else in bbcli.",
+		examples: []string{
+			"bbcli peers add --alias bob bb://<56-char-onion>.onion?name=bob",
+		},
+	}
+}
+
+func (c *peersInviteCommand) help() commandHelp {
+	return commandHelp{
+		long: "Issues a single-use invite code another node redeems to become a " +
+			"peer. The invite expires after --ttl.",
+		examples: []string{
+			"bbcli peers invite --label \"bob's laptop\" --ttl 48h",
+		},
+	}
+}
+
+func (c *peersInvitesCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists or revokes issued invites.",
+		examples: []string{"bbcli peers invites list"},
+	}
+}
+
+func (c *peersInvitesListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists issued invites with their states and expiry times.",
+		examples: []string{"bbcli peers invites list"},
+	}
+}
+
+func (c *peersInvitesRevokeCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Withdraws an unredeemed invite so its code stops working.",
+		examples: []string{"bbcli peers invites revoke <invite-id>"},
+	}
+}
+
+func (c *peersListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists registered peers with their aliases, addresses, and trust state. Large registries are fetched page by page; --limit stops early.",
+		examples: []string{"bbcli peers list", "bbcli peers list --sort date --limit 10"},
+	}
+}
+
+func (c *peersShowCommand) help() commandHelp {
+	return commandHelp{
+		long: "Shows one peer in detail: registry entry, agreement, storage in " +
+			"both directions, and recent reachability.",
+		examples: []string{"bbcli peers show bob"},
+	}
+}
+
+func (c *peersGroupCommand) help() commandHelp {
+	return commandHelp{
+		long: "Manages named peer groups, usable wherever a peer is expected — " +
+			"`--peer friends` backs up to every member.",
+		examples: []string{"bbcli peers group list"},
+	}
+}
+
+func (c *peersGroupCreateCommand) help() commandHelp {
+	return commandHelp{
+		long: "Defines or redefines a named group of peers. Members are aliases " +
+			"or onion addresses.",
+		examples: []string{"bbcli peers group create friends bob carol"},
+	}
+}
+
+func (c *peersGroupListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists the named peer groups and their members.",
+		examples: []string{"bbcli peers group list"},
+	}
+}
+
+func (c *peersWipeCommand) help() commandHelp {
+	return commandHelp{
+		long: "Removes a peer and permanently deletes everything stored for or " +
+			"about them: chunks, manifests, messages, agreements, and report " +
+			"history. Asks for confirmation unless --yes.",
+		examples: []string{"bbcli peers wipe bob"},
+	}
+}
+
+func (c *peersBlockCommand) help() commandHelp {
+	return commandHelp{
+		long: "Puts an onion address on the blocklist; every inbound connection " +
+			"from it is dropped. --and-wipe also deletes a registered peer's " +
+			"data, as bbcli peers wipe would.",
+		examples: []string{
+			"bbcli peers block bob",
+			"bbcli peers block --and-wipe bob",
+		},
+	}
+}
+
+func (c *peersUnblockCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Removes an address from the blocklist.",
+		examples: []string{"bbcli peers unblock bob"},
+	}
+}
+
+func (c *peersBlockedCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists blocked addresses with their contact attempt counters.",
+		examples: []string{"bbcli peers blocked"},
+	}
+}
+
+func (c *peersExtendCommand) help() commandHelp {
+	return commandHelp{
+		long: "Proposes a signed renewal of the newest agreement with the peer, " +
+			"keeping its terms but extending the expiry.",
+		examples: []string{"bbcli peers extend --days 180 bob"},
+	}
+}
+
+func (c *peersAnnounceMoveCommand) help() commandHelp {
+	return commandHelp{
+		long: "Re-sends the stored address-change notice to every peer, for when " +
+			"some were offline during an identity migration.",
+		examples: []string{"bbcli peers announce-move"},
+	}
+}
+
+func (c *peersSetOnionAuthCommand) help() commandHelp {
+	return commandHelp{
+		long: "Requires Tor client authorization on the onion service, so only " +
+			"registered peers can even connect. Takes effect at the next " +
+			"unlock.",
+		examples: []string{"bbcli peers set-onion-auth on"},
+	}
+}
+
+func (c *authCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Manages clirpc credentials beyond the admin keys bbd writes itself.",
+		examples: []string{"bbcli auth create-readonly --out /etc/bb/monitor-keys"},
+	}
+}
+
+func (c *authCreateReadonlyCommand) help() commandHelp {
+	return commandHelp{
+		long: "Mints credentials limited to read-only methods, for monitoring " +
+			"agents. Point bbcli at them with --keys-dir; they are valid until " +
+			"the daemon restarts.",
+		examples: []string{
+			"bbcli auth create-readonly --out /etc/bb/monitor-keys",
+			"bbcli --keys-dir /etc/bb/monitor-keys status",
+		},
+	}
+}
+
+func (c *identityCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Manages the node identity key.",
+		examples: []string{"bbcli identity migrate"},
+	}
+}
+
+func (c *identityMigrateCommand) help() commandHelp {
+	return commandHelp{
+		long: "Switches from the password-derived onion key to a random one " +
+			"sealed in the data dir. The onion address changes and the " +
+			"migration cannot be undone; peers are notified automatically.",
+		examples: []string{"bbcli identity migrate"},
+	}
+}
+
+func (c *msgCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Exchanges short text messages with peers, e.g. to coordinate downtime.",
+		examples: []string{"bbcli msg list"},
+	}
+}
+
+func (c *msgSendCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Sends a text message to a peer.",
+		examples: []string{"bbcli msg send bob \"rebooting tonight, back by 9\""},
+	}
+}
+
+func (c *msgListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists exchanged messages, newest last.",
+		examples: []string{"bbcli msg list --peer bob --mark-read"},
+	}
+}
+
+func (c *backupCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Creates, inspects, and restores backups stored on peers.",
+		examples: []string{"bbcli backup list"},
+	}
+}
+
+func (c *backupCreateCommand) help() commandHelp {
+	return commandHelp{
+		long: "Backs up a directory to one or more peers. A re-run over the same " +
+			"directory is incremental: unchanged files reuse the chunks already " +
+			"on the peer. With --stdin a single stream is backed up instead, " +
+			"chunked and uploaded as it arrives.",
+		examples: []string{
+			"bbcli backup create --peer bob ~/documents",
+			"bbcli backup create --peer friends --exclude '*.o' ~/src",
+			"pg_dump mydb | bbcli backup create --stdin --name mydb.sql --peer bob",
+		},
+	}
+}
+
+func (c *backupListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists backups, newest first by default. --all also shows backups in the trash; --sort and --limit pick the order and cut the listing short.",
+		examples: []string{"bbcli backup list --all", "bbcli backup list --sort size --limit 5"},
+	}
+}
+
+func (c *backupDeleteCommand) help() commandHelp {
+	return commandHelp{
+		long: "Moves a backup to the trash. It stays restorable for the grace " +
+			"period, then its chunks are purged from the peers.",
+		examples: []string{"bbcli backup delete <backup-id>"},
+	}
+}
+
+func (c *backupUndeleteCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Brings a backup back from the trash before it is purged.",
+		examples: []string{"bbcli backup undelete <backup-id>"},
+	}
+}
+
+func (c *backupDiffCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Compares the manifests of two backups and lists added, modified, and deleted paths.",
+		examples: []string{"bbcli backup diff <old-id> <new-id>"},
+	}
+}
+
+func (c *backupRestoreCommand) help() commandHelp {
+	return commandHelp{
+		long: "Restores a backup into a directory, verifying every chunk. With " +
+			"--to-stdout the backup is written to stdout as a tar archive " +
+			"instead, so it can be piped or checksummed.",
+		examples: []string{
+			"bbcli backup restore <backup-id> /tmp/restored",
+			"bbcli backup restore --to-stdout <backup-id> | tar -tv",
+		},
+	}
+}
+
+func (c *backupStatusCommand) help() commandHelp {
+	return commandHelp{
+		long: "Checks each replica peer for the backup's data and shows the last " +
+			"restore's integrity results.",
+		examples: []string{"bbcli backup status <backup-id>"},
+	}
+}
+
+func (c *backupRepairCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Re-uploads the backup's chunks that a replica peer is missing.",
+		examples: []string{"bbcli backup repair --peer bob <backup-id>"},
+	}
+}
+
+func (c *backupVerifyCommand) help() commandHelp {
+	return commandHelp{
+		long: "Checks a backup on its replica peers without restoring it: every " +
+			"blob's presence, a deterministic sample of chunks fetched back and " +
+			"authenticated, and the remote manifest copy. Re-run with the printed " +
+			"--seed to reproduce a run's findings; --repair re-uploads what " +
+			"verification finds missing or corrupt.",
+		examples: []string{
+			"bbcli backup verify <backup-id>",
+			"bbcli backup verify --full --repair <backup-id>",
+		},
+	}
+}
+
+func (c *recoverCommand) help() commandHelp {
+	return commandHelp{
+		long: "Rebuilds the local backup index from the manifests a peer stores, " +
+			"after losing the data dir. Restore the backups afterwards with " +
+			"bbcli backup restore.",
+		examples: []string{"bbcli recover --peer bob"},
+	}
+}
+
+func (c *jobCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Controls long-running backup, restore, and repair jobs.",
+		examples: []string{"bbcli job list"},
+	}
+}
+
+func (c *jobListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists job records, newest first, with their states and progress.",
+		examples: []string{"bbcli job list"},
+	}
+}
+
+func (c *jobCancelCommand) help() commandHelp {
+	return commandHelp{
+		long: "Cancels a running, paused, or interrupted job. Chunks it already " +
+			"uploaded become garbage-collectable.",
+		examples: []string{"bbcli job cancel <job-id>"},
+	}
+}
+
+func (c *jobPauseCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Pauses a running job; resume it later with bbcli job resume.",
+		examples: []string{"bbcli job pause <job-id>"},
+	}
+}
+
+func (c *jobResumeCommand) help() commandHelp {
+	return commandHelp{
+		long: "Resumes a paused job, or relaunches one interrupted by a daemon " +
+			"restart.",
+		examples: []string{"bbcli job resume <job-id>"},
+	}
+}
+
+func (c *hostingCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Shows and manages what this node stores for peers.",
+		examples: []string{"bbcli hosting list"},
+	}
+}
+
+func (c *hostingListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists whose data this node stores, largest first.",
+		examples: []string{"bbcli hosting list --peer bob"},
+	}
+}
+
+func (c *hostingMigrateCommand) help() commandHelp {
+	return commandHelp{
+		long: "Streams one owner's hosted blobs to their new host, for when this " +
+			"node shuts down for good. Local copies are deleted after a grace " +
+			"period.",
+		examples: []string{"bbcli hosting migrate --owner bob --to carol"},
+	}
+}
+
+func (c *balanceCommand) help() commandHelp {
+	return commandHelp{
+		long: "Shows the barter balance per peer: bytes stored for them against " +
+			"bytes they store for you.",
+		examples: []string{"bbcli balance"},
+	}
+}
+
+func (c *storageCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Reconciles and acknowledges storage accounting.",
+		examples: []string{"bbcli storage reconcile"},
+	}
+}
+
+func (c *storageReconcileCommand) help() commandHelp {
+	return commandHelp{
+		long: "Rescans the chunk store and corrects the per-peer usage counters. " +
+			"A large drift leaves the daemon degraded until acknowledged.",
+		examples: []string{"bbcli storage reconcile"},
+	}
+}
+
+func (c *storageAckDriftCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Acknowledges a detected counter drift and lifts the degraded state.",
+		examples: []string{"bbcli storage ack-drift"},
+	}
+}
+
+func (c *configCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Changes runtime daemon settings; zero-valued flags keep the current value.",
+		examples: []string{"bbcli config set"},
+	}
+}
+
+func (c *configSetCommand) help() commandHelp {
+	return commandHelp{
+		long: "Changes runtime daemon settings. Flags not given keep their " +
+			"current values, so running it with no flags just prints the " +
+			"current configuration.",
+		examples: []string{
+			"bbcli config set --disk-soft-bytes 5000000000",
+			"bbcli config set",
+		},
+	}
+}
+
+func (c *agreementsCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Manages storage agreements: the signed terms of who stores how much for whom.",
+		examples: []string{"bbcli agreements list"},
+	}
+}
+
+func (c *agreementsListCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Lists stored agreements with their states and expiry dates.",
+		examples: []string{"bbcli agreements list"},
+	}
+}
+
+func (c *agreementsProposeCommand) help() commandHelp {
+	return commandHelp{
+		long: "Signs and sends a storage agreement to a peer: you offer bytes of " +
+			"your disk against bytes of theirs for a number of days.",
+		examples: []string{
+			"bbcli agreements propose --offer 10000000000 --request 10000000000 bob",
+		},
+	}
+}
+
+func (c *agreementsAcceptCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Accepts a pending agreement a peer proposed.",
+		examples: []string{"bbcli agreements accept <agreement-id>"},
+	}
+}
+
+func (c *rpcCommand) help() commandHelp {
+	return commandHelp{
+		long: "Invokes raw clirpc methods — a debug escape hatch, not part of the " +
+			"supported surface. It needs bbd started with --debug-reflection.",
+		examples: []string{"bbcli rpc call clirpc.CLI/GetStatus"},
+	}
+}
+
+func (c *rpcCallCommand) help() commandHelp {
+	return commandHelp{
+		long:     "Invokes a clirpc method by name with a JSON request body.",
+		examples: []string{"bbcli rpc call clirpc.CLI/ListBackups '{\"all\": true}'"},
+	}
+}
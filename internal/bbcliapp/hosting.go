@@ -0,0 +1,111 @@
+package bbcliapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type hostingCommand struct {
+	app *app
+
+	List    hostingListCommand    `command:"list" description:"List whose data this node stores, largest first"`
+	Migrate hostingMigrateCommand `command:"migrate" description:"Stream a peer's hosted data to their new host"`
+}
+
+func (c *hostingCommand) Execute(args []string) error { return nil }
+
+type hostingListCommand struct {
+	app *app
+
+	JSON bool   `long:"json" description:"Print the raw hosting entries as JSON"`
+	Peer string `long:"peer" description:"Only show the entry for this alias or onion address"`
+}
+
+func (c *hostingListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListHostingResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListHosting(ctx, &pb.ListHostingRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	hosting := resp.Hosting
+	if c.Peer != "" {
+		filtered := hosting[:0]
+		for _, h := range hosting {
+			if h.Onion == c.Peer || (h.Alias != "" && h.Alias == c.Peer) {
+				filtered = append(filtered, h)
+			}
+		}
+		hosting = filtered
+		if len(hosting) == 0 {
+			return fmt.Errorf("no hosted data for %q", c.Peer)
+		}
+	}
+	if c.JSON {
+		enc := json.NewEncoder(c.app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(hosting)
+	}
+	if len(hosting) == 0 {
+		c.app.println("not storing data for any peer")
+		return nil
+	}
+	for _, h := range hosting {
+		name := h.Onion
+		if h.Alias != "" {
+			name = h.Alias
+		}
+		used := formatBytes(h.Bytes)
+		if h.QuotaBytes > 0 {
+			used = fmt.Sprintf("%s / %s (%.0f%%)", used, formatBytes(h.QuotaBytes), h.PercentUsed)
+		}
+		c.app.printf("%s\t%d chunks\t%s\toldest %s\tnewest %s\tlast access %s\n",
+			name, h.Chunks, used,
+			formatAgo(h.OldestChunkUnix), formatAgo(h.NewestChunkUnix),
+			formatAgo(h.LastAccessUnix))
+	}
+	return nil
+}
+
+type hostingMigrateCommand struct {
+	app *app
+
+	Owner string `long:"owner" required:"true" description:"Alias or onion address whose hosted data moves"`
+	To    string `long:"to" required:"true" description:"Alias or onion address of the new host"`
+}
+
+func (c *hostingMigrateCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	// Unbounded context: the transfer moves every hosted blob over Tor.
+	resp, err := client.MigrateHosting(context.Background(), &pb.MigrateHostingRequest{
+		Owner: c.Owner,
+		To:    c.To,
+	})
+	if err != nil {
+		return err
+	}
+	c.app.printf("migrated %d chunks (%s) for %s to %s", resp.MigratedChunks,
+		formatBytes(resp.Bytes), c.Owner, c.To)
+	if resp.SkippedChunks > 0 {
+		c.app.printf(", %d already there", resp.SkippedChunks)
+	}
+	c.app.printf("; local copies will be deleted on %s unless rescued\n",
+		time.Unix(resp.DeleteAtUnix, 0).Format("2006-01-02"))
+	return nil
+}
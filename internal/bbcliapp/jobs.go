@@ -0,0 +1,119 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type jobCommand struct {
+	app *app
+
+	List   jobListCommand   `command:"list" description:"List long-running jobs"`
+	Cancel jobCancelCommand `command:"cancel" description:"Cancel a running, paused, or interrupted job"`
+	Pause  jobPauseCommand  `command:"pause" description:"Pause a running job"`
+	Resume jobResumeCommand `command:"resume" description:"Resume a paused or interrupted job"`
+}
+
+func (c *jobCommand) Execute(args []string) error { return nil }
+
+type jobListCommand struct {
+	app *app
+}
+
+func (c *jobListCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	var resp *pb.ListJobsResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.ListJobs(ctx, &pb.ListJobsRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, j := range resp.Jobs {
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", j.Id,
+			time.Unix(j.CreatedAtUnix, 0).Format("2006-01-02 15:04"),
+			j.Kind, j.State, j.Detail)
+		if j.Error != "" {
+			line += "\t" + j.Error
+		}
+		c.app.println(line)
+	}
+	return nil
+}
+
+type jobCancelCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *jobCancelCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.CancelJob(ctx, &pb.CancelJobRequest{Id: c.Args.ID}); err != nil {
+		return err
+	}
+	c.app.printf("cancelled job %s\n", c.Args.ID)
+	return nil
+}
+
+type jobPauseCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *jobPauseCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.PauseJob(ctx, &pb.PauseJobRequest{Id: c.Args.ID}); err != nil {
+		return err
+	}
+	c.app.printf("paused job %s; in-flight transfers will finish\n", c.Args.ID)
+	return nil
+}
+
+type jobResumeCommand struct {
+	app *app
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c *jobResumeCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.ResumeJob(ctx, &pb.ResumeJobRequest{Id: c.Args.ID}); err != nil {
+		return err
+	}
+	c.app.printf("resumed job %s\n", c.Args.ID)
+	return nil
+}
@@ -0,0 +1,44 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type modeCommand struct {
+	app *app
+
+	DrainDeadline time.Duration `long:"drain-deadline" description:"For draining: how long fetches keep being served, e.g. 2h"`
+
+	Args struct {
+		Mode string `positional-arg-name:"mode" description:"normal, read-only, or draining"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *modeCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	req := &pb.SetModeRequest{Mode: c.Args.Mode}
+	if c.DrainDeadline > 0 {
+		req.DrainDeadlineUnix = time.Now().Add(c.DrainDeadline).Unix()
+	}
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	resp, err := client.SetMode(ctx, req)
+	if err != nil {
+		return err
+	}
+	line := fmt.Sprintf("mode: %s", resp.Mode)
+	if resp.DrainDeadlineUnix != 0 {
+		line += fmt.Sprintf(" (fetches until %s)",
+			time.Unix(resp.DrainDeadlineUnix, 0).Format("15:04:05"))
+	}
+	c.app.println(line)
+	return nil
+}
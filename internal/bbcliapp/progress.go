@@ -0,0 +1,127 @@
+package bbcliapp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+// progressPrinter renders job progress updates. On a terminal it keeps
+// rewriting one line; otherwise it prints a plain line per update so
+// logs stay readable.
+type progressPrinter struct {
+	out  *os.File
+	tty  bool
+	drew bool
+}
+
+func newProgressPrinter(out *os.File) *progressPrinter {
+	return &progressPrinter{out: out, tty: term.IsTerminal(int(out.Fd()))}
+}
+
+func (p *progressPrinter) update(u *pb.WatchJobResponse) {
+	line := progressLine(u)
+	if !p.tty {
+		fmt.Fprintln(p.out, line)
+		return
+	}
+	if len(line) > 100 {
+		line = line[:100]
+	}
+	fmt.Fprintf(p.out, "\r\x1b[K%s", line)
+	p.drew = true
+}
+
+// finish terminates the rewritten line so the command's own output
+// starts on a fresh one.
+func (p *progressPrinter) finish() {
+	if p.tty && p.drew {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func progressLine(u *pb.WatchJobResponse) string {
+	line := u.State
+	if u.BytesTotal > 0 {
+		line += fmt.Sprintf(" %s/%s (%d%%)", formatBytes(u.BytesDone),
+			formatBytes(u.BytesTotal), u.BytesDone*100/u.BytesTotal)
+	} else if u.BytesDone > 0 {
+		line += " " + formatBytes(u.BytesDone)
+	}
+	if u.ChunksTotal > 0 {
+		line += fmt.Sprintf(", chunk %d/%d", u.ChunksDone, u.ChunksTotal)
+	}
+	if u.BytesPerSec > 0 {
+		line += fmt.Sprintf(", %s/s", formatBytes(u.BytesPerSec))
+	}
+	if u.CurrentFile != "" {
+		line += "  " + u.CurrentFile
+	}
+	return line
+}
+
+// watchJobProgress finds the newest running job of the given kind and
+// renders its progress stream until the job finishes or ctx is
+// cancelled. It is display-only: errors are swallowed so a progress
+// hiccup never fails the command it decorates.
+func watchJobProgress(ctx context.Context, client pb.CLIClient, kind string) {
+	id := ""
+	// The job record appears shortly after the blocking RPC starts;
+	// poll briefly for it.
+	for i := 0; i < 20 && id == ""; i++ {
+		resp, err := client.ListJobs(ctx, &pb.ListJobsRequest{})
+		if err != nil {
+			return
+		}
+		for _, j := range resp.Jobs {
+			if j.Kind == kind && j.State == "running" {
+				id = j.Id
+			}
+		}
+		if id == "" {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	if id == "" {
+		return
+	}
+	stream, err := client.WatchJob(ctx, &pb.WatchJobRequest{Id: id})
+	if err != nil {
+		return
+	}
+	printer := newProgressPrinter(os.Stderr)
+	defer printer.finish()
+	for {
+		u, err := stream.Recv()
+		if err != nil {
+			return
+		}
+		printer.update(u)
+	}
+}
+
+// runWithProgress runs a blocking job RPC while showing its live
+// progress, unless quiet disables the bar.
+func (a *app) runWithProgress(client pb.CLIClient, kind string, quiet bool, call func() error) error {
+	if quiet {
+		return call()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+		cancel()
+	}()
+	watchJobProgress(ctx, client, kind)
+	cancel()
+	return <-done
+}
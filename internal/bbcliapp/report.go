@@ -0,0 +1,63 @@
+package bbcliapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type reportCommand struct {
+	app *app
+
+	Days int  `long:"days" default:"7" description:"How many days back to report"`
+	JSON bool `long:"json" description:"Print the raw report as JSON"`
+}
+
+func (c *reportCommand) Execute(args []string) error {
+	if c.Days < 1 {
+		return fmt.Errorf("--days must be at least 1")
+	}
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	now := time.Now()
+	req := &pb.GetReportRequest{
+		FromUnix: now.AddDate(0, 0, -(c.Days - 1)).Unix(),
+		ToUnix:   now.Unix(),
+	}
+	var resp *pb.GetReportResponse
+	err = c.app.retry(func(ctx context.Context) error {
+		resp, err = client.GetReport(ctx, req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.JSON {
+		enc := json.NewEncoder(c.app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp.Days)
+	}
+	if len(resp.Days) == 0 {
+		c.app.println("no activity recorded in the requested range")
+		return nil
+	}
+	for _, day := range resp.Days {
+		c.app.printf("%s  jobs: %d  errors: %d  audits: %d passed / %d failed\n",
+			day.Date, day.JobsRun, day.Errors, day.AuditsPassed, day.AuditsFailed)
+		for _, p := range day.StoredForPeers {
+			c.app.printf("  stored for %s: %d bytes\n", p.Peer, p.Bytes)
+		}
+		for _, p := range day.StoredAtPeers {
+			c.app.printf("  stored at  %s: %d bytes\n", p.Peer, p.Bytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package bbcliapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// rpcCommand is the hidden debug escape hatch for invoking clirpc
+// methods that have no subcommand yet. It needs bbd started with
+// --debug-reflection.
+type rpcCommand struct {
+	app *app
+
+	Call rpcCallCommand `command:"call" description:"Invoke a clirpc method by name with a JSON request"`
+}
+
+func (c *rpcCommand) Execute(args []string) error { return nil }
+
+type rpcCallCommand struct {
+	app *app
+
+	Args struct {
+		Method  string `positional-arg-name:"full-method" required:"true" description:"Method name, e.g. clirpc.CLI/GetStatus"`
+		Request string `positional-arg-name:"json-request" description:"Request body as JSON; defaults to {}"`
+	} `positional-args:"true"`
+}
+
+func (c *rpcCallCommand) Execute(args []string) error {
+	service, method, err := splitFullMethod(c.Args.Method)
+	if err != nil {
+		return err
+	}
+	cc, closeConn, err := c.app.openConn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx := context.Background()
+	md, err := resolveMethod(ctx, cc, service, method)
+	if err != nil {
+		return err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return fmt.Errorf("%s/%s is a streaming method; streaming not supported", service, method)
+	}
+	jsonReq := c.Args.Request
+	if jsonReq == "" {
+		jsonReq = "{}"
+	}
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal([]byte(jsonReq), req); err != nil {
+		return fmt.Errorf("parse request: %w", err)
+	}
+	resp := dynamicpb.NewMessage(md.Output())
+	if err := cc.Invoke(ctx, fmt.Sprintf("/%s/%s", service, method), req, resp); err != nil {
+		return err
+	}
+	out, err := protojson.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("render response: %w", err)
+	}
+	// protojson randomizes its whitespace on purpose; re-indent through
+	// encoding/json so the output is stable for scripts and tests.
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, out, "", "  "); err != nil {
+		return fmt.Errorf("render response: %w", err)
+	}
+	c.app.println(pretty.String())
+	return nil
+}
+
+// splitFullMethod parses "Service/Method", with or without the gRPC wire
+// form's leading slash.
+func splitFullMethod(s string) (service, method string, err error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(s, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return "", "", fmt.Errorf("method must be Service/Method, e.g. clirpc.CLI/GetStatus")
+	}
+	return service, method, nil
+}
+
+// resolveMethod looks the method descriptor up over the server's
+// reflection service.
+func resolveMethod(ctx context.Context, cc *grpc.ClientConn, service, method string) (protoreflect.MethodDescriptor, error) {
+	stream, err := rpb.NewServerReflectionClient(cc).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reflection: %w", err)
+	}
+	defer stream.CloseSend()
+	err = stream.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reflection: %w", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("reflection (does bbd run with --debug-reflection?): %w", err)
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("reflection: %s", e.ErrorMessage)
+	}
+	// The response carries the file defining the service plus its
+	// transitive dependencies, enough to build a standalone registry.
+	fdSet := &descriptorpb.FileDescriptorSet{}
+	for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fdp := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(raw, fdp); err != nil {
+			return nil, fmt.Errorf("reflection: parse file descriptor: %w", err)
+		}
+		fdSet.File = append(fdSet.File, fdp)
+	}
+	files, err := protodesc.NewFiles(fdSet)
+	if err != nil {
+		return nil, fmt.Errorf("reflection: build registry: %w", err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, method)
+	}
+	return md, nil
+}
@@ -0,0 +1,171 @@
+package bbcliapp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+// setupWaitTimeout bounds the wait for the first reachability check
+// after unlock.
+const setupWaitTimeout = 2 * time.Minute
+
+type setupCommand struct {
+	app *app
+
+	NonInteractive   bool   `long:"non-interactive" description:"Never prompt; take all answers from flags"`
+	PasswordFile     string `long:"password-file" description:"Read the node password from a file"`
+	GeneratePassword bool   `long:"generate-password" description:"Generate a random password and print it"`
+}
+
+// Execute walks a new user through first-time setup. Every step checks
+// the current state first, so re-running setup after a partial failure
+// skips what is already done.
+func (c *setupCommand) Execute(args []string) error {
+	// Step 1: the daemon must be running.
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		c.app.println("The daemon is not reachable. Start it first:")
+		c.app.println()
+		c.app.printf("    bbd --data-dir %s\n", c.app.cfg.DataDir)
+		c.app.println()
+		c.app.println("then re-run bbcli setup.")
+		return err
+	}
+	defer closeClient()
+	if _, err := client.LocalHealthCheck(context.Background(), &pb.LocalHealthCheckRequest{}); err != nil {
+		return fmt.Errorf("daemon is not healthy: %w", err)
+	}
+	c.app.println("daemon: running")
+
+	// Step 2: unlock, unless already done.
+	resp, err := client.GetStatus(context.Background(), &pb.GetStatusRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.State == "unlocked" {
+		c.app.println("node: already unlocked")
+	} else {
+		password, err := c.choosePassword()
+		if err != nil {
+			return err
+		}
+		if _, err := client.Unlock(context.Background(), &pb.UnlockRequest{Password: password}); err != nil {
+			return fmt.Errorf("unlock: %w", err)
+		}
+		c.app.println("node: unlocked")
+	}
+
+	// Step 3: wait until the node can reach itself over the network.
+	resp, err = c.waitReachable(client)
+	if err != nil {
+		return err
+	}
+
+	// Step 4: the address, and how to connect the first peer.
+	c.app.println()
+	c.app.printf("your address: %s\n", resp.Onion)
+	c.app.println()
+	c.app.println("To pair with a friend, they run:")
+	c.app.printf("    bbcli peers add %s --alias you\n", resp.Onion)
+	c.app.println("and you add their address the same way. Then propose a")
+	c.app.println("storage agreement with bbcli agreements propose.")
+	return nil
+}
+
+// choosePassword picks the node password per flags, or interactively.
+func (c *setupCommand) choosePassword() (string, error) {
+	if c.PasswordFile != "" {
+		return readPassword(c.PasswordFile)
+	}
+	if c.GeneratePassword {
+		return c.generatePassword()
+	}
+	if c.NonInteractive {
+		return "", fmt.Errorf("--non-interactive needs --password-file or --generate-password")
+	}
+	c.app.print("Generate a random password for you? [y/N] ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if answer := strings.ToLower(strings.TrimSpace(line)); answer == "y" || answer == "yes" {
+		return c.generatePassword()
+	}
+	fmt.Fprint(os.Stderr, "Choose a password: ")
+	first, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	fmt.Fprint(os.Stderr, "Repeat it: ")
+	second, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(first), nil
+}
+
+// generatePassword prints and returns a fresh random password. The
+// password IS the identity: losing it orphans the node and every
+// backup, so the user must store it before going on.
+func (c *setupCommand) generatePassword() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	password := hex.EncodeToString(b[:])
+	c.app.println()
+	c.app.printf("your password: %s\n", password)
+	c.app.println()
+	c.app.println("Write it down now. It is the node's identity and the only")
+	c.app.println("way to recover your backups; it cannot be reset.")
+	c.app.println()
+	return password, nil
+}
+
+// waitReachable polls until the self-dial check succeeds, the check is
+// not enabled, or the timeout passes. It returns the last status.
+func (c *setupCommand) waitReachable(client pb.CLIClient) (*pb.GetStatusResponse, error) {
+	deadline := time.Now().Add(setupWaitTimeout)
+	waited := false
+	for {
+		resp, err := client.GetStatus(context.Background(), &pb.GetStatusRequest{})
+		if err != nil {
+			return nil, err
+		}
+		switch resp.Health {
+		case "ok":
+			c.app.printf("network: reachable (self-dial %dms)\n", resp.SelfCheckLatencyMs)
+			return resp, nil
+		case "degraded":
+			c.app.printf("network: DEGRADED: %s\n", resp.HealthError)
+			return resp, nil
+		}
+		// "unknown": either the first check is still running (Tor
+		// bootstrap) or self-checking is disabled on this network.
+		if c.NonInteractive || time.Now().After(deadline) {
+			c.app.println("network: reachability not confirmed yet (check bbcli status later)")
+			return resp, nil
+		}
+		if !waited {
+			c.app.print("network: waiting for Tor bootstrap ")
+			waited = true
+		}
+		c.app.print(".")
+		time.Sleep(2 * time.Second)
+	}
+}
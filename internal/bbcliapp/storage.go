@@ -0,0 +1,63 @@
+package bbcliapp
+
+import (
+	"context"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+type storageCommand struct {
+	app *app
+
+	Reconcile storageReconcileCommand `command:"reconcile" description:"Rescan stored chunks and correct the per-peer usage counters"`
+	AckDrift  storageAckDriftCommand  `command:"ack-drift" description:"Acknowledge a detected counter drift and lift the degraded state"`
+}
+
+func (c *storageCommand) Execute(args []string) error { return nil }
+
+type storageReconcileCommand struct {
+	app *app
+}
+
+func (c *storageReconcileCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	// A big store takes a while to rescan; no --timeout here.
+	resp, err := client.ReconcileStorage(context.Background(), &pb.ReconcileStorageRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.DriftedOwners == 0 {
+		c.app.println("usage counters match the chunks on disk")
+		return nil
+	}
+	c.app.printf("corrected %d counter(s), total drift %s\n",
+		resp.DriftedOwners, formatBytes(resp.DriftBytes))
+	if resp.LargeDrift != "" {
+		c.app.printf("large drift: %s\n", resp.LargeDrift)
+		c.app.println("the daemon reports itself degraded until bbcli storage ack-drift")
+	}
+	return nil
+}
+
+type storageAckDriftCommand struct {
+	app *app
+}
+
+func (c *storageAckDriftCommand) Execute(args []string) error {
+	client, closeClient, err := c.app.openClient(context.Background())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	ctx, cancel := c.app.rpcCtx()
+	defer cancel()
+	if _, err := client.AckStorageDrift(ctx, &pb.AckStorageDriftRequest{}); err != nil {
+		return err
+	}
+	c.app.println("storage drift acknowledged")
+	return nil
+}
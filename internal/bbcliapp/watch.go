@@ -0,0 +1,110 @@
+package bbcliapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+// clearScreen is the ANSI clear-and-home sequence the watch redraw
+// uses, so no terminal library is needed.
+const clearScreen = "\x1b[2J\x1b[H"
+
+// watch polls GetStatus every interval until interrupted. In text mode
+// it redraws the screen and highlights what changed since the previous
+// sample; with --json it emits one JSON object per line, ready for jq.
+// A lost daemon connection shows a reconnecting banner and keeps
+// polling instead of exiting.
+func (c *statusCommand) watch(client pb.CLIClient) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	var prev *pb.GetStatusResponse
+	reconnecting := false
+	for {
+		rctx, cancel := context.WithTimeout(ctx, c.app.cfg.Timeout)
+		resp, err := client.GetStatus(rctx, &pb.GetStatusRequest{})
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			// Ctrl-C, possibly mid-call; leave quietly.
+			if !c.JSON {
+				c.app.println("")
+			}
+			return nil
+		case err != nil:
+			if c.JSON {
+				line, _ := json.Marshal(map[string]string{"error": err.Error()})
+				c.app.printf("%s\n", line)
+			} else if !reconnecting {
+				c.app.printf("connection lost (%v); retrying every %s\n", err, c.Interval)
+			}
+			reconnecting = true
+		case c.JSON:
+			line, err := json.Marshal(resp)
+			if err != nil {
+				return err
+			}
+			c.app.printf("%s\n", line)
+			reconnecting = false
+		default:
+			c.app.print(clearScreen)
+			c.app.printf("bbcli status --watch, every %s, %s (Ctrl-C to quit)\n\n",
+				c.Interval, time.Now().Format("15:04:05"))
+			c.printStatus(resp)
+			c.printDeltas(prev, resp)
+			prev = resp
+			reconnecting = false
+		}
+		select {
+		case <-ctx.Done():
+			if !c.JSON {
+				c.app.println("")
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printDeltas highlights what moved between two consecutive samples.
+func (c *statusCommand) printDeltas(prev, cur *pb.GetStatusResponse) {
+	if prev == nil {
+		return
+	}
+	var lines []string
+	if prev.State != cur.State {
+		lines = append(lines, fmt.Sprintf("state %s -> %s", prev.State, cur.State))
+	}
+	if prev.Health != cur.Health {
+		lines = append(lines, fmt.Sprintf("health %s -> %s", prev.Health, cur.Health))
+	}
+	if prev.PeerCount != cur.PeerCount {
+		lines = append(lines, fmt.Sprintf("peers %d -> %d", prev.PeerCount, cur.PeerCount))
+	}
+	if prev.UnreachablePeers != cur.UnreachablePeers {
+		lines = append(lines, fmt.Sprintf("unreachable peers %d -> %d", prev.UnreachablePeers, cur.UnreachablePeers))
+	}
+	if prev.RunningJobs != cur.RunningJobs {
+		lines = append(lines, fmt.Sprintf("running jobs %d -> %d", prev.RunningJobs, cur.RunningJobs))
+	}
+	if prev.UnreadMessages != cur.UnreadMessages {
+		lines = append(lines, fmt.Sprintf("unread messages %d -> %d", prev.UnreadMessages, cur.UnreadMessages))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	c.app.println("")
+	for _, line := range lines {
+		c.app.printf("changed: %s\n", line)
+	}
+}
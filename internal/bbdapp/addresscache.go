@@ -0,0 +1,47 @@
+package bbdapp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+)
+
+// addressFile caches the node's onion address in the data dir. The
+// address is public information, but deriving it needs the password,
+// so the cache lets a locked daemon answer "which identity lives
+// here".
+const addressFile = "address.txt"
+
+// cacheAddress persists onion as this data dir's address after a
+// successful unlock or identity migration. A cache that disagrees with
+// the freshly derived address is noteworthy — a copied data dir, or a
+// migration that did not get to update it — so the overwrite is
+// audited.
+func (s *cliService) cacheAddress(onion string) {
+	prev := s.cachedAddress()
+	if prev == onion {
+		return
+	}
+	if prev != "" {
+		s.auditEvent("address_cache_mismatch", map[string]string{
+			"cached":  prev,
+			"derived": onion,
+		})
+	}
+	if err := atomicfile.WriteFile(filepath.Join(s.dataDir, addressFile), []byte(onion+"\n"), 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "bbd: cache onion address: %v\n", err)
+	}
+}
+
+// cachedAddress returns the onion address persisted at the last
+// unlock, or "" when none is cached yet.
+func (s *cliService) cachedAddress() string {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, addressFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,78 @@
+package bbdapp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestAddressCachedAcrossLock(t *testing.T) {
+	dataDir := t.TempDir()
+	s := &cliService{dataDir: dataDir, network: netmock.New()}
+	t.Cleanup(s.shutdown)
+	ctx := context.Background()
+
+	unlocked, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"})
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir, addressFile))
+	if err != nil {
+		t.Fatalf("read %s: %v", addressFile, err)
+	}
+	if got := strings.TrimSpace(string(data)); got != unlocked.Onion {
+		t.Errorf("cached address = %q, want %q", got, unlocked.Onion)
+	}
+
+	if _, err := s.Lock(ctx, &pb.LockRequest{}); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	status, err := s.GetStatus(ctx, &pb.GetStatusRequest{})
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if status.State != "locked" {
+		t.Fatalf("state = %q, want locked", status.State)
+	}
+	if status.Onion != "" {
+		t.Errorf("locked status carries a live onion %q", status.Onion)
+	}
+	if status.CachedOnion != unlocked.Onion {
+		t.Errorf("locked status cached onion = %q, want %q", status.CachedOnion, unlocked.Onion)
+	}
+	health, err := s.LocalHealthCheck(ctx, &pb.LocalHealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("LocalHealthCheck: %v", err)
+	}
+	if health.CachedOnion != unlocked.Onion {
+		t.Errorf("healthcheck cached onion = %q, want %q", health.CachedOnion, unlocked.Onion)
+	}
+}
+
+func TestAddressCacheMismatchOverwritten(t *testing.T) {
+	dataDir := t.TempDir()
+	// A stale cache — say the data dir was copied from another node —
+	// must be overwritten with the address the unlock derived.
+	if err := os.WriteFile(filepath.Join(dataDir, addressFile), []byte("stale.onion\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := &cliService{dataDir: dataDir, network: netmock.New()}
+	t.Cleanup(s.shutdown)
+
+	unlocked, err := s.Unlock(context.Background(), &pb.UnlockRequest{Password: "correct"})
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir, addressFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != unlocked.Onion {
+		t.Errorf("cache after unlock = %q, want %q", got, unlocked.Onion)
+	}
+}
@@ -0,0 +1,449 @@
+// Package bbdapp implements the bbd daemon: it serves the clirpc control
+// API on a loopback address and manages the node lifecycle (locked until
+// Unlock provides the password).
+package bbdapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/auditlog"
+	"github.com/starius/barterbackup/internal/bbnode"
+	"github.com/starius/barterbackup/internal/chunkstore"
+	"github.com/starius/barterbackup/internal/clitls"
+	"github.com/starius/barterbackup/internal/netlocal"
+	"github.com/starius/barterbackup/internal/netsocks"
+	"github.com/starius/barterbackup/internal/nettor"
+	"github.com/starius/barterbackup/internal/tracing"
+)
+
+// DefaultCLIAddr is the default clirpc bind address.
+const DefaultCLIAddr = "127.0.0.1:9911"
+
+// ErrDataDirLocked is returned by PrepareDirs when another bbd instance
+// holds the data dir lock.
+var ErrDataDirLocked = errors.New("data dir is in use by another bbd instance")
+
+// Config configures the daemon.
+type Config struct {
+	// DataDir is the daemon state directory.
+	DataDir string
+	// CLIAddr is the clirpc bind address; DefaultCLIAddr when empty.
+	// Port 0 binds an ephemeral port; the chosen address is published in
+	// the cli-keys dir for bbcli to discover. Ignored under systemd
+	// socket activation, where the inherited socket is served instead.
+	CLIAddr string
+	// CLIAllowRemote permits a non-loopback CLIAddr. Anyone who can
+	// reach the address and read the cli-keys dir controls the daemon,
+	// so it is off by default.
+	CLIAllowRemote bool
+	// DataDirUnsafeOK starts the daemon even when the data dir fails
+	// the filesystem preflight (NFS, FAT, sync folders). Locking and
+	// atomic persistence are then best effort.
+	DataDirUnsafeOK bool
+	// IdentityMode selects how the onion key relates to the password:
+	// "derived" (the default) or "stored". Empty keeps whatever mode the
+	// data dir already records.
+	IdentityMode string
+	// Network overrides the node network, for tests. When nil the
+	// daemon builds one per NetworkBackend.
+	Network bbnode.Network
+	// NetworkBackend selects the node transport: "tor" (the default,
+	// an embedded Tor with state under <DataDir>/tor) or "socks" (an
+	// externally-managed Tor reached per the Socks config).
+	NetworkBackend string
+	// Socks configures the "socks" network backend.
+	Socks netsocks.Config
+	// TorBinary is the tor executable the "tor" backend launches. Empty
+	// means "tor" from PATH.
+	TorBinary string
+	// TorLocalPort pins the onion service's local listener to this
+	// loopback port. Zero means an ephemeral port each run.
+	TorLocalPort int
+	// TorBootstrapTimeout and TorPublishTimeout override the budgets
+	// for the two onion registration phases. Zero keeps the nettor
+	// defaults (4 minutes bootstrap, 2 minutes publish).
+	TorBootstrapTimeout time.Duration
+	TorPublishTimeout   time.Duration
+	// TorMaxMemory restarts the embedded Tor child when its RSS exceeds
+	// this many bytes; zero means no cap.
+	TorMaxMemory int64
+	// LocalRegistry is the shared registry file of the "local" backend;
+	// daemons that should see each other point at the same file. Empty
+	// means <DataDir>/netlocal.json, which only one daemon reads.
+	LocalRegistry string
+	// BackupRoots is the allow-list of directories backups may read
+	// from. Empty means unrestricted, with a warning at startup: the
+	// daemon runs with the user's privileges, so anyone holding a CLI
+	// credential can otherwise back up (and so read) any readable path.
+	BackupRoots []string
+	// InsecureLocalOK acknowledges that the "local" backend has no
+	// onion layer; without it the backend is refused.
+	InsecureLocalOK bool
+	// ChunkBackend selects where peers' chunks are stored: "fs" (the
+	// default, under <DataDir>/chunks) or "s3".
+	ChunkBackend string
+	// WarmConnections, when positive, pre-dials up to this many peers
+	// from the last session after unlock.
+	WarmConnections int
+	// StrictIdentity stops the node when the self-check finds another
+	// live instance of its identity, instead of only degrading status.
+	StrictIdentity bool
+	// RequireOnionProof refuses data-plane RPCs from peers that have
+	// not proven control of their onion identity key.
+	RequireOnionProof bool
+	// ServerMaxStreams, ServerConnIdle, ServerConnAge, and
+	// ServerHandshakeTimeout tune the bbrpc server's connection
+	// protections; zero keeps each default.
+	ServerMaxStreams       int
+	ServerConnIdle         time.Duration
+	ServerConnAge          time.Duration
+	ServerHandshakeTimeout time.Duration
+	// UnlockMaxFailures is how many failed unlock attempts trigger the
+	// cool-down; zero means the default of ten.
+	UnlockMaxFailures int
+	// OTLPEndpoint, when set, exports OpenTelemetry traces of clirpc
+	// handling, jobs, and peer calls to this OTLP/gRPC endpoint. Empty
+	// leaves tracing off with no-op overhead.
+	OTLPEndpoint string
+	// DebugReflection registers gRPC server reflection on the clirpc
+	// server, for bbcli rpc call. It only ever applies to the loopback
+	// control API; the peer-facing bbrpc server has no such option.
+	DebugReflection bool
+	// S3 configures the "s3" chunk backend.
+	S3 chunkstore.S3Config
+}
+
+// Daemon is the daemon lifecycle split into stages — PrepareDirs,
+// Listen, SetupCLIKeys, Serve, Shutdown — so tests can drive and fail
+// each one in isolation. Run composes them; Shutdown cleans up whatever
+// the completed stages created and is safe to call after any of them
+// failed.
+type Daemon struct {
+	cfg     Config
+	keysDir string
+
+	// Test seams; NewDaemon installs the real implementations.
+	listen    func(addr, keysDir string, allowRemote bool) (net.Listener, error)
+	writeKeys func(dir string) (*clitls.ServerKeys, error)
+
+	lock         *os.File
+	dataDirCheck []dataDirProbe
+	audit        *auditlog.Logger
+	network      bbnode.Network
+	nodeOpts     []bbnode.Option
+	ln           net.Listener
+	serverKeys   *clitls.ServerKeys
+	keysWritten  bool
+	svc          *cliService
+	srv          *grpc.Server
+}
+
+// NewDaemon prepares a daemon for cfg without touching the filesystem
+// or the network yet.
+func NewDaemon(cfg Config) *Daemon {
+	if cfg.CLIAddr == "" {
+		cfg.CLIAddr = DefaultCLIAddr
+	}
+	return &Daemon{
+		cfg:       cfg,
+		keysDir:   filepath.Join(cfg.DataDir, "cli-keys"),
+		listen:    listenCLI,
+		writeKeys: clitls.WriteKeys,
+	}
+}
+
+// Run starts the daemon and blocks until ctx is cancelled.
+func Run(ctx context.Context, cfg Config) error {
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, "bbd")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+	d := NewDaemon(cfg)
+	defer d.Shutdown()
+	if err := d.PrepareDirs(); err != nil {
+		return err
+	}
+	if err := d.Listen(); err != nil {
+		return err
+	}
+	if err := d.SetupCLIKeys(); err != nil {
+		return err
+	}
+	return d.Serve(ctx)
+}
+
+// PrepareDirs creates and locks the data dir, upgrades its layout,
+// opens the audit log, and resolves the node configuration. It returns
+// an error wrapping ErrDataDirLocked when another instance owns the
+// dir.
+func (d *Daemon) PrepareDirs() error {
+	if err := os.MkdirAll(d.cfg.DataDir, 0o700); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	d.dataDirCheck = checkDataDir(d.cfg.DataDir)
+	var unsafeProbes []string
+	for _, p := range d.dataDirCheck {
+		if !p.OK {
+			unsafeProbes = append(unsafeProbes, fmt.Sprintf("%s: %s", p.Name, p.Detail))
+		}
+	}
+	if len(unsafeProbes) > 0 && !d.cfg.DataDirUnsafeOK {
+		return fmt.Errorf("data dir %s lacks filesystem guarantees the daemon needs: %s (move it to a local filesystem, or pass --data-dir-unsafe-ok to run anyway)",
+			d.cfg.DataDir, strings.Join(unsafeProbes, "; "))
+	}
+	lock, err := lockDataDir(d.cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	d.lock = lock
+	if err := migrateDataDir(d.cfg.DataDir); err != nil {
+		return fmt.Errorf("migrate data dir: %w", err)
+	}
+	audit, err := auditlog.Open(d.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	d.audit = audit
+
+	d.network = d.cfg.Network
+	d.nodeOpts = []bbnode.Option{bbnode.WithAuditLog(audit)}
+	if d.cfg.WarmConnections > 0 {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithWarmConnections(d.cfg.WarmConnections))
+	}
+	if d.cfg.IdentityMode != "" {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithIdentityMode(d.cfg.IdentityMode))
+	}
+	if d.cfg.StrictIdentity {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithStrictIdentity())
+	}
+	if d.cfg.RequireOnionProof {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithRequireOnionProof())
+	}
+	if d.cfg.ServerMaxStreams > 0 || d.cfg.ServerConnIdle > 0 || d.cfg.ServerConnAge > 0 || d.cfg.ServerHandshakeTimeout > 0 {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithServerConnLimits(
+			uint32(d.cfg.ServerMaxStreams), d.cfg.ServerConnIdle, d.cfg.ServerConnAge, d.cfg.ServerHandshakeTimeout))
+	}
+	if len(d.cfg.BackupRoots) > 0 {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithBackupRoots(d.cfg.BackupRoots))
+	} else {
+		fmt.Fprintln(os.Stderr, "bbd: no --backup-root configured; backups may read any path the daemon can read")
+	}
+	if d.cfg.OTLPEndpoint != "" {
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithTracing())
+	}
+	switch d.cfg.ChunkBackend {
+	case "", "fs":
+	case "s3":
+		backend, err := chunkstore.NewS3Backend(d.cfg.S3)
+		if err != nil {
+			return err
+		}
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithChunkBackend(backend))
+	default:
+		return fmt.Errorf("unknown chunk backend %q (want fs or s3)", d.cfg.ChunkBackend)
+	}
+	if d.network == nil {
+		switch d.cfg.NetworkBackend {
+		case "", "tor":
+			torOpts := []nettor.Option{
+				nettor.WithOnionStateHook(func(warning string) {
+					if err := audit.Append("onion_state_mismatch", map[string]string{"warning": warning}); err != nil {
+						fmt.Fprintf(os.Stderr, "audit log: %v\n", err)
+					}
+				}),
+			}
+			if d.cfg.TorBinary != "" {
+				torOpts = append(torOpts, nettor.WithTorBinary(d.cfg.TorBinary))
+			}
+			if d.cfg.TorLocalPort != 0 {
+				torOpts = append(torOpts, nettor.WithLocalPort(d.cfg.TorLocalPort))
+			}
+			if d.cfg.TorBootstrapTimeout != 0 {
+				torOpts = append(torOpts, nettor.WithBootstrapTimeout(d.cfg.TorBootstrapTimeout))
+			}
+			if d.cfg.TorPublishTimeout != 0 {
+				torOpts = append(torOpts, nettor.WithPublishTimeout(d.cfg.TorPublishTimeout))
+			}
+			if d.cfg.TorMaxMemory != 0 {
+				torOpts = append(torOpts, nettor.WithMaxTorMemory(d.cfg.TorMaxMemory))
+			}
+			d.network = nettor.New(filepath.Join(d.cfg.DataDir, "tor"), torOpts...)
+		case "socks":
+			network, err := netsocks.New(d.cfg.Socks)
+			if err != nil {
+				return err
+			}
+			d.network = network
+		case "local":
+			if !d.cfg.InsecureLocalOK {
+				return fmt.Errorf("the local network has no onion layer and is unsafe outside development; pass --i-know-this-is-insecure to use it")
+			}
+			registry := d.cfg.LocalRegistry
+			if registry == "" {
+				registry = filepath.Join(d.cfg.DataDir, "netlocal.json")
+			}
+			network, err := netlocal.New(registry)
+			if err != nil {
+				return err
+			}
+			d.network = network
+		default:
+			return fmt.Errorf("unknown network %q (want tor, socks, or local)", d.cfg.NetworkBackend)
+		}
+		// Onion reachability is worth watching on a real network —
+		// doubly so when an external gateway owns the onion mapping;
+		// mocks are reachable by construction.
+		d.nodeOpts = append(d.nodeOpts, bbnode.WithSelfCheck(0))
+	}
+	return nil
+}
+
+// Listen binds the clirpc address, or adopts the socket systemd handed
+// over when started via socket activation (LISTEN_FDS). It runs before
+// SetupCLIKeys: if another bbd instance owns the address, its published
+// client keys must survive to probe it.
+func (d *Daemon) Listen() error {
+	if ln, err := activationListener(); err != nil {
+		return err
+	} else if ln != nil {
+		d.ln = ln
+		return nil
+	}
+	ln, err := d.listen(d.cfg.CLIAddr, d.keysDir, d.cfg.CLIAllowRemote)
+	if err != nil {
+		return err
+	}
+	d.ln = ln
+	return nil
+}
+
+// SetupCLIKeys writes fresh client credentials to the cli-keys dir and
+// publishes the bound address there. With an explicit port the address
+// matches cfg.CLIAddr; with port 0 the endpoint file is the only way
+// for bbcli to find the daemon.
+func (d *Daemon) SetupCLIKeys() error {
+	serverKeys, err := d.writeKeys(d.keysDir)
+	if err != nil {
+		return err
+	}
+	d.serverKeys = serverKeys
+	d.keysWritten = true
+	if err := clitls.WriteEndpoint(d.keysDir, d.ln.Addr().String()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Serve runs the clirpc server until ctx is cancelled or serving fails.
+func (d *Daemon) Serve(ctx context.Context) error {
+	d.svc = &cliService{
+		dataDir:           d.cfg.DataDir,
+		dataDirCheck:      d.dataDirCheck,
+		backupRoots:       d.cfg.BackupRoots,
+		network:           d.network,
+		nodeOpts:          d.nodeOpts,
+		audit:             d.audit,
+		keys:              d.serverKeys,
+		startedAt:         time.Now(),
+		maxUnlockFailures: d.cfg.UnlockMaxFailures,
+	}
+	srv := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(d.serverKeys.TLSConfig())),
+		// Tracing wraps everything so even rejected calls get a span;
+		// then the role check, so a readonly credential gets
+		// PermissionDenied even when the daemon is locked.
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor(), d.svc.roleUnaryInterceptor, d.svc.stateUnaryInterceptor),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor(), d.svc.roleStreamInterceptor, d.svc.stateStreamInterceptor),
+	)
+	d.srv = srv
+	pb.RegisterCLIServer(srv, d.svc)
+	if d.cfg.DebugReflection {
+		reflection.Register(srv)
+	}
+
+	// The goroutine holds its own references: Shutdown may clear d.srv
+	// and d.ln before the goroutine gets scheduled.
+	ln := d.ln
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("serve clirpc: %w", err)
+	case <-ctx.Done():
+		// Bound the clirpc drain by the same budget the node applies to
+		// in-flight peer RPCs, so shutdown stays inside systemd's stop
+		// timeout.
+		drained := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-time.After(bbnode.DefaultDrainTimeout):
+			srv.Stop()
+		}
+		return nil
+	}
+}
+
+// Shutdown releases whatever the completed stages created: the node,
+// the server and listener, the published credentials, the audit log,
+// and the data dir lock. It is idempotent.
+func (d *Daemon) Shutdown() {
+	if d.svc != nil {
+		d.svc.shutdown()
+		d.svc = nil
+	}
+	if d.srv != nil {
+		d.srv.Stop() // no-op after Serve already stopped it
+		d.srv = nil
+		d.ln = nil // Serve closes the listener
+	}
+	if d.ln != nil {
+		d.ln.Close()
+		d.ln = nil
+	}
+	if d.keysWritten {
+		clitls.RemoveKeys(d.keysDir)
+		d.keysWritten = false
+	}
+	if d.audit != nil {
+		d.audit.Close()
+		d.audit = nil
+	}
+	if d.lock != nil {
+		d.lock.Close() // releases the flock
+		d.lock = nil
+	}
+}
+
+// lockDataDir takes an exclusive advisory lock on bbd.lock so two
+// daemons never share a data dir. The lock lives as long as the
+// returned file is open.
+func lockDataDir(dataDir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dataDir, lockFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", dataDir, ErrDataDirLocked)
+	}
+	return f, nil
+}
@@ -0,0 +1,211 @@
+package bbdapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/clitls"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestPrepareDirsLockContention(t *testing.T) {
+	dataDir := t.TempDir()
+
+	first := NewDaemon(Config{DataDir: dataDir})
+	if err := first.PrepareDirs(); err != nil {
+		t.Fatalf("first PrepareDirs: %v", err)
+	}
+	defer first.Shutdown()
+
+	second := NewDaemon(Config{DataDir: dataDir})
+	if err := second.PrepareDirs(); !errors.Is(err, ErrDataDirLocked) {
+		second.Shutdown()
+		t.Fatalf("second PrepareDirs: %v, want ErrDataDirLocked", err)
+	}
+
+	// Releasing the lock frees the dir for the next instance.
+	first.Shutdown()
+	third := NewDaemon(Config{DataDir: dataDir})
+	if err := third.PrepareDirs(); err != nil {
+		t.Fatalf("PrepareDirs after Shutdown: %v", err)
+	}
+	third.Shutdown()
+}
+
+func TestPrepareDirsUnwritableDataDir(t *testing.T) {
+	// A path under a regular file cannot be created, whoever runs us.
+	file := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(file, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDaemon(Config{DataDir: filepath.Join(file, "data")})
+	defer d.Shutdown()
+	if err := d.PrepareDirs(); err == nil || !strings.Contains(err.Error(), "create data dir") {
+		t.Fatalf("PrepareDirs: %v, want create data dir error", err)
+	}
+}
+
+func TestListenFailure(t *testing.T) {
+	// Occupy a port with a plain listener, then ask the daemon for it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	d := NewDaemon(Config{DataDir: t.TempDir(), CLIAddr: ln.Addr().String()})
+	defer d.Shutdown()
+	if err := d.PrepareDirs(); err != nil {
+		t.Fatalf("PrepareDirs: %v", err)
+	}
+	if err := d.Listen(); err == nil || !strings.Contains(err.Error(), "listen on") {
+		t.Fatalf("Listen: %v, want listen error", err)
+	}
+	// Listen runs before SetupCLIKeys, so a running daemon's published
+	// credentials were not clobbered.
+	if _, err := os.Stat(filepath.Join(d.cfg.DataDir, "cli-keys")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("cli-keys dir after failed Listen: %v, want not exist", err)
+	}
+}
+
+func TestServeOnInjectedListener(t *testing.T) {
+	dataDir := t.TempDir()
+	lis := bufconn.Listen(1 << 20)
+	d := NewDaemon(Config{DataDir: dataDir, Network: netmock.New()})
+	d.listen = func(addr, keysDir string, allowRemote bool) (net.Listener, error) {
+		return lis, nil
+	}
+	defer d.Shutdown()
+	if err := d.PrepareDirs(); err != nil {
+		t.Fatalf("PrepareDirs: %v", err)
+	}
+	if err := d.Listen(); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if err := d.SetupCLIKeys(); err != nil {
+		t.Fatalf("SetupCLIKeys: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Serve(ctx) }()
+
+	tlsCfg, err := clitls.ReadKeys(filepath.Join(dataDir, "cli-keys"))
+	if err != nil {
+		t.Fatalf("ReadKeys: %v", err)
+	}
+	dialCtx, dialCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer dialCancel()
+	cc, err := grpc.DialContext(dialCtx, "bufconn",
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	defer cc.Close()
+	if _, err := pb.NewCLIClient(cc).LocalHealthCheck(dialCtx, &pb.LocalHealthCheckRequest{}); err != nil {
+		t.Fatalf("LocalHealthCheck: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Serve: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+}
+
+func TestCleanShutdownLeavesExpectedFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Config{DataDir: dataDir, CLIAddr: "127.0.0.1:0", Network: netmock.New()})
+	}()
+	keysDir := filepath.Join(dataDir, "cli-keys")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := clitls.ReadEndpoint(keysDir); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("daemon did not publish its endpoint")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{"audit.log", "bbd.lock", "migrations.log", "version"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("data dir after shutdown: %v, want %v", got, want)
+	}
+}
+
+// failAcceptListener makes Serve fail after SetupCLIKeys succeeded.
+type failAcceptListener struct{}
+
+func (failAcceptListener) Accept() (net.Conn, error) { return nil, errors.New("accept refused") }
+func (failAcceptListener) Close() error              { return nil }
+func (failAcceptListener) Addr() net.Addr            { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func TestServeFailureRemovesKeys(t *testing.T) {
+	dataDir := t.TempDir()
+	d := NewDaemon(Config{DataDir: dataDir, Network: netmock.New()})
+	d.listen = func(addr, keysDir string, allowRemote bool) (net.Listener, error) {
+		return failAcceptListener{}, nil
+	}
+	if err := d.PrepareDirs(); err != nil {
+		t.Fatalf("PrepareDirs: %v", err)
+	}
+	if err := d.Listen(); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if err := d.SetupCLIKeys(); err != nil {
+		t.Fatalf("SetupCLIKeys: %v", err)
+	}
+	clientKey := filepath.Join(dataDir, "cli-keys", "client.key")
+	if _, err := os.Stat(clientKey); err != nil {
+		t.Fatalf("client.key after SetupCLIKeys: %v", err)
+	}
+
+	if err := d.Serve(context.Background()); err == nil || !strings.Contains(err.Error(), "serve clirpc") {
+		t.Fatalf("Serve: %v, want serve error", err)
+	}
+	d.Shutdown()
+	if _, err := os.Stat(clientKey); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("client.key after Shutdown: %v, want not exist", err)
+	}
+}
@@ -0,0 +1,96 @@
+package bbdapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/clitls"
+)
+
+// inUseProbeTimeout bounds the check whether an already-running daemon
+// owns the clirpc address.
+const inUseProbeTimeout = 2 * time.Second
+
+// checkCLIAddr parses and resolves the clirpc bind address and reports
+// whether every address it can bind to is loopback. It accepts IPv4
+// ("127.0.0.1:9911"), IPv6 ("[::1]:9911"), and hostname ("localhost:9911")
+// forms; a missing port or an unresolvable host is an error.
+func checkCLIAddr(addr string) (loopback bool, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false, fmt.Errorf("invalid cli address %q: %v (want host:port)", addr, err)
+	}
+	if host == "" {
+		// ":9911" binds every interface.
+		return false, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback(), nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false, fmt.Errorf("resolve cli address host %q: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// daemonAnswersAt reports whether a daemon that published its client
+// credentials in keysDir answers LocalHealthCheck at addr. It is used to
+// tell "another bbd owns this port" apart from an unrelated process.
+func daemonAnswersAt(addr, keysDir string) bool {
+	tlsCfg, err := clitls.ReadKeys(keysDir)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), inUseProbeTimeout)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, addr,
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)),
+	)
+	if err != nil {
+		return false
+	}
+	defer cc.Close()
+	_, err = pb.NewCLIClient(cc).LocalHealthCheck(ctx, &pb.LocalHealthCheckRequest{})
+	return err == nil
+}
+
+// listenCLI validates and binds the clirpc address. Non-loopback binds
+// expose the control plane to the network and are refused unless
+// explicitly allowed.
+func listenCLI(addr, keysDir string, allowRemote bool) (net.Listener, error) {
+	loopback, err := checkCLIAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !loopback {
+		if !allowRemote {
+			return nil, fmt.Errorf("cli address %s is not loopback; anyone who can reach it "+
+				"controls this daemon (pass --cli-allow-remote to bind anyway)", addr)
+		}
+		fmt.Printf("WARNING: serving the clirpc control API on non-loopback address %s; "+
+			"anyone who can reach it and read the cli-keys dir controls this daemon\n", addr)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) && daemonAnswersAt(addr, keysDir) {
+			return nil, fmt.Errorf("listen on %s: %w (another bbd instance is already serving there)", addr, err)
+		}
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,48 @@
+package bbdapp
+
+import "testing"
+
+func TestCheckCLIAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		loopback bool
+		wantErr  bool
+	}{
+		{addr: "127.0.0.1:9911", loopback: true},
+		{addr: "[::1]:9911", loopback: true},
+		{addr: "localhost:9911", loopback: true},
+		{addr: "0.0.0.0:9911", loopback: false},
+		{addr: "[::]:9911", loopback: false},
+		{addr: ":9911", loopback: false},
+		{addr: "192.0.2.1:9911", loopback: false},
+		{addr: "127.0.0.1", wantErr: true},
+		{addr: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		loopback, err := checkCLIAddr(tt.addr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("checkCLIAddr(%q): no error, want one", tt.addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("checkCLIAddr(%q): %v", tt.addr, err)
+			continue
+		}
+		if loopback != tt.loopback {
+			t.Errorf("checkCLIAddr(%q): loopback = %v, want %v", tt.addr, loopback, tt.loopback)
+		}
+	}
+}
+
+func TestListenCLIRejectsWildcard(t *testing.T) {
+	if _, err := listenCLI("0.0.0.0:0", t.TempDir(), false); err == nil {
+		t.Fatal("listenCLI bound a wildcard address without --cli-allow-remote")
+	}
+	ln, err := listenCLI("127.0.0.1:0", t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("listenCLI on loopback: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,1561 @@
+package bbdapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/auditlog"
+	"github.com/starius/barterbackup/internal/bbnode"
+	"github.com/starius/barterbackup/internal/clitls"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// fingerprintFile holds the fingerprint of the master secret so a wrong
+// password is detected instead of silently creating a second identity in
+// the same data dir.
+const fingerprintFile = "fingerprint.txt"
+
+// cliService implements the clirpc CLI service. It guards the node with
+// an RWMutex: the node is nil while locked.
+type cliService struct {
+	pb.UnimplementedCLIServer
+
+	dataDir string
+	// dataDirCheck holds the startup filesystem preflight results, for
+	// RunDiagnostics.
+	dataDirCheck []dataDirProbe
+	// backupRoots is the allow-list of backup source directories, for
+	// RunDiagnostics; enforcement lives in the node.
+	backupRoots []string
+	network     bbnode.Network
+	nodeOpts    []bbnode.Option
+	audit       *auditlog.Logger
+	// keys mints additional readonly credentials; nil in tests that
+	// construct the service without a listener.
+	keys      *clitls.ServerKeys
+	startedAt time.Time
+	// now is the clock unlock throttling runs on; nil means time.Now.
+	// Tests inject a fake to verify the backoff schedule.
+	now func() time.Time
+	// maxUnlockFailures is how many failed unlocks trigger the
+	// cool-down; zero means the default.
+	maxUnlockFailures int
+
+	mu   sync.RWMutex
+	node *bbnode.Node
+	// unlocking is non-nil while an unlock is in flight and closed when
+	// it finishes; concurrent Unlock calls wait on it instead of racing
+	// for the fingerprint file.
+	unlocking chan struct{}
+	// throttle tracks failed unlock attempts; created lazily so tests
+	// constructing the service literal get one too.
+	throttle *unlockThrottle
+}
+
+// unlockThrottleFor returns the service's unlock throttle, creating it
+// on first use.
+func (s *cliService) unlockThrottleFor() *unlockThrottle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.throttle == nil {
+		s.throttle = newUnlockThrottle(s.dataDir, s.now, s.maxUnlockFailures)
+	}
+	return s.throttle
+}
+
+// statusExpirationHorizon is how far ahead GetStatus reports upcoming
+// stored-data expirations.
+const statusExpirationHorizon = 30 * 24 * time.Hour
+
+// errLocked is the error for methods that need an unlocked node.
+var errLocked = status.Error(codes.FailedPrecondition, "node is locked; run bbcli unlock")
+
+// auditEvent records a security-relevant event if the audit log is
+// available; a write failure must not fail the operation itself.
+func (s *cliService) auditEvent(event string, details map[string]string) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Append(event, details); err != nil {
+		fmt.Fprintf(os.Stderr, "audit log: %v\n", err)
+	}
+}
+
+// getNode returns the node or errLocked.
+func (s *cliService) getNode() (*bbnode.Node, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.node == nil {
+		return nil, errLocked
+	}
+	return s.node, nil
+}
+
+func (s *cliService) Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error) {
+	// The throttle runs before any password work: a throttled attempt
+	// must not even pay for Argon2, let alone refine a guess.
+	throttle := s.unlockThrottleFor()
+	if err := throttle.check(); err != nil {
+		s.auditEvent("unlock_throttled", map[string]string{"error": status.Convert(err).Message()})
+		return nil, err
+	}
+	// Claim the UNLOCKING state; the precondition interceptor keeps
+	// other state-changing calls out until we finish, and nothing
+	// observes a half-initialized node because s.node is only set at
+	// the very end.
+	for {
+		s.mu.Lock()
+		if node := s.node; node != nil {
+			s.mu.Unlock()
+			// Already unlocked: the same password succeeds idempotently
+			// so provisioning retry loops converge.
+			if bbnode.PasswordFingerprint(req.Password) != node.Fingerprint() {
+				failures := throttle.recordFailure()
+				s.auditEvent("unlock_failed", map[string]string{
+					"error":    "wrong password on unlocked daemon",
+					"failures": fmt.Sprint(failures),
+				})
+				return nil, status.Error(codes.PermissionDenied, "wrong password for this data dir")
+			}
+			throttle.reset()
+			return &pb.UnlockResponse{Onion: node.Address(), WasAlreadyUnlocked: true}, nil
+		}
+		if s.unlocking == nil {
+			break // holding s.mu
+		}
+		done := s.unlocking
+		s.mu.Unlock()
+		// Another unlock is in flight; wait for it instead of spawning
+		// a parallel node, then re-evaluate.
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	done := make(chan struct{})
+	s.unlocking = done
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.unlocking = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	node, err := bbnode.New(req.Password, s.network, s.dataDir, s.nodeOpts...)
+	if err != nil {
+		s.auditEvent("unlock_failed", map[string]string{"error": err.Error()})
+		return nil, status.Errorf(codes.Internal, "create node: %v", err)
+	}
+	if err := s.checkFingerprint(node.Fingerprint()); err != nil {
+		details := map[string]string{"error": status.Convert(err).Message()}
+		if status.Code(err) == codes.PermissionDenied {
+			// Only wrong passwords count against the throttle; an I/O
+			// error reading the fingerprint is not an attack.
+			details["failures"] = fmt.Sprint(throttle.recordFailure())
+		}
+		s.auditEvent("unlock_failed", details)
+		return nil, err
+	}
+	if err := node.Start(ctx); err != nil {
+		s.auditEvent("unlock_failed", map[string]string{"error": err.Error()})
+		return nil, status.Errorf(codes.Internal, "start node: %v", err)
+	}
+	s.mu.Lock()
+	s.node = node
+	s.mu.Unlock()
+	throttle.reset()
+	s.cacheAddress(node.Address())
+	s.auditEvent("unlock", map[string]string{"onion": node.Address()})
+	return &pb.UnlockResponse{Onion: node.Address()}, nil
+}
+
+// Lock stops the node and wipes its key material from memory; the
+// daemon stays up and a later Unlock starts a fresh node.
+func (s *cliService) Lock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
+	s.mu.Lock()
+	node := s.node
+	s.node = nil
+	s.mu.Unlock()
+	if node == nil {
+		return nil, errLocked
+	}
+	if err := node.Stop(); err != nil {
+		return nil, status.Errorf(codes.Internal, "stop node: %v", err)
+	}
+	s.auditEvent("lock", nil)
+	return &pb.LockResponse{}, nil
+}
+
+// checkFingerprint compares the password fingerprint against the one
+// recorded in the data dir, recording it on first unlock. The
+// comparison itself lives in the keys package; this only maps its
+// outcomes onto gRPC codes, keeping PermissionDenied — the code the
+// unlock throttle counts — reserved for an actual mismatch.
+func (s *cliService) checkFingerprint(fp string) error {
+	path := filepath.Join(s.dataDir, fingerprintFile)
+	want, err := keys.FingerprintFromHex(fp)
+	if err != nil {
+		return status.Errorf(codes.Internal, "parse fingerprint: %v", err)
+	}
+	outcome, err := want.VerifyAgainstFile(path)
+	switch outcome {
+	case keys.FingerprintMatch, keys.FingerprintCreated:
+		return nil
+	case keys.FingerprintMismatch:
+		return status.Error(codes.PermissionDenied, "wrong password for this data dir")
+	case keys.FingerprintFormatError:
+		return status.Errorf(codes.Internal, "fingerprint file: %v", err)
+	default:
+		return status.Errorf(codes.Internal, "read fingerprint: %v", err)
+	}
+}
+
+func (s *cliService) GetStatus(ctx context.Context, req *pb.GetStatusRequest) (*pb.GetStatusResponse, error) {
+	s.mu.RLock()
+	node := s.node
+	s.mu.RUnlock()
+	if node == nil {
+		resp := &pb.GetStatusResponse{
+			State:               "locked",
+			DaemonUptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		}
+		// An unlock in flight has no node yet, but the network already
+		// knows which registration phase it is waiting on.
+		if rp, ok := s.network.(interface{ RegisterPhase() string }); ok {
+			resp.TorPhase = rp.RegisterPhase()
+		}
+		resp.CachedOnion = s.cachedAddress()
+		return resp, nil
+	}
+	gcDone, _, gcBytes := node.StartupGCStatus()
+	health := node.Health()
+	resp := &pb.GetStatusResponse{
+		State:                   "unlocked",
+		Onion:                   node.Address(),
+		PeerCount:               int32(len(node.ListPeers())),
+		UnreadMessages:          int32(node.UnreadCount()),
+		StartupGcDone:           gcDone,
+		StartupGcReclaimedBytes: gcBytes,
+		Health:                  health.State,
+		HealthError:             health.Err,
+		SelfCheckLatencyMs:      health.Latency.Milliseconds(),
+		UnreachablePeers:        int32(node.UnreachablePeers()),
+		WarmConnections:         int32(node.WarmConnections()),
+	}
+	for _, c := range node.ActiveStreams() {
+		resp.ActiveStreams += int32(c)
+	}
+	mode, drainDeadline := node.Mode()
+	resp.Mode = string(mode)
+	if !drainDeadline.IsZero() {
+		resp.DrainDeadlineUnix = drainDeadline.Unix()
+	}
+	if !health.CheckedAt.IsZero() {
+		resp.LastSelfCheckUnix = health.CheckedAt.Unix()
+	}
+	disk := node.DiskStatus()
+	resp.DiskFreeBytes = disk.FreeBytes
+	resp.DiskThreshold = disk.Threshold
+	if exps, err := node.UpcomingExpirations(statusExpirationHorizon); err == nil {
+		for _, e := range exps {
+			info := &pb.ExpirationInfo{
+				Onion:         e.Onion,
+				Alias:         e.Alias,
+				ExpiresAtUnix: e.ExpiresAt.Unix(),
+				InGrace:       e.InGrace,
+			}
+			if e.InGrace {
+				info.DeleteAtUnix = e.DeleteAt.Unix()
+			}
+			resp.Expirations = append(resp.Expirations, info)
+		}
+	}
+	if disk.Threshold != "" {
+		resp.Health = "degraded"
+		if resp.HealthError == "" {
+			resp.HealthError = fmt.Sprintf("disk space below %s threshold (%d bytes free)",
+				disk.Threshold, disk.FreeBytes)
+		}
+	}
+	ns := node.NetworkStatus()
+	resp.NetworkRecovering = ns.Recovering
+	resp.NetworkRecoveryAttempts = int32(ns.RecoveryAttempts)
+	resp.NetworkLastFailure = ns.LastFailure
+	if !ns.LastFailureAt.IsZero() {
+		resp.NetworkLastFailureUnix = ns.LastFailureAt.Unix()
+	}
+	if ns.Recovering {
+		resp.Health = "degraded"
+		if resp.HealthError == "" {
+			resp.HealthError = fmt.Sprintf("network down: %s", ns.LastFailure)
+		}
+	}
+	sr := node.StorageReconStatus()
+	resp.StorageDrift = sr.LargeDrift
+	if !sr.LargeDriftAt.IsZero() {
+		resp.StorageDriftDetectedUnix = sr.LargeDriftAt.Unix()
+	}
+	if sr.LargeDrift != "" {
+		resp.Health = "degraded"
+		if resp.HealthError == "" {
+			resp.HealthError = fmt.Sprintf("storage drift: %s", sr.LargeDrift)
+		}
+	}
+	if tv, ok := s.network.(interface{ TorVersion() string }); ok {
+		resp.TorVersion = tv.TorVersion()
+	}
+	if ow, ok := s.network.(interface{ OnionStateWarning() string }); ok {
+		resp.OnionStateWarning = ow.OnionStateWarning()
+	}
+	if rp, ok := s.network.(interface{ RegisterPhase() string }); ok {
+		resp.TorPhase = rp.RegisterPhase()
+	}
+	if op, ok := s.network.(interface{ OnionPorts() (string, int) }); ok {
+		local, remote := op.OnionPorts()
+		if local != "" {
+			resp.TorLocalListener = local
+			resp.TorOnionPort = int32(remote)
+		}
+	}
+	if ps, ok := s.network.(interface {
+		TorProcStats() (int, int64, float64)
+	}); ok {
+		pid, rss, cpu := ps.TorProcStats()
+		resp.TorPid = int32(pid)
+		resp.TorRssBytes = rss
+		resp.TorCpuSeconds = cpu
+	}
+	if jobs, err := node.ListJobs(); err == nil {
+		for i := range jobs {
+			if jobs[i].State == "running" {
+				resp.RunningJobs++
+			}
+		}
+	}
+	rate, attempts := node.OutboundSuccessRate()
+	resp.OutboundSuccessRate = rate
+	resp.OutboundAttempts = int64(attempts)
+	resp.DaemonUptimeSeconds = int64(time.Since(s.startedAt).Seconds())
+	resp.NodeUptimeSeconds = int64(node.Uptime().Seconds())
+	return resp, nil
+}
+
+func (s *cliService) SetConfig(ctx context.Context, req *pb.SetConfigRequest) (*pb.SetConfigResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	cfg := node.DiskConfig()
+	if req.DiskSoftBytes != 0 {
+		cfg.SoftBytes = req.DiskSoftBytes
+	}
+	if req.DiskHardBytes != 0 {
+		cfg.HardBytes = req.DiskHardBytes
+	}
+	if req.DiskCheckIntervalSeconds != 0 {
+		cfg.CheckInterval = time.Duration(req.DiskCheckIntervalSeconds) * time.Second
+	}
+	if err := node.SetDiskConfig(cfg); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "set config: %v", err)
+	}
+	retention := node.RetentionConfig()
+	if req.TrashGraceDays != 0 || req.BackupTrashDays != 0 {
+		if req.TrashGraceDays != 0 {
+			retention.TrashGraceDays = req.TrashGraceDays
+		}
+		if req.BackupTrashDays != 0 {
+			retention.BackupTrashDays = req.BackupTrashDays
+		}
+		if err := node.SetRetentionConfig(retention); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "set config: %v", err)
+		}
+	}
+	if req.BalanceNudgeRatio != 0 {
+		balance := node.BalanceConfig()
+		// Zero means "unchanged" throughout SetConfig, so disabling
+		// takes a negative value.
+		if req.BalanceNudgeRatio < 0 {
+			balance.NudgeRatio = 0
+		} else {
+			balance.NudgeRatio = req.BalanceNudgeRatio
+		}
+		if err := node.SetBalanceConfig(balance); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "set config: %v", err)
+		}
+	}
+	cfg = node.DiskConfig()
+	balance := node.BalanceConfig()
+	s.auditEvent("config_changed", map[string]string{
+		"disk_soft_bytes":     fmt.Sprint(cfg.SoftBytes),
+		"disk_hard_bytes":     fmt.Sprint(cfg.HardBytes),
+		"trash_grace_days":    fmt.Sprint(retention.TrashGraceDays),
+		"backup_trash_days":   fmt.Sprint(retention.BackupTrashDays),
+		"balance_nudge_ratio": fmt.Sprint(balance.NudgeRatio),
+	})
+	return &pb.SetConfigResponse{
+		DiskSoftBytes:            cfg.SoftBytes,
+		DiskHardBytes:            cfg.HardBytes,
+		DiskCheckIntervalSeconds: int64(cfg.CheckInterval / time.Second),
+		TrashGraceDays:           retention.TrashGraceDays,
+		BackupTrashDays:          retention.BackupTrashDays,
+		BalanceNudgeRatio:        balance.NudgeRatio,
+		BackupRoots:              node.BackupRoots(),
+	}, nil
+}
+
+func (s *cliService) SetMode(ctx context.Context, req *pb.SetModeRequest) (*pb.SetModeResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	var deadline time.Time
+	if req.DrainDeadlineUnix != 0 {
+		deadline = time.Unix(req.DrainDeadlineUnix, 0)
+	}
+	if err := node.SetMode(bbnode.Mode(req.Mode), deadline); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "set mode: %v", err)
+	}
+	mode, deadline := node.Mode()
+	resp := &pb.SetModeResponse{Mode: string(mode)}
+	if !deadline.IsZero() {
+		resp.DrainDeadlineUnix = deadline.Unix()
+	}
+	return resp, nil
+}
+
+func (s *cliService) ReconcileStorage(ctx context.Context, req *pb.ReconcileStorageRequest) (*pb.ReconcileStorageResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	sr, err := node.ReconcileStorage()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reconcile storage: %v", err)
+	}
+	return &pb.ReconcileStorageResponse{
+		DriftedOwners: int32(sr.DriftedOwners),
+		DriftBytes:    sr.DriftBytes,
+		LargeDrift:    sr.LargeDrift,
+	}, nil
+}
+
+func (s *cliService) AckStorageDrift(ctx context.Context, req *pb.AckStorageDriftRequest) (*pb.AckStorageDriftResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.AckStorageDrift(); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "ack storage drift: %v", err)
+	}
+	return &pb.AckStorageDriftResponse{}, nil
+}
+
+func (s *cliService) ListHosting(ctx context.Context, req *pb.ListHostingRequest) (*pb.ListHostingResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	hosting, err := node.ListHosting()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list hosting: %v", err)
+	}
+	resp := &pb.ListHostingResponse{}
+	for _, h := range hosting {
+		info := &pb.HostingInfo{
+			Onion:      h.Onion,
+			Alias:      h.Alias,
+			Chunks:     int64(h.Chunks),
+			Bytes:      h.Bytes,
+			QuotaBytes: h.QuotaBytes,
+		}
+		if h.QuotaBytes > 0 {
+			info.PercentUsed = 100 * float64(h.Bytes) / float64(h.QuotaBytes)
+		}
+		if !h.OldestChunk.IsZero() {
+			info.OldestChunkUnix = h.OldestChunk.Unix()
+		}
+		if !h.NewestChunk.IsZero() {
+			info.NewestChunkUnix = h.NewestChunk.Unix()
+		}
+		if !h.LastAccess.IsZero() {
+			info.LastAccessUnix = h.LastAccess.Unix()
+		}
+		resp.Hosting = append(resp.Hosting, info)
+	}
+	return resp, nil
+}
+
+func (s *cliService) MigrateHosting(ctx context.Context, req *pb.MigrateHostingRequest) (*pb.MigrateHostingResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	result, err := node.MigrateHostedData(ctx, req.Owner, req.To)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "migrate hosting: %v", err)
+	}
+	return &pb.MigrateHostingResponse{
+		MigratedChunks: int64(result.Migrated),
+		SkippedChunks:  int64(result.Skipped),
+		Bytes:          result.Bytes,
+		DeleteAtUnix:   result.DeleteAt.Unix(),
+	}, nil
+}
+
+func (s *cliService) ListBalances(ctx context.Context, req *pb.ListBalancesRequest) (*pb.ListBalancesResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := node.PeerBalances()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "peer balances: %v", err)
+	}
+	resp := &pb.ListBalancesResponse{}
+	for _, b := range balances {
+		resp.Balances = append(resp.Balances, &pb.PeerBalanceInfo{
+			Onion:              b.Onion,
+			Alias:              b.Alias,
+			StoredForPeerBytes: b.StoredForPeer,
+			StoredAtPeerBytes:  b.StoredAtPeer,
+			SentBytes:          b.SentBytes,
+			ReceivedBytes:      b.ReceivedBytes,
+		})
+	}
+	return resp, nil
+}
+
+func (s *cliService) LocalHealthCheck(ctx context.Context, req *pb.LocalHealthCheckRequest) (*pb.LocalHealthCheckResponse, error) {
+	resp := &pb.LocalHealthCheckResponse{
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		CachedOnion:   s.cachedAddress(),
+	}
+	s.mu.RLock()
+	node := s.node
+	s.mu.RUnlock()
+	if node != nil {
+		resp.NodeUptimeSeconds = int64(node.Uptime().Seconds())
+	}
+	return resp, nil
+}
+
+// ReadAuditLog returns raw audit records, optionally bounded by time.
+// It works locked: the audit trail matters most when something looks
+// wrong.
+func (s *cliService) ReadAuditLog(ctx context.Context, req *pb.ReadAuditLogRequest) (*pb.ReadAuditLogResponse, error) {
+	if s.audit == nil {
+		return nil, status.Error(codes.Unavailable, "audit log is not available")
+	}
+	var from, to time.Time
+	if req.FromUnix > 0 {
+		from = time.Unix(req.FromUnix, 0)
+	}
+	if req.ToUnix > 0 {
+		to = time.Unix(req.ToUnix, 0)
+	}
+	records, err := s.audit.Read(from, to)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "read audit log: %v", err)
+	}
+	return &pb.ReadAuditLogResponse{Records: records}, nil
+}
+
+func (s *cliService) CreateReadonlyCreds(ctx context.Context, req *pb.CreateReadonlyCredsRequest) (*pb.CreateReadonlyCredsResponse, error) {
+	if s.keys == nil {
+		return nil, status.Error(codes.Unavailable, "credential minting is not available")
+	}
+	cert, key, err := s.keys.MintReadonly()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mint readonly credentials: %v", err)
+	}
+	s.auditEvent("readonly_creds_created", map[string]string{})
+	return &pb.CreateReadonlyCredsResponse{ClientCert: cert, ClientKey: key}, nil
+}
+
+func (s *cliService) GetReport(ctx context.Context, req *pb.GetReportRequest) (*pb.GetReportResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	days, err := node.Report(time.Unix(req.FromUnix, 0), time.Unix(req.ToUnix, 0))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "report: %v", err)
+	}
+	resp := &pb.GetReportResponse{}
+	for i := range days {
+		resp.Days = append(resp.Days, reportDayInfo(&days[i]))
+	}
+	return resp, nil
+}
+
+func reportDayInfo(d *bbnode.ReportDay) *pb.ReportDayInfo {
+	info := &pb.ReportDayInfo{
+		Date:         d.Date,
+		AuditsPassed: int32(d.AuditsPassed),
+		AuditsFailed: int32(d.AuditsFailed),
+		JobsRun:      int32(d.JobsRun),
+		Errors:       int32(d.Errors),
+	}
+	info.StoredForPeers = peerBytesList(d.StoredForPeers)
+	info.StoredAtPeers = peerBytesList(d.StoredAtPeers)
+	return info
+}
+
+// peerBytesList flattens a peer->bytes map into a deterministic list.
+func peerBytesList(m map[string]int64) []*pb.ReportPeerBytes {
+	peers := make([]string, 0, len(m))
+	for peer := range m {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	out := make([]*pb.ReportPeerBytes, 0, len(peers))
+	for _, peer := range peers {
+		out = append(out, &pb.ReportPeerBytes{Peer: peer, Bytes: m[peer]})
+	}
+	return out
+}
+
+func (s *cliService) AddPeer(ctx context.Context, req *pb.AddPeerRequest) (*pb.AddPeerResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.AddPeer(req.Onion, req.Alias); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.AddPeerResponse{}, nil
+}
+
+func (s *cliService) ListPeers(ctx context.Context, req *pb.ListPeersRequest) (*pb.ListPeersResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	sortOrder := req.Sort
+	if sortOrder == "" {
+		sortOrder = "onion"
+	}
+	var key func(p *bbnode.Peer) string
+	switch sortOrder {
+	case "onion":
+		key = func(p *bbnode.Peer) string { return p.Onion }
+	case "name":
+		key = func(p *bbnode.Peer) string { return p.Alias }
+	case "date":
+		key = func(p *bbnode.Peer) string { return descendingKey(p.AddedAt.Unix()) }
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown sort %q; use onion, name or date", req.Sort)
+	}
+	peers := node.ListPeers()
+	sort.Slice(peers, func(i, j int) bool {
+		ki, kj := key(&peers[i]), key(&peers[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return peers[i].Onion < peers[j].Onion
+	})
+	// Pages keep a huge registry from ballooning one response; the
+	// token resumes after the sort position of the previous page's last
+	// peer, so removals in between cannot crash the walk.
+	if req.PageToken != "" {
+		cur, err := decodePageToken(req.PageToken, sortOrder)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		for len(peers) > 0 && !afterCursor(cur, key(&peers[0]), peers[0].Onion) {
+			peers = peers[1:]
+		}
+	}
+	resp := &pb.ListPeersResponse{}
+	if size := pageSize(req.PageSize); len(peers) > size {
+		peers = peers[:size]
+		last := &peers[size-1]
+		resp.NextPageToken = encodePageToken(pageCursor{Sort: sortOrder, Key: key(last), ID: last.Onion})
+	}
+	active := node.ActiveStreams()
+	for _, p := range peers {
+		info := &pb.PeerInfo{
+			Onion:         p.Onion,
+			Alias:         p.Alias,
+			AddedAtUnix:   p.AddedAt.Unix(),
+			ProbeFailures: int32(p.ProbeFailures),
+			ActiveStreams: int32(active[p.Onion]),
+			Mode:          node.PeerMode(p.Onion),
+			ProtoVersion:  int32(p.ProtoVersion),
+		}
+		if !p.LastSeen.IsZero() {
+			info.LastSeenUnix = p.LastSeen.Unix()
+		}
+		setBreakerInfo(info, node, p.Onion)
+		resp.Peers = append(resp.Peers, info)
+	}
+	return resp, nil
+}
+
+func (s *cliService) GetPeer(ctx context.Context, req *pb.GetPeerRequest) (*pb.GetPeerResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	d, err := node.PeerDetails(req.Peer)
+	if errors.Is(err, bbnode.ErrUnknownPeer) {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "peer details: %v", err)
+	}
+	p := d.Peer
+	info := &pb.PeerInfo{
+		Onion:         p.Onion,
+		Alias:         p.Alias,
+		AddedAtUnix:   p.AddedAt.Unix(),
+		ProbeFailures: int32(p.ProbeFailures),
+		ActiveStreams: int32(d.ActiveStreams),
+		Mode:          node.PeerMode(p.Onion),
+		ProtoVersion:  int32(p.ProtoVersion),
+	}
+	if !p.LastSeen.IsZero() {
+		info.LastSeenUnix = p.LastSeen.Unix()
+	}
+	setBreakerInfo(info, node, p.Onion)
+	resp := &pb.GetPeerResponse{
+		Peer:               info,
+		StoredForPeerBytes: d.StoredForPeer,
+		StoredAtPeerBytes:  d.StoredAtPeer,
+		UploadedBytes:      d.UploadedBytes,
+		AuditsPassed:       int32(d.AuditsPassed),
+		AuditsFailed:       int32(d.AuditsFailed),
+		AvgPingMs:          p.AvgPingMs,
+		UnreadMessages:     int32(d.UnreadMessages),
+		RpcSentBytes:       d.RPC.SentBytes,
+		RpcSentWireBytes:   d.RPC.SentWireBytes,
+		RpcRecvBytes:       d.RPC.RecvBytes,
+		RpcRecvWireBytes:   d.RPC.RecvWireBytes,
+		ReachHistory:       node.PeerReachability(p.Onion),
+	}
+	if d.Agreement != nil {
+		resp.Agreement = agreementInfo(d.Agreement)
+	}
+	return resp, nil
+}
+
+// setBreakerInfo copies the peer's circuit breaker state into info;
+// a closed breaker leaves the fields at their zero values.
+func setBreakerInfo(info *pb.PeerInfo, node *bbnode.Node, onion string) {
+	state, retryAt := node.PeerBreaker(onion)
+	info.BreakerState = state
+	if !retryAt.IsZero() {
+		info.BreakerRetryAtUnix = retryAt.Unix()
+	}
+}
+
+func (s *cliService) CreateInvite(ctx context.Context, req *pb.CreateInviteRequest) (*pb.CreateInviteResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	inv, err := node.NewInvite(time.Duration(req.TtlSeconds)*time.Second, req.Label)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.CreateInviteResponse{
+		Id:            inv.ID,
+		Uri:           fmt.Sprintf("bb://%s/%s", node.Address(), inv.Code()),
+		ExpiresAtUnix: inv.ExpiresAt.Unix(),
+	}, nil
+}
+
+func (s *cliService) ListInvites(ctx context.Context, req *pb.ListInvitesRequest) (*pb.ListInvitesResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	invites, err := node.ListInvites()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list invites: %v", err)
+	}
+	resp := &pb.ListInvitesResponse{}
+	for _, inv := range invites {
+		info := &pb.InviteInfo{
+			Id:            inv.ID,
+			Label:         inv.Label,
+			State:         inv.State,
+			CreatedAtUnix: inv.CreatedAt.Unix(),
+			ExpiresAtUnix: inv.ExpiresAt.Unix(),
+			UsedBy:        inv.UsedBy,
+		}
+		if !inv.UsedAt.IsZero() {
+			info.UsedAtUnix = inv.UsedAt.Unix()
+		}
+		resp.Invites = append(resp.Invites, info)
+	}
+	return resp, nil
+}
+
+func (s *cliService) RevokeInvite(ctx context.Context, req *pb.RevokeInviteRequest) (*pb.RevokeInviteResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	err = node.RevokeInvite(req.Id)
+	if errors.Is(err, bbnode.ErrUnknownInvite) {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	} else if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	return &pb.RevokeInviteResponse{}, nil
+}
+
+func (s *cliService) WipePeer(ctx context.Context, req *pb.WipePeerRequest) (*pb.WipePeerResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	onion, jobID, err := node.WipePeer(req.Peer)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.WipePeerResponse{Onion: onion, JobId: jobID}, nil
+}
+
+func (s *cliService) BlockPeer(ctx context.Context, req *pb.BlockPeerRequest) (*pb.BlockPeerResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	onion, wipeJobID, err := node.BlockPeer(req.Peer, req.AndWipe)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.BlockPeerResponse{Onion: onion, WipeJobId: wipeJobID}, nil
+}
+
+func (s *cliService) UnblockPeer(ctx context.Context, req *pb.UnblockPeerRequest) (*pb.UnblockPeerResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	err = node.UnblockPeer(req.Onion)
+	if errors.Is(err, bbnode.ErrNotBlocked) {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	return &pb.UnblockPeerResponse{}, nil
+}
+
+func (s *cliService) ListBlockedPeers(ctx context.Context, req *pb.ListBlockedPeersRequest) (*pb.ListBlockedPeersResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListBlockedPeersResponse{}
+	for _, b := range node.ListBlockedPeers() {
+		info := &pb.BlockedPeerInfo{
+			Onion:         b.Onion,
+			BlockedAtUnix: b.BlockedAt.Unix(),
+			Attempts:      b.Attempts,
+		}
+		if !b.LastAttempt.IsZero() {
+			info.LastAttemptUnix = b.LastAttempt.Unix()
+		}
+		resp.Blocked = append(resp.Blocked, info)
+	}
+	return resp, nil
+}
+
+func (s *cliService) MigrateIdentity(ctx context.Context, req *pb.MigrateIdentityRequest) (*pb.MigrateIdentityResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	newOnion, notified, err := node.MigrateIdentity(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	s.cacheAddress(newOnion)
+	return &pb.MigrateIdentityResponse{NewOnion: newOnion, PeersNotified: int32(notified)}, nil
+}
+
+func (s *cliService) AnnounceMove(ctx context.Context, req *pb.AnnounceMoveRequest) (*pb.AnnounceMoveResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	acks, err := node.AnnounceMove(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	resp := &pb.AnnounceMoveResponse{}
+	for _, ack := range acks {
+		resp.Acks = append(resp.Acks, &pb.MoveAckInfo{Onion: ack.Onion, Alias: ack.Alias, Error: ack.Err})
+	}
+	return resp, nil
+}
+
+// peerCallError maps a failed call to a remote peer onto a gRPC code
+// the CLI exit-code table distinguishes: dial timeouts become
+// DeadlineExceeded, everything else that kept the peer unreachable
+// stays Unavailable.
+func peerCallError(op string, err error) error {
+	if errors.Is(err, bbnode.ErrDialTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return status.Errorf(codes.DeadlineExceeded, "%s: %v", op, err)
+	}
+	return status.Errorf(codes.Unavailable, "%s: %v", op, err)
+}
+
+func (s *cliService) SendMessage(ctx context.Context, req *pb.SendMessageRequest) (*pb.SendMessageResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.SendMessage(ctx, req.Peer, req.Body); err != nil {
+		return nil, peerCallError("send message", err)
+	}
+	return &pb.SendMessageResponse{}, nil
+}
+
+func (s *cliService) ListMessages(ctx context.Context, req *pb.ListMessagesRequest) (*pb.ListMessagesResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := node.ListMessages(req.Peer)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list messages: %v", err)
+	}
+	resp := &pb.ListMessagesResponse{}
+	for _, m := range msgs {
+		info := &pb.MessageInfo{
+			Id:         m.ID,
+			Peer:       m.Peer,
+			Body:       m.Body,
+			Incoming:   m.Incoming,
+			SentAtUnix: m.SentAt.Unix(),
+			Read:       m.Read,
+		}
+		if !m.ReceivedAt.IsZero() {
+			info.ReceivedAtUnix = m.ReceivedAt.Unix()
+		}
+		resp.Messages = append(resp.Messages, info)
+	}
+	return resp, nil
+}
+
+func (s *cliService) MarkRead(ctx context.Context, req *pb.MarkReadRequest) (*pb.MarkReadResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.MarkRead(req.Ids); err != nil {
+		return nil, status.Errorf(codes.Internal, "mark read: %v", err)
+	}
+	return &pb.MarkReadResponse{}, nil
+}
+
+func agreementInfo(a *bbnode.Agreement) *pb.AgreementInfo {
+	info := &pb.AgreementInfo{
+		Id:             a.ID,
+		Proposer:       a.Proposer,
+		Acceptor:       a.Acceptor,
+		OfferedBytes:   a.OfferedBytes,
+		RequestedBytes: a.RequestedBytes,
+		Days:           a.Days,
+		State:          a.State(),
+		CreatedAtUnix:  a.CreatedAt.Unix(),
+	}
+	if exp := a.ExpiresAt(); !exp.IsZero() {
+		info.ExpiresAtUnix = exp.Unix()
+	}
+	return info
+}
+
+func (s *cliService) ProposeAgreement(ctx context.Context, req *pb.ProposeAgreementRequest) (*pb.ProposeAgreementResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	a, err := node.ProposeAgreement(ctx, req.Peer, req.OfferedBytes, req.RequestedBytes, req.Days)
+	if err != nil {
+		return nil, peerCallError("propose agreement", err)
+	}
+	return &pb.ProposeAgreementResponse{Agreement: agreementInfo(a)}, nil
+}
+
+func (s *cliService) ExtendAgreement(ctx context.Context, req *pb.ExtendAgreementRequest) (*pb.ExtendAgreementResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	a, err := node.ExtendAgreement(ctx, req.Peer, req.Days)
+	if err != nil {
+		return nil, peerCallError("extend agreement", err)
+	}
+	return &pb.ExtendAgreementResponse{Agreement: agreementInfo(a)}, nil
+}
+
+func (s *cliService) AcceptAgreement(ctx context.Context, req *pb.AcceptAgreementRequest) (*pb.AcceptAgreementResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	a, err := node.AcceptAgreement(ctx, req.Id)
+	if err != nil {
+		return nil, peerCallError("accept agreement", err)
+	}
+	return &pb.AcceptAgreementResponse{Agreement: agreementInfo(a)}, nil
+}
+
+func (s *cliService) ListAgreements(ctx context.Context, req *pb.ListAgreementsRequest) (*pb.ListAgreementsResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	list, err := node.ListAgreements()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list agreements: %v", err)
+	}
+	resp := &pb.ListAgreementsResponse{}
+	for i := range list {
+		resp.Agreements = append(resp.Agreements, agreementInfo(&list[i]))
+	}
+	return resp, nil
+}
+
+func (s *cliService) SetOnionAuth(ctx context.Context, req *pb.SetOnionAuthRequest) (*pb.SetOnionAuthResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.SetOnionAuth(ctx, req.Enabled); err != nil {
+		return nil, status.Errorf(codes.Internal, "set onion auth: %v", err)
+	}
+	return &pb.SetOnionAuthResponse{}, nil
+}
+
+func backupInfo(b *bbnode.Backup) *pb.BackupInfo {
+	info := &pb.BackupInfo{
+		Id:            b.ID,
+		Peers:         b.Peers,
+		Replication:   b.Replication,
+		SourceDir:     b.SourceDir,
+		BaseId:        b.BaseID,
+		CreatedAtUnix: b.CreatedAt.Unix(),
+		FileCount:     int32(b.FileCount),
+		TotalBytes:    b.TotalBytes,
+		UploadedBytes: b.UploadedBytes,
+		ChunkCount:    int32(b.ChunkCount),
+	}
+	if !b.LastVerifiedAt.IsZero() {
+		info.LastVerifiedUnix = b.LastVerifiedAt.Unix()
+	}
+	return info
+}
+
+func (s *cliService) CreateBackup(ctx context.Context, req *pb.CreateBackupRequest) (*pb.CreateBackupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	opts := bbnode.BackupOptions{
+		Chunker:        req.Chunker,
+		Hash:           req.Hash,
+		Include:        req.Include,
+		Exclude:        req.Exclude,
+		FollowSymlinks: req.FollowSymlinks,
+	}
+	if req.DryRun {
+		planned, total, err := node.PlanBackup(req.SourceDir, opts)
+		if errors.Is(err, bbnode.ErrSourceNotAllowed) {
+			return nil, status.Errorf(codes.PermissionDenied, "plan backup: %v", err)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "plan backup: %v", err)
+		}
+		resp := &pb.CreateBackupResponse{PlannedBytes: total}
+		for _, f := range planned {
+			resp.Planned = append(resp.Planned, &pb.PlannedFileInfo{Path: f.Path, Size: f.Size})
+		}
+		return resp, nil
+	}
+	b, err := node.CreateBackup(ctx, req.Peers, req.SourceDir, opts)
+	if errors.Is(err, bbnode.ErrSourceNotAllowed) {
+		return nil, status.Errorf(codes.PermissionDenied, "create backup: %v", err)
+	}
+	if err != nil {
+		return nil, peerCallError("create backup", err)
+	}
+	return &pb.CreateBackupResponse{Backup: backupInfo(b)}, nil
+}
+
+func (s *cliService) CreateStreamBackup(stream pb.CLI_CreateStreamBackupServer) error {
+	node, err := s.getNode()
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "create stream backup: %v", err)
+	}
+	// The CLI hanging up mid-stream cancels the stream context, which
+	// fails the backup job; its partial chunks are left for garbage
+	// collection.
+	r := &streamBackupReader{stream: stream, buf: first.Data}
+	b, err := node.CreateStreamBackup(stream.Context(), first.Peers, first.Name, r)
+	if err != nil {
+		return peerCallError("create stream backup", err)
+	}
+	return stream.SendAndClose(&pb.CreateStreamBackupResponse{Backup: backupInfo(b)})
+}
+
+// streamBackupReader adapts inbound CreateStreamBackup frames to the
+// io.Reader the node chunks from.
+type streamBackupReader struct {
+	stream pb.CLI_CreateStreamBackupServer
+	buf    []byte
+	eof    bool
+}
+
+func (r *streamBackupReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		req, err := r.stream.Recv()
+		if err == io.EOF {
+			r.eof = true
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, err
+		}
+		r.buf = req.Data
+	}
+	m := copy(p, r.buf)
+	r.buf = r.buf[m:]
+	return m, nil
+}
+
+func (s *cliService) ListBackups(ctx context.Context, req *pb.ListBackupsRequest) (*pb.ListBackupsResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	sortOrder := req.Sort
+	if sortOrder == "" {
+		sortOrder = "date"
+	}
+	var key func(b *bbnode.Backup) string
+	switch sortOrder {
+	case "date":
+		key = func(b *bbnode.Backup) string { return descendingKey(b.CreatedAt.UnixNano()) }
+	case "name":
+		key = func(b *bbnode.Backup) string { return b.SourceDir }
+	case "size":
+		key = func(b *bbnode.Backup) string { return descendingKey(b.TotalBytes) }
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown sort %q; use date, name or size", req.Sort)
+	}
+	all, err := node.ListBackups()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list backups: %v", err)
+	}
+	list := all[:0]
+	for _, b := range all {
+		if b.DeletedAt.IsZero() || req.All {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ki, kj := key(&list[i]), key(&list[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return list[i].ID < list[j].ID
+	})
+	if req.PageToken != "" {
+		cur, err := decodePageToken(req.PageToken, sortOrder)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		for len(list) > 0 && !afterCursor(cur, key(&list[0]), list[0].ID) {
+			list = list[1:]
+		}
+	}
+	window := time.Duration(node.RetentionConfig().BackupTrashDays) * 24 * time.Hour
+	resp := &pb.ListBackupsResponse{}
+	if size := pageSize(req.PageSize); len(list) > size {
+		list = list[:size]
+		last := &list[size-1]
+		resp.NextPageToken = encodePageToken(pageCursor{Sort: sortOrder, Key: key(last), ID: last.ID})
+	}
+	for i := range list {
+		b := &list[i]
+		info := backupInfo(b)
+		if !b.DeletedAt.IsZero() {
+			info.DeletedAtUnix = b.DeletedAt.Unix()
+			info.PurgeAtUnix = b.DeletedAt.Add(window).Unix()
+		}
+		resp.Backups = append(resp.Backups, info)
+	}
+	return resp, nil
+}
+
+func (s *cliService) DeleteBackup(ctx context.Context, req *pb.DeleteBackupRequest) (*pb.DeleteBackupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	purgeAt, err := node.DeleteBackup(req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "delete backup: %v", err)
+	}
+	return &pb.DeleteBackupResponse{PurgeAtUnix: purgeAt.Unix()}, nil
+}
+
+func (s *cliService) UndeleteBackup(ctx context.Context, req *pb.UndeleteBackupRequest) (*pb.UndeleteBackupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.UndeleteBackup(req.Id); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "undelete backup: %v", err)
+	}
+	return &pb.UndeleteBackupResponse{}, nil
+}
+
+func (s *cliService) DiffBackups(ctx context.Context, req *pb.DiffBackupsRequest) (*pb.DiffBackupsResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	c, err := node.DiffBackups(req.OldId, req.NewId)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "diff backups: %v", err)
+	}
+	resp := &pb.DiffBackupsResponse{Deleted: c.Deleted}
+	for _, e := range c.Added {
+		resp.Added = append(resp.Added, e.Path)
+	}
+	for _, e := range c.Modified {
+		resp.Modified = append(resp.Modified, e.Path)
+	}
+	return resp, nil
+}
+
+func (s *cliService) RestoreBackup(ctx context.Context, req *pb.RestoreBackupRequest) (*pb.RestoreBackupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.RestoreBackup(ctx, req.Id, req.DestDir, req.WriteReport); err != nil {
+		return nil, peerCallError("restore backup", err)
+	}
+	return &pb.RestoreBackupResponse{}, nil
+}
+
+// restoreStreamFrame bounds one RestoreStream response so a frame never
+// approaches the clirpc message ceiling.
+const restoreStreamFrame = 64 << 10
+
+// restoreStreamWriter adapts a RestoreStream server stream to io.Writer,
+// slicing writes into bounded frames.
+type restoreStreamWriter struct {
+	stream pb.CLI_RestoreStreamServer
+}
+
+func (w *restoreStreamWriter) Write(p []byte) (int, error) {
+	sent := 0
+	for len(p) > 0 {
+		frame := p
+		if len(frame) > restoreStreamFrame {
+			frame = p[:restoreStreamFrame]
+		}
+		if err := w.stream.Send(&pb.RestoreStreamResponse{Data: frame}); err != nil {
+			return sent, err
+		}
+		sent += len(frame)
+		p = p[len(frame):]
+	}
+	return sent, nil
+}
+
+func (s *cliService) RestoreStream(req *pb.RestoreStreamRequest, stream pb.CLI_RestoreStreamServer) error {
+	node, err := s.getNode()
+	if err != nil {
+		return err
+	}
+	// A consumer hanging up cancels the stream context, which cancels
+	// the restore job through the node's checkpoints.
+	if err := node.RestoreBackupStream(stream.Context(), req.Id, &restoreStreamWriter{stream: stream}); err != nil {
+		return peerCallError("restore stream", err)
+	}
+	return nil
+}
+
+func (s *cliService) RecoverBackups(ctx context.Context, req *pb.RecoverBackupsRequest) (*pb.RecoverBackupsResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	list, err := node.RecoverFromPeer(ctx, req.Peer)
+	if err != nil {
+		return nil, peerCallError("recover backups", err)
+	}
+	resp := &pb.RecoverBackupsResponse{}
+	for i := range list {
+		resp.Recovered = append(resp.Recovered, backupInfo(&list[i]))
+	}
+	return resp, nil
+}
+
+func (s *cliService) BackupStatus(ctx context.Context, req *pb.BackupStatusRequest) (*pb.BackupStatusResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	list, err := node.BackupStatus(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "backup status: %v", err)
+	}
+	resp := &pb.BackupStatusResponse{}
+	for _, r := range list {
+		resp.Peers = append(resp.Peers, &pb.PeerReplicationInfo{
+			Peer:          r.Peer,
+			State:         r.State,
+			MissingChunks: int32(r.MissingChunks),
+		})
+	}
+	report, err := node.RestoreReport(req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "restore report: %v", err)
+	}
+	if report != nil {
+		info := &pb.RestoreReportInfo{
+			DestDir:        report.DestDir,
+			StartedAtUnix:  report.StartedAt.Unix(),
+			FinishedAtUnix: report.FinishedAt.Unix(),
+			FilesOk:        int32(report.FilesOK),
+			FilesFailed:    int32(report.FilesFailed),
+			FilesSkipped:   int32(report.FilesSkipped),
+			BytesVerified:  report.BytesVerified,
+		}
+		for _, f := range report.Files {
+			info.Files = append(info.Files, &pb.RestoreFileResultInfo{
+				Path:   f.Path,
+				Result: f.Result,
+				Detail: f.Detail,
+			})
+		}
+		resp.LastRestore = info
+	}
+	return resp, nil
+}
+
+func (s *cliService) RepairBackup(ctx context.Context, req *pb.RepairBackupRequest) (*pb.RepairBackupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	res, err := node.RepairBackup(ctx, req.Id, req.Peer)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "repair backup: %v", err)
+	}
+	return &pb.RepairBackupResponse{
+		Checked:    int64(res.Checked),
+		Missing:    int64(res.Missing),
+		Repaired:   int64(res.Repaired),
+		Unrepaired: res.Unrepaired,
+	}, nil
+}
+
+func (s *cliService) VerifyBackup(ctx context.Context, req *pb.VerifyBackupRequest) (*pb.VerifyBackupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	res, err := node.VerifyBackup(ctx, req.Id, int(req.SamplePercent), req.Seed, req.Repair)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "verify backup: %v", err)
+	}
+	resp := &pb.VerifyBackupResponse{
+		SamplePercent: int32(res.SamplePercent),
+		Seed:          res.Seed,
+	}
+	if !res.VerifiedAt.IsZero() {
+		resp.VerifiedAtUnix = res.VerifiedAt.Unix()
+	}
+	for i := range res.Peers {
+		pr := &res.Peers[i]
+		resp.Peers = append(resp.Peers, &pb.VerifyPeerResultInfo{
+			Onion:         pr.Onion,
+			Error:         pr.Error,
+			Checked:       int64(pr.Checked),
+			Missing:       pr.Missing,
+			Sampled:       int64(pr.Sampled),
+			Failed:        pr.Failed,
+			ManifestOk:    pr.ManifestOK,
+			ManifestError: pr.ManifestError,
+			Repaired:      int64(pr.Repaired),
+			Unrepaired:    pr.Unrepaired,
+		})
+	}
+	return resp, nil
+}
+
+// jobDetail summarizes what a job operates on for bbcli job list.
+func jobDetail(job *bbnode.Job) string {
+	switch job.Kind {
+	case "backup":
+		return fmt.Sprintf("%s -> %s", job.SourceDir, strings.Join(job.Peers, ","))
+	case "restore":
+		return fmt.Sprintf("%s -> %s", job.BackupID, job.DestDir)
+	case "repair":
+		return fmt.Sprintf("%s on %s", job.BackupID, job.Peer)
+	case "verify":
+		return fmt.Sprintf("%s (%d%% sample)", job.BackupID, job.SamplePercent)
+	case "wipe":
+		return fmt.Sprintf("%s (%d blobs, %d bytes deleted)", job.Peer, job.WipedBlobs, job.WipedBytes)
+	}
+	return ""
+}
+
+func (s *cliService) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := node.ListJobs()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list jobs: %v", err)
+	}
+	resp := &pb.ListJobsResponse{}
+	for i := range jobs {
+		job := &jobs[i]
+		resp.Jobs = append(resp.Jobs, &pb.JobInfo{
+			Id:            job.ID,
+			Kind:          job.Kind,
+			State:         job.State,
+			Error:         job.Error,
+			CreatedAtUnix: job.CreatedAt.Unix(),
+			UpdatedAtUnix: job.UpdatedAt.Unix(),
+			Detail:        jobDetail(job),
+		})
+	}
+	return resp, nil
+}
+
+func (s *cliService) WatchJob(req *pb.WatchJobRequest, stream pb.CLI_WatchJobServer) error {
+	node, err := s.getNode()
+	if err != nil {
+		return err
+	}
+	err = node.WatchJob(stream.Context(), req.Id, func(p bbnode.JobProgress) error {
+		return stream.Send(&pb.WatchJobResponse{
+			State:       p.State,
+			BytesDone:   p.BytesDone,
+			BytesTotal:  p.BytesTotal,
+			CurrentFile: p.CurrentFile,
+			ChunksDone:  p.ChunksDone,
+			ChunksTotal: p.ChunksTotal,
+			BytesPerSec: p.BytesPerSec,
+			Done:        p.Done,
+			Error:       p.Error,
+		})
+	})
+	if err != nil && errors.Is(err, secstore.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "watch job: %v", err)
+	}
+	return err
+}
+
+func (s *cliService) CancelJob(ctx context.Context, req *pb.CancelJobRequest) (*pb.CancelJobResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.CancelJob(req.Id); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cancel job: %v", err)
+	}
+	return &pb.CancelJobResponse{}, nil
+}
+
+func (s *cliService) PauseJob(ctx context.Context, req *pb.PauseJobRequest) (*pb.PauseJobResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.PauseJob(req.Id); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "pause job: %v", err)
+	}
+	return &pb.PauseJobResponse{}, nil
+}
+
+func (s *cliService) ResumeJob(ctx context.Context, req *pb.ResumeJobRequest) (*pb.ResumeJobResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.ResumeJob(req.Id); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "resume job: %v", err)
+	}
+	return &pb.ResumeJobResponse{}, nil
+}
+
+func (s *cliService) CreatePeerGroup(ctx context.Context, req *pb.CreatePeerGroupRequest) (*pb.CreatePeerGroupResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := node.CreateGroup(req.Name, req.Members); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.CreatePeerGroupResponse{}, nil
+}
+
+func (s *cliService) ListPeerGroups(ctx context.Context, req *pb.ListPeerGroupsRequest) (*pb.ListPeerGroupsResponse, error) {
+	node, err := s.getNode()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := node.Groups()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list groups: %v", err)
+	}
+	names, err := node.GroupNames()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list groups: %v", err)
+	}
+	resp := &pb.ListPeerGroupsResponse{}
+	for _, name := range names {
+		resp.Groups = append(resp.Groups, &pb.PeerGroupInfo{Name: name, Members: groups[name]})
+	}
+	return resp, nil
+}
+
+// shutdown stops the node if it is running.
+func (s *cliService) shutdown() {
+	s.mu.Lock()
+	node := s.node
+	s.node = nil
+	s.mu.Unlock()
+	if node != nil {
+		if err := node.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "stop node: %v\n", err)
+		}
+	}
+	s.auditEvent("shutdown", nil)
+}
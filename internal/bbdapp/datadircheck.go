@@ -0,0 +1,188 @@
+package bbdapp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataDirProbe is the result of one data dir preflight check.
+type dataDirProbe struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// knownBadFSTypes maps statfs magic numbers of filesystems where flock,
+// atomic rename, or permissions are known not to behave — network
+// filesystems and FAT variants — to a readable name.
+var knownBadFSTypes = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x4d44:     "msdos/vfat",
+	0x2011bab0: "exfat",
+	0x65735546: "fuse",
+}
+
+// checkDataDir probes dir for the guarantees the daemon relies on: a
+// local filesystem, permissions that stick, atomic rename, and working
+// flock. The dir must already exist.
+func checkDataDir(dir string) []dataDirProbe {
+	return []dataDirProbe{
+		probeFSType(dir),
+		probePermissions(dir),
+		probeParentWritable(dir),
+		probeAtomicRename(dir),
+		probeFlock(dir),
+	}
+}
+
+// probeParentWritable flags a parent directory other users can write:
+// they could swap the whole data dir — cli-keys included — between
+// restarts. A sticky world-writable parent like /tmp is tolerated; the
+// sticky bit stops other users from renaming entries they do not own.
+func probeParentWritable(dir string) dataDirProbe {
+	p := dataDirProbe{Name: "parent-writable"}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		p.Detail = fmt.Sprintf("resolve %s: %v", dir, err)
+		return p
+	}
+	parent := filepath.Dir(abs)
+	info, err := os.Stat(parent)
+	if err != nil {
+		p.Detail = fmt.Sprintf("stat %s: %v", parent, err)
+		return p
+	}
+	if perm := info.Mode().Perm(); perm&0o022 != 0 && info.Mode()&os.ModeSticky == 0 {
+		p.Detail = fmt.Sprintf("%s is writable by other users (mode %#o); run chmod go-w %s or move the data dir", parent, perm, parent)
+		return p
+	}
+	p.OK = true
+	return p
+}
+
+// probeFSType statfs-es dir and flags known-problematic filesystem
+// types (NFS, SMB/CIFS, FAT variants, FUSE overlays like cloud-sync
+// folders).
+func probeFSType(dir string) dataDirProbe {
+	p := dataDirProbe{Name: "fs-type"}
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		p.Detail = fmt.Sprintf("statfs: %v", err)
+		return p
+	}
+	if name, bad := knownBadFSTypes[int64(st.Type)]; bad {
+		p.Detail = fmt.Sprintf("%s is on %s, which does not reliably support flock, atomic rename, or permissions", dir, name)
+		return p
+	}
+	p.OK = true
+	p.Detail = fmt.Sprintf("filesystem type 0x%x", st.Type)
+	return p
+}
+
+// probePermissions creates a file with mode 0600 and verifies the mode
+// sticks; FAT and some sync folders report everything world-readable.
+func probePermissions(dir string) dataDirProbe {
+	p := dataDirProbe{Name: "permissions"}
+	f, err := os.CreateTemp(dir, ".permcheck-*")
+	if err != nil {
+		p.Detail = fmt.Sprintf("create test file: %v", err)
+		return p
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+	if err := os.Chmod(name, 0o600); err != nil {
+		p.Detail = fmt.Sprintf("chmod test file: %v", err)
+		return p
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		p.Detail = fmt.Sprintf("stat test file: %v", err)
+		return p
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		p.Detail = fmt.Sprintf("mode 0600 came back as %04o", perm)
+		return p
+	}
+	p.OK = true
+	p.Detail = "mode 0600 sticks"
+	return p
+}
+
+// probeAtomicRename renames a file over an existing one and verifies
+// the replacement took, the way the secstore and chunk store persist
+// data.
+func probeAtomicRename(dir string) dataDirProbe {
+	p := dataDirProbe{Name: "atomic-rename"}
+	target := filepath.Join(dir, ".renamecheck")
+	tmp := target + ".tmp"
+	defer os.Remove(target)
+	defer os.Remove(tmp)
+	if err := os.WriteFile(target, []byte("old"), 0o600); err != nil {
+		p.Detail = fmt.Sprintf("write test file: %v", err)
+		return p
+	}
+	if err := os.WriteFile(tmp, []byte("new"), 0o600); err != nil {
+		p.Detail = fmt.Sprintf("write test file: %v", err)
+		return p
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		p.Detail = fmt.Sprintf("rename over existing file: %v", err)
+		return p
+	}
+	data, err := os.ReadFile(target)
+	if err != nil || string(data) != "new" {
+		p.Detail = fmt.Sprintf("renamed content = %q, %v", data, err)
+		return p
+	}
+	p.OK = true
+	p.Detail = "rename replaces atomically"
+	return p
+}
+
+// probeFlock verifies that flock both acquires and actually excludes a
+// second holder; on some network filesystems it succeeds without
+// locking anything.
+func probeFlock(dir string) dataDirProbe {
+	p := dataDirProbe{Name: "flock"}
+	name := filepath.Join(dir, ".flockcheck")
+	defer os.Remove(name)
+	f1, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		p.Detail = fmt.Sprintf("open test file: %v", err)
+		return p
+	}
+	defer f1.Close()
+	if err := syscall.Flock(int(f1.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		p.Detail = fmt.Sprintf("acquire: %v", err)
+		return p
+	}
+	f2, err := os.OpenFile(name, os.O_RDWR, 0o600)
+	if err != nil {
+		p.Detail = fmt.Sprintf("reopen test file: %v", err)
+		return p
+	}
+	defer f2.Close()
+	if err := syscall.Flock(int(f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+		p.Detail = "a second flock on a held lock succeeded; locks do not exclude"
+		return p
+	}
+	if err := syscall.Flock(int(f1.Fd()), syscall.LOCK_UN); err != nil {
+		p.Detail = fmt.Sprintf("release: %v", err)
+		return p
+	}
+	if err := syscall.Flock(int(f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		p.Detail = fmt.Sprintf("reacquire after release: %v", err)
+		return p
+	}
+	p.OK = true
+	p.Detail = "locks acquire, exclude, and release"
+	return p
+}
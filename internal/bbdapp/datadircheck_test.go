@@ -0,0 +1,106 @@
+package bbdapp
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCheckDataDirLocalFS(t *testing.T) {
+	// A plain temp dir on a local filesystem passes every probe.
+	for _, p := range checkDataDir(t.TempDir()) {
+		if !p.OK {
+			t.Errorf("probe %s failed on a local dir: %s", p.Name, p.Detail)
+		}
+	}
+}
+
+func TestProbePermissions(t *testing.T) {
+	dir := t.TempDir()
+	if p := probePermissions(dir); !p.OK {
+		t.Errorf("probePermissions = %+v, want OK", p)
+	}
+	// No leftover test files.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("probe left %d file(s) behind", len(entries))
+	}
+}
+
+func TestProbeParentWritable(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "data")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if p := probeParentWritable(dir); !p.OK {
+		t.Errorf("private parent: %+v, want OK", p)
+	}
+	if err := os.Chmod(parent, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if p := probeParentWritable(dir); p.OK {
+		t.Error("world-writable parent passed the probe")
+	}
+	// A sticky world-writable parent (like /tmp) is fine: other users
+	// cannot rename the data dir out from under us there.
+	if err := os.Chmod(parent, 0o777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if p := probeParentWritable(dir); !p.OK {
+		t.Errorf("sticky parent: %+v, want OK", p)
+	}
+}
+
+func TestProbeAtomicRename(t *testing.T) {
+	dir := t.TempDir()
+	if p := probeAtomicRename(dir); !p.OK {
+		t.Errorf("probeAtomicRename = %+v, want OK", p)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("probe left %d file(s) behind", len(entries))
+	}
+}
+
+func TestProbeFlock(t *testing.T) {
+	dir := t.TempDir()
+	if p := probeFlock(dir); !p.OK {
+		t.Errorf("probeFlock = %+v, want OK", p)
+	}
+
+	// The probe must notice when the lock is already held elsewhere:
+	// it then cannot exercise release/reacquire and reports acquire
+	// failure rather than pretending locks work.
+	name := filepath.Join(dir, ".flockcheck")
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("flock: %v", err)
+	}
+	if p := probeFlock(dir); p.OK {
+		t.Errorf("probeFlock = %+v with the lock held elsewhere, want failure", p)
+	}
+}
+
+func TestProbeFSType(t *testing.T) {
+	p := probeFSType(t.TempDir())
+	if !p.OK {
+		// tmpfs, ext4, btrfs, xfs are all fine; only network and FAT
+		// filesystems are flagged. CI never runs the data dir on those.
+		t.Errorf("probeFSType = %+v, want OK", p)
+	}
+	if q := probeFSType(filepath.Join(t.TempDir(), "missing")); q.OK {
+		t.Errorf("probeFSType on a missing dir = %+v, want failure", q)
+	}
+}
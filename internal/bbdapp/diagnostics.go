@@ -0,0 +1,106 @@
+package bbdapp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+)
+
+// selfDialTimeout bounds the onion self-dial diagnostic; reaching our
+// own address goes through a full Tor round trip.
+const selfDialTimeout = 90 * time.Second
+
+// diskSpaceWarnBytes is the free-space level below which the disk check
+// warns.
+const diskSpaceWarnBytes = 5 << 30 // 5 GiB
+
+func check(name, status, format string, args ...any) *pb.DiagnosticCheck {
+	return &pb.DiagnosticCheck{
+		Name:    name,
+		Status:  status,
+		Details: fmt.Sprintf(format, args...),
+	}
+}
+
+func (s *cliService) RunDiagnostics(ctx context.Context, req *pb.RunDiagnosticsRequest) (*pb.RunDiagnosticsResponse, error) {
+	resp := &pb.RunDiagnosticsResponse{}
+	add := func(c *pb.DiagnosticCheck) {
+		resp.Checks = append(resp.Checks, c)
+	}
+
+	// Data dir exists with sane permissions.
+	if info, err := os.Stat(s.dataDir); err != nil {
+		add(check("data-dir", "fail", "cannot stat %s: %v", s.dataDir, err))
+	} else if !info.IsDir() {
+		add(check("data-dir", "fail", "%s is not a directory", s.dataDir))
+	} else if info.Mode().Perm()&0o077 != 0 {
+		add(check("data-dir", "warn", "%s is accessible by other users (mode %04o, want 0700)", s.dataDir, info.Mode().Perm()))
+	} else {
+		add(check("data-dir", "pass", "%s", s.dataDir))
+	}
+
+	// Filesystem preflight results from startup. A failed probe here
+	// means the daemon runs with --data-dir-unsafe-ok.
+	for _, p := range s.dataDirCheck {
+		status := "pass"
+		if !p.OK {
+			status = "fail"
+		}
+		add(check("data-dir-"+p.Name, status, "%s", p.Detail))
+	}
+
+	// CLI credentials are present (the caller reached us, but a second
+	// bbcli on another account would need them too).
+	keysDir := filepath.Join(s.dataDir, "cli-keys")
+	if _, err := os.Stat(filepath.Join(keysDir, "client.key")); err != nil {
+		add(check("cli-keys", "fail", "missing client credentials in %s", keysDir))
+	} else {
+		add(check("cli-keys", "pass", "%s", keysDir))
+	}
+
+	// Backup source allow-list.
+	if len(s.backupRoots) > 0 {
+		add(check("backup-roots", "pass", "%s", strings.Join(s.backupRoots, ", ")))
+	} else {
+		add(check("backup-roots", "warn", "no --backup-root configured; backups may read any path the daemon can read"))
+	}
+
+	// Free disk space under the data dir.
+	var st unix.Statfs_t
+	if err := unix.Statfs(s.dataDir, &st); err != nil {
+		add(check("disk-space", "warn", "statfs: %v", err))
+	} else {
+		free := int64(st.Bavail) * st.Bsize
+		status := "pass"
+		if free < diskSpaceWarnBytes {
+			status = "warn"
+		}
+		add(check("disk-space", status, "%d bytes free", free))
+	}
+
+	// Lock state and, when unlocked, the onion self-dial.
+	s.mu.RLock()
+	node := s.node
+	s.mu.RUnlock()
+	if node == nil {
+		add(check("lock-state", "warn", "locked; unlock to run the onion reachability check"))
+		return resp, nil
+	}
+	add(check("lock-state", "pass", "unlocked, onion %s", node.Address()))
+
+	dialCtx, cancel := context.WithTimeout(ctx, selfDialTimeout)
+	defer cancel()
+	if err := node.SelfCheck(dialCtx); err != nil {
+		add(check("self-dial", "fail", "%v", err))
+	} else {
+		add(check("self-dial", "pass", "own onion reachable"))
+	}
+	return resp, nil
+}
@@ -0,0 +1,125 @@
+package bbdapp
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/bbcliapp"
+	"github.com/starius/barterbackup/internal/clitls"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// startDaemon runs the daemon against a mock network until the test
+// ends and returns its data dir once the clirpc endpoint is published.
+func startDaemon(t *testing.T, cliAddr string) string {
+	t.Helper()
+	dataDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Config{DataDir: dataDir, CLIAddr: cliAddr, Network: netmock.New()})
+	}()
+	keysDir := filepath.Join(dataDir, "cli-keys")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := clitls.ReadEndpoint(keysDir); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("daemon did not publish its endpoint")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Run: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("daemon did not shut down")
+		}
+	})
+	return dataDir
+}
+
+func TestEndpointExplicitPort(t *testing.T) {
+	// Reserve a free port, then hand it to the daemon explicitly.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dataDir := startDaemon(t, addr)
+	got, err := clitls.ReadEndpoint(filepath.Join(dataDir, "cli-keys"))
+	if err != nil {
+		t.Fatalf("ReadEndpoint: %v", err)
+	}
+	if got != addr {
+		t.Errorf("published endpoint = %q, want %q", got, addr)
+	}
+}
+
+func TestEndpointEphemeralPort(t *testing.T) {
+	dataDir := startDaemon(t, "127.0.0.1:0")
+	keysDir := filepath.Join(dataDir, "cli-keys")
+	addr, err := clitls.ReadEndpoint(keysDir)
+	if err != nil {
+		t.Fatalf("ReadEndpoint: %v", err)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("published endpoint %q: %v", addr, err)
+	}
+	if host != "127.0.0.1" || port == "0" {
+		t.Errorf("published endpoint = %q, want 127.0.0.1 with a real port", addr)
+	}
+	if !daemonAnswersAt(addr, keysDir) {
+		t.Errorf("daemon does not answer at published endpoint %s", addr)
+	}
+}
+
+func TestEndpointRemovedOnShutdown(t *testing.T) {
+	dataDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Config{DataDir: dataDir, CLIAddr: "127.0.0.1:0", Network: netmock.New()})
+	}()
+	keysDir := filepath.Join(dataDir, "cli-keys")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := clitls.ReadEndpoint(keysDir); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("daemon did not publish its endpoint")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(keysDir, "endpoint")); !os.IsNotExist(err) {
+		t.Errorf("endpoint file survived shutdown: %v", err)
+	}
+}
+
+func TestCLIDiscoversEndpoint(t *testing.T) {
+	dataDir := startDaemon(t, "127.0.0.1:0")
+	// No --daemon-addr: bbcli must find the ephemeral port through the
+	// endpoint file.
+	if err := bbcliapp.Run([]string{"--data-dir", dataDir, "healthcheck"}); err != nil {
+		t.Fatalf("bbcli healthcheck via endpoint discovery: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package bbdapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/bbcliapp"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// TestIntegrationCLI runs the real daemon and drives it through the real
+// bbcli code path over a loopback clirpc connection: unlock, status,
+// healthcheck, peers add, and shutdown, asserting on the command output.
+// Only the node network is mocked.
+func TestIntegrationCLI(t *testing.T) {
+	dataDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- Run(ctx, Config{
+			DataDir: dataDir,
+			CLIAddr: "127.0.0.1:0",
+			Network: netmock.New(),
+		})
+	}()
+
+	// bbcli runs one command against the daemon, capturing its stdout.
+	// The ephemeral port is discovered via the published endpoint file,
+	// exactly as the real client does.
+	bbcli := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := bbcliapp.Run(append([]string{"--data-dir", dataDir}, args...),
+			bbcliapp.WithOutput(&out))
+		return out.String(), err
+	}
+
+	// Readiness: poll healthcheck until the daemon serves, instead of
+	// sleeping a fixed amount.
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		out, err := bbcli("healthcheck")
+		if err == nil {
+			if !strings.Contains(out, "daemon ok") {
+				t.Fatalf("healthcheck output = %q", out)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("daemon not healthy before deadline: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("integration-pw\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bbcli("unlock", "--password-file", passwordFile)
+	if err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if !strings.Contains(out, "unlocked; onion address: ") {
+		t.Errorf("unlock output = %q", out)
+	}
+
+	out, err = bbcli("status")
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !strings.Contains(out, "state: unlocked") {
+		t.Errorf("status output = %q", out)
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onion := keys.OnionAddress(pub)
+	out, err = bbcli("peers", "add", onion, "--alias", "mate")
+	if err != nil {
+		t.Fatalf("peers add: %v", err)
+	}
+	if !strings.Contains(out, "added peer "+onion) {
+		t.Errorf("peers add output = %q", out)
+	}
+	out, err = bbcli("peers", "list")
+	if err != nil {
+		t.Fatalf("peers list: %v", err)
+	}
+	if !strings.Contains(out, "mate\t"+onion) {
+		t.Errorf("peers list output = %q", out)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("daemon did not shut down")
+	}
+}
+
+// TestDebugReflectionRPCCall exercises the bbcli rpc call escape hatch
+// against a daemon started with reflection enabled.
+func TestDebugReflectionRPCCall(t *testing.T) {
+	dataDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- Run(ctx, Config{
+			DataDir:         dataDir,
+			CLIAddr:         "127.0.0.1:0",
+			Network:         netmock.New(),
+			DebugReflection: true,
+		})
+	}()
+	bbcli := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := bbcliapp.Run(append([]string{"--data-dir", dataDir}, args...),
+			bbcliapp.WithOutput(&out))
+		return out.String(), err
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		if _, err := bbcli("healthcheck"); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("daemon not healthy before deadline: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// A unary method resolved and invoked dynamically; the daemon is
+	// still locked, which GetStatus reports.
+	out, err := bbcli("rpc", "call", "clirpc.CLI/GetStatus")
+	if err != nil {
+		t.Fatalf("rpc call GetStatus: %v", err)
+	}
+	if !strings.Contains(out, `"state": "locked"`) {
+		t.Errorf("rpc call output = %q", out)
+	}
+
+	// Streaming methods are refused with a clear error.
+	_, err = bbcli("rpc", "call", "clirpc.CLI/WatchJob", `{"id":"x"}`)
+	if err == nil || !strings.Contains(err.Error(), "streaming not supported") {
+		t.Errorf("rpc call on a streaming method: %v, want streaming not supported", err)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("daemon did not shut down")
+	}
+}
+
+// TestIntegrationLocalNetwork runs two real daemons on the netlocal
+// backend — real TLS, real gRPC, loopback TCP — sharing one registry
+// file, and exchanges a message between them through the real bbcli
+// code path.
+func TestIntegrationLocalNetwork(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "netlocal.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type daemon struct {
+		dataDir string
+		runErr  chan error
+	}
+	startDaemon := func() *daemon {
+		d := &daemon{dataDir: t.TempDir(), runErr: make(chan error, 1)}
+		go func() {
+			d.runErr <- Run(ctx, Config{
+				DataDir:         d.dataDir,
+				CLIAddr:         "127.0.0.1:0",
+				NetworkBackend:  "local",
+				LocalRegistry:   registry,
+				InsecureLocalOK: true,
+			})
+		}()
+		return d
+	}
+	a, b := startDaemon(), startDaemon()
+
+	bbcli := func(d *daemon, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := bbcliapp.Run(append([]string{"--data-dir", d.dataDir}, args...),
+			bbcliapp.WithOutput(&out))
+		return out.String(), err
+	}
+	unlock := func(d *daemon, password string) string {
+		t.Helper()
+		deadline := time.Now().Add(15 * time.Second)
+		for {
+			if _, err := bbcli(d, "healthcheck"); err == nil {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatalf("daemon not healthy before deadline: %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		passwordFile := filepath.Join(t.TempDir(), "password")
+		if err := os.WriteFile(passwordFile, []byte(password+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bbcli(d, "unlock", "--password-file", passwordFile); err != nil {
+			t.Fatalf("unlock: %v", err)
+		}
+		out, err := bbcli(d, "address")
+		if err != nil {
+			t.Fatalf("address: %v", err)
+		}
+		return strings.TrimSpace(out)
+	}
+	addrA := unlock(a, "local-pw-a")
+	addrB := unlock(b, "local-pw-b")
+
+	if _, err := bbcli(a, "peers", "add", addrB, "--alias", "bob"); err != nil {
+		t.Fatalf("peers add on a: %v", err)
+	}
+	if _, err := bbcli(b, "peers", "add", addrA, "--alias", "alice"); err != nil {
+		t.Fatalf("peers add on b: %v", err)
+	}
+
+	out, err := bbcli(a, "msg", "send", "bob", "hello over loopback tcp")
+	if err != nil {
+		t.Fatalf("msg send: %v", err)
+	}
+	if !strings.Contains(out, "sent") {
+		t.Errorf("msg send output = %q", out)
+	}
+	out, err = bbcli(b, "msg", "list")
+	if err != nil {
+		t.Fatalf("msg list: %v", err)
+	}
+	if !strings.Contains(out, "hello over loopback tcp") {
+		t.Errorf("msg list output = %q", out)
+	}
+
+	cancel()
+	for _, d := range []*daemon{a, b} {
+		select {
+		case err := <-d.runErr:
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+		case <-time.After(15 * time.Second):
+			t.Fatal("daemon did not shut down")
+		}
+	}
+}
+
+// TestLocalNetworkRequiresAcknowledgement checks that the insecure
+// local backend is refused without the explicit flag.
+func TestLocalNetworkRequiresAcknowledgement(t *testing.T) {
+	err := Run(context.Background(), Config{
+		DataDir:        t.TempDir(),
+		CLIAddr:        "127.0.0.1:0",
+		NetworkBackend: "local",
+	})
+	if err == nil || !strings.Contains(err.Error(), "--i-know-this-is-insecure") {
+		t.Fatalf("Run: got %v, want the insecurity acknowledgement error", err)
+	}
+}
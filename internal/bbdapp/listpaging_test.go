@@ -0,0 +1,152 @@
+package bbdapp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// pagingService unlocks a fresh service and registers n peers with
+// aliases peer0..peerN, returning the onion addresses sorted ascending.
+func pagingService(t *testing.T, n int) (*cliService, []string) {
+	t.Helper()
+	s := &cliService{dataDir: t.TempDir(), network: netmock.New()}
+	t.Cleanup(s.shutdown)
+	if _, err := s.Unlock(context.Background(), &pb.UnlockRequest{Password: "correct"}); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	node, err := s.getNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	onions := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		onion := keys.OnionAddress(pub)
+		if err := node.AddPeer(onion, fmt.Sprintf("peer%d", i)); err != nil {
+			t.Fatalf("AddPeer: %v", err)
+		}
+		onions = append(onions, onion)
+	}
+	sort.Strings(onions)
+	return s, onions
+}
+
+func TestListPeersPagination(t *testing.T) {
+	s, onions := pagingService(t, 5)
+	ctx := context.Background()
+
+	var got []string
+	token := ""
+	pages := 0
+	for {
+		resp, err := s.ListPeers(ctx, &pb.ListPeersRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("ListPeers page %d: %v", pages, err)
+		}
+		pages++
+		for _, p := range resp.Peers {
+			got = append(got, p.Onion)
+		}
+		token = resp.NextPageToken
+		if token == "" {
+			break
+		}
+	}
+	if pages != 3 {
+		t.Errorf("walked %d pages, want 3", pages)
+	}
+	if len(got) != len(onions) {
+		t.Fatalf("listed %d peers, want %d", len(got), len(onions))
+	}
+	for i, onion := range onions {
+		if got[i] != onion {
+			t.Errorf("peer %d = %s, want %s", i, got[i], onion)
+		}
+	}
+
+	// A token only resumes the sort order it was issued under.
+	first, err := s.ListPeers(ctx, &pb.ListPeersRequest{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ListPeers(ctx, &pb.ListPeersRequest{PageToken: first.NextPageToken, Sort: "name"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("token reused under another sort: %v, want InvalidArgument", err)
+	}
+}
+
+func TestListPeersSortByName(t *testing.T) {
+	s, _ := pagingService(t, 4)
+
+	resp, err := s.ListPeers(context.Background(), &pb.ListPeersRequest{Sort: "name"})
+	if err != nil {
+		t.Fatalf("ListPeers: %v", err)
+	}
+	if len(resp.Peers) != 4 {
+		t.Fatalf("listed %d peers, want 4", len(resp.Peers))
+	}
+	for i, p := range resp.Peers {
+		if want := fmt.Sprintf("peer%d", i); p.Alias != want {
+			t.Errorf("peer %d alias = %s, want %s", i, p.Alias, want)
+		}
+	}
+}
+
+func TestListPeersMutationBetweenPages(t *testing.T) {
+	s, onions := pagingService(t, 6)
+	ctx := context.Background()
+
+	page1, err := s.ListPeers(ctx, &pb.ListPeersRequest{PageSize: 2})
+	if err != nil {
+		t.Fatalf("ListPeers page 1: %v", err)
+	}
+	if page1.NextPageToken == "" {
+		t.Fatal("page 1 carries no next token")
+	}
+
+	// Remove the peer the next page would have started with. The token
+	// holds a position, not an entry, so the walk continues with the
+	// survivors after that position.
+	node, err := s.getNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.RemovePeer(onions[2]); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+
+	var rest []string
+	token := page1.NextPageToken
+	for token != "" {
+		resp, err := s.ListPeers(ctx, &pb.ListPeersRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("ListPeers after mutation: %v", err)
+		}
+		for _, p := range resp.Peers {
+			rest = append(rest, p.Onion)
+		}
+		token = resp.NextPageToken
+	}
+	want := []string{onions[3], onions[4], onions[5]}
+	if len(rest) != len(want) {
+		t.Fatalf("remaining pages listed %v, want %v", rest, want)
+	}
+	for i := range want {
+		if rest[i] != want[i] {
+			t.Errorf("remaining peer %d = %s, want %s", i, rest[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package bbdapp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// schemaVersionFile records the data dir layout version, so a newer
+// binary can upgrade an old dir and an old binary can refuse a newer
+// one instead of misreading it.
+const schemaVersionFile = "version"
+
+// migrationJournal logs every migration run, one entry before and one
+// after, so an interrupted upgrade is diagnosable.
+const migrationJournal = "migrations.log"
+
+// currentSchemaVersion is the layout version this binary writes.
+const currentSchemaVersion = 3
+
+// legacyLockFile and lockFile are the old and current daemon lock file
+// locations; migration 2 moves the former to the latter.
+const (
+	legacyLockFile = "lock"
+	lockFile       = "bbd.lock"
+)
+
+// A migration upgrades the data dir from version-1 to version. Each
+// must be idempotent: a crash between the journal entry and the version
+// file bump reruns it.
+type migration struct {
+	version int
+	name    string
+	run     func(dataDir string) error
+}
+
+var migrations = []migration{
+	{1, "fingerprint-trailing-newline", migrateFingerprintNewline},
+	{2, "move-lock-file", migrateLockFile},
+	{3, "fingerprint-salted", migrateFingerprintSalted},
+}
+
+// migrateDataDir brings the data dir layout up to
+// currentSchemaVersion, running each pending migration in order and
+// bumping the version file after each so progress survives a crash. It
+// refuses a dir whose version is newer than this binary writes.
+func migrateDataDir(dataDir string) error {
+	onDisk, err := readSchemaVersion(dataDir)
+	if err != nil {
+		return err
+	}
+	if onDisk > currentSchemaVersion {
+		return fmt.Errorf("data dir %s has schema version %d, newer than the %d this binary supports; upgrade bbd",
+			dataDir, onDisk, currentSchemaVersion)
+	}
+	for _, m := range migrations {
+		if m.version <= onDisk {
+			continue
+		}
+		if err := journal(dataDir, fmt.Sprintf("start %d %s", m.version, m.name)); err != nil {
+			return err
+		}
+		if err := m.run(dataDir); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if err := writeSchemaVersion(dataDir, m.version); err != nil {
+			return err
+		}
+		if err := journal(dataDir, fmt.Sprintf("done %d %s", m.version, m.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSchemaVersion(dataDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, schemaVersionFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Dirs from before versioning, and brand-new dirs, start at
+		// zero; every migration is a no-op on an empty dir.
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parse schema version %q: %v", strings.TrimSpace(string(data)), err)
+	}
+	return v, nil
+}
+
+func writeSchemaVersion(dataDir string, v int) error {
+	path := filepath.Join(dataDir, schemaVersionFile)
+	if err := atomicfile.WriteFile(path, []byte(strconv.Itoa(v)+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write schema version: %w", err)
+	}
+	return nil
+}
+
+func journal(dataDir, entry string) error {
+	f, err := os.OpenFile(filepath.Join(dataDir, migrationJournal),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open migration journal: %w", err)
+	}
+	defer f.Close()
+	line := fmt.Sprintf("%s %s\n", time.Now().UTC().Format(time.RFC3339), entry)
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("write migration journal: %w", err)
+	}
+	return nil
+}
+
+// migrateFingerprintNewline rewrites fingerprint.txt in the current
+// format: early builds wrote the bare fingerprint without a trailing
+// newline.
+func migrateFingerprintNewline(dataDir string) error {
+	path := filepath.Join(dataDir, fingerprintFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // never unlocked; nothing to rewrite
+	} else if err != nil {
+		return err
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		return nil
+	}
+	return atomicfile.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// migrateFingerprintSalted rewrites a legacy fingerprint.txt — the bare
+// fingerprint hex, a stable identifier linking data dirs of the same
+// password — in the salted format. The legacy file holds everything the
+// rewrite needs, so no password is required.
+func migrateFingerprintSalted(dataDir string) error {
+	path := filepath.Join(dataDir, fingerprintFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // never unlocked; nothing to rewrite
+	} else if err != nil {
+		return err
+	}
+	fp, err := keys.FingerprintFromHex(strings.TrimSpace(string(data)))
+	if err != nil {
+		// Already salted, or corrupted; the latter is Unlock's to
+		// report, not a reason to fail every daemon start.
+		return nil
+	}
+	return fp.WriteFile(path)
+}
+
+// migrateLockFile moves the daemon lock file from the old bare "lock"
+// name, which collided with user expectations about the locked state,
+// to bbd.lock.
+func migrateLockFile(dataDir string) error {
+	old := filepath.Join(dataDir, legacyLockFile)
+	if _, err := os.Stat(old); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return os.Rename(old, filepath.Join(dataDir, lockFile))
+}
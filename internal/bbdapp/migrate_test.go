@@ -0,0 +1,160 @@
+package bbdapp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+func TestMigrateFromOldLayout(t *testing.T) {
+	dir := t.TempDir()
+	// A version-0 layout: no version file, a fingerprint without the
+	// trailing newline, and the lock file under its old name.
+	if err := os.WriteFile(filepath.Join(dir, fingerprintFile), []byte("abcd1234"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, legacyLockFile), []byte("1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateDataDir(dir); err != nil {
+		t.Fatalf("migrateDataDir: %v", err)
+	}
+
+	v, err := readSchemaVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != currentSchemaVersion {
+		t.Errorf("schema version = %d, want %d", v, currentSchemaVersion)
+	}
+	fp, err := os.ReadFile(filepath.Join(dir, fingerprintFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fp) != "abcd1234\n" {
+		t.Errorf("fingerprint file = %q, want %q", fp, "abcd1234\n")
+	}
+	if _, err := os.Stat(filepath.Join(dir, legacyLockFile)); !os.IsNotExist(err) {
+		t.Errorf("legacy lock file still present (stat: %v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, lockFile)); err != nil {
+		t.Errorf("moved lock file: %v", err)
+	}
+
+	journal, err := os.ReadFile(filepath.Join(dir, migrationJournal))
+	if err != nil {
+		t.Fatalf("read migration journal: %v", err)
+	}
+	lines := strings.Count(string(journal), "\n")
+	if want := 2 * len(migrations); lines != want {
+		t.Errorf("journal has %d lines, want %d:\n%s", lines, want, journal)
+	}
+
+	// A second run must be a no-op: same version, no new journal
+	// entries, files untouched.
+	if err := migrateDataDir(dir); err != nil {
+		t.Fatalf("second migrateDataDir: %v", err)
+	}
+	journal2, err := os.ReadFile(filepath.Join(dir, migrationJournal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(journal2) != string(journal) {
+		t.Errorf("second run appended journal entries:\n%s", journal2)
+	}
+	fp2, err := os.ReadFile(filepath.Join(dir, fingerprintFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fp2) != string(fp) {
+		t.Errorf("second run changed fingerprint file to %q", fp2)
+	}
+}
+
+func TestMigrateEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := migrateDataDir(dir); err != nil {
+		t.Fatalf("migrateDataDir on empty dir: %v", err)
+	}
+	v, err := readSchemaVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != currentSchemaVersion {
+		t.Errorf("schema version = %d, want %d", v, currentSchemaVersion)
+	}
+}
+
+func TestMigrateRefusesNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeSchemaVersion(dir, currentSchemaVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	err := migrateDataDir(dir)
+	if err == nil {
+		t.Fatal("migrateDataDir accepted a newer schema version")
+	}
+	if !strings.Contains(err.Error(), "newer than") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMigrateFingerprintSalted(t *testing.T) {
+	dir := t.TempDir()
+	fp := keys.ComputeFingerprint([]byte("test master secret"))
+	if err := os.WriteFile(filepath.Join(dir, fingerprintFile), []byte(fp.Hex()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateFingerprintSalted(dir); err != nil {
+		t.Fatalf("migrateFingerprintSalted: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, fingerprintFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), fp.Hex()) {
+		t.Errorf("fingerprint file %q still contains the bare fingerprint", data)
+	}
+	if outcome, err := fp.VerifyAgainstFile(filepath.Join(dir, fingerprintFile)); err != nil || outcome != keys.FingerprintMatch {
+		t.Errorf("verify after migration = %v, %v; want match", outcome, err)
+	}
+
+	// Rerunning on the salted file is a no-op.
+	if err := migrateFingerprintSalted(dir); err != nil {
+		t.Fatalf("second migrateFingerprintSalted: %v", err)
+	}
+	data2, err := os.ReadFile(filepath.Join(dir, fingerprintFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data2) != string(data) {
+		t.Errorf("second run rewrote the fingerprint file to %q", data2)
+	}
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, fingerprintFile), []byte("abcd1234\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if err := m.run(dir); err != nil {
+			t.Fatalf("migration %d (%s) first run: %v", m.version, m.name, err)
+		}
+		if err := m.run(dir); err != nil {
+			t.Fatalf("migration %d (%s) second run: %v", m.version, m.name, err)
+		}
+	}
+	fp, err := os.ReadFile(filepath.Join(dir, fingerprintFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fp) != "abcd1234\n" {
+		t.Errorf("fingerprint file = %q after reruns, want %q", fp, "abcd1234\n")
+	}
+}
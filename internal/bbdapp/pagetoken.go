@@ -0,0 +1,78 @@
+package bbdapp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// List RPCs page through large collections with opaque tokens. A token
+// records the sort order it was issued under plus the sort key and
+// unique ID of the last item on the page, so the next page resumes
+// after that position rather than at a fixed index. Pagination is
+// best-effort consistent: entries added or removed between pages never
+// crash a listing, though an entry that moves across the page boundary
+// can be missed or repeated.
+
+// defaultListPageSize bounds one list response page when the request
+// does not pick a size; maxListPageSize caps what it may pick.
+const (
+	defaultListPageSize = 100
+	maxListPageSize     = 1000
+)
+
+// pageCursor is the decoded form of a page token.
+type pageCursor struct {
+	// Sort is the order the token was issued under; resuming under a
+	// different order would skip arbitrary entries, so it is rejected.
+	Sort string `json:"sort"`
+	// Key and ID locate the last item of the previous page: its sort
+	// key and its unique ID as the tiebreaker.
+	Key string `json:"key"`
+	ID  string `json:"id"`
+}
+
+func encodePageToken(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(token, sortOrder string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("malformed page token")
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return pageCursor{}, fmt.Errorf("malformed page token")
+	}
+	if c.Sort != sortOrder {
+		return pageCursor{}, fmt.Errorf("page token was issued for sort %q, not %q", c.Sort, sortOrder)
+	}
+	return c, nil
+}
+
+// pageSize clamps a requested page size to the default and the cap.
+func pageSize(requested int32) int {
+	switch {
+	case requested <= 0:
+		return defaultListPageSize
+	case requested > maxListPageSize:
+		return maxListPageSize
+	}
+	return int(requested)
+}
+
+// descendingKey renders v so ascending string order over keys is
+// descending numeric order over values; date and size sorts use it to
+// put newest and largest first.
+func descendingKey(v int64) string {
+	return fmt.Sprintf("%020d", uint64(math.MaxInt64-v))
+}
+
+// afterCursor reports whether an item at (key, id) sorts after the
+// cursor position in ascending (key, id) order.
+func afterCursor(c pageCursor, key, id string) bool {
+	return key > c.Key || (key == c.Key && id > c.ID)
+}
@@ -0,0 +1,64 @@
+package bbdapp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	in := pageCursor{Sort: "date", Key: descendingKey(1700000000), ID: "abc123"}
+	out, err := decodePageToken(encodePageToken(in), "date")
+	if err != nil {
+		t.Fatalf("decodePageToken: %v", err)
+	}
+	if out != in {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestPageTokenRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"not base64 !!!", "aGVsbG8", ""} {
+		if _, err := decodePageToken(token, "date"); err == nil {
+			t.Errorf("decodePageToken(%q) succeeded, want error", token)
+		}
+	}
+}
+
+func TestPageTokenRejectsWrongSort(t *testing.T) {
+	token := encodePageToken(pageCursor{Sort: "name", Key: "x", ID: "y"})
+	_, err := decodePageToken(token, "size")
+	if err == nil || !strings.Contains(err.Error(), "sort") {
+		t.Errorf("decodePageToken with wrong sort: %v, want sort mismatch error", err)
+	}
+}
+
+func TestPageSizeClamp(t *testing.T) {
+	cases := []struct {
+		requested int32
+		want      int
+	}{
+		{0, defaultListPageSize},
+		{-5, defaultListPageSize},
+		{7, 7},
+		{maxListPageSize + 1, maxListPageSize},
+	}
+	for _, tc := range cases {
+		if got := pageSize(tc.requested); got != tc.want {
+			t.Errorf("pageSize(%d) = %d, want %d", tc.requested, got, tc.want)
+		}
+	}
+}
+
+func TestDescendingKeyOrder(t *testing.T) {
+	// Ascending string order over the keys must be descending numeric
+	// order over the values, so "newest first" survives the cursor's
+	// string comparison.
+	values := []int64{0, 1, 1000, 1700000000, 1 << 60}
+	for i := 1; i < len(values); i++ {
+		lo, hi := descendingKey(values[i-1]), descendingKey(values[i])
+		if !(hi < lo) {
+			t.Errorf("descendingKey(%d) = %q not below descendingKey(%d) = %q",
+				values[i], hi, values[i-1], lo)
+		}
+	}
+}
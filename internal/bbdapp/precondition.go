@@ -0,0 +1,90 @@
+package bbdapp
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// methodState is the lock state a clirpc method requires.
+type methodState int
+
+const (
+	// AnyState methods work locked, unlocked, or mid-unlock.
+	AnyState methodState = iota
+	// RequiresLocked methods only make sense before an unlock.
+	RequiresLocked
+	// RequiresUnlocked methods need a fully initialized node. A node
+	// that is still unlocking does not qualify.
+	RequiresUnlocked
+)
+
+// methodStates maps full clirpc method names to the state they require.
+// Methods not listed default to RequiresUnlocked, so forgetting to
+// register a new method fails safe instead of touching a nil or
+// half-initialized node.
+var methodStates = map[string]methodState{
+	// Unlock manages the locked/unlocking/unlocked transitions itself:
+	// it is idempotent when already unlocked and waits out a concurrent
+	// unlock.
+	"/clirpc.CLI/Unlock":           AnyState,
+	"/clirpc.CLI/GetStatus":        AnyState,
+	"/clirpc.CLI/LocalHealthCheck": AnyState,
+	"/clirpc.CLI/RunDiagnostics":   AnyState,
+	"/clirpc.CLI/ReadAuditLog":     AnyState,
+	// Minting readonly credentials only touches the CLI certificate
+	// authority, never the node.
+	"/clirpc.CLI/CreateReadonlyCreds": AnyState,
+	// Server reflection (registered only with --debug-reflection) just
+	// describes the API; it touches no node state.
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      AnyState,
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": AnyState,
+}
+
+// checkState enforces the declared state requirement for fullMethod.
+func (s *cliService) checkState(fullMethod string) error {
+	required, ok := methodStates[fullMethod]
+	if !ok {
+		required = RequiresUnlocked
+	}
+	if required == AnyState {
+		return nil
+	}
+	s.mu.RLock()
+	unlocked := s.node != nil
+	unlocking := s.unlocking != nil
+	s.mu.RUnlock()
+	switch required {
+	case RequiresLocked:
+		if unlocking {
+			return status.Error(codes.FailedPrecondition, "unlock already in progress")
+		}
+		if unlocked {
+			return status.Error(codes.FailedPrecondition, "already unlocked")
+		}
+	case RequiresUnlocked:
+		if unlocking {
+			return status.Error(codes.Unavailable, "unlock in progress; retry shortly")
+		}
+		if !unlocked {
+			return errLocked
+		}
+	}
+	return nil
+}
+
+func (s *cliService) stateUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.checkState(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *cliService) stateStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.checkState(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,50 @@
+package bbdapp
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/bbnode"
+)
+
+func TestCheckState(t *testing.T) {
+	cases := []struct {
+		name      string
+		method    string
+		unlocked  bool
+		unlocking bool
+		wantCode  codes.Code
+	}{
+		{"status while locked", "/clirpc.CLI/GetStatus", false, false, codes.OK},
+		{"status while unlocking", "/clirpc.CLI/GetStatus", false, true, codes.OK},
+		{"status while unlocked", "/clirpc.CLI/GetStatus", true, false, codes.OK},
+		// Unlock handles all three states itself: idempotent when
+		// unlocked, waiting when an unlock is in flight.
+		{"unlock while locked", "/clirpc.CLI/Unlock", false, false, codes.OK},
+		{"unlock while unlocked", "/clirpc.CLI/Unlock", true, false, codes.OK},
+		{"unlock while unlocking", "/clirpc.CLI/Unlock", false, true, codes.OK},
+		{"peers while locked", "/clirpc.CLI/ListPeers", false, false, codes.FailedPrecondition},
+		{"peers while unlocking", "/clirpc.CLI/ListPeers", false, true, codes.Unavailable},
+		{"peers while unlocked", "/clirpc.CLI/ListPeers", true, false, codes.OK},
+		// Unknown methods default to RequiresUnlocked.
+		{"unknown while locked", "/clirpc.CLI/FutureMethod", false, false, codes.FailedPrecondition},
+		{"unknown while unlocked", "/clirpc.CLI/FutureMethod", true, false, codes.OK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &cliService{}
+			if tc.unlocking {
+				s.unlocking = make(chan struct{})
+			}
+			if tc.unlocked {
+				s.node = &bbnode.Node{}
+			}
+			err := s.checkState(tc.method)
+			if got := status.Code(err); got != tc.wantCode {
+				t.Errorf("checkState(%s) = %v, want code %v", tc.method, err, tc.wantCode)
+			}
+		})
+	}
+}
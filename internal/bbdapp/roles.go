@@ -0,0 +1,78 @@
+package bbdapp
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/clitls"
+)
+
+// readonlyMethods are the clirpc methods a readonly credential may
+// call: pure observation, nothing that changes state, touches key
+// material, or mints further credentials. Everything else needs the
+// admin credential.
+var readonlyMethods = map[string]bool{
+	"/clirpc.CLI/GetStatus":        true,
+	"/clirpc.CLI/LocalHealthCheck": true,
+	"/clirpc.CLI/GetReport":        true,
+	"/clirpc.CLI/ReadAuditLog":     true,
+	"/clirpc.CLI/ListPeers":        true,
+	"/clirpc.CLI/ListBlockedPeers": true,
+	"/clirpc.CLI/GetPeer":          true,
+	"/clirpc.CLI/ListInvites":      true,
+	"/clirpc.CLI/ListPeerGroups":   true,
+	"/clirpc.CLI/ListMessages":     true,
+	"/clirpc.CLI/ListAgreements":   true,
+	"/clirpc.CLI/ListBackups":      true,
+	"/clirpc.CLI/BackupStatus":     true,
+	"/clirpc.CLI/ListJobs":         true,
+	"/clirpc.CLI/ListHosting":      true,
+	"/clirpc.CLI/ListBalances":     true,
+	"/clirpc.CLI/WatchJob":         true,
+	"/clirpc.CLI/RunDiagnostics":   true,
+}
+
+// callerRole reads the role from the caller's client certificate. A
+// connection without one cannot exist past the TLS handshake, but the
+// fallback still fails closed.
+func callerRole(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return clitls.RoleReadonly
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return clitls.RoleReadonly
+	}
+	return clitls.RoleFromCert(tlsInfo.State.PeerCertificates[0])
+}
+
+// checkRole rejects privileged methods called with a readonly
+// credential.
+func (s *cliService) checkRole(ctx context.Context, fullMethod string) error {
+	role := callerRole(ctx)
+	if role == clitls.RoleAdmin || readonlyMethods[fullMethod] {
+		return nil
+	}
+	s.auditEvent("cli_denied", map[string]string{"method": fullMethod, "role": role})
+	return status.Errorf(codes.PermissionDenied, "%s requires the admin credential", fullMethod)
+}
+
+func (s *cliService) roleUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.checkRole(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *cliService) roleStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.checkRole(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
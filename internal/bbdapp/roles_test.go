@@ -0,0 +1,147 @@
+package bbdapp
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/clitls"
+)
+
+// dialCLI connects to the daemon with the credentials in keysDir.
+func dialCLI(t *testing.T, keysDir, addr string) pb.CLIClient {
+	t.Helper()
+	tlsCfg, err := clitls.ReadKeys(keysDir)
+	if err != nil {
+		t.Fatalf("ReadKeys: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		t.Fatalf("dial daemon: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return pb.NewCLIClient(cc)
+}
+
+func TestCLIRoles(t *testing.T) {
+	dataDir := startDaemon(t, "127.0.0.1:0")
+	keysDir := filepath.Join(dataDir, "cli-keys")
+	addr, err := clitls.ReadEndpoint(keysDir)
+	if err != nil {
+		t.Fatalf("ReadEndpoint: %v", err)
+	}
+	admin := dialCLI(t, keysDir, addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	minted, err := admin.CreateReadonlyCreds(ctx, &pb.CreateReadonlyCredsRequest{})
+	if err != nil {
+		t.Fatalf("CreateReadonlyCreds: %v", err)
+	}
+	roDir := t.TempDir()
+	if err := clitls.WriteMintedKeys(roDir, keysDir, minted.ClientCert, minted.ClientKey); err != nil {
+		t.Fatalf("WriteMintedKeys: %v", err)
+	}
+	ro := dialCLI(t, roDir, addr)
+
+	// Observation methods work with the readonly credential even while
+	// the daemon is locked.
+	if _, err := ro.GetStatus(ctx, &pb.GetStatusRequest{}); err != nil {
+		t.Errorf("readonly GetStatus: %v", err)
+	}
+	if _, err := ro.LocalHealthCheck(ctx, &pb.LocalHealthCheckRequest{}); err != nil {
+		t.Errorf("readonly LocalHealthCheck: %v", err)
+	}
+	if _, err := ro.ReadAuditLog(ctx, &pb.ReadAuditLogRequest{}); err != nil {
+		t.Errorf("readonly ReadAuditLog: %v", err)
+	}
+	// These pass the role check and then fail on the locked daemon —
+	// never with PermissionDenied.
+	if _, err := ro.ListPeers(ctx, &pb.ListPeersRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("readonly ListPeers on locked daemon: %v, want FailedPrecondition", err)
+	}
+	if _, err := ro.GetReport(ctx, &pb.GetReportRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("readonly GetReport on locked daemon: %v, want FailedPrecondition", err)
+	}
+
+	// Privileged methods are refused outright, before any state checks.
+	denied := []struct {
+		name string
+		call func() error
+	}{
+		{"Unlock", func() error {
+			_, err := ro.Unlock(ctx, &pb.UnlockRequest{Password: "pw"})
+			return err
+		}},
+		{"Lock", func() error {
+			_, err := ro.Lock(ctx, &pb.LockRequest{})
+			return err
+		}},
+		{"SetConfig", func() error {
+			_, err := ro.SetConfig(ctx, &pb.SetConfigRequest{})
+			return err
+		}},
+		{"WipePeer", func() error {
+			_, err := ro.WipePeer(ctx, &pb.WipePeerRequest{Peer: "x"})
+			return err
+		}},
+		{"MigrateIdentity", func() error {
+			_, err := ro.MigrateIdentity(ctx, &pb.MigrateIdentityRequest{})
+			return err
+		}},
+		{"CreateReadonlyCreds", func() error {
+			_, err := ro.CreateReadonlyCreds(ctx, &pb.CreateReadonlyCredsRequest{})
+			return err
+		}},
+	}
+	for _, d := range denied {
+		if err := d.call(); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("readonly %s: %v, want PermissionDenied", d.name, err)
+		}
+	}
+
+	// The admin credential passes the role check everywhere; what fails
+	// fails on daemon state, never on the role.
+	if _, err := admin.GetStatus(ctx, &pb.GetStatusRequest{}); err != nil {
+		t.Errorf("admin GetStatus: %v", err)
+	}
+	adminCalls := []struct {
+		name string
+		call func() error
+	}{
+		{"SetConfig", func() error {
+			_, err := admin.SetConfig(ctx, &pb.SetConfigRequest{})
+			return err
+		}},
+		{"WipePeer", func() error {
+			_, err := admin.WipePeer(ctx, &pb.WipePeerRequest{Peer: "x"})
+			return err
+		}},
+		{"MigrateIdentity", func() error {
+			_, err := admin.MigrateIdentity(ctx, &pb.MigrateIdentityRequest{})
+			return err
+		}},
+		{"Lock", func() error {
+			_, err := admin.Lock(ctx, &pb.LockRequest{})
+			return err
+		}},
+	}
+	for _, c := range adminCalls {
+		if err := c.call(); status.Code(err) == codes.PermissionDenied {
+			t.Errorf("admin %s hit the role check: %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package bbdapp
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor systemd passes under
+// socket activation, per sd_listen_fds(3).
+const listenFDsStart = 3
+
+// adoptListenerFD turns an inherited descriptor into a listener. A seam
+// so tests can hand in a pre-bound listener without fiddling with the
+// process's descriptor table. net.FileListener never unlinks an
+// inherited unix socket on Close, which is what systemd expects.
+var adoptListenerFD = func(fd int) (net.Listener, error) {
+	syscall.CloseOnExec(fd)
+	f := os.NewFile(uintptr(fd), "clirpc-activation-socket")
+	defer f.Close() // FileListener dups the descriptor
+	return net.FileListener(f)
+}
+
+// activationListener adopts the clirpc listener handed over by systemd
+// socket activation. It returns (nil, nil) when the environment carries
+// no activation descriptors, or carries them for a different process.
+// The systemd unit already chose where to bind, so the CLIAddr loopback
+// validation does not apply to an adopted socket.
+func activationListener() (net.Listener, error) {
+	fds := os.Getenv("LISTEN_FDS")
+	if fds == "" {
+		return nil, nil
+	}
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	// Consume the variables either way: child processes must not
+	// re-adopt the descriptor.
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad LISTEN_FDS %q", fds)
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("socket activation passed %d sockets, want exactly 1 (the clirpc listener)", n)
+	}
+	ln, err := adoptListenerFD(listenFDsStart)
+	if err != nil {
+		return nil, fmt.Errorf("adopt activation socket: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,100 @@
+package bbdapp
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/clitls"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// stubActivation simulates systemd handing over one pre-bound listener
+// on fd 3.
+func stubActivation(t *testing.T, ln net.Listener) {
+	t.Helper()
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	orig := adoptListenerFD
+	adoptListenerFD = func(fd int) (net.Listener, error) {
+		if fd != listenFDsStart {
+			t.Errorf("adoptListenerFD(%d), want %d", fd, listenFDsStart)
+		}
+		return ln, nil
+	}
+	t.Cleanup(func() { adoptListenerFD = orig })
+}
+
+func TestListenAdoptsActivationSocket(t *testing.T) {
+	prebound, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubActivation(t, prebound)
+
+	dataDir := t.TempDir()
+	d := NewDaemon(Config{DataDir: dataDir, Network: netmock.New()})
+	d.listen = func(addr, keysDir string, allowRemote bool) (net.Listener, error) {
+		t.Error("Listen bound a fresh socket despite socket activation")
+		return nil, nil
+	}
+	defer d.Shutdown()
+	if err := d.PrepareDirs(); err != nil {
+		t.Fatalf("PrepareDirs: %v", err)
+	}
+	if err := d.Listen(); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if d.ln != prebound {
+		t.Fatalf("Listen adopted %v, want the pre-bound listener", d.ln)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("LISTEN_FDS survived adoption; children would re-adopt the fd")
+	}
+	if err := d.SetupCLIKeys(); err != nil {
+		t.Fatalf("SetupCLIKeys: %v", err)
+	}
+	// The published endpoint is the adopted socket's address.
+	addr, err := clitls.ReadEndpoint(filepath.Join(dataDir, "cli-keys"))
+	if err != nil {
+		t.Fatalf("ReadEndpoint: %v", err)
+	}
+	if addr != prebound.Addr().String() {
+		t.Errorf("endpoint = %s, want %s", addr, prebound.Addr().String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Serve(ctx) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Serve: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+}
+
+func TestActivationListenerIgnoresOtherPID(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", "1")
+	ln, err := activationListener()
+	if ln != nil || err != nil {
+		t.Fatalf("activationListener = %v, %v, want nil, nil", ln, err)
+	}
+}
+
+func TestActivationListenerRejectsExtraFDs(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	if _, err := activationListener(); err == nil || !strings.Contains(err.Error(), "exactly 1") {
+		t.Fatalf("activationListener: %v, want exactly-1 error", err)
+	}
+}
@@ -0,0 +1,42 @@
+package bbdapp
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestUnlockIdempotent(t *testing.T) {
+	s := &cliService{dataDir: t.TempDir(), network: netmock.New()}
+	t.Cleanup(s.shutdown)
+	ctx := context.Background()
+
+	first, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"})
+	if err != nil {
+		t.Fatalf("first Unlock: %v", err)
+	}
+	if first.WasAlreadyUnlocked {
+		t.Error("first Unlock reports was_already_unlocked")
+	}
+
+	second, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"})
+	if err != nil {
+		t.Fatalf("repeated Unlock with the same password: %v", err)
+	}
+	if !second.WasAlreadyUnlocked {
+		t.Error("repeated Unlock does not report was_already_unlocked")
+	}
+	if second.Onion != first.Onion {
+		t.Errorf("repeated Unlock onion = %q, want %q", second.Onion, first.Onion)
+	}
+
+	_, err = s.Unlock(ctx, &pb.UnlockRequest{Password: "wrong"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Unlock with the wrong password: %v, want PermissionDenied", err)
+	}
+}
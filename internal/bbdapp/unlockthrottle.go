@@ -0,0 +1,148 @@
+package bbdapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+)
+
+// Argon2 alone only slows an Unlock brute force down; it does not stop
+// one. The throttle adds exponential backoff after consecutive
+// failures and a hard cool-down once too many pile up, with the
+// counter persisted in the data dir so restarting the daemon does not
+// reset it.
+const (
+	// unlockAttemptsFile persists the failure counter across restarts.
+	unlockAttemptsFile = "unlock-attempts.json"
+	// unlockBackoffBase is the delay after the first failure; it
+	// doubles per failure up to unlockBackoffCap.
+	unlockBackoffBase = time.Second
+	unlockBackoffCap  = time.Minute
+	// defaultUnlockMaxFailures is how many failures trigger the
+	// cool-down when the daemon does not configure its own limit.
+	defaultUnlockMaxFailures = 10
+	// unlockCooldown is the wait imposed once the failure limit is
+	// reached.
+	unlockCooldown = 15 * time.Minute
+)
+
+// unlockAttempts is the persisted throttle state.
+type unlockAttempts struct {
+	Failures        int   `json:"failures"`
+	LastFailureUnix int64 `json:"last_failure_unix"`
+}
+
+// unlockThrottle tracks consecutive failed unlock attempts. It is safe
+// for concurrent use.
+type unlockThrottle struct {
+	path string
+	now  func() time.Time
+
+	mu          sync.Mutex
+	maxFailures int
+	state       unlockAttempts
+}
+
+// newUnlockThrottle loads the persisted counter from dataDir. A nil now
+// means the wall clock; maxFailures <= 0 means the default limit.
+func newUnlockThrottle(dataDir string, now func() time.Time, maxFailures int) *unlockThrottle {
+	if now == nil {
+		now = time.Now
+	}
+	if maxFailures <= 0 {
+		maxFailures = defaultUnlockMaxFailures
+	}
+	t := &unlockThrottle{
+		path:        filepath.Join(dataDir, unlockAttemptsFile),
+		now:         now,
+		maxFailures: maxFailures,
+	}
+	if data, err := os.ReadFile(t.path); err == nil {
+		// A corrupt file counts as a clean slate; losing the counter
+		// is recoverable, failing every unlock forever is not.
+		json.Unmarshal(data, &t.state)
+	}
+	return t
+}
+
+// backoffLocked returns how long after the last failure the next
+// attempt is allowed. Callers hold t.mu.
+func (t *unlockThrottle) backoffLocked() time.Duration {
+	if t.state.Failures >= t.maxFailures {
+		return unlockCooldown
+	}
+	d := unlockBackoffBase
+	for i := 1; i < t.state.Failures && d < unlockBackoffCap; i++ {
+		d *= 2
+	}
+	if d > unlockBackoffCap {
+		d = unlockBackoffCap
+	}
+	return d
+}
+
+// check returns an error while attempts are still embargoed by earlier
+// failures, telling the caller how long to wait.
+func (t *unlockThrottle) check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state.Failures == 0 {
+		return nil
+	}
+	allowedAt := time.Unix(t.state.LastFailureUnix, 0).Add(t.backoffLocked())
+	wait := allowedAt.Sub(t.now())
+	if wait <= 0 {
+		return nil
+	}
+	if t.state.Failures >= t.maxFailures {
+		return status.Errorf(codes.ResourceExhausted,
+			"too many failed unlock attempts (%d); cooling down, try again in %s",
+			t.state.Failures, wait.Round(time.Second))
+	}
+	return status.Errorf(codes.ResourceExhausted,
+		"unlock throttled after %d failed attempts; try again in %s",
+		t.state.Failures, wait.Round(time.Second))
+}
+
+// recordFailure counts one failed attempt and returns the new total.
+func (t *unlockThrottle) recordFailure() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state.Failures++
+	t.state.LastFailureUnix = t.now().Unix()
+	t.persistLocked()
+	return t.state.Failures
+}
+
+// reset clears the counter after a successful unlock.
+func (t *unlockThrottle) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state.Failures == 0 {
+		return
+	}
+	t.state = unlockAttempts{}
+	if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "unlock throttle: %v\n", err)
+	}
+}
+
+// persistLocked writes the counter out; a write failure must not fail
+// the unlock handling itself. Callers hold t.mu.
+func (t *unlockThrottle) persistLocked() {
+	data, err := json.Marshal(t.state)
+	if err == nil {
+		err = atomicfile.WriteFile(t.path, data, 0o600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unlock throttle: persist attempts: %v\n", err)
+	}
+}
@@ -0,0 +1,156 @@
+package bbdapp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/clirpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestUnlockThrottleBackoffSchedule(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clk := func() time.Time { return now }
+	th := newUnlockThrottle(t.TempDir(), clk, 10)
+
+	if err := th.check(); err != nil {
+		t.Fatalf("check on a clean slate: %v", err)
+	}
+
+	// The delay doubles per failure: 1s, 2s, 4s, ...
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		th.recordFailure()
+		if err := th.check(); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("check right after failure %d: %v, want ResourceExhausted", i+1, err)
+		}
+		now = now.Add(want - time.Millisecond)
+		if err := th.check(); err == nil {
+			t.Fatalf("check %v after failure %d passed, want throttled until %v", want-time.Millisecond, i+1, want)
+		}
+		now = now.Add(time.Millisecond)
+		if err := th.check(); err != nil {
+			t.Fatalf("check %v after failure %d: %v", want, i+1, err)
+		}
+	}
+
+	// The delay caps at a minute well before the failure limit.
+	for th.state.Failures < 9 {
+		th.recordFailure()
+	}
+	now = now.Add(unlockBackoffCap)
+	if err := th.check(); err != nil {
+		t.Fatalf("check at the backoff cap: %v", err)
+	}
+
+	// The tenth failure reaches the limit: a cool-down replaces the
+	// backoff and the error says so.
+	th.recordFailure()
+	now = now.Add(unlockBackoffCap)
+	err := th.check()
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(status.Convert(err).Message(), "cooling down") {
+		t.Fatalf("check after the failure limit: %v, want the cool-down error", err)
+	}
+	now = now.Add(unlockCooldown)
+	if err := th.check(); err != nil {
+		t.Fatalf("check after the cool-down: %v", err)
+	}
+
+	th.reset()
+	th.recordFailure()
+	if err := th.check(); err == nil {
+		t.Fatal("check right after a post-reset failure passed")
+	}
+	now = now.Add(time.Second)
+	if err := th.check(); err != nil {
+		t.Fatalf("reset did not restart the schedule: %v", err)
+	}
+}
+
+func TestUnlockThrottlePersistsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+	clk := func() time.Time { return now }
+
+	th := newUnlockThrottle(dir, clk, 10)
+	th.recordFailure()
+	th.recordFailure()
+
+	// A fresh throttle over the same data dir — a restarted daemon —
+	// still knows about the failures.
+	th2 := newUnlockThrottle(dir, clk, 10)
+	now = now.Add(time.Second)
+	err := th2.check()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("check after restart: %v, want ResourceExhausted", err)
+	}
+
+	th2.reset()
+	th3 := newUnlockThrottle(dir, clk, 10)
+	if err := th3.check(); err != nil {
+		t.Fatalf("check after reset and restart: %v", err)
+	}
+}
+
+func TestUnlockThrottledRPC(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := &cliService{
+		dataDir:           t.TempDir(),
+		network:           netmock.New(),
+		now:               func() time.Time { return now },
+		maxUnlockFailures: 3,
+	}
+	t.Cleanup(s.shutdown)
+	ctx := context.Background()
+
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"}); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	// Failures back off; while embargoed even the right password is
+	// refused, since confirming it would refine a guess.
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "wrong"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("wrong password: %v, want PermissionDenied", err)
+	}
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("throttled attempt: %v, want ResourceExhausted", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "wrong"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("second wrong password: %v, want PermissionDenied", err)
+	}
+
+	// The limit of three is reached on the next failure; then only the
+	// cool-down helps.
+	now = now.Add(2 * time.Second)
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "wrong"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("third wrong password: %v, want PermissionDenied", err)
+	}
+	now = now.Add(5 * time.Minute)
+	_, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"})
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(status.Convert(err).Message(), "cooling down") {
+		t.Fatalf("attempt during the cool-down: %v, want the cool-down error", err)
+	}
+	now = now.Add(unlockCooldown)
+	resp, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"})
+	if err != nil {
+		t.Fatalf("Unlock after the cool-down: %v", err)
+	}
+	if !resp.WasAlreadyUnlocked {
+		t.Error("Unlock after the cool-down does not report was_already_unlocked")
+	}
+
+	// Success reset the counter: a new failure starts at a 1s delay,
+	// not the cool-down.
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "wrong"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("wrong password after reset: %v, want PermissionDenied", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := s.Unlock(ctx, &pb.UnlockRequest{Password: "correct"}); err != nil {
+		t.Fatalf("Unlock one second after a single failure: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// DefaultQuotaBytes is how much a peer without an active agreement may
+// store, kept for registries predating the agreement feature.
+const DefaultQuotaBytes = 1 << 30 // 1 GiB
+
+// agreementSigContext domain-separates agreement signatures from any
+// other use of the identity key.
+const agreementSigContext = "barterbackup/agreement/v1\n"
+
+// Agreement records a barter: the proposer stores OfferedBytes for the
+// acceptor, the acceptor stores RequestedBytes for the proposer, for
+// Days days from acceptance. Both parties sign the terms with their
+// onion identity keys, so either side can later prove what was agreed.
+type Agreement struct {
+	ID             string    `json:"id"`
+	Proposer       string    `json:"proposer"` // onion address
+	Acceptor       string    `json:"acceptor"` // onion address
+	OfferedBytes   int64     `json:"offered_bytes"`
+	RequestedBytes int64     `json:"requested_bytes"`
+	Days           int32     `json:"days"`
+	CreatedAt      time.Time `json:"created_at"`
+	ProposerSig    []byte    `json:"proposer_sig"`
+	AcceptorSig    []byte    `json:"acceptor_sig,omitempty"`
+	AcceptedAt     time.Time `json:"accepted_at,omitempty"`
+	// ProposerDHPub and AcceptorDHPub are the sides' X25519 public keys;
+	// both derive the shared secret behind FetchChunk ownership proofs.
+	// They are authenticated by the TLS channel at exchange time rather
+	// than by the terms signatures, so pre-exchange agreements verify
+	// unchanged.
+	ProposerDHPub []byte `json:"proposer_dh_pub,omitempty"`
+	AcceptorDHPub []byte `json:"acceptor_dh_pub,omitempty"`
+}
+
+// termsBytes is the canonical byte string both signatures cover.
+func (a *Agreement) termsBytes() []byte {
+	return []byte(fmt.Sprintf("%s%s|%s|%s|%d|%d|%d|%d",
+		agreementSigContext, a.ID, a.Proposer, a.Acceptor,
+		a.OfferedBytes, a.RequestedBytes, a.Days, a.CreatedAt.Unix()))
+}
+
+// State returns "pending", "active", or "expired".
+func (a *Agreement) State() string {
+	if len(a.AcceptorSig) == 0 {
+		return "pending"
+	}
+	if time.Now().After(a.ExpiresAt()) {
+		return "expired"
+	}
+	return "active"
+}
+
+// ExpiresAt returns when an accepted agreement lapses. It is zero for
+// pending agreements.
+func (a *Agreement) ExpiresAt() time.Time {
+	if a.AcceptedAt.IsZero() {
+		return time.Time{}
+	}
+	return a.AcceptedAt.Add(time.Duration(a.Days) * 24 * time.Hour)
+}
+
+// verifySigs checks the proposer signature and, when present, the
+// acceptor signature against the keys encoded in the onion addresses.
+func (a *Agreement) verifySigs() error {
+	terms := a.termsBytes()
+	for _, side := range []struct {
+		onion string
+		sig   []byte
+	}{
+		{a.Proposer, a.ProposerSig},
+		{a.Acceptor, a.AcceptorSig},
+	} {
+		if len(side.sig) == 0 {
+			continue
+		}
+		pub, err := keys.PubKeyFromOnion(side.onion)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, terms, side.sig) {
+			return fmt.Errorf("bad agreement signature from %s", side.onion)
+		}
+	}
+	if len(a.ProposerSig) == 0 {
+		return fmt.Errorf("agreement lacks proposer signature")
+	}
+	return nil
+}
+
+func agreementKey(id string) string {
+	return "agreements/" + id
+}
+
+// ProposeAgreement creates, signs, and sends a new agreement to the peer
+// identified by alias or onion address, storing it locally as pending.
+func (n *Node) ProposeAgreement(ctx context.Context, aliasOrOnion string, offeredBytes, requestedBytes int64, days int32) (*Agreement, error) {
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return nil, err
+	}
+	a := &Agreement{
+		ID:             newMessageID(),
+		Proposer:       n.Address(),
+		Acceptor:       p.Onion,
+		OfferedBytes:   offeredBytes,
+		RequestedBytes: requestedBytes,
+		Days:           days,
+		CreatedAt:      time.Now(),
+	}
+	_, dhPub, err := n.dhKey()
+	if err != nil {
+		return nil, err
+	}
+	a.ProposerDHPub = dhPub
+	signKey, err := n.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	a.ProposerSig = ed25519.Sign(signKey, a.termsBytes())
+
+	err = n.callPeer(ctx, p.Onion, 0, func(ctx context.Context, client pb.PeerClient) error {
+		_, err := client.ProposeAgreement(ctx, &pb.ProposeAgreementRequest{
+			Agreement: agreementToProto(a),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := n.sec.PutJSON(agreementKey(a.ID), a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AcceptAgreement signs a pending agreement proposed to us and notifies
+// the proposer.
+func (n *Node) AcceptAgreement(ctx context.Context, id string) (*Agreement, error) {
+	var a Agreement
+	if err := n.sec.GetJSON(agreementKey(id), &a); err != nil {
+		return nil, err
+	}
+	if a.Acceptor != n.Address() {
+		return nil, fmt.Errorf("agreement %s was not proposed to this node", id)
+	}
+	if a.State() != "pending" {
+		return nil, fmt.Errorf("agreement %s is %s, not pending", id, a.State())
+	}
+	_, dhPub, err := n.dhKey()
+	if err != nil {
+		return nil, err
+	}
+	a.AcceptorDHPub = dhPub
+	signKey, err := n.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	a.AcceptorSig = ed25519.Sign(signKey, a.termsBytes())
+	a.AcceptedAt = time.Now()
+
+	err = n.callPeer(ctx, a.Proposer, 0, func(ctx context.Context, client pb.PeerClient) error {
+		_, err := client.AcceptAgreement(ctx, &pb.AcceptAgreementRequest{
+			Agreement: agreementToProto(&a),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := n.sec.PutJSON(agreementKey(a.ID), &a); err != nil {
+		return nil, err
+	}
+	// A proposer from before the key exchange sends no DH key; the
+	// agreement then works without a fetch secret.
+	if len(a.ProposerDHPub) > 0 {
+		if err := n.storeAgreementSecret(a.ID, a.ProposerDHPub); err != nil {
+			return nil, err
+		}
+	}
+	n.auditEvent("agreement_accepted", map[string]string{
+		"id":        a.ID,
+		"peer":      a.Proposer,
+		"offered":   fmt.Sprint(a.OfferedBytes),
+		"requested": fmt.Sprint(a.RequestedBytes),
+	})
+	return &a, nil
+}
+
+// ListAgreements returns all stored agreements, newest first.
+func (n *Node) ListAgreements() ([]Agreement, error) {
+	ids, err := n.sec.List("agreements/")
+	if err != nil {
+		return nil, err
+	}
+	var out []Agreement
+	for _, key := range ids {
+		var a Agreement
+		if err := n.sec.GetJSON(key, &a); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// activeAgreementWith returns the agreement with the peer in the given
+// state ("active" etc.), or nil.
+func (n *Node) agreementWith(onion, state string) *Agreement {
+	all, err := n.ListAgreements()
+	if err != nil {
+		return nil
+	}
+	for i := range all {
+		a := &all[i]
+		if (a.Proposer == onion || a.Acceptor == onion) && a.State() == state {
+			return a
+		}
+	}
+	return nil
+}
+
+// PeerQuota returns how many bytes the peer may store on this node. The
+// quota derives from the active agreement; peers without any agreement
+// fall back to DefaultQuotaBytes.
+func (n *Node) PeerQuota(onion string) int64 {
+	if a := n.agreementWith(onion, "active"); a != nil {
+		if a.Proposer == n.Address() {
+			return a.OfferedBytes
+		}
+		return a.RequestedBytes
+	}
+	if n.agreementWith(onion, "expired") != nil {
+		// Expired agreement: the peer is read-only until renewal.
+		return 0
+	}
+	return DefaultQuotaBytes
+}
+
+// storeAllowed reports whether the peer may currently write new data.
+// Peers whose agreement expired are read-only: fetches still work so
+// they can recover their data, but stores are rejected.
+func (n *Node) storeAllowed(onion string) bool {
+	return n.PeerQuota(onion) > 0
+}
+
+func agreementToProto(a *Agreement) *pb.AgreementMsg {
+	msg := &pb.AgreementMsg{
+		Id:             a.ID,
+		Proposer:       a.Proposer,
+		Acceptor:       a.Acceptor,
+		OfferedBytes:   a.OfferedBytes,
+		RequestedBytes: a.RequestedBytes,
+		Days:           a.Days,
+		CreatedAtUnix:  a.CreatedAt.Unix(),
+		ProposerSig:    a.ProposerSig,
+		AcceptorSig:    a.AcceptorSig,
+		ProposerDhPub:  a.ProposerDHPub,
+		AcceptorDhPub:  a.AcceptorDHPub,
+	}
+	if !a.AcceptedAt.IsZero() {
+		msg.AcceptedAtUnix = a.AcceptedAt.Unix()
+	}
+	return msg
+}
+
+func agreementFromProto(msg *pb.AgreementMsg) *Agreement {
+	a := &Agreement{
+		ID:             msg.Id,
+		Proposer:       msg.Proposer,
+		Acceptor:       msg.Acceptor,
+		OfferedBytes:   msg.OfferedBytes,
+		RequestedBytes: msg.RequestedBytes,
+		Days:           msg.Days,
+		CreatedAt:      time.Unix(msg.CreatedAtUnix, 0),
+		ProposerSig:    msg.ProposerSig,
+		AcceptorSig:    msg.AcceptorSig,
+		ProposerDHPub:  msg.ProposerDhPub,
+		AcceptorDHPub:  msg.AcceptorDhPub,
+	}
+	if msg.AcceptedAtUnix != 0 {
+		a.AcceptedAt = time.Unix(msg.AcceptedAtUnix, 0)
+	}
+	return a
+}
@@ -0,0 +1,103 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestAgreementLifecycle(t *testing.T) {
+	a, b := startPairedNodes(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	proposed, err := a.ProposeAgreement(ctx, b.Address(), 50<<30, 40<<30, 90)
+	if err != nil {
+		t.Fatalf("ProposeAgreement: %v", err)
+	}
+	if proposed.State() != "pending" {
+		t.Fatalf("state after propose = %q, want pending", proposed.State())
+	}
+
+	// Both sides see the pending agreement.
+	for _, n := range []*Node{a, b} {
+		list, err := n.ListAgreements()
+		if err != nil {
+			t.Fatalf("ListAgreements: %v", err)
+		}
+		if len(list) != 1 || list[0].ID != proposed.ID {
+			t.Fatalf("ListAgreements: got %+v", list)
+		}
+	}
+
+	accepted, err := b.AcceptAgreement(ctx, proposed.ID)
+	if err != nil {
+		t.Fatalf("AcceptAgreement: %v", err)
+	}
+	if accepted.State() != "active" {
+		t.Fatalf("state after accept = %q, want active", accepted.State())
+	}
+	if err := accepted.verifySigs(); err != nil {
+		t.Fatalf("verifySigs: %v", err)
+	}
+
+	// Quotas derive from the agreement: a stores 50 GiB for b, b stores
+	// 40 GiB for a.
+	if got := a.PeerQuota(b.Address()); got != 50<<30 {
+		t.Errorf("a.PeerQuota(b) = %d, want %d", got, int64(50<<30))
+	}
+	if got := b.PeerQuota(a.Address()); got != 40<<30 {
+		t.Errorf("b.PeerQuota(a) = %d, want %d", got, int64(40<<30))
+	}
+}
+
+func TestAgreementExpiryFlipsReadOnly(t *testing.T) {
+	a, b := startPairedNodes(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	proposed, err := a.ProposeAgreement(ctx, b.Address(), 1<<20, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("ProposeAgreement: %v", err)
+	}
+	if _, err := b.AcceptAgreement(ctx, proposed.ID); err != nil {
+		t.Fatalf("AcceptAgreement: %v", err)
+	}
+
+	// Backdate the acceptance past the duration.
+	var stored Agreement
+	if err := a.sec.GetJSON(agreementKey(proposed.ID), &stored); err != nil {
+		t.Fatalf("load agreement: %v", err)
+	}
+	stored.AcceptedAt = time.Now().Add(-48 * time.Hour)
+	if err := a.sec.PutJSON(agreementKey(proposed.ID), &stored); err != nil {
+		t.Fatalf("store agreement: %v", err)
+	}
+
+	if got := stored.State(); got != "expired" {
+		t.Fatalf("state = %q, want expired", got)
+	}
+	if a.storeAllowed(b.Address()) {
+		t.Error("storeAllowed = true for peer with expired agreement, want false")
+	}
+}
+
+// startPairedNodes starts two mutually registered nodes on one mock
+// network.
+func startPairedNodes(t *testing.T) (*Node, *Node) {
+	t.Helper()
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	return a, b
+}
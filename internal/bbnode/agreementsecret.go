@@ -0,0 +1,105 @@
+package bbnode
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// fetchNonceSize is the size of the session nonce FetchChunk ownership
+// proofs cover.
+const fetchNonceSize = 16
+
+// agreementSecretInfo domain-separates the per-agreement fetch secret
+// from other HKDF outputs; the agreement ID is appended so distinct
+// agreements with the same peer get distinct secrets.
+const agreementSecretInfo = "barterbackup/agreement-secret/v1|"
+
+func agreementSecretKey(id string) string {
+	return "agreementsecrets/" + id
+}
+
+// dhKey returns the node's X25519 key pair for agreement secret
+// exchanges, derived from the master secret.
+func (n *Node) dhKey() (priv, pub []byte, err error) {
+	master, err := n.master()
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys.DHKeyFromMaster(master)
+}
+
+// storeAgreementSecret derives the shared secret for the agreement from
+// our X25519 key and the peer's public key and persists it. Fetches
+// under the agreement must prove knowledge of this secret, so a
+// replayed TLS identity alone cannot read stored chunks.
+func (n *Node) storeAgreementSecret(id string, theirDHPub []byte) error {
+	if len(theirDHPub) != curve25519.PointSize {
+		return fmt.Errorf("bad dh public key size %d", len(theirDHPub))
+	}
+	priv, _, err := n.dhKey()
+	if err != nil {
+		return err
+	}
+	shared, err := curve25519.X25519(priv, theirDHPub)
+	if err != nil {
+		return fmt.Errorf("agreement dh exchange: %w", err)
+	}
+	secret, err := keys.Expand(shared, agreementSecretInfo+id, 32)
+	if err != nil {
+		return err
+	}
+	return n.sec.Put(agreementSecretKey(id), secret)
+}
+
+// agreementSecret returns the shared fetch secret established with the
+// peer at onion, if any. Expired agreements still count: the peer keeps
+// read access to recover its data, and that access stays proof-gated.
+func (n *Node) agreementSecret(onion string) ([]byte, bool) {
+	a := n.agreementWith(onion, "active")
+	if a == nil {
+		a = n.agreementWith(onion, "expired")
+	}
+	if a == nil {
+		return nil, false
+	}
+	secret, err := n.sec.Get(agreementSecretKey(a.ID))
+	if err != nil {
+		return nil, false
+	}
+	return secret, true
+}
+
+// fetchChunkProof computes the ownership proof for fetching name under
+// the session nonce: HMAC-SHA256(secret, name || nonce).
+func fetchChunkProof(secret []byte, name string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(name))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// issueFetchNonce hands out (and remembers) the session nonce the
+// caller's FetchChunk proofs must cover. Re-issuing replaces the old
+// nonce, invalidating proofs computed against it.
+func (n *Node) issueFetchNonce(caller string) []byte {
+	nonce := make([]byte, fetchNonceSize)
+	rand.Read(nonce)
+	n.mu.Lock()
+	n.fetchNonces[caller] = nonce
+	n.mu.Unlock()
+	return nonce
+}
+
+// issuedFetchNonce returns the session nonce last issued to the caller.
+func (n *Node) issuedFetchNonce(caller string) ([]byte, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	nonce, ok := n.fetchNonces[caller]
+	return nonce, ok
+}
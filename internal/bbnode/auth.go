@@ -0,0 +1,130 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// openMethods are bbrpc methods any node may call without being in the
+// peer registry. Everything else requires an authorized peer.
+var openMethods = map[string]bool{
+	"/bbrpc.Peer/HealthCheck": true,
+	"/bbrpc.Peer/Ping":        true,
+	// The self-dial identity check must work even though a node is not
+	// in its own peer registry.
+	"/bbrpc.Peer/WhoAmI": true,
+	// Authenticated by the signature inside the notice, not the caller
+	// identity: a peer's new address is unknown until the notice lands.
+	"/bbrpc.Peer/AnnounceAddressChange": true,
+	// Authenticated by the invite code: the caller is by definition not
+	// in the registry yet.
+	"/bbrpc.Peer/Join": true,
+}
+
+// dataPlaneMethods are the chunk and manifest transfer methods an
+// operator can restrict to peers that proved onion ownership; see
+// WithRequireOnionProof. Control-plane calls (messages, agreements,
+// ProveOnion itself) stay available so a peer can become proven.
+var dataPlaneMethods = map[string]bool{
+	"/bbrpc.Peer/HasChunk":            true,
+	"/bbrpc.Peer/HasChunks":           true,
+	"/bbrpc.Peer/StoreChunk":          true,
+	"/bbrpc.Peer/FetchChunk":          true,
+	"/bbrpc.Peer/DeleteChunks":        true,
+	"/bbrpc.Peer/HasOwnedChunks":      true,
+	"/bbrpc.Peer/MigrateChunks":       true,
+	"/bbrpc.Peer/StoreManifest":       true,
+	"/bbrpc.Peer/ListStoredManifests": true,
+	"/bbrpc.Peer/FetchManifest":       true,
+}
+
+// callerOnion derives the calling node's onion address from its TLS
+// client certificate.
+func callerOnion(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "no peer info")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return "", status.Error(codes.Unauthenticated, "no client certificate")
+	}
+	pub, ok := tlsInfo.State.PeerCertificates[0].PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "client certificate key is not Ed25519")
+	}
+	return keys.OnionAddress(pub), nil
+}
+
+// authorize checks that the caller is an authorized peer and returns its
+// onion address.
+func (n *Node) authorize(ctx context.Context, fullMethod string) (string, error) {
+	onion, err := callerOnion(ctx)
+	if err != nil {
+		return "", err
+	}
+	// The blocklist wins over everything, including the open methods.
+	if n.isBlocked(onion) {
+		n.recordBlockedAttempt(onion, fullMethod)
+		return "", status.Errorf(codes.PermissionDenied, "peer %s is blocked", onion)
+	}
+	n.mu.Lock()
+	p, known := n.peers[onion]
+	proven := known && p.OnionProven
+	beingWiped := n.wiping[onion]
+	n.mu.Unlock()
+	if beingWiped {
+		// A wipe job is deleting this peer's data; letting any call
+		// through would race the file removal.
+		return "", status.Errorf(codes.PermissionDenied, "peer %s is being wiped", onion)
+	}
+	if known {
+		n.markPeerSeen(onion)
+	}
+	if openMethods[fullMethod] {
+		return onion, nil
+	}
+	if !known {
+		n.auditEvent("auth_failed", map[string]string{"onion": onion, "method": fullMethod})
+		return "", status.Errorf(codes.PermissionDenied, "peer %s is not authorized", onion)
+	}
+	if n.requireProof && dataPlaneMethods[fullMethod] && !proven {
+		n.auditEvent("auth_unproven", map[string]string{"onion": onion, "method": fullMethod})
+		return "", status.Errorf(codes.PermissionDenied, "peer %s has not proven onion ownership", onion)
+	}
+	return onion, nil
+}
+
+func (n *Node) authUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	onion, err := n.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.limiter.acquire(onion, n.peerStreamLimit(onion)); err != nil {
+		return nil, err
+	}
+	// Released via defer so the slot comes back even if the handler
+	// panics or the caller vanishes mid-call.
+	defer n.limiter.release(onion)
+	return handler(ctx, req)
+}
+
+func (n *Node) authStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	onion, err := n.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	if err := n.limiter.acquire(onion, n.peerStreamLimit(onion)); err != nil {
+		return err
+	}
+	defer n.limiter.release(onion)
+	return handler(srv, ss)
+}
@@ -0,0 +1,1364 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/atomicfile"
+	"github.com/starius/barterbackup/internal/cdc"
+	"github.com/starius/barterbackup/internal/chunkcrypto"
+	"github.com/starius/barterbackup/internal/glob"
+	"github.com/starius/barterbackup/internal/hashid"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/manifest"
+	manifestpb "github.com/starius/barterbackup/internal/manifest/pb"
+	"github.com/starius/barterbackup/internal/tracing"
+)
+
+// chunkSize is the fixed-chunking plaintext chunk size. It leaves room
+// for the chunkcrypto envelope and proto framing under
+// bbrpc.GRPCMaxMsgSize; cdc.DefaultParams.Max obeys the same ceiling.
+const chunkSize = 8 * 1024
+
+// Chunking algorithm names, as they appear in manifests and the
+// CreateBackup chunker argument.
+const (
+	chunkerFixed = "fixed"
+	chunkerCDC   = "cdc"
+)
+
+// manifestEnvelopeIndex is the reserved chunk index the manifest blob
+// pushed to the peer is sealed under.
+const manifestEnvelopeIndex = math.MaxUint64
+
+// manifestFrameSize is how much of the sealed manifest goes into one
+// StoreManifest stream frame.
+const manifestFrameSize = 8 * 1024
+
+// manifestBlobPrefix prefixes manifest blob names on the peer.
+const manifestBlobPrefix = "manifest-"
+
+func backupRecordKey(id string) string { return "backups/" + id }
+
+func manifestRecordKey(id string) string { return "manifests/" + id }
+
+// chunkBlobName is the name a chunk envelope is stored under on the
+// peer. It includes the sealing backup's ID so identical plaintext in
+// different backups (sealed under different keys) never collides.
+func chunkBlobName(backupID, hash string) string { return backupID + "-" + hash }
+
+// Backup is the local record of one backup run.
+type Backup struct {
+	// ID identifies the backup; it also appears in chunk envelopes.
+	ID string `json:"id"`
+	// Peers are the onion addresses the backup is replicated to.
+	Peers []string `json:"peers"`
+	// Replication records the upload outcome per peer: "complete", or
+	// what went wrong. bbcli backup status re-checks it live.
+	Replication map[string]string `json:"replication,omitempty"`
+	// SourceDir is the absolute path the backup was taken from.
+	SourceDir string `json:"source_dir"`
+	// BaseID is the previous backup this run was incremental against.
+	BaseID    string    `json:"base_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// FileCount counts manifest entries (files, dirs, symlinks).
+	FileCount int `json:"file_count"`
+	// TotalBytes is the plaintext size of all files.
+	TotalBytes int64 `json:"total_bytes"`
+	// UploadedBytes is how much was actually sent this run across all
+	// peers; the rest was reused from the base backup or deduplicated.
+	UploadedBytes int64 `json:"uploaded_bytes"`
+	ChunkCount    int   `json:"chunk_count"`
+	// LastVerifiedAt is when the last fully clean VerifyBackup run
+	// finished; zero if the backup was never verified.
+	LastVerifiedAt time.Time `json:"last_verified_at,omitempty"`
+	// DeletedAt marks a backup in the deletion grace period: hidden
+	// from default listings and skipped as an incremental base, but
+	// still restorable until the trash sweep purges it. Zero means
+	// live.
+	DeletedAt time.Time `json:"deleted_at,omitempty"`
+}
+
+func newBackupID() string {
+	var b [chunkcrypto.IDSize]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// backupSealKey derives the chunkcrypto key for the backup with the
+// given hex ID.
+func (n *Node) backupSealKey(id string) (*chunkcrypto.BackupKey, error) {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != chunkcrypto.IDSize {
+		return nil, fmt.Errorf("bad backup id %q", id)
+	}
+	master, err := n.master()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := keys.Expand(master, "barterbackup/backup/v1/"+id, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive backup key: %w", err)
+	}
+	key := &chunkcrypto.BackupKey{}
+	copy(key.ID[:], raw)
+	copy(key.Secret[:], secret)
+	return key, nil
+}
+
+// target is one replication destination during a backup run. A target
+// that fails mid-run is dropped; the run continues on the rest.
+type target struct {
+	onion  string
+	client pb.PeerClient
+	err    error
+}
+
+// BackupOptions are the optional parameters of a backup run.
+type BackupOptions struct {
+	// Chunker is "cdc" or "fixed"; empty picks the default.
+	Chunker string
+	// Hash names the chunk hash algorithm, "sha256" or "blake3"; empty
+	// picks the default.
+	Hash string
+	// Include and Exclude filter the tree walk with gitignore-style
+	// glob patterns; excludes win.
+	Include []string
+	Exclude []string
+	// FollowSymlinks stores what symlinks point at, descending into
+	// symlinked directories, instead of recording the links themselves.
+	FollowSymlinks bool
+}
+
+// CreateBackup walks sourceDir, uploads chunks of new or changed files
+// to every target peer, and stores the manifest both locally and
+// (encrypted) on each peer. peerSpecs mixes group names, aliases, and
+// onion addresses. The include and exclude options filter the walk,
+// excludes winning; an incremental run given no patterns reuses the
+// base backup's. Files unchanged since the previous backup of the same
+// source reuse its chunks without re-reading them. The run succeeds if
+// at least one peer got a complete replica; per-peer outcomes are
+// recorded in the backup record. The run is registered as a job, so
+// bbcli job pause/resume/cancel apply to it.
+func (n *Node) CreateBackup(ctx context.Context, peerSpecs []string, sourceDir string, opts BackupOptions) (*Backup, error) {
+	// Reject pattern typos before the job exists, let alone any upload.
+	if _, err := newBackupFilter(opts.Include, opts.Exclude); err != nil {
+		return nil, err
+	}
+	job := &Job{
+		Kind: "backup", Peers: peerSpecs, SourceDir: sourceDir,
+		BackupID: newBackupID(), Chunker: opts.Chunker, Hash: opts.Hash,
+		Include: opts.Include, Exclude: opts.Exclude,
+		FollowSymlinks: opts.FollowSymlinks,
+	}
+	var b *Backup
+	err := n.runJob(ctx, job, func(ctx context.Context) error {
+		var err error
+		b, err = n.createBackup(ctx, job)
+		return err
+	})
+	return b, err
+}
+
+// createBackup is the body of a backup job. The backup ID lives in the
+// job record, so a resumed job reuses it and finds its earlier chunks
+// already on the peers.
+func (n *Node) createBackup(ctx context.Context, job *Job) (*Backup, error) {
+	onions, err := n.resolvePeerSpecs(job.Peers)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(job.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve source dir: %w", err)
+	}
+	if abs, err = n.checkBackupRoot(abs); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(abs); err != nil {
+		return nil, fmt.Errorf("source dir: %w", err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("source %s is not a directory", abs)
+	}
+	prev, prevEntries, prevHdr, err := n.previousBackup(onions, abs)
+	if err != nil {
+		return nil, err
+	}
+	chunker, params, err := chunkParamsFor(job.Chunker, prevHdr)
+	if err != nil {
+		return nil, err
+	}
+	hashAlg, hashName, err := hashAlgFor(job.Hash, prevHdr)
+	if err != nil {
+		return nil, err
+	}
+	include, exclude := job.Include, job.Exclude
+	if len(include) == 0 && len(exclude) == 0 && prevHdr != nil {
+		// Like the chunker: a run given no patterns keeps the base
+		// backup's selection, so incrementals skip the same trees.
+		include, exclude = prevHdr.Include, prevHdr.Exclude
+	}
+	filter, err := newBackupFilter(include, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	id := job.BackupID
+	key, err := n.backupSealKey(id)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+
+	b := &Backup{
+		ID:          id,
+		Peers:       onions,
+		Replication: make(map[string]string),
+		SourceDir:   abs,
+		CreatedAt:   time.Now(),
+	}
+	if prev != nil {
+		b.BaseID = prev.ID
+	}
+
+	var targets []*target
+	for _, onion := range onions {
+		cc, err := n.getConn(ctx, onion)
+		if err != nil {
+			b.Replication[onion] = fmt.Sprintf("unreachable: %v", err)
+			continue
+		}
+		targets = append(targets, &target{onion: onion, client: pb.NewPeerClient(cc)})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no backup target peer is reachable")
+	}
+
+	hdr := &manifestpb.Header{
+		BackupId:      id,
+		CreatedAtUnix: b.CreatedAt.Unix(),
+		SourceDir:     abs,
+		Peers:         onions,
+		Chunker:       chunker,
+		HashAlg:       hashName,
+		Include:       include,
+		Exclude:       exclude,
+	}
+	if chunker == chunkerCDC {
+		hdr.CdcMin = int64(params.Min)
+		hdr.CdcAvg = int64(params.Avg)
+		hdr.CdcMax = int64(params.Max)
+	}
+	var mbuf bytes.Buffer
+	mw, err := manifest.NewWriter(&mbuf, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	up := &uploader{node: n, targets: targets, key: key, backupID: id, jobID: job.ID, chunker: chunker, params: params, hashAlg: hashAlg}
+	hardlinks := map[hardlinkKey]string{} // inode -> first manifest path
+	walkErr := walkSource(abs, job.FollowSymlinks, n.sourceAllowFunc(), func(path, rel string, d os.DirEntry) error {
+		if filter.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Directories are always recorded so the restored tree keeps
+		// its structure; include patterns select files and symlinks.
+		if !d.IsDir() && !filter.included(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := &manifestpb.FileEntry{
+			Path:      rel,
+			Mode:      uint32(info.Mode()),
+			MtimeUnix: info.ModTime().Unix(),
+			MtimeNsec: int32(info.ModTime().Nanosecond()),
+		}
+		switch {
+		case d.IsDir():
+			// Recorded for mode and mtime; nothing to upload.
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("read symlink %s: %w", rel, err)
+			}
+			e.SymlinkTarget = target
+		case info.Mode().IsRegular():
+			e.Size = info.Size()
+			b.TotalBytes += e.Size
+			n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesTotal = b.TotalBytes })
+			if hk, ok := hardlinkID(info); ok {
+				if first, seen := hardlinks[hk]; seen {
+					// Another name for a file already in this run:
+					// record the group, store the content once.
+					e.HardlinkTo = first
+					n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesDone += e.Size })
+					break
+				}
+				hardlinks[hk] = rel
+			}
+			if old := prevEntries[e.Path]; old != nil && old.HardlinkTo == "" && !manifest.EntryChanged(old, e) {
+				// Unchanged since the base backup: reference its chunks.
+				e.Chunks = reuseChunks(old, prev.ID)
+				e.FileHash = old.FileHash
+				n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesDone += e.Size })
+			} else if err := up.uploadFile(ctx, path, e); err != nil {
+				return fmt.Errorf("upload %s: %w", rel, err)
+			}
+		default:
+			return nil // sockets, devices, etc. are skipped
+		}
+		b.FileCount++
+		b.ChunkCount += len(e.Chunks)
+		return mw.Add(e)
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("backup %s: %w", abs, walkErr)
+	}
+	if err := mw.Flush(); err != nil {
+		return nil, err
+	}
+	b.UploadedBytes = up.uploadedBytes
+	span := tracing.SpanFromContext(ctx)
+	span.SetInt("backup.total_bytes", b.TotalBytes)
+	span.SetInt("backup.uploaded_bytes", b.UploadedBytes)
+	span.SetInt("backup.chunks", int64(b.ChunkCount))
+	span.SetInt("backup.files", int64(b.FileCount))
+
+	if err := n.sec.Put(manifestRecordKey(id), mbuf.Bytes()); err != nil {
+		return nil, fmt.Errorf("store manifest: %w", err)
+	}
+	complete := 0
+	for _, t := range targets {
+		if t.err == nil {
+			t.err = pushManifest(ctx, t.client, key, id, mbuf.Bytes())
+		}
+		if t.err != nil {
+			b.Replication[t.onion] = fmt.Sprintf("failed: %v", t.err)
+		} else {
+			b.Replication[t.onion] = "complete"
+			n.reportStoredAt(t.onion, mbuf.Len())
+			complete++
+		}
+	}
+	if complete == 0 {
+		return nil, fmt.Errorf("backup reached no peer completely: %v", b.Replication)
+	}
+	if err := n.sec.PutJSON(backupRecordKey(id), b); err != nil {
+		return nil, fmt.Errorf("store backup record: %w", err)
+	}
+	return b, nil
+}
+
+// chunkParamsFor picks the chunking algorithm for a run. An explicit
+// request wins; an incremental run otherwise reuses the base manifest's
+// parameters so both runs cut identical boundaries; a fresh run
+// defaults to content-defined chunking.
+func chunkParamsFor(requested string, base *manifestpb.Header) (string, cdc.Params, error) {
+	if requested == "" && base != nil {
+		if base.Chunker == chunkerCDC {
+			return chunkerCDC, cdc.Params{
+				Min: int(base.CdcMin), Avg: int(base.CdcAvg), Max: int(base.CdcMax),
+			}, nil
+		}
+		// Manifests from before chunking was configurable have an empty
+		// chunker and were cut fixed.
+		return chunkerFixed, cdc.Params{}, nil
+	}
+	switch requested {
+	case "", chunkerCDC:
+		return chunkerCDC, cdc.DefaultParams, nil
+	case chunkerFixed:
+		return chunkerFixed, cdc.Params{}, nil
+	default:
+		return "", cdc.Params{}, fmt.Errorf("unknown chunker %q (want %s or %s)", requested, chunkerFixed, chunkerCDC)
+	}
+}
+
+// hashAlgFor picks the chunk hash algorithm for a run. An explicit
+// request wins; an incremental run otherwise reuses the base manifest's
+// algorithm so unchanged files dedup against the base; a fresh run
+// defaults to SHA-256. Manifests from before hashing was configurable
+// have an empty algorithm, which names SHA-256.
+func hashAlgFor(requested string, base *manifestpb.Header) (byte, string, error) {
+	name := requested
+	if name == "" && base != nil {
+		name = base.HashAlg
+	}
+	alg, err := hashid.AlgByName(name)
+	if err != nil {
+		return 0, "", err
+	}
+	resolved, err := hashid.NameOf(alg)
+	if err != nil {
+		return 0, "", err
+	}
+	return alg, resolved, nil
+}
+
+// backupFilter applies include and exclude glob patterns to the tree
+// walk. Excludes win over includes; an empty include list admits
+// everything.
+type backupFilter struct {
+	include []*glob.Pattern
+	exclude []*glob.Pattern
+}
+
+func newBackupFilter(include, exclude []string) (*backupFilter, error) {
+	f := &backupFilter{}
+	for _, raw := range include {
+		p, err := glob.Compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("include pattern %q: %w", raw, err)
+		}
+		f.include = append(f.include, p)
+	}
+	for _, raw := range exclude {
+		p, err := glob.Compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", raw, err)
+		}
+		f.exclude = append(f.exclude, p)
+	}
+	return f, nil
+}
+
+// excluded reports whether the entry at rel stays out of the backup;
+// for a directory that prunes the whole subtree.
+func (f *backupFilter) excluded(rel string) bool {
+	for _, p := range f.exclude {
+		if p.Match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether the include patterns select the file at rel.
+func (f *backupFilter) included(rel string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.Match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlannedFile is one entry a dry-run backup would store.
+type PlannedFile struct {
+	// Path is the slash-separated path relative to the source dir.
+	Path string
+	// Size is the file's plaintext size; zero for symlinks.
+	Size int64
+}
+
+// PlanBackup walks sourceDir under the same selection rules as
+// CreateBackup and returns the files and symlinks that would enter the
+// backup, with the total file bytes. Nothing is uploaded, no peer is
+// contacted, and no job is recorded; bbcli backup create --dry-run is
+// the caller.
+func (n *Node) PlanBackup(sourceDir string, opts BackupOptions) ([]PlannedFile, int64, error) {
+	filter, err := newBackupFilter(opts.Include, opts.Exclude)
+	if err != nil {
+		return nil, 0, err
+	}
+	abs, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("resolve source dir: %w", err)
+	}
+	if abs, err = n.checkBackupRoot(abs); err != nil {
+		return nil, 0, err
+	}
+	if info, err := os.Stat(abs); err != nil {
+		return nil, 0, fmt.Errorf("source dir: %w", err)
+	} else if !info.IsDir() {
+		return nil, 0, fmt.Errorf("source %s is not a directory", abs)
+	}
+	var planned []PlannedFile
+	var total int64
+	err = walkSource(abs, opts.FollowSymlinks, n.sourceAllowFunc(), func(path, rel string, d os.DirEntry) error {
+		if filter.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !filter.included(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			planned = append(planned, PlannedFile{Path: rel})
+		case info.Mode().IsRegular():
+			planned = append(planned, PlannedFile{Path: rel, Size: info.Size()})
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("plan backup %s: %w", abs, err)
+	}
+	return planned, total, nil
+}
+
+// splitter produces the chunks of one file; io.EOF after the last.
+type splitter interface {
+	Next() ([]byte, error)
+}
+
+// fixedSplitter cuts chunkSize blocks.
+type fixedSplitter struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (s *fixedSplitter) Next() ([]byte, error) {
+	m, err := io.ReadFull(s.r, s.buf)
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return s.buf[:m], nil
+}
+
+// reuseChunks copies the chunk refs of an unchanged file, making the
+// sealing backup explicit so restore derives the right key.
+func reuseChunks(old *manifestpb.FileEntry, sealerID string) []*manifestpb.ChunkRef {
+	refs := make([]*manifestpb.ChunkRef, 0, len(old.Chunks))
+	for _, c := range old.Chunks {
+		ref := &manifestpb.ChunkRef{
+			Hash:     c.Hash,
+			Offset:   c.Offset,
+			Size:     c.Size,
+			Index:    c.Index,
+			BackupId: c.BackupId,
+		}
+		if ref.BackupId == "" {
+			ref.BackupId = sealerID
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// uploader seals chunks for one backup run and replicates each to all
+// still-healthy targets, deduplicating identical plaintext within the
+// run and per peer via HasChunk.
+type uploader struct {
+	node     *Node
+	targets  []*target
+	key      *chunkcrypto.BackupKey
+	backupID string
+	jobID    string
+	chunker  string
+	params   cdc.Params
+	hashAlg  byte
+
+	nextIndex     uint64
+	uploadedBytes int64
+	seen          map[string]*manifestpb.ChunkRef // plaintext hash -> ref
+}
+
+func (u *uploader) uploadFile(ctx context.Context, path string, e *manifestpb.FileEntry) error {
+	if u.seen == nil {
+		u.seen = make(map[string]*manifestpb.ChunkRef)
+	}
+	u.node.updateJobProgress(u.jobID, func(p *JobProgress) { p.CurrentFile = e.Path })
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// A sparse file is read region by region; the holes between regions
+	// are neither read nor uploaded, only hashed as the zeros they are.
+	regions, ok := dataRegions(f, e.Size)
+	if !ok {
+		regions = []fileRegion{{off: 0, length: e.Size}}
+	}
+	fileHash := sha256.New()
+	var pos int64
+	for _, reg := range regions {
+		hashZeros(fileHash, reg.off-pos)
+		var sp splitter
+		r := io.NewSectionReader(f, reg.off, reg.length)
+		if u.chunker == chunkerCDC {
+			sp, err = cdc.NewChunker(r, u.params)
+			if err != nil {
+				return err
+			}
+		} else {
+			sp = &fixedSplitter{r: r, buf: make([]byte, chunkSize)}
+		}
+		offset := reg.off
+		for {
+			block, err := sp.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			fileHash.Write(block)
+			hash, err := hashid.Sum(u.hashAlg, block)
+			if err != nil {
+				return err
+			}
+			if ref, ok := u.seen[hash]; ok {
+				// Same plaintext already sealed this run; point at it.
+				e.Chunks = append(e.Chunks, &manifestpb.ChunkRef{
+					Hash: hash, Offset: offset, Size: int64(len(block)), Index: ref.Index,
+				})
+				u.node.updateJobProgress(u.jobID, func(p *JobProgress) { p.BytesDone += int64(len(block)) })
+			} else {
+				index := u.nextIndex
+				u.nextIndex++
+				if err := u.sendChunk(ctx, hash, block, index); err != nil {
+					return err
+				}
+				ref := &manifestpb.ChunkRef{Hash: hash, Offset: offset, Size: int64(len(block)), Index: index}
+				u.seen[hash] = ref
+				e.Chunks = append(e.Chunks, ref)
+			}
+			offset += int64(len(block))
+		}
+		pos = reg.off + reg.length
+	}
+	hashZeros(fileHash, e.Size-pos)
+	e.FileHash = fileHash.Sum(nil)
+	return nil
+}
+
+// sendChunk replicates one sealed chunk to every healthy target. A
+// failing target is dropped from the rest of the run; the run aborts
+// only when no target is left.
+func (u *uploader) sendChunk(ctx context.Context, hash string, block []byte, index uint64) error {
+	if err := checkpoint(ctx); err != nil {
+		return err
+	}
+	name := chunkBlobName(u.backupID, hash)
+	env, err := chunkcrypto.Seal(block, u.key, index)
+	if err != nil {
+		return err
+	}
+	healthy := 0
+	for _, t := range u.targets {
+		if t.err != nil {
+			continue
+		}
+		if err := sendChunkTo(u.node.peerCtx(ctx, t.onion), t.client, name, env); err != nil {
+			t.err = err
+			continue
+		}
+		u.uploadedBytes += int64(len(env))
+		u.node.reportStoredAt(t.onion, len(env))
+		healthy++
+	}
+	if healthy == 0 {
+		return fmt.Errorf("all target peers failed, last: %v", u.targets[len(u.targets)-1].err)
+	}
+	u.node.updateJobProgress(u.jobID, func(p *JobProgress) {
+		p.BytesDone += int64(len(block))
+		p.ChunksDone++
+	})
+	return nil
+}
+
+func sendChunkTo(ctx context.Context, client pb.PeerClient, name string, env []byte) error {
+	has, err := client.HasChunk(ctx, &pb.HasChunkRequest{Name: name})
+	if err != nil {
+		return fmt.Errorf("check chunk: %w", err)
+	}
+	if has.Present {
+		return nil // left over from an interrupted run
+	}
+	if _, err := client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: name, Data: env}); err != nil {
+		return fmt.Errorf("store chunk: %w", err)
+	}
+	return nil
+}
+
+// pushManifest seals the manifest and streams it to the peer so a total
+// local loss is recoverable with just the password and the peer's copy.
+func pushManifest(ctx context.Context, client pb.PeerClient, key *chunkcrypto.BackupKey, id string, data []byte) error {
+	env, err := chunkcrypto.Seal(data, key, manifestEnvelopeIndex)
+	if err != nil {
+		return err
+	}
+	stream, err := client.StoreManifest(ctx)
+	if err != nil {
+		return fmt.Errorf("store manifest: %w", err)
+	}
+	for first := true; len(env) > 0 || first; first = false {
+		frame := &pb.StoreManifestRequest{}
+		if first {
+			frame.BackupId = id
+		}
+		m := len(env)
+		if m > manifestFrameSize {
+			m = manifestFrameSize
+		}
+		frame.Data = env[:m]
+		env = env[m:]
+		if err := stream.Send(frame); err != nil {
+			return fmt.Errorf("send manifest frame: %w", err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("store manifest: %w", err)
+	}
+	return nil
+}
+
+// previousBackup returns the most recent backup of sourceDir whose peer
+// set covers all requested peers (so reused chunks exist on every
+// target), with its manifest entries indexed by path and its manifest
+// header, or nils when nothing qualifies and the run is a full backup.
+func (n *Node) previousBackup(onions []string, sourceDir string) (*Backup, map[string]*manifestpb.FileEntry, *manifestpb.Header, error) {
+	list, err := n.ListBackups()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var prev *Backup
+	for i := range list {
+		b := &list[i]
+		if b.SourceDir != sourceDir || !coversAll(b, onions) || !b.DeletedAt.IsZero() {
+			continue
+		}
+		if prev == nil || b.CreatedAt.After(prev.CreatedAt) {
+			prev = b
+		}
+	}
+	if prev == nil {
+		return nil, nil, nil, nil
+	}
+	raw, err := n.sec.Get(manifestRecordKey(prev.ID))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("load manifest of %s: %w", prev.ID, err)
+	}
+	mr, err := manifest.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	entries := make(map[string]*manifestpb.FileEntry)
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, nil, err
+		}
+		entries[e.Path] = e
+	}
+	return prev, entries, mr.Header(), nil
+}
+
+// coversAll reports whether backup b has a complete replica on every
+// one of the given peers.
+func coversAll(b *Backup, onions []string) bool {
+	for _, onion := range onions {
+		if b.Replication != nil && b.Replication[onion] == "complete" {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// ListBackups returns all backup records, newest first.
+func (n *Node) ListBackups() ([]Backup, error) {
+	ids, err := n.sec.List("backups/")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Backup, 0, len(ids))
+	for _, key := range ids {
+		var b Backup
+		if err := n.sec.GetJSON(key, &b); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// DiffBackups compares the manifests of two local backups.
+func (n *Node) DiffBackups(oldID, newID string) (*manifest.Changes, error) {
+	readers := make([]*manifest.Reader, 2)
+	for i, id := range []string{oldID, newID} {
+		raw, err := n.sec.Get(manifestRecordKey(id))
+		if err != nil {
+			return nil, fmt.Errorf("load manifest of %s: %w", id, err)
+		}
+		mr, err := manifest.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = mr
+	}
+	return manifest.DiffManifests(readers[0], readers[1])
+}
+
+// restoreTmpSuffix marks files being rebuilt; a file only reaches its
+// final name after every chunk authenticated and the whole-file hash
+// matched.
+const restoreTmpSuffix = ".bbrestore"
+
+// replica pairs a peer's onion address with an open client, so fetches
+// can attach ownership proofs keyed per peer.
+type replica struct {
+	onion  string
+	client pb.PeerClient
+}
+
+// fetchChunkData reads a whole FetchChunk stream into memory, attaching
+// the ownership proof the peer at addr requires once an agreement
+// secret exists. Chunks are bounded by the chunking parameters, so this
+// stays small even though the wire format streams. A stale session
+// nonce (e.g. after the peer restarted) is refreshed once.
+func (n *Node) fetchChunkData(ctx context.Context, client pb.PeerClient, addr, name string) ([]byte, error) {
+	data, err := n.fetchChunkOnce(ctx, client, addr, name)
+	if status.Code(err) == codes.Unauthenticated {
+		if err := n.refreshFetchNonce(ctx, client, addr); err != nil {
+			return nil, err
+		}
+		return n.fetchChunkOnce(ctx, client, addr, name)
+	}
+	return data, err
+}
+
+func (n *Node) fetchChunkOnce(ctx context.Context, client pb.PeerClient, addr, name string) ([]byte, error) {
+	req := &pb.FetchChunkRequest{Name: name}
+	if secret, ok := n.agreementSecret(addr); ok {
+		n.mu.Lock()
+		nonce := n.peerFetchNonce[addr]
+		n.mu.Unlock()
+		if nonce == nil {
+			if err := n.refreshFetchNonce(ctx, client, addr); err != nil {
+				return nil, err
+			}
+			n.mu.Lock()
+			nonce = n.peerFetchNonce[addr]
+			n.mu.Unlock()
+		}
+		req.Proof = fetchChunkProof(secret, name, nonce)
+	}
+	stream, err := client.FetchChunk(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		}
+		data = append(data, frame.Data...)
+	}
+}
+
+// refreshFetchNonce health-checks the peer over the given client to
+// obtain a fresh fetch session nonce.
+func (n *Node) refreshFetchNonce(ctx context.Context, client pb.PeerClient, addr string) error {
+	resp, err := client.HealthCheck(ctx, &pb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	if len(resp.FetchNonce) > 0 {
+		n.peerFetchNonce[addr] = resp.FetchNonce
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// RestoreBackup restores backup id into destDir, reading from whichever
+// replica peers are reachable and falling back per chunk when one of
+// them is missing data. Files with chunks that fail authentication are
+// not written; restore continues with the rest and reports the failures
+// at the end. Every file is verified and the per-file outcomes are
+// saved as the backup's restore report; writeReport additionally saves
+// the report as a JSON file alongside destDir. The run is registered as
+// a job, so bbcli job pause/resume/cancel apply to it.
+func (n *Node) RestoreBackup(ctx context.Context, id, destDir string, writeReport bool) error {
+	job := &Job{Kind: "restore", BackupID: id, DestDir: destDir, WriteReport: writeReport}
+	return n.runJob(ctx, job, func(ctx context.Context) error {
+		return n.restoreBackup(ctx, job)
+	})
+}
+
+// restoreSession bundles what every restore output shares: the backup
+// record and raw manifest, the replica fetch with per-chunk fallback,
+// the prefetcher overlapping Tor round trips, and the cached seal keys.
+type restoreSession struct {
+	node     *Node
+	id       string
+	b        Backup
+	raw      []byte
+	pf       *prefetcher
+	sealKeys map[string]*chunkcrypto.BackupKey
+}
+
+func (n *Node) openRestoreSession(ctx context.Context, id string) (*restoreSession, error) {
+	s := &restoreSession{node: n, id: id, sealKeys: map[string]*chunkcrypto.BackupKey{}}
+	if err := n.sec.GetJSON(backupRecordKey(id), &s.b); err != nil {
+		return nil, fmt.Errorf("unknown backup %s: %w", id, err)
+	}
+	raw, err := n.sec.Get(manifestRecordKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("load manifest: %w", err)
+	}
+	s.raw = raw
+
+	var replicas []replica
+	for _, onion := range s.b.Peers {
+		cc, err := n.getConn(ctx, onion)
+		if err != nil {
+			continue // unreachable; the rest of the replicas cover it
+		}
+		replicas = append(replicas, replica{onion: onion, client: pb.NewPeerClient(cc)})
+	}
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("no replica peer of backup %s is reachable", id)
+	}
+	fetch := func(name string) ([]byte, error) {
+		if err := checkpoint(ctx); err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, r := range replicas {
+			data, err := n.fetchChunkData(ctx, r.client, r.onion, name)
+			if err != nil {
+				// Falling back to another replica only helps when the
+				// failure is on the peer's side.
+				if errors.Is(err, ErrNodeStopped) {
+					return nil, err
+				}
+				lastErr = err
+				continue
+			}
+			return data, nil
+		}
+		return nil, lastErr
+	}
+
+	// Collect the chunk names the writer will ask for, in manifest
+	// order, and run a prefetcher ahead of it: per-chunk round trips
+	// over Tor dominate a restore, so overlapping them is the win.
+	chunkNames, err := restoreChunkNames(raw, id)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(n.dataDir, "restore-staging-")
+	if err != nil {
+		return nil, fmt.Errorf("create restore staging dir: %w", err)
+	}
+	s.pf, err = newPrefetcher(fetch, chunkNames, staging, n.prefetchDepth, n.prefetchStaging)
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	return s, nil
+}
+
+// keyFor returns the seal key for sealerID, caching it for the rest of
+// the session; close zeroes the cache.
+func (s *restoreSession) keyFor(sealerID string) (*chunkcrypto.BackupKey, error) {
+	if key, ok := s.sealKeys[sealerID]; ok {
+		return key, nil
+	}
+	key, err := s.node.backupSealKey(sealerID)
+	if err != nil {
+		return nil, err
+	}
+	s.sealKeys[sealerID] = key
+	return key, nil
+}
+
+func (s *restoreSession) close() {
+	s.pf.close()
+	for _, key := range s.sealKeys {
+		key.Zero()
+	}
+}
+
+func (n *Node) restoreBackup(ctx context.Context, job *Job) error {
+	id, destDir := job.BackupID, job.DestDir
+	s, err := n.openRestoreSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	b := &s.b
+	mr, err := manifest.NewReader(bytes.NewReader(s.raw))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(destDir, 0o700); err != nil {
+		return fmt.Errorf("create destination: %w", err)
+	}
+
+	report := &RestoreReport{BackupID: id, DestDir: destDir, StartedAt: time.Now()}
+	n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesTotal = b.TotalBytes })
+	var failed []string
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		n.updateJobProgress(job.ID, func(p *JobProgress) { p.CurrentFile = e.Path })
+		if !safeRelPath(e.Path) {
+			failed = append(failed, e.Path)
+			report.add(e.Path, RestoreFileSkipped, "path escapes the destination")
+			continue
+		}
+		path := filepath.Join(destDir, filepath.FromSlash(e.Path))
+		mode := os.FileMode(e.Mode)
+		isFile := false
+		switch {
+		case mode.IsDir():
+			if err = os.MkdirAll(path, mode.Perm()); err != nil {
+				err = &restoreFailure{result: RestoreFilePermission, err: err}
+			}
+		case mode&os.ModeSymlink != 0:
+			if err = os.Symlink(e.SymlinkTarget, path); err != nil {
+				err = &restoreFailure{result: RestoreFilePermission, err: err}
+			}
+		case e.HardlinkTo != "":
+			err = restoreHardlink(destDir, e, path)
+		default:
+			isFile = true
+			err = n.restoreFile(s.pf.next, s.keyFor, id, e, path)
+		}
+		switch {
+		case err != nil:
+			failed = append(failed, e.Path)
+			result, detail := classifyRestoreError(err)
+			report.add(e.Path, result, detail)
+		case isFile:
+			// Directories and symlinks have nothing to verify; only
+			// files enter the report as ok.
+			report.add(e.Path, RestoreFileOK, "")
+			report.BytesVerified += e.Size
+			n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesDone += e.Size })
+		}
+	}
+	report.FinishedAt = time.Now()
+	job.RestoredOK = report.FilesOK
+	job.RestoredFailed = report.FilesFailed
+	job.RestoredSkipped = report.FilesSkipped
+	job.VerifiedBytes = report.BytesVerified
+	if err := n.sec.PutJSON(restoreReportKey(id), report); err != nil {
+		log.Printf("save restore report for %s: %v", id, err)
+	}
+	if job.WriteReport {
+		if err := writeRestoreReportFile(destDir, report); err != nil {
+			log.Printf("write restore report for %s: %v", id, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("restore incomplete: %d of %d entries failed, e.g. %s",
+			len(failed), b.FileCount, failed[0])
+	}
+	return nil
+}
+
+// restoreChunkNames lists, in manifest order, the chunk blob names a
+// restore of the manifest will fetch: the chunks of every regular file
+// entry the writer would attempt. Hardlinks, symlinks, directories, and
+// unsafe paths fetch nothing.
+func restoreChunkNames(rawManifest []byte, backupID string) ([]string, error) {
+	mr, err := manifest.NewReader(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			return names, nil
+		} else if err != nil {
+			return nil, err
+		}
+		mode := os.FileMode(e.Mode)
+		if !safeRelPath(e.Path) || mode.IsDir() || mode&os.ModeSymlink != 0 || e.HardlinkTo != "" {
+			continue
+		}
+		for _, ref := range e.Chunks {
+			sealerID := ref.BackupId
+			if sealerID == "" {
+				sealerID = backupID
+			}
+			names = append(names, chunkBlobName(sealerID, ref.Hash))
+		}
+	}
+}
+
+// writeRestoreReportFile saves the report as JSON next to the restore
+// destination, not inside it, so the restored tree stays exactly what
+// the backup contained.
+func writeRestoreReportFile(destDir string, report *RestoreReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Clean(destDir)+".restore-report.json", append(data, '\n'), 0o600)
+}
+
+// safeRelPath rejects manifest paths that would escape the destination.
+func safeRelPath(path string) bool {
+	if path == "" || strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == ".." || part == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreHardlink re-links a hardlink group member to its already
+// restored representative (manifest order put the representative
+// first), falling back to a plain copy on filesystems that refuse the
+// link.
+func restoreHardlink(destDir string, e *manifestpb.FileEntry, path string) error {
+	if !safeRelPath(e.HardlinkTo) {
+		return &restoreFailure{result: RestoreFileSkipped,
+			err: fmt.Errorf("hardlink target %s escapes the destination", e.HardlinkTo)}
+	}
+	target := filepath.Join(destDir, filepath.FromSlash(e.HardlinkTo))
+	if err := os.Link(target, path); err == nil {
+		return nil
+	} else if _, statErr := os.Stat(target); statErr != nil {
+		// The representative itself was not restored.
+		return &restoreFailure{result: RestoreFileMissingChunks,
+			err: fmt.Errorf("hardlink target %s was not restored: %w", e.HardlinkTo, err)}
+	}
+	src, err := os.Open(target)
+	if err != nil {
+		return &restoreFailure{result: RestoreFilePermission, err: err}
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(e.Mode).Perm())
+	if err != nil {
+		return &restoreFailure{result: RestoreFilePermission, err: err}
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return &restoreFailure{result: RestoreFilePermission, err: err}
+	}
+	if err := dst.Close(); err != nil {
+		return &restoreFailure{result: RestoreFilePermission, err: err}
+	}
+	return nil
+}
+
+// restoreFile rebuilds one file next to its final name and renames it
+// into place only after every chunk authenticated and the whole-file
+// hash matched.
+func (n *Node) restoreFile(fetch func(string) ([]byte, error), keyFor func(string) (*chunkcrypto.BackupKey, error), backupID string, e *manifestpb.FileEntry, path string) error {
+	tmp := path + restoreTmpSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return &restoreFailure{result: RestoreFilePermission, err: err}
+	}
+	fail := func(result string, err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return &restoreFailure{result: result, err: err}
+	}
+	fileHash := sha256.New()
+	var pos int64
+	for _, ref := range e.Chunks {
+		sealerID := ref.BackupId
+		if sealerID == "" {
+			sealerID = backupID
+		}
+		key, err := keyFor(sealerID)
+		if err != nil {
+			return fail(RestoreFileError, err)
+		}
+		data, err := fetch(chunkBlobName(sealerID, ref.Hash))
+		if err != nil {
+			return fail(RestoreFileMissingChunks, fmt.Errorf("fetch chunk %s: %w", ref.Hash, err))
+		}
+		plain, index, err := chunkcrypto.Open(data, key)
+		if err != nil {
+			n.reportAudit(false)
+			return fail(RestoreFileHashMismatch, fmt.Errorf("open chunk %s: %w", ref.Hash, err))
+		}
+		if index != ref.Index || int64(len(plain)) != ref.Size {
+			n.reportAudit(false)
+			return fail(RestoreFileHashMismatch, fmt.Errorf("chunk %s does not match its manifest entry", ref.Hash))
+		}
+		ok, err := hashid.Matches(ref.Hash, plain)
+		if err != nil {
+			// An unknown algorithm id is not corruption: the chunk may be
+			// fine, this binary just cannot verify it.
+			return fail(RestoreFileError, fmt.Errorf("chunk %s: %w", ref.Hash, err))
+		}
+		if !ok {
+			n.reportAudit(false)
+			return fail(RestoreFileHashMismatch, fmt.Errorf("chunk %s content hash mismatch", ref.Hash))
+		}
+		n.reportAudit(true)
+		// A gap before this chunk is a hole of a sparse file: it hashes
+		// as zeros and stays unwritten, so the hole comes back as one.
+		hashZeros(fileHash, ref.Offset-pos)
+		fileHash.Write(plain)
+		if _, err := f.WriteAt(plain, ref.Offset); err != nil {
+			return fail(RestoreFilePermission, err)
+		}
+		pos = ref.Offset + int64(len(plain))
+	}
+	hashZeros(fileHash, e.Size-pos)
+	if err := f.Truncate(e.Size); err != nil {
+		return fail(RestoreFilePermission, err)
+	}
+	if len(e.FileHash) > 0 && !bytes.Equal(fileHash.Sum(nil), e.FileHash) {
+		// Every chunk authenticated but the reassembled file does not
+		// match the manifest. Quarantine it under a name nothing will
+		// mistake for the real file instead of leaving it looking
+		// valid — the pieces may still be worth salvaging.
+		f.Close()
+		quarantine := path + ".corrupt"
+		if err := os.Rename(tmp, quarantine); err != nil {
+			os.Remove(tmp)
+			quarantine = "nothing (quarantine failed: " + err.Error() + ")"
+		}
+		return &restoreFailure{
+			result: RestoreFileHashMismatch,
+			err:    fmt.Errorf("file hash mismatch for %s; kept as %s", e.Path, quarantine),
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fail(RestoreFilePermission, err)
+	}
+	if err := os.Chmod(tmp, os.FileMode(e.Mode).Perm()); err != nil {
+		return fail(RestoreFilePermission, err)
+	}
+	mtime := time.Unix(e.MtimeUnix, int64(e.MtimeNsec))
+	if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+		return fail(RestoreFilePermission, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fail(RestoreFilePermission, err)
+	}
+	return nil
+}
+
+// PeerReplication is the live replication health of one backup replica.
+type PeerReplication struct {
+	Peer string
+	// State is "complete", "manifest missing", "N chunks missing", or
+	// "unreachable".
+	State string
+	// MissingChunks is how many of the backup's chunks the peer lacks.
+	MissingChunks int
+}
+
+// BackupStatus checks every replica peer for the backup's manifest and
+// chunks and reports per-peer health.
+func (n *Node) BackupStatus(ctx context.Context, id string) ([]PeerReplication, error) {
+	var b Backup
+	if err := n.sec.GetJSON(backupRecordKey(id), &b); err != nil {
+		return nil, fmt.Errorf("unknown backup %s: %w", id, err)
+	}
+	raw, err := n.sec.Get(manifestRecordKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("load manifest: %w", err)
+	}
+	mr, err := manifest.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for _, ref := range e.Chunks {
+			sealerID := ref.BackupId
+			if sealerID == "" {
+				sealerID = id
+			}
+			names[chunkBlobName(sealerID, ref.Hash)] = true
+		}
+	}
+
+	var out []PeerReplication
+	for _, onion := range b.Peers {
+		r := PeerReplication{Peer: onion}
+		cc, err := n.getConn(ctx, onion)
+		if err != nil {
+			r.State = "unreachable"
+			out = append(out, r)
+			continue
+		}
+		client := pb.NewPeerClient(cc)
+		for name := range names {
+			has, err := client.HasChunk(ctx, &pb.HasChunkRequest{Name: name})
+			if err != nil {
+				r.State = "unreachable"
+				break
+			}
+			if !has.Present {
+				r.MissingChunks++
+			}
+		}
+		if r.State == "" {
+			manifestOK, err := client.HasChunk(ctx, &pb.HasChunkRequest{Name: manifestBlobPrefix + id})
+			switch {
+			case err != nil:
+				r.State = "unreachable"
+			case !manifestOK.Present:
+				r.State = "manifest missing"
+			case r.MissingChunks > 0:
+				r.State = fmt.Sprintf("%d chunks missing", r.MissingChunks)
+			default:
+				r.State = "complete"
+			}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
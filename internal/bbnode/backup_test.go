@@ -0,0 +1,484 @@
+package bbnode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func writeFile(t *testing.T, dir, rel, content string) {
+	t.Helper()
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, dir, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, rel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBackupRestoreIncremental(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "notes.txt", "remember the milk")
+	writeFile(t, source, "sub/big.bin", string(make([]byte, 3*chunkSize+100)))
+	if err := os.Symlink("notes.txt", filepath.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	if first.BaseID != "" {
+		t.Errorf("first backup has base %q, want none", first.BaseID)
+	}
+	if first.UploadedBytes == 0 {
+		t.Error("first backup uploaded nothing")
+	}
+
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, first.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if got := readFile(t, dest, "notes.txt"); got != "remember the milk" {
+		t.Errorf("notes.txt = %q", got)
+	}
+	if got := readFile(t, dest, "sub/big.bin"); len(got) != 3*chunkSize+100 {
+		t.Errorf("big.bin size = %d", len(got))
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "link")); err != nil || target != "notes.txt" {
+		t.Errorf("link -> %q, %v", target, err)
+	}
+
+	// An incremental run re-uploads only the changed file.
+	writeFile(t, source, "notes.txt", "remember the milk and eggs")
+	second, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("incremental CreateBackup: %v", err)
+	}
+	if second.BaseID != first.ID {
+		t.Errorf("second backup base = %q, want %q", second.BaseID, first.ID)
+	}
+	if second.UploadedBytes >= first.UploadedBytes {
+		t.Errorf("incremental uploaded %d bytes, full run uploaded %d",
+			second.UploadedBytes, first.UploadedBytes)
+	}
+
+	dest2 := t.TempDir()
+	if err := a.RestoreBackup(ctx, second.ID, dest2, false); err != nil {
+		t.Fatalf("RestoreBackup incremental: %v", err)
+	}
+	if got := readFile(t, dest2, "notes.txt"); got != "remember the milk and eggs" {
+		t.Errorf("notes.txt after incremental = %q", got)
+	}
+
+	changes, err := a.DiffBackups(first.ID, second.ID)
+	if err != nil {
+		t.Fatalf("DiffBackups: %v", err)
+	}
+	if len(changes.Modified) != 1 || changes.Modified[0].Path != "notes.txt" {
+		t.Errorf("Modified = %v", changes.Modified)
+	}
+	if len(changes.Added) != 0 || len(changes.Deleted) != 0 {
+		t.Errorf("Added = %v, Deleted = %v", changes.Added, changes.Deleted)
+	}
+}
+
+func TestBackupPatterns(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "keep.txt", "keep")
+	writeFile(t, source, "scratch.tmp", "scratch")
+	writeFile(t, source, "sub/deep/also.tmp", "scratch")
+	writeFile(t, source, "sub/deep/data.bin", "data")
+	writeFile(t, source, ".cache/a/b/blob", "cached")
+	outside := t.TempDir()
+	writeFile(t, outside, "huge.tmp", "outside the source tree")
+	if err := os.Symlink(outside, filepath.Join(source, "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+	exclude := []string{".cache/**", "*.tmp"}
+
+	// A pattern typo fails up front, before any peer is contacted.
+	if _, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{Exclude: []string{"[oops"}}); err == nil {
+		t.Fatal("CreateBackup with a malformed pattern succeeded")
+	}
+
+	// A dry run reports the selection without touching any peer.
+	planned, total, err := a.PlanBackup(source, BackupOptions{Exclude: exclude})
+	if err != nil {
+		t.Fatalf("PlanBackup: %v", err)
+	}
+	var paths []string
+	for _, f := range planned {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"dirlink", "keep.txt", "sub/deep/data.bin"}
+	if len(paths) != len(want) {
+		t.Fatalf("planned %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("planned %v, want %v", paths, want)
+		}
+	}
+	if total != int64(len("keep")+len("data")) {
+		t.Errorf("planned bytes = %d", total)
+	}
+	if onlyBin, _, err := a.PlanBackup(source, BackupOptions{Include: []string{"**/*.bin"}}); err != nil ||
+		len(onlyBin) != 1 || onlyBin[0].Path != "sub/deep/data.bin" {
+		t.Errorf("PlanBackup with include = %v, %v", onlyBin, err)
+	}
+
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{Exclude: exclude})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, backup.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if got := readFile(t, dest, "keep.txt"); got != "keep" {
+		t.Errorf("keep.txt = %q", got)
+	}
+	if got := readFile(t, dest, "sub/deep/data.bin"); got != "data" {
+		t.Errorf("data.bin = %q", got)
+	}
+	for _, rel := range []string{"scratch.tmp", "sub/deep/also.tmp", ".cache/a"} {
+		if _, err := os.Lstat(filepath.Join(dest, rel)); !os.IsNotExist(err) {
+			t.Errorf("excluded %s was restored (%v)", rel, err)
+		}
+	}
+	// The symlinked directory comes back as a symlink; the walk never
+	// followed it into the tree it points at.
+	if target, err := os.Readlink(filepath.Join(dest, "dirlink")); err != nil || target != outside {
+		t.Errorf("dirlink -> %q, %v", target, err)
+	}
+
+	// An incremental run given no patterns keeps the base backup's.
+	writeFile(t, source, "another.tmp", "more scratch")
+	second, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("incremental CreateBackup: %v", err)
+	}
+	if second.BaseID != backup.ID {
+		t.Errorf("second backup base = %q, want %q", second.BaseID, backup.ID)
+	}
+	dest2 := t.TempDir()
+	if err := a.RestoreBackup(ctx, second.ID, dest2, false); err != nil {
+		t.Fatalf("RestoreBackup incremental: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest2, "another.tmp")); !os.IsNotExist(err) {
+		t.Error("incremental run did not inherit the exclude patterns")
+	}
+}
+
+func TestBackupHardlinks(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	content := string(make([]byte, 2*chunkSize))
+	writeFile(t, source, "orig.bin", content)
+	if err := os.Link(filepath.Join(source, "orig.bin"), filepath.Join(source, "alias.bin")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, source, "other.txt", "unrelated")
+
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	// Both names count, but the content was stored once.
+	if backup.TotalBytes != 2*int64(len(content))+int64(len("unrelated")) {
+		t.Errorf("TotalBytes = %d", backup.TotalBytes)
+	}
+
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, backup.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if got := readFile(t, dest, "alias.bin"); got != content {
+		t.Errorf("alias.bin has %d bytes, want %d", len(got), len(content))
+	}
+	fi1, err := os.Stat(filepath.Join(dest, "orig.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(filepath.Join(dest, "alias.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(fi1, fi2) {
+		t.Error("restored orig.bin and alias.bin are separate files, want one inode")
+	}
+}
+
+func TestBackupFollowSymlinks(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "here.txt", "in the tree")
+	outside := t.TempDir()
+	writeFile(t, outside, "sub/there.txt", "behind a link")
+	if err := os.Symlink(outside, filepath.Join(source, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "sub/there.txt"), filepath.Join(source, "filelink")); err != nil {
+		t.Fatal(err)
+	}
+	// A link back to the source itself must not loop the walk.
+	if err := os.Symlink(source, filepath.Join(source, "self")); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source,
+		BackupOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, backup.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	// The linked directory and file came back as real ones.
+	if got := readFile(t, dest, "linked/sub/there.txt"); got != "behind a link" {
+		t.Errorf("linked/sub/there.txt = %q", got)
+	}
+	fi, err := os.Lstat(filepath.Join(dest, "filelink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.Mode().IsRegular() {
+		t.Errorf("filelink mode = %v, want a regular file", fi.Mode())
+	}
+	if got := readFile(t, dest, "filelink"); got != "behind a link" {
+		t.Errorf("filelink = %q", got)
+	}
+}
+
+func TestReplicatedBackup(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	c := startTestNode(t, network, "password-c")
+	for _, peer := range []*Node{b, c} {
+		if err := a.AddPeer(peer.Address(), ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := peer.AddPeer(a.Address(), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.CreateGroup("friends", []string{b.Address(), c.Address()}); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "doc.txt", "replicate me")
+	backup, err := a.CreateBackup(ctx, []string{"friends"}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	if len(backup.Peers) != 2 {
+		t.Fatalf("backup.Peers = %v, want both group members", backup.Peers)
+	}
+	for _, onion := range backup.Peers {
+		if got := backup.Replication[onion]; got != "complete" {
+			t.Errorf("replication to %s = %q, want complete", onion, got)
+		}
+	}
+
+	status, err := a.BackupStatus(ctx, backup.ID)
+	if err != nil {
+		t.Fatalf("BackupStatus: %v", err)
+	}
+	for _, r := range status {
+		if r.State != "complete" {
+			t.Errorf("status of %s = %q, want complete", r.Peer, r.State)
+		}
+	}
+
+	// One replica disappearing must not block restore.
+	if err := b.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, backup.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup with one replica down: %v", err)
+	}
+	if got := readFile(t, dest, "doc.txt"); got != "replicate me" {
+		t.Errorf("doc.txt = %q", got)
+	}
+}
+
+func TestRepairBackup(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	c := startTestNode(t, network, "password-c")
+	for _, peer := range []*Node{b, c} {
+		if err := a.AddPeer(peer.Address(), ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := peer.AddPeer(a.Address(), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "data.bin", string(make([]byte, 2*chunkSize+50)))
+	backup, err := a.CreateBackup(ctx, []string{b.Address(), c.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	names, err := b.chunks.List(a.Address(), "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var chunkNames []string
+	for _, name := range names {
+		if name != manifestBlobPrefix+backup.ID {
+			chunkNames = append(chunkNames, name)
+		}
+	}
+	if len(chunkNames) < 2 {
+		t.Fatalf("only %d chunk blobs on b", len(chunkNames))
+	}
+
+	// Lose one chunk on b: repaired by re-sealing local source data.
+	if err := b.chunks.Delete(a.Address(), chunkNames[0]); err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.RepairBackup(ctx, backup.ID, b.Address())
+	if err != nil {
+		t.Fatalf("RepairBackup: %v", err)
+	}
+	if res.Missing != 1 || res.Repaired != 1 || len(res.Unrepaired) != 0 {
+		t.Errorf("repair from source: %+v", res)
+	}
+
+	// Lose another chunk after the source changed: repaired by fetching
+	// the envelope from the other replica.
+	writeFile(t, source, "data.bin", "different content now")
+	if err := b.chunks.Delete(a.Address(), chunkNames[1]); err != nil {
+		t.Fatal(err)
+	}
+	res, err = a.RepairBackup(ctx, backup.ID, b.Address())
+	if err != nil {
+		t.Fatalf("RepairBackup from replica: %v", err)
+	}
+	if res.Missing != 1 || res.Repaired != 1 || len(res.Unrepaired) != 0 {
+		t.Errorf("repair from replica: %+v", res)
+	}
+
+	status, err := a.BackupStatus(ctx, backup.ID)
+	if err != nil {
+		t.Fatalf("BackupStatus: %v", err)
+	}
+	for _, r := range status {
+		if r.State != "complete" {
+			t.Errorf("status of %s after repair = %q", r.Peer, r.State)
+		}
+	}
+
+	// With the source changed and no other copy, the chunk is reported
+	// as unrepairable.
+	if err := b.chunks.Delete(a.Address(), chunkNames[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.chunks.Delete(a.Address(), chunkNames[1]); err != nil {
+		t.Fatal(err)
+	}
+	res, err = a.RepairBackup(ctx, backup.ID, b.Address())
+	if err != nil {
+		t.Fatalf("RepairBackup unrepairable: %v", err)
+	}
+	if len(res.Unrepaired) != 1 || res.Unrepaired[0] != chunkNames[1] {
+		t.Errorf("Unrepaired = %v, want [%s]", res.Unrepaired, chunkNames[1])
+	}
+}
+
+func TestRecoverFromPeer(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "precious.txt", "the only copy")
+	backup, err := a.CreateBackup(ctx, []string{"bob"}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	// Disaster: a's disk dies. A fresh node with the same password (and
+	// so the same identity) recovers the index from b.
+	if err := a.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	a2 := startTestNode(t, network, "password-a")
+
+	recovered, err := a2.RecoverFromPeer(ctx, b.Address())
+	if err != nil {
+		t.Fatalf("RecoverFromPeer: %v", err)
+	}
+	if len(recovered) != 1 || recovered[0].ID != backup.ID {
+		t.Fatalf("recovered = %+v, want backup %s", recovered, backup.ID)
+	}
+	if recovered[0].SourceDir != backup.SourceDir || recovered[0].FileCount != backup.FileCount {
+		t.Errorf("recovered record %+v does not match original %+v", recovered[0], backup)
+	}
+
+	dest := t.TempDir()
+	if err := a2.RestoreBackup(ctx, backup.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup after recovery: %v", err)
+	}
+	if got := readFile(t, dest, "precious.txt"); got != "the only copy" {
+		t.Errorf("precious.txt = %q", got)
+	}
+
+	// Recovery is idempotent.
+	again, err := a2.RecoverFromPeer(ctx, b.Address())
+	if err != nil {
+		t.Fatalf("second RecoverFromPeer: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second recovery returned %d backups, want 0", len(again))
+	}
+}
@@ -0,0 +1,70 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSourceNotAllowed reports a backup source outside the configured
+// backup roots. The daemon maps it to PermissionDenied.
+var ErrSourceNotAllowed = errors.New("source path is outside the allowed backup roots")
+
+// BackupRoots reports the configured backup root allow-list, empty when
+// any readable path may be backed up.
+func (n *Node) BackupRoots() []string {
+	return n.backupRoots
+}
+
+// checkBackupRoot canonicalizes abs — resolving symlinks, so a link
+// into a forbidden tree cannot smuggle it past the check — and verifies
+// it lies inside one of the configured roots. With no roots configured
+// every path passes. The canonical path is returned so the walk reads
+// the tree the check approved.
+func (n *Node) checkBackupRoot(abs string) (string, error) {
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("resolve source dir: %w", err)
+	}
+	if len(n.backupRoots) == 0 {
+		return real, nil
+	}
+	if n.sourceAllowed(real) {
+		return real, nil
+	}
+	return "", fmt.Errorf("%w: %s (allowed: %s)",
+		ErrSourceNotAllowed, real, strings.Join(n.backupRoots, ", "))
+}
+
+// sourceAllowFunc returns the walk containment check, or nil when no
+// roots are configured so the walk skips the extra resolution work.
+func (n *Node) sourceAllowFunc() func(real string) bool {
+	if len(n.backupRoots) == 0 {
+		return nil
+	}
+	return n.sourceAllowed
+}
+
+// sourceAllowed reports whether the canonical path real lies inside one
+// of the configured backup roots. Roots are resolved at call time, not
+// at startup, so a root that is a mount point may appear later.
+func (n *Node) sourceAllowed(real string) bool {
+	if len(n.backupRoots) == 0 {
+		return true
+	}
+	for _, root := range n.backupRoots {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(realRoot, real)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../")) {
+			return true
+		}
+	}
+	return false
+}
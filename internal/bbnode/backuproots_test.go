@@ -0,0 +1,86 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupRootsEnforced(t *testing.T) {
+	a, b := startPairedNodes(t)
+	root := t.TempDir()
+	a.backupRoots = []string{root}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inside := filepath.Join(root, "docs")
+	writeFile(t, inside, "notes.txt", "allowed")
+	if _, err := a.CreateBackup(ctx, []string{b.Address()}, inside, BackupOptions{}); err != nil {
+		t.Fatalf("CreateBackup inside the root: %v", err)
+	}
+
+	outside := t.TempDir()
+	writeFile(t, outside, "secret.txt", "forbidden")
+	if _, err := a.CreateBackup(ctx, []string{b.Address()}, outside, BackupOptions{}); !errors.Is(err, ErrSourceNotAllowed) {
+		t.Errorf("CreateBackup outside the roots: %v, want ErrSourceNotAllowed", err)
+	}
+	if _, _, err := a.PlanBackup(outside, BackupOptions{}); !errors.Is(err, ErrSourceNotAllowed) {
+		t.Errorf("PlanBackup outside the roots: %v, want ErrSourceNotAllowed", err)
+	}
+
+	// A `..` escape is cleaned away before the check.
+	dotdot := filepath.Join(inside, "..", "..", filepath.Base(outside))
+	if _, _, err := a.PlanBackup(dotdot, BackupOptions{}); !errors.Is(err, ErrSourceNotAllowed) {
+		t.Errorf("PlanBackup via ..: %v, want ErrSourceNotAllowed", err)
+	}
+
+	// A symlink into a forbidden tree does not launder the path.
+	link := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.PlanBackup(link, BackupOptions{}); !errors.Is(err, ErrSourceNotAllowed) {
+		t.Errorf("PlanBackup via symlink: %v, want ErrSourceNotAllowed", err)
+	}
+}
+
+func TestBackupRootsContainWalk(t *testing.T) {
+	a, _ := startPairedNodes(t)
+	root := t.TempDir()
+	a.backupRoots = []string{root}
+
+	source := filepath.Join(root, "docs")
+	writeFile(t, source, "notes.txt", "allowed")
+	outside := t.TempDir()
+	writeFile(t, outside, "secret.txt", "forbidden")
+	if err := os.Symlink(outside, filepath.Join(source, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	// With follow on, the escaping link stays a link: its target's
+	// content is not planned.
+	planned, _, err := a.PlanBackup(source, BackupOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("PlanBackup: %v", err)
+	}
+	for _, f := range planned {
+		if f.Path == "escape/secret.txt" {
+			t.Error("walk followed a symlink out of the backup roots")
+		}
+	}
+
+	// A link staying inside the roots is still followed.
+	if err := os.Symlink(source, filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	planned, _, err = a.PlanBackup(filepath.Join(root, "alias"), BackupOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("PlanBackup alias: %v", err)
+	}
+	if len(planned) == 0 {
+		t.Error("nothing planned through an in-root symlink")
+	}
+}
@@ -0,0 +1,205 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/manifest"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Backup deletion is two-phase: DeleteBackup only marks the record, and
+// the manifest and remote chunks survive for BackupTrashDays so a wrong
+// bbcli backup delete costs nothing. UndeleteBackup inside the window
+// brings the backup back exactly as it was; after the window the trash
+// sweep purges the chunks no surviving backup references.
+
+// DeleteBackup moves the backup into the deletion grace period and
+// returns when the trash sweep will purge it.
+func (n *Node) DeleteBackup(id string) (time.Time, error) {
+	var b Backup
+	err := n.sec.GetJSON(backupRecordKey(id), &b)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return time.Time{}, fmt.Errorf("no backup %s", id)
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	if !b.DeletedAt.IsZero() {
+		return time.Time{}, fmt.Errorf("backup %s is already deleted", id)
+	}
+	b.DeletedAt = time.Now()
+	if err := n.sec.PutJSON(backupRecordKey(id), &b); err != nil {
+		return time.Time{}, err
+	}
+	purgeAt := b.DeletedAt.Add(n.backupTrashWindow())
+	n.auditEvent("backup_trashed", map[string]string{
+		"backup":   id,
+		"purge_at": purgeAt.UTC().Format(time.RFC3339),
+	})
+	return purgeAt, nil
+}
+
+// UndeleteBackup rescues a backup from the deletion grace period. After
+// the sweep purged it the record is gone and there is nothing to rescue.
+func (n *Node) UndeleteBackup(id string) error {
+	var b Backup
+	err := n.sec.GetJSON(backupRecordKey(id), &b)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return fmt.Errorf("no backup %s (already purged?)", id)
+	} else if err != nil {
+		return err
+	}
+	if b.DeletedAt.IsZero() {
+		return fmt.Errorf("backup %s is not deleted", id)
+	}
+	b.DeletedAt = time.Time{}
+	if err := n.sec.PutJSON(backupRecordKey(id), &b); err != nil {
+		return err
+	}
+	n.auditEvent("backup_undeleted", map[string]string{"backup": id})
+	return nil
+}
+
+// backupTrashWindow is the configured grace period as a duration.
+func (n *Node) backupTrashWindow() time.Duration {
+	return time.Duration(n.RetentionConfig().BackupTrashDays) * 24 * time.Hour
+}
+
+// backupTrashSweep purges deleted backups whose grace period ran out.
+// A purge that fails (an unreachable replica, usually) is retried on
+// the next sweep and does not hold up other backups.
+func (n *Node) backupTrashSweep(ctx context.Context) error {
+	list, err := n.ListBackups()
+	if err != nil {
+		return err
+	}
+	window := n.backupTrashWindow()
+	now := time.Now()
+	for i := range list {
+		b := &list[i]
+		if b.DeletedAt.IsZero() || now.Before(b.DeletedAt.Add(window)) {
+			continue
+		}
+		if err := n.purgeBackup(ctx, b, list); err != nil {
+			log.Printf("purge backup %s: %v", b.ID, err)
+		}
+	}
+	return nil
+}
+
+// purgeBackup deletes the backup's blobs from its replica peers and
+// drops the local record. Only chunks no other backup references are
+// deleted: an incremental built on the purged backup keeps the chunks
+// it reuses, so it stays restorable.
+func (n *Node) purgeBackup(ctx context.Context, b *Backup, all []Backup) error {
+	doomed, err := n.backupChunkNames(b.ID)
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		o := &all[i]
+		if o.ID == b.ID {
+			continue
+		}
+		names, err := n.backupChunkNames(o.ID)
+		if err != nil {
+			// Without the other manifest the reference count is unknown;
+			// keeping the chunks is the safe side.
+			return fmt.Errorf("load manifest of %s: %w", o.ID, err)
+		}
+		for name := range names {
+			delete(doomed, name)
+		}
+	}
+	// The manifest blob is per-backup and always dies with it.
+	doomed[manifestBlobPrefix+b.ID] = true
+	names := make([]string, 0, len(doomed))
+	for name := range doomed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, onion := range b.Peers {
+		if _, err := n.findPeer(onion); err != nil {
+			// The peer was removed; whatever it still holds is beyond
+			// our reach.
+			continue
+		}
+		if !n.PeerSupports(onion, bbrpc.FeatureDeleteChunks) {
+			// An old peer keeps the blobs until its own retention
+			// lapses; the purge still completes locally.
+			log.Printf("purge backup %s: peer %s does not support chunk deletion", b.ID, onion)
+			continue
+		}
+		if err := n.deletePeerBlobs(ctx, onion, names); err != nil {
+			return err
+		}
+	}
+	if err := n.sec.Delete(manifestRecordKey(b.ID)); err != nil && !errors.Is(err, secstore.ErrNotFound) {
+		return err
+	}
+	if err := n.sec.Delete(backupRecordKey(b.ID)); err != nil {
+		return err
+	}
+	n.auditEvent("backup_purged", map[string]string{
+		"backup": b.ID,
+		"blobs":  fmt.Sprint(len(names)),
+	})
+	return nil
+}
+
+// backupChunkNames returns the set of chunk blob names the backup's
+// manifest references, including chunks reused from an earlier backup.
+func (n *Node) backupChunkNames(id string) (map[string]bool, error) {
+	raw, err := n.sec.Get(manifestRecordKey(id))
+	if err != nil {
+		return nil, err
+	}
+	mr, err := manifest.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			return names, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for _, ref := range e.Chunks {
+			sealerID := ref.BackupId
+			if sealerID == "" {
+				sealerID = id
+			}
+			names[chunkBlobName(sealerID, ref.Hash)] = true
+		}
+	}
+}
+
+// deletePeerBlobs runs DeleteChunks against one peer in batches.
+func (n *Node) deletePeerBlobs(ctx context.Context, onion string, names []string) error {
+	for len(names) > 0 {
+		m := len(names)
+		if m > bbrpc.HasChunksBatch {
+			m = bbrpc.HasChunksBatch
+		}
+		batch := names[:m]
+		names = names[m:]
+		err := n.callPeer(ctx, onion, 0, func(ctx context.Context, client pb.PeerClient) error {
+			_, err := client.DeleteChunks(ctx, &pb.DeleteChunksRequest{Names: batch})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("delete chunks on %s: %w", onion, err)
+		}
+	}
+	return nil
+}
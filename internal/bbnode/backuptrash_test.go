@@ -0,0 +1,163 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/internal/netmock"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// backdateDeletion rewrites the backup record on n so its grace period
+// has already run out.
+func backdateDeletion(t *testing.T, n *Node, id string, by time.Duration) {
+	t.Helper()
+	var b Backup
+	if err := n.sec.GetJSON(backupRecordKey(id), &b); err != nil {
+		t.Fatalf("load backup record: %v", err)
+	}
+	b.DeletedAt = time.Now().Add(-by)
+	if err := n.sec.PutJSON(backupRecordKey(id), &b); err != nil {
+		t.Fatalf("store backup record: %v", err)
+	}
+}
+
+func TestDeleteUndeleteBackup(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "data.bin", string(make([]byte, 2*chunkSize)))
+	first, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	purgeAt, err := a.DeleteBackup(first.ID)
+	if err != nil {
+		t.Fatalf("DeleteBackup: %v", err)
+	}
+	if !purgeAt.After(time.Now().Add(13 * 24 * time.Hour)) {
+		t.Errorf("purge time %v sooner than the default grace period", purgeAt)
+	}
+	if _, err := a.DeleteBackup(first.ID); err == nil || !strings.Contains(err.Error(), "already deleted") {
+		t.Errorf("second DeleteBackup: %v, want already-deleted error", err)
+	}
+	// Nothing is removed yet: the manifest blob is still on the peer and
+	// the backup still restores.
+	if !b.chunks.Has(a.Address(), manifestBlobPrefix+first.ID) {
+		t.Error("manifest blob deleted before the grace period ran out")
+	}
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, first.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup of trashed backup: %v", err)
+	}
+
+	// A deleted backup is no incremental base: the next run is full.
+	second, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("second CreateBackup: %v", err)
+	}
+	if second.BaseID != "" {
+		t.Errorf("second backup base = %q, want full backup", second.BaseID)
+	}
+
+	if err := a.UndeleteBackup(first.ID); err != nil {
+		t.Fatalf("UndeleteBackup: %v", err)
+	}
+	if err := a.UndeleteBackup(first.ID); err == nil || !strings.Contains(err.Error(), "not deleted") {
+		t.Errorf("second UndeleteBackup: %v, want not-deleted error", err)
+	}
+	var rec Backup
+	if err := a.sec.GetJSON(backupRecordKey(first.ID), &rec); err != nil {
+		t.Fatalf("load backup record: %v", err)
+	}
+	if !rec.DeletedAt.IsZero() {
+		t.Errorf("DeletedAt after undelete = %v, want zero", rec.DeletedAt)
+	}
+}
+
+func TestBackupTrashSweepPurges(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	a.recordPeerCaps(b.Address(), bbrpc.ProtocolVersion, bbrpc.LocalFeatures)
+
+	source := t.TempDir()
+	writeFile(t, source, "keep.bin", string(make([]byte, 2*chunkSize)))
+	writeFile(t, source, "change.bin", strings.Repeat("v1", chunkSize))
+	first, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	// The incremental reuses first's chunks for the unchanged file; the
+	// old version of the changed file stays unique to first.
+	writeFile(t, source, "change.bin", strings.Repeat("v2", chunkSize))
+	second, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("incremental CreateBackup: %v", err)
+	}
+	if second.BaseID != first.ID {
+		t.Fatalf("second backup base = %q, want %q", second.BaseID, first.ID)
+	}
+
+	if _, err := a.DeleteBackup(first.ID); err != nil {
+		t.Fatalf("DeleteBackup: %v", err)
+	}
+	before, err := b.chunks.List(a.Address(), "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	backdateDeletion(t, a, first.ID, 15*24*time.Hour)
+	if err := a.backupTrashSweep(ctx); err != nil {
+		t.Fatalf("backupTrashSweep: %v", err)
+	}
+
+	var gone Backup
+	if err := a.sec.GetJSON(backupRecordKey(first.ID), &gone); !errors.Is(err, secstore.ErrNotFound) {
+		t.Errorf("backup record after purge: %v, want not found", err)
+	}
+	if _, err := a.sec.Get(manifestRecordKey(first.ID)); !errors.Is(err, secstore.ErrNotFound) {
+		t.Errorf("manifest record after purge: %v, want not found", err)
+	}
+	if b.chunks.Has(a.Address(), manifestBlobPrefix+first.ID) {
+		t.Error("manifest blob survived the purge")
+	}
+	after, err := b.chunks.List(a.Address(), "")
+	if err != nil {
+		t.Fatalf("List after purge: %v", err)
+	}
+	if len(after) >= len(before) {
+		t.Errorf("peer holds %d blobs after purge, %d before", len(after), len(before))
+	}
+	// The chunks the incremental reuses from first survived: it still
+	// restores in full.
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, second.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup after purge: %v", err)
+	}
+	if got := readFile(t, dest, "keep.bin"); len(got) != 2*chunkSize {
+		t.Errorf("keep.bin size = %d", len(got))
+	}
+	if got := readFile(t, dest, "change.bin"); got != strings.Repeat("v2", chunkSize) {
+		t.Error("change.bin content mismatch after purge")
+	}
+}
+
+func TestSetRetentionConfigBackupTrash(t *testing.T) {
+	n := startTestNode(t, netmock.New(), "password-a")
+	if err := n.SetRetentionConfig(RetentionConfig{TrashGraceDays: 7, BackupTrashDays: 0}); err == nil {
+		t.Error("SetRetentionConfig accepted a zero backup trash window")
+	}
+	if err := n.SetRetentionConfig(RetentionConfig{TrashGraceDays: 7, BackupTrashDays: 3}); err != nil {
+		t.Errorf("SetRetentionConfig: %v", err)
+	}
+	if got := n.RetentionConfig().BackupTrashDays; got != 3 {
+		t.Errorf("BackupTrashDays = %d, want 3", got)
+	}
+}
@@ -0,0 +1,99 @@
+package bbnode
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// fileRegion is one data-bearing extent of a file; the holes of a
+// sparse file lie between regions.
+type fileRegion struct {
+	off    int64
+	length int64
+}
+
+// hashZeros feeds n zero bytes into w, standing in for hole content so
+// the file hash of a sparse file matches a dense read of it.
+func hashZeros(w io.Writer, n int64) {
+	var zeros [32 * 1024]byte
+	for n > 0 {
+		m := int64(len(zeros))
+		if m > n {
+			m = n
+		}
+		w.Write(zeros[:m])
+		n -= m
+	}
+}
+
+// walkSource walks the tree at root in lexical order, calling fn with
+// the real path to read, the slash-separated path relative to root, and
+// the entry. Symlinks are reported as themselves; with follow set they
+// are resolved instead, symlinked files appearing as regular files and
+// symlinked directories being descended into (each target only once, so
+// link cycles terminate). A non-nil allow vetoes following: a link
+// whose resolved target it rejects is reported as a link, so a walk
+// confined to the backup roots cannot escape them through a symlink.
+// fn may return filepath.SkipDir on a directory to prune its subtree.
+func walkSource(root string, follow bool, allow func(real string) bool, fn func(path, rel string, d os.DirEntry) error) error {
+	visited := map[string]bool{}
+	if follow {
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			visited[real] = true
+		}
+	}
+	var walk func(dir, prefix string) error
+	walk = func(dir, prefix string) error {
+		return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if prefix != "" {
+				rel = prefix + "/" + rel
+			}
+			if !follow || d.Type()&os.ModeSymlink == 0 {
+				return fn(path, rel, d)
+			}
+			// Resolve the link; a broken one is reported as a link so
+			// the caller records it instead of failing the walk.
+			info, err := os.Stat(path)
+			if err != nil {
+				return fn(path, rel, d)
+			}
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return fn(path, rel, d)
+			}
+			if allow != nil && !allow(real) {
+				// The target escapes the allowed roots: record the
+				// link itself instead of its content.
+				return fn(path, rel, d)
+			}
+			if !info.IsDir() {
+				return fn(path, rel, fs.FileInfoToDirEntry(info))
+			}
+			if visited[real] {
+				return nil // already being walked; a link cycle
+			}
+			visited[real] = true
+			if err := fn(path, rel, fs.FileInfoToDirEntry(info)); err != nil {
+				if err == filepath.SkipDir {
+					return nil
+				}
+				return err
+			}
+			return walk(real, rel)
+		})
+	}
+	return walk(root, "")
+}
@@ -0,0 +1,229 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// balanceConfigKey persists the barter balance settings.
+const balanceConfigKey = "config/balance"
+
+// balanceNudgeKey records when a peer was last nudged about imbalance.
+func balanceNudgeKey(onion string) string { return "balance/nudges/" + onion }
+
+// balanceTrendDays is the window the per-peer byte flow trend covers.
+const balanceTrendDays = 30
+
+// balanceCheckInterval is how often the nudger re-evaluates balances.
+const balanceCheckInterval = 24 * time.Hour
+
+// balanceNudgeInterval is the minimum time between two nudge messages
+// to the same peer.
+const balanceNudgeInterval = 7 * 24 * time.Hour
+
+// balanceNudgeFloor is the least this node must store for a peer before
+// a nudge is considered; tiny imbalances are not worth a message.
+const balanceNudgeFloor int64 = 64 << 20 // 64 MiB
+
+// BalanceConfig are the runtime-configurable barter balance settings.
+type BalanceConfig struct {
+	// NudgeRatio: when the bytes this node stores for a peer exceed
+	// the bytes the peer stores for it by this factor, the peer gets a
+	// friendly message (at most once per balanceNudgeInterval). Zero
+	// disables nudges; they are off by default because they message
+	// peers.
+	NudgeRatio float64 `json:"nudge_ratio,omitempty"`
+}
+
+// PeerBalance is the barter view of one peer: what each side stores
+// for the other, and the recent byte flow. Measurement only — nothing
+// is enforced.
+type PeerBalance struct {
+	Onion string
+	Alias string
+	// StoredForPeer is the bytes this node currently holds for the
+	// peer, from the chunk store.
+	StoredForPeer int64
+	// StoredAtPeer is the bytes the peer holds for this node, estimated
+	// from the replication records of local backups.
+	StoredAtPeer int64
+	// SentBytes and ReceivedBytes are the byte flow over the last
+	// balanceTrendDays, from the daily report buckets: sent to the
+	// peer, received from the peer.
+	SentBytes     int64
+	ReceivedBytes int64
+}
+
+// loadBalanceConfig reads the persisted balance settings. Called from
+// New.
+func (n *Node) loadBalanceConfig() error {
+	var cfg BalanceConfig
+	err := n.sec.GetJSON(balanceConfigKey, &cfg)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	n.balanceCfg = cfg
+	return nil
+}
+
+// BalanceConfig returns the current balance settings.
+func (n *Node) BalanceConfig() BalanceConfig {
+	n.balanceMu.Lock()
+	defer n.balanceMu.Unlock()
+	return n.balanceCfg
+}
+
+// SetBalanceConfig validates, persists, and applies new balance
+// settings.
+func (n *Node) SetBalanceConfig(cfg BalanceConfig) error {
+	if cfg.NudgeRatio < 0 {
+		return fmt.Errorf("nudge ratio must not be negative")
+	}
+	if cfg.NudgeRatio > 0 && cfg.NudgeRatio < 1 {
+		return fmt.Errorf("nudge ratio below 1 would nudge balanced peers")
+	}
+	if err := n.sec.PutJSON(balanceConfigKey, &cfg); err != nil {
+		return fmt.Errorf("store balance settings: %w", err)
+	}
+	n.balanceMu.Lock()
+	n.balanceCfg = cfg
+	n.balanceMu.Unlock()
+	return nil
+}
+
+// storedAtPeers estimates, per peer onion, the bytes the peer holds for
+// this node: the sum of uploaded bytes of every backup whose
+// replication to that peer completed. Incremental runs upload only new
+// chunks, so summing over a backup chain counts each chunk once.
+func (n *Node) storedAtPeers() (map[string]int64, error) {
+	backups, err := n.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64)
+	for _, b := range backups {
+		for onion, state := range b.Replication {
+			if state == "complete" {
+				out[onion] += b.UploadedBytes
+			}
+		}
+	}
+	return out, nil
+}
+
+// PeerBalances computes the barter balance for every registered peer,
+// sorted by the absolute imbalance descending.
+func (n *Node) PeerBalances() ([]PeerBalance, error) {
+	storedAt, err := n.storedAtPeers()
+	if err != nil {
+		return nil, err
+	}
+	now := n.clk.Now()
+	days, err := n.Report(now.AddDate(0, 0, -balanceTrendDays), now)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]PeerBalance, 0)
+	for _, p := range n.ListPeers() {
+		b := PeerBalance{
+			Onion:         p.Onion,
+			Alias:         p.Alias,
+			StoredForPeer: n.chunks.Usage(p.Onion),
+			StoredAtPeer:  storedAt[p.Onion],
+		}
+		for _, day := range days {
+			b.SentBytes += day.StoredAtPeers[p.Onion]
+			b.ReceivedBytes += day.StoredForPeers[p.Onion]
+		}
+		out = append(out, b)
+	}
+	imbalance := func(b PeerBalance) int64 {
+		d := b.StoredForPeer - b.StoredAtPeer
+		if d < 0 {
+			d = -d
+		}
+		return d
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if di, dj := imbalance(out[i]), imbalance(out[j]); di != dj {
+			return di > dj
+		}
+		return out[i].Onion < out[j].Onion
+	})
+	return out, nil
+}
+
+// nudgeRecord remembers the last balance nudge sent to a peer.
+type nudgeRecord struct {
+	SentAt time.Time `json:"sent_at"`
+}
+
+// runBalanceNudger periodically checks balances and messages peers
+// whose imbalance crossed the configured ratio, until stop closes.
+func (n *Node) runBalanceNudger(stop chan struct{}) {
+	t := n.clk.NewTicker(balanceCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C():
+			n.nudgeImbalancedPeers()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// nudgeImbalancedPeers sends one friendly message to each peer storing
+// NudgeRatio times more here than it holds for this node, at most once
+// per balanceNudgeInterval per peer. Failures are left for the next
+// check; a nudge is not worth retrying aggressively.
+func (n *Node) nudgeImbalancedPeers() {
+	ratio := n.BalanceConfig().NudgeRatio
+	if ratio <= 0 {
+		return
+	}
+	balances, err := n.PeerBalances()
+	if err != nil {
+		log.Printf("balance nudge: %v", err)
+		return
+	}
+	for _, b := range balances {
+		if b.StoredForPeer < balanceNudgeFloor {
+			continue
+		}
+		theirs := b.StoredAtPeer
+		if theirs < 1 {
+			theirs = 1
+		}
+		if float64(b.StoredForPeer)/float64(theirs) < ratio {
+			continue
+		}
+		var last nudgeRecord
+		if err := n.sec.GetJSON(balanceNudgeKey(b.Onion), &last); err == nil &&
+			n.clk.Now().Sub(last.SentAt) < balanceNudgeInterval {
+			continue
+		}
+		body := fmt.Sprintf(
+			"Friendly barter check-in: I currently store %d bytes for you, while you store %d bytes for me. No action required, but if you would like to even things out, feel free to back up more data to me.",
+			b.StoredForPeer, b.StoredAtPeer)
+		ctx, cancel := context.WithTimeout(context.Background(), n.callTimeout)
+		err := n.SendMessage(ctx, b.Onion, body)
+		cancel()
+		if err != nil {
+			log.Printf("balance nudge to %s: %v", b.Onion, err)
+			continue
+		}
+		if err := n.sec.PutJSON(balanceNudgeKey(b.Onion), &nudgeRecord{SentAt: n.clk.Now()}); err != nil {
+			log.Printf("record balance nudge for %s: %v", b.Onion, err)
+		}
+		n.auditEvent("balance_nudge_sent", map[string]string{"onion": b.Onion})
+	}
+}
@@ -0,0 +1,74 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestPeerBalances(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	if _, err := pb.NewPeerClient(cc).StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("data")}); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	// Seed backup records directly: a completed chain to bob, plus a
+	// failed upload that must not count.
+	records := []*Backup{
+		{ID: "b1", Replication: map[string]string{b.Address(): "complete"}, UploadedBytes: 100},
+		{ID: "b2", BaseID: "b1", Replication: map[string]string{b.Address(): "complete"}, UploadedBytes: 30},
+		{ID: "b3", Replication: map[string]string{b.Address(): "connection refused"}, UploadedBytes: 999},
+	}
+	for _, r := range records {
+		if err := a.sec.PutJSON(backupRecordKey(r.ID), r); err != nil {
+			t.Fatalf("PutJSON: %v", err)
+		}
+	}
+
+	balances, err := a.PeerBalances()
+	if err != nil {
+		t.Fatalf("PeerBalances: %v", err)
+	}
+	if len(balances) != 1 {
+		t.Fatalf("len(balances) = %d, want 1", len(balances))
+	}
+	got := balances[0]
+	if got.Onion != b.Address() || got.Alias != "bob" {
+		t.Errorf("peer = %s (%s), want bob", got.Onion, got.Alias)
+	}
+	if got.StoredForPeer != int64(len("data")) {
+		t.Errorf("StoredForPeer = %d, want %d", got.StoredForPeer, len("data"))
+	}
+	if got.StoredAtPeer != 130 {
+		t.Errorf("StoredAtPeer = %d, want 130", got.StoredAtPeer)
+	}
+	if got.ReceivedBytes != int64(len("data")) {
+		t.Errorf("ReceivedBytes = %d, want %d", got.ReceivedBytes, len("data"))
+	}
+}
+
+func TestSetBalanceConfig(t *testing.T) {
+	n := startTestNode(t, netmock.New(), "pw")
+
+	if err := n.SetBalanceConfig(BalanceConfig{NudgeRatio: -1}); err == nil {
+		t.Error("negative ratio accepted")
+	}
+	if err := n.SetBalanceConfig(BalanceConfig{NudgeRatio: 0.5}); err == nil {
+		t.Error("ratio below 1 accepted")
+	}
+	if err := n.SetBalanceConfig(BalanceConfig{NudgeRatio: 2}); err != nil {
+		t.Fatalf("SetBalanceConfig: %v", err)
+	}
+	if got := n.BalanceConfig().NudgeRatio; got != 2 {
+		t.Errorf("NudgeRatio = %g, want 2", got)
+	}
+}
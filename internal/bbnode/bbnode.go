@@ -0,0 +1,661 @@
+// Package bbnode implements the barterbackup node: it publishes the
+// bbrpc server on the node's onion address, maintains a pool of
+// outbound connections to peers, keeps the peer registry, and holds the
+// node's encrypted state in the secstore under the data dir.
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/auditlog"
+	"github.com/starius/barterbackup/internal/chunkstore"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/memzero"
+	"github.com/starius/barterbackup/internal/secstore"
+	"github.com/starius/barterbackup/internal/tracing"
+)
+
+// Network abstracts how the node is published and how peers are reached.
+// nettor implements it over Tor; netmock implements it in memory.
+type Network interface {
+	// Register makes the node reachable at the onion address derived
+	// from onionKey and returns the address and a listener for inbound
+	// connections. Closing the listener unregisters the node.
+	Register(ctx context.Context, onionKey ed25519.PrivateKey) (string, net.Listener, error)
+	// Dial opens a connection to the peer at addr.
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// Node is a running daemon-side node.
+type Node struct {
+	network Network
+	dataDir string
+	clk     clock
+
+	masterPriv []byte
+	// identityMode is how the onion key relates to the password: derived
+	// from it, or a random key sealed in the secstore. See identity.go.
+	identityMode string
+	onionKey     ed25519.PrivateKey
+	cert         tls.Certificate
+	// serverTLS is the onion listener's TLS config, built once in Start
+	// and reused when the recovery loop republishes, so the ticket key
+	// rotator keeps working across network restarts.
+	serverTLS   *tls.Config
+	sec         *secstore.Store
+	chunks      *chunkstore.Store
+	audit       *auditlog.Logger
+	maxMsgSize  int
+	streamLimit int
+	limiter     *streamLimiter
+	maxPeers    int
+	dialLimit   int
+	dialSem     chan struct{}
+	warmConns   int
+	backupRoots []string
+
+	// capsOverridden and the pair below let tests advertise the
+	// capabilities of an older build; see localCaps.
+	capsOverridden bool
+	protoVersion   uint32
+	features       uint64
+	// tracing advertises FeatureTracing and propagates trace context to
+	// peers that advertise it back.
+	tracing bool
+
+	selfCheck         bool
+	selfCheckInterval time.Duration
+	strictIdentity    bool
+	// instanceNonce distinguishes this node instance from another one
+	// started with the same identity; WhoAmI echoes it on self-dials.
+	instanceNonce   []byte
+	probeInterval   time.Duration
+	drainTimeout    time.Duration
+	callTimeout     time.Duration
+	prefetchDepth   int
+	prefetchStaging int64
+	// requireProof refuses data-plane RPCs from peers that have not
+	// proven onion ownership; see onionproof.go.
+	requireProof bool
+	// Inbound connection protections; see connlimits.go.
+	serverMaxStreams uint32
+	serverHandshake  time.Duration
+	serverConnIdle   time.Duration
+	serverConnAge    time.Duration
+
+	mu         sync.Mutex
+	addr       string
+	ln         net.Listener
+	srv        *grpc.Server
+	stop       chan struct{}
+	startedAt  time.Time
+	conns      map[string]*poolConn
+	dialing    map[string]*dialCall
+	peerMaxMsg map[string]int
+	peerMode   map[string]string
+	peers      map[string]*Peer
+	// fetchNonces holds the session nonce issued to each caller for
+	// FetchChunk ownership proofs; peerFetchNonce caches the nonces
+	// other servers issued to us.
+	fetchNonces    map[string][]byte
+	peerFetchNonce map[string][]byte
+	// onionChallenges holds the outstanding onion ownership challenge
+	// issued to each caller; see onionproof.go.
+	onionChallenges map[string][]byte
+	// contacted is the set of peers dialed this session; Stop persists
+	// it so the next session can pre-dial them.
+	contacted map[string]bool
+	// breakers holds the outbound circuit breaker of every peer that
+	// accumulated failures; absent means closed. See breaker.go.
+	breakers map[string]*peerBreaker
+	// wiping marks peers whose data a wipe job is currently deleting;
+	// they are rejected at the door until the job finishes.
+	wiping map[string]bool
+	// blocked is the peer blocklist; calls from these addresses are
+	// refused before any other authorization.
+	blocked         map[string]*BlockedPeer
+	warmEstablished int
+	// wiped is set once Stop has zeroized the key material; methods
+	// that need keys fail with errKeysWiped from then on.
+	wiped bool
+
+	sessionCache tls.ClientSessionCache
+	stats        poolCounters
+	servStats    serverConnCounters
+
+	rpcStatsMu sync.Mutex
+	rpcStats   map[string]*rpcCounters
+
+	healthMu sync.Mutex
+	health   Health
+
+	reachMu    sync.Mutex
+	reach      map[string]map[int64]*reachCounts
+	reachDirty bool
+
+	netMu     sync.Mutex
+	netStatus NetworkStatus
+
+	jobsMu      sync.Mutex
+	runningJobs map[string]*runningJob
+
+	progressMu sync.Mutex
+	progress   map[string]*jobProgressState
+
+	diskMu     sync.Mutex
+	diskCfg    DiskConfig
+	diskStatus DiskStatus
+
+	gcMu    sync.Mutex
+	gcDone  bool
+	gcFiles int
+	gcBytes int64
+
+	modeMu        sync.Mutex
+	mode          Mode
+	drainDeadline time.Time
+
+	reportMu    sync.Mutex
+	reportCur   *ReportDay
+	reportDirty bool
+
+	retentionMu  sync.Mutex
+	retentionCfg RetentionConfig
+
+	balanceMu  sync.Mutex
+	balanceCfg BalanceConfig
+
+	reconMu     sync.Mutex
+	reconStatus StorageReconStatus
+
+	// invitesMu serializes invite issuance and redemption so racing
+	// Join calls cannot both mark one invite used.
+	invitesMu sync.Mutex
+}
+
+// staleTempTTL is how old an interrupted upload's temp file must be
+// before the startup reclaim pass deletes it.
+const staleTempTTL = 24 * time.Hour
+
+// DefaultDrainTimeout is how long Stop lets in-flight peer RPCs finish
+// before cutting them off. It is short enough that, together with the
+// daemon's own drain, shutdown stays inside systemd's stop timeout.
+const DefaultDrainTimeout = 30 * time.Second
+
+// New opens the node state under dataDir and derives or loads the node
+// identity per the data dir's identity mode (see identity.go). The node
+// is not reachable until Start.
+func New(password string, network Network, dataDir string, opts ...Option) (*Node, error) {
+	pw := []byte(password)
+	master := deriveMasterCached(pw)
+	memzero.Bytes(pw)
+	sec, err := secstore.Open(filepath.Join(dataDir, "secstore"), master)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		network:           network,
+		dataDir:           dataDir,
+		clk:               realClock{},
+		masterPriv:        master,
+		sec:               sec,
+		maxMsgSize:        bbrpc.GRPCMaxMsgSize,
+		streamLimit:       defaultPeerStreamLimit,
+		limiter:           newStreamLimiter(),
+		maxPeers:          defaultMaxPeers,
+		dialLimit:         defaultDialLimit,
+		conns:             make(map[string]*poolConn),
+		dialing:           make(map[string]*dialCall),
+		peerMaxMsg:        make(map[string]int),
+		peerMode:          make(map[string]string),
+		peers:             make(map[string]*Peer),
+		fetchNonces:       make(map[string][]byte),
+		peerFetchNonce:    make(map[string][]byte),
+		onionChallenges:   make(map[string][]byte),
+		contacted:         make(map[string]bool),
+		breakers:          make(map[string]*peerBreaker),
+		wiping:            make(map[string]bool),
+		blocked:           make(map[string]*BlockedPeer),
+		runningJobs:       make(map[string]*runningJob),
+		progress:          make(map[string]*jobProgressState),
+		selfCheckInterval: defaultSelfCheckInterval,
+		probeInterval:     defaultProbeInterval,
+		drainTimeout:      DefaultDrainTimeout,
+		callTimeout:       defaultPeerCallTimeout,
+		prefetchDepth:     defaultPrefetchDepth,
+		prefetchStaging:   defaultPrefetchStagingBytes,
+		serverMaxStreams:  serverMaxConcurrentStreams,
+		serverHandshake:   defaultServerHandshakeTimeout,
+		serverConnIdle:    defaultServerConnIdle,
+		serverConnAge:     defaultServerConnAge,
+		instanceNonce:     newInstanceNonce(),
+		sessionCache:      tls.NewLRUClientSessionCache(64),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	// The identity mode option must be applied before the key resolves.
+	onionKey, err := n.resolveIdentity(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	n.onionKey = onionKey
+	cert, err := selfSignedEd25519Cert(onionKey)
+	if err != nil {
+		return nil, fmt.Errorf("self-signed cert: %w", err)
+	}
+	n.cert = cert
+	n.dialSem = make(chan struct{}, n.dialLimit)
+	// The chunk backend option must be applied before the store opens.
+	if n.chunks == nil {
+		chunks, err := chunkstore.Open(filepath.Join(dataDir, "chunks"))
+		if err != nil {
+			return nil, err
+		}
+		n.chunks = chunks
+	}
+	if err := n.loadPeers(); err != nil {
+		return nil, err
+	}
+	if err := n.loadBlocklist(); err != nil {
+		return nil, err
+	}
+	if err := n.loadDiskConfig(); err != nil {
+		return nil, err
+	}
+	if err := n.loadRetentionConfig(); err != nil {
+		return nil, err
+	}
+	if err := n.loadBalanceConfig(); err != nil {
+		return nil, err
+	}
+	if err := n.loadMode(); err != nil {
+		return nil, err
+	}
+	if err := n.loadStorageDrift(); err != nil {
+		return nil, err
+	}
+	if err := n.loadReachHistory(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Fingerprint returns a stable hex identifier of the master secret,
+// usable to check a password against a data dir without storing anything
+// secret.
+func (n *Node) Fingerprint() string {
+	return fingerprintOf(n.masterPriv)
+}
+
+// PasswordFingerprint returns the fingerprint a node derived from
+// password would report, without constructing a node. The daemon uses
+// it to check a repeated Unlock against the running node.
+func PasswordFingerprint(password string) string {
+	pw := []byte(password)
+	master := deriveMasterCached(pw)
+	memzero.Bytes(pw)
+	defer memzero.Bytes(master)
+	return fingerprintOf(master)
+}
+
+func fingerprintOf(master []byte) string {
+	return keys.ComputeFingerprint(master).Hex()
+}
+
+// auditEvent records a security-relevant event if the daemon wired up
+// an audit log; a write failure must not fail the operation itself.
+func (n *Node) auditEvent(event string, details map[string]string) {
+	if n.audit == nil {
+		return
+	}
+	if err := n.audit.Append(event, details); err != nil {
+		log.Printf("audit log: %v", err)
+	}
+}
+
+// errKeysWiped is returned by methods that need key material after
+// Stop has zeroized it.
+var errKeysWiped = errors.New("node is locked: key material has been wiped")
+
+// master returns the master secret, or errKeysWiped once Stop wiped it.
+func (n *Node) master() ([]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.wiped {
+		return nil, errKeysWiped
+	}
+	return n.masterPriv, nil
+}
+
+// signingKey returns the onion identity key, or errKeysWiped once Stop
+// wiped it.
+func (n *Node) signingKey() (ed25519.PrivateKey, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.wiped {
+		return nil, errKeysWiped
+	}
+	return n.onionKey, nil
+}
+
+// wipeKeys zeroizes the master secret and the onion key. The TLS
+// certificate references the same onion key slice, so its copy is
+// wiped with it.
+func (n *Node) wipeKeys() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.wiped {
+		return
+	}
+	n.wiped = true
+	memzero.Bytes(n.masterPriv)
+	memzero.Bytes(n.onionKey)
+}
+
+// Start publishes the node on its network and begins serving peer RPCs.
+func (n *Node) Start(ctx context.Context) error {
+	if _, err := n.signingKey(); err != nil {
+		return err
+	}
+	if err := n.refreshOnionAuth(ctx); err != nil {
+		return fmt.Errorf("apply onion client auth: %w", err)
+	}
+	if err := n.markInterruptedJobs(); err != nil {
+		return fmt.Errorf("mark interrupted jobs: %w", err)
+	}
+	tlsCfg, err := n.serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	n.serverTLS = tlsCfg
+	if err := n.publishAndServe(ctx); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	n.mu.Lock()
+	n.stop = stop
+	n.startedAt = time.Now()
+	n.mu.Unlock()
+
+	go n.rotateTicketKeys(tlsCfg, stop)
+	go n.startEvictor(stop)
+	go n.runStartupGC()
+	go n.runDiskWatch(stop)
+	go n.runPeerProbe(stop)
+	go n.runReportFlusher(stop)
+	go n.runRetentionSweep(stop)
+	go n.runStorageReconcile(stop)
+	go n.runBalanceNudger(stop)
+	go n.runReachPersist(stop)
+	if n.selfCheck {
+		go n.runSelfCheck(stop)
+	}
+	if n.warmConns > 0 {
+		go n.warmConnections(stop)
+	}
+	if dn, ok := n.network.(downNotifier); ok {
+		go n.runNetworkRecovery(dn.Down(), stop)
+	}
+	return nil
+}
+
+// publishAndServe registers the node's onion address on the network and
+// starts a gRPC server on the returned listener. Start calls it once;
+// the network recovery loop calls it again after the transport dies.
+func (n *Node) publishAndServe(ctx context.Context) error {
+	addr, rawLn, err := n.network.Register(ctx, n.onionKey)
+	if err != nil {
+		return fmt.Errorf("register on network: %w", err)
+	}
+	ln := net.Listener(&guardedListener{Listener: rawLn, timeout: n.serverHandshake, stats: &n.servStats})
+	opts := []grpc.ServerOption{
+		grpc.Creds(credentials.NewTLS(n.serverTLS)),
+		grpc.MaxRecvMsgSize(n.maxMsgSize),
+		grpc.MaxSendMsgSize(n.maxMsgSize),
+		grpc.MaxConcurrentStreams(n.serverMaxStreams),
+		grpc.InitialWindowSize(serverStreamWindow),
+		grpc.InitialConnWindowSize(serverConnWindow),
+		grpc.ConnectionTimeout(n.serverHandshake),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     n.serverConnIdle,
+			MaxConnectionAge:      n.serverConnAge,
+			MaxConnectionAgeGrace: defaultServerConnAgeGrace,
+		}),
+		grpc.ChainUnaryInterceptor(n.authUnaryInterceptor),
+		grpc.ChainStreamInterceptor(n.authStreamInterceptor),
+	}
+	if n.tracing {
+		// Continue traces from peers that propagated context; without
+		// the flag incoming trace metadata is simply ignored.
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor()),
+		)
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterPeerServer(srv, &peerService{node: n})
+
+	n.mu.Lock()
+	n.addr = addr
+	n.ln = ln
+	n.srv = srv
+	n.mu.Unlock()
+
+	go srv.Serve(ln)
+	return nil
+}
+
+// runStartupGC reclaims stale temp files left by interrupted uploads. It
+// runs in the background so a big store does not delay Start; progress
+// is visible via StartupGCStatus.
+func (n *Node) runStartupGC() {
+	files, bytes, err := n.chunks.ReclaimStale(staleTempTTL)
+	if err != nil {
+		log.Printf("startup chunk GC: %v", err)
+	}
+	if files > 0 {
+		log.Printf("startup chunk GC: reclaimed %d stale temp files, %d bytes", files, bytes)
+	}
+	n.gcMu.Lock()
+	n.gcDone = true
+	n.gcFiles = files
+	n.gcBytes = bytes
+	n.gcMu.Unlock()
+}
+
+// StartupGCStatus reports whether the startup reclaim pass finished and
+// what it reclaimed.
+func (n *Node) StartupGCStatus() (done bool, files int, bytes int64) {
+	n.gcMu.Lock()
+	defer n.gcMu.Unlock()
+	return n.gcDone, n.gcFiles, n.gcBytes
+}
+
+// Address returns the node's onion address. It is empty before Start.
+func (n *Node) Address() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.addr
+}
+
+// StartedAt returns when Start was last called. It is zero before Start
+// and again after Stop.
+func (n *Node) StartedAt() time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.startedAt
+}
+
+// Uptime returns how long the node has been running, zero while it is
+// not started. A Stop/Start cycle restarts the clock.
+func (n *Node) Uptime() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.startedAt.IsZero() {
+		return 0
+	}
+	return time.Since(n.startedAt)
+}
+
+// Stop unpublishes the node, closes all pooled connections, and stops
+// serving. In-flight peer RPCs get the drain timeout to finish — killing
+// a StoreChunk stream mid-upload leaves the peer with a partial chunk —
+// and are cut off once it runs out.
+func (n *Node) Stop() error {
+	n.cancelRunningJobs()
+	n.mu.Lock()
+	srv, ln, stop := n.srv, n.ln, n.stop
+	n.srv, n.ln, n.stop = nil, nil, nil
+	n.startedAt = time.Time{}
+	conns := n.conns
+	n.conns = make(map[string]*poolConn)
+	n.mu.Unlock()
+	for _, pc := range conns {
+		pc.cc.Close()
+	}
+	if stop != nil {
+		close(stop)
+	}
+	if srv != nil {
+		drained := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-time.After(n.drainTimeout):
+			srv.Stop()
+			<-drained
+		}
+	}
+	if ln != nil {
+		ln.Close()
+	}
+	n.saveWarmList()
+	n.flushReport()
+	n.wipeKeys()
+	return nil
+}
+
+// ErrIdentityConflict is returned by SelfCheck when the self-dial
+// reached another live instance of this node's identity — typically a
+// second daemon started from the same password on another machine, with
+// both fighting over the Tor descriptor.
+var ErrIdentityConflict = errors.New("identity conflict: another instance is serving this onion address")
+
+// newInstanceNonce draws the random value WhoAmI echoes so self-dials
+// can tell this instance from a duplicate sharing its identity.
+func newInstanceNonce() []byte {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	return nonce
+}
+
+// SelfCheck dials the node's own onion address through the network and
+// verifies the HealthCheck response reports the expected identity. It
+// proves the published address is actually reachable.
+func (n *Node) SelfCheck(ctx context.Context) error {
+	addr := n.Address()
+	if addr == "" {
+		return fmt.Errorf("node not started")
+	}
+	onion, err := n.HealthCheck(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("self-dial %s: %w", addr, err)
+	}
+	if onion != addr {
+		return fmt.Errorf("self-dial reached %s, expected %s", onion, addr)
+	}
+	// The right identity is not yet the right instance: a duplicate
+	// daemon publishes the same onion key and answers with the same
+	// address. Only the startup nonce tells the two apart.
+	var resp *pb.WhoAmIResponse
+	err = n.callPeer(ctx, addr, 0, func(ctx context.Context, client pb.PeerClient) error {
+		var err error
+		resp, err = client.WhoAmI(ctx, &pb.WhoAmIRequest{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("self-dial %s: %w", addr, err)
+	}
+	if !bytes.Equal(resp.InstanceNonce, n.instanceNonce) {
+		return fmt.Errorf("%w (%s)", ErrIdentityConflict, addr)
+	}
+	return nil
+}
+
+// HealthCheck dials the peer at addr and runs a HealthCheck RPC,
+// returning the onion address the peer reports for itself. The
+// advertised message size limit is recorded for later frame size
+// negotiation.
+func (n *Node) HealthCheck(ctx context.Context, addr string) (string, error) {
+	var resp *pb.HealthCheckResponse
+	err := n.callPeer(ctx, addr, 0, func(ctx context.Context, client pb.PeerClient) error {
+		var err error
+		resp, err = client.HealthCheck(ctx, &pb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		// A challenge means the peer has no ownership proof from us
+		// yet; answering on the spot keeps the same connection and
+		// unblocks data-plane calls on proof-requiring peers.
+		if len(resp.OnionChallenge) > 0 {
+			return n.answerOnionChallenge(ctx, client, resp.OnionChallenge)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	if resp.MaxMsgSize > 0 {
+		n.peerMaxMsg[addr] = int(resp.MaxMsgSize)
+	}
+	n.peerMode[addr] = resp.Mode
+	if len(resp.FetchNonce) > 0 {
+		n.peerFetchNonce[addr] = resp.FetchNonce
+	}
+	n.mu.Unlock()
+	n.recordPeerCaps(addr, resp.ProtoVersion, resp.Features)
+	return resp.Onion, nil
+}
+
+// Ping echoes payload off the peer at addr.
+func (n *Node) Ping(ctx context.Context, addr string, payload []byte) error {
+	return n.callPeer(ctx, addr, 0, func(ctx context.Context, client pb.PeerClient) error {
+		_, err := client.Ping(ctx, &pb.PingRequest{Payload: payload})
+		return err
+	})
+}
+
+// PeerMaxMsgSize returns the message size limit the peer at addr
+// advertised in its last HealthCheck response, or bbrpc.GRPCMaxMsgSize if
+// the peer has not been health-checked yet.
+func (n *Node) PeerMaxMsgSize(addr string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if size, ok := n.peerMaxMsg[addr]; ok {
+		return size
+	}
+	return bbrpc.GRPCMaxMsgSize
+}
@@ -0,0 +1,154 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// blocklistKey is the secstore key holding the peer blocklist.
+const blocklistKey = "peers/blocklist"
+
+// ErrNotBlocked is wrapped by UnblockPeer for an address that is not on
+// the blocklist.
+var ErrNotBlocked = errors.New("not blocked")
+
+// BlockedPeer is a blocklist entry for an onion address whose calls are
+// refused at the door.
+type BlockedPeer struct {
+	// Onion is the blocked onion address.
+	Onion string `json:"onion"`
+	// BlockedAt is when the address was blocked.
+	BlockedAt time.Time `json:"blocked_at"`
+	// Attempts counts inbound calls rejected since the block.
+	Attempts int64 `json:"attempts,omitempty"`
+	// LastAttempt is when the address last tried to call. Zero if it has
+	// not tried since the block.
+	LastAttempt time.Time `json:"last_attempt,omitempty"`
+}
+
+// BlockPeer puts the peer given as an alias, onion address, or bb:// URI
+// on the blocklist: every inbound call from it is rejected with
+// PermissionDenied before any other authorization. Blocking does not by
+// itself remove a registered peer; with andWipe the wipe flow runs too,
+// and the returned job ID identifies the deletion job.
+func (n *Node) BlockPeer(aliasOrOnion string, andWipe bool) (onion, wipeJobID string, err error) {
+	registered := false
+	if p, err := n.findPeer(aliasOrOnion); err == nil {
+		onion = p.Onion
+		registered = true
+	} else {
+		u, err := parsePeerURI(aliasOrOnion, time.Now())
+		if err != nil {
+			return "", "", err
+		}
+		onion = u.Onion
+	}
+	n.mu.Lock()
+	if _, ok := n.blocked[onion]; ok {
+		n.mu.Unlock()
+		return "", "", fmt.Errorf("peer %s is already blocked", onion)
+	}
+	n.blocked[onion] = &BlockedPeer{Onion: onion, BlockedAt: time.Now()}
+	saveErr := n.saveBlocklistLocked()
+	// Close our own pooled connection too; a blocked peer gets no
+	// traffic in either direction.
+	pc := n.conns[onion]
+	delete(n.conns, onion)
+	n.mu.Unlock()
+	if pc != nil {
+		pc.cc.Close()
+	}
+	if saveErr != nil {
+		return "", "", saveErr
+	}
+	n.auditEvent("peer_blocked", map[string]string{"onion": onion})
+	if andWipe && registered {
+		if _, wipeJobID, err = n.WipePeer(onion); err != nil {
+			return "", "", err
+		}
+	}
+	return onion, wipeJobID, nil
+}
+
+// UnblockPeer removes the onion address from the blocklist.
+func (n *Node) UnblockPeer(onion string) error {
+	n.mu.Lock()
+	if _, ok := n.blocked[onion]; !ok {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s is %w", onion, ErrNotBlocked)
+	}
+	delete(n.blocked, onion)
+	err := n.saveBlocklistLocked()
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	n.auditEvent("peer_unblocked", map[string]string{"onion": onion})
+	return nil
+}
+
+// ListBlockedPeers returns the blocklist sorted by onion address.
+func (n *Node) ListBlockedPeers() []BlockedPeer {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := make([]BlockedPeer, 0, len(n.blocked))
+	for _, b := range n.blocked {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Onion < out[j].Onion })
+	return out
+}
+
+// isBlocked reports whether inbound calls from onion are refused.
+func (n *Node) isBlocked(onion string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.blocked[onion]
+	return ok
+}
+
+// recordBlockedAttempt counts a rejected call from a blocked address.
+// The counter is persisted so attempt history survives restarts.
+func (n *Node) recordBlockedAttempt(onion, method string) {
+	n.mu.Lock()
+	b, ok := n.blocked[onion]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	b.Attempts++
+	b.LastAttempt = time.Now()
+	if err := n.saveBlocklistLocked(); err != nil {
+		log.Printf("save blocklist: %v", err)
+	}
+	n.mu.Unlock()
+	n.auditEvent("blocked_peer_attempt", map[string]string{"onion": onion, "method": method})
+}
+
+func (n *Node) loadBlocklist() error {
+	var list []*BlockedPeer
+	err := n.sec.GetJSON(blocklistKey, &list)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, b := range list {
+		n.blocked[b.Onion] = b
+	}
+	return nil
+}
+
+func (n *Node) saveBlocklistLocked() error {
+	list := make([]*BlockedPeer, 0, len(n.blocked))
+	for _, b := range n.blocked {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Onion < list[j].Onion })
+	return n.sec.PutJSON(blocklistKey, list)
+}
@@ -0,0 +1,97 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBlockPeer(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := a.Ping(ctx, b.Address(), []byte("hi")); err != nil {
+		t.Fatalf("Ping before block: %v", err)
+	}
+
+	// b blocks a by alias; even the open methods are refused now.
+	onion, jobID, err := b.BlockPeer("alice", false)
+	if err != nil {
+		t.Fatalf("BlockPeer: %v", err)
+	}
+	if onion != a.Address() {
+		t.Errorf("blocked onion = %s, want %s", onion, a.Address())
+	}
+	if jobID != "" {
+		t.Errorf("wipe job id = %q without --and-wipe", jobID)
+	}
+	err = a.Ping(ctx, b.Address(), []byte("hi"))
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Ping after block: %v, want PermissionDenied", err)
+	}
+
+	// The attempt shows up with a counter and timestamp.
+	blocked := b.ListBlockedPeers()
+	if len(blocked) != 1 {
+		t.Fatalf("blocklist = %+v, want one entry", blocked)
+	}
+	if blocked[0].Onion != a.Address() || blocked[0].Attempts != 1 || blocked[0].LastAttempt.IsZero() {
+		t.Errorf("blocklist entry = %+v", blocked[0])
+	}
+
+	// A blocked address cannot be re-added or re-blocked.
+	if err := b.RemovePeer(a.Address()); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), ""); err == nil {
+		t.Error("AddPeer of a blocked address succeeded")
+	}
+	if _, _, err := b.BlockPeer(a.Address(), false); err == nil {
+		t.Error("second BlockPeer succeeded")
+	}
+
+	// Unblocking restores contact and survives only one unblock.
+	if err := b.UnblockPeer(a.Address()); err != nil {
+		t.Fatalf("UnblockPeer: %v", err)
+	}
+	if err := a.Ping(ctx, b.Address(), []byte("hi")); err != nil {
+		t.Fatalf("Ping after unblock: %v", err)
+	}
+	if err := b.UnblockPeer(a.Address()); err == nil {
+		t.Error("UnblockPeer of an unblocked address succeeded")
+	}
+}
+
+func TestBlockPeerAndWipe(t *testing.T) {
+	a, b := startPairedNodes(t)
+
+	_, jobID, err := b.BlockPeer(a.Address(), true)
+	if err != nil {
+		t.Fatalf("BlockPeer: %v", err)
+	}
+	if jobID == "" {
+		t.Fatal("BlockPeer with andWipe returned no wipe job")
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if jobByID(t, b, jobID).State == "done" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wipe job stuck in state %q", jobByID(t, b, jobID).State)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, p := range b.ListPeers() {
+		if p.Onion == a.Address() {
+			t.Error("wiped peer still registered")
+		}
+	}
+	if !b.isBlocked(a.Address()) {
+		t.Error("peer not blocked after BlockPeer with andWipe")
+	}
+}
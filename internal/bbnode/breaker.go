@@ -0,0 +1,150 @@
+package bbnode
+
+import "time"
+
+// Circuit breaker for outbound calls to a peer that keeps failing. A
+// peer that is gone for good would otherwise cost a fresh Tor circuit
+// on every probe round forever; after enough consecutive failures the
+// breaker opens and background loops leave the peer alone except for
+// exponentially spaced probes. User-initiated calls are never blocked —
+// they half-open the breaker and their outcome decides whether it
+// closes again or backs off further.
+const (
+	// breakerFailureThreshold is how many consecutive outbound failures
+	// open the breaker. It sits above UnreachableProbeThreshold so the
+	// peer shows as unreachable before background traffic stops.
+	breakerFailureThreshold = 5
+	// breakerBaseBackoff is the first open interval; each further
+	// failure doubles it up to breakerMaxBackoff.
+	breakerBaseBackoff = 30 * time.Minute
+	breakerMaxBackoff  = 6 * time.Hour
+)
+
+// breakerState is one of the three classic circuit-breaker states.
+type breakerState int
+
+const (
+	// breakerClosed: calls flow normally; consecutive failures count up.
+	breakerClosed breakerState = iota
+	// breakerOpen: background loops skip the peer until retryAt.
+	breakerOpen
+	// breakerHalfOpen: a trial call is in flight; its outcome closes the
+	// breaker or reopens it with a longer backoff.
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// peerBreaker is the per-peer state machine. It is not safe for
+// concurrent use; the Node guards its breaker map with n.mu.
+type peerBreaker struct {
+	clk      clock
+	state    breakerState
+	failures int
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+// allow reports whether a background call to the peer should proceed.
+// It never mutates state: an open breaker past its retry time answers
+// true, and the attempt itself (see trial) moves it to half-open.
+func (b *peerBreaker) allow() bool {
+	switch b.state {
+	case breakerOpen:
+		return !b.clk.Now().Before(b.retryAt)
+	case breakerHalfOpen:
+		// One trial at a time; more background calls would just pile
+		// failures onto a peer that is probably still down.
+		return false
+	default:
+		return true
+	}
+}
+
+// trial records that an outbound call to the peer is starting. An open
+// breaker becomes half-open, so the call's outcome is judged as the
+// trial; in other states trial is a no-op.
+func (b *peerBreaker) trial() {
+	if b.state == breakerOpen {
+		b.state = breakerHalfOpen
+	}
+}
+
+// success resets the breaker to closed with a clean slate. Any
+// successful contact counts, whatever state the breaker was in.
+func (b *peerBreaker) success() {
+	b.state = breakerClosed
+	b.failures = 0
+	b.backoff = 0
+	b.retryAt = time.Time{}
+}
+
+// failure records one failed outbound call. While closed it counts
+// toward the threshold; once open or half-open every failure doubles
+// the backoff up to the cap and pushes the next probe out.
+func (b *peerBreaker) failure() {
+	switch b.state {
+	case breakerClosed:
+		b.failures++
+		if b.failures < breakerFailureThreshold {
+			return
+		}
+		b.backoff = breakerBaseBackoff
+	default:
+		b.backoff *= 2
+		if b.backoff > breakerMaxBackoff {
+			b.backoff = breakerMaxBackoff
+		}
+	}
+	b.state = breakerOpen
+	b.retryAt = b.clk.Now().Add(b.backoff)
+}
+
+// breakerAllowsLocked is allow for callers already holding n.mu. A peer
+// without a breaker has never failed enough to earn one.
+func (n *Node) breakerAllowsLocked(onion string) bool {
+	b := n.breakers[onion]
+	return b == nil || b.allow()
+}
+
+// breakerAllows reports whether background loops may contact the peer.
+func (n *Node) breakerAllows(onion string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.breakerAllowsLocked(onion)
+}
+
+// breakerTrial marks an outbound call attempt; callPeer runs it for
+// every call so a user command against an open breaker half-opens it.
+func (n *Node) breakerTrial(onion string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if b := n.breakers[onion]; b != nil {
+		b.trial()
+	}
+}
+
+// PeerBreaker returns the peer's breaker state ("open" or "half-open")
+// and, when open, the time of the next allowed background probe. A
+// closed or absent breaker reports an empty state.
+func (n *Node) PeerBreaker(onion string) (state string, retryAt time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	b := n.breakers[onion]
+	if b == nil || b.state == breakerClosed {
+		return "", time.Time{}
+	}
+	if b.state == breakerOpen {
+		retryAt = b.retryAt
+	}
+	return b.state.String(), retryAt
+}
@@ -0,0 +1,176 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+func TestPeerBreakerTransitions(t *testing.T) {
+	// Each step is one event against the breaker followed by the
+	// expected state and background-allow answer after it.
+	type step struct {
+		event string // "fail", "ok", "trial", or "advance:<duration>"
+		state breakerState
+		allow bool
+	}
+	cases := []struct {
+		name  string
+		steps []step
+	}{
+		{"stays closed under threshold", []step{
+			{"fail", breakerClosed, true},
+			{"fail", breakerClosed, true},
+			{"fail", breakerClosed, true},
+			{"fail", breakerClosed, true},
+		}},
+		{"opens at threshold", []step{
+			{"fail", breakerClosed, true},
+			{"fail", breakerClosed, true},
+			{"fail", breakerClosed, true},
+			{"fail", breakerClosed, true},
+			{"fail", breakerOpen, false},
+		}},
+		{"open admits a probe after the backoff", []step{
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerOpen, false},
+			{"advance:29m", breakerOpen, false},
+			{"advance:1m", breakerOpen, true},
+		}},
+		{"trial half-opens and blocks more background calls", []step{
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerOpen, false},
+			{"advance:30m", breakerOpen, true},
+			{"trial", breakerHalfOpen, false},
+		}},
+		{"failed trial doubles the backoff", []step{
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerOpen, false},
+			{"advance:30m", breakerOpen, true},
+			{"trial", breakerHalfOpen, false},
+			{"fail", breakerOpen, false},
+			{"advance:59m", breakerOpen, false},
+			{"advance:1m", breakerOpen, true},
+		}},
+		{"successful trial closes and resets the count", []step{
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerOpen, false},
+			{"advance:30m", breakerOpen, true},
+			{"trial", breakerHalfOpen, false},
+			{"ok", breakerClosed, true},
+			// The slate is clean: one more failure does not reopen.
+			{"fail", breakerClosed, true},
+		}},
+		{"success while open closes without a trial", []step{
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerClosed, true}, {"fail", breakerClosed, true},
+			{"fail", breakerOpen, false},
+			{"ok", breakerClosed, true},
+		}},
+		{"trial is a no-op while closed", []step{
+			{"trial", breakerClosed, true},
+			{"fail", breakerClosed, true},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := newFakeClock()
+			b := &peerBreaker{clk: fc}
+			for i, s := range tc.steps {
+				switch s.event {
+				case "fail":
+					b.failure()
+				case "ok":
+					b.success()
+				case "trial":
+					b.trial()
+				default:
+					d, err := time.ParseDuration(s.event[len("advance:"):])
+					if err != nil {
+						t.Fatalf("step %d: bad event %q", i, s.event)
+					}
+					fc.Advance(d)
+				}
+				if b.state != s.state {
+					t.Fatalf("step %d (%s): state = %v, want %v", i, s.event, b.state, s.state)
+				}
+				if got := b.allow(); got != s.allow {
+					t.Fatalf("step %d (%s): allow = %v, want %v", i, s.event, got, s.allow)
+				}
+			}
+		})
+	}
+}
+
+func TestPeerBreakerBackoffCap(t *testing.T) {
+	fc := newFakeClock()
+	b := &peerBreaker{clk: fc}
+	for i := 0; i < breakerFailureThreshold+20; i++ {
+		b.failure()
+		if b.backoff > breakerMaxBackoff {
+			t.Fatalf("failure %d: backoff %v exceeds cap %v", i, b.backoff, breakerMaxBackoff)
+		}
+	}
+	if b.backoff != breakerMaxBackoff {
+		t.Errorf("backoff = %v after many failures, want the cap %v", b.backoff, breakerMaxBackoff)
+	}
+	if !b.retryAt.Equal(fc.Now().Add(breakerMaxBackoff)) {
+		t.Errorf("retryAt = %v, want now+%v", b.retryAt, breakerMaxBackoff)
+	}
+}
+
+func TestBreakerSkipsOpenPeer(t *testing.T) {
+	a, _ := startPairedNodes(t)
+
+	// A registered peer that is not on the network fails every probe;
+	// once the breaker opens the prober must leave it alone.
+	ghostPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghost := keys.OnionAddress(ghostPub)
+	if err := a.AddPeer(ghost, "ghost"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	for i := 0; i < breakerFailureThreshold; i++ {
+		a.probePeers()
+	}
+	state, retryAt := a.PeerBreaker(ghost)
+	if state != "open" {
+		t.Fatalf("breaker state = %q, want open", state)
+	}
+	if !retryAt.After(time.Now()) {
+		t.Errorf("retryAt = %v, want in the future", retryAt)
+	}
+	p, err := a.findPeer(ghost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := p.ProbeFailures
+	a.probePeers()
+	if p.ProbeFailures != failures {
+		t.Errorf("open breaker did not skip the probe: failures %d -> %d", failures, p.ProbeFailures)
+	}
+
+	// A user-initiated call still tries, half-opening the breaker; its
+	// failure reopens with a longer backoff.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := a.HealthCheck(ctx, ghost); err == nil {
+		t.Fatal("HealthCheck of a ghost peer succeeded")
+	}
+	state, retryAt2 := a.PeerBreaker(ghost)
+	if state != "open" {
+		t.Fatalf("breaker state after failed trial = %q, want open", state)
+	}
+	if !retryAt2.After(retryAt) {
+		t.Errorf("failed trial did not extend the backoff: %v -> %v", retryAt, retryAt2)
+	}
+}
@@ -0,0 +1,102 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/tracing"
+)
+
+// defaultPeerCallTimeout bounds one outbound unary peer RPC when the
+// call site does not pick a tighter limit. Tor round trips are slow,
+// but a call that takes longer than this is a stuck circuit, not a slow
+// one.
+const defaultPeerCallTimeout = 2 * time.Minute
+
+// Outbound call failures, classified so internal loops and logs can
+// tell a stuck circuit from a peer that answered with an error.
+var (
+	// ErrPeerTimeout marks a call that did not complete within its
+	// deadline.
+	ErrPeerTimeout = errors.New("peer call timed out")
+	// ErrPeerUnreachable marks a call that never reached the peer: the
+	// dial failed or the transport broke underneath the RPC.
+	ErrPeerUnreachable = errors.New("peer unreachable")
+)
+
+// callPeer runs one outbound unary RPC against the peer at addr under a
+// bounded context: it acquires the pooled connection, hands a client to
+// fn, and folds the outcome into the peer's stats — latency and
+// last-seen on success, the consecutive failure counter on transport
+// failures. A timeout of zero means the node's default (see
+// WithPeerCallTimeout). Failures are classified: ErrPeerTimeout when
+// the bounded deadline ran out, ErrPeerUnreachable when no connection
+// came up, anything else is the peer's own answer and passes through
+// unchanged, since an answer — even a refusal — proves the peer is up.
+//
+// Long-lived streams (chunk transfers, HasChunks) manage their own
+// contexts and stay off this helper: one deadline cannot fit a transfer
+// whose duration depends on the data.
+func (n *Node) callPeer(ctx context.Context, addr string, timeout time.Duration, fn func(ctx context.Context, client pb.PeerClient) error) error {
+	if timeout <= 0 {
+		timeout = n.callTimeout
+	}
+	// An attempt against an open breaker half-opens it: this call is the
+	// trial, and markPeerSeen / markPeerProbeFailed judge its outcome.
+	n.breakerTrial(addr)
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cc, err := n.getConn(cctx, addr)
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, ErrNodeStopped) {
+			// The caller gave up or the node is stopping; neither is
+			// held against the peer.
+			return err
+		}
+		n.markPeerProbeFailed(addr)
+		if cctx.Err() != nil {
+			return fmt.Errorf("%w: dial %s: %v", ErrPeerTimeout, addr, err)
+		}
+		return fmt.Errorf("%w: dial %s: %v", ErrPeerUnreachable, addr, err)
+	}
+	start := time.Now()
+	fctx, span := tracing.StartSpan(cctx, "bbrpc.call")
+	span.SetString("peer", addr)
+	err = fn(n.peerCtx(fctx, addr), pb.NewPeerClient(cc))
+	span.End(err)
+	switch {
+	case err == nil:
+		n.recordPeerLatency(addr, time.Since(start))
+		n.markPeerSeen(addr)
+		return nil
+	case ctx.Err() != nil || errors.Is(err, ErrNodeStopped):
+		return err
+	case cctx.Err() != nil || status.Code(err) == codes.DeadlineExceeded:
+		n.markPeerProbeFailed(addr)
+		return fmt.Errorf("%w: %s: %v", ErrPeerTimeout, addr, err)
+	case status.Code(err) == codes.Unavailable:
+		n.markPeerProbeFailed(addr)
+		return fmt.Errorf("%w: %s: %v", ErrPeerUnreachable, addr, err)
+	default:
+		// The peer answered with an application error; it is reachable.
+		n.markPeerSeen(addr)
+		return err
+	}
+}
+
+// peerCtx attaches trace context to an outbound call when both sides
+// opted into tracing; otherwise the context passes through untouched.
+// The propagated traceparent carries only random IDs, never hostnames.
+func (n *Node) peerCtx(ctx context.Context, addr string) context.Context {
+	if n.tracing && n.PeerSupports(addr, bbrpc.FeatureTracing) {
+		return tracing.Inject(ctx)
+	}
+	return ctx
+}
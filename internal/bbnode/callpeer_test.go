@@ -0,0 +1,127 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// stallNetwork simulates a stuck circuit: once stalled, dials block
+// until the caller's deadline runs out.
+type stallNetwork struct {
+	*netmock.MockNetwork
+
+	mu      sync.Mutex
+	stalled bool
+}
+
+func (s *stallNetwork) setStalled(v bool) {
+	s.mu.Lock()
+	s.stalled = v
+	s.mu.Unlock()
+}
+
+func (s *stallNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	s.mu.Lock()
+	stalled := s.stalled
+	s.mu.Unlock()
+	if stalled {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.MockNetwork.Dial(ctx, addr)
+}
+
+func TestCallPeerTimeout(t *testing.T) {
+	network := netmock.New()
+	b := startTestNode(t, network, "password-b")
+	stall := &stallNetwork{MockNetwork: network}
+	a, err := New("password-a", stall, t.TempDir(),
+		WithPeerCallTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	stall.setStalled(true)
+	err = a.Ping(context.Background(), b.Address(), []byte("hi"))
+	if !errors.Is(err, ErrPeerTimeout) {
+		t.Fatalf("Ping through stalled network: %v, want ErrPeerTimeout", err)
+	}
+	if p, _ := a.findPeer(b.Address()); p.ProbeFailures != 1 {
+		t.Errorf("ProbeFailures after timeout = %d, want 1", p.ProbeFailures)
+	}
+
+	// A working circuit clears the failure counter and records latency.
+	stall.setStalled(false)
+	if err := a.Ping(context.Background(), b.Address(), []byte("hi")); err != nil {
+		t.Fatalf("Ping after unstall: %v", err)
+	}
+	p, _ := a.findPeer(b.Address())
+	if p.ProbeFailures != 0 || p.LastSeen.IsZero() || p.AvgPingMs == 0 {
+		t.Errorf("peer stats after success = %+v", p)
+	}
+}
+
+func TestCallPeerUnreachable(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	ghostPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghost := keys.OnionAddress(ghostPub)
+	if err := a.AddPeer(ghost, "ghost"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	err = a.Ping(context.Background(), ghost, nil)
+	if !errors.Is(err, ErrPeerUnreachable) {
+		t.Fatalf("Ping to unregistered address: %v, want ErrPeerUnreachable", err)
+	}
+	if p, _ := a.findPeer(ghost); p.ProbeFailures != 1 {
+		t.Errorf("ProbeFailures = %d, want 1", p.ProbeFailures)
+	}
+}
+
+func TestCallPeerApplicationError(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// b does not know a, so the RPC is answered with a refusal. That is
+	// the peer's error, not a transport failure: it passes through
+	// unclassified and still counts as contact.
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	err := a.SendMessage(ctx, "bob", "hello?")
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("SendMessage: %v, want PermissionDenied", err)
+	}
+	if errors.Is(err, ErrPeerTimeout) || errors.Is(err, ErrPeerUnreachable) {
+		t.Errorf("application error was classified as transport failure: %v", err)
+	}
+	p, _ := a.findPeer(b.Address())
+	if p.ProbeFailures != 0 || p.LastSeen.IsZero() {
+		t.Errorf("peer stats after application error = %+v", p)
+	}
+}
@@ -0,0 +1,73 @@
+package bbnode
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/starius/barterbackup/bbrpc"
+)
+
+// recordPeerCaps caches the protocol version and feature set the peer
+// at onion advertised in its HealthCheck response. Capabilities live in
+// the registry so gating decisions survive restarts without a fresh
+// health check.
+func (n *Node) recordPeerCaps(onion string, version uint32, features uint64) {
+	n.mu.Lock()
+	p, ok := n.peers[onion]
+	if !ok || (p.ProtoVersion == int(version) && p.Features == features) {
+		n.mu.Unlock()
+		return
+	}
+	p.ProtoVersion = int(version)
+	p.Features = features
+	err := n.savePeersLocked()
+	n.mu.Unlock()
+	if err != nil {
+		log.Printf("persist peer registry: %v", err)
+	}
+}
+
+// PeerProtoVersion returns the bbrpc protocol version the peer at onion
+// last advertised. Zero means the peer predates the version exchange,
+// or has never been health-checked.
+func (n *Node) PeerProtoVersion(onion string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if p, ok := n.peers[onion]; ok {
+		return p.ProtoVersion
+	}
+	return 0
+}
+
+// PeerSupports reports whether the peer at onion advertised the
+// feature. False for unknown peers and for peers from before the
+// capability exchange, so callers fall back to baseline behavior.
+func (n *Node) PeerSupports(onion string, feature uint64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p, ok := n.peers[onion]
+	return ok && p.Features&feature != 0
+}
+
+// requireFeature is the proactive gate for optional RPC behavior: it
+// fails with a clear error before a job starts instead of letting an
+// Unimplemented error surface mid-transfer.
+func (n *Node) requireFeature(onion string, feature uint64, what string) error {
+	if !n.PeerSupports(onion, feature) {
+		return fmt.Errorf("peer %s (protocol v%d) does not support %s", onion, n.PeerProtoVersion(onion), what)
+	}
+	return nil
+}
+
+// localCaps returns the version and features this node advertises;
+// tests shrink them to impersonate an older build.
+func (n *Node) localCaps() (uint32, uint64) {
+	if n.capsOverridden {
+		return n.protoVersion, n.features
+	}
+	features := uint64(bbrpc.LocalFeatures)
+	if n.tracing {
+		features |= bbrpc.FeatureTracing
+	}
+	return bbrpc.ProtocolVersion, features
+}
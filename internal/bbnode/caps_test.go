@@ -0,0 +1,69 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestCapabilityExchange(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if got := b.PeerProtoVersion(a.Address()); got != bbrpc.ProtocolVersion {
+		t.Errorf("PeerProtoVersion = %d, want %d", got, bbrpc.ProtocolVersion)
+	}
+	if !b.PeerSupports(a.Address(), bbrpc.FeatureCDCChunking) {
+		t.Error("PeerSupports(FeatureCDCChunking) = false, want true")
+	}
+	if b.PeerSupports(a.Address(), bbrpc.FeatureCompression) {
+		t.Error("PeerSupports(FeatureCompression) = true for an unimplemented feature")
+	}
+	if err := b.requireFeature(a.Address(), bbrpc.FeatureClientAuth, "client auth"); err != nil {
+		t.Errorf("requireFeature: %v", err)
+	}
+}
+
+func TestCapabilityExchangeWithOlderPeer(t *testing.T) {
+	network := netmock.New()
+	// old impersonates a build from before the version exchange: it
+	// reports version zero and no features.
+	old, err := New("password-old", network, t.TempDir(), withCaps(0, 0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := old.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { old.Stop() })
+	b := startTestNode(t, network, "password-b")
+	if err := b.AddPeer(old.Address(), "legacy"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.HealthCheck(ctx, old.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if got := b.PeerProtoVersion(old.Address()); got != 0 {
+		t.Errorf("PeerProtoVersion = %d, want 0", got)
+	}
+	if b.PeerSupports(old.Address(), bbrpc.FeatureCDCChunking) {
+		t.Error("PeerSupports reports a feature the legacy peer never advertised")
+	}
+	// The gate fires before a job would start, not mid-transfer.
+	if err := b.requireFeature(old.Address(), bbrpc.FeatureChunkResume, "resumable uploads"); err == nil {
+		t.Error("requireFeature: no error for an unsupported feature")
+	}
+}
@@ -0,0 +1,31 @@
+package bbnode
+
+import "time"
+
+// clock abstracts time for the connection pool so tests can drive the
+// idle eviction sweep with a fake clock instead of real sleeps.
+type clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) ticker
+}
+
+// ticker is the subset of time.Ticker the pool needs.
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock implements clock with the real time package. It is the
+// default; tests swap it via withClock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,129 @@
+package bbnode
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// fakeClock implements clock with a manually advanced time.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	t := &fakeTicker{ch: make(chan time.Time)}
+	c.mu.Lock()
+	c.tickers = append(c.tickers, t)
+	c.mu.Unlock()
+	return t
+}
+
+// Advance moves the clock and fires every ticker once with the new time.
+// Sends are blocking, so when Advance returns each ticker consumer has
+// received the tick.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	tickers := append([]*fakeTicker(nil), c.tickers...)
+	c.mu.Unlock()
+	for _, t := range tickers {
+		t.ch <- now
+	}
+}
+
+type fakeTicker struct{ ch chan time.Time }
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+func (t *fakeTicker) Stop()               {}
+
+func TestEvictIdleWithFakeClock(t *testing.T) {
+	fc := newFakeClock()
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	c := startTestNode(t, network, "password-c")
+	b, err := New("password-b", network, t.TempDir(), withClock(fc))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { b.Stop() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck a: %v", err)
+	}
+	fc.Advance(idleTimeout - time.Minute)
+	if _, err := b.HealthCheck(ctx, c.Address()); err != nil {
+		t.Fatalf("HealthCheck c: %v", err)
+	}
+	if got := b.PoolStats().Conns; got != 2 {
+		t.Fatalf("Conns = %d, want 2", got)
+	}
+
+	// The conn to a is now idle past the threshold; the conn to c was
+	// used a minute ago and must survive the sweep.
+	fc.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for b.PoolStats().Conns != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Conns = %d after sweep, want 1", b.PoolStats().Conns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The surviving connection is the one to c: using it again must not
+	// cost another dial.
+	full := b.PoolStats().FullHandshakes
+	if _, err := b.HealthCheck(ctx, c.Address()); err != nil {
+		t.Fatalf("HealthCheck c after sweep: %v", err)
+	}
+	if got := b.PoolStats().FullHandshakes; got != full {
+		t.Errorf("FullHandshakes = %d after reusing c, want %d", got, full)
+	}
+}
+
+func TestStopDuringSweepDoesNotDeadlock(t *testing.T) {
+	fc := newFakeClock()
+	network := netmock.New()
+	b, err := New("password-b", network, t.TempDir(), withClock(fc))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Fire a sweep concurrently with Stop. The Advance goroutine may
+	// stay blocked if the evictor exits first; only Stop must finish.
+	go fc.Advance(evictInterval)
+	done := make(chan struct{})
+	go func() {
+		b.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop deadlocked during an eviction sweep")
+	}
+}
@@ -0,0 +1,147 @@
+// gRPC-level compression for peer RPCs. Manifest pushes, HasChunks
+// bitmaps, and message payloads compress well, so calls carrying them
+// use gzip when the peer advertises FeatureRPCCompression. This is
+// separate from chunk-content compression: chunk frames carry encrypted
+// data that does not compress, and compressing them would only waste
+// CPU, so the chunk-frame RPCs stay uncompressed.
+
+package bbnode
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip" // registers the gzip compressor for both directions
+	"google.golang.org/grpc/stats"
+
+	"github.com/starius/barterbackup/bbrpc"
+)
+
+// compressibleMethods are the peer RPCs whose payloads are worth
+// compressing. Deliberately absent: StoreChunk, FetchChunk, and
+// MigrateChunks (encrypted frames), and the tiny probe RPCs where the
+// gzip header would outweigh the savings.
+var compressibleMethods = map[string]bool{
+	"/bbrpc.Peer/SendMessage":           true,
+	"/bbrpc.Peer/ProposeAgreement":      true,
+	"/bbrpc.Peer/AcceptAgreement":       true,
+	"/bbrpc.Peer/HasChunks":             true,
+	"/bbrpc.Peer/DeleteChunks":          true,
+	"/bbrpc.Peer/HasOwnedChunks":        true,
+	"/bbrpc.Peer/StoreManifest":         true,
+	"/bbrpc.Peer/ListStoredManifests":   true,
+	"/bbrpc.Peer/FetchManifest":         true,
+	"/bbrpc.Peer/AnnounceAddressChange": true,
+	"/bbrpc.Peer/Join":                  true,
+}
+
+// compressCall reports whether the call to method on the peer at addr
+// should ask for gzip: the method must carry a compressible payload and
+// the peer must have advertised support, so older peers never see an
+// encoding they cannot decode.
+func (n *Node) compressCall(addr, method string) bool {
+	return compressibleMethods[method] && n.PeerSupports(addr, bbrpc.FeatureRPCCompression)
+}
+
+// compressUnaryInterceptor adds per-call gzip to compressible unary
+// RPCs on the pooled connection to addr.
+func (n *Node) compressUnaryInterceptor(addr string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if n.compressCall(addr, method) {
+			opts = append(opts, grpc.UseCompressor(gzip.Name))
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// compressStreamInterceptor is the streaming counterpart of
+// compressUnaryInterceptor.
+func (n *Node) compressStreamInterceptor(addr string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if n.compressCall(addr, method) {
+			opts = append(opts, grpc.UseCompressor(gzip.Name))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// rpcCounters accumulate the payload volume exchanged with one peer,
+// before and after compression, updated atomically from the gRPC stats
+// callbacks.
+type rpcCounters struct {
+	sentBytes     atomic.Int64
+	sentWireBytes atomic.Int64
+	recvBytes     atomic.Int64
+	recvWireBytes atomic.Int64
+}
+
+// rpcCountersFor returns the counters of the peer at addr, creating
+// them on first use.
+func (n *Node) rpcCountersFor(addr string) *rpcCounters {
+	n.rpcStatsMu.Lock()
+	defer n.rpcStatsMu.Unlock()
+	if n.rpcStats == nil {
+		n.rpcStats = make(map[string]*rpcCounters)
+	}
+	c, ok := n.rpcStats[addr]
+	if !ok {
+		c = &rpcCounters{}
+		n.rpcStats[addr] = c
+	}
+	return c
+}
+
+// RPCStats is a snapshot of the payload volume exchanged with one peer.
+// WireBytes equal Bytes for uncompressed calls; the gap between them is
+// what compression saved.
+type RPCStats struct {
+	SentBytes     int64
+	SentWireBytes int64
+	RecvBytes     int64
+	RecvWireBytes int64
+}
+
+// PeerRPCStats returns the payload counters of the peer at onion,
+// zeroes for peers never called.
+func (n *Node) PeerRPCStats(onion string) RPCStats {
+	n.rpcStatsMu.Lock()
+	c := n.rpcStats[onion]
+	n.rpcStatsMu.Unlock()
+	if c == nil {
+		return RPCStats{}
+	}
+	return RPCStats{
+		SentBytes:     c.sentBytes.Load(),
+		SentWireBytes: c.sentWireBytes.Load(),
+		RecvBytes:     c.recvBytes.Load(),
+		RecvWireBytes: c.recvWireBytes.Load(),
+	}
+}
+
+// rpcStatsHandler feeds per-peer payload counters from the gRPC stats
+// callbacks of one pooled connection.
+type rpcStatsHandler struct {
+	counters *rpcCounters
+}
+
+func (h *rpcStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *rpcStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.OutPayload:
+		h.counters.sentBytes.Add(int64(p.Length))
+		h.counters.sentWireBytes.Add(int64(p.CompressedLength))
+	case *stats.InPayload:
+		h.counters.recvBytes.Add(int64(p.Length))
+		h.counters.recvWireBytes.Add(int64(p.CompressedLength))
+	}
+}
+
+func (h *rpcStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *rpcStatsHandler) HandleConn(ctx context.Context, _ stats.ConnStats) {}
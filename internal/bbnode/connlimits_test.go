@@ -0,0 +1,78 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestServerClosesIdleConnections(t *testing.T) {
+	network := netmock.New()
+	a, err := New("password-a", network, t.TempDir(),
+		WithServerConnLimits(0, 300*time.Millisecond, 0, 0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	if _, err := b.HealthCheck(context.Background(), a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if got := a.ServerConnStats().Accepted; got < 1 {
+		t.Fatalf("Accepted = %d, want >= 1", got)
+	}
+
+	// b leaves the connection pooled and idle; a's server should retire
+	// it once the configured idle period passes.
+	deadline := time.Now().Add(5 * time.Second)
+	for a.ServerConnStats().Closed < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle connection not closed: stats %+v", a.ServerConnStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandshakeTimeoutCountsStalledConns(t *testing.T) {
+	network := netmock.New()
+	a, err := New("password-a", network, t.TempDir(),
+		WithServerConnLimits(0, 0, 0, 200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+
+	// Connect and send nothing: the cheapest slowloris. The guarded
+	// listener should cut the connection after the handshake timeout.
+	conn, err := network.Dial(context.Background(), a.Address())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for a.ServerConnStats().HandshakeTimeouts < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stalled connection not timed out: stats %+v", a.ServerConnStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := a.ServerConnStats().Accepted; got < 1 {
+		t.Fatalf("Accepted = %d, want >= 1", got)
+	}
+}
@@ -0,0 +1,176 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Disk watchdog defaults. The soft threshold stops accepting peer data;
+// the hard threshold also pauses local jobs that write temp data.
+const (
+	defaultDiskSoftBytes     = 5 << 30
+	defaultDiskHardBytes     = 1 << 30
+	defaultDiskCheckInterval = time.Minute
+)
+
+// diskConfigKey holds the watchdog settings in the secstore.
+const diskConfigKey = "config/diskwatch"
+
+// DiskConfig are the runtime-configurable watchdog settings.
+type DiskConfig struct {
+	// SoftBytes: below this much free space, StoreChunk and
+	// StoreManifest are rejected with ResourceExhausted.
+	SoftBytes int64 `json:"soft_bytes"`
+	// HardBytes: below this, running local jobs are paused too.
+	HardBytes int64 `json:"hard_bytes"`
+	// CheckInterval is how often free space is measured.
+	CheckInterval time.Duration `json:"check_interval"`
+}
+
+// DiskStatus is the watchdog's latest measurement.
+type DiskStatus struct {
+	// FreeBytes is the free space under the data dir at CheckedAt.
+	FreeBytes int64
+	// Threshold is "", "soft", or "hard".
+	Threshold string
+	CheckedAt time.Time
+}
+
+// loadDiskConfig reads the persisted watchdog settings, falling back to
+// the defaults. Called from New.
+func (n *Node) loadDiskConfig() error {
+	n.diskCfg = DiskConfig{
+		SoftBytes:     defaultDiskSoftBytes,
+		HardBytes:     defaultDiskHardBytes,
+		CheckInterval: defaultDiskCheckInterval,
+	}
+	var cfg DiskConfig
+	err := n.sec.GetJSON(diskConfigKey, &cfg)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	n.diskCfg = cfg
+	return nil
+}
+
+// DiskConfig returns the current watchdog settings.
+func (n *Node) DiskConfig() DiskConfig {
+	n.diskMu.Lock()
+	defer n.diskMu.Unlock()
+	return n.diskCfg
+}
+
+// SetDiskConfig validates, persists, and applies new watchdog settings.
+// The next check uses them; it runs immediately.
+func (n *Node) SetDiskConfig(cfg DiskConfig) error {
+	if cfg.SoftBytes < 0 || cfg.HardBytes < 0 || cfg.CheckInterval <= 0 {
+		return fmt.Errorf("disk watchdog settings must be positive")
+	}
+	if cfg.HardBytes > cfg.SoftBytes {
+		return fmt.Errorf("hard threshold %d above soft threshold %d", cfg.HardBytes, cfg.SoftBytes)
+	}
+	if err := n.sec.PutJSON(diskConfigKey, &cfg); err != nil {
+		return fmt.Errorf("store disk watchdog settings: %w", err)
+	}
+	n.diskMu.Lock()
+	n.diskCfg = cfg
+	n.diskMu.Unlock()
+	n.checkDisk()
+	return nil
+}
+
+// DiskStatus returns the watchdog's latest measurement. CheckedAt is
+// zero before the first check.
+func (n *Node) DiskStatus() DiskStatus {
+	n.diskMu.Lock()
+	defer n.diskMu.Unlock()
+	return n.diskStatus
+}
+
+// diskDegraded reports whether peer writes must be rejected.
+func (n *Node) diskDegraded() bool {
+	n.diskMu.Lock()
+	defer n.diskMu.Unlock()
+	return n.diskStatus.Threshold != ""
+}
+
+// runDiskWatch measures free space on the configured interval until the
+// node stops.
+func (n *Node) runDiskWatch(stop <-chan struct{}) {
+	for {
+		n.checkDisk()
+		n.diskMu.Lock()
+		interval := n.diskCfg.CheckInterval
+		n.diskMu.Unlock()
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkDisk measures free space under the data dir and applies the
+// thresholds. Crossing the hard threshold pauses running jobs; they are
+// not auto-resumed, so the operator decides when space is back.
+func (n *Node) checkDisk() {
+	free, err := diskFree(n.dataDir)
+	if err != nil {
+		log.Printf("disk watchdog: %v", err)
+		return
+	}
+	n.diskMu.Lock()
+	cfg := n.diskCfg
+	prev := n.diskStatus.Threshold
+	threshold := ""
+	switch {
+	case free < cfg.HardBytes:
+		threshold = "hard"
+	case free < cfg.SoftBytes:
+		threshold = "soft"
+	}
+	n.diskStatus = DiskStatus{FreeBytes: free, Threshold: threshold, CheckedAt: time.Now()}
+	n.diskMu.Unlock()
+	if threshold != prev {
+		log.Printf("disk watchdog: %d bytes free, threshold %q (was %q)", free, threshold, prev)
+	}
+	if threshold == "hard" && prev != "hard" {
+		n.pauseRunningJobs("disk space below hard threshold")
+	}
+}
+
+// pauseRunningJobs pauses every running job, e.g. when the disk is
+// about to fill.
+func (n *Node) pauseRunningJobs(reason string) {
+	n.jobsMu.Lock()
+	ids := make([]string, 0, len(n.runningJobs))
+	for id := range n.runningJobs {
+		ids = append(ids, id)
+	}
+	n.jobsMu.Unlock()
+	for _, id := range ids {
+		if err := n.PauseJob(id); err != nil {
+			log.Printf("pause job %s (%s): %v", id, reason, err)
+		} else {
+			log.Printf("paused job %s: %s", id, reason)
+		}
+	}
+}
+
+// diskFree returns the free space available to the daemon on the
+// filesystem holding dir.
+func diskFree(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,90 @@
+package bbnode
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestDiskWatchdog(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "file.txt", "fits on disk")
+
+	// An absurd soft threshold makes any real filesystem look full:
+	// b must refuse new peer data.
+	full := DiskConfig{
+		SoftBytes:     math.MaxInt64,
+		HardBytes:     defaultDiskHardBytes,
+		CheckInterval: defaultDiskCheckInterval,
+	}
+	if err := b.SetDiskConfig(full); err != nil {
+		t.Fatalf("SetDiskConfig: %v", err)
+	}
+	if got := b.DiskStatus().Threshold; got != "soft" {
+		t.Fatalf("threshold = %q, want soft", got)
+	}
+	if _, err := a.CreateBackup(ctx, []string{"bob"}, source, BackupOptions{}); err == nil {
+		t.Error("CreateBackup succeeded against a full peer")
+	}
+
+	// The hard threshold additionally pauses running jobs.
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	job := &Job{Kind: "restore"}
+	go func() {
+		done <- b.runJob(context.Background(), job, func(ctx context.Context) error {
+			close(started)
+			for {
+				if err := checkpoint(ctx); err != nil {
+					return err
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}()
+	<-started
+	full.HardBytes = math.MaxInt64
+	if err := b.SetDiskConfig(full); err != nil {
+		t.Fatalf("SetDiskConfig hard: %v", err)
+	}
+	if got := b.DiskStatus().Threshold; got != "hard" {
+		t.Fatalf("threshold = %q, want hard", got)
+	}
+	if got := jobByID(t, b, job.ID).State; got != "paused" {
+		t.Errorf("job state after hard trip = %q, want paused", got)
+	}
+	if err := b.CancelJob(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	// Back to sane thresholds the node accepts data again.
+	if err := b.SetDiskConfig(DiskConfig{
+		SoftBytes:     1,
+		HardBytes:     1,
+		CheckInterval: defaultDiskCheckInterval,
+	}); err != nil {
+		t.Fatalf("SetDiskConfig reset: %v", err)
+	}
+	if got := b.DiskStatus().Threshold; got != "" {
+		t.Fatalf("threshold after reset = %q, want none", got)
+	}
+	if _, err := a.CreateBackup(ctx, []string{"bob"}, source, BackupOptions{}); err != nil {
+		t.Errorf("CreateBackup after reset: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// startDrainNode is startTestNode with a custom drain timeout.
+func startDrainNode(t *testing.T, network Network, password string, drain time.Duration) *Node {
+	t.Helper()
+	n, err := New(password, network, t.TempDir(), WithDrainTimeout(drain))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { n.Stop() })
+	return n
+}
+
+// openManifestStream starts a StoreManifest stream from b to a and sends
+// the header frame, leaving the stream open so a has an in-flight RPC.
+func openManifestStream(t *testing.T, ctx context.Context, a, b *Node) pb.Peer_StoreManifestClient {
+	t.Helper()
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	stream, err := pb.NewPeerClient(cc).StoreManifest(ctx)
+	if err != nil {
+		t.Fatalf("StoreManifest: %v", err)
+	}
+	if err := stream.Send(&pb.StoreManifestRequest{BackupId: "slow", Data: []byte("part one ")}); err != nil {
+		t.Fatalf("Send header: %v", err)
+	}
+	return stream
+}
+
+func TestStopDrainsInFlightStream(t *testing.T) {
+	network := netmock.New()
+	a := startDrainNode(t, network, "password-a", 10*time.Second)
+	b := startTestNode(t, network, "password-b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openManifestStream(t, ctx, a, b)
+
+	stopDone := make(chan struct{})
+	go func() {
+		a.Stop()
+		close(stopDone)
+	}()
+	// Let GracefulStop start draining before the stream finishes.
+	time.Sleep(100 * time.Millisecond)
+	if err := stream.Send(&pb.StoreManifestRequest{Data: []byte("part two")}); err != nil {
+		t.Fatalf("Send during drain: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatalf("CloseAndRecv during drain: %v", err)
+	}
+	select {
+	case <-stopDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return after the stream finished")
+	}
+}
+
+func TestStopCutsOffStreamAfterDrainTimeout(t *testing.T) {
+	network := netmock.New()
+	a := startDrainNode(t, network, "password-a", 200*time.Millisecond)
+	b := startTestNode(t, network, "password-b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream := openManifestStream(t, ctx, a, b)
+
+	// The stream is never finished, so Stop must fall back to the hard
+	// stop once the drain timeout runs out instead of blocking forever.
+	start := time.Now()
+	a.Stop()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Stop took %v, want roughly the drain timeout", elapsed)
+	}
+	if _, err := stream.CloseAndRecv(); err == nil {
+		t.Fatal("stream survived the hard stop, want error")
+	}
+}
@@ -0,0 +1,173 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/chunkstore"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// TestFetchChunkMemoryBounded streams a blob far bigger than the
+// flow-control windows to a deliberately slow reader and checks the
+// heap never approaches the blob size: the server must hold one frame
+// per stream, not the whole blob.
+func TestFetchChunkMemoryBounded(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams 64 MiB")
+	}
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	const blobSize = 64 << 20
+	blob := make([]byte, blobSize)
+	rand.Read(blob)
+	// Too big to arrive over StoreChunk; plant it in the store directly.
+	if err := a.chunks.Put(b.Address(), "bigchunk", blob); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	blob = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	stream, err := pb.NewPeerClient(cc).FetchChunk(ctx, &pb.FetchChunkRequest{Name: "bigchunk"})
+	if err != nil {
+		t.Fatalf("FetchChunk: %v", err)
+	}
+
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	baseline := ms.HeapAlloc
+
+	var total, frames int
+	var maxHeap uint64
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		total += len(frame.Data)
+		frames++
+		if frames%64 == 0 {
+			time.Sleep(time.Millisecond) // slow reader
+		}
+		if frames%1024 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > maxHeap {
+				maxHeap = ms.HeapAlloc
+			}
+		}
+	}
+	if total != blobSize {
+		t.Fatalf("received %d bytes, want %d", total, blobSize)
+	}
+	// Client and server run in one process here, so the bound covers
+	// both sides' buffers. Half the blob would mean unbounded buffering.
+	if growth := int64(maxHeap) - int64(baseline); growth > blobSize/2 {
+		t.Errorf("heap grew by %d bytes streaming a %d byte blob", growth, blobSize)
+	}
+}
+
+// closeTrackingBackend wraps an FS backend and counts how many readers
+// handed out by Open have been closed again.
+type closeTrackingBackend struct {
+	*chunkstore.FSBackend
+	opened int32
+	closed int32
+}
+
+func (b *closeTrackingBackend) Open(owner, name string) (io.ReadCloser, error) {
+	rc, err := b.FSBackend.Open(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&b.opened, 1)
+	return &closeTrackingReader{ReadCloser: rc, closed: &b.closed}, nil
+}
+
+type closeTrackingReader struct {
+	io.ReadCloser
+	closed *int32
+}
+
+func (r *closeTrackingReader) Close() error {
+	atomic.AddInt32(r.closed, 1)
+	return r.ReadCloser.Close()
+}
+
+// TestFetchChunkCancelReleasesFile cancels a fetch mid-stream without
+// reading it to the end and checks the server closes the blob promptly.
+func TestFetchChunkCancelReleasesFile(t *testing.T) {
+	network := netmock.New()
+	fsBackend, err := chunkstore.NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSBackend: %v", err)
+	}
+	backend := &closeTrackingBackend{FSBackend: fsBackend}
+	a, err := New("password-a", network, t.TempDir(), WithChunkBackend(backend))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	blob := make([]byte, 4<<20)
+	if err := a.chunks.Put(b.Address(), "bigchunk", blob); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	dialCtx, dialCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer dialCancel()
+	cc, err := b.getConn(dialCtx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := pb.NewPeerClient(cc).FetchChunk(ctx, &pb.FetchChunkRequest{Name: "bigchunk"})
+	if err != nil {
+		cancel()
+		t.Fatalf("FetchChunk: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		cancel()
+		t.Fatalf("Recv: %v", err)
+	}
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&backend.closed) != atomic.LoadInt32(&backend.opened) {
+		if time.Now().After(deadline) {
+			t.Fatalf("blob reader not closed after cancel: %d opened, %d closed",
+				atomic.LoadInt32(&backend.opened), atomic.LoadInt32(&backend.closed))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,114 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// groupsKey is the secstore key holding named peer groups.
+const groupsKey = "peers/groups"
+
+// CreateGroup defines (or redefines) a named group of peers that can be
+// used wherever a backup target is expected. Members are resolved
+// through the registry, so aliases work.
+func (n *Node) CreateGroup(name string, members []string) error {
+	if name == "" {
+		return fmt.Errorf("group name must not be empty")
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("group %q needs at least one member", name)
+	}
+	onions := make([]string, 0, len(members))
+	seen := make(map[string]bool)
+	for _, m := range members {
+		p, err := n.findPeer(m)
+		if err != nil {
+			return err
+		}
+		if !seen[p.Onion] {
+			seen[p.Onion] = true
+			onions = append(onions, p.Onion)
+		}
+	}
+	groups, err := n.Groups()
+	if err != nil {
+		return err
+	}
+	groups[name] = onions
+	return n.sec.PutJSON(groupsKey, groups)
+}
+
+// DeleteGroup removes a named group; its member peers stay registered.
+func (n *Node) DeleteGroup(name string) error {
+	groups, err := n.Groups()
+	if err != nil {
+		return err
+	}
+	if _, ok := groups[name]; !ok {
+		return fmt.Errorf("unknown group %q", name)
+	}
+	delete(groups, name)
+	return n.sec.PutJSON(groupsKey, groups)
+}
+
+// Groups returns all named peer groups.
+func (n *Node) Groups() (map[string][]string, error) {
+	groups := make(map[string][]string)
+	err := n.sec.GetJSON(groupsKey, &groups)
+	if err != nil && !errors.Is(err, secstore.ErrNotFound) {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GroupNames returns the group names, sorted.
+func (n *Node) GroupNames() ([]string, error) {
+	groups, err := n.Groups()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// resolvePeerSpecs expands a mix of group names, aliases, and onion
+// addresses into a deduplicated list of onion addresses, preserving
+// order.
+func (n *Node) resolvePeerSpecs(specs []string) ([]string, error) {
+	groups, err := n.Groups()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	seen := make(map[string]bool)
+	add := func(onion string) {
+		if !seen[onion] {
+			seen[onion] = true
+			out = append(out, onion)
+		}
+	}
+	for _, spec := range specs {
+		if members, ok := groups[spec]; ok {
+			for _, onion := range members {
+				add(onion)
+			}
+			continue
+		}
+		p, err := n.findPeer(spec)
+		if err != nil {
+			return nil, err
+		}
+		add(p.Onion)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no backup target peers given")
+	}
+	return out, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package bbnode
+
+import "os"
+
+// hardlinkKey is unused on platforms without inode information; every
+// file is stored as a plain file there.
+type hardlinkKey struct{}
+
+func hardlinkID(info os.FileInfo) (hardlinkKey, bool) {
+	return hardlinkKey{}, false
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package bbnode
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardlinkKey identifies a file's inode, so several directory entries
+// of the same file are detected as one hardlink group.
+type hardlinkKey struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkID returns the inode key of a file with more than one link.
+// ok is false for singly-linked files; those never start a group.
+func hardlinkID(info os.FileInfo) (hardlinkKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return hardlinkKey{}, false
+	}
+	return hardlinkKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,154 @@
+package bbnode
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+)
+
+// hasChunksWindow is how many request batches CheckChunks keeps in
+// flight before waiting for a bitmap. Two keeps the pipe full without
+// either side buffering more than a couple of batches.
+const hasChunksWindow = 2
+
+// ChunkIter yields blob names one at a time and reports false once the
+// sequence is exhausted.
+type ChunkIter func() (name string, ok bool)
+
+// SliceChunkIter returns a ChunkIter over names.
+func SliceChunkIter(names []string) ChunkIter {
+	i := 0
+	return func() (string, bool) {
+		if i >= len(names) {
+			return "", false
+		}
+		name := names[i]
+		i++
+		return name, true
+	}
+}
+
+// MissingChunks iterates over the names a CheckChunks call found absent
+// on the peer, in input order. Iterate with Next and check Err once it
+// reports false.
+type MissingChunks struct {
+	stream  pb.Peer_HasChunksClient
+	iter    ChunkIter
+	pending [][]string // batches sent, bitmaps outstanding
+	ready   []string   // missing names from answered batches
+	sentAll bool
+	drained bool
+	err     error
+}
+
+// CheckChunks asks the peer which of the names yielded by iter it
+// stores for us and returns an iterator over the missing ones. The
+// names go out in batches over a single HasChunks stream with a bounded
+// number of batches in flight, so checking millions of names never
+// holds them all in memory on either side.
+func (n *Node) CheckChunks(ctx context.Context, aliasOrOnion string, iter ChunkIter) (*MissingChunks, error) {
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := n.getConn(ctx, p.Onion)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := pb.NewPeerClient(cc).HasChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &MissingChunks{stream: stream, iter: iter}
+	for len(m.pending) < hasChunksWindow && !m.sentAll {
+		if err := m.sendBatch(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// sendBatch sends the next batch of names, closing the send side once
+// iter is exhausted.
+func (m *MissingChunks) sendBatch() error {
+	if m.sentAll {
+		return nil
+	}
+	var batch []string
+	for len(batch) < bbrpc.HasChunksBatch {
+		name, ok := m.iter()
+		if !ok {
+			break
+		}
+		batch = append(batch, name)
+	}
+	if len(batch) == 0 {
+		m.sentAll = true
+		return m.stream.CloseSend()
+	}
+	if err := m.stream.Send(&pb.HasChunksRequest{Names: batch}); err != nil {
+		return err
+	}
+	m.pending = append(m.pending, batch)
+	return nil
+}
+
+// Next returns the next missing name. It reports false at the end of
+// the set and on error; Err tells the two apart.
+func (m *MissingChunks) Next() (string, bool) {
+	for {
+		if m.err != nil {
+			return "", false
+		}
+		if len(m.ready) > 0 {
+			name := m.ready[0]
+			m.ready = m.ready[1:]
+			return name, true
+		}
+		if len(m.pending) == 0 {
+			// Drain the trailing EOF so a server-side error on close
+			// still surfaces.
+			if m.sentAll && !m.drained {
+				m.drained = true
+				if _, err := m.stream.Recv(); err != io.EOF {
+					if err == nil {
+						err = fmt.Errorf("unexpected extra bitmap after the last batch")
+					}
+					m.err = err
+				}
+			}
+			return "", false
+		}
+		resp, err := m.stream.Recv()
+		if err == io.EOF {
+			m.err = fmt.Errorf("stream closed with %d batches unanswered", len(m.pending))
+			return "", false
+		} else if err != nil {
+			m.err = err
+			return "", false
+		}
+		batch := m.pending[0]
+		m.pending = m.pending[1:]
+		if len(resp.Present) < (len(batch)+7)/8 {
+			m.err = fmt.Errorf("bitmap of %d bytes for a batch of %d names", len(resp.Present), len(batch))
+			return "", false
+		}
+		for i, name := range batch {
+			if resp.Present[i/8]&(1<<(i%8)) == 0 {
+				m.ready = append(m.ready, name)
+			}
+		}
+		if err := m.sendBatch(); err != nil {
+			m.err = err
+			return "", false
+		}
+	}
+}
+
+// Err returns the error that ended the iteration early, if any.
+func (m *MissingChunks) Err() error {
+	return m.err
+}
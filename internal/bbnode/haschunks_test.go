@@ -0,0 +1,151 @@
+package bbnode
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestCheckChunks(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Store every third chunk on a; the set crosses batch boundaries.
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	client := pb.NewPeerClient(cc)
+	const total = 250
+	names := make([]string, total)
+	var wantMissing []string
+	for i := range names {
+		names[i] = fmt.Sprintf("c-%03d", i)
+		if i%3 == 0 {
+			if _, err := client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: names[i], Data: []byte("x")}); err != nil {
+				t.Fatalf("StoreChunk %s: %v", names[i], err)
+			}
+		} else {
+			wantMissing = append(wantMissing, names[i])
+		}
+	}
+
+	missing, err := b.CheckChunks(ctx, "alice", SliceChunkIter(names))
+	if err != nil {
+		t.Fatalf("CheckChunks: %v", err)
+	}
+	var got []string
+	for {
+		name, ok := missing.Next()
+		if !ok {
+			break
+		}
+		got = append(got, name)
+	}
+	if err := missing.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(wantMissing) {
+		t.Errorf("missing = %v, want %v", got, wantMissing)
+	}
+}
+
+func TestCheckChunksEmpty(t *testing.T) {
+	_, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	missing, err := b.CheckChunks(ctx, "alice", SliceChunkIter(nil))
+	if err != nil {
+		t.Fatalf("CheckChunks: %v", err)
+	}
+	if name, ok := missing.Next(); ok {
+		t.Errorf("Next on empty set returned %q", name)
+	}
+	if err := missing.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+}
+
+func TestCheckChunksBadName(t *testing.T) {
+	_, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	missing, err := b.CheckChunks(ctx, "alice", SliceChunkIter([]string{"UPPER/CASE"}))
+	if err != nil {
+		t.Fatalf("CheckChunks: %v", err)
+	}
+	for {
+		if _, ok := missing.Next(); !ok {
+			break
+		}
+	}
+	if status.Code(missing.Err()) != codes.InvalidArgument {
+		t.Errorf("Err = %v, want InvalidArgument", missing.Err())
+	}
+}
+
+func BenchmarkCheckChunks1M(b *testing.B) {
+	network := netmock.New()
+	server, err := New("password-a", network, b.TempDir())
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	caller, err := New("password-b", network, b.TempDir())
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	for _, n := range []*Node{server, caller} {
+		n := n
+		if err := n.Start(context.Background()); err != nil {
+			b.Fatalf("Start: %v", err)
+		}
+		b.Cleanup(func() { n.Stop() })
+	}
+	if err := server.AddPeer(caller.Address(), "caller"); err != nil {
+		b.Fatalf("AddPeer: %v", err)
+	}
+	if err := caller.AddPeer(server.Address(), "server"); err != nil {
+		b.Fatalf("AddPeer: %v", err)
+	}
+
+	const hashes = 1 << 20
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next := 0
+		missing, err := caller.CheckChunks(ctx, "server", func() (string, bool) {
+			if next >= hashes {
+				return "", false
+			}
+			name := fmt.Sprintf("c-%07d", next)
+			next++
+			return name, true
+		})
+		if err != nil {
+			b.Fatalf("CheckChunks: %v", err)
+		}
+		got := 0
+		for {
+			if _, ok := missing.Next(); !ok {
+				break
+			}
+			got++
+		}
+		if err := missing.Err(); err != nil {
+			b.Fatalf("Err: %v", err)
+		}
+		if got != hashes {
+			b.Fatalf("missing %d names, want %d", got, hashes)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Right after Start the check retries quickly for a bounded period
+// before declaring the node degraded: Tor sometimes publishes the
+// descriptor slowly, and that should not fail Start outright.
+const (
+	selfCheckRetryInterval = 15 * time.Second
+	selfCheckRetryPeriod   = 5 * time.Minute
+	selfCheckTimeout       = 90 * time.Second
+)
+
+// Health is the node's reachability as seen by the self-dial check.
+type Health struct {
+	// State is "unknown" until the first check completes, then "ok" or
+	// "degraded".
+	State string
+	// CheckedAt is when the last check finished.
+	CheckedAt time.Time
+	// Latency is how long the last successful self-dial took.
+	Latency time.Duration
+	// Err describes the last failure while degraded.
+	Err string
+}
+
+// Health returns the latest self-check result.
+func (n *Node) Health() Health {
+	n.healthMu.Lock()
+	defer n.healthMu.Unlock()
+	if n.health.State == "" {
+		return Health{State: "unknown"}
+	}
+	return n.health
+}
+
+// runSelfCheck proves the published onion address is actually reachable
+// and keeps proving it periodically. It runs until Stop.
+func (n *Node) runSelfCheck(stop <-chan struct{}) {
+	deadline := time.Now().Add(selfCheckRetryPeriod)
+	for !n.selfCheckOnce() && time.Now().Before(deadline) {
+		select {
+		case <-stop:
+			return
+		case <-time.After(selfCheckRetryInterval):
+		}
+	}
+	ticker := time.NewTicker(n.selfCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n.selfCheckOnce()
+		}
+	}
+}
+
+// selfCheckOnce runs one self-dial and records the result.
+func (n *Node) selfCheckOnce() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := n.SelfCheck(ctx)
+	h := Health{State: "ok", CheckedAt: time.Now(), Latency: time.Since(start)}
+	if err != nil {
+		h.State = "degraded"
+		h.Err = err.Error()
+		h.Latency = 0
+	}
+	n.healthMu.Lock()
+	n.health = h
+	n.healthMu.Unlock()
+	if errors.Is(err, ErrIdentityConflict) {
+		log.Printf("IDENTITY CONFLICT: another daemon is serving %s — was bbd started on a second machine with the same password?", n.Address())
+		if n.strictIdentity {
+			log.Printf("strict-identity is set; stopping this instance")
+			// Stop closes the channel runSelfCheck selects on, so it
+			// must not run on this goroutine.
+			go n.Stop()
+		}
+	}
+	return err == nil
+}
@@ -0,0 +1,58 @@
+package bbnode
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HostingInfo describes the data this node stores for one peer.
+type HostingInfo struct {
+	Onion string
+	// Alias is the registry alias, empty for owners no longer in the
+	// registry (e.g. data in the post-wipe grace period).
+	Alias      string
+	Chunks     int
+	Bytes      int64
+	QuotaBytes int64
+	// OldestChunk and NewestChunk are the stored-blob timestamps;
+	// LastAccess is when the peer last read or wrote, zero if not since
+	// the node started.
+	OldestChunk time.Time
+	NewestChunk time.Time
+	LastAccess  time.Time
+}
+
+// ListHosting aggregates the chunk store by owner, so the operator can
+// see whose data the node holds and how close each peer is to its
+// quota. It serves from the store's tracked counters and is sorted by
+// bytes descending.
+func (n *Node) ListHosting() ([]HostingInfo, error) {
+	usages, err := n.chunks.OwnerUsages()
+	if err != nil {
+		return nil, fmt.Errorf("aggregate chunk store: %w", err)
+	}
+	out := make([]HostingInfo, 0, len(usages))
+	for _, u := range usages {
+		info := HostingInfo{
+			Onion:       u.Owner,
+			Chunks:      u.Chunks,
+			Bytes:       u.Bytes,
+			QuotaBytes:  n.PeerQuota(u.Owner),
+			OldestChunk: u.Oldest,
+			NewestChunk: u.Newest,
+			LastAccess:  u.LastAccess,
+		}
+		if p, err := n.findPeer(u.Owner); err == nil {
+			info.Alias = p.Alias
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return out[i].Onion < out[j].Onion
+	})
+	return out, nil
+}
@@ -0,0 +1,321 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/atomicfile"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Identity modes. In the derived mode the onion key is a pure function
+// of the password, so the node is stateless but a password change moves
+// the onion address. In the stored mode the onion key is a random seed
+// sealed in the secstore, so the address survives password changes.
+const (
+	IdentityModeDerived = "derived"
+	IdentityModeStored  = "stored"
+)
+
+// identityModeFile records the data dir's identity mode so a later run
+// cannot silently come up under a different onion address.
+const identityModeFile = "identity-mode"
+
+// identitySeedKey is the secstore key holding the stored identity seed.
+// The secstore seals it with XChaCha20-Poly1305 under a password-derived
+// key, so a password change only re-encrypts the seed.
+const identitySeedKey = "identity/seed"
+
+// addressChangeSigContext prefixes the bytes signed in an address-change
+// notice, so the signature cannot be confused with any other use of the
+// identity key.
+const addressChangeSigContext = "barterbackup/address-change/v1\n"
+
+// moveNoticeKey is the secstore key holding the node's own signed
+// address-change notice, so it can be re-announced to peers that missed
+// it. The old key is gone after the migration; only the stored notice
+// can still prove the move.
+const moveNoticeKey = "identity/move-notice"
+
+// addrChangeGrace is how long the vacated address keeps resolving as an
+// alias of the moved peer, so scripts and habits have time to catch up.
+const addrChangeGrace = 30 * 24 * time.Hour
+
+// moveNotice is a stored signed address-change notice.
+type moveNotice struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Seq increases with every notice the identity signs; receivers
+	// reject notices older than the last one they applied.
+	Seq uint64 `json:"seq"`
+	Sig []byte `json:"sig"`
+}
+
+// addressChangeBytes is the canonical byte string an address-change
+// notice signs: the old and new onion addresses and the sequence number
+// under a fixed context.
+func addressChangeBytes(oldOnion, newOnion string, seq uint64) []byte {
+	return []byte(addressChangeSigContext + oldOnion + "|" + newOnion + "|" + strconv.FormatUint(seq, 10))
+}
+
+// IdentityMode returns the node's effective identity mode.
+func (n *Node) IdentityMode() string {
+	return n.identityMode
+}
+
+// resolveIdentity reconciles the requested identity mode with the one
+// recorded in the data dir and returns the onion key for the winner. A
+// first run records the requested mode (derived when unspecified); later
+// runs must match it, except for the one-way migration MigrateIdentity
+// performs.
+func (n *Node) resolveIdentity(dataDir string) (ed25519.PrivateKey, error) {
+	modePath := filepath.Join(dataDir, identityModeFile)
+	recorded := ""
+	if data, err := os.ReadFile(modePath); err == nil {
+		recorded = strings.TrimSpace(string(data))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read identity mode: %w", err)
+	}
+	mode := n.identityMode
+	switch {
+	case recorded == "" && mode == "":
+		mode = IdentityModeDerived
+	case recorded == "":
+	case mode == "" || mode == recorded:
+		mode = recorded
+	default:
+		return nil, fmt.Errorf("data dir records identity mode %q, refusing to run as %q (migration is one-way, see MigrateIdentity)", recorded, mode)
+	}
+	switch mode {
+	case IdentityModeDerived, IdentityModeStored:
+	default:
+		return nil, fmt.Errorf("unknown identity mode %q (want %s or %s)", mode, IdentityModeDerived, IdentityModeStored)
+	}
+	if recorded == "" {
+		if err := atomicfile.WriteFile(modePath, []byte(mode+"\n"), 0o600); err != nil {
+			return nil, fmt.Errorf("record identity mode: %w", err)
+		}
+	}
+	n.identityMode = mode
+	if mode == IdentityModeDerived {
+		key, err := keys.OnionKeyFromMaster(n.masterPriv)
+		if err != nil {
+			return nil, fmt.Errorf("derive onion key: %w", err)
+		}
+		return key, nil
+	}
+	return n.loadOrCreateStoredIdentity()
+}
+
+// loadOrCreateStoredIdentity returns the sealed identity key, generating
+// a fresh random one on the first stored-mode run.
+func (n *Node) loadOrCreateStoredIdentity() (ed25519.PrivateKey, error) {
+	seed, err := n.sec.Get(identitySeedKey)
+	if errors.Is(err, secstore.ErrNotFound) {
+		seed = make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, fmt.Errorf("generate identity seed: %w", err)
+		}
+		if err := n.sec.Put(identitySeedKey, seed); err != nil {
+			return nil, fmt.Errorf("store identity seed: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("load identity seed: %w", err)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// MigrateIdentity switches a derived-identity node to the stored mode.
+// It generates a fresh random identity key — reusing the derived key
+// would keep the address password-crackable forever — seals it in the
+// secstore, records the new mode, and announces the new address to every
+// registered peer with a notice signed by the current key. The notice is
+// kept for AnnounceMove to re-send later. The migration is one-way; the
+// new address takes over on the next unlock, so the node keeps serving
+// at the old one until then. It returns the new onion address and how
+// many peers acknowledged the notice.
+func (n *Node) MigrateIdentity(ctx context.Context) (newOnion string, notified int, err error) {
+	if n.identityMode == IdentityModeStored {
+		return "", 0, fmt.Errorf("identity is already in the stored mode")
+	}
+	signKey, err := n.signingKey()
+	if err != nil {
+		return "", 0, err
+	}
+	oldOnion := keys.OnionAddress(signKey.Public().(ed25519.PublicKey))
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", 0, fmt.Errorf("generate identity seed: %w", err)
+	}
+	newKey := ed25519.NewKeyFromSeed(seed)
+	newOnion = keys.OnionAddress(newKey.Public().(ed25519.PublicKey))
+	if err := n.sec.Put(identitySeedKey, seed); err != nil {
+		return "", 0, fmt.Errorf("store identity seed: %w", err)
+	}
+	// Each notice the identity ever signs gets a higher seq than the one
+	// before, so receivers can reject replays of captured notices.
+	notice := moveNotice{Old: oldOnion, New: newOnion, Seq: 1}
+	var prev moveNotice
+	if err := n.sec.GetJSON(moveNoticeKey, &prev); err == nil {
+		notice.Seq = prev.Seq + 1
+	} else if !errors.Is(err, secstore.ErrNotFound) {
+		return "", 0, err
+	}
+	notice.Sig = ed25519.Sign(signKey, addressChangeBytes(oldOnion, newOnion, notice.Seq))
+	if err := n.sec.PutJSON(moveNoticeKey, notice); err != nil {
+		return "", 0, fmt.Errorf("store move notice: %w", err)
+	}
+	// Record the mode last: until this write the data dir still comes up
+	// derived, so a crash in between loses only an unused seed.
+	modePath := filepath.Join(n.dataDir, identityModeFile)
+	if err := atomicfile.WriteFile(modePath, []byte(IdentityModeStored+"\n"), 0o600); err != nil {
+		return "", 0, fmt.Errorf("record identity mode: %w", err)
+	}
+	n.identityMode = IdentityModeStored
+
+	for _, ack := range n.announceNotice(ctx, notice) {
+		if ack.Err == "" {
+			notified++
+		}
+	}
+	n.auditEvent("identity_migrated", map[string]string{
+		"old":            oldOnion,
+		"new":            newOnion,
+		"seq":            strconv.FormatUint(notice.Seq, 10),
+		"peers_notified": strconv.Itoa(notified),
+	})
+	return newOnion, notified, nil
+}
+
+// MoveAck is the per-peer outcome of announcing an address change.
+type MoveAck struct {
+	// Onion and Alias identify the peer the notice went to.
+	Onion string
+	Alias string
+	// Err is empty if the peer acknowledged the notice.
+	Err string
+}
+
+// AnnounceMove re-sends the node's stored address-change notice to every
+// registered peer and reports which of them acknowledged it. Peers that
+// already applied the notice acknowledge again, so re-running it is
+// harmless.
+func (n *Node) AnnounceMove(ctx context.Context) ([]MoveAck, error) {
+	var notice moveNotice
+	err := n.sec.GetJSON(moveNoticeKey, &notice)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil, fmt.Errorf("no address change to announce; the notice is created by the identity migration")
+	} else if err != nil {
+		return nil, err
+	}
+	return n.announceNotice(ctx, notice), nil
+}
+
+// announceNotice sends notice to every registered peer.
+func (n *Node) announceNotice(ctx context.Context, notice moveNotice) []MoveAck {
+	req := &pb.AddressChangeRequest{
+		OldOnion:  notice.Old,
+		NewOnion:  notice.New,
+		Seq:       notice.Seq,
+		Signature: notice.Sig,
+	}
+	var acks []MoveAck
+	for _, p := range n.ListPeers() {
+		ack := MoveAck{Onion: p.Onion, Alias: p.Alias}
+		err := n.callPeer(ctx, p.Onion, 0, func(ctx context.Context, client pb.PeerClient) error {
+			_, err := client.AnnounceAddressChange(ctx, req)
+			return err
+		})
+		if err != nil {
+			ack.Err = err.Error()
+		}
+		acks = append(acks, ack)
+	}
+	return acks
+}
+
+// adoptPeerAddress moves a peer's registry entry and stored state from
+// oldOnion to newOnion after a verified address-change notice with the
+// given seq. The old address keeps resolving as an alias for a grace
+// period. The peer's chunks and message history follow the new address;
+// agreements keep the old one as part of their signed record, so quota
+// falls back to the default until a new agreement is made. A notice
+// already applied is acknowledged again; one older than the applied one
+// is rejected as a replay.
+func (n *Node) adoptPeerAddress(oldOnion, newOnion string, seq uint64) error {
+	n.mu.Lock()
+	if p, ok := n.peers[newOnion]; ok && p.AddrChangeSeq >= seq {
+		// Re-announced notice; the entry already moved.
+		n.mu.Unlock()
+		return nil
+	}
+	p, ok := n.peers[oldOnion]
+	if !ok {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s not registered", oldOnion)
+	}
+	if p.AddrChangeSeq >= seq {
+		n.mu.Unlock()
+		return fmt.Errorf("stale address-change notice (seq %d, already applied %d)", seq, p.AddrChangeSeq)
+	}
+	if _, ok := n.peers[newOnion]; ok {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s already registered", newOnion)
+	}
+	delete(n.peers, oldOnion)
+	p.Onion = newOnion
+	p.AddrChangeSeq = seq
+	p.PrevOnion = oldOnion
+	p.PrevOnionUntil = time.Now().Add(addrChangeGrace)
+	n.peers[newOnion] = p
+	err := n.savePeersLocked()
+	pc := n.conns[oldOnion]
+	delete(n.conns, oldOnion)
+	delete(n.fetchNonces, oldOnion)
+	delete(n.peerFetchNonce, oldOnion)
+	n.mu.Unlock()
+	if pc != nil {
+		pc.cc.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := n.chunks.RenameOwner(oldOnion, newOnion); err != nil {
+		return fmt.Errorf("move chunks: %w", err)
+	}
+	msgs, err := n.loadMessages(oldOnion)
+	if err != nil {
+		return err
+	}
+	if len(msgs) > 0 {
+		for i := range msgs {
+			msgs[i].Peer = newOnion
+		}
+		if err := n.sec.PutJSON(msgKey(newOnion), msgs); err != nil {
+			return err
+		}
+		if err := n.sec.Delete(msgKey(oldOnion)); err != nil {
+			return err
+		}
+	}
+	n.auditEvent("peer_address_changed", map[string]string{
+		"old": oldOnion,
+		"new": newOnion,
+		"seq": strconv.FormatUint(seq, 10),
+	})
+	if n.OnionAuthEnabled() {
+		return n.refreshOnionAuth(context.Background())
+	}
+	return nil
+}
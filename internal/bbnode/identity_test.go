@@ -0,0 +1,208 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestStoredIdentityStable(t *testing.T) {
+	network := netmock.New()
+	dataDir := t.TempDir()
+
+	n1, err := New("password", network, dataDir, WithIdentityMode(IdentityModeStored))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	addr1 := keys.OnionAddress(n1.onionKey.Public().(ed25519.PublicKey))
+	n1.Stop()
+
+	// A second run with the same password finds the same sealed key; the
+	// mode is recorded, so it need not be repeated.
+	n2, err := New("password", network, dataDir)
+	if err != nil {
+		t.Fatalf("New (reopen): %v", err)
+	}
+	defer n2.Stop()
+	addr2 := keys.OnionAddress(n2.onionKey.Public().(ed25519.PublicKey))
+	if addr1 != addr2 {
+		t.Errorf("stored identity changed between runs: %s then %s", addr1, addr2)
+	}
+	if n2.IdentityMode() != IdentityModeStored {
+		t.Errorf("IdentityMode = %q, want %q", n2.IdentityMode(), IdentityModeStored)
+	}
+
+	// The stored key is random, not the derived one.
+	derived, err := New("password", network, t.TempDir())
+	if err != nil {
+		t.Fatalf("New (derived): %v", err)
+	}
+	defer derived.Stop()
+	if got := keys.OnionAddress(derived.onionKey.Public().(ed25519.PublicKey)); got == addr1 {
+		t.Error("stored identity equals the derived one")
+	}
+}
+
+func TestIdentityModeEnforced(t *testing.T) {
+	network := netmock.New()
+	dataDir := t.TempDir()
+
+	n, err := New("password", network, dataDir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if n.IdentityMode() != IdentityModeDerived {
+		t.Errorf("default IdentityMode = %q, want %q", n.IdentityMode(), IdentityModeDerived)
+	}
+	n.Stop()
+
+	if _, err := New("password", network, dataDir, WithIdentityMode(IdentityModeStored)); err == nil || !strings.Contains(err.Error(), "identity mode") {
+		t.Errorf("New with conflicting mode: %v, want identity mode error", err)
+	}
+	if _, err := New("password", network, t.TempDir(), WithIdentityMode("bogus")); err == nil || !strings.Contains(err.Error(), "identity mode") {
+		t.Errorf("New with unknown mode: %v, want identity mode error", err)
+	}
+}
+
+func TestMigrateIdentity(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// State held for a on b must follow the new address.
+	cc, err := a.getConn(ctx, b.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	if _, err := pb.NewPeerClient(cc).StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("data")}); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	if err := a.SendMessage(ctx, "bob", "hello"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	oldOnion := a.Address()
+	newOnion, notified, err := a.MigrateIdentity(ctx)
+	if err != nil {
+		t.Fatalf("MigrateIdentity: %v", err)
+	}
+	if newOnion == oldOnion {
+		t.Error("migration kept the old address")
+	}
+	if notified != 1 {
+		t.Errorf("notified = %d, want 1", notified)
+	}
+
+	p, err := b.findPeer("alice")
+	if err != nil {
+		t.Fatalf("findPeer after migration: %v", err)
+	}
+	if p.Onion != newOnion {
+		t.Errorf("registry entry = %s, want %s", p.Onion, newOnion)
+	}
+	// The vacated address keeps resolving as an alias during the grace
+	// period.
+	if moved, err := b.findPeer(oldOnion); err != nil || moved.Onion != newOnion {
+		t.Errorf("findPeer(old) = %v, %v; want the moved entry", moved, err)
+	}
+	if names, _ := b.chunks.List(newOnion, ""); len(names) != 1 || names[0] != "c1" {
+		t.Errorf("chunks under new address = %v, want [c1]", names)
+	}
+	if msgs, err := b.loadMessages(newOnion); err != nil || len(msgs) != 1 {
+		t.Errorf("messages under new address = %v, %v; want the one sent", msgs, err)
+	}
+
+	// Re-announcing is harmless: the peer acknowledges again.
+	acks, err := a.AnnounceMove(ctx)
+	if err != nil {
+		t.Fatalf("AnnounceMove: %v", err)
+	}
+	if len(acks) != 1 || acks[0].Err != "" {
+		t.Errorf("AnnounceMove acks = %+v, want one clean ack", acks)
+	}
+
+	// The new key takes over at the next unlock of a's data dir.
+	dataDir := a.dataDir
+	a.Stop()
+	a2, err := New("password-a", a.network, dataDir)
+	if err != nil {
+		t.Fatalf("New (after migration): %v", err)
+	}
+	defer a2.Stop()
+	if a2.IdentityMode() != IdentityModeStored {
+		t.Errorf("IdentityMode after migration = %q, want %q", a2.IdentityMode(), IdentityModeStored)
+	}
+	if got := keys.OnionAddress(a2.onionKey.Public().(ed25519.PublicKey)); got != newOnion {
+		t.Errorf("address after migration = %s, want %s", got, newOnion)
+	}
+}
+
+func TestAddressChangeRejectsForgery(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cc, err := a.getConn(ctx, b.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	client := pb.NewPeerClient(cc)
+	newOnion := testOnionAddr(t)
+
+	// A notice not involving the caller is rejected on identity alone.
+	victim := testOnionAddr(t)
+	_, err = client.AnnounceAddressChange(ctx, &pb.AddressChangeRequest{OldOnion: victim, NewOnion: newOnion, Seq: 1})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("notice for another peer: %v, want PermissionDenied", err)
+	}
+
+	// The caller's own notice still needs a valid signature.
+	_, err = client.AnnounceAddressChange(ctx, &pb.AddressChangeRequest{
+		OldOnion:  a.Address(),
+		NewOnion:  newOnion,
+		Seq:       1,
+		Signature: []byte("bogus"),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("notice with bad signature: %v, want InvalidArgument", err)
+	}
+	if _, err := b.findPeer(newOnion); err == nil {
+		t.Error("forged notice changed the registry")
+	}
+}
+
+func TestAdoptPeerAddressReplay(t *testing.T) {
+	n := startTestNode(t, netmock.New(), "password")
+	oldOnion := testOnionAddr(t)
+	newOnion := testOnionAddr(t)
+	if err := n.AddPeer(oldOnion, "mover"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	n.mu.Lock()
+	n.peers[oldOnion].AddrChangeSeq = 5
+	n.mu.Unlock()
+
+	if err := n.adoptPeerAddress(oldOnion, newOnion, 5); err == nil || !strings.Contains(err.Error(), "stale") {
+		t.Errorf("adopt with replayed seq: %v, want stale notice error", err)
+	}
+	if err := n.adoptPeerAddress(oldOnion, newOnion, 6); err != nil {
+		t.Fatalf("adopt with fresh seq: %v", err)
+	}
+	p, err := n.findPeer(newOnion)
+	if err != nil || p.AddrChangeSeq != 6 || p.Alias != "mover" {
+		t.Errorf("moved entry = %+v, %v", p, err)
+	}
+	// The same notice again is acknowledged without another move.
+	if err := n.adoptPeerAddress(oldOnion, newOnion, 6); err != nil {
+		t.Errorf("re-applied notice: %v", err)
+	}
+}
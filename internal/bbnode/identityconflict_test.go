@@ -0,0 +1,96 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// closeListener cuts the node's listener without going through Stop, so
+// another instance of the same identity can register on the mock
+// network. On real Tor both instances publish concurrently; netmock
+// refuses duplicate registrations, so the test hands the address over.
+func closeListener(t *testing.T, n *Node) {
+	t.Helper()
+	n.mu.Lock()
+	ln := n.ln
+	n.mu.Unlock()
+	if ln == nil {
+		t.Fatal("node has no listener")
+	}
+	ln.Close()
+}
+
+func TestSelfCheckOwnInstance(t *testing.T) {
+	n := startTestNode(t, netmock.New(), "password-a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := n.SelfCheck(ctx); err != nil {
+		t.Fatalf("SelfCheck: %v", err)
+	}
+}
+
+func TestSelfCheckIdentityConflict(t *testing.T) {
+	network := netmock.New()
+	n1 := startTestNode(t, network, "password-a")
+
+	closeListener(t, n1)
+	n2 := startTestNode(t, network, "password-a")
+	if n2.Address() != n1.Address() {
+		t.Fatalf("same password gave different addresses: %s vs %s", n1.Address(), n2.Address())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// n1's self-dial now reaches n2, which reports the right onion but
+	// the wrong instance nonce.
+	err := n1.SelfCheck(ctx)
+	if !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("SelfCheck: got %v, want ErrIdentityConflict", err)
+	}
+
+	n1.selfCheckOnce()
+	h := n1.Health()
+	if h.State != "degraded" {
+		t.Fatalf("health state: got %q, want degraded", h.State)
+	}
+	if !strings.Contains(h.Err, "identity conflict") {
+		t.Fatalf("health err %q does not mention the identity conflict", h.Err)
+	}
+
+	// n2 is a healthy instance from its own point of view.
+	if err := n2.SelfCheck(ctx); err != nil {
+		t.Fatalf("SelfCheck on the second instance: %v", err)
+	}
+}
+
+func TestStrictIdentityStopsNode(t *testing.T) {
+	network := netmock.New()
+	n1, err := New("password-a", network, t.TempDir(), WithStrictIdentity())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n1.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { n1.Stop() })
+
+	closeListener(t, n1)
+	startTestNode(t, network, "password-a")
+
+	n1.selfCheckOnce()
+	deadline := time.Now().Add(10 * time.Second)
+	for !n1.StartedAt().IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("strict-identity node did not stop after the conflict")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
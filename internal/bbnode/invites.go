@@ -0,0 +1,252 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// invitesKey is the secstore key holding the invite registry.
+const invitesKey = "invites/registry"
+
+// Invite states. "expired" is derived from ExpiresAt and the clock;
+// the other three are persisted transitions.
+const (
+	InviteIssued  = "issued"
+	InviteUsed    = "used"
+	InviteExpired = "expired"
+	InviteRevoked = "revoked"
+)
+
+// ErrUnknownInvite is wrapped by invite lookups with an ID that was
+// never issued.
+var ErrUnknownInvite = errors.New("unknown invite")
+
+// Invite is one issued invitation code. The full code handed to the
+// invitee is "<secret>.<unix-expiry>"; the registry keeps the secret so
+// redemption can match it, and the short ID is what list and revoke
+// work with.
+type Invite struct {
+	// ID identifies the invite in bbcli output without exposing the
+	// redeemable secret.
+	ID string `json:"id"`
+	// Secret is the random part of the invite code.
+	Secret string `json:"secret"`
+	// Label is the operator's note on who the invite is for.
+	Label string `json:"label,omitempty"`
+	// State is InviteIssued, InviteUsed, or InviteRevoked as persisted;
+	// ListInvites reports InviteExpired for issued invites past expiry.
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// UsedBy is the onion address that redeemed the invite.
+	UsedBy    string    `json:"used_by,omitempty"`
+	UsedAt    time.Time `json:"used_at,omitempty"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+}
+
+// Code returns the redeemable invite code.
+func (i *Invite) Code() string {
+	return fmt.Sprintf("%s.%d", i.Secret, i.ExpiresAt.Unix())
+}
+
+// loadInvitesLocked reads the invite registry; callers hold invitesMu.
+func (n *Node) loadInvitesLocked() ([]*Invite, error) {
+	var list []*Invite
+	err := n.sec.GetJSON(invitesKey, &list)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil, nil
+	}
+	return list, err
+}
+
+// NewInvite issues an invite expiring after ttl and returns it. The
+// redeemable code is Invite.Code; everything else is bookkeeping.
+func (n *Node) NewInvite(ttl time.Duration, label string) (*Invite, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invite ttl must be positive, got %v", ttl)
+	}
+	var raw [20]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return nil, err
+	}
+	inv := &Invite{
+		ID:        fmt.Sprintf("%x", raw[:4]),
+		Secret:    fmt.Sprintf("%x", raw[4:]),
+		Label:     label,
+		State:     InviteIssued,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	n.invitesMu.Lock()
+	defer n.invitesMu.Unlock()
+	list, err := n.loadInvitesLocked()
+	if err != nil {
+		return nil, err
+	}
+	if err := n.sec.PutJSON(invitesKey, append(list, inv)); err != nil {
+		return nil, err
+	}
+	n.auditEvent("invite_issued", map[string]string{"id": inv.ID, "label": label})
+	return inv, nil
+}
+
+// ListInvites returns all invites, newest first, with the expired state
+// applied for display.
+func (n *Node) ListInvites() ([]Invite, error) {
+	n.invitesMu.Lock()
+	list, err := n.loadInvitesLocked()
+	n.invitesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]Invite, 0, len(list))
+	for _, inv := range list {
+		i := *inv
+		if i.State == InviteIssued && now.After(i.ExpiresAt) {
+			i.State = InviteExpired
+		}
+		out = append(out, i)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// RevokeInvite marks the invite with id revoked so it can no longer be
+// redeemed. A used invite cannot be revoked; the peer already joined
+// and must be removed as a peer instead.
+func (n *Node) RevokeInvite(id string) error {
+	n.invitesMu.Lock()
+	defer n.invitesMu.Unlock()
+	list, err := n.loadInvitesLocked()
+	if err != nil {
+		return err
+	}
+	for _, inv := range list {
+		if inv.ID != id {
+			continue
+		}
+		switch inv.State {
+		case InviteUsed:
+			return fmt.Errorf("invite %s was already used by %s; remove the peer instead", id, inv.UsedBy)
+		case InviteRevoked:
+			return nil
+		}
+		inv.State = InviteRevoked
+		inv.RevokedAt = time.Now()
+		if err := n.sec.PutJSON(invitesKey, list); err != nil {
+			return err
+		}
+		n.auditEvent("invite_revoked", map[string]string{"id": inv.ID})
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrUnknownInvite, id)
+}
+
+// redeemInvite validates code for the caller at onion and marks the
+// invite used. invitesMu makes the check-and-mark atomic: two peers
+// racing on the same code see exactly one success. Expiry is checked
+// against this node's clock, not the expiry baked into the code.
+// Errors are gRPC statuses ready for the Join handler to return.
+func (n *Node) redeemInvite(code, onion string) (*Invite, error) {
+	reject := func(reason string, err error) (*Invite, error) {
+		n.auditEvent("invite_rejected", map[string]string{"onion": onion, "reason": reason})
+		return nil, err
+	}
+	secret, _, ok := strings.Cut(code, ".")
+	if !ok || secret == "" {
+		return reject("malformed", status.Errorf(codes.InvalidArgument, "malformed invite code"))
+	}
+	n.invitesMu.Lock()
+	defer n.invitesMu.Unlock()
+	list, err := n.loadInvitesLocked()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "load invites: %v", err)
+	}
+	for _, inv := range list {
+		if inv.Secret != secret {
+			continue
+		}
+		switch inv.State {
+		case InviteRevoked:
+			return reject("revoked", status.Errorf(codes.PermissionDenied, "invite code has been revoked"))
+		case InviteUsed:
+			return reject("used", status.Errorf(codes.PermissionDenied, "invite code was already used"))
+		}
+		if time.Now().After(inv.ExpiresAt) {
+			return reject("expired", status.Errorf(codes.PermissionDenied, "invite code has expired"))
+		}
+		inv.State = InviteUsed
+		inv.UsedBy = onion
+		inv.UsedAt = time.Now()
+		if err := n.sec.PutJSON(invitesKey, list); err != nil {
+			return nil, status.Errorf(codes.Internal, "save invites: %v", err)
+		}
+		n.auditEvent("invite_used", map[string]string{"id": inv.ID, "onion": onion})
+		return inv, nil
+	}
+	return reject("unknown", status.Errorf(codes.PermissionDenied, "unknown invite code"))
+}
+
+// registerJoinedPeer adds the caller that redeemed an invite to the
+// peer registry. A caller already in the registry is left alone:
+// re-joining after a dropped response must not fail.
+func (n *Node) registerJoinedPeer(onion string) error {
+	n.mu.Lock()
+	if _, ok := n.peers[onion]; ok {
+		n.mu.Unlock()
+		return nil
+	}
+	if len(n.peers) >= n.maxPeers {
+		n.mu.Unlock()
+		return fmt.Errorf("peer registry is full (%d peers, max %d)", len(n.peers), n.maxPeers)
+	}
+	n.peers[onion] = &Peer{Onion: onion, AddedAt: time.Now(), LastSeen: time.Now()}
+	err := n.savePeersLocked()
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	n.auditEvent("peer_added", map[string]string{"onion": onion, "via": "invite"})
+	if n.OnionAuthEnabled() {
+		return n.refreshOnionAuth(context.Background())
+	}
+	return nil
+}
+
+// joinWithInvite redeems the invite code a peer was added with against
+// that peer, clearing the stored code on success so AddPeer's join
+// attempt is not repeated.
+func (n *Node) joinWithInvite(ctx context.Context, onion, code string) error {
+	err := n.callPeer(ctx, onion, 0, func(ctx context.Context, client pb.PeerClient) error {
+		resp, err := client.Join(ctx, &pb.JoinRequest{InviteCode: code})
+		if err != nil {
+			return err
+		}
+		if len(resp.OnionChallenge) > 0 {
+			return n.answerOnionChallenge(ctx, client, resp.OnionChallenge)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	if p, ok := n.peers[onion]; ok {
+		p.Invite = ""
+	}
+	err = n.savePeersLocked()
+	n.mu.Unlock()
+	return err
+}
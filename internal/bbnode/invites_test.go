@@ -0,0 +1,114 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestInviteJoin(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inv, err := a.NewInvite(time.Hour, "for bob")
+	if err != nil {
+		t.Fatalf("NewInvite: %v", err)
+	}
+
+	// The bb:// URI path: AddPeer redeems the invite in the background
+	// and the issuer registers the joiner.
+	uri := fmt.Sprintf("bb://%s/%s", a.Address(), inv.Code())
+	if err := b.AddPeer(uri, "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := a.findPeer(b.Address()); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("issuer never registered the joining peer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	invites, err := a.ListInvites()
+	if err != nil {
+		t.Fatalf("ListInvites: %v", err)
+	}
+	if len(invites) != 1 || invites[0].State != InviteUsed || invites[0].UsedBy != b.Address() {
+		t.Errorf("invites = %+v, want one used by %s", invites, b.Address())
+	}
+
+	// The same code cannot be redeemed twice.
+	c := startTestNode(t, network, "password-c")
+	err = c.joinWithInvite(ctx, a.Address(), inv.Code())
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("second join: %v, want PermissionDenied already used", err)
+	}
+}
+
+func TestInviteRevoke(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inv, err := a.NewInvite(time.Hour, "")
+	if err != nil {
+		t.Fatalf("NewInvite: %v", err)
+	}
+	if err := a.RevokeInvite(inv.ID); err != nil {
+		t.Fatalf("RevokeInvite: %v", err)
+	}
+	if err := a.RevokeInvite(inv.ID); err != nil {
+		t.Errorf("RevokeInvite again: %v, want nil", err)
+	}
+	if err := a.RevokeInvite("ffffffff"); !errors.Is(err, ErrUnknownInvite) {
+		t.Errorf("RevokeInvite unknown: %v, want ErrUnknownInvite", err)
+	}
+
+	err = b.joinWithInvite(ctx, a.Address(), inv.Code())
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("join with revoked invite: %v, want PermissionDenied revoked", err)
+	}
+	if invites, _ := a.ListInvites(); len(invites) != 1 || invites[0].State != InviteRevoked {
+		t.Errorf("invites = %+v, want one revoked", invites)
+	}
+}
+
+func TestInviteExpiry(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inv, err := a.NewInvite(50*time.Millisecond, "")
+	if err != nil {
+		t.Fatalf("NewInvite: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	err = b.joinWithInvite(ctx, a.Address(), inv.Code())
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("join with expired invite: %v, want PermissionDenied expired", err)
+	}
+	if invites, _ := a.ListInvites(); len(invites) != 1 || invites[0].State != InviteExpired {
+		t.Errorf("invites = %+v, want one expired", invites)
+	}
+	if _, err := a.NewInvite(0, ""); err == nil {
+		t.Error("NewInvite with zero ttl succeeded")
+	}
+}
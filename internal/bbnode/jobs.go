@@ -0,0 +1,374 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/starius/barterbackup/internal/tracing"
+)
+
+// Job states. A "running" or "paused" job whose daemon died becomes
+// "interrupted" on the next start; resuming it re-runs the operation,
+// which skips chunks already present on the peer.
+const (
+	jobRunning     = "running"
+	jobPaused      = "paused"
+	jobDone        = "done"
+	jobFailed      = "failed"
+	jobCancelled   = "cancelled"
+	jobInterrupted = "interrupted"
+)
+
+func jobRecordKey(id string) string { return "jobs/" + id }
+
+// Job is the persisted record of one long-running operation. The
+// parameter fields hold what is needed to run the operation again, so a
+// job that outlived its daemon can be resumed.
+type Job struct {
+	ID string `json:"id"`
+	// Kind is "backup", "backup-stream", "restore", "repair", "verify",
+	// or "wipe".
+	Kind      string    `json:"kind"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Peers are the peer specs of a backup run.
+	Peers []string `json:"peers,omitempty"`
+	// SourceDir is the directory a backup run reads.
+	SourceDir string `json:"source_dir,omitempty"`
+	// Chunker is the chunking algorithm of a backup run; empty picks
+	// the default.
+	Chunker string `json:"chunker,omitempty"`
+	// Hash is the chunk hash algorithm of a backup run; empty picks the
+	// default.
+	Hash string `json:"hash,omitempty"`
+	// Include and Exclude are the glob patterns a backup run filters
+	// the tree walk with.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// FollowSymlinks makes a backup run store link targets instead of
+	// the links.
+	FollowSymlinks bool `json:"follow_symlinks,omitempty"`
+	// BackupID is the backup being created, restored, or repaired.
+	BackupID string `json:"backup_id,omitempty"`
+	// DestDir is where a restore writes.
+	DestDir string `json:"dest_dir,omitempty"`
+	// Peer is the replica a repair targets, or the peer a wipe is
+	// forgetting.
+	Peer string `json:"peer,omitempty"`
+	// SamplePercent and SampleSeed pin a verify run's chunk sample, so
+	// a resumed or reproduced run checks the same chunks.
+	SamplePercent int   `json:"sample_percent,omitempty"`
+	SampleSeed    int64 `json:"sample_seed,omitempty"`
+	// WipedBlobs and WipedBytes track how much a wipe job has deleted
+	// so far.
+	WipedBlobs int64 `json:"wiped_blobs,omitempty"`
+	WipedBytes int64 `json:"wiped_bytes,omitempty"`
+	// WriteReport makes a restore job save its integrity report as a
+	// JSON file alongside the destination.
+	WriteReport bool `json:"write_report,omitempty"`
+	// RestoredOK, RestoredFailed, RestoredSkipped, and VerifiedBytes
+	// summarize a restore run's per-file verification for monitoring.
+	RestoredOK      int   `json:"restored_ok,omitempty"`
+	RestoredFailed  int   `json:"restored_failed,omitempty"`
+	RestoredSkipped int   `json:"restored_skipped,omitempty"`
+	VerifiedBytes   int64 `json:"verified_bytes,omitempty"`
+}
+
+// runningJob is the runtime half of a job: a cancel handle and the
+// pause gate chunk transfers block on.
+type runningJob struct {
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	cancelled bool
+	// interrupted marks a job stopped with the node rather than by the
+	// user; it stays resumable.
+	interrupted bool
+	// resume is non-nil while paused and closed on resume.
+	resume chan struct{}
+}
+
+// wait blocks while the job is paused. It returns once the job runs
+// again, or the context error if the job was cancelled meanwhile.
+func (rj *runningJob) wait(ctx context.Context) error {
+	for {
+		rj.mu.Lock()
+		ch := rj.resume
+		rj.mu.Unlock()
+		if ch == nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// jobCtxKey carries the runningJob through the contexts the operations
+// already thread everywhere.
+type jobCtxKey struct{}
+
+// checkpoint is called before each new chunk transfer. It blocks while
+// the owning job is paused and reports cancellation; in-flight
+// transfers are not interrupted by a pause. Outside a job it only
+// checks the context.
+func checkpoint(ctx context.Context) error {
+	if rj, ok := ctx.Value(jobCtxKey{}).(*runningJob); ok {
+		return rj.wait(ctx)
+	}
+	return ctx.Err()
+}
+
+func newJobID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// runJob registers the job, runs fn under a cancellable per-job
+// context, and persists the outcome.
+func (n *Node) runJob(ctx context.Context, job *Job, fn func(context.Context) error) error {
+	if job.ID == "" {
+		job.ID = newJobID()
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+	jctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rj := &runningJob{cancel: cancel}
+	n.jobsMu.Lock()
+	n.runningJobs[job.ID] = rj
+	n.jobsMu.Unlock()
+	if err := n.saveJob(job, jobRunning, nil); err != nil {
+		n.jobsMu.Lock()
+		delete(n.runningJobs, job.ID)
+		n.jobsMu.Unlock()
+		return err
+	}
+	n.startJobProgress(job)
+
+	fctx, span := tracing.StartSpan(context.WithValue(jctx, jobCtxKey{}, rj), "job."+job.Kind)
+	span.SetString("job.id", job.ID)
+	err := fn(fctx)
+	span.End(err)
+
+	n.jobsMu.Lock()
+	delete(n.runningJobs, job.ID)
+	cancelled, interrupted := rj.cancelled, rj.interrupted
+	n.jobsMu.Unlock()
+	switch {
+	case interrupted:
+		n.saveJob(job, jobInterrupted, nil)
+		n.finishJobProgress(job.ID, jobInterrupted, nil)
+		return fmt.Errorf("job %s interrupted", job.ID)
+	case cancelled:
+		n.saveJob(job, jobCancelled, err)
+		n.finishJobProgress(job.ID, jobCancelled, err)
+		return fmt.Errorf("job %s cancelled", job.ID)
+	case err != nil:
+		n.saveJob(job, jobFailed, err)
+		n.finishJobProgress(job.ID, jobFailed, err)
+		n.reportJobRun(true)
+	default:
+		n.saveJob(job, jobDone, nil)
+		n.finishJobProgress(job.ID, jobDone, nil)
+		n.reportJobRun(false)
+	}
+	return err
+}
+
+func (n *Node) saveJob(job *Job, state string, cause error) error {
+	job.State = state
+	job.Error = ""
+	if cause != nil {
+		job.Error = cause.Error()
+	}
+	job.UpdatedAt = time.Now()
+	if err := n.sec.PutJSON(jobRecordKey(job.ID), job); err != nil {
+		return fmt.Errorf("store job record: %w", err)
+	}
+	return nil
+}
+
+// markInterruptedJobs runs at start and turns jobs that were running or
+// paused when the previous daemon died into "interrupted" ones, which
+// ResumeJob can relaunch.
+func (n *Node) markInterruptedJobs() error {
+	jobs, err := n.ListJobs()
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.State != jobRunning && job.State != jobPaused {
+			continue
+		}
+		if err := n.saveJob(job, jobInterrupted, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListJobs returns all job records, newest first.
+func (n *Node) ListJobs() ([]Job, error) {
+	keys, err := n.sec.List("jobs/")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Job, 0, len(keys))
+	for _, key := range keys {
+		var job Job
+		if err := n.sec.GetJSON(key, &job); err != nil {
+			return nil, err
+		}
+		out = append(out, job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// CancelJob cancels a running or paused job. Already-stored chunks are
+// kept: a later retry of the same operation reuses them.
+func (n *Node) CancelJob(id string) error {
+	n.jobsMu.Lock()
+	rj := n.runningJobs[id]
+	if rj != nil {
+		rj.cancelled = true
+	}
+	n.jobsMu.Unlock()
+	if rj != nil {
+		rj.cancel()
+		return nil
+	}
+	var job Job
+	if err := n.sec.GetJSON(jobRecordKey(id), &job); err != nil {
+		return fmt.Errorf("unknown job %s: %w", id, err)
+	}
+	if job.State != jobInterrupted {
+		return fmt.Errorf("job %s is %s, nothing to cancel", id, job.State)
+	}
+	return n.saveJob(&job, jobCancelled, nil)
+}
+
+// PauseJob stops the job from issuing new chunk transfers; in-flight
+// ones finish. The paused state is persisted, so a daemon restart turns
+// the job into an interrupted one that ResumeJob can pick up again.
+func (n *Node) PauseJob(id string) error {
+	n.jobsMu.Lock()
+	rj := n.runningJobs[id]
+	if rj != nil {
+		rj.mu.Lock()
+		if rj.resume == nil {
+			rj.resume = make(chan struct{})
+		}
+		rj.mu.Unlock()
+	}
+	n.jobsMu.Unlock()
+	if rj == nil {
+		return fmt.Errorf("job %s is not running", id)
+	}
+	var job Job
+	if err := n.sec.GetJSON(jobRecordKey(id), &job); err != nil {
+		return err
+	}
+	n.updateJobProgress(id, func(p *JobProgress) { p.State = jobPaused })
+	return n.saveJob(&job, jobPaused, nil)
+}
+
+// ResumeJob unpauses a paused job, or relaunches an interrupted one
+// from its persisted parameters. A relaunched backup keeps its backup
+// ID, so chunks uploaded before the interruption are skipped.
+func (n *Node) ResumeJob(id string) error {
+	n.jobsMu.Lock()
+	rj := n.runningJobs[id]
+	if rj != nil {
+		rj.mu.Lock()
+		if rj.resume != nil {
+			close(rj.resume)
+			rj.resume = nil
+		}
+		rj.mu.Unlock()
+	}
+	n.jobsMu.Unlock()
+	if rj != nil {
+		var job Job
+		if err := n.sec.GetJSON(jobRecordKey(id), &job); err != nil {
+			return err
+		}
+		n.updateJobProgress(id, func(p *JobProgress) { p.State = jobRunning })
+		return n.saveJob(&job, jobRunning, nil)
+	}
+	var job Job
+	if err := n.sec.GetJSON(jobRecordKey(id), &job); err != nil {
+		return fmt.Errorf("unknown job %s: %w", id, err)
+	}
+	if job.State != jobInterrupted {
+		return fmt.Errorf("job %s is %s, not interrupted", id, job.State)
+	}
+	return n.relaunchJob(&job)
+}
+
+// relaunchJob re-runs an interrupted job in the background. The job
+// context is detached from the caller and ends with the node.
+func (n *Node) relaunchJob(job *Job) error {
+	var fn func(context.Context) error
+	switch job.Kind {
+	case "backup":
+		fn = func(ctx context.Context) error {
+			_, err := n.createBackup(ctx, job)
+			return err
+		}
+	case "backup-stream":
+		// The stdin that fed the run is gone; there is nothing to
+		// resume from.
+		return fmt.Errorf("job %s is a stream backup and cannot be resumed", job.ID)
+	case "restore":
+		fn = func(ctx context.Context) error {
+			return n.restoreBackup(ctx, job)
+		}
+	case "repair":
+		fn = func(ctx context.Context) error {
+			_, err := n.repairBackup(ctx, job)
+			return err
+		}
+	case "verify":
+		// Only the verification is replayed; a --repair given to the
+		// original run is not.
+		fn = func(ctx context.Context) error {
+			_, err := n.verifyBackup(ctx, job)
+			return err
+		}
+	case "wipe":
+		fn = func(ctx context.Context) error {
+			return n.wipePeerData(ctx, job, job.Peer)
+		}
+	default:
+		return fmt.Errorf("job %s has unknown kind %q", job.ID, job.Kind)
+	}
+	go n.runJob(context.Background(), job, fn)
+	return nil
+}
+
+// cancelRunningJobs is called from Stop so no job outlives the node.
+// The jobs end up "interrupted", not "cancelled", so they can be
+// resumed after the next start.
+func (n *Node) cancelRunningJobs() {
+	n.jobsMu.Lock()
+	defer n.jobsMu.Unlock()
+	for _, rj := range n.runningJobs {
+		rj.interrupted = true
+		rj.cancel()
+	}
+}
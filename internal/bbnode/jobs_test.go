@@ -0,0 +1,130 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// jobByID finds one job record in a ListJobs result.
+func jobByID(t *testing.T, n *Node, id string) *Job {
+	t.Helper()
+	jobs, err := n.ListJobs()
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	for i := range jobs {
+		if jobs[i].ID == id {
+			return &jobs[i]
+		}
+	}
+	t.Fatalf("job %s not in %v", id, jobs)
+	return nil
+}
+
+func TestJobControls(t *testing.T) {
+	network := netmock.New()
+	n := startTestNode(t, network, "password-a")
+
+	// A fake job body that, like the real ones, hits a checkpoint
+	// before each unit of work.
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	job := &Job{Kind: "backup"}
+	go func() {
+		done <- n.runJob(context.Background(), job, func(ctx context.Context) error {
+			close(started)
+			for {
+				if err := checkpoint(ctx); err != nil {
+					return err
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}()
+	<-started
+
+	if err := n.PauseJob(job.ID); err != nil {
+		t.Fatalf("PauseJob: %v", err)
+	}
+	if got := jobByID(t, n, job.ID).State; got != "paused" {
+		t.Errorf("state after pause = %q", got)
+	}
+	if err := n.ResumeJob(job.ID); err != nil {
+		t.Fatalf("ResumeJob: %v", err)
+	}
+	if got := jobByID(t, n, job.ID).State; got != "running" {
+		t.Errorf("state after resume = %q", got)
+	}
+
+	if err := n.CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("cancelled job returned nil error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled job did not stop")
+	}
+	if got := jobByID(t, n, job.ID).State; got != "cancelled" {
+		t.Errorf("state after cancel = %q", got)
+	}
+
+	// Controls on finished jobs fail cleanly.
+	if err := n.PauseJob(job.ID); err == nil {
+		t.Error("PauseJob on a finished job succeeded")
+	}
+	if err := n.CancelJob(job.ID); err == nil {
+		t.Error("CancelJob on a finished job succeeded")
+	}
+}
+
+func TestJobResumeInterrupted(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "file.txt", "job me")
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	jobs, err := a.ListJobs()
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Kind != "backup" || jobs[0].State != "done" {
+		t.Fatalf("jobs after backup = %+v", jobs)
+	}
+	if jobs[0].BackupID != backup.ID {
+		t.Errorf("job backup id = %s, want %s", jobs[0].BackupID, backup.ID)
+	}
+
+	// Simulate a daemon death mid-run and resume: the relaunched job
+	// keeps its backup ID and finds the chunks already on the peer.
+	if err := a.saveJob(&jobs[0], jobInterrupted, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ResumeJob(jobs[0].ID); err != nil {
+		t.Fatalf("ResumeJob: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job := jobByID(t, a, jobs[0].ID)
+		if job.State == "done" {
+			if job.BackupID != backup.ID {
+				t.Errorf("resumed job backup id = %s, want %s", job.BackupID, backup.ID)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resumed job stuck in state %q (error %q)", job.State, job.Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
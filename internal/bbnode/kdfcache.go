@@ -0,0 +1,51 @@
+package bbnode
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// kdfCache memoizes the last password → master secret derivation, so
+// unlocking again after a lock in the same process skips the
+// multi-second Argon2 run. The cache is memory-only by design: a daemon
+// restart always pays the full KDF once. Caching means Lock no longer
+// removes the master secret from process memory — it removes it from
+// the node, which still blocks all key use — and a different password
+// simply misses the cache and overwrites the entry, so a changed
+// password invalidates it on first use.
+var kdfCache struct {
+	mu sync.Mutex
+	// pwHash identifies the password the entry was derived from without
+	// keeping the password itself.
+	pwHash [sha256.Size]byte
+	master []byte
+	// derivations counts actual Argon2 runs, so tests can assert a
+	// cached unlock skipped the KDF.
+	derivations int
+}
+
+// deriveMasterCached returns a caller-owned copy of the master secret
+// for password, running the Argon2 KDF only on a cache miss.
+func deriveMasterCached(password []byte) []byte {
+	h := sha256.Sum256(password)
+	kdfCache.mu.Lock()
+	defer kdfCache.mu.Unlock()
+	if kdfCache.master == nil || kdfCache.pwHash != h {
+		kdfCache.pwHash = h
+		kdfCache.master = keys.DeriveMasterPriv(password)
+		kdfCache.derivations++
+	}
+	out := make([]byte, len(kdfCache.master))
+	copy(out, kdfCache.master)
+	return out
+}
+
+// kdfDerivationCount reports how many Argon2 runs happened so far in
+// this process.
+func kdfDerivationCount() int {
+	kdfCache.mu.Lock()
+	defer kdfCache.mu.Unlock()
+	return kdfCache.derivations
+}
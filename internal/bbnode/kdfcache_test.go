@@ -0,0 +1,47 @@
+package bbnode
+
+import (
+	"testing"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestUnlockReusesCachedKDF(t *testing.T) {
+	network := netmock.New()
+	dataDir := t.TempDir()
+
+	before := kdfDerivationCount()
+	n, err := New("kdf-cache-password", network, dataDir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	fingerprint := n.Fingerprint()
+	if got := kdfDerivationCount(); got != before+1 {
+		t.Fatalf("derivations after first New = %d, want %d", got, before+1)
+	}
+
+	// Lock/unlock cycle: Stop wipes the node's keys, but the cache
+	// keeps its own copy, so the same password skips the KDF.
+	if err := n.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	n2, err := New("kdf-cache-password", network, dataDir)
+	if err != nil {
+		t.Fatalf("New after Stop: %v", err)
+	}
+	defer n2.Stop()
+	if got := kdfDerivationCount(); got != before+1 {
+		t.Errorf("derivations after re-unlock = %d, want %d (cached)", got, before+1)
+	}
+	if n2.Fingerprint() != fingerprint {
+		t.Error("cached unlock produced a different fingerprint")
+	}
+
+	// A different password misses the cache and derives again.
+	if _, err := New("kdf-cache-other", network, t.TempDir()); err != nil {
+		t.Fatalf("New with other password: %v", err)
+	}
+	if got := kdfDerivationCount(); got != before+2 {
+		t.Errorf("derivations after other password = %d, want %d", got, before+2)
+	}
+}
@@ -0,0 +1,148 @@
+package bbnode
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// defaultProbeInterval is how often the background prober checks on
+// peers that have not been contacted recently.
+const defaultProbeInterval = time.Hour
+
+// probeTimeout bounds one background dial (warm connections, invite
+// joins). Probes themselves are bounded by the callPeer deadline.
+const probeTimeout = 2 * time.Minute
+
+// UnreachableProbeThreshold is how many consecutive probe failures mark
+// a peer as unreachable in status output.
+const UnreachableProbeThreshold = 3
+
+// lastSeenPersistInterval throttles how often a last-seen update is
+// written to the secstore, so busy peer traffic does not turn every RPC
+// into a registry write.
+const lastSeenPersistInterval = time.Minute
+
+// markPeerSeen records a successful contact with the peer at onion.
+func (n *Node) markPeerSeen(onion string) {
+	now := time.Now()
+	n.mu.Lock()
+	p, ok := n.peers[onion]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	persist := p.ProbeFailures > 0 || now.Sub(p.LastSeen) >= lastSeenPersistInterval
+	p.LastSeen = now
+	p.ProbeFailures = 0
+	if b := n.breakers[onion]; b != nil {
+		b.success()
+	}
+	var err error
+	if persist {
+		err = n.savePeersLocked()
+	}
+	n.mu.Unlock()
+	if err != nil {
+		log.Printf("persist peer registry: %v", err)
+	}
+	n.recordReach(onion, true)
+}
+
+// recordPeerLatency folds one successful round trip into the peer's
+// smoothed ping latency. Persistence piggybacks on the next registry
+// write, so the number is approximate across restarts.
+func (n *Node) recordPeerLatency(onion string, rtt time.Duration) {
+	ms := rtt.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p, ok := n.peers[onion]
+	if !ok {
+		return
+	}
+	if p.AvgPingMs == 0 {
+		p.AvgPingMs = ms
+	} else {
+		p.AvgPingMs = (3*p.AvgPingMs + ms) / 4
+	}
+}
+
+// markPeerProbeFailed bumps the peer's consecutive failure counter.
+func (n *Node) markPeerProbeFailed(onion string) {
+	n.mu.Lock()
+	p, ok := n.peers[onion]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	p.ProbeFailures++
+	b := n.breakers[onion]
+	if b == nil {
+		b = &peerBreaker{clk: n.clk}
+		n.breakers[onion] = b
+	}
+	b.failure()
+	err := n.savePeersLocked()
+	n.mu.Unlock()
+	if err != nil {
+		log.Printf("persist peer registry: %v", err)
+	}
+	n.recordReach(onion, false)
+}
+
+// UnreachablePeers returns how many registered peers have failed
+// UnreachableProbeThreshold or more consecutive probes.
+func (n *Node) UnreachablePeers() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for _, p := range n.peers {
+		if p.ProbeFailures >= UnreachableProbeThreshold {
+			count++
+		}
+	}
+	return count
+}
+
+// runPeerProbe periodically probes peers that have not been contacted
+// within one probe interval, until the stop channel closes.
+func (n *Node) runPeerProbe(stop chan struct{}) {
+	t := time.NewTicker(n.probeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			n.probePeers()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// probePeers health-checks every peer whose last contact is older than
+// one probe interval. The callPeer deadline bounds each probe and folds
+// the outcome into the peer's stats: successes refresh last-seen,
+// transport failures bump the consecutive failure counter. Peers with
+// an open circuit breaker are skipped until their backoff expires, so a
+// peer that is gone for good does not cost a Tor circuit every round.
+func (n *Node) probePeers() {
+	cutoff := time.Now().Add(-n.probeInterval)
+	var stale []string
+	n.mu.Lock()
+	for onion, p := range n.peers {
+		if p.LastSeen.Before(cutoff) && n.breakerAllowsLocked(onion) {
+			stale = append(stale, onion)
+		}
+	}
+	n.mu.Unlock()
+	// Probe in random order so a large registry does not starve the
+	// same tail entries every round if the interval runs out.
+	rand.Shuffle(len(stale), func(i, j int) { stale[i], stale[j] = stale[j], stale[i] })
+	for _, onion := range stale {
+		n.HealthCheck(context.Background(), onion)
+	}
+}
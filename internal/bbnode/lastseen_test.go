@@ -0,0 +1,57 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+func TestPeerLastSeen(t *testing.T) {
+	a, b := startPairedNodes(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+
+	// Outbound contact updates b's view of a; the inbound call updates
+	// a's view of b.
+	if p, err := b.findPeer(a.Address()); err != nil || p.LastSeen.IsZero() {
+		t.Errorf("outbound last-seen not recorded: %v %+v", err, p)
+	}
+	if p, err := a.findPeer(b.Address()); err != nil || p.LastSeen.IsZero() {
+		t.Errorf("inbound last-seen not recorded: %v %+v", err, p)
+	}
+}
+
+func TestPeerProbeFailures(t *testing.T) {
+	a, _ := startPairedNodes(t)
+
+	// A registered peer that is not on the network: probes must fail
+	// and accumulate until the unreachable threshold.
+	ghostPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghost := keys.OnionAddress(ghostPub)
+	if err := a.AddPeer(ghost, "ghost"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	for i := 0; i < UnreachableProbeThreshold; i++ {
+		a.probePeers()
+	}
+	p, err := a.findPeer(ghost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ProbeFailures != UnreachableProbeThreshold {
+		t.Errorf("ProbeFailures = %d, want %d", p.ProbeFailures, UnreachableProbeThreshold)
+	}
+	if got := a.UnreachablePeers(); got != 1 {
+		t.Errorf("UnreachablePeers = %d, want 1", got)
+	}
+}
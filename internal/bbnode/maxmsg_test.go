@@ -0,0 +1,74 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// protoOverhead leaves room for the message framing around the payload.
+const protoOverhead = 64
+
+func TestMaxMsgSizeDefault(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	under := make([]byte, bbrpc.GRPCMaxMsgSize-protoOverhead)
+	if err := b.Ping(ctx, a.Address(), under); err != nil {
+		t.Fatalf("Ping under limit: %v", err)
+	}
+
+	over := make([]byte, bbrpc.GRPCMaxMsgSize+1)
+	err := b.Ping(ctx, a.Address(), over)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Ping over limit: got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestMaxMsgSizeRaised(t *testing.T) {
+	network := netmock.New()
+	const raised = 64 * 1024
+
+	a, err := New("password-a", network, t.TempDir(), WithMaxMsgSize(raised))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+	b, err := New("password-b", network, t.TempDir(), WithMaxMsgSize(raised))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { b.Stop() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	payload := make([]byte, raised-protoOverhead)
+	if err := b.Ping(ctx, a.Address(), payload); err != nil {
+		t.Fatalf("Ping with raised limit: %v", err)
+	}
+
+	// The raised limit is advertised via HealthCheck.
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if got := b.PeerMaxMsgSize(a.Address()); got != raised {
+		t.Errorf("PeerMaxMsgSize = %d, want %d", got, raised)
+	}
+}
@@ -0,0 +1,214 @@
+// Hosted-data migration: when this node retires, the data it stores
+// for a peer can move to that peer's new host directly, host to host,
+// without the owner re-uploading anything. The blobs stay sealed with
+// the owner's keys throughout — neither host can read them. After a
+// complete transfer the local copies enter the trash grace period, so
+// a mistake is reversible until the retention sweep catches up.
+
+package bbnode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+)
+
+// MigrationResult summarizes one hosted-data migration.
+type MigrationResult struct {
+	// Owner and Target are the onion addresses of the peer whose data
+	// moved and of its new host.
+	Owner  string
+	Target string
+	// Migrated is how many blobs this run transferred; Skipped is how
+	// many the target already had, e.g. from an interrupted earlier
+	// run.
+	Migrated int
+	Skipped  int
+	// Bytes is the transferred volume.
+	Bytes int64
+	// DeleteAt is when the local copies leave the trash and are
+	// deleted.
+	DeleteAt time.Time
+}
+
+// MigrateHostedData streams every blob stored for the owner to the
+// target peer and, once the target confirmed the full set, notifies
+// the owner over the messaging channel and puts the local copies into
+// the trash grace period. Interrupting the transfer is safe: a retry
+// skips blobs the target already has, and nothing is trashed until a
+// run completes.
+func (n *Node) MigrateHostedData(ctx context.Context, ownerSpec, targetSpec string) (*MigrationResult, error) {
+	owner, err := n.findPeer(ownerSpec)
+	if err != nil {
+		return nil, err
+	}
+	target, err := n.findPeer(targetSpec)
+	if err != nil {
+		return nil, err
+	}
+	if owner.Onion == target.Onion {
+		return nil, fmt.Errorf("cannot migrate a peer's data to the peer itself; they can fetch it directly")
+	}
+	if err := n.requireFeature(target.Onion, bbrpc.FeatureMigration, "chunk migration"); err != nil {
+		return nil, err
+	}
+	names, err := n.chunks.List(owner.Onion, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("nothing stored for %s", owner.Onion)
+	}
+	sort.Strings(names)
+
+	cc, err := n.getConn(ctx, target.Onion)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", target.Onion, err)
+	}
+	client := pb.NewPeerClient(cc)
+
+	missing, err := missingOnTarget(ctx, client, owner.Onion, names)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrationResult{
+		Owner:   owner.Onion,
+		Target:  target.Onion,
+		Skipped: len(names) - len(missing),
+	}
+	if len(missing) > 0 {
+		sent, bytes, err := n.sendBlobs(ctx, client, owner.Onion, missing)
+		if err != nil {
+			return nil, err
+		}
+		result.Migrated, result.Bytes = sent, bytes
+	}
+
+	// Only a complete transfer changes local state; a failed run above
+	// left everything in place for the retry.
+	n.notifyMigration(ctx, owner.Onion, target.Onion, names)
+	grace := time.Duration(n.RetentionConfig().TrashGraceDays) * 24 * time.Hour
+	rec := trashRecord{TrashedAt: time.Now(), Warned: true, Migrated: true}
+	if err := n.sec.PutJSON(retentionKey(owner.Onion), &rec); err != nil {
+		return nil, fmt.Errorf("trash local copies: %w", err)
+	}
+	result.DeleteAt = rec.TrashedAt.Add(grace)
+	n.auditEvent("hosting_migrated", map[string]string{
+		"owner":  owner.Onion,
+		"target": target.Onion,
+		"blobs":  fmt.Sprint(len(names)),
+	})
+	return result, nil
+}
+
+// missingOnTarget asks the target which of the owner's blobs it lacks,
+// in batches, so a resumed migration only resends the gap.
+func missingOnTarget(ctx context.Context, client pb.PeerClient, owner string, names []string) ([]string, error) {
+	var missing []string
+	for start := 0; start < len(names); start += bbrpc.HasChunksBatch {
+		end := start + bbrpc.HasChunksBatch
+		if end > len(names) {
+			end = len(names)
+		}
+		batch := names[start:end]
+		resp, err := client.HasOwnedChunks(ctx, &pb.HasOwnedChunksRequest{Owner: owner, Names: batch})
+		if err != nil {
+			return nil, fmt.Errorf("probe target: %w", err)
+		}
+		for i, name := range batch {
+			if i/8 >= len(resp.Present) || resp.Present[i/8]&(1<<(i%8)) == 0 {
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// sendBlobs streams the named blobs to the target in bounded frames.
+func (n *Node) sendBlobs(ctx context.Context, client pb.PeerClient, owner string, names []string) (sent int, bytes int64, err error) {
+	stream, err := client.MigrateChunks(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open migration stream: %w", err)
+	}
+	firstFrame := true
+	for _, name := range names {
+		rc, err := n.chunks.Open(owner, name)
+		if err != nil {
+			return 0, 0, fmt.Errorf("open blob %s: %w", name, err)
+		}
+		buf := make([]byte, chunkFrameSize)
+		var sentAny bool
+		for {
+			k, readErr := rc.Read(buf)
+			if k > 0 || !sentAny {
+				frame := &pb.MigrateChunksRequest{Name: name, Data: buf[:k]}
+				if firstFrame {
+					frame.Owner = owner
+					firstFrame = false
+				}
+				if readErr == io.EOF {
+					frame.Last = true
+				}
+				if err := stream.Send(frame); err != nil {
+					rc.Close()
+					return 0, 0, fmt.Errorf("send blob %s: %w", name, err)
+				}
+				sentAny = true
+				bytes += int64(k)
+			} else if readErr == io.EOF {
+				// The final Read returned 0, EOF after a frame that was
+				// not marked last; close the blob explicitly.
+				if err := stream.Send(&pb.MigrateChunksRequest{Name: name, Last: true}); err != nil {
+					rc.Close()
+					return 0, 0, fmt.Errorf("send blob %s: %w", name, err)
+				}
+			}
+			if readErr == io.EOF {
+				break
+			} else if readErr != nil {
+				rc.Close()
+				return 0, 0, fmt.Errorf("read blob %s: %w", name, readErr)
+			}
+		}
+		rc.Close()
+		sent++
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return 0, 0, fmt.Errorf("finish migration: %w", err)
+	}
+	return sent, bytes, nil
+}
+
+// notifyMigration tells the owner where their data went, including the
+// migrated blob names so they can update their replica records. The
+// list is split across as many messages as the size cap requires. Best
+// effort: an offline owner learns about the move when their next fetch
+// fails over.
+func (n *Node) notifyMigration(ctx context.Context, owner, target string, names []string) {
+	header := fmt.Sprintf("the data you stored here was migrated to %s; migrated chunks: ", target)
+	var batch []string
+	size := len(header)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := n.SendMessage(ctx, owner, header+strings.Join(batch, ",")); err != nil {
+			n.auditEvent("migration_notify_failed", map[string]string{"owner": owner, "error": err.Error()})
+		}
+		batch, size = nil, len(header)
+	}
+	for _, name := range names {
+		if size+len(name)+1 > bbrpc.MaxMessageSize {
+			flush()
+		}
+		batch = append(batch, name)
+		size += len(name) + 1
+	}
+	flush()
+}
@@ -0,0 +1,213 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestMigrateHostedData(t *testing.T) {
+	network := netmock.New()
+	owner := startTestNode(t, network, "password-a")
+	oldHost := startTestNode(t, network, "password-b")
+	newHost := startTestNode(t, network, "password-c")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Everyone knows everyone: the owner stores on the old host, and
+	// both hosts have the owner and each other registered.
+	if err := owner.AddPeer(oldHost.Address(), "old"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := oldHost.AddPeer(owner.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := oldHost.AddPeer(newHost.Address(), "new"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := newHost.AddPeer(oldHost.Address(), "old"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := newHost.AddPeer(owner.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	oldHost.recordPeerCaps(newHost.Address(), bbrpc.ProtocolVersion, bbrpc.LocalFeatures)
+
+	// Seed hosted blobs: one spanning several frames, one exactly one
+	// frame (exercises the explicit trailing last frame), one small.
+	blobs := map[string][]byte{
+		"chunk-big":   bytes.Repeat([]byte{1}, 2*chunkFrameSize+100),
+		"chunk-exact": bytes.Repeat([]byte{2}, chunkFrameSize),
+		"chunk-small": []byte("tiny"),
+	}
+	var total int64
+	for name, data := range blobs {
+		if err := oldHost.chunks.Put(owner.Address(), name, data); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		total += int64(len(data))
+	}
+	// One blob is already on the new host, as after an interrupted run.
+	if err := newHost.chunks.Put(owner.Address(), "chunk-small", blobs["chunk-small"]); err != nil {
+		t.Fatalf("Put on new host: %v", err)
+	}
+
+	result, err := oldHost.MigrateHostedData(ctx, "alice", newHost.Address())
+	if err != nil {
+		t.Fatalf("MigrateHostedData: %v", err)
+	}
+	if result.Migrated != 2 || result.Skipped != 1 {
+		t.Errorf("migrated %d skipped %d, want 2 and 1", result.Migrated, result.Skipped)
+	}
+	if want := total - int64(len(blobs["chunk-small"])); result.Bytes != want {
+		t.Errorf("Bytes = %d, want %d", result.Bytes, want)
+	}
+	if !result.DeleteAt.After(time.Now().Add(13 * 24 * time.Hour)) {
+		t.Errorf("DeleteAt %v sooner than the default grace period", result.DeleteAt)
+	}
+	for name, data := range blobs {
+		got, err := newHost.chunks.Get(owner.Address(), name)
+		if err != nil {
+			t.Fatalf("Get %s on new host: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("blob %s corrupted in transit", name)
+		}
+	}
+
+	// The owner was told where the data went, including the chunk names.
+	msgs, err := owner.ListMessages("old")
+	if err != nil {
+		t.Fatalf("ListMessages: %v", err)
+	}
+	if len(msgs) == 0 {
+		t.Fatal("owner received no migration notice")
+	}
+	notice := msgs[len(msgs)-1].Body
+	if !strings.Contains(notice, newHost.Address()) {
+		t.Errorf("notice does not name the new host: %q", notice)
+	}
+	for name := range blobs {
+		if !strings.Contains(notice, name) {
+			t.Errorf("notice does not list %s: %q", name, notice)
+		}
+	}
+
+	// Local copies are in the trash as migrated, and the sweep deletes
+	// them after the grace period without an agreement-based rescue.
+	var rec trashRecord
+	if err := oldHost.sec.GetJSON(retentionKey(owner.Address()), &rec); err != nil {
+		t.Fatalf("load trash record: %v", err)
+	}
+	if !rec.Migrated || !rec.Warned {
+		t.Errorf("trash record = %+v, want migrated and warned", rec)
+	}
+	if !oldHost.chunks.Has(owner.Address(), "chunk-big") {
+		t.Error("local copy deleted before the grace period ran out")
+	}
+	rec.TrashedAt = time.Now().Add(-15 * 24 * time.Hour)
+	if err := oldHost.sec.PutJSON(retentionKey(owner.Address()), &rec); err != nil {
+		t.Fatalf("backdate trash record: %v", err)
+	}
+	if err := oldHost.retentionSweep(ctx); err != nil {
+		t.Fatalf("retentionSweep: %v", err)
+	}
+	for name := range blobs {
+		if oldHost.chunks.Has(owner.Address(), name) {
+			t.Errorf("local copy of %s survived the sweep", name)
+		}
+	}
+}
+
+func TestMigrateHostedDataResume(t *testing.T) {
+	network := netmock.New()
+	owner := startTestNode(t, network, "password-a")
+	oldHost := startTestNode(t, network, "password-b")
+	newHost := startTestNode(t, network, "password-c")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := oldHost.AddPeer(owner.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := oldHost.AddPeer(newHost.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := newHost.AddPeer(oldHost.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := newHost.AddPeer(owner.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	oldHost.recordPeerCaps(newHost.Address(), bbrpc.ProtocolVersion, bbrpc.LocalFeatures)
+
+	// More blobs than one HasOwnedChunks batch, all but one already on
+	// the target: only the gap is resent.
+	for i := 0; i < bbrpc.HasChunksBatch+5; i++ {
+		name := fmt.Sprintf("chunk-%04d", i)
+		data := []byte(name)
+		if err := oldHost.chunks.Put(owner.Address(), name, data); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if i != 42 {
+			if err := newHost.chunks.Put(owner.Address(), name, data); err != nil {
+				t.Fatalf("Put on new host: %v", err)
+			}
+		}
+	}
+	result, err := oldHost.MigrateHostedData(ctx, owner.Address(), newHost.Address())
+	if err != nil {
+		t.Fatalf("MigrateHostedData: %v", err)
+	}
+	if result.Migrated != 1 || result.Skipped != bbrpc.HasChunksBatch+4 {
+		t.Errorf("migrated %d skipped %d, want 1 and %d", result.Migrated, result.Skipped, bbrpc.HasChunksBatch+4)
+	}
+	if !newHost.chunks.Has(owner.Address(), "chunk-0042") {
+		t.Error("the missing blob was not transferred")
+	}
+}
+
+func TestMigrateHostedDataErrors(t *testing.T) {
+	network := netmock.New()
+	owner := startTestNode(t, network, "password-a")
+	oldHost := startTestNode(t, network, "password-b")
+	newHost := startTestNode(t, network, "password-c")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := oldHost.AddPeer(owner.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := oldHost.AddPeer(newHost.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	// The target has not advertised the migration feature.
+	if err := oldHost.chunks.Put(owner.Address(), "chunk-a", []byte("x")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	_, err := oldHost.MigrateHostedData(ctx, owner.Address(), newHost.Address())
+	if err == nil || !strings.Contains(err.Error(), "does not support") {
+		t.Errorf("migration to a non-supporting host: %v, want feature error", err)
+	}
+
+	// Migrating to the owner themselves is refused.
+	oldHost.recordPeerCaps(newHost.Address(), bbrpc.ProtocolVersion, bbrpc.LocalFeatures)
+	if _, err := oldHost.MigrateHostedData(ctx, owner.Address(), owner.Address()); err == nil {
+		t.Error("migration to the owner succeeded, want error")
+	}
+
+	// Nothing stored for the peer.
+	oldHost.recordPeerCaps(owner.Address(), bbrpc.ProtocolVersion, bbrpc.LocalFeatures)
+	_, err = oldHost.MigrateHostedData(ctx, newHost.Address(), owner.Address())
+	if err == nil || !strings.Contains(err.Error(), "nothing stored") {
+		t.Errorf("migration with nothing stored: %v, want error", err)
+	}
+}
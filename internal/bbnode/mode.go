@@ -0,0 +1,124 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Mode is the node's maintenance mode.
+type Mode string
+
+const (
+	// ModeNormal serves everything.
+	ModeNormal Mode = "normal"
+	// ModeReadOnly keeps the node up for restores but rejects new
+	// writes and agreement proposals, e.g. while disk is nearly full.
+	ModeReadOnly Mode = "read-only"
+	// ModeDraining is read-only and, once the drain deadline passes,
+	// also refuses new fetches so the operator can shut down.
+	ModeDraining Mode = "draining"
+)
+
+// defaultDrainGrace is how long a DRAINING node keeps serving fetches
+// when SetMode did not pick a deadline.
+const defaultDrainGrace = time.Hour
+
+// modeKey holds the maintenance mode in the secstore.
+const modeKey = "config/mode"
+
+// modeState is the persisted form of the maintenance mode.
+type modeState struct {
+	Mode              Mode  `json:"mode"`
+	DrainDeadlineUnix int64 `json:"drain_deadline_unix,omitempty"`
+}
+
+// loadMode reads the persisted maintenance mode, defaulting to normal.
+// Called from New, so a node restarted mid-maintenance stays in
+// maintenance.
+func (n *Node) loadMode() error {
+	n.mode = ModeNormal
+	var st modeState
+	err := n.sec.GetJSON(modeKey, &st)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	n.mode = st.Mode
+	if st.DrainDeadlineUnix != 0 {
+		n.drainDeadline = time.Unix(st.DrainDeadlineUnix, 0)
+	}
+	return nil
+}
+
+// SetMode validates, persists, and applies a maintenance mode. For
+// draining, deadline is when fetches stop being served; zero means
+// defaultDrainGrace from now.
+func (n *Node) SetMode(mode Mode, deadline time.Time) error {
+	switch mode {
+	case ModeNormal, ModeReadOnly:
+		deadline = time.Time{}
+	case ModeDraining:
+		if deadline.IsZero() {
+			deadline = time.Now().Add(defaultDrainGrace)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q (want %s, %s, or %s)",
+			mode, ModeNormal, ModeReadOnly, ModeDraining)
+	}
+	st := modeState{Mode: mode}
+	if !deadline.IsZero() {
+		st.DrainDeadlineUnix = deadline.Unix()
+	}
+	if err := n.sec.PutJSON(modeKey, &st); err != nil {
+		return fmt.Errorf("store mode: %w", err)
+	}
+	n.modeMu.Lock()
+	n.mode = mode
+	n.drainDeadline = deadline
+	n.modeMu.Unlock()
+	n.auditEvent("mode_changed", map[string]string{"mode": string(mode)})
+	return nil
+}
+
+// Mode returns the maintenance mode and, for draining, the fetch
+// deadline.
+func (n *Node) Mode() (Mode, time.Time) {
+	n.modeMu.Lock()
+	defer n.modeMu.Unlock()
+	return n.mode, n.drainDeadline
+}
+
+// modeRejectsWrite returns a reason when the maintenance mode refuses
+// writes and agreement proposals.
+func (n *Node) modeRejectsWrite() (string, bool) {
+	mode, _ := n.Mode()
+	switch mode {
+	case ModeReadOnly:
+		return "peer is in maintenance (read-only): not accepting new data", true
+	case ModeDraining:
+		return "peer is draining for shutdown: not accepting new data", true
+	}
+	return "", false
+}
+
+// modeRejectsFetch returns a reason when the maintenance mode refuses
+// fetches: only draining past its deadline does.
+func (n *Node) modeRejectsFetch() (string, bool) {
+	mode, deadline := n.Mode()
+	if mode == ModeDraining && time.Now().After(deadline) {
+		return "peer is draining for shutdown: restore window has closed", true
+	}
+	return "", false
+}
+
+// PeerMode returns the maintenance mode the peer at addr advertised in
+// its last HealthCheck response; empty if unknown.
+func (n *Node) PeerMode(addr string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.peerMode[addr]
+}
@@ -0,0 +1,88 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestModePersistsAcrossRestart(t *testing.T) {
+	network := netmock.New()
+	dir := t.TempDir()
+	a, err := New("password-a", network, dir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.SetMode(ModeReadOnly, time.Time{}); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	a.Stop()
+
+	b, err := New("password-a", network, dir)
+	if err != nil {
+		t.Fatalf("New after restart: %v", err)
+	}
+	defer b.Stop()
+	if mode, _ := b.Mode(); mode != ModeReadOnly {
+		t.Errorf("mode after restart = %q, want %q", mode, ModeReadOnly)
+	}
+	if err := b.SetMode("repair", time.Time{}); err == nil {
+		t.Error("SetMode accepted an unknown mode")
+	}
+}
+
+func TestReadOnlyRejectsWritesButServesFetches(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	client := pb.NewPeerClient(cc)
+	if _, err := client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("x")}); err != nil {
+		t.Fatalf("StoreChunk before maintenance: %v", err)
+	}
+
+	if err := a.SetMode(ModeReadOnly, time.Time{}); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	_, err = client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c2", Data: []byte("y")})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("StoreChunk in read-only: %v, want FailedPrecondition", err)
+	}
+	if _, err := b.fetchChunkData(ctx, client, a.Address(), "c1"); err != nil {
+		t.Errorf("FetchChunk in read-only: %v", err)
+	}
+	// The mode travels in HealthCheck responses so clients can warn the
+	// operator.
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if got := b.PeerMode(a.Address()); got != string(ModeReadOnly) {
+		t.Errorf("PeerMode = %q, want %q", got, ModeReadOnly)
+	}
+
+	// Draining past its deadline refuses fetches too.
+	if err := a.SetMode(ModeDraining, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("SetMode draining: %v", err)
+	}
+	_, err = b.fetchChunkData(ctx, client, a.Address(), "c1")
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("FetchChunk while draining: %v, want FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,199 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Message is a text message exchanged with a peer, stored per-peer in the
+// secstore.
+type Message struct {
+	// ID identifies the message locally.
+	ID string `json:"id"`
+	// Peer is the onion address of the other side.
+	Peer string `json:"peer"`
+	// Body is the message text.
+	Body string `json:"body"`
+	// Incoming is true for received messages, false for sent ones.
+	Incoming bool `json:"incoming"`
+	// SentAt is the sender's clock when the message was composed.
+	SentAt time.Time `json:"sent_at"`
+	// ReceivedAt is the receiver's clock on delivery.
+	ReceivedAt time.Time `json:"received_at,omitempty"`
+	// Read reports whether the local user has seen the message.
+	Read bool `json:"read"`
+}
+
+func msgKey(peerOnion string) string {
+	return "messages/" + peerOnion
+}
+
+func newMessageID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// SendMessage delivers body to the peer identified by alias or onion
+// address and records the sent copy locally.
+func (n *Node) SendMessage(ctx context.Context, aliasOrOnion, body string) error {
+	if len(body) > bbrpc.MaxMessageSize {
+		return fmt.Errorf("message too long: %d bytes, max %d", len(body), bbrpc.MaxMessageSize)
+	}
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return err
+	}
+	sentAt := time.Now()
+	err = n.callPeer(ctx, p.Onion, 0, func(ctx context.Context, client pb.PeerClient) error {
+		_, err := client.SendMessage(ctx, &pb.SendMessageRequest{
+			Body:       body,
+			SentAtUnix: sentAt.Unix(),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return n.appendMessage(&Message{
+		ID:       newMessageID(),
+		Peer:     p.Onion,
+		Body:     body,
+		Incoming: false,
+		SentAt:   sentAt,
+		Read:     true,
+	})
+}
+
+// receiveMessage stores an inbound message from peerOnion and returns its
+// assigned ID.
+func (n *Node) receiveMessage(peerOnion, body string, sentAt time.Time) (string, error) {
+	m := &Message{
+		ID:         newMessageID(),
+		Peer:       peerOnion,
+		Body:       body,
+		Incoming:   true,
+		SentAt:     sentAt,
+		ReceivedAt: time.Now(),
+	}
+	if err := n.appendMessage(m); err != nil {
+		return "", err
+	}
+	return m.ID, nil
+}
+
+// ListMessages returns messages exchanged with the given peer, or with
+// all peers when aliasOrOnion is empty, oldest first.
+func (n *Node) ListMessages(aliasOrOnion string) ([]Message, error) {
+	var peers []string
+	if aliasOrOnion == "" {
+		keys, err := n.sec.List("messages/")
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			peers = append(peers, k[len("messages/"):])
+		}
+	} else {
+		p, err := n.findPeer(aliasOrOnion)
+		if err != nil {
+			return nil, err
+		}
+		peers = []string{p.Onion}
+	}
+	var out []Message
+	for _, onion := range peers {
+		msgs, err := n.loadMessages(onion)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, msgs...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SentAt.Before(out[j].SentAt) })
+	return out, nil
+}
+
+// MarkRead marks the messages with the given IDs as read.
+func (n *Node) MarkRead(ids []string) error {
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	keys, err := n.sec.List("messages/")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var msgs []Message
+		if err := n.sec.GetJSON(key, &msgs); err != nil {
+			return err
+		}
+		changed := false
+		for i := range msgs {
+			if want[msgs[i].ID] && !msgs[i].Read {
+				msgs[i].Read = true
+				changed = true
+			}
+		}
+		if changed {
+			if err := n.sec.PutJSON(key, msgs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnreadCount returns the number of unread incoming messages.
+func (n *Node) UnreadCount() int {
+	keys, err := n.sec.List("messages/")
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, key := range keys {
+		var msgs []Message
+		if err := n.sec.GetJSON(key, &msgs); err != nil {
+			continue
+		}
+		for _, m := range msgs {
+			if m.Incoming && !m.Read {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (n *Node) loadMessages(peerOnion string) ([]Message, error) {
+	var msgs []Message
+	err := n.sec.GetJSON(msgKey(peerOnion), &msgs)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (n *Node) appendMessage(m *Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	msgs, err := n.loadMessages(m.Peer)
+	if err != nil {
+		return err
+	}
+	msgs = append(msgs, *m)
+	return n.sec.PutJSON(msgKey(m.Peer), msgs)
+}
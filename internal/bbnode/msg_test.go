@@ -0,0 +1,102 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func startTestNode(t *testing.T, network Network, password string) *Node {
+	t.Helper()
+	// The mock network answers or fails instantly; a short call timeout
+	// keeps a test against an absent peer from waiting out the 2-minute
+	// production default.
+	n, err := New(password, network, t.TempDir(), WithPeerCallTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { n.Stop() })
+	return n
+}
+
+func TestMessaging(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// b knows a, but a has not authorized b yet.
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	err := b.SendMessage(ctx, "alice", "hello?")
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("SendMessage unauthorized: got %v, want PermissionDenied", err)
+	}
+
+	// After mutual registration the message goes through.
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.SendMessage(ctx, "alice", "hello!"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	if got := a.UnreadCount(); got != 1 {
+		t.Errorf("UnreadCount = %d, want 1", got)
+	}
+	msgs, err := a.ListMessages("bob")
+	if err != nil {
+		t.Fatalf("ListMessages: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Body != "hello!" || !msgs[0].Incoming {
+		t.Fatalf("ListMessages: got %+v", msgs)
+	}
+	if msgs[0].ReceivedAt.IsZero() {
+		t.Error("ReceivedAt not set")
+	}
+
+	if err := a.MarkRead([]string{msgs[0].ID}); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	if got := a.UnreadCount(); got != 0 {
+		t.Errorf("UnreadCount after MarkRead = %d, want 0", got)
+	}
+
+	// The sender keeps a copy marked outgoing and read.
+	sent, err := b.ListMessages("")
+	if err != nil {
+		t.Fatalf("ListMessages on sender: %v", err)
+	}
+	if len(sent) != 1 || sent[0].Incoming || !sent[0].Read {
+		t.Errorf("sender copy: got %+v", sent)
+	}
+}
+
+func TestMessageTooLong(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	long := make([]byte, 5*1024)
+	if err := b.SendMessage(ctx, a.Address(), string(long)); err == nil {
+		t.Error("SendMessage with oversized body succeeded, want error")
+	}
+}
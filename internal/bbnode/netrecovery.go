@@ -0,0 +1,125 @@
+package bbnode
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Recovery attempts back off exponentially: a Tor that died from OOM
+// pressure tends to die again immediately, and hammering it makes the
+// pressure worse. Each attempt is bounded so a wedged bootstrap cannot
+// stall the loop forever.
+const (
+	recoveryBaseDelay     = 5 * time.Second
+	recoveryMaxDelay      = 5 * time.Minute
+	recoveryRegisterLimit = 5 * time.Minute
+)
+
+// downNotifier is implemented by networks that can lose their transport
+// out from under the node. nettor implements it: the channel delivers
+// one error per Tor process crash.
+type downNotifier interface {
+	Down() <-chan error
+}
+
+// NetworkStatus is a snapshot of the node's network publication state,
+// covering transport crashes and the republish loop that follows them.
+type NetworkStatus struct {
+	// Recovering reports that the transport went down and the node has
+	// not republished its onion address yet.
+	Recovering bool
+	// RecoveryAttempts counts republish attempts since the transport
+	// last went down; the final count survives a successful recovery.
+	RecoveryAttempts int
+	// LastFailure describes the most recent transport failure and
+	// LastFailureAt is when it was observed. Both stay set after
+	// recovery so operators can see that the network flapped.
+	LastFailure   string
+	LastFailureAt time.Time
+}
+
+// NetworkStatus returns the latest network publication state.
+func (n *Node) NetworkStatus() NetworkStatus {
+	n.netMu.Lock()
+	defer n.netMu.Unlock()
+	return n.netStatus
+}
+
+// runNetworkRecovery watches the network's down channel and republishes
+// the node after each transport crash. It runs until Stop.
+func (n *Node) runNetworkRecovery(down <-chan error, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case err := <-down:
+			n.recoverNetwork(err, stop)
+		}
+	}
+}
+
+// recoverNetwork tears down the server left behind by a dead transport
+// and retries publishAndServe with backoff until the node is reachable
+// again or Stop interrupts it. The onion key is unchanged, so peers
+// find the node at the same address once the new descriptor publishes.
+func (n *Node) recoverNetwork(cause error, stop chan struct{}) {
+	log.Printf("network down: %v; republishing", cause)
+	n.auditEvent("network_down", map[string]string{"error": cause.Error()})
+	n.netMu.Lock()
+	n.netStatus.Recovering = true
+	n.netStatus.RecoveryAttempts = 0
+	n.netStatus.LastFailure = cause.Error()
+	n.netStatus.LastFailureAt = time.Now()
+	n.netMu.Unlock()
+
+	// The old server and pooled connections all ran over the dead
+	// transport; every one of them would only fail slowly on first use.
+	n.mu.Lock()
+	srv, ln := n.srv, n.ln
+	n.srv, n.ln = nil, nil
+	conns := n.conns
+	n.conns = make(map[string]*poolConn)
+	n.mu.Unlock()
+	for _, pc := range conns {
+		pc.cc.Close()
+	}
+	if srv != nil {
+		srv.Stop()
+	}
+	if ln != nil {
+		ln.Close()
+	}
+
+	delay := recoveryBaseDelay
+	for {
+		n.netMu.Lock()
+		n.netStatus.RecoveryAttempts++
+		attempt := n.netStatus.RecoveryAttempts
+		n.netMu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), recoveryRegisterLimit)
+		err := n.publishAndServe(ctx)
+		cancel()
+		if err == nil {
+			log.Printf("network recovered after %d attempts", attempt)
+			n.auditEvent("network_recovered", map[string]string{"address": n.Address()})
+			n.netMu.Lock()
+			n.netStatus.Recovering = false
+			n.netMu.Unlock()
+			return
+		}
+		log.Printf("network recovery attempt %d: %v", attempt, err)
+		n.netMu.Lock()
+		n.netStatus.LastFailure = err.Error()
+		n.netStatus.LastFailureAt = time.Now()
+		n.netMu.Unlock()
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > recoveryMaxDelay {
+			delay = recoveryMaxDelay
+		}
+	}
+}
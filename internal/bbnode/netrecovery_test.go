@@ -0,0 +1,80 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// crashNetwork wraps a netmock network with the down channel nettor
+// exposes, so tests can simulate a Tor process crash.
+type crashNetwork struct {
+	*netmock.MockNetwork
+	down chan error
+}
+
+func (c *crashNetwork) Down() <-chan error { return c.down }
+
+func TestNetworkRecovery(t *testing.T) {
+	network := netmock.New()
+	cn := &crashNetwork{MockNetwork: network, down: make(chan error, 1)}
+	a := startTestNode(t, cn, "password-a")
+	b := startTestNode(t, network, "password-b")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if _, err := a.HealthCheck(ctx, b.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if got := a.PoolStats().Conns; got != 1 {
+		t.Fatalf("pooled conns before crash = %d, want 1", got)
+	}
+
+	// The transport dies; Tor would also have closed a's listener here.
+	a.ln.Close()
+	cn.down <- errors.New("tor died: process exited")
+
+	deadline := time.Now().Add(5 * time.Second)
+	var ns NetworkStatus
+	for {
+		ns = a.NetworkStatus()
+		if !ns.Recovering && ns.RecoveryAttempts > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recovery did not finish: %+v", ns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ns.RecoveryAttempts != 1 {
+		t.Errorf("RecoveryAttempts = %d, want 1", ns.RecoveryAttempts)
+	}
+	if !strings.Contains(ns.LastFailure, "tor died") {
+		t.Errorf("LastFailure = %q, want the crash error", ns.LastFailure)
+	}
+	if got := a.PoolStats().Conns; got != 0 {
+		t.Errorf("pooled conns after crash = %d, want 0 (invalidated)", got)
+	}
+
+	// The republished node answers at the same onion address.
+	onion, err := b.HealthCheck(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("HealthCheck after recovery: %v", err)
+	}
+	if onion != a.Address() {
+		t.Errorf("recovered node reports %s, want %s", onion, a.Address())
+	}
+	// And a can dial out again through the restarted transport.
+	if _, err := a.HealthCheck(ctx, b.Address()); err != nil {
+		t.Errorf("outbound HealthCheck after recovery: %v", err)
+	}
+}
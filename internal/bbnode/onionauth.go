@@ -0,0 +1,71 @@
+package bbnode
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// onionAuthKey is the secstore key holding the client-auth flag.
+const onionAuthKey = "config/onion-auth"
+
+// clientAuthNetwork is implemented by networks that support Tor v3
+// client authorization (nettor does; netmock does not).
+type clientAuthNetwork interface {
+	SetClientAuthKey(priv []byte)
+	SetAuthorizedClients(ctx context.Context, pubs [][]byte) error
+}
+
+// OnionAuthEnabled reports whether the onion service requires client
+// authorization.
+func (n *Node) OnionAuthEnabled() bool {
+	var enabled bool
+	if err := n.sec.GetJSON(onionAuthKey, &enabled); err != nil {
+		return false
+	}
+	return enabled
+}
+
+// SetOnionAuth toggles client authorization on the onion service. When
+// enabled, only registered peers can fetch the service descriptor, so
+// the node is invisible to anyone who merely learns its address. The
+// setting persists across restarts.
+func (n *Node) SetOnionAuth(ctx context.Context, enabled bool) error {
+	if _, ok := n.network.(clientAuthNetwork); !ok {
+		return fmt.Errorf("network does not support onion client authorization")
+	}
+	if err := n.sec.PutJSON(onionAuthKey, enabled); err != nil {
+		return err
+	}
+	return n.refreshOnionAuth(ctx)
+}
+
+// refreshOnionAuth pushes the node's auth key and the authorized client
+// set derived from the peer registry to the network. It is a no-op on
+// networks without client auth support.
+func (n *Node) refreshOnionAuth(ctx context.Context) error {
+	can, ok := n.network.(clientAuthNetwork)
+	if !ok {
+		return nil
+	}
+	onionKey, err := n.signingKey()
+	if err != nil {
+		return err
+	}
+	// The dial-side key is always available, so we can reach peers who
+	// require authorization regardless of our own setting.
+	can.SetClientAuthKey(keys.CurveAuthPrivFromOnionKey(onionKey))
+	if !n.OnionAuthEnabled() {
+		return can.SetAuthorizedClients(ctx, nil)
+	}
+	var pubs [][]byte
+	for _, p := range n.ListPeers() {
+		pub, err := keys.CurveAuthPubFromOnion(p.Onion)
+		if err != nil {
+			return fmt.Errorf("client auth key for peer %s: %w", p.Onion, err)
+		}
+		pubs = append(pubs, pub)
+	}
+	return can.SetAuthorizedClients(ctx, pubs)
+}
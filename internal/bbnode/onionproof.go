@@ -0,0 +1,88 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/rand"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// Onion ownership proofs. The TLS client certificate only shows the
+// caller holds some Ed25519 key that maps to an onion address; nothing
+// in the handshake proves the caller actually serves that onion. The
+// proof closes the gap explicitly: the server issues a random challenge
+// (in its Join or HealthCheck response), the client signs it with the
+// onion identity key under a domain separation tag (see internal/keys),
+// and the peer entry records the result. With WithRequireOnionProof the
+// interceptor refuses data-plane calls from unproven peers.
+
+// onionChallengeSize is the length of one challenge nonce.
+const onionChallengeSize = 32
+
+// issueOnionChallenge hands out (and remembers) the challenge the
+// caller's ownership proof must cover. Re-issuing replaces the old
+// challenge; a challenge is consumed by the proof that answers it.
+func (n *Node) issueOnionChallenge(caller string) []byte {
+	nonce := make([]byte, onionChallengeSize)
+	rand.Read(nonce)
+	n.mu.Lock()
+	n.onionChallenges[caller] = nonce
+	n.mu.Unlock()
+	return nonce
+}
+
+// needsOnionProof reports whether the registered caller has yet to
+// prove its identity; unknown callers have nothing to prove against.
+func (n *Node) needsOnionProof(caller string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p, ok := n.peers[caller]
+	return ok && !p.OnionProven
+}
+
+// proveOnion verifies the caller's signature over its outstanding
+// challenge and marks the peer entry proven. Errors are gRPC statuses
+// ready for the ProveOnion handler to return.
+func (n *Node) proveOnion(caller string, sig []byte) error {
+	n.mu.Lock()
+	nonce, ok := n.onionChallenges[caller]
+	n.mu.Unlock()
+	if !ok {
+		return status.Error(codes.FailedPrecondition, "no onion challenge issued; run HealthCheck first")
+	}
+	if !keys.VerifyOnionProof(caller, nonce, sig) {
+		n.auditEvent("onion_proof_failed", map[string]string{"onion": caller})
+		return status.Error(codes.PermissionDenied, "bad onion ownership proof")
+	}
+	n.mu.Lock()
+	delete(n.onionChallenges, caller)
+	p, known := n.peers[caller]
+	var err error
+	if known && !p.OnionProven {
+		p.OnionProven = true
+		err = n.savePeersLocked()
+	}
+	n.mu.Unlock()
+	if err != nil {
+		return status.Errorf(codes.Internal, "persist peer registry: %v", err)
+	}
+	if known {
+		n.auditEvent("onion_proven", map[string]string{"onion": caller})
+	}
+	return nil
+}
+
+// answerOnionChallenge signs the server's challenge with this node's
+// onion key and submits the proof over an already open client. Both the
+// outbound HealthCheck and the invite join answer challenges this way,
+// so a peer upgraded to a proof-requiring build accepts this node's
+// data again after the next contact.
+func (n *Node) answerOnionChallenge(ctx context.Context, client pb.PeerClient, challenge []byte) error {
+	sig := keys.SignOnionProof(n.onionKey, challenge)
+	_, err := client.ProveOnion(ctx, &pb.ProveOnionRequest{Signature: sig})
+	return err
+}
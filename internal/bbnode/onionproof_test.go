@@ -0,0 +1,106 @@
+package bbnode
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestProveOnionChallengeFlow(t *testing.T) {
+	a, b := startPairedNodes(t)
+
+	// Without an outstanding challenge there is nothing to prove.
+	err := a.proveOnion(b.Address(), []byte("sig"))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("proof without challenge: %v, want FailedPrecondition", err)
+	}
+
+	nonce := a.issueOnionChallenge(b.Address())
+	if err := a.proveOnion(b.Address(), []byte("bad signature")); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("bad proof: %v, want PermissionDenied", err)
+	}
+	if err := a.proveOnion(b.Address(), keys.SignOnionProof(b.onionKey, nonce)); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	p, err := a.findPeer(b.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.OnionProven {
+		t.Error("peer not marked proven after a valid proof")
+	}
+
+	// The challenge is consumed; replaying the proof needs a new one.
+	err = a.proveOnion(b.Address(), keys.SignOnionProof(b.onionKey, nonce))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("replayed proof: %v, want FailedPrecondition", err)
+	}
+}
+
+func TestHealthCheckAnswersOnionChallenge(t *testing.T) {
+	a, b := startPairedNodes(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	// The health check carried a's challenge and b answered it on the
+	// same connection.
+	p, err := a.findPeer(b.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.OnionProven {
+		t.Error("outbound health check did not prove b's identity to a")
+	}
+}
+
+func TestRequireOnionProofGatesDataPlane(t *testing.T) {
+	network := netmock.New()
+	a, err := New("password-a", network, t.TempDir(), WithRequireOnionProof())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	hasChunk := func() error {
+		return b.callPeer(ctx, a.Address(), 0, func(ctx context.Context, client pb.PeerClient) error {
+			_, err := client.HasChunk(ctx, &pb.HasChunkRequest{Name: "missing"})
+			return err
+		})
+	}
+	err = hasChunk()
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(err.Error(), "proven") {
+		t.Fatalf("data-plane call from unproven peer: %v, want PermissionDenied about proof", err)
+	}
+
+	// The health check answers the challenge; the same call now passes
+	// the interceptor.
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if err := hasChunk(); err != nil {
+		t.Errorf("data-plane call from proven peer: %v", err)
+	}
+}
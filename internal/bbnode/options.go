@@ -0,0 +1,243 @@
+package bbnode
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/starius/barterbackup/internal/auditlog"
+	"github.com/starius/barterbackup/internal/chunkstore"
+)
+
+// Option configures a Node at construction.
+type Option func(*Node)
+
+// defaultSelfCheckInterval is how often the reachability check repeats
+// once the node is up.
+const defaultSelfCheckInterval = 30 * time.Minute
+
+// WithSelfCheck enables the post-start reachability check: the node
+// dials its own onion address through the network and runs HealthCheck,
+// repeating every interval so descriptor expiry problems surface in
+// monitoring. A zero interval means the default. It is wired up for the
+// Tor network and left off for mocks, where reachability is a given.
+func WithSelfCheck(interval time.Duration) Option {
+	return func(n *Node) {
+		n.selfCheck = true
+		if interval > 0 {
+			n.selfCheckInterval = interval
+		}
+	}
+}
+
+// WithStrictIdentity makes the node stop serving when the self-check
+// finds another live instance of its identity, instead of only marking
+// itself degraded. Two daemons started from the same password otherwise
+// fight over the Tor descriptor indefinitely.
+func WithStrictIdentity() Option {
+	return func(n *Node) {
+		n.strictIdentity = true
+	}
+}
+
+// WithServerConnLimits tunes the bbrpc server's connection protections:
+// maxStreams caps concurrent streams per inbound connection, idle and
+// age bound how long a connection may live without traffic or at all,
+// and handshake bounds connection setup (first byte and TLS + HTTP/2
+// handshake). A zero value keeps that field's default; see
+// connlimits.go for the defaults and their Tor-latency rationale.
+func WithServerConnLimits(maxStreams uint32, idle, age, handshake time.Duration) Option {
+	return func(n *Node) {
+		if maxStreams > 0 {
+			n.serverMaxStreams = maxStreams
+		}
+		if idle > 0 {
+			n.serverConnIdle = idle
+		}
+		if age > 0 {
+			n.serverConnAge = age
+		}
+		if handshake > 0 {
+			n.serverHandshake = handshake
+		}
+	}
+}
+
+// WithRequireOnionProof refuses data-plane RPCs (chunk and manifest
+// transfer) from peers that have not proven control of their onion
+// identity key via the ProveOnion challenge. Control-plane calls stay
+// open so an honest peer can still deliver its proof.
+func WithRequireOnionProof() Option {
+	return func(n *Node) {
+		n.requireProof = true
+	}
+}
+
+// WithTracing makes the node advertise bbrpc.FeatureTracing and attach
+// trace context to outbound peer calls — but only to peers advertising
+// the feature back, so nobody receives correlation IDs unasked. The
+// daemon enables it together with its OTLP exporter.
+func WithTracing() Option {
+	return func(n *Node) {
+		n.tracing = true
+	}
+}
+
+// WithChunkBackend stores peers' chunks on backend instead of the
+// default on-disk store under the data dir.
+func WithChunkBackend(backend chunkstore.ChunkBackend) Option {
+	return func(n *Node) {
+		n.chunks = chunkstore.New(backend)
+	}
+}
+
+// WithIdentityMode selects how the onion key relates to the password:
+// IdentityModeDerived (the default) or IdentityModeStored. The choice is
+// recorded in the data dir on first run and enforced afterwards; see
+// identity.go.
+func WithIdentityMode(mode string) Option {
+	return func(n *Node) {
+		n.identityMode = mode
+	}
+}
+
+// WithProbeInterval changes how often the background prober checks on
+// peers that have not been contacted recently. The default is hourly.
+func WithProbeInterval(interval time.Duration) Option {
+	return func(n *Node) {
+		if interval > 0 {
+			n.probeInterval = interval
+		}
+	}
+}
+
+// WithAuditLog records security-relevant node events (peers added or
+// removed, agreements accepted, rejected callers) in the daemon's audit
+// log.
+func WithAuditLog(l *auditlog.Logger) Option {
+	return func(n *Node) {
+		n.audit = l
+	}
+}
+
+// WithDialLimit changes how many new peer dials may run concurrently;
+// further dials queue for a slot. The default is four, which keeps a
+// burst of activity from flooding the Tor client with circuit requests.
+func WithDialLimit(limit int) Option {
+	return func(n *Node) {
+		if limit > 0 {
+			n.dialLimit = limit
+		}
+	}
+}
+
+// WithMaxPeers changes the cap on registry size enforced by AddPeer.
+func WithMaxPeers(limit int) Option {
+	return func(n *Node) {
+		if limit > 0 {
+			n.maxPeers = limit
+		}
+	}
+}
+
+// WithPeerStreamLimit changes the node-wide cap on in-flight RPCs per
+// peer. Individual peers can be given a different cap with
+// SetPeerStreamLimit.
+func WithPeerStreamLimit(limit int) Option {
+	return func(n *Node) {
+		if limit > 0 {
+			n.streamLimit = limit
+		}
+	}
+}
+
+// WithPeerCallTimeout changes the default deadline on outbound unary
+// peer RPCs (health checks, messages, announcements, and the like).
+// Streaming transfers are not bounded by it. The default is two
+// minutes, sized for slow but working Tor circuits.
+func WithPeerCallTimeout(d time.Duration) Option {
+	return func(n *Node) {
+		if d > 0 {
+			n.callTimeout = d
+		}
+	}
+}
+
+// WithDrainTimeout changes how long Stop waits for in-flight peer RPCs
+// to finish before cutting them off. The default is DefaultDrainTimeout.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(n *Node) {
+		if d > 0 {
+			n.drainTimeout = d
+		}
+	}
+}
+
+// WithWarmConnections pre-dials up to count of the peers contacted in
+// the last session after the onion is published. Pre-dials run in the
+// background at low priority: they queue behind the dial limiter, do
+// not delay readiness, and fail silently. The default is zero, off.
+func WithWarmConnections(count int) Option {
+	return func(n *Node) {
+		if count > 0 {
+			n.warmConns = count
+		}
+	}
+}
+
+// WithBackupRoots restricts backup sources to the given directories:
+// CreateBackup and PlanBackup reject canonicalized paths outside every
+// root, and followed symlinks escaping the roots are recorded as links
+// instead of being descended into. Empty means unrestricted.
+func WithBackupRoots(roots []string) Option {
+	return func(n *Node) {
+		for _, root := range roots {
+			if abs, err := filepath.Abs(root); err == nil {
+				n.backupRoots = append(n.backupRoots, abs)
+			}
+		}
+	}
+}
+
+// WithRestorePrefetch changes how far restores read ahead: depth is the
+// number of FetchChunk requests kept in flight ahead of the writer, and
+// stagingBytes caps the on-disk staging area buffering fetched chunks
+// until the writer consumes them. The defaults are 8 requests and
+// 64 MiB.
+func WithRestorePrefetch(depth int, stagingBytes int64) Option {
+	return func(n *Node) {
+		if depth > 0 {
+			n.prefetchDepth = depth
+		}
+		if stagingBytes > 0 {
+			n.prefetchStaging = stagingBytes
+		}
+	}
+}
+
+// withClock injects a fake clock into the connection pool; tests use it
+// to drive the idle eviction sweep without real sleeps.
+func withClock(c clock) Option {
+	return func(n *Node) {
+		n.clk = c
+	}
+}
+
+// withCaps overrides the advertised protocol version and feature set;
+// tests use it to impersonate an older build.
+func withCaps(version uint32, features uint64) Option {
+	return func(n *Node) {
+		n.capsOverridden = true
+		n.protoVersion = version
+		n.features = features
+	}
+}
+
+// WithMaxMsgSize raises the maximum gRPC message size on peer
+// connections above the protocol default bbrpc.GRPCMaxMsgSize, e.g. to
+// allow larger chunk streaming frames. The chosen value is advertised to
+// peers in HealthCheck responses so both sides can agree on a frame size.
+func WithMaxMsgSize(size int) Option {
+	return func(n *Node) {
+		n.maxMsgSize = size
+	}
+}
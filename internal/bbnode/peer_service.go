@@ -0,0 +1,565 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/chunkstore"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// peerService implements the bbrpc Peer service.
+type peerService struct {
+	pb.UnimplementedPeerServer
+
+	node *Node
+}
+
+func (s *peerService) HealthCheck(ctx context.Context, req *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	mode, _ := s.node.Mode()
+	version, features := s.node.localCaps()
+	resp := &pb.HealthCheckResponse{
+		Onion:        s.node.Address(),
+		MaxMsgSize:   uint32(s.node.maxMsgSize),
+		Mode:         string(mode),
+		ProtoVersion: version,
+		Features:     features,
+	}
+	if caller, err := callerOnion(ctx); err == nil {
+		resp.FetchNonce = s.node.issueFetchNonce(caller)
+		if s.node.needsOnionProof(caller) {
+			resp.OnionChallenge = s.node.issueOnionChallenge(caller)
+		}
+	}
+	return resp, nil
+}
+
+func (s *peerService) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
+	return &pb.PingResponse{Payload: req.Payload}, nil
+}
+
+func (s *peerService) WhoAmI(ctx context.Context, req *pb.WhoAmIRequest) (*pb.WhoAmIResponse, error) {
+	return &pb.WhoAmIResponse{
+		Onion:         s.node.Address(),
+		InstanceNonce: s.node.instanceNonce,
+	}, nil
+}
+
+func (s *peerService) ProposeAgreement(ctx context.Context, req *pb.ProposeAgreementRequest) (*pb.ProposeAgreementResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if reason, rejected := s.node.modeRejectsWrite(); rejected {
+		return nil, status.Error(codes.FailedPrecondition, reason)
+	}
+	if req.Agreement == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing agreement")
+	}
+	a := agreementFromProto(req.Agreement)
+	if a.Proposer != caller {
+		return nil, status.Errorf(codes.PermissionDenied, "proposer %s does not match caller %s", a.Proposer, caller)
+	}
+	if a.Acceptor != s.node.Address() {
+		return nil, status.Error(codes.InvalidArgument, "agreement is not addressed to this node")
+	}
+	if err := a.verifySigs(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := s.node.sec.PutJSON(agreementKey(a.ID), a); err != nil {
+		return nil, status.Errorf(codes.Internal, "store agreement: %v", err)
+	}
+	return &pb.ProposeAgreementResponse{}, nil
+}
+
+func (s *peerService) AcceptAgreement(ctx context.Context, req *pb.AcceptAgreementRequest) (*pb.AcceptAgreementResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Agreement == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing agreement")
+	}
+	a := agreementFromProto(req.Agreement)
+	if a.Acceptor != caller {
+		return nil, status.Errorf(codes.PermissionDenied, "acceptor %s does not match caller %s", a.Acceptor, caller)
+	}
+	if a.Proposer != s.node.Address() {
+		return nil, status.Error(codes.InvalidArgument, "agreement was not proposed by this node")
+	}
+	if len(a.AcceptorSig) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing acceptor signature")
+	}
+	if err := a.verifySigs(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := s.node.sec.PutJSON(agreementKey(a.ID), a); err != nil {
+		return nil, status.Errorf(codes.Internal, "store agreement: %v", err)
+	}
+	// An acceptor from before the key exchange sends no DH key; the
+	// agreement then works without a fetch secret.
+	if len(a.AcceptorDHPub) > 0 {
+		if err := s.node.storeAgreementSecret(a.ID, a.AcceptorDHPub); err != nil {
+			return nil, status.Errorf(codes.Internal, "store agreement secret: %v", err)
+		}
+	}
+	s.node.auditEvent("agreement_accepted", map[string]string{
+		"id":        a.ID,
+		"peer":      caller,
+		"offered":   fmt.Sprint(a.OfferedBytes),
+		"requested": fmt.Sprint(a.RequestedBytes),
+	})
+	return &pb.AcceptAgreementResponse{}, nil
+}
+
+// maxManifestBlob bounds an uploaded manifest envelope.
+const maxManifestBlob = 256 << 20
+
+// blobNameOK reports whether a caller-supplied blob name is safe to use
+// as a file name in the chunk store.
+func blobNameOK(name string) bool {
+	if name == "" || len(name) > 128 {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r == '-', r >= '0' && r <= '9', r >= 'a' && r <= 'z':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *peerService) HasChunk(ctx context.Context, req *pb.HasChunkRequest) (*pb.HasChunkResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !blobNameOK(req.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "bad blob name %q", req.Name)
+	}
+	return &pb.HasChunkResponse{Present: s.node.chunks.Has(caller, req.Name)}, nil
+}
+
+// HasChunks answers presence for batches of blob names, one bitmap per
+// batch in request order. Each batch is answered before the next is
+// read, so the handler holds a single batch at a time and gRPC flow
+// control throttles a client that streams faster than we answer.
+func (s *peerService) HasChunks(stream pb.Peer_HasChunksServer) error {
+	caller, err := callerOnion(stream.Context())
+	if err != nil {
+		return err
+	}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(req.Names) > bbrpc.HasChunksBatch {
+			return status.Errorf(codes.InvalidArgument, "batch of %d names, max %d", len(req.Names), bbrpc.HasChunksBatch)
+		}
+		bitmap := make([]byte, (len(req.Names)+7)/8)
+		for i, name := range req.Names {
+			if !blobNameOK(name) {
+				return status.Errorf(codes.InvalidArgument, "bad blob name %q", name)
+			}
+			if s.node.chunks.Has(caller, name) {
+				bitmap[i/8] |= 1 << (i % 8)
+			}
+		}
+		if err := stream.Send(&pb.HasChunksResponse{Present: bitmap}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *peerService) StoreChunk(ctx context.Context, req *pb.StoreChunkRequest) (*pb.StoreChunkResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !blobNameOK(req.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "bad blob name %q", req.Name)
+	}
+	if reason, rejected := s.node.modeRejectsWrite(); rejected {
+		return nil, status.Error(codes.FailedPrecondition, reason)
+	}
+	if !s.node.storeAllowed(caller) {
+		return nil, status.Error(codes.PermissionDenied, "storage is read-only until the agreement is renewed")
+	}
+	if s.node.diskDegraded() {
+		return nil, status.Error(codes.ResourceExhausted, "node is low on disk space")
+	}
+	if s.node.chunks.Usage(caller)+int64(len(req.Data)) > s.node.PeerQuota(caller) {
+		return nil, status.Errorf(codes.ResourceExhausted, "storage quota of %d bytes exceeded", s.node.PeerQuota(caller))
+	}
+	if err := s.node.chunks.Put(caller, req.Name, req.Data); err != nil {
+		return nil, status.Errorf(codes.Internal, "store chunk: %v", err)
+	}
+	s.node.reportStoredFor(caller, len(req.Data))
+	return &pb.StoreChunkResponse{}, nil
+}
+
+// chunkFrameSize is how much of a blob goes into one FetchChunk stream
+// frame. The frame plus its proto envelope must stay under the
+// GRPCMaxMsgSize message cap.
+const chunkFrameSize = 8 * 1024
+
+func (s *peerService) FetchChunk(req *pb.FetchChunkRequest, stream pb.Peer_FetchChunkServer) error {
+	caller, err := callerOnion(stream.Context())
+	if err != nil {
+		return err
+	}
+	if !blobNameOK(req.Name) {
+		return status.Errorf(codes.InvalidArgument, "bad blob name %q", req.Name)
+	}
+	if reason, rejected := s.node.modeRejectsFetch(); rejected {
+		return status.Error(codes.FailedPrecondition, reason)
+	}
+	// Once an agreement secret exists with the caller, fetching takes an
+	// ownership proof on top of the TLS identity; peers from before the
+	// key exchange keep identity-only access. Error codes distinguish a
+	// bad proof (Unauthenticated) from a blob owned by someone else
+	// (PermissionDenied) and from a blob that does not exist (NotFound).
+	if secret, ok := s.node.agreementSecret(caller); ok {
+		nonce, issued := s.node.issuedFetchNonce(caller)
+		if !issued {
+			return status.Error(codes.Unauthenticated, "no session nonce issued; run HealthCheck first")
+		}
+		if !hmac.Equal(req.Proof, fetchChunkProof(secret, req.Name, nonce)) {
+			return status.Error(codes.Unauthenticated, "bad ownership proof")
+		}
+	}
+	rc, err := s.node.chunks.Open(caller, req.Name)
+	if errors.Is(err, chunkstore.ErrNotFound) {
+		if owner, ok := s.node.chunks.FindOwner(req.Name); ok && owner != caller {
+			return status.Errorf(codes.PermissionDenied, "chunk %s belongs to another peer", req.Name)
+		}
+		return status.Errorf(codes.NotFound, "no chunk %s", req.Name)
+	} else if err != nil {
+		return status.Errorf(codes.Internal, "fetch chunk: %v", err)
+	}
+	defer rc.Close()
+	// One frame buffer per stream: Send blocks on gRPC flow control when
+	// the reader is slow, so that is also the whole memory footprint. A
+	// cancelled stream fails the Send, which drops out of the loop and
+	// closes the blob.
+	buf := make([]byte, chunkFrameSize)
+	for {
+		m, err := rc.Read(buf)
+		if m > 0 {
+			if err := stream.Send(&pb.FetchChunkResponse{Data: buf[:m]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return status.Errorf(codes.Internal, "read chunk: %v", err)
+		}
+	}
+}
+
+func (s *peerService) DeleteChunks(ctx context.Context, req *pb.DeleteChunksRequest) (*pb.DeleteChunksResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Names) > bbrpc.HasChunksBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "batch of %d names, max %d", len(req.Names), bbrpc.HasChunksBatch)
+	}
+	if reason, rejected := s.node.modeRejectsWrite(); rejected {
+		return nil, status.Error(codes.FailedPrecondition, reason)
+	}
+	// Deletion is scoped to the caller's own blobs: the store keys by
+	// owner, so a name held for another peer simply does not exist here.
+	var deleted int64
+	for _, name := range req.Names {
+		if !blobNameOK(name) {
+			return nil, status.Errorf(codes.InvalidArgument, "bad blob name %q", name)
+		}
+		if !s.node.chunks.Has(caller, name) {
+			continue
+		}
+		if err := s.node.chunks.Delete(caller, name); err != nil {
+			return nil, status.Errorf(codes.Internal, "delete chunk: %v", err)
+		}
+		deleted++
+	}
+	return &pb.DeleteChunksResponse{Deleted: deleted}, nil
+}
+
+func (s *peerService) HasOwnedChunks(ctx context.Context, req *pb.HasOwnedChunksRequest) (*pb.HasOwnedChunksResponse, error) {
+	if _, err := callerOnion(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.Names) > bbrpc.HasChunksBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "batch of %d names, max %d", len(req.Names), bbrpc.HasChunksBatch)
+	}
+	if _, err := s.node.findPeer(req.Owner); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "owner %s is not a peer here", req.Owner)
+	}
+	bitmap := make([]byte, (len(req.Names)+7)/8)
+	for i, name := range req.Names {
+		if !blobNameOK(name) {
+			return nil, status.Errorf(codes.InvalidArgument, "bad blob name %q", name)
+		}
+		if s.node.chunks.Has(req.Owner, name) {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+	return &pb.HasOwnedChunksResponse{Present: bitmap}, nil
+}
+
+func (s *peerService) MigrateChunks(stream pb.Peer_MigrateChunksServer) error {
+	caller, err := callerOnion(stream.Context())
+	if err != nil {
+		return err
+	}
+	if reason, rejected := s.node.modeRejectsWrite(); rejected {
+		return status.Error(codes.FailedPrecondition, reason)
+	}
+	if s.node.diskDegraded() {
+		return status.Error(codes.ResourceExhausted, "node is low on disk space")
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "receive migration header: %v", err)
+	}
+	// The blobs land under the owner, not the sending host: the owner
+	// must already be a peer here so a quota exists to charge them to.
+	owner := first.Owner
+	if _, err := s.node.findPeer(owner); err != nil {
+		return status.Errorf(codes.FailedPrecondition, "owner %s is not a peer here", owner)
+	}
+	if !s.node.storeAllowed(owner) {
+		return status.Error(codes.PermissionDenied, "storage for the owner is read-only until their agreement is renewed")
+	}
+	var stored, skipped int64
+	var name string
+	var data []byte
+	frame := first
+	for {
+		if frame.Name != name && len(data) > 0 {
+			return status.Errorf(codes.InvalidArgument, "blob %q interrupted mid-transfer", name)
+		}
+		name = frame.Name
+		if !blobNameOK(name) {
+			return status.Errorf(codes.InvalidArgument, "bad blob name %q", name)
+		}
+		data = append(data, frame.Data...)
+		if len(data) > maxManifestBlob {
+			return status.Errorf(codes.ResourceExhausted, "blob %q exceeds %d bytes", name, maxManifestBlob)
+		}
+		if frame.Last {
+			if s.node.chunks.Has(owner, name) {
+				skipped++
+			} else {
+				if s.node.chunks.Usage(owner)+int64(len(data)) > s.node.PeerQuota(owner) {
+					return status.Errorf(codes.ResourceExhausted, "owner's storage quota of %d bytes exceeded", s.node.PeerQuota(owner))
+				}
+				if err := s.node.chunks.Put(owner, name, data); err != nil {
+					return status.Errorf(codes.Internal, "store migrated chunk: %v", err)
+				}
+				s.node.reportStoredFor(owner, len(data))
+				stored++
+			}
+			name, data = "", nil
+		}
+		frame, err = stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return status.Errorf(codes.InvalidArgument, "receive migration frame: %v", err)
+		}
+	}
+	if len(data) > 0 {
+		return status.Errorf(codes.InvalidArgument, "blob %q truncated", name)
+	}
+	s.node.auditEvent("chunks_migrated_in", map[string]string{
+		"from":   caller,
+		"owner":  owner,
+		"stored": fmt.Sprint(stored),
+	})
+	return stream.SendAndClose(&pb.MigrateChunksResponse{Stored: stored, Skipped: skipped})
+}
+
+func (s *peerService) StoreManifest(stream pb.Peer_StoreManifestServer) error {
+	caller, err := callerOnion(stream.Context())
+	if err != nil {
+		return err
+	}
+	if reason, rejected := s.node.modeRejectsWrite(); rejected {
+		return status.Error(codes.FailedPrecondition, reason)
+	}
+	if !s.node.storeAllowed(caller) {
+		return status.Error(codes.PermissionDenied, "storage is read-only until the agreement is renewed")
+	}
+	if s.node.diskDegraded() {
+		return status.Error(codes.ResourceExhausted, "node is low on disk space")
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "receive manifest header: %v", err)
+	}
+	if !blobNameOK(first.BackupId) {
+		return status.Errorf(codes.InvalidArgument, "bad backup id %q", first.BackupId)
+	}
+	data := first.Data
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return status.Errorf(codes.InvalidArgument, "receive manifest frame: %v", err)
+		}
+		data = append(data, frame.Data...)
+		if len(data) > maxManifestBlob {
+			return status.Errorf(codes.ResourceExhausted, "manifest exceeds %d bytes", maxManifestBlob)
+		}
+	}
+	if s.node.chunks.Usage(caller)+int64(len(data)) > s.node.PeerQuota(caller) {
+		return status.Errorf(codes.ResourceExhausted, "storage quota of %d bytes exceeded", s.node.PeerQuota(caller))
+	}
+	if err := s.node.chunks.Put(caller, manifestBlobPrefix+first.BackupId, data); err != nil {
+		return status.Errorf(codes.Internal, "store manifest: %v", err)
+	}
+	s.node.reportStoredFor(caller, len(data))
+	return stream.SendAndClose(&pb.StoreManifestResponse{})
+}
+
+func (s *peerService) ListStoredManifests(ctx context.Context, req *pb.ListStoredManifestsRequest) (*pb.ListStoredManifestsResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.node.chunks.List(caller, manifestBlobPrefix)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list manifests: %v", err)
+	}
+	resp := &pb.ListStoredManifestsResponse{}
+	for _, name := range names {
+		resp.BackupIds = append(resp.BackupIds, strings.TrimPrefix(name, manifestBlobPrefix))
+	}
+	return resp, nil
+}
+
+func (s *peerService) FetchManifest(req *pb.FetchManifestRequest, stream pb.Peer_FetchManifestServer) error {
+	caller, err := callerOnion(stream.Context())
+	if err != nil {
+		return err
+	}
+	if !blobNameOK(req.BackupId) {
+		return status.Errorf(codes.InvalidArgument, "bad backup id %q", req.BackupId)
+	}
+	if reason, rejected := s.node.modeRejectsFetch(); rejected {
+		return status.Error(codes.FailedPrecondition, reason)
+	}
+	data, err := s.node.chunks.Get(caller, manifestBlobPrefix+req.BackupId)
+	if errors.Is(err, chunkstore.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "no manifest for backup %s", req.BackupId)
+	} else if err != nil {
+		return status.Errorf(codes.Internal, "fetch manifest: %v", err)
+	}
+	for len(data) > 0 {
+		m := len(data)
+		if m > manifestFrameSize {
+			m = manifestFrameSize
+		}
+		if err := stream.Send(&pb.FetchManifestResponse{Data: data[:m]}); err != nil {
+			return err
+		}
+		data = data[m:]
+	}
+	return nil
+}
+
+func (s *peerService) SendMessage(ctx context.Context, req *pb.SendMessageRequest) (*pb.SendMessageResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Body) > bbrpc.MaxMessageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "message too long: %d bytes, max %d", len(req.Body), bbrpc.MaxMessageSize)
+	}
+	id, err := s.node.receiveMessage(caller, req.Body, time.Unix(req.SentAtUnix, 0))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "store message: %v", err)
+	}
+	return &pb.SendMessageResponse{Id: id}, nil
+}
+
+func (s *peerService) AnnounceAddressChange(ctx context.Context, req *pb.AddressChangeRequest) (*pb.AddressChangeResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The signature by the old identity key authenticates the notice
+	// itself; the TLS check only stops third parties from relaying it.
+	// The new identity may re-send the notice after the old key is gone,
+	// which is why the method is open: the new address is not in the
+	// registry until the notice is applied.
+	if req.OldOnion != caller && req.NewOnion != caller {
+		return nil, status.Errorf(codes.PermissionDenied, "notice for %s -> %s sent by %s", req.OldOnion, req.NewOnion, caller)
+	}
+	if _, err := keys.PubKeyFromOnion(req.NewOnion); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad new onion address: %v", err)
+	}
+	oldPub, err := keys.PubKeyFromOnion(req.OldOnion)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad old onion address: %v", err)
+	}
+	if req.Seq == 0 {
+		return nil, status.Error(codes.InvalidArgument, "address-change notice without a sequence number")
+	}
+	if !ed25519.Verify(oldPub, addressChangeBytes(req.OldOnion, req.NewOnion, req.Seq), req.Signature) {
+		return nil, status.Error(codes.InvalidArgument, "bad address-change signature")
+	}
+	if err := s.node.adoptPeerAddress(req.OldOnion, req.NewOnion, req.Seq); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "adopt new address: %v", err)
+	}
+	return &pb.AddressChangeResponse{}, nil
+}
+
+// Join redeems an invite code and registers the caller as a peer. The
+// invite, not the registry, authorizes the call; see openMethods.
+func (s *peerService) Join(ctx context.Context, req *pb.JoinRequest) (*pb.JoinResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.node.redeemInvite(req.InviteCode, caller); err != nil {
+		return nil, err
+	}
+	if err := s.node.registerJoinedPeer(caller); err != nil {
+		return nil, status.Errorf(codes.Internal, "register joined peer: %v", err)
+	}
+	return &pb.JoinResponse{OnionChallenge: s.node.issueOnionChallenge(caller)}, nil
+}
+
+// ProveOnion verifies the caller's signature over the challenge issued
+// in a Join or HealthCheck response and marks its peer entry proven.
+func (s *peerService) ProveOnion(ctx context.Context, req *pb.ProveOnionRequest) (*pb.ProveOnionResponse, error) {
+	caller, err := callerOnion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.node.proveOnion(caller, req.Signature); err != nil {
+		return nil, err
+	}
+	return &pb.ProveOnionResponse{}, nil
+}
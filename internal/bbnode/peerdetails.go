@@ -0,0 +1,87 @@
+package bbnode
+
+import (
+	"time"
+)
+
+// peerDetailsWindowDays is how far back PeerDetails aggregates the
+// report counters.
+const peerDetailsWindowDays = 30
+
+// PeerDetails is the drill-down view of one peer, aggregated from the
+// registry, the chunk store, and the report buckets.
+type PeerDetails struct {
+	// Peer is a copy of the registry entry.
+	Peer Peer
+	// Agreement is the newest agreement with the peer, preferring
+	// active over expired over pending; nil when none exists.
+	Agreement *Agreement
+	// StoredForPeer is the bytes the peer currently stores on this
+	// node.
+	StoredForPeer int64
+	// StoredAtPeer is the bytes the peer holds for this node, estimated
+	// from backup replication records; see PeerBalances.
+	StoredAtPeer int64
+	// UploadedBytes is the bytes this node uploaded to the peer over
+	// the window.
+	UploadedBytes int64
+	// AuditsPassed and AuditsFailed count chunk envelopes served by
+	// this peer that passed or failed authentication over the window.
+	AuditsPassed int
+	AuditsFailed int
+	// UnreadMessages is the number of unread messages from the peer.
+	UnreadMessages int
+	// ActiveStreams is the peer's current number of in-flight RPCs.
+	ActiveStreams int
+	// RPC is the payload volume exchanged with the peer since unlock,
+	// before and after gRPC-level compression.
+	RPC RPCStats
+}
+
+// PeerDetails aggregates everything the node records about the peer at
+// aliasOrOnion. Unknown peers report an error wrapping ErrUnknownPeer.
+func (n *Node) PeerDetails(aliasOrOnion string) (*PeerDetails, error) {
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return nil, err
+	}
+	d := &PeerDetails{Peer: *p}
+	onion := d.Peer.Onion
+
+	for _, state := range []string{"active", "expired", "pending"} {
+		if a := n.agreementWith(onion, state); a != nil {
+			d.Agreement = a
+			break
+		}
+	}
+	d.StoredForPeer = n.chunks.Usage(onion)
+	if storedAt, err := n.storedAtPeers(); err == nil {
+		d.StoredAtPeer = storedAt[onion]
+	}
+
+	now := time.Now()
+	days, err := n.Report(now.AddDate(0, 0, -peerDetailsWindowDays), now)
+	if err != nil {
+		return nil, err
+	}
+	for _, day := range days {
+		d.UploadedBytes += day.StoredAtPeers[onion]
+		if pa := day.AuditsByPeer[onion]; pa != nil {
+			d.AuditsPassed += pa.Passed
+			d.AuditsFailed += pa.Failed
+		}
+	}
+
+	msgs, err := n.loadMessages(onion)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		if m.Incoming && !m.Read {
+			d.UnreadMessages++
+		}
+	}
+	d.ActiveStreams = n.ActiveStreams()[onion]
+	d.RPC = n.PeerRPCStats(onion)
+	return d, nil
+}
@@ -0,0 +1,61 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+)
+
+func TestPeerDetails(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	proposed, err := a.ProposeAgreement(ctx, b.Address(), 50<<30, 40<<30, 90)
+	if err != nil {
+		t.Fatalf("ProposeAgreement: %v", err)
+	}
+	if _, err := b.AcceptAgreement(ctx, proposed.ID); err != nil {
+		t.Fatalf("AcceptAgreement: %v", err)
+	}
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	if _, err := pb.NewPeerClient(cc).StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("data")}); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	if err := b.SendMessage(ctx, "alice", "ping"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if _, err := a.HealthCheck(ctx, b.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+
+	d, err := a.PeerDetails("bob")
+	if err != nil {
+		t.Fatalf("PeerDetails: %v", err)
+	}
+	if d.Peer.Onion != b.Address() || d.Peer.Alias != "bob" {
+		t.Errorf("registry entry = %+v", d.Peer)
+	}
+	if d.Agreement == nil || d.Agreement.ID != proposed.ID || d.Agreement.State() != "active" {
+		t.Errorf("agreement = %+v", d.Agreement)
+	}
+	if d.StoredForPeer != int64(len("data")) {
+		t.Errorf("StoredForPeer = %d, want %d", d.StoredForPeer, len("data"))
+	}
+	if d.UnreadMessages != 1 {
+		t.Errorf("UnreadMessages = %d, want 1", d.UnreadMessages)
+	}
+	if d.Peer.AvgPingMs <= 0 {
+		t.Errorf("AvgPingMs = %d, want positive", d.Peer.AvgPingMs)
+	}
+
+	if _, err := a.PeerDetails("nobody"); !errors.Is(err, ErrUnknownPeer) {
+		t.Errorf("PeerDetails(nobody): %v, want ErrUnknownPeer", err)
+	}
+}
@@ -0,0 +1,196 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// peersKey is the secstore key holding the peer registry.
+const peersKey = "peers/registry"
+
+// defaultMaxPeers caps the registry size so a buggy or hostile flow
+// cannot register peers until registry scans and probe loops choke.
+const defaultMaxPeers = 256
+
+// ErrUnknownPeer is wrapped by lookups of an alias or onion address
+// that is not in the registry.
+var ErrUnknownPeer = errors.New("unknown peer")
+
+// Peer is a registry entry for an authorized peer.
+type Peer struct {
+	// Onion is the peer's onion address (its identity).
+	Onion string `json:"onion"`
+	// Alias is the local human-readable name for the peer.
+	Alias string `json:"alias,omitempty"`
+	// AddedAt is when the peer was added to the registry.
+	AddedAt time.Time `json:"added_at"`
+	// LastSeen is the last successful contact with the peer, inbound or
+	// outbound. Zero if the peer has never been reached.
+	LastSeen time.Time `json:"last_seen,omitempty"`
+	// ProbeFailures counts consecutive failed reachability probes. It
+	// resets to zero on any successful contact.
+	ProbeFailures int `json:"probe_failures,omitempty"`
+	// OnionProven records that the peer answered an onion ownership
+	// challenge, proving its TLS key really is its onion identity key;
+	// see onionproof.go.
+	OnionProven bool `json:"onion_proven,omitempty"`
+	// Invite is the invite code the peer was added with, kept until it
+	// is redeemed.
+	Invite string `json:"invite,omitempty"`
+	// StreamLimit overrides the node-wide cap on this peer's in-flight
+	// RPCs. Zero means the default.
+	StreamLimit int `json:"stream_limit,omitempty"`
+	// ProtoVersion is the bbrpc protocol version the peer advertised in
+	// its last HealthCheck response; zero for pre-versioning builds.
+	ProtoVersion int `json:"proto_version,omitempty"`
+	// Features is the feature-flag bitset the peer advertised; see the
+	// Feature constants in the bbrpc package.
+	Features uint64 `json:"features,omitempty"`
+	// AddrChangeSeq is the sequence number of the last address-change
+	// notice applied to this entry; older notices are replays.
+	AddrChangeSeq uint64 `json:"addr_change_seq,omitempty"`
+	// PrevOnion is the address the peer vacated in its last address
+	// change; it keeps resolving as an alias until PrevOnionUntil.
+	PrevOnion      string    `json:"prev_onion,omitempty"`
+	PrevOnionUntil time.Time `json:"prev_onion_until,omitempty"`
+	// AvgPingMs is a smoothed round-trip time of successful health
+	// checks to the peer, in milliseconds. Zero until the first one.
+	AvgPingMs int64 `json:"avg_ping_ms,omitempty"`
+}
+
+// AddPeer authorizes a peer given as a bare onion address or a bb://
+// peer URI, optionally under alias. An explicit alias wins over the
+// URI's name parameter. A URI with an invite code triggers a join
+// attempt in the background.
+func (n *Node) AddPeer(addr, alias string) error {
+	u, err := parsePeerURI(addr, time.Now())
+	if err != nil {
+		return err
+	}
+	if alias == "" {
+		alias = u.Alias
+	}
+	n.mu.Lock()
+	if _, ok := n.peers[u.Onion]; ok {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s already registered", u.Onion)
+	}
+	if n.wiping[u.Onion] {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s is being wiped; wait for the wipe job to finish", u.Onion)
+	}
+	if _, ok := n.blocked[u.Onion]; ok {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s is blocked; unblock it first", u.Onion)
+	}
+	if len(n.peers) >= n.maxPeers {
+		n.mu.Unlock()
+		return fmt.Errorf("peer registry is full (%d peers, max %d); remove peers before adding more", len(n.peers), n.maxPeers)
+	}
+	n.peers[u.Onion] = &Peer{Onion: u.Onion, Alias: alias, AddedAt: time.Now(), Invite: u.Invite}
+	err = n.savePeersLocked()
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	n.auditEvent("peer_added", map[string]string{"onion": u.Onion, "alias": alias})
+	if u.Invite != "" {
+		// Redeem the invite against the issuer in the background; the
+		// issuer registers us as a peer when it succeeds.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			if err := n.joinWithInvite(ctx, u.Onion, u.Invite); err != nil {
+				log.Printf("join %s with invite: %v", u.Onion, err)
+			}
+		}()
+	}
+	if n.OnionAuthEnabled() {
+		return n.refreshOnionAuth(context.Background())
+	}
+	return nil
+}
+
+// RemovePeer deletes the peer at onion from the registry.
+func (n *Node) RemovePeer(onion string) error {
+	n.mu.Lock()
+	if _, ok := n.peers[onion]; !ok {
+		n.mu.Unlock()
+		return fmt.Errorf("peer %s not registered", onion)
+	}
+	delete(n.peers, onion)
+	delete(n.breakers, onion)
+	err := n.savePeersLocked()
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	n.auditEvent("peer_removed", map[string]string{"onion": onion})
+	if n.OnionAuthEnabled() {
+		return n.refreshOnionAuth(context.Background())
+	}
+	return nil
+}
+
+// ListPeers returns the registry entries sorted by onion address.
+func (n *Node) ListPeers() []Peer {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := make([]Peer, 0, len(n.peers))
+	for _, p := range n.peers {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Onion < out[j].Onion })
+	return out
+}
+
+// findPeer resolves an alias or onion address to a registry entry. An
+// address a peer vacated still resolves during the grace period after
+// its address change.
+func (n *Node) findPeer(aliasOrOnion string) (*Peer, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if p, ok := n.peers[aliasOrOnion]; ok {
+		return p, nil
+	}
+	for _, p := range n.peers {
+		if p.Alias != "" && p.Alias == aliasOrOnion {
+			return p, nil
+		}
+	}
+	for _, p := range n.peers {
+		if p.PrevOnion == aliasOrOnion && time.Now().Before(p.PrevOnionUntil) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownPeer, aliasOrOnion)
+}
+
+func (n *Node) loadPeers() error {
+	var list []*Peer
+	err := n.sec.GetJSON(peersKey, &list)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, p := range list {
+		n.peers[p.Onion] = p
+	}
+	return nil
+}
+
+func (n *Node) savePeersLocked() error {
+	list := make([]*Peer, 0, len(n.peers))
+	for _, p := range n.peers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Onion < list[j].Onion })
+	return n.sec.PutJSON(peersKey, list)
+}
@@ -0,0 +1,86 @@
+package bbnode
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+// testOnionAddr generates a valid onion address not backed by any node.
+func testOnionAddr(tb testing.TB) string {
+	tb.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		tb.Fatalf("GenerateKey: %v", err)
+	}
+	return keys.OnionAddress(pub)
+}
+
+func TestMaxPeers(t *testing.T) {
+	n, err := New("password", netmock.New(), t.TempDir(), WithMaxPeers(3))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := n.AddPeer(testOnionAddr(t), fmt.Sprintf("peer%d", i)); err != nil {
+			t.Fatalf("AddPeer %d: %v", i, err)
+		}
+	}
+	err = n.AddPeer(testOnionAddr(t), "one-too-many")
+	if err == nil {
+		t.Fatal("AddPeer over the cap succeeded")
+	}
+	if got := len(n.ListPeers()); got != 3 {
+		t.Errorf("registry has %d peers, want 3", got)
+	}
+}
+
+// benchRegistryNode returns a node with a registry filled to the
+// default cap.
+func benchRegistryNode(b *testing.B) *Node {
+	b.Helper()
+	n, err := New("password", netmock.New(), b.TempDir())
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	for i := 0; i < defaultMaxPeers; i++ {
+		if err := n.AddPeer(testOnionAddr(b), fmt.Sprintf("peer%d", i)); err != nil {
+			b.Fatalf("AddPeer %d: %v", i, err)
+		}
+	}
+	return n
+}
+
+func BenchmarkListPeersAtCap(b *testing.B) {
+	n := benchRegistryNode(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got := len(n.ListPeers()); got != defaultMaxPeers {
+			b.Fatalf("ListPeers returned %d peers", got)
+		}
+	}
+}
+
+func BenchmarkFindPeerAtCap(b *testing.B) {
+	n := benchRegistryNode(b)
+	alias := fmt.Sprintf("peer%d", defaultMaxPeers-1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := n.findPeer(alias); err != nil {
+			b.Fatalf("findPeer: %v", err)
+		}
+	}
+}
+
+func BenchmarkMarkPeerSeenAtCap(b *testing.B) {
+	n := benchRegistryNode(b)
+	onion := n.ListPeers()[0].Onion
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.markPeerSeen(onion)
+	}
+}
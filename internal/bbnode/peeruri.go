@@ -0,0 +1,81 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// Peer URIs are the string form of peer invitations:
+//
+//	bb://<onion>/<invite-code>?name=<alias>
+//
+// The invite code and name are optional; a bare onion address is
+// accepted wherever a peer URI is.
+
+var (
+	errBadScheme     = errors.New("peer URI scheme is not bb://")
+	errBadOnion      = errors.New("bad onion address")
+	errBadInvite     = errors.New("malformed invite code")
+	errExpiredInvite = errors.New("invite code has expired")
+)
+
+// peerURI is a parsed bb:// peer URI.
+type peerURI struct {
+	Onion  string
+	Alias  string
+	Invite string
+}
+
+// parsePeerURI parses a bb:// URI or a bare onion address, verifying
+// the v3 onion address checksum and the invite expiry against now.
+func parsePeerURI(s string, now time.Time) (*peerURI, error) {
+	u := &peerURI{Onion: s}
+	if strings.Contains(s, "://") {
+		parsed, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse peer URI: %w", err)
+		}
+		if parsed.Scheme != "bb" {
+			return nil, fmt.Errorf("%w: %q", errBadScheme, parsed.Scheme)
+		}
+		u.Onion = parsed.Host
+		if code := strings.TrimPrefix(parsed.Path, "/"); code != "" {
+			if err := checkInvite(code, now); err != nil {
+				return nil, err
+			}
+			u.Invite = code
+		}
+		u.Alias = parsed.Query().Get("name")
+	}
+	if !strings.HasSuffix(u.Onion, ".onion") {
+		return nil, fmt.Errorf("%w: %q", errBadOnion, u.Onion)
+	}
+	if _, err := keys.PubKeyFromOnion(u.Onion); err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadOnion, err)
+	}
+	return u, nil
+}
+
+// checkInvite validates the invite code shape and expiry. Codes are
+// "<secret>.<unix-expiry>"; redemption happens against the issuing
+// peer, only the expiry is checked locally.
+func checkInvite(code string, now time.Time) error {
+	secret, expStr, ok := strings.Cut(code, ".")
+	if !ok || secret == "" {
+		return fmt.Errorf("%w: %q", errBadInvite, code)
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %q", errBadInvite, code)
+	}
+	if now.After(time.Unix(exp, 0)) {
+		return errExpiredInvite
+	}
+	return nil
+}
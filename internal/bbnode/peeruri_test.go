@@ -0,0 +1,70 @@
+package bbnode
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+func TestParsePeerURI(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onion := keys.OnionAddress(pub)
+	// Flip one character of the payload so the checksum no longer
+	// matches the key.
+	corrupt := onion
+	if corrupt[0] != 'a' {
+		corrupt = "a" + corrupt[1:]
+	} else {
+		corrupt = "b" + corrupt[1:]
+	}
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name  string
+		in    string
+		want  peerURI
+		errIs error
+	}{
+		{name: "bare onion", in: onion, want: peerURI{Onion: onion}},
+		{name: "plain uri", in: "bb://" + onion, want: peerURI{Onion: onion}},
+		{
+			name: "uri with name",
+			in:   "bb://" + onion + "?name=alice",
+			want: peerURI{Onion: onion, Alias: "alice"},
+		},
+		{
+			name: "uri with invite",
+			in:   "bb://" + onion + "/s3cret.1800000000?name=alice",
+			want: peerURI{Onion: onion, Alias: "alice", Invite: "s3cret.1800000000"},
+		},
+		{name: "bad scheme", in: "http://" + onion, errIs: errBadScheme},
+		{name: "bad checksum", in: "bb://" + corrupt, errIs: errBadOnion},
+		{name: "not an onion", in: "example.com", errIs: errBadOnion},
+		{name: "expired invite", in: "bb://" + onion + "/s3cret.1600000000", errIs: errExpiredInvite},
+		{name: "malformed invite", in: "bb://" + onion + "/s3cret", errIs: errBadInvite},
+		{name: "invite bad expiry", in: "bb://" + onion + "/s3cret.soon", errIs: errBadInvite},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parsePeerURI(tc.in, now)
+			if tc.errIs != nil {
+				if !errors.Is(err, tc.errIs) {
+					t.Fatalf("parsePeerURI(%q) error = %v, want %v", tc.in, err, tc.errIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePeerURI(%q): %v", tc.in, err)
+			}
+			if *got != tc.want {
+				t.Errorf("parsePeerURI(%q) = %+v, want %+v", tc.in, *got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package bbnode
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	idleTimeout   = 5 * time.Minute
+	evictInterval = time.Minute
+)
+
+// Sentinel errors from the connection pool, for callers that branch on
+// dial failures with errors.Is instead of matching message strings.
+var (
+	// ErrNodeStopped is returned for connection attempts after Stop.
+	ErrNodeStopped = errors.New("bbnode: node is stopped")
+	// ErrDialTimeout reports that the dial context expired, whether
+	// waiting for a dial slot or while connecting.
+	ErrDialTimeout = errors.New("bbnode: dial timed out")
+)
+
+// dialCtxErr converts a context error from a dial attempt on addr into
+// the pool's typed errors.
+func dialCtxErr(ctx context.Context, addr string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s", ErrDialTimeout, addr)
+	}
+	return ctx.Err()
+}
+
+// defaultDialLimit bounds concurrent new dials. Tor circuit creation is
+// expensive and the Tor client handles a thundering herd of dials
+// poorly, so the prober, a backup run, and user commands starting at
+// once must queue rather than all hit the network together.
+const defaultDialLimit = 4
+
+// poolConn is a pooled client connection to one peer.
+type poolConn struct {
+	cc       *grpc.ClientConn
+	lastUsed time.Time
+}
+
+// dialCall is one in-flight dial, shared by every goroutine that needs
+// the same peer while it runs.
+type dialCall struct {
+	done chan struct{}
+	cc   *grpc.ClientConn
+	err  error
+}
+
+// poolCounters holds pool statistics updated atomically.
+type poolCounters struct {
+	fullHandshakes    atomic.Uint64
+	resumedHandshakes atomic.Uint64
+	queuedDials       atomic.Uint64
+	singleflightHits  atomic.Uint64
+}
+
+// PoolStats is a snapshot of connection pool statistics.
+type PoolStats struct {
+	// Conns is the number of currently pooled connections.
+	Conns int
+	// FullHandshakes counts dials that performed a full TLS handshake.
+	FullHandshakes uint64
+	// ResumedHandshakes counts dials that resumed a TLS session.
+	ResumedHandshakes uint64
+	// QueuedDials counts dials that had to wait for a dial slot.
+	QueuedDials uint64
+	// SingleflightHits counts callers that joined another goroutine's
+	// in-flight dial instead of dialing themselves.
+	SingleflightHits uint64
+}
+
+// PoolStats returns a snapshot of the pool statistics.
+func (n *Node) PoolStats() PoolStats {
+	n.mu.Lock()
+	conns := len(n.conns)
+	n.mu.Unlock()
+	return PoolStats{
+		Conns:             conns,
+		FullHandshakes:    n.stats.fullHandshakes.Load(),
+		ResumedHandshakes: n.stats.resumedHandshakes.Load(),
+		QueuedDials:       n.stats.queuedDials.Load(),
+		SingleflightHits:  n.stats.singleflightHits.Load(),
+	}
+}
+
+// getConn returns a pooled connection to addr, dialing if necessary.
+// Concurrent callers needing the same peer share one dial, and new
+// dials queue behind the dial limit.
+func (n *Node) getConn(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	n.mu.Lock()
+	if n.wiped {
+		n.mu.Unlock()
+		return nil, ErrNodeStopped
+	}
+	n.contacted[addr] = true
+	if pc, ok := n.conns[addr]; ok {
+		pc.lastUsed = n.clk.Now()
+		n.mu.Unlock()
+		return pc.cc, nil
+	}
+	if call, ok := n.dialing[addr]; ok {
+		n.mu.Unlock()
+		n.stats.singleflightHits.Add(1)
+		select {
+		case <-call.done:
+			return call.cc, call.err
+		case <-ctx.Done():
+			return nil, dialCtxErr(ctx, addr)
+		}
+	}
+	call := &dialCall{done: make(chan struct{})}
+	n.dialing[addr] = call
+	n.mu.Unlock()
+
+	call.cc, call.err = n.dialLimited(ctx, addr)
+
+	n.mu.Lock()
+	delete(n.dialing, addr)
+	if call.err == nil {
+		n.conns[addr] = &poolConn{cc: call.cc, lastUsed: n.clk.Now()}
+	}
+	n.mu.Unlock()
+	close(call.done)
+	return call.cc, call.err
+}
+
+// dialLimited waits for a dial slot, honoring ctx, then dials addr.
+func (n *Node) dialLimited(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	select {
+	case n.dialSem <- struct{}{}:
+	default:
+		n.stats.queuedDials.Add(1)
+		select {
+		case n.dialSem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, dialCtxErr(ctx, addr)
+		}
+	}
+	defer func() { <-n.dialSem }()
+	return n.dial(ctx, addr)
+}
+
+// permanentDialError marks a dialer failure that gRPC must surface
+// immediately instead of retrying until the deadline. gRPC treats any
+// error without a Temporary method as temporary; the network backends'
+// typed errors (an unknown address, a bad onion) and TLS failures do
+// not heal on retry, and the pool's callers re-dial at a higher level
+// anyway.
+type permanentDialError struct{ err error }
+
+func (e *permanentDialError) Error() string   { return e.err.Error() }
+func (e *permanentDialError) Unwrap() error   { return e.err }
+func (e *permanentDialError) Temporary() bool { return false }
+
+// dial opens a TLS connection to addr over the network and wraps it in a
+// gRPC client connection. TLS runs below gRPC so the pool can observe
+// handshake results and share the session cache.
+func (n *Node) dial(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	tlsCfg := n.clientTLSConfig(addr)
+	dialer := func(ctx context.Context, target string) (net.Conn, error) {
+		raw, err := n.network.Dial(ctx, target)
+		if err != nil {
+			return nil, &permanentDialError{err: err}
+		}
+		conn := tls.Client(raw, tlsCfg)
+		if err := conn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, &permanentDialError{err: fmt.Errorf("tls handshake with %s: %w", target, err)}
+		}
+		if conn.ConnectionState().DidResume {
+			n.stats.resumedHandshakes.Add(1)
+		} else {
+			n.stats.fullHandshakes.Add(1)
+		}
+		return conn, nil
+	}
+	// Block until connected: the dial slot must be held while the
+	// network dial actually runs, not released before gRPC lazily
+	// connects. Non-temporary dialer errors — an unknown address, a
+	// failed TLS handshake — surface immediately instead of being
+	// retried until the deadline, so callers can tell an unreachable
+	// peer from a stuck circuit.
+	cc, err := grpc.DialContext(ctx, addr,
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithReturnConnectionError(),
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(n.maxMsgSize),
+			grpc.MaxCallSendMsgSize(n.maxMsgSize),
+		),
+		grpc.WithChainUnaryInterceptor(n.compressUnaryInterceptor(addr)),
+		grpc.WithChainStreamInterceptor(n.compressStreamInterceptor(addr)),
+		grpc.WithStatsHandler(&rpcStatsHandler{counters: n.rpcCountersFor(addr)}),
+	)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %s", ErrDialTimeout, addr)
+		}
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	return cc, nil
+}
+
+// startEvictor closes pooled connections idle past idleTimeout until the
+// stop channel closes.
+func (n *Node) startEvictor(stop chan struct{}) {
+	t := n.clk.NewTicker(evictInterval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C():
+			n.evictIdle(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (n *Node) evictIdle(now time.Time) {
+	var victims []*poolConn
+	n.mu.Lock()
+	for addr, pc := range n.conns {
+		if now.Sub(pc.lastUsed) >= idleTimeout {
+			delete(n.conns, addr)
+			victims = append(victims, pc)
+		}
+	}
+	n.mu.Unlock()
+	for _, pc := range victims {
+		pc.cc.Close()
+	}
+}
@@ -0,0 +1,182 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestHealthCheck(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	onion, err := b.HealthCheck(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if onion != a.Address() {
+		t.Errorf("HealthCheck: got %q, want %q", onion, a.Address())
+	}
+}
+
+func TestSessionResumption(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("first HealthCheck: %v", err)
+	}
+	if got := b.PoolStats().FullHandshakes; got != 1 {
+		t.Fatalf("after first dial: FullHandshakes = %d, want 1", got)
+	}
+
+	// Evict the pooled connection; the next call must redial and resume
+	// the TLS session instead of paying a full handshake.
+	b.evictIdle(time.Now().Add(idleTimeout))
+	if got := b.PoolStats().Conns; got != 0 {
+		t.Fatalf("after evict: Conns = %d, want 0", got)
+	}
+	if _, err := b.HealthCheck(ctx, a.Address()); err != nil {
+		t.Fatalf("second HealthCheck: %v", err)
+	}
+	stats := b.PoolStats()
+	if stats.ResumedHandshakes != 1 {
+		t.Errorf("ResumedHandshakes = %d, want 1", stats.ResumedHandshakes)
+	}
+	if stats.FullHandshakes != 1 {
+		t.Errorf("FullHandshakes = %d, want 1", stats.FullHandshakes)
+	}
+}
+
+func TestGetConnAfterStop(t *testing.T) {
+	network := netmock.New()
+	n, err := New("password-a", network, t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	n.Stop()
+	if _, err := n.getConn(context.Background(), "whatever.onion"); !errors.Is(err, ErrNodeStopped) {
+		t.Errorf("getConn after Stop: %v, want ErrNodeStopped", err)
+	}
+}
+
+func TestGetConnTimeout(t *testing.T) {
+	network := netmock.New()
+	b := startTestNode(t, &hangNetwork{Network: network}, "password-b")
+	// The dial hangs like a circuit going nowhere, so the blocking dial
+	// can only end with the deadline. An address nobody listens on
+	// would instead fail fast with the network's typed error.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := b.getConn(ctx, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.onion")
+	if !errors.Is(err, ErrDialTimeout) {
+		t.Errorf("getConn to stalled peer: %v, want ErrDialTimeout", err)
+	}
+}
+
+// hangNetwork registers normally but never completes a dial.
+type hangNetwork struct {
+	Network
+}
+
+func (h *hangNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// slowNetwork delays Dial and records how many dials run concurrently.
+type slowNetwork struct {
+	Network
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	return s.Network.Dial(ctx, addr)
+}
+
+func TestDialLimitAndSingleflight(t *testing.T) {
+	network := netmock.New()
+	var peers []string
+	for i := 0; i < 5; i++ {
+		p := startTestNode(t, network, fmt.Sprintf("password-%d", i))
+		peers = append(peers, p.Address())
+	}
+	slow := &slowNetwork{Network: network}
+	client, err := New("password-client", slow, t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { client.Stop() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		addr := peers[i%len(peers)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.getConn(ctx, addr); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("getConn: %v", err)
+	}
+
+	slow.mu.Lock()
+	maxInFlight := slow.maxInFlight
+	slow.mu.Unlock()
+	if maxInFlight > defaultDialLimit {
+		t.Errorf("%d dials in flight at once, limit %d", maxInFlight, defaultDialLimit)
+	}
+	stats := client.PoolStats()
+	if stats.Conns != len(peers) {
+		t.Errorf("pool has %d conns, want %d", stats.Conns, len(peers))
+	}
+	// 50 callers for 5 peers: most must have joined an in-flight dial,
+	// and with 5 overlapping dials against 4 slots at least one queued.
+	if stats.SingleflightHits == 0 {
+		t.Error("no singleflight hits recorded")
+	}
+	if stats.QueuedDials == 0 {
+		t.Error("no queued dials recorded")
+	}
+}
@@ -0,0 +1,193 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// defaultPrefetchDepth is how many FetchChunk requests a restore keeps
+// in flight ahead of the writer. Over Tor the per-chunk round trip
+// dominates a restore, so overlapping a handful of requests buys most
+// of the available speedup.
+const defaultPrefetchDepth = 8
+
+// defaultPrefetchStagingBytes caps the on-disk staging area that holds
+// fetched chunks the writer has not consumed yet.
+const defaultPrefetchStagingBytes int64 = 64 << 20 // 64 MiB
+
+// errPrefetcherClosed aborts in-flight fetches once the restore is done
+// with the prefetcher.
+var errPrefetcherClosed = errors.New("prefetcher closed")
+
+// prefetchItem is one chunk moving through the prefetch queue. The
+// fetch goroutine fills the result fields, then closes done.
+type prefetchItem struct {
+	pos  int
+	name string
+	done chan struct{}
+
+	path string // staging file; empty when the fetch failed
+	size int64
+	err  error
+}
+
+// prefetcher runs ahead of the restore writer: it fetches the
+// manifest's chunks in order with a bounded number of requests in
+// flight, staging results on disk rather than RAM until the writer
+// consumes them in order. The writer may skip ahead — a failed file
+// abandons its remaining chunks — and staged results it passes over are
+// discarded.
+type prefetcher struct {
+	fetch    func(string) ([]byte, error)
+	dir      string
+	capBytes int64
+
+	// pending delivers items in manifest order; its capacity is the
+	// bound on fetches in flight ahead of the writer.
+	pending chan *prefetchItem
+	stop    chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	staged int64
+	// nextPos is the position the writer consumes next; the fetch at
+	// that position may always stage, so a full budget never deadlocks
+	// the queue head.
+	nextPos int
+	closed  bool
+}
+
+// newPrefetcher starts fetching names, in order, into the staging dir.
+// The caller must close the prefetcher when done, however far the
+// restore got.
+func newPrefetcher(fetch func(string) ([]byte, error), names []string, dir string, depth int, capBytes int64) (*prefetcher, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create restore staging dir: %w", err)
+	}
+	p := &prefetcher{
+		fetch:    fetch,
+		dir:      dir,
+		capBytes: capBytes,
+		pending:  make(chan *prefetchItem, depth),
+		stop:     make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run(names)
+	return p, nil
+}
+
+// run feeds the queue. Enqueueing before launching the fetch keeps
+// delivery in manifest order while the fetches themselves overlap.
+func (p *prefetcher) run(names []string) {
+	defer close(p.pending)
+	for i, name := range names {
+		it := &prefetchItem{pos: i, name: name, done: make(chan struct{})}
+		select {
+		case p.pending <- it:
+		case <-p.stop:
+			return
+		}
+		go p.fetchOne(it)
+	}
+}
+
+// fetchOne downloads one chunk and stages it, waiting for staging
+// budget first so the area stays within its cap.
+func (p *prefetcher) fetchOne(it *prefetchItem) {
+	defer close(it.done)
+	data, err := p.fetch(it.name)
+	if err != nil {
+		it.err = err
+		return
+	}
+	if !p.reserve(it.pos, int64(len(data))) {
+		it.err = errPrefetcherClosed
+		return
+	}
+	path := filepath.Join(p.dir, strconv.Itoa(it.pos))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		p.release(int64(len(data)))
+		it.err = err
+		return
+	}
+	it.path, it.size = path, int64(len(data))
+}
+
+// reserve blocks until size fits in the staging budget, or returns
+// false when the prefetcher closed. The chunk the writer needs next is
+// exempt so a budget filled by later chunks cannot stall the head of
+// the queue.
+func (p *prefetcher) reserve(pos int, size int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && pos != p.nextPos && p.staged+size > p.capBytes {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return false
+	}
+	p.staged += size
+	return true
+}
+
+func (p *prefetcher) release(size int64) {
+	p.mu.Lock()
+	p.staged -= size
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// next returns the data for name, the writer's next chunk in manifest
+// order. Staged results for chunks the writer skipped are discarded. A
+// name the queue no longer holds falls back to a direct fetch.
+func (p *prefetcher) next(name string) ([]byte, error) {
+	for it := range p.pending {
+		p.mu.Lock()
+		p.nextPos = it.pos
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		<-it.done
+		if it.name != name {
+			p.discard(it)
+			continue
+		}
+		if it.err != nil {
+			return nil, it.err
+		}
+		data, err := os.ReadFile(it.path)
+		p.discard(it)
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return p.fetch(name)
+}
+
+// discard drops a staged result the writer will not consume.
+func (p *prefetcher) discard(it *prefetchItem) {
+	if it.path == "" {
+		return
+	}
+	os.Remove(it.path)
+	p.release(it.size)
+}
+
+// close stops feeding the queue, drains in-flight fetches, and removes
+// the staging area. Safe to call however far the restore got.
+func (p *prefetcher) close() {
+	close(p.stop)
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	for it := range p.pending {
+		<-it.done
+		p.discard(it)
+	}
+	os.RemoveAll(p.dir)
+}
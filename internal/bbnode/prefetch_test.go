@@ -0,0 +1,172 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// echoFetch resolves a chunk name to its own bytes, after an optional
+// simulated round trip.
+func echoFetch(rtt time.Duration) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		if rtt > 0 {
+			time.Sleep(rtt)
+		}
+		return []byte(name), nil
+	}
+}
+
+func TestPrefetcherInOrder(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	dir := filepath.Join(t.TempDir(), "staging")
+	p, err := newPrefetcher(echoFetch(0), names, dir, 2, 3)
+	if err != nil {
+		t.Fatalf("newPrefetcher: %v", err)
+	}
+	for _, name := range names {
+		data, err := p.next(name)
+		if err != nil {
+			t.Fatalf("next(%s): %v", name, err)
+		}
+		if string(data) != name {
+			t.Errorf("next(%s) = %q", name, data)
+		}
+	}
+	p.close()
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staging dir after close: %v, want not exist", err)
+	}
+}
+
+func TestPrefetcherSkipsAbandonedChunks(t *testing.T) {
+	// A failed file abandons its remaining chunks; the writer then asks
+	// for a later name and the staged results in between are discarded.
+	names := []string{"a", "b", "c", "d"}
+	dir := filepath.Join(t.TempDir(), "staging")
+	p, err := newPrefetcher(echoFetch(0), names, dir, 4, 1<<20)
+	if err != nil {
+		t.Fatalf("newPrefetcher: %v", err)
+	}
+	if data, err := p.next("a"); err != nil || string(data) != "a" {
+		t.Fatalf("next(a) = %q, %v", data, err)
+	}
+	if data, err := p.next("d"); err != nil || string(data) != "d" {
+		t.Fatalf("next(d) = %q, %v", data, err)
+	}
+	p.close()
+	p.mu.Lock()
+	staged := p.staged
+	p.mu.Unlock()
+	if staged != 0 {
+		t.Errorf("staged budget after close = %d, want 0", staged)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staging dir after close: %v, want not exist", err)
+	}
+}
+
+func TestPrefetcherDrainsOnEarlyClose(t *testing.T) {
+	// Closing with the queue full — the cancellation path — must not
+	// leak staging files or hang on in-flight fetches.
+	names := make([]string, 100)
+	for i := range names {
+		names[i] = fmt.Sprint("chunk-", i)
+	}
+	dir := filepath.Join(t.TempDir(), "staging")
+	p, err := newPrefetcher(echoFetch(time.Millisecond), names, dir, 8, 16)
+	if err != nil {
+		t.Fatalf("newPrefetcher: %v", err)
+	}
+	if _, err := p.next(names[0]); err != nil {
+		t.Fatalf("next: %v", err)
+	}
+	p.close()
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staging dir after close: %v, want not exist", err)
+	}
+}
+
+func TestPrefetcherPropagatesFetchErrors(t *testing.T) {
+	fetchErr := errors.New("peer went away")
+	fetch := func(name string) ([]byte, error) {
+		if name == "bad" {
+			return nil, fetchErr
+		}
+		return []byte(name), nil
+	}
+	dir := filepath.Join(t.TempDir(), "staging")
+	p, err := newPrefetcher(fetch, []string{"a", "bad", "c"}, dir, 2, 1<<20)
+	if err != nil {
+		t.Fatalf("newPrefetcher: %v", err)
+	}
+	defer p.close()
+	if _, err := p.next("a"); err != nil {
+		t.Fatalf("next(a): %v", err)
+	}
+	if _, err := p.next("bad"); !errors.Is(err, fetchErr) {
+		t.Errorf("next(bad): %v, want the fetch error", err)
+	}
+	if data, err := p.next("c"); err != nil || string(data) != "c" {
+		t.Errorf("next(c) = %q, %v", data, err)
+	}
+}
+
+func TestPrefetcherStagingCapBoundsOutstanding(t *testing.T) {
+	// With a one-byte budget every chunk overflows the cap, so only the
+	// writer's next chunk may stage at a time; the restore must still
+	// complete.
+	names := []string{"aaaa", "bbbb", "cccc"}
+	dir := filepath.Join(t.TempDir(), "staging")
+	p, err := newPrefetcher(echoFetch(0), names, dir, 3, 1)
+	if err != nil {
+		t.Fatalf("newPrefetcher: %v", err)
+	}
+	defer p.close()
+	for _, name := range names {
+		if data, err := p.next(name); err != nil || string(data) != name {
+			t.Fatalf("next(%s) = %q, %v", name, data, err)
+		}
+	}
+}
+
+// BenchmarkRestorePrefetch measures consuming 64 chunks through the
+// prefetcher with a simulated per-fetch round trip, the latency shape
+// of a restore over Tor. The depth=1 case is the old strictly
+// sequential behavior; the default depth should finish close to
+// depth times faster.
+func BenchmarkRestorePrefetch(b *testing.B) {
+	const rtt = time.Millisecond
+	for _, depth := range []int{1, defaultPrefetchDepth} {
+		b.Run(fmt.Sprint("depth=", depth), func(b *testing.B) {
+			names := make([]string, 64)
+			for i := range names {
+				names[i] = fmt.Sprint("chunk-", i)
+			}
+			var fetches atomic.Int64
+			fetch := func(name string) ([]byte, error) {
+				fetches.Add(1)
+				time.Sleep(rtt)
+				return []byte(name), nil
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p, err := newPrefetcher(fetch, names, filepath.Join(b.TempDir(), "staging"), depth, defaultPrefetchStagingBytes)
+				if err != nil {
+					b.Fatalf("newPrefetcher: %v", err)
+				}
+				for _, name := range names {
+					if _, err := p.next(name); err != nil {
+						b.Fatalf("next: %v", err)
+					}
+				}
+				p.close()
+			}
+			b.ReportMetric(float64(fetches.Load())/float64(b.N), "fetches/op")
+		})
+	}
+}
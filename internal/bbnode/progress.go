@@ -0,0 +1,152 @@
+package bbnode
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// progressInterval throttles how often WatchJob pushes an update; a
+// terminal state goes out immediately regardless.
+const progressInterval = 500 * time.Millisecond
+
+// JobProgress is one live progress snapshot of a job. The totals grow
+// while a backup walk is still discovering files, so BytesDone may
+// briefly run ahead of BytesTotal on ratios computed from it.
+type JobProgress struct {
+	JobID string
+	Kind  string
+	State string
+	// BytesDone and BytesTotal count plaintext bytes of the operation.
+	BytesDone  int64
+	BytesTotal int64
+	// CurrentFile is the manifest path being worked on.
+	CurrentFile string
+	// ChunksDone and ChunksTotal count chunk transfers; ChunksTotal is
+	// zero when it is not known up front.
+	ChunksDone  int64
+	ChunksTotal int64
+	// BytesPerSec is the average rate since the job started.
+	BytesPerSec int64
+	// Done marks the final update: the job reached a terminal state.
+	Done  bool
+	Error string
+}
+
+// jobProgressState is the live progress of one running job, shared by
+// the job itself and any number of watchers.
+type jobProgressState struct {
+	mu        sync.Mutex
+	cur       JobProgress
+	startedAt time.Time
+	// done closes when the job reaches a terminal state, waking every
+	// watcher for the final update.
+	done chan struct{}
+}
+
+func (st *jobProgressState) snapshot() JobProgress {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	p := st.cur
+	if elapsed := time.Since(st.startedAt).Seconds(); elapsed > 0 && p.BytesDone > 0 {
+		p.BytesPerSec = int64(float64(p.BytesDone) / elapsed)
+	}
+	return p
+}
+
+// startJobProgress registers live progress for a job runJob launches.
+func (n *Node) startJobProgress(job *Job) {
+	st := &jobProgressState{
+		cur:       JobProgress{JobID: job.ID, Kind: job.Kind, State: jobRunning},
+		startedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+	n.progressMu.Lock()
+	n.progress[job.ID] = st
+	n.progressMu.Unlock()
+}
+
+// updateJobProgress applies fn to the job's live progress. A job
+// without live progress (already finished) is ignored.
+func (n *Node) updateJobProgress(id string, fn func(*JobProgress)) {
+	n.progressMu.Lock()
+	st := n.progress[id]
+	n.progressMu.Unlock()
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	fn(&st.cur)
+	st.mu.Unlock()
+}
+
+// finishJobProgress publishes the job's terminal state to its watchers
+// and drops the live entry; later watchers read the stored job record.
+func (n *Node) finishJobProgress(id, state string, cause error) {
+	n.progressMu.Lock()
+	st := n.progress[id]
+	delete(n.progress, id)
+	n.progressMu.Unlock()
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	st.cur.State = state
+	st.cur.Done = true
+	if cause != nil {
+		st.cur.Error = cause.Error()
+	}
+	st.mu.Unlock()
+	close(st.done)
+}
+
+// WatchJob follows the job's progress: send is called once right away,
+// then at most every progressInterval while something changed, and
+// immediately with the final snapshot when the job ends. It returns
+// when the job ends, send fails, or ctx is cancelled. Any number of
+// watchers may follow the same job; a job that already finished gets
+// its stored record's terminal state.
+func (n *Node) WatchJob(ctx context.Context, id string, send func(JobProgress) error) error {
+	n.progressMu.Lock()
+	st := n.progress[id]
+	n.progressMu.Unlock()
+	if st == nil {
+		var job Job
+		if err := n.sec.GetJSON(jobRecordKey(id), &job); err != nil {
+			return fmt.Errorf("unknown job %s: %w", id, err)
+		}
+		return send(JobProgress{
+			JobID: job.ID, Kind: job.Kind, State: job.State,
+			Done: true, Error: job.Error,
+		})
+	}
+	last := st.snapshot()
+	if err := send(last); err != nil {
+		return err
+	}
+	if last.Done {
+		return nil
+	}
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-st.done:
+		case <-t.C:
+		}
+		p := st.snapshot()
+		if p == last && !p.Done {
+			continue
+		}
+		if err := send(p); err != nil {
+			return err
+		}
+		last = p
+		if p.Done {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestWatchJob(t *testing.T) {
+	network := netmock.New()
+	n := startTestNode(t, network, "password-a")
+
+	// A fake job body that reports progress like the real ones.
+	started := make(chan struct{})
+	stop := make(chan struct{})
+	jobDone := make(chan error, 1)
+	job := &Job{Kind: "backup"}
+	go func() {
+		jobDone <- n.runJob(context.Background(), job, func(ctx context.Context) error {
+			n.updateJobProgress(job.ID, func(p *JobProgress) {
+				p.BytesTotal = 100
+				p.BytesDone = 25
+				p.CurrentFile = "dir/file.txt"
+			})
+			close(started)
+			<-stop
+			n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesDone = 100 })
+			return nil
+		})
+	}()
+	<-started
+
+	var updates []JobProgress
+	watchDone := make(chan error, 1)
+	go func() {
+		watchDone <- n.WatchJob(context.Background(), job.ID, func(p JobProgress) error {
+			updates = append(updates, p)
+			return nil
+		})
+	}()
+	// Give the watcher time for its immediate first update, then let
+	// the job finish; the terminal update must follow without waiting
+	// for the next tick.
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case err := <-watchDone:
+		if err != nil {
+			t.Fatalf("WatchJob: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchJob did not return after the job finished")
+	}
+	if err := <-jobDone; err != nil {
+		t.Fatalf("job: %v", err)
+	}
+	if len(updates) < 2 {
+		t.Fatalf("got %d updates, want at least 2", len(updates))
+	}
+	first := updates[0]
+	if first.State != "running" || first.BytesDone != 25 || first.BytesTotal != 100 || first.CurrentFile != "dir/file.txt" {
+		t.Errorf("first update = %+v", first)
+	}
+	final := updates[len(updates)-1]
+	if !final.Done || final.State != "done" || final.BytesDone != 100 {
+		t.Errorf("final update = %+v", final)
+	}
+
+	// Watching a finished job returns its stored terminal state in one
+	// update.
+	var after []JobProgress
+	err := n.WatchJob(context.Background(), job.ID, func(p JobProgress) error {
+		after = append(after, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WatchJob on finished job: %v", err)
+	}
+	if len(after) != 1 || !after[0].Done || after[0].State != "done" {
+		t.Errorf("updates on finished job = %+v", after)
+	}
+
+	if err := n.WatchJob(context.Background(), "no-such-job", func(JobProgress) error { return nil }); err == nil {
+		t.Error("WatchJob on an unknown job succeeded")
+	}
+}
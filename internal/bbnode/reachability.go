@@ -0,0 +1,172 @@
+package bbnode
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Reachability history parameters: 24 hours of five-minute buckets per
+// peer, fed by the prober and every outbound call, so "is my peer flaky
+// or is my Tor flaky?" has an answer beyond the last probe.
+const (
+	reachBucket  = 5 * time.Minute
+	reachBuckets = 288
+	// reachPersistInterval throttles history writes; losing the last few
+	// minutes on a crash is acceptable.
+	reachPersistInterval = 5 * time.Minute
+)
+
+// reachHistoryKey persists the rolling history in the secstore.
+const reachHistoryKey = "reachability"
+
+// Per-bucket reachability states, as exposed through the CLI API.
+const (
+	ReachNone  = 0 // no contact attempted in the bucket
+	ReachOK    = 1 // every attempt succeeded
+	ReachFail  = 2 // every attempt failed
+	ReachMixed = 3 // both outcomes seen
+)
+
+// reachCounts are the attempt outcomes within one bucket.
+type reachCounts struct {
+	OK   int `json:"ok,omitempty"`
+	Fail int `json:"fail,omitempty"`
+}
+
+// recordReach folds one outbound contact outcome into the peer's
+// rolling history and prunes buckets that fell out of the window.
+func (n *Node) recordReach(onion string, ok bool) {
+	bucket := time.Now().Unix() / int64(reachBucket/time.Second)
+	n.reachMu.Lock()
+	defer n.reachMu.Unlock()
+	if n.reach == nil {
+		n.reach = make(map[string]map[int64]*reachCounts)
+	}
+	peer := n.reach[onion]
+	if peer == nil {
+		peer = make(map[int64]*reachCounts)
+		n.reach[onion] = peer
+	}
+	c := peer[bucket]
+	if c == nil {
+		c = &reachCounts{}
+		peer[bucket] = c
+		for b := range peer {
+			if b <= bucket-reachBuckets {
+				delete(peer, b)
+			}
+		}
+	}
+	if ok {
+		c.OK++
+	} else {
+		c.Fail++
+	}
+	n.reachDirty = true
+}
+
+// loadReachHistory restores the persisted history. Called from New.
+func (n *Node) loadReachHistory() error {
+	var reach map[string]map[int64]*reachCounts
+	err := n.sec.GetJSON(reachHistoryKey, &reach)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	n.reachMu.Lock()
+	n.reach = reach
+	n.reachMu.Unlock()
+	return nil
+}
+
+// runReachPersist periodically writes the dirty history out, and once
+// more on stop so a clean shutdown keeps the full window.
+func (n *Node) runReachPersist(stop <-chan struct{}) {
+	t := time.NewTicker(reachPersistInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			n.persistReachHistory()
+		case <-stop:
+			n.persistReachHistory()
+			return
+		}
+	}
+}
+
+// persistReachHistory writes the history if it changed since the last
+// write. A failure only costs history, not correctness.
+func (n *Node) persistReachHistory() {
+	n.reachMu.Lock()
+	if !n.reachDirty {
+		n.reachMu.Unlock()
+		return
+	}
+	snapshot := make(map[string]map[int64]*reachCounts, len(n.reach))
+	for onion, peer := range n.reach {
+		cp := make(map[int64]*reachCounts, len(peer))
+		for b, c := range peer {
+			cc := *c
+			cp[b] = &cc
+		}
+		snapshot[onion] = cp
+	}
+	n.reachDirty = false
+	n.reachMu.Unlock()
+	if err := n.sec.PutJSON(reachHistoryKey, snapshot); err != nil {
+		log.Printf("persist reachability history: %v", err)
+	}
+}
+
+// PeerReachability returns the peer's last 24 hours as one state per
+// five-minute bucket, oldest first. Buckets without contact are
+// ReachNone.
+func (n *Node) PeerReachability(onion string) []int32 {
+	now := time.Now().Unix() / int64(reachBucket/time.Second)
+	out := make([]int32, reachBuckets)
+	n.reachMu.Lock()
+	defer n.reachMu.Unlock()
+	for b, c := range n.reach[onion] {
+		i := int(b - (now - reachBuckets + 1))
+		if i < 0 || i >= reachBuckets {
+			continue
+		}
+		switch {
+		case c.OK > 0 && c.Fail > 0:
+			out[i] = ReachMixed
+		case c.OK > 0:
+			out[i] = ReachOK
+		case c.Fail > 0:
+			out[i] = ReachFail
+		}
+	}
+	return out
+}
+
+// OutboundSuccessRate aggregates the last 24 hours of outbound contacts
+// across all peers. A low rate with enough attempts points at this
+// node's own transport rather than any one peer.
+func (n *Node) OutboundSuccessRate() (rate float64, attempts int) {
+	cutoff := time.Now().Unix()/int64(reachBucket/time.Second) - reachBuckets
+	var ok int
+	n.reachMu.Lock()
+	defer n.reachMu.Unlock()
+	for _, peer := range n.reach {
+		for b, c := range peer {
+			if b <= cutoff {
+				continue
+			}
+			ok += c.OK
+			attempts += c.OK + c.Fail
+		}
+	}
+	if attempts == 0 {
+		return 0, 0
+	}
+	return float64(ok) / float64(attempts), attempts
+}
@@ -0,0 +1,90 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestReachabilityStates(t *testing.T) {
+	n := startTestNode(t, netmock.New(), "password-a")
+	const onion = "peerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeer.onion"
+
+	n.recordReach(onion, true)
+	hist := n.PeerReachability(onion)
+	if len(hist) != reachBuckets {
+		t.Fatalf("history length = %d, want %d", len(hist), reachBuckets)
+	}
+	if got := hist[reachBuckets-1]; got != ReachOK {
+		t.Errorf("current bucket = %d, want ReachOK", got)
+	}
+	n.recordReach(onion, false)
+	if got := n.PeerReachability(onion)[reachBuckets-1]; got != ReachMixed {
+		t.Errorf("current bucket after a failure = %d, want ReachMixed", got)
+	}
+	if got := n.PeerReachability("other")[reachBuckets-1]; got != ReachNone {
+		t.Errorf("unknown peer's bucket = %d, want ReachNone", got)
+	}
+
+	rate, attempts := n.OutboundSuccessRate()
+	if attempts != 2 || rate != 0.5 {
+		t.Errorf("OutboundSuccessRate = %v over %d, want 0.5 over 2", rate, attempts)
+	}
+}
+
+func TestReachabilityPruneAndPersist(t *testing.T) {
+	n := startTestNode(t, netmock.New(), "password-a")
+	const onion = "peerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeerpeer.onion"
+
+	// Plant a bucket older than the window; the next record prunes it.
+	stale := time.Now().Add(-25*time.Hour).Unix() / int64(reachBucket/time.Second)
+	n.reachMu.Lock()
+	n.reach = map[string]map[int64]*reachCounts{
+		onion: {stale: {Fail: 3}},
+	}
+	n.reachMu.Unlock()
+	n.recordReach(onion, true)
+	n.reachMu.Lock()
+	_, staleKept := n.reach[onion][stale]
+	n.reachMu.Unlock()
+	if staleKept {
+		t.Error("bucket older than the window survived recordReach")
+	}
+	if rate, attempts := n.OutboundSuccessRate(); attempts != 1 || rate != 1 {
+		t.Errorf("OutboundSuccessRate = %v over %d, want 1 over 1", rate, attempts)
+	}
+
+	// The history survives a persist/load cycle.
+	n.persistReachHistory()
+	n.reachMu.Lock()
+	n.reach = nil
+	n.reachMu.Unlock()
+	if err := n.loadReachHistory(); err != nil {
+		t.Fatalf("loadReachHistory: %v", err)
+	}
+	if got := n.PeerReachability(onion)[reachBuckets-1]; got != ReachOK {
+		t.Errorf("bucket after reload = %d, want ReachOK", got)
+	}
+}
+
+func TestReachabilityFedByPeerCalls(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), ""); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.SendMessage(ctx, b.Address(), "ping"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if got := a.PeerReachability(b.Address())[reachBuckets-1]; got != ReachOK {
+		t.Errorf("bucket after a successful call = %d, want ReachOK", got)
+	}
+}
@@ -0,0 +1,131 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/chunkcrypto"
+	"github.com/starius/barterbackup/internal/manifest"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// RecoverFromPeer downloads every manifest the peer stores for this
+// node and repopulates the local backup index. This is the disaster
+// path: only the password and one peer's onion address survived, so the
+// peer may not be in the (empty) registry yet; a raw onion address is
+// added to it.
+func (n *Node) RecoverFromPeer(ctx context.Context, aliasOrOnion string) ([]Backup, error) {
+	onion := aliasOrOnion
+	if p, err := n.findPeer(aliasOrOnion); err == nil {
+		onion = p.Onion
+	} else if strings.HasSuffix(aliasOrOnion, ".onion") {
+		if err := n.AddPeer(aliasOrOnion, ""); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	cc, err := n.getConn(ctx, onion)
+	if err != nil {
+		return nil, err
+	}
+	client := pb.NewPeerClient(cc)
+
+	list, err := client.ListStoredManifests(ctx, &pb.ListStoredManifestsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("list stored manifests: %w", err)
+	}
+	var recovered []Backup
+	for _, id := range list.BackupIds {
+		if _, err := n.sec.Get(manifestRecordKey(id)); err == nil {
+			continue // already present locally
+		} else if !errors.Is(err, secstore.ErrNotFound) {
+			return nil, err
+		}
+		b, err := n.recoverManifest(ctx, client, onion, id)
+		if err != nil {
+			return nil, fmt.Errorf("recover backup %s: %w", id, err)
+		}
+		recovered = append(recovered, *b)
+	}
+	return recovered, nil
+}
+
+// recoverManifest fetches, authenticates, and stores one manifest, and
+// rebuilds its backup record from the manifest contents.
+func (n *Node) recoverManifest(ctx context.Context, client pb.PeerClient, onion, id string) (*Backup, error) {
+	key, err := n.backupSealKey(id)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	stream, err := client.FetchManifest(ctx, &pb.FetchManifestRequest{BackupId: id})
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	var env []byte
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("receive manifest frame: %w", err)
+		}
+		env = append(env, frame.Data...)
+		if len(env) > maxManifestBlob {
+			return nil, fmt.Errorf("manifest exceeds %d bytes", maxManifestBlob)
+		}
+	}
+	data, index, err := chunkcrypto.Open(env, key)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate manifest: %w", err)
+	}
+	if index != uint64(manifestEnvelopeIndex) {
+		return nil, fmt.Errorf("manifest sealed under chunk index %d", index)
+	}
+
+	mr, err := manifest.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	hdr := mr.Header()
+	if hdr.BackupId != id {
+		return nil, fmt.Errorf("manifest header claims backup %s", hdr.BackupId)
+	}
+	peers := hdr.Peers
+	if len(peers) == 0 {
+		peers = []string{onion}
+	}
+	b := &Backup{
+		ID:          id,
+		Peers:       peers,
+		Replication: map[string]string{onion: "complete"},
+		SourceDir:   hdr.SourceDir,
+		CreatedAt:   time.Unix(hdr.CreatedAtUnix, 0),
+	}
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		b.FileCount++
+		b.TotalBytes += e.Size
+		b.ChunkCount += len(e.Chunks)
+	}
+	if err := n.sec.Put(manifestRecordKey(id), data); err != nil {
+		return nil, fmt.Errorf("store manifest: %w", err)
+	}
+	if err := n.sec.PutJSON(backupRecordKey(id), b); err != nil {
+		return nil, fmt.Errorf("store backup record: %w", err)
+	}
+	return b, nil
+}
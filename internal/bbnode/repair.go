@@ -0,0 +1,245 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/chunkcrypto"
+	"github.com/starius/barterbackup/internal/hashid"
+	"github.com/starius/barterbackup/internal/manifest"
+)
+
+// chunkSource is everything needed to rebuild one chunk envelope during
+// repair: where the plaintext lived in the source tree and how it was
+// sealed.
+type chunkSource struct {
+	sealerID string
+	hash     string
+	index    uint64
+	path     string // slash-separated, relative to the source dir
+	offset   int64
+	size     int64
+}
+
+// RepairResult summarizes a repair run against one replica peer.
+type RepairResult struct {
+	// Checked is how many distinct blobs the peer was audited for.
+	Checked int
+	// Missing is how many of them the peer lacked.
+	Missing int
+	// Repaired is how many missing blobs were re-uploaded.
+	Repaired int
+	// Unrepaired lists blob names that could not be rebuilt from local
+	// source data or any other replica.
+	Unrepaired []string
+}
+
+// RepairBackup audits one replica peer for the backup's chunks and
+// re-uploads missing ones, from local source data when the file is
+// still unchanged, or from another replica otherwise. The run is
+// registered as a job, so bbcli job pause/resume/cancel apply to it.
+func (n *Node) RepairBackup(ctx context.Context, id, peerSpec string) (*RepairResult, error) {
+	job := &Job{Kind: "repair", BackupID: id, Peer: peerSpec}
+	var res *RepairResult
+	err := n.runJob(ctx, job, func(ctx context.Context) error {
+		var err error
+		res, err = n.repairBackup(ctx, job)
+		return err
+	})
+	return res, err
+}
+
+func (n *Node) repairBackup(ctx context.Context, job *Job) (*RepairResult, error) {
+	id, peerSpec := job.BackupID, job.Peer
+	var b Backup
+	if err := n.sec.GetJSON(backupRecordKey(id), &b); err != nil {
+		return nil, fmt.Errorf("unknown backup %s: %w", id, err)
+	}
+	p, err := n.findPeer(peerSpec)
+	if err != nil {
+		return nil, err
+	}
+	isReplica := false
+	for _, onion := range b.Peers {
+		if onion == p.Onion {
+			isReplica = true
+		}
+	}
+	if !isReplica {
+		return nil, fmt.Errorf("peer %s is not a replica of backup %s", p.Onion, id)
+	}
+
+	sources, err := n.chunkSources(id)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := n.getConn(ctx, p.Onion)
+	if err != nil {
+		return nil, err
+	}
+	client := pb.NewPeerClient(cc)
+
+	var others []replica
+	for _, onion := range b.Peers {
+		if onion == p.Onion {
+			continue
+		}
+		occ, err := n.getConn(ctx, onion)
+		if err != nil {
+			continue
+		}
+		others = append(others, replica{onion: onion, client: pb.NewPeerClient(occ)})
+	}
+
+	res := &RepairResult{}
+	// The manifest blob audited at the end counts as one more chunk.
+	n.updateJobProgress(job.ID, func(p *JobProgress) { p.ChunksTotal = int64(len(sources)) + 1 })
+	for name, src := range sources {
+		if err := checkpoint(ctx); err != nil {
+			return nil, err
+		}
+		res.Checked++
+		n.updateJobProgress(job.ID, func(p *JobProgress) {
+			p.ChunksDone++
+			p.CurrentFile = src.path
+		})
+		has, err := client.HasChunk(ctx, &pb.HasChunkRequest{Name: name})
+		if err != nil {
+			return nil, fmt.Errorf("check chunk on %s: %w", p.Onion, err)
+		}
+		if has.Present {
+			continue
+		}
+		res.Missing++
+		env, err := n.rebuildEnvelope(ctx, &b, src, others)
+		if err != nil {
+			res.Unrepaired = append(res.Unrepaired, name)
+			continue
+		}
+		if _, err := client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: name, Data: env}); err != nil {
+			return nil, fmt.Errorf("re-upload chunk to %s: %w", p.Onion, err)
+		}
+		res.Repaired++
+		n.updateJobProgress(job.ID, func(p *JobProgress) { p.BytesDone += int64(len(env)) })
+	}
+
+	// The manifest blob is part of the replica too.
+	res.Checked++
+	has, err := client.HasChunk(ctx, &pb.HasChunkRequest{Name: manifestBlobPrefix + id})
+	if err != nil {
+		return nil, fmt.Errorf("check manifest on %s: %w", p.Onion, err)
+	}
+	if !has.Present {
+		res.Missing++
+		raw, err := n.sec.Get(manifestRecordKey(id))
+		if err != nil {
+			return nil, fmt.Errorf("load manifest: %w", err)
+		}
+		key, err := n.backupSealKey(id)
+		if err != nil {
+			return nil, err
+		}
+		defer key.Zero()
+		if err := pushManifest(ctx, client, key, id, raw); err != nil {
+			res.Unrepaired = append(res.Unrepaired, manifestBlobPrefix+id)
+		} else {
+			res.Repaired++
+		}
+	}
+	return res, nil
+}
+
+// chunkSources indexes the backup's chunk blobs by name, remembering
+// one source location per blob.
+func (n *Node) chunkSources(id string) (map[string]*chunkSource, error) {
+	raw, err := n.sec.Get(manifestRecordKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("load manifest: %w", err)
+	}
+	mr, err := manifest.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]*chunkSource)
+	for {
+		e, err := mr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for _, ref := range e.Chunks {
+			sealerID := ref.BackupId
+			if sealerID == "" {
+				sealerID = id
+			}
+			name := chunkBlobName(sealerID, ref.Hash)
+			if _, ok := sources[name]; ok {
+				continue
+			}
+			sources[name] = &chunkSource{
+				sealerID: sealerID,
+				hash:     ref.Hash,
+				index:    ref.Index,
+				path:     e.Path,
+				offset:   ref.Offset,
+				size:     ref.Size,
+			}
+		}
+	}
+	return sources, nil
+}
+
+// rebuildEnvelope reconstructs a chunk envelope, preferring the local
+// source file (re-sealing the original plaintext) and falling back to
+// fetching and authenticating the envelope from another replica.
+func (n *Node) rebuildEnvelope(ctx context.Context, b *Backup, src *chunkSource, others []replica) ([]byte, error) {
+	key, err := n.backupSealKey(src.sealerID)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	if env, err := resealFromSource(filepath.Join(b.SourceDir, filepath.FromSlash(src.path)), src, key); err == nil {
+		return env, nil
+	}
+	name := chunkBlobName(src.sealerID, src.hash)
+	for _, other := range others {
+		env, err := n.fetchChunkData(ctx, other.client, other.onion, name)
+		if err != nil {
+			continue
+		}
+		// Authenticate before spreading it further.
+		if _, index, err := chunkcrypto.Open(env, key); err != nil || index != src.index {
+			n.reportPeerAudit(other.onion, false)
+			continue
+		}
+		n.reportPeerAudit(other.onion, true)
+		return env, nil
+	}
+	return nil, fmt.Errorf("chunk %s not recoverable", name)
+}
+
+// resealFromSource re-reads the chunk's plaintext from the source file
+// and seals it again. It fails if the file changed since the backup.
+func resealFromSource(path string, src *chunkSource, key *chunkcrypto.BackupKey) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	block := make([]byte, src.size)
+	if _, err := f.ReadAt(block, src.offset); err != nil {
+		return nil, err
+	}
+	if ok, err := hashid.Matches(src.hash, block); err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", src.hash, err)
+	} else if !ok {
+		return nil, fmt.Errorf("source file %s changed since the backup", path)
+	}
+	return chunkcrypto.Seal(block, key, src.index)
+}
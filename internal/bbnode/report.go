@@ -0,0 +1,232 @@
+package bbnode
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// reportDateFormat keys report buckets; one bucket per UTC day.
+const reportDateFormat = "2006-01-02"
+
+// reportRetentionDays is how many daily buckets are kept; older ones
+// are pruned when the day rolls over.
+const reportRetentionDays = 90
+
+// reportFlushInterval is how often the current day's counters are
+// persisted, so at most this much activity is lost in a crash.
+const reportFlushInterval = 5 * time.Minute
+
+func reportKey(date string) string { return "reports/" + date }
+
+// ReportDay aggregates one UTC day of node activity. The counters are
+// fed by cheap hooks on the hot paths, not by scanning logs.
+type ReportDay struct {
+	// Date is the bucket's UTC day, formatted as 2006-01-02.
+	Date string `json:"date"`
+	// StoredForPeers maps peer onion -> bytes the peer uploaded to us
+	// that day.
+	StoredForPeers map[string]int64 `json:"stored_for_peers,omitempty"`
+	// StoredAtPeers maps peer onion -> bytes we uploaded to the peer
+	// that day.
+	StoredAtPeers map[string]int64 `json:"stored_at_peers,omitempty"`
+	// AuditsPassed and AuditsFailed count chunk envelopes that passed or
+	// failed authentication when read back from peers.
+	AuditsPassed int `json:"audits_passed,omitempty"`
+	AuditsFailed int `json:"audits_failed,omitempty"`
+	// AuditsByPeer breaks the audit counters down by the replica that
+	// served the envelope, for fetch paths where it is known.
+	AuditsByPeer map[string]*PeerAudits `json:"audits_by_peer,omitempty"`
+	// JobsRun counts finished jobs; Errors counts the ones that failed.
+	JobsRun int `json:"jobs_run,omitempty"`
+	Errors  int `json:"errors,omitempty"`
+	// StorageDriftBytes is how far the usage counters had drifted from
+	// the blobs on disk, as found by the reconciliation runs that day.
+	StorageDriftBytes int64 `json:"storage_drift_bytes,omitempty"`
+}
+
+// PeerAudits counts one peer's audit outcomes within a day bucket.
+type PeerAudits struct {
+	Passed int `json:"passed,omitempty"`
+	Failed int `json:"failed,omitempty"`
+}
+
+// reportUpdate applies f to the current day's bucket, rolling the day
+// over (and pruning expired buckets) when the UTC date changed since
+// the last update.
+func (n *Node) reportUpdate(f func(*ReportDay)) {
+	n.reportMu.Lock()
+	defer n.reportMu.Unlock()
+	day := n.clk.Now().UTC().Format(reportDateFormat)
+	if n.reportCur == nil || n.reportCur.Date != day {
+		n.flushReportLocked()
+		cur := &ReportDay{Date: day}
+		// A restart mid-day continues the persisted bucket.
+		if err := n.sec.GetJSON(reportKey(day), cur); err != nil && !errors.Is(err, secstore.ErrNotFound) {
+			log.Printf("load report bucket: %v", err)
+		}
+		cur.Date = day
+		n.reportCur = cur
+		n.pruneReportsLocked(day)
+	}
+	f(n.reportCur)
+	n.reportDirty = true
+}
+
+// flushReportLocked persists the current bucket if it changed since the
+// last flush. Callers hold reportMu.
+func (n *Node) flushReportLocked() {
+	if n.reportCur == nil || !n.reportDirty {
+		return
+	}
+	if err := n.sec.PutJSON(reportKey(n.reportCur.Date), n.reportCur); err != nil {
+		log.Printf("persist report bucket: %v", err)
+		return
+	}
+	n.reportDirty = false
+}
+
+// flushReport persists the current bucket; it runs periodically, on
+// Stop, and before reads so Report sees fresh numbers.
+func (n *Node) flushReport() {
+	n.reportMu.Lock()
+	defer n.reportMu.Unlock()
+	n.flushReportLocked()
+}
+
+// pruneReportsLocked deletes buckets older than the retention window.
+// Callers hold reportMu.
+func (n *Node) pruneReportsLocked(today string) {
+	cutoff, err := time.Parse(reportDateFormat, today)
+	if err != nil {
+		return
+	}
+	oldest := cutoff.AddDate(0, 0, -reportRetentionDays).Format(reportDateFormat)
+	keys, err := n.sec.List("reports/")
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if date := key[len("reports/"):]; date < oldest {
+			if err := n.sec.Delete(key); err != nil {
+				log.Printf("prune report bucket %s: %v", date, err)
+			}
+		}
+	}
+}
+
+// runReportFlusher persists the report counters every
+// reportFlushInterval until the stop channel closes.
+func (n *Node) runReportFlusher(stop chan struct{}) {
+	t := n.clk.NewTicker(reportFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C():
+			n.flushReport()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Hooks feeding the aggregator. They only bump in-memory counters;
+// persistence happens on the flush schedule.
+
+func (n *Node) reportStoredFor(peer string, bytes int) {
+	n.reportUpdate(func(d *ReportDay) {
+		if d.StoredForPeers == nil {
+			d.StoredForPeers = make(map[string]int64)
+		}
+		d.StoredForPeers[peer] += int64(bytes)
+	})
+}
+
+func (n *Node) reportStoredAt(peer string, bytes int) {
+	n.reportUpdate(func(d *ReportDay) {
+		if d.StoredAtPeers == nil {
+			d.StoredAtPeers = make(map[string]int64)
+		}
+		d.StoredAtPeers[peer] += int64(bytes)
+	})
+}
+
+func (n *Node) reportAudit(passed bool) {
+	n.reportUpdate(func(d *ReportDay) {
+		if passed {
+			d.AuditsPassed++
+		} else {
+			d.AuditsFailed++
+		}
+	})
+}
+
+// reportPeerAudit is reportAudit for paths that know which replica
+// served the envelope; it feeds both the global and the per-peer
+// counters.
+func (n *Node) reportPeerAudit(peer string, passed bool) {
+	n.reportUpdate(func(d *ReportDay) {
+		if passed {
+			d.AuditsPassed++
+		} else {
+			d.AuditsFailed++
+		}
+		if d.AuditsByPeer == nil {
+			d.AuditsByPeer = make(map[string]*PeerAudits)
+		}
+		pa := d.AuditsByPeer[peer]
+		if pa == nil {
+			pa = &PeerAudits{}
+			d.AuditsByPeer[peer] = pa
+		}
+		if passed {
+			pa.Passed++
+		} else {
+			pa.Failed++
+		}
+	})
+}
+
+func (n *Node) reportStorageDrift(bytes int64) {
+	n.reportUpdate(func(d *ReportDay) {
+		d.StorageDriftBytes += bytes
+	})
+}
+
+func (n *Node) reportJobRun(failed bool) {
+	n.reportUpdate(func(d *ReportDay) {
+		d.JobsRun++
+		if failed {
+			d.Errors++
+		}
+	})
+}
+
+// Report returns the daily buckets whose dates fall inside [from, to],
+// compared by UTC day, oldest first.
+func (n *Node) Report(from, to time.Time) ([]ReportDay, error) {
+	n.flushReport()
+	fromDay := from.UTC().Format(reportDateFormat)
+	toDay := to.UTC().Format(reportDateFormat)
+	keys, err := n.sec.List("reports/")
+	if err != nil {
+		return nil, err
+	}
+	var out []ReportDay
+	for _, key := range keys {
+		date := key[len("reports/"):]
+		if date < fromDay || date > toDay {
+			continue
+		}
+		var day ReportDay
+		if err := n.sec.GetJSON(key, &day); err != nil {
+			return nil, err
+		}
+		out = append(out, day)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
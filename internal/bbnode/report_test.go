@@ -0,0 +1,94 @@
+package bbnode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestReportDailyBucketing(t *testing.T) {
+	fc := newFakeClock() // starts at 2023-11-14 22:13:20 UTC
+	n, err := New("password-a", netmock.New(), t.TempDir(), withClock(fc))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// Plant an expired bucket; the first day rollover must prune it.
+	if err := n.sec.PutJSON(reportKey("2020-01-01"), &ReportDay{Date: "2020-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n.reportStoredFor("peer1", 100)
+	n.reportStoredFor("peer1", 50)
+	n.reportStoredAt("peer2", 200)
+	n.reportJobRun(false)
+	n.reportAudit(true)
+
+	fc.Advance(24 * time.Hour)
+	n.reportStoredFor("peer1", 7)
+	n.reportJobRun(true)
+	n.reportAudit(false)
+
+	days, err := n.Report(time.Unix(1700000000, 0), fc.Now())
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("Report returned %d days, want 2: %+v", len(days), days)
+	}
+	d1, d2 := days[0], days[1]
+	if d1.Date != "2023-11-14" || d2.Date != "2023-11-15" {
+		t.Errorf("dates = %q, %q, want 2023-11-14, 2023-11-15", d1.Date, d2.Date)
+	}
+	if got := d1.StoredForPeers["peer1"]; got != 150 {
+		t.Errorf("day 1 stored for peer1 = %d, want 150", got)
+	}
+	if got := d1.StoredAtPeers["peer2"]; got != 200 {
+		t.Errorf("day 1 stored at peer2 = %d, want 200", got)
+	}
+	if d1.JobsRun != 1 || d1.Errors != 0 || d1.AuditsPassed != 1 || d1.AuditsFailed != 0 {
+		t.Errorf("day 1 counters = %+v", d1)
+	}
+	if got := d2.StoredForPeers["peer1"]; got != 7 {
+		t.Errorf("day 2 stored for peer1 = %d, want 7", got)
+	}
+	if d2.JobsRun != 1 || d2.Errors != 1 || d2.AuditsFailed != 1 {
+		t.Errorf("day 2 counters = %+v", d2)
+	}
+
+	// The expired bucket is gone and out-of-range queries see nothing.
+	old, err := n.Report(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Report (old range): %v", err)
+	}
+	if len(old) != 0 {
+		t.Errorf("expired bucket survived the rollover: %+v", old)
+	}
+}
+
+func TestReportSurvivesRestart(t *testing.T) {
+	network := netmock.New()
+	dir := t.TempDir()
+	a, err := New("password-a", network, dir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.reportStoredFor("peer1", 10)
+	a.flushReport()
+
+	b, err := New("password-a", network, dir)
+	if err != nil {
+		t.Fatalf("New after restart: %v", err)
+	}
+	b.reportStoredFor("peer1", 5)
+	days, err := b.Report(time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(days) != 1 {
+		t.Fatalf("Report returned %d days, want 1", len(days))
+	}
+	if got := days[0].StoredForPeers["peer1"]; got != 15 {
+		t.Errorf("stored for peer1 = %d after restart, want 15", got)
+	}
+}
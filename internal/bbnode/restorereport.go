@@ -0,0 +1,94 @@
+package bbnode
+
+import (
+	"errors"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// restoreReportKey is where the latest restore's integrity report for a
+// backup is kept.
+func restoreReportKey(id string) string { return "restorereports/" + id }
+
+// Per-file verification outcomes of a restore.
+const (
+	RestoreFileOK            = "ok"
+	RestoreFileHashMismatch  = "hash mismatch"
+	RestoreFileMissingChunks = "missing chunks"
+	RestoreFilePermission    = "permission error"
+	RestoreFileSkipped       = "skipped"
+	// RestoreFileError covers failures outside the classified cases,
+	// e.g. the node stopping mid-restore.
+	RestoreFileError = "error"
+)
+
+// RestoreFileResult is the verification outcome of one restored entry.
+type RestoreFileResult struct {
+	Path   string `json:"path"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// RestoreReport is the integrity report of one restore run: every
+// regular file verified against the whole-file hash in the manifest,
+// plus any entry that failed or was skipped.
+type RestoreReport struct {
+	BackupID   string    `json:"backup_id"`
+	DestDir    string    `json:"dest_dir"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	FilesOK       int   `json:"files_ok"`
+	FilesFailed   int   `json:"files_failed"`
+	FilesSkipped  int   `json:"files_skipped"`
+	BytesVerified int64 `json:"bytes_verified"`
+
+	Files []RestoreFileResult `json:"files"`
+}
+
+// add records one entry's outcome and bumps the summary counters.
+func (r *RestoreReport) add(path, result, detail string) {
+	r.Files = append(r.Files, RestoreFileResult{Path: path, Result: result, Detail: detail})
+	switch result {
+	case RestoreFileOK:
+		r.FilesOK++
+	case RestoreFileSkipped:
+		r.FilesSkipped++
+	default:
+		r.FilesFailed++
+	}
+}
+
+// RestoreReport returns the integrity report of the latest restore of
+// backup id, or nil if the backup was never restored.
+func (n *Node) RestoreReport(id string) (*RestoreReport, error) {
+	var r RestoreReport
+	err := n.sec.GetJSON(restoreReportKey(id), &r)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// restoreFailure tags a restoreFile error with its report result so
+// the restore loop can classify it without string matching.
+type restoreFailure struct {
+	result string
+	err    error
+}
+
+func (e *restoreFailure) Error() string { return e.err.Error() }
+
+func (e *restoreFailure) Unwrap() error { return e.err }
+
+// classifyRestoreError maps a restore entry error onto a report result.
+func classifyRestoreError(err error) (result, detail string) {
+	var rf *restoreFailure
+	if errors.As(err, &rf) {
+		return rf.result, rf.err.Error()
+	}
+	return RestoreFileError, err.Error()
+}
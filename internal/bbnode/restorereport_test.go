@@ -0,0 +1,127 @@
+package bbnode
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/hashid"
+)
+
+func TestRestoreReport(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "good.bin", string(make([]byte, 2*chunkSize+50)))
+	writeFile(t, source, "doomed.txt", "this one will lose its chunk")
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	// Lose doomed.txt's only chunk on the sole replica. The file is
+	// smaller than a chunk, so its chunk hash is the file hash.
+	doomedHash, err := hashid.Sum(hashid.AlgSHA256, []byte("this one will lose its chunk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.chunks.Delete(a.Address(), chunkBlobName(backup.ID, doomedHash)); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	err = a.RestoreBackup(ctx, backup.ID, dest, true)
+	if err == nil || !strings.Contains(err.Error(), "restore incomplete") {
+		t.Fatalf("RestoreBackup: %v, want restore incomplete", err)
+	}
+	if got := readFile(t, dest, "good.bin"); len(got) != 2*chunkSize+50 {
+		t.Errorf("good.bin size = %d", len(got))
+	}
+
+	report, err := a.RestoreReport(backup.ID)
+	if err != nil {
+		t.Fatalf("RestoreReport: %v", err)
+	}
+	if report == nil {
+		t.Fatal("no restore report saved")
+	}
+	if report.FilesOK != 1 || report.FilesFailed != 1 || report.FilesSkipped != 0 {
+		t.Errorf("report counters = %d ok, %d failed, %d skipped, want 1/1/0",
+			report.FilesOK, report.FilesFailed, report.FilesSkipped)
+	}
+	if report.BytesVerified != int64(2*chunkSize+50) {
+		t.Errorf("BytesVerified = %d, want %d", report.BytesVerified, 2*chunkSize+50)
+	}
+	found := false
+	for _, f := range report.Files {
+		if f.Path == "doomed.txt" {
+			found = true
+			if f.Result != RestoreFileMissingChunks {
+				t.Errorf("doomed.txt result = %q, want %q", f.Result, RestoreFileMissingChunks)
+			}
+		}
+	}
+	if !found {
+		t.Error("doomed.txt missing from the report")
+	}
+
+	// --report saved the same report as JSON next to the destination.
+	data, err := os.ReadFile(dest + ".restore-report.json")
+	if err != nil {
+		t.Fatalf("read report file: %v", err)
+	}
+	var fileReport RestoreReport
+	if err := json.Unmarshal(data, &fileReport); err != nil {
+		t.Fatalf("parse report file: %v", err)
+	}
+	if fileReport.BackupID != backup.ID || fileReport.FilesFailed != 1 {
+		t.Errorf("report file = %+v", fileReport)
+	}
+
+	// The job record carries the summary counters.
+	jobs, err := a.ListJobs()
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	var restoreJob *Job
+	for i := range jobs {
+		if jobs[i].Kind == "restore" {
+			restoreJob = &jobs[i]
+			break
+		}
+	}
+	if restoreJob == nil {
+		t.Fatal("no restore job recorded")
+	}
+	if restoreJob.RestoredOK != 1 || restoreJob.RestoredFailed != 1 ||
+		restoreJob.VerifiedBytes != int64(2*chunkSize+50) || !restoreJob.WriteReport {
+		t.Errorf("restore job = %+v", restoreJob)
+	}
+
+	// A clean restore of an intact backup overwrites the report.
+	source2 := t.TempDir()
+	writeFile(t, source2, "fine.txt", "all good here")
+	backup2, err := a.CreateBackup(ctx, []string{b.Address()}, source2, BackupOptions{})
+	if err != nil {
+		t.Fatalf("second CreateBackup: %v", err)
+	}
+	dest2 := t.TempDir()
+	if err := a.RestoreBackup(ctx, backup2.ID, dest2, false); err != nil {
+		t.Fatalf("second RestoreBackup: %v", err)
+	}
+	report2, err := a.RestoreReport(backup2.ID)
+	if err != nil || report2 == nil {
+		t.Fatalf("second RestoreReport: %+v, %v", report2, err)
+	}
+	if report2.FilesFailed != 0 || report2.FilesOK != 1 {
+		t.Errorf("clean report = %+v", report2)
+	}
+	if _, err := os.Stat(dest2 + ".restore-report.json"); !os.IsNotExist(err) {
+		t.Errorf("report file written without --report: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package bbnode
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreBackupStream(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "notes.txt", "remember the milk")
+	writeFile(t, source, "sub/big.bin", string(make([]byte, 3*chunkSize+100)))
+	if err := os.Symlink("notes.txt", filepath.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	var first bytes.Buffer
+	if err := a.RestoreBackupStream(ctx, backup.ID, &first); err != nil {
+		t.Fatalf("RestoreBackupStream: %v", err)
+	}
+
+	got := map[string]string{}
+	links := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(first.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("read %s: %v", hdr.Name, err)
+			}
+			got[hdr.Name] = string(data)
+		case tar.TypeSymlink:
+			links[hdr.Name] = hdr.Linkname
+		}
+		if hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("%s carries uid/gid %d/%d, want 0/0", hdr.Name, hdr.Uid, hdr.Gid)
+		}
+	}
+	if got["notes.txt"] != "remember the milk" {
+		t.Errorf("notes.txt = %q", got["notes.txt"])
+	}
+	if len(got["sub/big.bin"]) != 3*chunkSize+100 {
+		t.Errorf("big.bin size = %d", len(got["sub/big.bin"]))
+	}
+	if links["link"] != "notes.txt" {
+		t.Errorf("link -> %q, want notes.txt", links["link"])
+	}
+
+	// The same manifest yields the same bytes, so the archive can be
+	// checksummed.
+	var second bytes.Buffer
+	if err := a.RestoreBackupStream(ctx, backup.ID, &second); err != nil {
+		t.Fatalf("second RestoreBackupStream: %v", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("two streams of the same backup differ")
+	}
+}
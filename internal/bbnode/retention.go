@@ -0,0 +1,311 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Retention defaults. Expired peers' data is held in a grace period
+// before physical deletion, so a lapsed agreement does not instantly
+// destroy a friend's backup.
+const (
+	defaultTrashGraceDays  = 14
+	defaultBackupTrashDays = 14
+	retentionSweepInterval = time.Hour
+)
+
+// retentionConfigKey holds the retention settings in the secstore.
+const retentionConfigKey = "config/retention"
+
+// RetentionConfig are the runtime-configurable retention settings.
+type RetentionConfig struct {
+	// TrashGraceDays is how long an expired peer's data stays in the
+	// trash state before the sweep deletes it.
+	TrashGraceDays int32 `json:"trash_grace_days"`
+	// BackupTrashDays is how long a deleted backup of our own stays
+	// undeletable-from before the sweep purges its chunks from the
+	// replica peers.
+	BackupTrashDays int32 `json:"backup_trash_days"`
+}
+
+// retentionKey holds the trash record of one stored-data owner.
+func retentionKey(onion string) string {
+	return "retention/" + onion
+}
+
+// trashRecord marks an owner whose stored data entered the grace
+// period.
+type trashRecord struct {
+	// ExpiredAt is when the owner's agreement lapsed.
+	ExpiredAt time.Time `json:"expired_at"`
+	// TrashedAt is when the sweep noticed; deletion happens
+	// TrashGraceDays after it.
+	TrashedAt time.Time `json:"trashed_at"`
+	// Warned records that the owner was messaged about the pending
+	// deletion, so an unreachable peer is retried on later sweeps.
+	Warned bool `json:"warned,omitempty"`
+	// Migrated marks data trashed because it moved to another host, not
+	// because an agreement lapsed; an active agreement does not rescue
+	// it, since the agreement now covers the owner's new host.
+	Migrated bool `json:"migrated,omitempty"`
+}
+
+// loadRetentionConfig reads the persisted retention settings, falling
+// back to the defaults. Called from New.
+func (n *Node) loadRetentionConfig() error {
+	n.retentionCfg = RetentionConfig{
+		TrashGraceDays:  defaultTrashGraceDays,
+		BackupTrashDays: defaultBackupTrashDays,
+	}
+	var cfg RetentionConfig
+	err := n.sec.GetJSON(retentionConfigKey, &cfg)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cfg.BackupTrashDays == 0 {
+		// Config stored before backup deletion existed.
+		cfg.BackupTrashDays = defaultBackupTrashDays
+	}
+	n.retentionCfg = cfg
+	return nil
+}
+
+// RetentionConfig returns the current retention settings.
+func (n *Node) RetentionConfig() RetentionConfig {
+	n.retentionMu.Lock()
+	defer n.retentionMu.Unlock()
+	return n.retentionCfg
+}
+
+// SetRetentionConfig validates, persists, and applies new retention
+// settings.
+func (n *Node) SetRetentionConfig(cfg RetentionConfig) error {
+	if cfg.TrashGraceDays <= 0 {
+		return fmt.Errorf("trash grace must be at least one day")
+	}
+	if cfg.BackupTrashDays <= 0 {
+		return fmt.Errorf("backup trash window must be at least one day")
+	}
+	if err := n.sec.PutJSON(retentionConfigKey, &cfg); err != nil {
+		return fmt.Errorf("store retention settings: %w", err)
+	}
+	n.retentionMu.Lock()
+	n.retentionCfg = cfg
+	n.retentionMu.Unlock()
+	return nil
+}
+
+// ownerExpiry returns when the owner's stored data lapses: the expiry
+// of the newest accepted agreement with them. Owners without any
+// agreement have no expiry — they store under the legacy default quota.
+func (n *Node) ownerExpiry(onion string) (time.Time, bool) {
+	if a := n.agreementWith(onion, "active"); a != nil {
+		return a.ExpiresAt(), true
+	}
+	if a := n.agreementWith(onion, "expired"); a != nil {
+		return a.ExpiresAt(), true
+	}
+	return time.Time{}, false
+}
+
+// runRetentionSweep periodically applies the retention policy to stored
+// peer data.
+func (n *Node) runRetentionSweep(stop <-chan struct{}) {
+	for {
+		if err := n.retentionSweep(context.Background()); err != nil {
+			log.Printf("retention sweep: %v", err)
+		}
+		if err := n.backupTrashSweep(context.Background()); err != nil {
+			log.Printf("backup trash sweep: %v", err)
+		}
+		select {
+		case <-time.After(retentionSweepInterval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// retentionSweep walks all stored-data owners once. Owners whose
+// agreement lapsed enter the trash state and are warned over the
+// messaging channel; owners trashed longer than the grace period lose
+// their chunks; owners who renewed are rescued from the trash.
+func (n *Node) retentionSweep(ctx context.Context) error {
+	owners, err := n.chunks.Owners()
+	if err != nil {
+		return err
+	}
+	grace := time.Duration(n.RetentionConfig().TrashGraceDays) * 24 * time.Hour
+	now := time.Now()
+	for _, owner := range owners {
+		var rec trashRecord
+		err := n.sec.GetJSON(retentionKey(owner), &rec)
+		trashed := err == nil
+		if err != nil && !errors.Is(err, secstore.ErrNotFound) {
+			return err
+		}
+		if trashed && rec.Migrated {
+			// Migrated data only awaits the grace deadline; whatever
+			// agreement is active covers the owner's new host, not this
+			// leftover copy.
+			if now.After(rec.TrashedAt.Add(grace)) {
+				if err := n.deleteOwnerData(owner); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if n.agreementWith(owner, "active") != nil {
+			// A renewal rescues trashed data.
+			if trashed {
+				if err := n.sec.Delete(retentionKey(owner)); err != nil {
+					return err
+				}
+				n.auditEvent("peer_data_rescued", map[string]string{"onion": owner})
+			}
+			continue
+		}
+		expiry, ok := n.ownerExpiry(owner)
+		if !ok || now.Before(expiry) {
+			continue
+		}
+		if !trashed {
+			rec = trashRecord{ExpiredAt: expiry, TrashedAt: now}
+			if err := n.sec.PutJSON(retentionKey(owner), &rec); err != nil {
+				return err
+			}
+			n.auditEvent("peer_data_trashed", map[string]string{
+				"onion":      owner,
+				"expired_at": expiry.UTC().Format(time.RFC3339),
+			})
+		}
+		if !rec.Warned {
+			if n.warnOwnerTrashed(ctx, owner, rec.TrashedAt.Add(grace)) == nil {
+				rec.Warned = true
+				if err := n.sec.PutJSON(retentionKey(owner), &rec); err != nil {
+					return err
+				}
+			}
+		}
+		if now.After(rec.TrashedAt.Add(grace)) {
+			if err := n.deleteOwnerData(owner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// warnOwnerTrashed tells the peer their stored data entered the grace
+// period. Best effort: the peer may be offline or no longer registered.
+func (n *Node) warnOwnerTrashed(ctx context.Context, owner string, deleteAt time.Time) error {
+	if _, err := n.findPeer(owner); err != nil {
+		return err
+	}
+	body := fmt.Sprintf(
+		"our storage agreement has expired; the data you store here will be deleted on %s unless the agreement is renewed",
+		deleteAt.UTC().Format("2006-01-02"))
+	return n.SendMessage(ctx, owner, body)
+}
+
+// deleteOwnerData physically removes the owner's chunks after the grace
+// period ran out.
+func (n *Node) deleteOwnerData(owner string) error {
+	names, err := n.chunks.List(owner, "")
+	if err != nil {
+		return err
+	}
+	var bytes int64
+	before := n.chunks.Usage(owner)
+	for _, name := range names {
+		if err := n.chunks.Delete(owner, name); err != nil {
+			return err
+		}
+	}
+	bytes = before - n.chunks.Usage(owner)
+	if err := n.sec.Delete(retentionKey(owner)); err != nil {
+		return err
+	}
+	n.auditEvent("peer_data_deleted", map[string]string{
+		"onion": owner,
+		"blobs": fmt.Sprint(len(names)),
+		"bytes": fmt.Sprint(bytes),
+	})
+	return nil
+}
+
+// Expiration describes when a peer's stored data lapses, for status
+// output.
+type Expiration struct {
+	Onion string
+	Alias string
+	// ExpiresAt is when the agreement covering the data lapses (or
+	// lapsed).
+	ExpiresAt time.Time
+	// InGrace reports that the data already entered the trash state;
+	// DeleteAt is then when the sweep will remove it.
+	InGrace  bool
+	DeleteAt time.Time
+}
+
+// UpcomingExpirations lists stored-data owners whose agreement lapses
+// within the horizon or already lapsed, soonest first.
+func (n *Node) UpcomingExpirations(horizon time.Duration) ([]Expiration, error) {
+	owners, err := n.chunks.Owners()
+	if err != nil {
+		return nil, err
+	}
+	grace := time.Duration(n.RetentionConfig().TrashGraceDays) * 24 * time.Hour
+	now := time.Now()
+	var out []Expiration
+	for _, owner := range owners {
+		expiry, ok := n.ownerExpiry(owner)
+		if !ok || expiry.After(now.Add(horizon)) {
+			continue
+		}
+		e := Expiration{Onion: owner, ExpiresAt: expiry}
+		if p, err := n.findPeer(owner); err == nil {
+			e.Alias = p.Alias
+		}
+		var rec trashRecord
+		if err := n.sec.GetJSON(retentionKey(owner), &rec); err == nil {
+			e.InGrace = true
+			e.DeleteAt = rec.TrashedAt.Add(grace)
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExpiresAt.Before(out[j].ExpiresAt) })
+	return out, nil
+}
+
+// ExtendAgreement proposes a signed renewal of the newest agreement
+// with the peer: same quotas, a fresh term of days days. The peer still
+// has to accept it; once they do, the new agreement supersedes the old
+// one and rescues any trashed data.
+func (n *Node) ExtendAgreement(ctx context.Context, aliasOrOnion string, days int32) (*Agreement, error) {
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return nil, err
+	}
+	base := n.agreementWith(p.Onion, "active")
+	if base == nil {
+		base = n.agreementWith(p.Onion, "expired")
+	}
+	if base == nil {
+		return nil, fmt.Errorf("no agreement with %s to extend; propose one instead", aliasOrOnion)
+	}
+	offered, requested := base.OfferedBytes, base.RequestedBytes
+	if base.Proposer != n.Address() {
+		// The renewal goes out under our signature, so the sides swap.
+		offered, requested = requested, offered
+	}
+	return n.ProposeAgreement(ctx, p.Onion, offered, requested, days)
+}
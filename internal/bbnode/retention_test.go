@@ -0,0 +1,159 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// expireAgreement backdates the stored agreement's acceptance on n so
+// its state flips to expired.
+func expireAgreement(t *testing.T, n *Node, id string, by time.Duration) {
+	t.Helper()
+	var stored Agreement
+	if err := n.sec.GetJSON(agreementKey(id), &stored); err != nil {
+		t.Fatalf("load agreement: %v", err)
+	}
+	stored.AcceptedAt = time.Now().Add(-by)
+	if err := n.sec.PutJSON(agreementKey(id), &stored); err != nil {
+		t.Fatalf("store agreement: %v", err)
+	}
+}
+
+func TestRetentionSweep(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	proposed, err := a.ProposeAgreement(ctx, b.Address(), 1<<20, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("ProposeAgreement: %v", err)
+	}
+	if _, err := b.AcceptAgreement(ctx, proposed.ID); err != nil {
+		t.Fatalf("AcceptAgreement: %v", err)
+	}
+
+	// b stores a chunk on a, then the agreement lapses.
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	if _, err := pb.NewPeerClient(cc).StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("data")}); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	expireAgreement(t, a, proposed.ID, 48*time.Hour)
+
+	// The first sweep trashes the data and warns b, but keeps the chunk.
+	if err := a.retentionSweep(ctx); err != nil {
+		t.Fatalf("retentionSweep: %v", err)
+	}
+	var rec trashRecord
+	if err := a.sec.GetJSON(retentionKey(b.Address()), &rec); err != nil {
+		t.Fatalf("trash record after sweep: %v", err)
+	}
+	if !rec.Warned {
+		t.Error("trash record not marked warned")
+	}
+	if !a.chunks.Has(b.Address(), "c1") {
+		t.Error("chunk deleted before the grace period ran out")
+	}
+	msgs, err := b.loadMessages(a.Address())
+	if err != nil {
+		t.Fatalf("loadMessages: %v", err)
+	}
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Body, "deleted on") {
+		t.Fatalf("warning messages on b: %+v", msgs)
+	}
+
+	// The owner shows up in grace in the expirations list.
+	exps, err := a.UpcomingExpirations(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("UpcomingExpirations: %v", err)
+	}
+	if len(exps) != 1 || exps[0].Onion != b.Address() || !exps[0].InGrace {
+		t.Fatalf("UpcomingExpirations = %+v", exps)
+	}
+
+	// After the grace period the data is deleted for real.
+	rec.TrashedAt = time.Now().Add(-15 * 24 * time.Hour)
+	if err := a.sec.PutJSON(retentionKey(b.Address()), &rec); err != nil {
+		t.Fatalf("store trash record: %v", err)
+	}
+	if err := a.retentionSweep(ctx); err != nil {
+		t.Fatalf("second retentionSweep: %v", err)
+	}
+	if a.chunks.Has(b.Address(), "c1") {
+		t.Error("chunk survived the grace period")
+	}
+	if err := a.sec.GetJSON(retentionKey(b.Address()), &rec); !errors.Is(err, secstore.ErrNotFound) {
+		t.Errorf("trash record after deletion: %v, want not found", err)
+	}
+}
+
+func TestRetentionRenewalRescues(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	proposed, err := a.ProposeAgreement(ctx, b.Address(), 1<<20, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("ProposeAgreement: %v", err)
+	}
+	if _, err := b.AcceptAgreement(ctx, proposed.ID); err != nil {
+		t.Fatalf("AcceptAgreement: %v", err)
+	}
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	if _, err := pb.NewPeerClient(cc).StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("data")}); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	expireAgreement(t, a, proposed.ID, 48*time.Hour)
+	if err := a.retentionSweep(ctx); err != nil {
+		t.Fatalf("retentionSweep: %v", err)
+	}
+
+	// A renewal pulls the data back out of the trash.
+	renewal, err := b.ExtendAgreement(ctx, "alice", 90)
+	if err != nil {
+		t.Fatalf("ExtendAgreement: %v", err)
+	}
+	if renewal.Proposer != b.Address() || renewal.Days != 90 {
+		t.Fatalf("renewal = %+v", renewal)
+	}
+	// b was the acceptor of the original, so the sides swap in the
+	// renewal and the quotas stay as each node experienced them.
+	if renewal.OfferedBytes != 1<<20 || renewal.RequestedBytes != 1<<20 {
+		t.Fatalf("renewal quotas = %d/%d", renewal.OfferedBytes, renewal.RequestedBytes)
+	}
+	if _, err := a.AcceptAgreement(ctx, renewal.ID); err != nil {
+		t.Fatalf("AcceptAgreement renewal: %v", err)
+	}
+	if err := a.retentionSweep(ctx); err != nil {
+		t.Fatalf("retentionSweep after renewal: %v", err)
+	}
+	var rec trashRecord
+	if err := a.sec.GetJSON(retentionKey(b.Address()), &rec); !errors.Is(err, secstore.ErrNotFound) {
+		t.Errorf("trash record after rescue: %v, want not found", err)
+	}
+	if !a.chunks.Has(b.Address(), "c1") {
+		t.Error("chunk lost despite renewal")
+	}
+}
+
+func TestExtendAgreementWithoutBase(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := a.ExtendAgreement(ctx, b.Address(), 90); err == nil ||
+		!strings.Contains(err.Error(), "no agreement") {
+		t.Errorf("ExtendAgreement without base: %v, want no-agreement error", err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package bbnode
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataRegions maps the data-bearing extents of f with SEEK_DATA and
+// SEEK_HOLE, so the holes of a sparse file are never read or uploaded.
+// ok is false when the filesystem does not support the extent map;
+// callers then treat the whole file as data.
+func dataRegions(f *os.File, size int64) (regions []fileRegion, ok bool) {
+	fd := int(f.Fd())
+	var off int64
+	for off < size {
+		data, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			break // nothing but a hole remains
+		} else if err != nil {
+			return nil, false
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, false
+		}
+		regions = append(regions, fileRegion{off: data, length: hole - data})
+		off = hole
+	}
+	return regions, true
+}
@@ -0,0 +1,81 @@
+package bbnode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestBackupSparse backs up a mostly-hole file and checks that the
+// holes are neither uploaded nor materialized on restore. The file name
+// pins this test to Linux, where SEEK_HOLE is available.
+func TestBackupSparse(t *testing.T) {
+	source := t.TempDir()
+	path := filepath.Join(source, "image.raw")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 1 << 20
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(data, size/2); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if regions, ok := dataRegions(f, size); !ok || len(regions) < 2 {
+		f.Close()
+		t.Skipf("filesystem does not expose the extent map (regions %v, ok %v)", regions, ok)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	backup, err := a.CreateBackup(ctx, []string{b.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	if backup.TotalBytes != size {
+		t.Errorf("TotalBytes = %d, want %d", backup.TotalBytes, size)
+	}
+	if backup.UploadedBytes >= size/2 {
+		t.Errorf("uploaded %d bytes of a %d byte sparse file; holes were transferred", backup.UploadedBytes, size)
+	}
+
+	dest := t.TempDir()
+	if err := a.RestoreBackup(ctx, backup.ID, dest, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	restored := filepath.Join(dest, "image.raw")
+	got, err := os.ReadFile(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || string(got) != string(want) {
+		t.Fatalf("restored content differs (%d bytes, want %d)", len(got), len(want))
+	}
+	fi, err := os.Stat(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Blocks*512 >= size {
+		t.Errorf("restored file occupies %d bytes on disk, want sparse (< %d)", st.Blocks*512, size)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package bbnode
+
+import "os"
+
+// dataRegions reports no extent map on platforms without SEEK_HOLE
+// support; callers treat the whole file as data.
+func dataRegions(f *os.File, size int64) ([]fileRegion, bool) {
+	return nil, false
+}
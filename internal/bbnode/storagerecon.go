@@ -0,0 +1,158 @@
+package bbnode
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+// Storage reconciliation defaults. The per-owner usage counters can
+// drift from the blobs actually on disk after a crash or a manual
+// deletion; a periodic rescan corrects them. A drift above
+// largeDriftFraction of an owner's stored bytes is suspicious enough to
+// degrade the node until an operator acknowledges it.
+const (
+	reconcileInterval  = 7 * 24 * time.Hour
+	largeDriftFraction = 0.05
+)
+
+// storageDriftKey holds the unacknowledged large-drift record in the
+// secstore, so the degraded state survives a restart.
+const storageDriftKey = "storage/drift"
+
+// driftRecord is the persisted form of an unacknowledged large drift.
+type driftRecord struct {
+	Detail     string    `json:"detail"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// StorageReconStatus is the outcome of the latest reconciliation run.
+type StorageReconStatus struct {
+	// LastRun is when the last reconciliation finished; zero before the
+	// first run of this session.
+	LastRun time.Time
+	// DriftedOwners and DriftBytes are how many owners' counters were
+	// corrected in the last run and by how many bytes in total.
+	DriftedOwners int
+	DriftBytes    int64
+	// LargeDrift describes an unacknowledged drift above the threshold.
+	// While it is set the daemon reports itself degraded; bbcli storage
+	// ack-drift clears it.
+	LargeDrift string
+	// LargeDriftAt is when the large drift was detected.
+	LargeDriftAt time.Time
+}
+
+// loadStorageDrift reads a persisted unacknowledged drift, so a node
+// restarted while degraded stays degraded. Called from New.
+func (n *Node) loadStorageDrift() error {
+	var rec driftRecord
+	err := n.sec.GetJSON(storageDriftKey, &rec)
+	if errors.Is(err, secstore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	n.reconStatus.LargeDrift = rec.Detail
+	n.reconStatus.LargeDriftAt = rec.DetectedAt
+	return nil
+}
+
+// StorageReconStatus returns the latest reconciliation outcome.
+func (n *Node) StorageReconStatus() StorageReconStatus {
+	n.reconMu.Lock()
+	defer n.reconMu.Unlock()
+	return n.reconStatus
+}
+
+// ReconcileStorage rescans the chunk store, corrects the per-owner
+// usage counters, and reports the outcome. Each corrected counter is
+// logged and counted in the daily report; a drift above
+// largeDriftFraction of an owner's stored bytes additionally degrades
+// the node until AckStorageDrift.
+func (n *Node) ReconcileStorage() (StorageReconStatus, error) {
+	drifts, err := n.chunks.Reconcile()
+	if err != nil {
+		return StorageReconStatus{}, fmt.Errorf("reconcile chunk store: %w", err)
+	}
+	var driftBytes int64
+	var large string
+	for _, d := range drifts {
+		log.Printf("storage reconcile: owner %s tracked %d bytes, found %d on disk",
+			d.Owner, d.Tracked, d.Actual)
+		diff := d.Actual - d.Tracked
+		if diff < 0 {
+			diff = -diff
+		}
+		driftBytes += diff
+		// The drift is measured against the larger of the two totals,
+		// so a counter that lost half its bytes and one that doubled
+		// are judged alike.
+		base := d.Tracked
+		if d.Actual > base {
+			base = d.Actual
+		}
+		if large == "" && float64(diff) > largeDriftFraction*float64(base) {
+			large = fmt.Sprintf("owner %s: tracked %d bytes, found %d on disk",
+				d.Owner, d.Tracked, d.Actual)
+		}
+	}
+	if driftBytes > 0 {
+		n.reportStorageDrift(driftBytes)
+	}
+
+	n.reconMu.Lock()
+	n.reconStatus.LastRun = time.Now()
+	n.reconStatus.DriftedOwners = len(drifts)
+	n.reconStatus.DriftBytes = driftBytes
+	if large != "" && n.reconStatus.LargeDrift == "" {
+		n.reconStatus.LargeDrift = large
+		n.reconStatus.LargeDriftAt = time.Now()
+		rec := driftRecord{Detail: large, DetectedAt: n.reconStatus.LargeDriftAt}
+		if err := n.sec.PutJSON(storageDriftKey, &rec); err != nil {
+			log.Printf("persist storage drift: %v", err)
+		}
+		n.auditEvent("storage_drift", map[string]string{"detail": large})
+	}
+	status := n.reconStatus
+	n.reconMu.Unlock()
+	return status, nil
+}
+
+// AckStorageDrift acknowledges a detected large drift and lifts the
+// degraded state. The counters were already corrected when the drift
+// was found; the acknowledgement only records that an operator has
+// looked.
+func (n *Node) AckStorageDrift() error {
+	n.reconMu.Lock()
+	defer n.reconMu.Unlock()
+	if n.reconStatus.LargeDrift == "" {
+		return fmt.Errorf("no storage drift to acknowledge")
+	}
+	if err := n.sec.Delete(storageDriftKey); err != nil && !errors.Is(err, secstore.ErrNotFound) {
+		return fmt.Errorf("clear storage drift: %w", err)
+	}
+	n.auditEvent("storage_drift_acked", map[string]string{"detail": n.reconStatus.LargeDrift})
+	n.reconStatus.LargeDrift = ""
+	n.reconStatus.LargeDriftAt = time.Time{}
+	return nil
+}
+
+// runStorageReconcile reconciles once at start and then weekly until
+// the node stops. It runs in the background so a big store does not
+// delay Start.
+func (n *Node) runStorageReconcile(stop <-chan struct{}) {
+	for {
+		if _, err := n.ReconcileStorage(); err != nil {
+			log.Printf("storage reconcile: %v", err)
+		}
+		select {
+		case <-time.After(reconcileInterval):
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package bbnode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/starius/barterbackup/internal/chunkstore"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestStorageReconcile(t *testing.T) {
+	network := netmock.New()
+	backend, err := chunkstore.NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	// The node is not started: reconciliation also runs on demand, and
+	// keeping the weekly loop out makes the counter checks below
+	// deterministic.
+	n, err := New("password-a", network, dataDir, WithChunkBackend(backend))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Two owners with primed counters: one loses everything it stored
+	// (a large drift), one loses a blob below the threshold.
+	if err := n.chunks.Put("owner1", "aabb", []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.chunks.Put("owner2", "ccdd", make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.chunks.Put("owner2", "eeff", []byte("xy")); err != nil {
+		t.Fatal(err)
+	}
+	n.chunks.Usage("owner1")
+	n.chunks.Usage("owner2")
+
+	// Corrupt the counters by deleting blobs behind the store's back.
+	if err := backend.Delete("owner1", "aabb"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Delete("owner2", "eeff"); err != nil {
+		t.Fatal(err)
+	}
+
+	sr, err := n.ReconcileStorage()
+	if err != nil {
+		t.Fatalf("ReconcileStorage: %v", err)
+	}
+	if sr.DriftedOwners != 2 || sr.DriftBytes != 12 {
+		t.Errorf("status = %d owners, %d bytes, want 2 owners, 12 bytes",
+			sr.DriftedOwners, sr.DriftBytes)
+	}
+	// owner1 lost 100% of its bytes; owner2 only 2%, below the
+	// threshold, so the large drift names owner1.
+	if !strings.Contains(sr.LargeDrift, "owner1") {
+		t.Errorf("LargeDrift = %q, want it to name owner1", sr.LargeDrift)
+	}
+	if got := n.chunks.Usage("owner1"); got != 0 {
+		t.Errorf("owner1 usage after reconcile = %d, want 0", got)
+	}
+	if got := n.chunks.Usage("owner2"); got != 100 {
+		t.Errorf("owner2 usage after reconcile = %d, want 100", got)
+	}
+
+	// The degraded state survives a restart.
+	n.Stop()
+	n2, err := New("password-a", network, dataDir, WithChunkBackend(backend))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer n2.Stop()
+	if got := n2.StorageReconStatus(); got.LargeDrift == "" {
+		t.Error("large drift lost across restart")
+	}
+
+	// Acknowledging lifts it; a second ack has nothing to do.
+	if err := n2.AckStorageDrift(); err != nil {
+		t.Fatalf("AckStorageDrift: %v", err)
+	}
+	if got := n2.StorageReconStatus(); got.LargeDrift != "" {
+		t.Errorf("LargeDrift after ack = %q, want empty", got.LargeDrift)
+	}
+	if err := n2.AckStorageDrift(); err == nil {
+		t.Error("second AckStorageDrift succeeded")
+	}
+}
@@ -0,0 +1,202 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/cdc"
+	"github.com/starius/barterbackup/internal/hashid"
+	"github.com/starius/barterbackup/internal/manifest"
+	manifestpb "github.com/starius/barterbackup/internal/manifest/pb"
+)
+
+// CreateStreamBackup backs up a single stream read from r — typically a
+// database dump piped into the CLI — as a backup holding one logical
+// file named name. Chunks are cut, sealed, and uploaded as the stream
+// arrives; nothing is spooled locally, so the total size is only known
+// at EOF and an empty stream is valid, yielding a tiny manifest.
+// Stream backups are never incremental and cannot be resumed — the
+// stdin that fed them is gone — so an aborted run just fails its job,
+// leaving any uploaded chunks for garbage collection. Restore with
+// RestoreBackupStream, or into a directory where the stream comes back
+// as one file.
+func (n *Node) CreateStreamBackup(ctx context.Context, peerSpecs []string, name string, r io.Reader) (*Backup, error) {
+	if name == "" || strings.Contains(name, "/") || !safeRelPath(name) {
+		return nil, fmt.Errorf("invalid stream name %q", name)
+	}
+	job := &Job{Kind: "backup-stream", Peers: peerSpecs, SourceDir: "-", BackupID: newBackupID()}
+	var b *Backup
+	err := n.runJob(ctx, job, func(ctx context.Context) error {
+		var err error
+		b, err = n.createStreamBackup(ctx, job, name, r)
+		return err
+	})
+	return b, err
+}
+
+func (n *Node) createStreamBackup(ctx context.Context, job *Job, name string, r io.Reader) (*Backup, error) {
+	onions, err := n.resolvePeerSpecs(job.Peers)
+	if err != nil {
+		return nil, err
+	}
+	// Content-defined chunking with the defaults: it cuts as it reads,
+	// so unbounded input needs no size up front, and a re-run of a
+	// slightly changed dump dedups against the chunks already on the
+	// peer.
+	chunker, params := chunkerCDC, cdc.DefaultParams
+	hashAlg, hashName, err := hashAlgFor("", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	id := job.BackupID
+	key, err := n.backupSealKey(id)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+
+	b := &Backup{
+		ID:          id,
+		Peers:       onions,
+		Replication: make(map[string]string),
+		SourceDir:   "-",
+		CreatedAt:   time.Now(),
+	}
+
+	var targets []*target
+	for _, onion := range onions {
+		cc, err := n.getConn(ctx, onion)
+		if err != nil {
+			b.Replication[onion] = fmt.Sprintf("unreachable: %v", err)
+			continue
+		}
+		targets = append(targets, &target{onion: onion, client: pb.NewPeerClient(cc)})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no backup target peer is reachable")
+	}
+
+	hdr := &manifestpb.Header{
+		BackupId:      id,
+		CreatedAtUnix: b.CreatedAt.Unix(),
+		SourceDir:     "-",
+		Peers:         onions,
+		Chunker:       chunker,
+		HashAlg:       hashName,
+		CdcMin:        int64(params.Min),
+		CdcAvg:        int64(params.Avg),
+		CdcMax:        int64(params.Max),
+	}
+	var mbuf bytes.Buffer
+	mw, err := manifest.NewWriter(&mbuf, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	up := &uploader{node: n, targets: targets, key: key, backupID: id, jobID: job.ID, chunker: chunker, params: params, hashAlg: hashAlg}
+	e := &manifestpb.FileEntry{
+		Path:      name,
+		Mode:      uint32(0o600),
+		MtimeUnix: b.CreatedAt.Unix(),
+		MtimeNsec: int32(b.CreatedAt.Nanosecond()),
+	}
+	if err := up.uploadStream(ctx, r, e); err != nil {
+		return nil, fmt.Errorf("upload stream: %w", err)
+	}
+	b.TotalBytes = e.Size
+	b.FileCount = 1
+	b.ChunkCount = len(e.Chunks)
+	if err := mw.Add(e); err != nil {
+		return nil, err
+	}
+	if err := mw.Flush(); err != nil {
+		return nil, err
+	}
+	b.UploadedBytes = up.uploadedBytes
+
+	if err := n.sec.Put(manifestRecordKey(id), mbuf.Bytes()); err != nil {
+		return nil, fmt.Errorf("store manifest: %w", err)
+	}
+	complete := 0
+	for _, t := range targets {
+		if t.err == nil {
+			t.err = pushManifest(ctx, t.client, key, id, mbuf.Bytes())
+		}
+		if t.err != nil {
+			b.Replication[t.onion] = fmt.Sprintf("failed: %v", t.err)
+		} else {
+			b.Replication[t.onion] = "complete"
+			n.reportStoredAt(t.onion, mbuf.Len())
+			complete++
+		}
+	}
+	if complete == 0 {
+		return nil, fmt.Errorf("backup reached no peer completely: %v", b.Replication)
+	}
+	if err := n.sec.PutJSON(backupRecordKey(id), b); err != nil {
+		return nil, fmt.Errorf("store backup record: %w", err)
+	}
+	return b, nil
+}
+
+// uploadStream seals and replicates the chunks of one unbounded
+// stream. Unlike uploadFile there is no seeking and no sparse-region
+// scan: chunks follow each other from offset zero and EOF ends the
+// last one.
+func (u *uploader) uploadStream(ctx context.Context, r io.Reader, e *manifestpb.FileEntry) error {
+	if u.seen == nil {
+		u.seen = make(map[string]*manifestpb.ChunkRef)
+	}
+	u.node.updateJobProgress(u.jobID, func(p *JobProgress) { p.CurrentFile = e.Path })
+	fileHash := sha256.New()
+	var sp splitter
+	var err error
+	if u.chunker == chunkerCDC {
+		sp, err = cdc.NewChunker(r, u.params)
+		if err != nil {
+			return err
+		}
+	} else {
+		sp = &fixedSplitter{r: r, buf: make([]byte, chunkSize)}
+	}
+	var offset int64
+	for {
+		block, err := sp.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		fileHash.Write(block)
+		hash, err := hashid.Sum(u.hashAlg, block)
+		if err != nil {
+			return err
+		}
+		if ref, ok := u.seen[hash]; ok {
+			e.Chunks = append(e.Chunks, &manifestpb.ChunkRef{
+				Hash: hash, Offset: offset, Size: int64(len(block)), Index: ref.Index,
+			})
+			u.node.updateJobProgress(u.jobID, func(p *JobProgress) { p.BytesDone += int64(len(block)) })
+		} else {
+			index := u.nextIndex
+			u.nextIndex++
+			if err := u.sendChunk(ctx, hash, block, index); err != nil {
+				return err
+			}
+			ref := &manifestpb.ChunkRef{Hash: hash, Offset: offset, Size: int64(len(block)), Index: index}
+			u.seen[hash] = ref
+			e.Chunks = append(e.Chunks, ref)
+		}
+		offset += int64(len(block))
+	}
+	e.Size = offset
+	e.FileHash = fileHash.Sum(nil)
+	return nil
+}
@@ -0,0 +1,103 @@
+package bbnode
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestCreateStreamBackup(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	content := make([]byte, 50<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	backup, err := a.CreateStreamBackup(ctx, []string{b.Address()}, "db.sql", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("CreateStreamBackup: %v", err)
+	}
+	if backup.FileCount != 1 {
+		t.Errorf("FileCount = %d, want 1", backup.FileCount)
+	}
+	if backup.TotalBytes != int64(len(content)) {
+		t.Errorf("TotalBytes = %d, want %d", backup.TotalBytes, len(content))
+	}
+	if backup.ChunkCount < 2 {
+		t.Errorf("ChunkCount = %d, want several for %d bytes", backup.ChunkCount, len(content))
+	}
+	if backup.SourceDir != "-" {
+		t.Errorf("SourceDir = %q, want -", backup.SourceDir)
+	}
+
+	got := streamedFile(t, a, backup.ID, "db.sql")
+	if !bytes.Equal(got, content) {
+		t.Error("restored stream differs from the input")
+	}
+
+	// A stream backup cannot be resumed: its stdin is gone.
+	if err := a.relaunchJob(&Job{ID: "j", Kind: "backup-stream"}); err == nil {
+		t.Error("relaunchJob accepted a backup-stream job")
+	}
+}
+
+func TestCreateStreamBackupEmpty(t *testing.T) {
+	a, b := startPairedNodes(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	backup, err := a.CreateStreamBackup(ctx, []string{b.Address()}, "empty.bin", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("CreateStreamBackup of empty stream: %v", err)
+	}
+	if backup.FileCount != 1 || backup.TotalBytes != 0 {
+		t.Errorf("FileCount/TotalBytes = %d/%d, want 1/0", backup.FileCount, backup.TotalBytes)
+	}
+	if got := streamedFile(t, a, backup.ID, "empty.bin"); len(got) != 0 {
+		t.Errorf("restored %d bytes from an empty stream", len(got))
+	}
+}
+
+func TestCreateStreamBackupBadName(t *testing.T) {
+	a, _ := startPairedNodes(t)
+	for _, name := range []string{"", "a/b", ".."} {
+		if _, err := a.CreateStreamBackup(context.Background(), nil, name, bytes.NewReader(nil)); err == nil {
+			t.Errorf("CreateStreamBackup accepted name %q", name)
+		}
+	}
+}
+
+// streamedFile restores the backup as a tar stream and returns the
+// content of the entry with the given name.
+func streamedFile(t *testing.T, n *Node, id, name string) []byte {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var buf bytes.Buffer
+	if err := n.RestoreBackupStream(ctx, id, &buf); err != nil {
+		t.Fatalf("RestoreBackupStream: %v", err)
+	}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		if hdr.Name == name {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("read %s: %v", name, err)
+			}
+			return data
+		}
+	}
+	t.Fatalf("entry %s not found in stream", name)
+	return nil
+}
@@ -0,0 +1,109 @@
+package bbnode
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultPeerStreamLimit is how many RPCs one peer may have in flight at
+// once, so a single peer opening many chunk fetches cannot starve the
+// others. Peers can be given a different limit via SetPeerStreamLimit.
+const defaultPeerStreamLimit = 8
+
+// serverMaxConcurrentStreams is the default transport-level cap on
+// concurrent streams per inbound connection, wired into
+// grpc.MaxConcurrentStreams as a backstop behind the per-peer
+// accounting. WithServerConnLimits can change it.
+const serverMaxConcurrentStreams = 128
+
+// serverStreamWindow and serverConnWindow are the HTTP/2 flow-control
+// windows for inbound connections. They bound how much a slow reader
+// can make the server buffer: at most serverStreamWindow bytes per
+// stream and serverConnWindow bytes across all streams on one
+// connection, regardless of how large the blobs being streamed are.
+const (
+	serverStreamWindow = 64 << 10
+	serverConnWindow   = 256 << 10
+)
+
+// streamLimiter counts in-flight RPCs per calling peer. Callers must
+// release with defer so the count drops even when a handler panics or
+// the client vanishes mid-stream.
+type streamLimiter struct {
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newStreamLimiter() *streamLimiter {
+	return &streamLimiter{active: make(map[string]int)}
+}
+
+// acquire admits one RPC from onion under limit, or fails with
+// ResourceExhausted.
+func (l *streamLimiter) acquire(onion string, limit int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[onion] >= limit {
+		return status.Errorf(codes.ResourceExhausted, "peer %s has %d RPCs in flight, limit %d", onion, l.active[onion], limit)
+	}
+	l.active[onion]++
+	return nil
+}
+
+// release returns one admitted RPC slot for onion.
+func (l *streamLimiter) release(onion string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[onion] <= 1 {
+		delete(l.active, onion)
+	} else {
+		l.active[onion]--
+	}
+}
+
+// counts returns a copy of the in-flight RPC counts per peer.
+func (l *streamLimiter) counts() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]int, len(l.active))
+	for onion, c := range l.active {
+		out[onion] = c
+	}
+	return out
+}
+
+// peerStreamLimit returns the in-flight RPC limit for onion: the peer's
+// own override if set, otherwise the node-wide default.
+func (n *Node) peerStreamLimit(onion string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if p, ok := n.peers[onion]; ok && p.StreamLimit > 0 {
+		return p.StreamLimit
+	}
+	return n.streamLimit
+}
+
+// SetPeerStreamLimit overrides the in-flight RPC limit for one peer; a
+// zero limit restores the node-wide default.
+func (n *Node) SetPeerStreamLimit(aliasOrOnion string, limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("negative stream limit %d", limit)
+	}
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p.StreamLimit = limit
+	return n.savePeersLocked()
+}
+
+// ActiveStreams returns the current in-flight RPC count per peer onion
+// address.
+func (n *Node) ActiveStreams() map[string]int {
+	return n.limiter.counts()
+}
@@ -0,0 +1,99 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	l := newStreamLimiter()
+	if err := l.acquire("x", 2); err != nil {
+		t.Fatalf("acquire 1: %v", err)
+	}
+	if err := l.acquire("x", 2); err != nil {
+		t.Fatalf("acquire 2: %v", err)
+	}
+	err := l.acquire("x", 2)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("acquire over limit: %v, want ResourceExhausted", err)
+	}
+	// Other peers have their own budget.
+	if err := l.acquire("y", 2); err != nil {
+		t.Fatalf("acquire for other peer: %v", err)
+	}
+	l.release("x")
+	if err := l.acquire("x", 2); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	counts := l.counts()
+	if counts["x"] != 2 || counts["y"] != 1 {
+		t.Errorf("counts = %v, want x:2 y:1", counts)
+	}
+}
+
+func TestPeerStreamLimitEnforced(t *testing.T) {
+	network := netmock.New()
+	a, err := New("password-a", network, t.TempDir(), WithPeerStreamLimit(1))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { a.Stop() })
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+
+	// An open manifest stream occupies b's only slot on a.
+	stream, err := pb.NewPeerClient(cc).StoreManifest(ctx)
+	if err != nil {
+		t.Fatalf("StoreManifest: %v", err)
+	}
+	if err := stream.Send(&pb.StoreManifestRequest{BackupId: "held", Data: []byte("x")}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	waitActive := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for a.ActiveStreams()[b.Address()] != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("ActiveStreams = %v, want %d for %s", a.ActiveStreams(), want, b.Address())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitActive(1)
+
+	err = b.Ping(ctx, a.Address(), []byte("hi"))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Ping while slot is held: %v, want ResourceExhausted", err)
+	}
+
+	// Finishing the stream frees the slot.
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatalf("CloseAndRecv: %v", err)
+	}
+	waitActive(0)
+	if err := b.Ping(ctx, a.Address(), []byte("hi")); err != nil {
+		t.Fatalf("Ping after release: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package bbnode
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// ticketRotateInterval controls how often the session ticket keys are
+// re-derived. Keys are deterministic per epoch so a daemon restart does
+// not invalidate outstanding tickets.
+const (
+	ticketRotateInterval = time.Hour
+	ticketEpochLength    = 24 * time.Hour
+)
+
+// selfSignedEd25519Cert builds a throwaway self-signed certificate for the
+// onion identity key. Peers never check the chain, only that the leaf key
+// matches the expected onion address.
+func selfSignedEd25519Cert(key ed25519.PrivateKey) (tls.Certificate, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "barterbackup"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// serverTLSConfig builds the TLS config for the onion listener. Every
+// client must present an Ed25519 certificate; authorization against the
+// peer registry happens per-RPC in the auth interceptor, where the caller
+// identity is derived from the certificate key. Session tickets are
+// enabled with keys derived from the master secret, so resumption
+// survives restarts. The client identity check runs in VerifyConnection,
+// which the TLS stack invokes for resumed sessions too, so resumption
+// does not bypass it.
+func (n *Node) serverTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{n.cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS13,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("no client certificate")
+			}
+			if _, ok := cs.PeerCertificates[0].PublicKey.(ed25519.PublicKey); !ok {
+				return fmt.Errorf("client certificate key is not Ed25519")
+			}
+			return nil
+		},
+	}
+	// The gRPC credentials clone the config once; serving from the live
+	// one via GetConfigForClient keeps ticket key rotation effective.
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return cfg, nil
+	}
+	if err := n.setTicketKeys(cfg, time.Now()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// setTicketKeys installs the ticket keys for the epoch containing now and
+// the previous epoch, so tickets issued shortly before rotation stay
+// valid.
+func (n *Node) setTicketKeys(cfg *tls.Config, now time.Time) error {
+	epoch := uint64(now.Unix()) / uint64(ticketEpochLength/time.Second)
+	cur, err := n.ticketKey(epoch)
+	if err != nil {
+		return err
+	}
+	prev, err := n.ticketKey(epoch - 1)
+	if err != nil {
+		return err
+	}
+	cfg.SetSessionTicketKeys([][32]byte{cur, prev})
+	return nil
+}
+
+// ticketKey derives the session ticket key for an epoch from the master
+// secret.
+func (n *Node) ticketKey(epoch uint64) ([32]byte, error) {
+	var out [32]byte
+	master, err := n.master()
+	if err != nil {
+		return out, err
+	}
+	var e [8]byte
+	binary.BigEndian.PutUint64(e[:], epoch)
+	raw, err := keys.Expand(master, "barterbackup/ticket/v1/"+string(e[:]), 32)
+	if err != nil {
+		return out, err
+	}
+	copy(out[:], raw)
+	return out, nil
+}
+
+// rotateTicketKeys re-derives the server ticket keys periodically until
+// the stop channel closes.
+func (n *Node) rotateTicketKeys(cfg *tls.Config, stop chan struct{}) {
+	t := time.NewTicker(ticketRotateInterval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			// Derivation can only fail on a broken master secret,
+			// which New has already validated.
+			n.setTicketKeys(cfg, now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// clientTLSConfig builds the TLS config for dialing addr, pinning the
+// server certificate key to the onion address. The check runs in
+// VerifyConnection so it also covers resumed sessions.
+func (n *Node) clientTLSConfig(addr string) *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{n.cert},
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true, // identity is pinned in VerifyConnection
+		ClientSessionCache: n.sessionCache,
+		ServerName:         "barterbackup",
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("no server certificate")
+			}
+			pub, ok := cs.PeerCertificates[0].PublicKey.(ed25519.PublicKey)
+			if !ok {
+				return fmt.Errorf("server certificate key is not Ed25519")
+			}
+			if got := keys.OnionAddress(pub); got != addr {
+				return fmt.Errorf("server identity mismatch: certificate derives %s, want %s", got, addr)
+			}
+			return nil
+		},
+	}
+}
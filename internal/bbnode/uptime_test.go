@@ -0,0 +1,51 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestNodeUptime(t *testing.T) {
+	n, err := New("uptime-password", netmock.New(), t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !n.StartedAt().IsZero() || n.Uptime() != 0 {
+		t.Fatal("uptime clock running before Start")
+	}
+
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	first := n.StartedAt()
+	if first.IsZero() {
+		t.Fatal("StartedAt zero after Start")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n.Uptime() <= 0 {
+		t.Errorf("Uptime = %v after Start, want > 0", n.Uptime())
+	}
+
+	// Stop resets the clock, so a re-unlock starts it fresh.
+	if err := n.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !n.StartedAt().IsZero() || n.Uptime() != 0 {
+		t.Error("uptime clock still running after Stop")
+	}
+
+	n2, err := New("uptime-password", netmock.New(), t.TempDir())
+	if err != nil {
+		t.Fatalf("New after Stop: %v", err)
+	}
+	if err := n2.Start(context.Background()); err != nil {
+		t.Fatalf("Start after Stop: %v", err)
+	}
+	defer n2.Stop()
+	if n2.StartedAt().Before(first) {
+		t.Errorf("restart StartedAt %v is before first start %v", n2.StartedAt(), first)
+	}
+}
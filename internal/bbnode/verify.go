@@ -0,0 +1,317 @@
+package bbnode
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/chunkcrypto"
+)
+
+// defaultVerifySamplePercent is how much of the backup's chunks a
+// verify run fetches back and authenticates when no sample size was
+// asked for. Presence of every blob is always checked; the sample is
+// about catching a peer that answers HasChunks but serves garbage.
+const defaultVerifySamplePercent = 10
+
+// VerifyPeerResult is the verification outcome for one replica peer.
+type VerifyPeerResult struct {
+	Onion string
+	// Error is set when the peer could not be checked at all, e.g. it
+	// was unreachable.
+	Error string
+	// Checked is how many blobs the peer was asked about, including the
+	// manifest blob.
+	Checked int
+	// Missing lists blob names the peer lacks.
+	Missing []string
+	// Sampled is how many blobs were fetched back; Failed lists the
+	// ones that did not authenticate.
+	Sampled int
+	Failed  []string
+	// ManifestOK reports whether the peer's encrypted manifest copy
+	// decrypts to exactly the local manifest; ManifestError says what
+	// went wrong otherwise.
+	ManifestOK    bool
+	ManifestError string
+	// Repaired and Unrepaired report the repair run triggered for this
+	// replica, when one was requested.
+	Repaired   int
+	Unrepaired []string
+}
+
+// clean reports whether the replica passed every check.
+func (r *VerifyPeerResult) clean() bool {
+	return r.Error == "" && len(r.Missing) == 0 && len(r.Failed) == 0 && r.ManifestOK
+}
+
+// VerifyResult summarizes a verify run across all replica peers.
+type VerifyResult struct {
+	BackupID string
+	// SamplePercent and Seed pin the chunk sample; re-running with the
+	// same seed samples the same chunks, so findings are reproducible.
+	SamplePercent int
+	Seed          int64
+	Peers         []VerifyPeerResult
+	// VerifiedAt is set when the run was fully clean and the backup's
+	// last-verified timestamp was updated.
+	VerifiedAt time.Time
+}
+
+// VerifyBackup checks the backup end-to-end on every replica peer
+// without restoring it: each blob's presence via HasChunks, the
+// authenticity of a deterministic sample of chunks fetched back and
+// opened, and that the remote encrypted manifest copy matches the local
+// one. The run is registered as a job, so bbcli job pause/resume/cancel
+// apply to it. A fully clean run updates the backup's last-verified
+// timestamp.
+//
+// samplePercent chooses how much of the chunk set is fetched back; zero
+// means the default, 100 every chunk. A zero seed picks a random one;
+// the seed used is recorded in the job and the result. With repair set,
+// each replica that failed verification gets the ordinary repair flow
+// run against it afterwards, as its own job; blobs that failed
+// authentication are deleted on the peer first so the repair re-uploads
+// them.
+func (n *Node) VerifyBackup(ctx context.Context, id string, samplePercent int, seed int64, repair bool) (*VerifyResult, error) {
+	if samplePercent <= 0 {
+		samplePercent = defaultVerifySamplePercent
+	} else if samplePercent > 100 {
+		samplePercent = 100
+	}
+	for seed == 0 {
+		var b [8]byte
+		rand.Read(b[:])
+		seed = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	job := &Job{Kind: "verify", BackupID: id, SamplePercent: samplePercent, SampleSeed: seed}
+	var res *VerifyResult
+	err := n.runJob(ctx, job, func(ctx context.Context) error {
+		var err error
+		res, err = n.verifyBackup(ctx, job)
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+	if repair {
+		for i := range res.Peers {
+			pr := &res.Peers[i]
+			if pr.clean() || pr.Error != "" {
+				continue
+			}
+			// Corrupt blobs still answer HasChunk, so repair would skip
+			// them; delete them first so they count as missing. The
+			// manifest copy is treated the same when it did not match.
+			doomed := append([]string(nil), pr.Failed...)
+			if !pr.ManifestOK {
+				doomed = append(doomed, manifestBlobPrefix+id)
+			}
+			if len(doomed) > 0 {
+				if err := n.deletePeerBlobs(ctx, pr.Onion, doomed); err != nil {
+					return res, err
+				}
+			}
+			rr, err := n.RepairBackup(ctx, id, pr.Onion)
+			if err != nil {
+				return res, fmt.Errorf("repair %s after verification: %w", pr.Onion, err)
+			}
+			pr.Repaired = rr.Repaired
+			pr.Unrepaired = rr.Unrepaired
+		}
+	}
+	return res, nil
+}
+
+func (n *Node) verifyBackup(ctx context.Context, job *Job) (*VerifyResult, error) {
+	id := job.BackupID
+	var b Backup
+	if err := n.sec.GetJSON(backupRecordKey(id), &b); err != nil {
+		return nil, fmt.Errorf("unknown backup %s: %w", id, err)
+	}
+	sources, err := n.chunkSources(id)
+	if err != nil {
+		return nil, err
+	}
+	localManifest, err := n.sec.Get(manifestRecordKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("load manifest: %w", err)
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := &VerifyResult{BackupID: id, SamplePercent: job.SamplePercent, Seed: job.SampleSeed}
+	// Per peer: every chunk blob plus the manifest blob.
+	n.updateJobProgress(job.ID, func(p *JobProgress) {
+		p.ChunksTotal = int64(len(b.Peers)) * int64(len(names)+1)
+	})
+	for _, onion := range b.Peers {
+		if err := checkpoint(ctx); err != nil {
+			return nil, err
+		}
+		pr := n.verifyReplica(ctx, job, &b, onion, names, sources, localManifest)
+		res.Peers = append(res.Peers, *pr)
+	}
+
+	clean := true
+	for i := range res.Peers {
+		if !res.Peers[i].clean() {
+			clean = false
+		}
+	}
+	if clean {
+		b.LastVerifiedAt = time.Now()
+		if err := n.sec.PutJSON(backupRecordKey(id), &b); err != nil {
+			return res, fmt.Errorf("store backup record: %w", err)
+		}
+		res.VerifiedAt = b.LastVerifiedAt
+	}
+	return res, nil
+}
+
+// verifyReplica runs the three checks against one replica. Problems
+// with the peer are findings recorded in the result, not errors: a dead
+// replica must not keep the others from being verified.
+func (n *Node) verifyReplica(ctx context.Context, job *Job, b *Backup, onion string, names []string, sources map[string]*chunkSource, localManifest []byte) *VerifyPeerResult {
+	pr := &VerifyPeerResult{Onion: onion}
+	cc, err := n.getConn(ctx, onion)
+	if err != nil {
+		pr.Error = err.Error()
+		return pr
+	}
+	client := pb.NewPeerClient(cc)
+
+	missing, err := n.CheckChunks(ctx, onion, SliceChunkIter(names))
+	if err != nil {
+		pr.Error = err.Error()
+		return pr
+	}
+	missingSet := make(map[string]bool)
+	for {
+		name, ok := missing.Next()
+		if !ok {
+			break
+		}
+		missingSet[name] = true
+		pr.Missing = append(pr.Missing, name)
+	}
+	if err := missing.Err(); err != nil {
+		pr.Error = err.Error()
+		return pr
+	}
+	pr.Checked = len(names)
+	n.updateJobProgress(job.ID, func(p *JobProgress) { p.ChunksDone += int64(len(names)) })
+
+	for _, name := range names {
+		if missingSet[name] || !sampleChunk(job.SampleSeed, name, job.SamplePercent) {
+			continue
+		}
+		if err := checkpoint(ctx); err != nil {
+			pr.Error = err.Error()
+			return pr
+		}
+		pr.Sampled++
+		src := sources[name]
+		n.updateJobProgress(job.ID, func(p *JobProgress) { p.CurrentFile = src.path })
+		if err := n.proveChunk(ctx, client, onion, name, src); err != nil {
+			pr.Failed = append(pr.Failed, name)
+			n.reportPeerAudit(onion, false)
+			continue
+		}
+		n.reportPeerAudit(onion, true)
+	}
+
+	pr.Checked++
+	if err := n.compareRemoteManifest(ctx, client, b.ID, localManifest); err != nil {
+		pr.ManifestError = err.Error()
+	} else {
+		pr.ManifestOK = true
+	}
+	n.updateJobProgress(job.ID, func(p *JobProgress) { p.ChunksDone++ })
+	return pr
+}
+
+// proveChunk fetches one chunk envelope back from the peer and
+// authenticates it: a valid AEAD tag under the backup key with the
+// expected chunk index proves the peer stores the genuine sealed data.
+func (n *Node) proveChunk(ctx context.Context, client pb.PeerClient, onion, name string, src *chunkSource) error {
+	env, err := n.fetchChunkData(ctx, client, onion, name)
+	if err != nil {
+		return err
+	}
+	key, err := n.backupSealKey(src.sealerID)
+	if err != nil {
+		return err
+	}
+	defer key.Zero()
+	if _, index, err := chunkcrypto.Open(env, key); err != nil {
+		return err
+	} else if index != src.index {
+		return fmt.Errorf("chunk %s sealed under index %d, want %d", name, index, src.index)
+	}
+	return nil
+}
+
+// compareRemoteManifest fetches the peer's encrypted manifest copy,
+// authenticates it, and checks it decrypts to exactly the local
+// manifest.
+func (n *Node) compareRemoteManifest(ctx context.Context, client pb.PeerClient, id string, local []byte) error {
+	key, err := n.backupSealKey(id)
+	if err != nil {
+		return err
+	}
+	defer key.Zero()
+	stream, err := client.FetchManifest(ctx, &pb.FetchManifestRequest{BackupId: id})
+	if err != nil {
+		return fmt.Errorf("fetch manifest: %w", err)
+	}
+	var env []byte
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("receive manifest frame: %w", err)
+		}
+		env = append(env, frame.Data...)
+		if len(env) > maxManifestBlob {
+			return fmt.Errorf("manifest exceeds %d bytes", maxManifestBlob)
+		}
+	}
+	data, index, err := chunkcrypto.Open(env, key)
+	if err != nil {
+		return fmt.Errorf("authenticate manifest: %w", err)
+	}
+	if index != uint64(manifestEnvelopeIndex) {
+		return fmt.Errorf("manifest sealed under chunk index %d", index)
+	}
+	if !bytes.Equal(data, local) {
+		return fmt.Errorf("remote manifest copy differs from the local one")
+	}
+	return nil
+}
+
+// sampleChunk decides deterministically whether a verify run with the
+// given seed fetches the named chunk back. Every (seed, name) pair
+// always lands on the same side, so a re-run with a recorded seed
+// samples exactly the same chunks.
+func sampleChunk(seed int64, name string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(seed))
+	sum := sha256.Sum256(append(buf[:], name...))
+	return binary.BigEndian.Uint64(sum[:8]) < uint64(percent)*(math.MaxUint64/100)
+}
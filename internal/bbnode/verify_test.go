@@ -0,0 +1,167 @@
+package bbnode
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestVerifyBackup(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	c := startTestNode(t, network, "password-c")
+	for _, peer := range []*Node{b, c} {
+		if err := a.AddPeer(peer.Address(), ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := peer.AddPeer(a.Address(), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	source := t.TempDir()
+	writeFile(t, source, "data.bin", string(make([]byte, 2*chunkSize+50)))
+	backup, err := a.CreateBackup(ctx, []string{b.Address(), c.Address()}, source, BackupOptions{})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	res, err := a.VerifyBackup(ctx, backup.ID, 100, 0, false)
+	if err != nil {
+		t.Fatalf("VerifyBackup: %v", err)
+	}
+	if res.VerifiedAt.IsZero() {
+		t.Errorf("clean run did not set VerifiedAt: %+v", res)
+	}
+	if len(res.Peers) != 2 {
+		t.Fatalf("verified %d peers, want 2", len(res.Peers))
+	}
+	for _, pr := range res.Peers {
+		if pr.Error != "" || len(pr.Missing) != 0 || len(pr.Failed) != 0 || !pr.ManifestOK {
+			t.Errorf("replica %s not clean: %+v", pr.Onion, pr)
+		}
+		if pr.Sampled != pr.Checked-1 {
+			t.Errorf("replica %s: sampled %d of %d blobs at 100%%", pr.Onion, pr.Sampled, pr.Checked-1)
+		}
+	}
+	list, err := a.ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups: %v", err)
+	}
+	for _, rec := range list {
+		if rec.ID == backup.ID && rec.LastVerifiedAt.IsZero() {
+			t.Error("LastVerifiedAt not persisted")
+		}
+	}
+
+	// Damage b: lose one chunk, corrupt another, and corrupt the
+	// manifest copy on c.
+	names, err := b.chunks.List(a.Address(), "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var chunkNames []string
+	for _, name := range names {
+		if name != manifestBlobPrefix+backup.ID {
+			chunkNames = append(chunkNames, name)
+		}
+	}
+	if len(chunkNames) < 2 {
+		t.Fatalf("only %d chunk blobs on b", len(chunkNames))
+	}
+	if err := b.chunks.Delete(a.Address(), chunkNames[0]); err != nil {
+		t.Fatal(err)
+	}
+	// Put keeps an existing blob, so corruption needs a delete first.
+	if err := b.chunks.Delete(a.Address(), chunkNames[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.chunks.Put(a.Address(), chunkNames[1], []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.chunks.Delete(a.Address(), manifestBlobPrefix+backup.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.chunks.Put(a.Address(), manifestBlobPrefix+backup.ID, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = a.VerifyBackup(ctx, backup.ID, 100, 0, false)
+	if err != nil {
+		t.Fatalf("VerifyBackup damaged: %v", err)
+	}
+	if !res.VerifiedAt.IsZero() {
+		t.Error("damaged run set VerifiedAt")
+	}
+	for _, pr := range res.Peers {
+		switch pr.Onion {
+		case b.Address():
+			if len(pr.Missing) != 1 || pr.Missing[0] != chunkNames[0] {
+				t.Errorf("Missing on b = %v, want [%s]", pr.Missing, chunkNames[0])
+			}
+			if len(pr.Failed) != 1 || pr.Failed[0] != chunkNames[1] {
+				t.Errorf("Failed on b = %v, want [%s]", pr.Failed, chunkNames[1])
+			}
+			if !pr.ManifestOK {
+				t.Errorf("manifest on b: %s", pr.ManifestError)
+			}
+		case c.Address():
+			if pr.ManifestOK {
+				t.Error("corrupt manifest on c not detected")
+			}
+			if len(pr.Missing) != 0 || len(pr.Failed) != 0 {
+				t.Errorf("replica c chunks: %+v", pr)
+			}
+		}
+	}
+
+	// --repair re-uploads what verification found, including the
+	// corrupt blobs and manifest.
+	res, err = a.VerifyBackup(ctx, backup.ID, 100, 0, true)
+	if err != nil {
+		t.Fatalf("VerifyBackup repair: %v", err)
+	}
+	for _, pr := range res.Peers {
+		if pr.Onion == b.Address() && (pr.Repaired != 2 || len(pr.Unrepaired) != 0) {
+			t.Errorf("repair on b: %+v", pr)
+		}
+	}
+	res, err = a.VerifyBackup(ctx, backup.ID, 100, 0, false)
+	if err != nil {
+		t.Fatalf("VerifyBackup after repair: %v", err)
+	}
+	if res.VerifiedAt.IsZero() {
+		t.Errorf("backup not clean after repair: %+v", res)
+	}
+}
+
+func TestVerifySampleDeterministic(t *testing.T) {
+	names := make([]string, 1000)
+	for i := range names {
+		names[i] = fmt.Sprintf("chunk-%04d", i)
+	}
+	selected := 0
+	for _, name := range names {
+		first := sampleChunk(42, name, 50)
+		if first != sampleChunk(42, name, 50) {
+			t.Fatalf("sampleChunk(42, %q, 50) is unstable", name)
+		}
+		if !sampleChunk(42, name, 100) {
+			t.Errorf("sampleChunk(42, %q, 100) = false", name)
+		}
+		if first {
+			selected++
+		}
+	}
+	// A 50% sample of 1000 names lands near 500; a wild miss means the
+	// hash is not spreading.
+	if selected < 350 || selected > 650 {
+		t.Errorf("50%% sample selected %d of 1000 names", selected)
+	}
+}
@@ -0,0 +1,82 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+)
+
+// warmListKey is the secstore key holding the peers contacted in the
+// last session, candidates for pre-dialing after the next unlock.
+const warmListKey = "peers/warmlist"
+
+// saveWarmList persists the peers contacted this session. It runs on
+// Stop, before the key material is wiped.
+func (n *Node) saveWarmList() {
+	n.mu.Lock()
+	list := make([]string, 0, len(n.contacted))
+	for addr := range n.contacted {
+		list = append(list, addr)
+	}
+	n.mu.Unlock()
+	if len(list) == 0 {
+		return
+	}
+	sort.Strings(list)
+	if err := n.sec.PutJSON(warmListKey, list); err != nil {
+		log.Printf("persist warm list: %v", err)
+	}
+}
+
+// warmConnections pre-dials peers contacted in the last session, up to
+// the configured count, so the first backup after an unlock does not
+// pay circuit-establishment latency to every peer. It runs in the
+// background after the onion is published and must never delay
+// readiness: dials go through the normal pool, queue behind the dial
+// limiter, and failures stay quiet — an unreachable peer will be
+// noticed by the prober anyway.
+func (n *Node) warmConnections(stop chan struct{}) {
+	var list []string
+	if err := n.sec.GetJSON(warmListKey, &list); err != nil {
+		return
+	}
+	established := 0
+	for _, addr := range list {
+		if established >= n.warmConns {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		n.mu.Lock()
+		_, known := n.peers[addr]
+		skip := !known || !n.breakerAllowsLocked(addr)
+		n.mu.Unlock()
+		if skip {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		_, err := n.getConn(ctx, addr)
+		cancel()
+		if errors.Is(err, ErrNodeStopped) {
+			return
+		} else if err != nil {
+			continue
+		}
+		established++
+		n.mu.Lock()
+		n.warmEstablished = established
+		n.mu.Unlock()
+	}
+}
+
+// WarmConnections reports how many warm connections the post-unlock
+// pre-dial pass has established.
+func (n *Node) WarmConnections() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.warmEstablished
+}
@@ -0,0 +1,63 @@
+package bbnode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func TestWarmConnectionsAcrossRestart(t *testing.T) {
+	network := netmock.New()
+	peer := startTestNode(t, network, "password-peer")
+
+	dir := t.TempDir()
+	a, err := New("password-a", network, dir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := a.AddPeer(peer.Address(), "peer"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Contact the peer so Stop records it in the warm list.
+	if _, err := a.HealthCheck(ctx, peer.Address()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	a.Stop()
+
+	// A fresh session on the same data dir pre-dials the peer contacted
+	// last time.
+	b, err := New("password-a", network, dir, WithWarmConnections(1))
+	if err != nil {
+		t.Fatalf("New after restart: %v", err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start after restart: %v", err)
+	}
+	t.Cleanup(func() { b.Stop() })
+
+	deadline := time.Now().Add(10 * time.Second)
+	for b.WarmConnections() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("WarmConnections = %d, want 1", b.WarmConnections())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := b.PoolStats().Conns; got != 1 {
+		t.Errorf("pool has %d conns after warm-up, want 1", got)
+	}
+}
+
+func TestWarmConnectionsOffByDefault(t *testing.T) {
+	network := netmock.New()
+	n := startTestNode(t, network, "password-a")
+	if got := n.WarmConnections(); got != 0 {
+		t.Errorf("WarmConnections = %d, want 0", got)
+	}
+}
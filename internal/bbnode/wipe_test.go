@@ -0,0 +1,63 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/starius/barterbackup/internal/netmock"
+)
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStopWipesKeys(t *testing.T) {
+	network := netmock.New()
+	n := startTestNode(t, network, "password-a")
+	master := n.masterPriv
+	onion := []byte(n.onionKey)
+	if allZero(master) || allZero(onion) {
+		t.Fatal("key material is zero before Stop")
+	}
+
+	if err := n.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !allZero(master) {
+		t.Error("masterPriv not wiped after Stop")
+	}
+	if !allZero(onion) {
+		t.Error("onion key not wiped after Stop")
+	}
+
+	// Methods that need keys fail cleanly instead of deriving from
+	// zeroed material.
+	if _, err := n.backupSealKey(newBackupID()); !errors.Is(err, errKeysWiped) {
+		t.Errorf("backupSealKey after Stop: %v, want errKeysWiped", err)
+	}
+	if err := n.Start(context.Background()); !errors.Is(err, errKeysWiped) {
+		t.Errorf("Start after Stop: %v, want errKeysWiped", err)
+	}
+}
+
+func TestBackupKeyZero(t *testing.T) {
+	network := netmock.New()
+	n := startTestNode(t, network, "password-a")
+	key, err := n.backupSealKey(newBackupID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allZero(key.Secret[:]) {
+		t.Fatal("derived key secret is zero")
+	}
+	key.Zero()
+	if !allZero(key.Secret[:]) {
+		t.Error("key secret not wiped by Zero")
+	}
+}
@@ -0,0 +1,172 @@
+package bbnode
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// wipeProgressEvery is how many blob deletions pass between persisted
+// progress updates on a wipe job.
+const wipeProgressEvery = 64
+
+// WipePeer removes the peer identified by alias or onion address and
+// forgets everything stored for or about them: chunks and manifests in
+// the chunk store, exchanged messages, agreement records, and report
+// history. The registry entry goes away immediately and the peer is
+// marked as being wiped, so concurrent inbound calls fail with
+// PermissionDenied instead of racing the file removal. The bulky blob
+// deletion runs as a background job whose record tracks progress; the
+// returned job ID identifies it. The hash-chained audit log is
+// append-only by design and keeps its entries; a peer_wiped event is
+// appended when the job finishes.
+func (n *Node) WipePeer(aliasOrOnion string) (onion, jobID string, err error) {
+	p, err := n.findPeer(aliasOrOnion)
+	if err != nil {
+		return "", "", err
+	}
+	onion = p.Onion
+	n.mu.Lock()
+	n.wiping[onion] = true
+	delete(n.peers, onion)
+	delete(n.contacted, onion)
+	delete(n.fetchNonces, onion)
+	delete(n.peerFetchNonce, onion)
+	saveErr := n.savePeersLocked()
+	pc := n.conns[onion]
+	delete(n.conns, onion)
+	n.mu.Unlock()
+	if pc != nil {
+		pc.cc.Close()
+	}
+	if saveErr != nil {
+		return "", "", saveErr
+	}
+	if n.OnionAuthEnabled() {
+		if err := n.refreshOnionAuth(context.Background()); err != nil {
+			return "", "", err
+		}
+	}
+	job := &Job{ID: newJobID(), Kind: "wipe", Peer: onion, CreatedAt: time.Now()}
+	// Persisted before the goroutine starts so the returned job ID is
+	// already visible to ListJobs and GetJob; runJob re-saves the same
+	// running record.
+	if err := n.saveJob(job, jobRunning, nil); err != nil {
+		return "", "", err
+	}
+	go n.runJob(context.Background(), job, func(ctx context.Context) error {
+		return n.wipePeerData(ctx, job, onion)
+	})
+	return onion, job.ID, nil
+}
+
+// wipePeerData deletes the blobs and records belonging to onion. Every
+// step is idempotent, so an interrupted wipe can be resumed.
+func (n *Node) wipePeerData(ctx context.Context, job *Job, onion string) error {
+	// Re-marked here so a job resumed after a daemon restart keeps
+	// rejecting the peer for the rest of the deletion.
+	n.mu.Lock()
+	n.wiping[onion] = true
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.wiping, onion)
+		n.mu.Unlock()
+	}()
+
+	before := n.chunks.Usage(onion)
+	// Two passes: a call that passed authorization before the wipe
+	// started may still have added a blob while the first pass listed.
+	for pass := 0; pass < 2; pass++ {
+		names, err := n.chunks.List(onion, "")
+		if err != nil {
+			return fmt.Errorf("list blobs of %s: %w", onion, err)
+		}
+		for i, name := range names {
+			if err := checkpoint(ctx); err != nil {
+				return err
+			}
+			if err := n.chunks.Delete(onion, name); err != nil {
+				return fmt.Errorf("delete blob %s: %w", name, err)
+			}
+			job.WipedBlobs++
+			job.WipedBytes = before - n.chunks.Usage(onion)
+			if (i+1)%wipeProgressEvery == 0 {
+				n.saveJob(job, jobRunning, nil)
+			}
+		}
+	}
+
+	msgs, err := n.loadMessages(onion)
+	if err != nil {
+		return err
+	}
+	if err := n.sec.Delete(msgKey(onion)); err != nil {
+		return err
+	}
+
+	all, err := n.ListAgreements()
+	if err != nil {
+		return err
+	}
+	agreements := 0
+	for i := range all {
+		a := &all[i]
+		if a.Proposer != onion && a.Acceptor != onion {
+			continue
+		}
+		if err := n.sec.Delete(agreementKey(a.ID)); err != nil {
+			return err
+		}
+		if err := n.sec.Delete(agreementSecretKey(a.ID)); err != nil {
+			return err
+		}
+		agreements++
+	}
+
+	if err := n.scrubReports(onion); err != nil {
+		return err
+	}
+
+	n.auditEvent("peer_wiped", map[string]string{
+		"onion":      onion,
+		"blobs":      fmt.Sprint(job.WipedBlobs),
+		"bytes":      fmt.Sprint(job.WipedBytes),
+		"messages":   fmt.Sprint(len(msgs)),
+		"agreements": fmt.Sprint(agreements),
+	})
+	return nil
+}
+
+// scrubReports removes the peer's byte counters from the in-memory and
+// persisted daily report buckets.
+func (n *Node) scrubReports(onion string) error {
+	n.reportMu.Lock()
+	if n.reportCur != nil {
+		delete(n.reportCur.StoredForPeers, onion)
+		delete(n.reportCur.StoredAtPeers, onion)
+		n.reportDirty = true
+	}
+	n.reportMu.Unlock()
+	keys, err := n.sec.List("reports/")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var day ReportDay
+		if err := n.sec.GetJSON(key, &day); err != nil {
+			return err
+		}
+		_, inFor := day.StoredForPeers[onion]
+		_, inAt := day.StoredAtPeers[onion]
+		if !inFor && !inAt {
+			continue
+		}
+		delete(day.StoredForPeers, onion)
+		delete(day.StoredAtPeers, onion)
+		if err := n.sec.PutJSON(key, &day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package bbnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/starius/barterbackup/bbrpc/pb"
+	"github.com/starius/barterbackup/internal/netmock"
+	"github.com/starius/barterbackup/internal/secstore"
+)
+
+func TestWipePeerDeletesEverything(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// b leaves traces of every kind on a: a stored chunk, a message,
+	// and an agreement proposal.
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	client := pb.NewPeerClient(cc)
+	if _, err := client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("data")}); err != nil {
+		t.Fatalf("StoreChunk: %v", err)
+	}
+	if err := b.SendMessage(ctx, "alice", "hello"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if _, err := b.ProposeAgreement(ctx, "alice", 1<<20, 1<<20, 30); err != nil {
+		t.Fatalf("ProposeAgreement: %v", err)
+	}
+
+	onion, jobID, err := a.WipePeer("bob")
+	if err != nil {
+		t.Fatalf("WipePeer: %v", err)
+	}
+	if onion != b.Address() {
+		t.Fatalf("WipePeer resolved %q, want %q", onion, b.Address())
+	}
+	var job Job
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err := a.sec.GetJSON(jobRecordKey(jobID), &job); err != nil {
+			t.Fatalf("load wipe job: %v", err)
+		}
+		if job.State == jobDone {
+			break
+		}
+		if job.State == jobFailed || time.Now().After(deadline) {
+			t.Fatalf("wipe job state = %q, error %q", job.State, job.Error)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Kind != "wipe" || job.WipedBlobs < 1 || job.WipedBytes < 4 {
+		t.Errorf("wipe job record = %+v", job)
+	}
+
+	if names, _ := a.chunks.List(onion, ""); len(names) != 0 {
+		t.Errorf("chunks survived the wipe: %v", names)
+	}
+	var msgs []Message
+	if err := a.sec.GetJSON(msgKey(onion), &msgs); !errors.Is(err, secstore.ErrNotFound) {
+		t.Errorf("messages survived the wipe: %v, %v", msgs, err)
+	}
+	agreements, err := a.ListAgreements()
+	if err != nil {
+		t.Fatalf("ListAgreements: %v", err)
+	}
+	for _, ag := range agreements {
+		if ag.Proposer == onion || ag.Acceptor == onion {
+			t.Errorf("agreement %s survived the wipe", ag.ID)
+		}
+	}
+	if _, err := a.findPeer("bob"); err == nil {
+		t.Error("wiped peer still resolves in the registry")
+	}
+
+	// The peer is out of the registry, so its next call is rejected.
+	_, err = client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c2", Data: []byte("more")})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StoreChunk after wipe: %v, want PermissionDenied", err)
+	}
+}
+
+func TestWipePeerRejectsConcurrentCalls(t *testing.T) {
+	network := netmock.New()
+	a := startTestNode(t, network, "password-a")
+	b := startTestNode(t, network, "password-b")
+	if err := a.AddPeer(b.Address(), "bob"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := b.AddPeer(a.Address(), "alice"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cc, err := b.getConn(ctx, a.Address())
+	if err != nil {
+		t.Fatalf("getConn: %v", err)
+	}
+	client := pb.NewPeerClient(cc)
+
+	// Freeze the wipe mid-flight: with the peer marked as being wiped
+	// but still registered, every call must bounce, even open methods.
+	a.mu.Lock()
+	a.wiping[b.Address()] = true
+	a.mu.Unlock()
+	_, err = client.StoreChunk(ctx, &pb.StoreChunkRequest{Name: "c1", Data: []byte("x")})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StoreChunk during wipe: %v, want PermissionDenied", err)
+	}
+	if _, err := client.HealthCheck(ctx, &pb.HealthCheckRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("HealthCheck during wipe: %v, want PermissionDenied", err)
+	}
+
+	// Re-adding the peer before the wipe job finished would hand the
+	// new registration's data to the running deletion.
+	a.mu.Lock()
+	delete(a.peers, b.Address())
+	a.mu.Unlock()
+	err = a.AddPeer(b.Address(), "bob-again")
+	if err == nil || !strings.Contains(err.Error(), "being wiped") {
+		t.Errorf("AddPeer during wipe: %v, want a being-wiped error", err)
+	}
+}
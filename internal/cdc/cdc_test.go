@@ -0,0 +1,171 @@
+package cdc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkAll splits data and returns copies of the chunks.
+func chunkAll(t testing.TB, r io.Reader, p Params) [][]byte {
+	t.Helper()
+	c, err := NewChunker(r, p)
+	if err != nil {
+		t.Fatalf("NewChunker: %v", err)
+	}
+	var out [][]byte
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return out
+		} else if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		out = append(out, append([]byte(nil), chunk...))
+	}
+}
+
+func TestReassembleAndBounds(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 1<<20)
+	rng.Read(data)
+	chunks := chunkAll(t, bytes.NewReader(data), DefaultParams)
+	var got []byte
+	for i, c := range chunks {
+		if len(c) > DefaultParams.Max {
+			t.Errorf("chunk %d is %d bytes, max %d", i, len(c), DefaultParams.Max)
+		}
+		if len(c) < DefaultParams.Min && i != len(chunks)-1 {
+			t.Errorf("chunk %d is %d bytes, min %d", i, len(c), DefaultParams.Min)
+		}
+		got = append(got, c...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("chunks do not reassemble into the input")
+	}
+}
+
+func TestPrependShiftsBoundariesLocally(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	data := make([]byte, 1<<20)
+	rng.Read(data)
+	shifted := append([]byte("prepended bytes"), data...)
+
+	hashes := func(chunks [][]byte) map[[32]byte]int {
+		m := make(map[[32]byte]int)
+		for _, c := range chunks {
+			m[sha256.Sum256(c)] += len(c)
+		}
+		return m
+	}
+	before := hashes(chunkAll(t, bytes.NewReader(data), DefaultParams))
+	after := chunkAll(t, bytes.NewReader(shifted), DefaultParams)
+	var reupload int
+	for _, c := range after {
+		if before[sha256.Sum256(c)] == 0 {
+			reupload += len(c)
+		}
+	}
+	// Only the chunks around the insertion point should differ; fixed
+	// chunking would re-upload everything.
+	if reupload > len(shifted)/10 {
+		t.Errorf("prepending re-uploads %d of %d bytes", reupload, len(shifted))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Params{
+		{Min: 0, Avg: 4, Max: 8},
+		{Min: 8, Avg: 4, Max: 8},
+		{Min: 2, Avg: 4, Max: 3},
+		{Min: 2, Avg: 5, Max: 8},
+	}
+	for _, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v): no error, want one", p)
+		}
+	}
+	if err := DefaultParams.Validate(); err != nil {
+		t.Errorf("Validate(DefaultParams): %v", err)
+	}
+}
+
+// FuzzDeterminism checks that boundaries depend only on the content:
+// the same data chunked through different read granularities must
+// produce identical chunks, which reassemble into the input.
+func FuzzDeterminism(f *testing.F) {
+	f.Add([]byte("hello"))
+	f.Add(bytes.Repeat([]byte{0}, 100000))
+	seed := make([]byte, 50000)
+	rand.New(rand.NewSource(3)).Read(seed)
+	f.Add(seed)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		whole := chunkAll(t, bytes.NewReader(data), DefaultParams)
+		bytewise := chunkAll(t, iotest.OneByteReader(bytes.NewReader(data)), DefaultParams)
+		if len(whole) != len(bytewise) {
+			t.Fatalf("%d chunks reading at once, %d reading bytewise", len(whole), len(bytewise))
+		}
+		var got []byte
+		for i := range whole {
+			if !bytes.Equal(whole[i], bytewise[i]) {
+				t.Fatalf("chunk %d differs between read granularities", i)
+			}
+			if len(whole[i]) > DefaultParams.Max {
+				t.Fatalf("chunk %d is %d bytes, max %d", i, len(whole[i]), DefaultParams.Max)
+			}
+			got = append(got, whole[i]...)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("chunks do not reassemble into the input")
+		}
+	})
+}
+
+// BenchmarkReuploadVolume measures how many bytes a backup of a file
+// must re-upload after the file is prepended to, for content-defined
+// versus fixed-size chunking. The metric to compare is reupload-B/op.
+func BenchmarkReuploadVolume(b *testing.B) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(4)).Read(data)
+	edited := append([]byte("a few bytes prepended to the file"), data...)
+
+	fixed := func(data []byte) [][]byte {
+		var out [][]byte
+		for len(data) > 0 {
+			m := len(data)
+			if m > DefaultParams.Max {
+				m = DefaultParams.Max
+			}
+			out = append(out, data[:m])
+			data = data[m:]
+		}
+		return out
+	}
+	cdc := func(data []byte) [][]byte {
+		return chunkAll(b, bytes.NewReader(data), DefaultParams)
+	}
+	for _, bench := range []struct {
+		name  string
+		split func([]byte) [][]byte
+	}{{"cdc", cdc}, {"fixed", fixed}} {
+		b.Run(bench.name, func(b *testing.B) {
+			var reupload int64
+			for i := 0; i < b.N; i++ {
+				have := make(map[[32]byte]bool)
+				for _, c := range bench.split(data) {
+					have[sha256.Sum256(c)] = true
+				}
+				reupload = 0
+				for _, c := range bench.split(edited) {
+					if !have[sha256.Sum256(c)] {
+						reupload += int64(len(c))
+					}
+				}
+			}
+			b.ReportMetric(float64(reupload), "reupload-B/op")
+		})
+	}
+}
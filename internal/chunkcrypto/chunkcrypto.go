@@ -0,0 +1,146 @@
+// Package chunkcrypto defines the versioned envelope format for backup
+// chunks. Chunks are sealed with XChaCha20-Poly1305 under a key derived
+// per backup and per chunk, so a peer holding the envelope learns
+// nothing but its size, and a chunk restored into the wrong backup or
+// position fails authentication instead of corrupting data.
+package chunkcrypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/starius/barterbackup/internal/memzero"
+)
+
+// Envelope layout, all fields big-endian:
+//
+//	magic    [4]byte  "bbck"
+//	version  byte     1
+//	backupID [16]byte
+//	index    uint64
+//	nonce    [24]byte
+//	ciphertext + Poly1305 tag
+//
+// The header (magic through index) is authenticated as associated data.
+
+// IDSize is the size of a backup ID.
+const IDSize = 16
+
+const (
+	magic       = "bbck"
+	version     = 1
+	headerSize  = len(magic) + 1 + IDSize + 8
+	chunkKeyTag = "barterbackup/chunk/v1"
+)
+
+// Overhead is how much larger an envelope is than its plaintext.
+const Overhead = headerSize + chacha20poly1305.NonceSizeX + chacha20poly1305.Overhead
+
+// Exhaustive decode failures, distinguishable with errors.Is.
+var (
+	// ErrNotEnvelope means the data does not start with the envelope magic.
+	ErrNotEnvelope = errors.New("chunkcrypto: not a chunk envelope")
+	// ErrWrongVersion means the envelope version is not supported.
+	ErrWrongVersion = errors.New("chunkcrypto: unsupported envelope version")
+	// ErrTruncated means the envelope is too short to contain a chunk.
+	ErrTruncated = errors.New("chunkcrypto: truncated envelope")
+	// ErrWrongBackup means the envelope belongs to a different backup.
+	ErrWrongBackup = errors.New("chunkcrypto: envelope belongs to another backup")
+	// ErrAuthentication means the ciphertext or header was tampered with,
+	// or the key is wrong.
+	ErrAuthentication = errors.New("chunkcrypto: authentication failed")
+)
+
+// BackupKey is the per-backup sealing key. ID is public (it appears in
+// envelope headers); Secret never leaves the owner.
+type BackupKey struct {
+	ID     [IDSize]byte
+	Secret [32]byte
+}
+
+// Zero wipes the key secret. Callers do this once they are done
+// sealing or opening, so derived keys do not outlive the operation.
+func (k *BackupKey) Zero() {
+	memzero.Bytes(k.Secret[:])
+}
+
+// chunkKey derives the per-chunk AEAD key: HKDF-Expand of the backup
+// secret with an info string binding the format tag and chunk index.
+func (k *BackupKey) chunkKey(index uint64) ([]byte, error) {
+	info := make([]byte, 0, len(chunkKeyTag)+8)
+	info = append(info, chunkKeyTag...)
+	info = binary.BigEndian.AppendUint64(info, index)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, k.Secret[:], info), key); err != nil {
+		return nil, fmt.Errorf("derive chunk key: %w", err)
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext as chunk index of the backup identified by
+// key, returning the envelope.
+func Seal(plaintext []byte, key *BackupKey, index uint64) ([]byte, error) {
+	chunkKey, err := key.chunkKey(index)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(chunkKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(plaintext)+Overhead)
+	out = append(out, magic...)
+	out = append(out, version)
+	out = append(out, key.ID[:]...)
+	out = binary.BigEndian.AppendUint64(out, index)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, out[:headerSize]), nil
+}
+
+// Open authenticates and decrypts an envelope sealed with key,
+// returning the plaintext and the chunk index recorded in the header.
+func Open(envelope []byte, key *BackupKey) ([]byte, uint64, error) {
+	if len(envelope) < len(magic) || string(envelope[:len(magic)]) != magic {
+		return nil, 0, ErrNotEnvelope
+	}
+	if len(envelope) < headerSize {
+		return nil, 0, ErrTruncated
+	}
+	if envelope[len(magic)] != version {
+		return nil, 0, fmt.Errorf("%w: %d", ErrWrongVersion, envelope[len(magic)])
+	}
+	var id [IDSize]byte
+	copy(id[:], envelope[len(magic)+1:])
+	if id != key.ID {
+		return nil, 0, ErrWrongBackup
+	}
+	index := binary.BigEndian.Uint64(envelope[headerSize-8 : headerSize])
+	if len(envelope) < Overhead {
+		return nil, 0, ErrTruncated
+	}
+	chunkKey, err := key.chunkKey(index)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := chacha20poly1305.NewX(chunkKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	nonce := envelope[headerSize : headerSize+chacha20poly1305.NonceSizeX]
+	plaintext, err := aead.Open(nil, nonce, envelope[headerSize+chacha20poly1305.NonceSizeX:], envelope[:headerSize])
+	if err != nil {
+		return nil, 0, ErrAuthentication
+	}
+	return plaintext, index, nil
+}
@@ -0,0 +1,128 @@
+package chunkcrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func testKey() *BackupKey {
+	key := &BackupKey{}
+	for i := range key.ID {
+		key.ID[i] = byte(i)
+	}
+	for i := range key.Secret {
+		key.Secret[i] = byte(0xa0 + i)
+	}
+	return key
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey()
+	for _, plaintext := range [][]byte{nil, []byte("x"), bytes.Repeat([]byte("chunk"), 1000)} {
+		env, err := Seal(plaintext, key, 7)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		if len(env) != len(plaintext)+Overhead {
+			t.Errorf("envelope size = %d, want %d", len(env), len(plaintext)+Overhead)
+		}
+		got, index, err := Open(env, key)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if index != 7 {
+			t.Errorf("index = %d, want 7", index)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("plaintext mismatch")
+		}
+	}
+}
+
+// TestHeaderFormat freezes the envelope header layout. If this test
+// breaks, old backups become unreadable: bump the version instead of
+// changing the format.
+func TestHeaderFormat(t *testing.T) {
+	env, err := Seal([]byte("payload"), testKey(), 0x0102030405060708)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	wantHeader := "6262636b" + // "bbck"
+		"01" + // version
+		"000102030405060708090a0b0c0d0e0f" + // backup ID
+		"0102030405060708" // index, big-endian
+	if got := hex.EncodeToString(env[:headerSize]); got != wantHeader {
+		t.Errorf("header = %s, want %s", got, wantHeader)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	key := testKey()
+	env, err := Seal([]byte("payload"), key, 3)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	corrupt := func(mutate func([]byte)) []byte {
+		c := append([]byte(nil), env...)
+		mutate(c)
+		return c
+	}
+	otherKey := testKey()
+	otherKey.Secret[0] ^= 1
+	otherID := testKey()
+	otherID.ID[0] ^= 1
+
+	cases := []struct {
+		name    string
+		env     []byte
+		key     *BackupKey
+		wantErr error
+	}{
+		{"not an envelope", []byte("not a chunk"), key, ErrNotEnvelope},
+		{"empty", nil, key, ErrNotEnvelope},
+		{"truncated header", env[:headerSize-1], key, ErrTruncated},
+		{"truncated body", env[:headerSize+5], key, ErrTruncated},
+		{"wrong version", corrupt(func(c []byte) { c[4] = 2 }), key, ErrWrongVersion},
+		{"wrong backup", env, otherID, ErrWrongBackup},
+		{"wrong key", env, otherKey, ErrAuthentication},
+		{"flipped header bit", corrupt(func(c []byte) { c[headerSize-1] ^= 1 }), key, ErrAuthentication},
+		{"flipped ciphertext bit", corrupt(func(c []byte) { c[len(c)-1] ^= 1 }), key, ErrAuthentication},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := Open(tc.env, tc.key)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Open = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestChunkKeySeparation checks that moving a chunk to another index or
+// another backup fails authentication: the per-chunk key binds both.
+func TestChunkKeySeparation(t *testing.T) {
+	key := testKey()
+	k0, err := key.chunkKey(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1, err := key.chunkKey(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(k0, k1) {
+		t.Error("chunk keys for different indexes are equal")
+	}
+	other := testKey()
+	other.Secret[31] ^= 1
+	o0, err := other.chunkKey(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(k0, o0) {
+		t.Error("chunk keys for different backups are equal")
+	}
+}
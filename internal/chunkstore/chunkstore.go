@@ -0,0 +1,429 @@
+// Package chunkstore stores peers' encrypted chunks. Chunks are opaque
+// blobs addressed by hash, grouped per owner (the peer the data belongs
+// to). Storage is pluggable through ChunkBackend: the default keeps
+// blobs on the local disk, the S3 backend spills them onto
+// S3-compatible object storage.
+package chunkstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a chunk that is not in the store.
+var ErrNotFound = errors.New("chunkstore: not found")
+
+// BlobInfo describes one stored blob.
+type BlobInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// ChunkBackend is the storage behind a Store. Implementations must be
+// safe for concurrent use. Get and Stat return an error wrapping
+// ErrNotFound for missing blobs.
+type ChunkBackend interface {
+	Put(owner, name string, data []byte) error
+	Get(owner, name string) ([]byte, error)
+	Has(owner, name string) (bool, error)
+	Delete(owner, name string) error
+	List(owner, prefix string) ([]string, error)
+	Stat(owner, name string) (BlobInfo, error)
+}
+
+// Transient backend errors (network blips, 5xx responses) are retried
+// on the Put and Get paths with a short backoff.
+const (
+	retryAttempts  = 3
+	retryBaseDelay = 100 * time.Millisecond
+)
+
+// ownerStats aggregates one owner's stored blobs. The byte and chunk
+// counters stay exact across Put and Delete; oldest and newest can go
+// stale after a Delete and are refreshed by the next Reconcile pass.
+type ownerStats struct {
+	bytes  int64
+	chunks int
+	oldest time.Time
+	newest time.Time
+}
+
+// Store tracks per-owner usage on top of a ChunkBackend and retries
+// transient backend failures. It is safe for concurrent use.
+type Store struct {
+	backend ChunkBackend
+
+	mu    sync.Mutex
+	stats map[string]*ownerStats // owner -> aggregates, computed lazily per owner
+	// lastAccess records the last Put, Get, or Open per owner. It is
+	// memory-only: a restart forgets it.
+	lastAccess map[string]time.Time
+}
+
+// Open opens (creating if needed) a disk-backed chunk store at dir.
+func Open(dir string) (*Store, error) {
+	backend, err := NewFSBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+	return New(backend), nil
+}
+
+// New creates a chunk store on top of backend.
+func New(backend ChunkBackend) *Store {
+	return &Store{
+		backend:    backend,
+		stats:      make(map[string]*ownerStats),
+		lastAccess: make(map[string]time.Time),
+	}
+}
+
+// touch records an access to owner's data.
+func (s *Store) touch(owner string) {
+	s.mu.Lock()
+	s.lastAccess[owner] = time.Now()
+	s.mu.Unlock()
+}
+
+// withRetry runs fn up to retryAttempts times, backing off between
+// tries. Not-found errors are final.
+func withRetry(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < retryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryBaseDelay << (attempt - 1))
+		}
+		err = fn()
+		if err == nil || errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return err
+}
+
+// Put stores a chunk for owner under hash.
+func (s *Store) Put(owner, hash string, data []byte) error {
+	s.touch(owner)
+	has, err := s.backend.Has(owner, hash)
+	if err == nil && has {
+		return nil // already stored; do not double-count usage
+	}
+	if err := withRetry(func() error { return s.backend.Put(owner, hash, data) }); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if st, ok := s.stats[owner]; ok {
+		st.bytes += int64(len(data))
+		st.chunks++
+		if st.oldest.IsZero() || now.Before(st.oldest) {
+			st.oldest = now
+		}
+		if now.After(st.newest) {
+			st.newest = now
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the chunk stored for owner under hash.
+func (s *Store) Get(owner, hash string) ([]byte, error) {
+	s.touch(owner)
+	var data []byte
+	err := withRetry(func() error {
+		var err error
+		data, err = s.backend.Get(owner, hash)
+		return err
+	})
+	return data, err
+}
+
+// Open returns a reader over the chunk stored for owner under hash, so
+// large blobs can be streamed without loading them whole. Backends that
+// cannot stream fall back to Get. The caller must close the reader.
+func (s *Store) Open(owner, hash string) (io.ReadCloser, error) {
+	type blobOpener interface {
+		Open(owner, name string) (io.ReadCloser, error)
+	}
+	s.touch(owner)
+	if o, ok := s.backend.(blobOpener); ok {
+		var rc io.ReadCloser
+		err := withRetry(func() error {
+			var err error
+			rc, err = o.Open(owner, hash)
+			return err
+		})
+		return rc, err
+	}
+	data, err := s.Get(owner, hash)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Has reports whether the chunk exists for owner.
+func (s *Store) Has(owner, hash string) bool {
+	has, err := s.backend.Has(owner, hash)
+	return err == nil && has
+}
+
+// Delete removes the chunk stored for owner under hash. Deleting a
+// missing chunk is not an error.
+func (s *Store) Delete(owner, hash string) error {
+	info, err := s.backend.Stat(owner, hash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.backend.Delete(owner, hash); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if st, ok := s.stats[owner]; ok {
+		st.bytes -= info.Size
+		st.chunks--
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns the names of owner's blobs starting with prefix, sorted.
+func (s *Store) List(owner, prefix string) ([]string, error) {
+	return s.backend.List(owner, prefix)
+}
+
+// Owners lists the owners with at least one stored blob. Backends that
+// cannot enumerate owners report none.
+func (s *Store) Owners() ([]string, error) {
+	type ownerLister interface {
+		Owners() ([]string, error)
+	}
+	ol, ok := s.backend.(ownerLister)
+	if !ok {
+		return nil, nil
+	}
+	return ol.Owners()
+}
+
+// FindOwner reports which owner a blob of the given name is stored
+// for, so servers can tell "you do not own this" apart from "no such
+// blob". Backends that cannot enumerate owners report not found.
+func (s *Store) FindOwner(hash string) (string, bool) {
+	owners, err := s.Owners()
+	if err != nil {
+		return "", false
+	}
+	for _, owner := range owners {
+		if has, err := s.backend.Has(owner, hash); err == nil && has {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// RenameOwner moves every blob stored for oldOwner to newOwner, for a
+// peer whose verified address change was announced. Backends that
+// cannot rename an owner in place fall back to copying blob by blob.
+func (s *Store) RenameOwner(oldOwner, newOwner string) error {
+	type ownerRenamer interface {
+		RenameOwner(oldOwner, newOwner string) error
+	}
+	if r, ok := s.backend.(ownerRenamer); ok {
+		if err := withRetry(func() error { return r.RenameOwner(oldOwner, newOwner) }); err != nil {
+			return err
+		}
+	} else {
+		names, err := s.backend.List(oldOwner, "")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			data, err := s.backend.Get(oldOwner, name)
+			if err != nil {
+				return err
+			}
+			if err := withRetry(func() error { return s.backend.Put(newOwner, name, data) }); err != nil {
+				return err
+			}
+			if err := s.backend.Delete(oldOwner, name); err != nil {
+				return err
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Drop both tracked totals so the next Usage call rescans.
+	delete(s.stats, oldOwner)
+	delete(s.stats, newOwner)
+	if at, ok := s.lastAccess[oldOwner]; ok {
+		s.lastAccess[newOwner] = at
+		delete(s.lastAccess, oldOwner)
+	}
+	return nil
+}
+
+// scanOwner measures owner's blobs in the backend.
+func (s *Store) scanOwner(owner string) (*ownerStats, error) {
+	names, err := s.backend.List(owner, "")
+	if err != nil {
+		return nil, err
+	}
+	st := &ownerStats{}
+	for _, name := range names {
+		info, err := s.backend.Stat(owner, name)
+		if err != nil {
+			continue
+		}
+		st.bytes += info.Size
+		st.chunks++
+		if st.oldest.IsZero() || info.ModTime.Before(st.oldest) {
+			st.oldest = info.ModTime
+		}
+		if info.ModTime.After(st.newest) {
+			st.newest = info.ModTime
+		}
+	}
+	return st, nil
+}
+
+// ownerStatsFor returns owner's tracked aggregates, scanning the
+// backend on the first call per owner.
+func (s *Store) ownerStatsFor(owner string) ownerStats {
+	s.mu.Lock()
+	if st, ok := s.stats[owner]; ok {
+		s.mu.Unlock()
+		return *st
+	}
+	s.mu.Unlock()
+
+	scanned, err := s.scanOwner(owner)
+	if err != nil {
+		return ownerStats{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Writes that raced the scan already adjusted the map; keep theirs.
+	if st, ok := s.stats[owner]; ok {
+		return *st
+	}
+	s.stats[owner] = scanned
+	return *scanned
+}
+
+// Usage returns the bytes currently stored for owner. The first call
+// per owner scans the backend; later calls use the tracked total.
+func (s *Store) Usage(owner string) int64 {
+	return s.ownerStatsFor(owner).bytes
+}
+
+// OwnerUsage describes one owner's stored data, for hosting listings.
+type OwnerUsage struct {
+	Owner  string
+	Chunks int
+	Bytes  int64
+	// Oldest and Newest are the modification times of the oldest and
+	// newest stored blob; they can lag behind deletions until the next
+	// reconcile pass.
+	Oldest time.Time
+	Newest time.Time
+	// LastAccess is when the owner's data was last written or read in
+	// this process; zero if it was not touched since startup.
+	LastAccess time.Time
+}
+
+// OwnerUsages aggregates the store per owner. It serves from the
+// tracked counters, scanning the backend only for owners not measured
+// yet, so calling it repeatedly does not walk the disk.
+func (s *Store) OwnerUsages() ([]OwnerUsage, error) {
+	owners, err := s.Owners()
+	if err != nil {
+		return nil, err
+	}
+	var out []OwnerUsage
+	for _, owner := range owners {
+		st := s.ownerStatsFor(owner)
+		s.mu.Lock()
+		at := s.lastAccess[owner]
+		s.mu.Unlock()
+		out = append(out, OwnerUsage{
+			Owner:      owner,
+			Chunks:     st.chunks,
+			Bytes:      st.bytes,
+			Oldest:     st.oldest,
+			Newest:     st.newest,
+			LastAccess: at,
+		})
+	}
+	return out, nil
+}
+
+// OwnerDrift reports one owner whose tracked usage counter did not
+// match the blobs actually in the backend.
+type OwnerDrift struct {
+	Owner   string
+	Tracked int64
+	Actual  int64
+}
+
+// Reconcile rescans every owner's blobs and replaces the tracked usage
+// counters with the measured totals. It returns the owners whose
+// counter had drifted from reality, e.g. after a crash or a deletion
+// behind the store's back. Owners whose counter was never computed have
+// nothing to drift and are set silently.
+func (s *Store) Reconcile() ([]OwnerDrift, error) {
+	owners, err := s.Owners()
+	if err != nil {
+		return nil, err
+	}
+	// An owner tracked in memory but gone from the backend drifts to
+	// zero; include it in the scan.
+	onDisk := make(map[string]bool, len(owners))
+	for _, owner := range owners {
+		onDisk[owner] = true
+	}
+	s.mu.Lock()
+	for owner := range s.stats {
+		if !onDisk[owner] {
+			owners = append(owners, owner)
+		}
+	}
+	s.mu.Unlock()
+
+	var drifts []OwnerDrift
+	for _, owner := range owners {
+		scanned, err := s.scanOwner(owner)
+		if err != nil {
+			return drifts, err
+		}
+		// Compare and correct under the lock. A write racing the scan
+		// can leave the counter off by that one blob; the next
+		// reconcile run absorbs it.
+		s.mu.Lock()
+		if st, ok := s.stats[owner]; ok && st.bytes != scanned.bytes {
+			drifts = append(drifts, OwnerDrift{Owner: owner, Tracked: st.bytes, Actual: scanned.bytes})
+		}
+		s.stats[owner] = scanned
+		s.mu.Unlock()
+	}
+	return drifts, nil
+}
+
+// ReclaimStale deletes leftovers of interrupted uploads older than ttl
+// on backends that have them. Object storage backends upload atomically
+// and have nothing to reclaim.
+func (s *Store) ReclaimStale(ttl time.Duration) (files int, bytes int64, err error) {
+	type staleReclaimer interface {
+		ReclaimStale(ttl time.Duration) (int, int64, error)
+	}
+	if r, ok := s.backend.(staleReclaimer); ok {
+		return r.ReclaimStale(ttl)
+	}
+	return 0, 0, nil
+}
@@ -0,0 +1,185 @@
+package chunkstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutGetDeleteUsage(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put("owner1", "aabb", []byte("data")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !s.Has("owner1", "aabb") {
+		t.Error("Has = false after Put")
+	}
+	got, err := s.Get("owner1", "aabb")
+	if err != nil || string(got) != "data" {
+		t.Fatalf("Get: %q, %v", got, err)
+	}
+	if got := s.Usage("owner1"); got != 4 {
+		t.Errorf("Usage = %d, want 4", got)
+	}
+	if err := s.Delete("owner1", "aabb"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get("owner1", "aabb"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if got := s.Usage("owner1"); got != 0 {
+		t.Errorf("Usage after Delete = %d, want 0", got)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put("owner1", "aabb", []byte("0123456789")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("owner2", "ccdd", []byte("abc")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Prime the tracked counters.
+	if got := s.Usage("owner1"); got != 10 {
+		t.Fatalf("Usage = %d, want 10", got)
+	}
+	s.Usage("owner2")
+
+	// Corrupt one counter by deleting a blob behind the store's back.
+	if err := os.Remove(filepath.Join(dir, "owner1", "aabb")); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err := s.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(drifts) != 1 || drifts[0].Owner != "owner1" ||
+		drifts[0].Tracked != 10 || drifts[0].Actual != 0 {
+		t.Errorf("drifts = %+v, want owner1 tracked 10 actual 0", drifts)
+	}
+	if got := s.Usage("owner1"); got != 0 {
+		t.Errorf("Usage after Reconcile = %d, want 0", got)
+	}
+	if got := s.Usage("owner2"); got != 3 {
+		t.Errorf("owner2 Usage after Reconcile = %d, want 3", got)
+	}
+
+	// A second run finds nothing to correct.
+	drifts, err = s.Reconcile()
+	if err != nil {
+		t.Fatalf("second Reconcile: %v", err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("second Reconcile drifts = %+v, want none", drifts)
+	}
+}
+
+func TestOwnerUsages(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put("owner1", "aabb", []byte("0123456789")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("owner1", "ccdd", []byte("abc")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("owner2", "eeff", []byte("x")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	usages, err := s.OwnerUsages()
+	if err != nil {
+		t.Fatalf("OwnerUsages: %v", err)
+	}
+	byOwner := make(map[string]OwnerUsage)
+	for _, u := range usages {
+		byOwner[u.Owner] = u
+	}
+	u1 := byOwner["owner1"]
+	if u1.Chunks != 2 || u1.Bytes != 13 {
+		t.Errorf("owner1 = %+v, want 2 chunks, 13 bytes", u1)
+	}
+	if u1.Oldest.IsZero() || u1.Newest.Before(u1.Oldest) {
+		t.Errorf("owner1 timestamps = %v..%v", u1.Oldest, u1.Newest)
+	}
+	if u1.LastAccess.IsZero() {
+		t.Error("owner1 LastAccess zero after Put")
+	}
+	if u2 := byOwner["owner2"]; u2.Chunks != 1 || u2.Bytes != 1 {
+		t.Errorf("owner2 = %+v, want 1 chunk, 1 byte", u2)
+	}
+
+	// Counters stay exact across deletes without rescanning.
+	if err := s.Delete("owner1", "ccdd"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	usages, err = s.OwnerUsages()
+	if err != nil {
+		t.Fatalf("OwnerUsages after Delete: %v", err)
+	}
+	for _, u := range usages {
+		if u.Owner == "owner1" && (u.Chunks != 1 || u.Bytes != 10) {
+			t.Errorf("owner1 after Delete = %+v, want 1 chunk, 10 bytes", u)
+		}
+	}
+}
+
+func TestReclaimStale(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put("owner1", "good", []byte("keep me")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Simulate a crash mid-upload: one stale temp file, one fresh.
+	ownerDir := filepath.Join(dir, "owner1")
+	stale := filepath.Join(ownerDir, "partial1.tmp")
+	if err := os.WriteFile(stale, []byte("half written"), 0o600); err != nil {
+		t.Fatalf("write stale temp: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("age stale temp: %v", err)
+	}
+	fresh := filepath.Join(ownerDir, "partial2.tmp")
+	if err := os.WriteFile(fresh, []byte("in progress"), 0o600); err != nil {
+		t.Fatalf("write fresh temp: %v", err)
+	}
+
+	// Simulate a restart: reopen the store and reclaim.
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	files, bytes, err := s.ReclaimStale(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("ReclaimStale: %v", err)
+	}
+	if files != 1 || bytes != int64(len("half written")) {
+		t.Errorf("ReclaimStale = %d files, %d bytes; want 1 file, %d bytes", files, bytes, len("half written"))
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temp file still present")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("fresh temp file was removed")
+	}
+	if !s.Has("owner1", "good") {
+		t.Error("real chunk was removed")
+	}
+}
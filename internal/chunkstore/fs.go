@@ -0,0 +1,195 @@
+package chunkstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tmpSuffix marks in-progress writes; leftovers are garbage collected.
+const tmpSuffix = ".tmp"
+
+// FSBackend stores blobs as files under one directory per owner. Writes
+// go through a temp file and an atomic rename so a crash never leaves a
+// truncated chunk at its final name.
+type FSBackend struct {
+	dir string
+}
+
+// NewFSBackend opens (creating if needed) the blob directory at dir.
+func NewFSBackend(dir string) (*FSBackend, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create chunk store dir: %w", err)
+	}
+	return &FSBackend{dir: dir}, nil
+}
+
+// Put stores a blob for owner under name.
+func (b *FSBackend) Put(owner, name string, data []byte) error {
+	dir := b.ownerDir(owner)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create owner dir: %w", err)
+	}
+	final := filepath.Join(dir, name)
+	if _, err := os.Stat(final); err == nil {
+		return nil // already stored
+	}
+	tmp := final + tmpSuffix
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write chunk: %w", err)
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("finalize chunk: %w", err)
+	}
+	return nil
+}
+
+// Get returns the blob stored for owner under name.
+func (b *FSBackend) Get(owner, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(b.ownerDir(owner), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, owner, name)
+	} else if err != nil {
+		return nil, fmt.Errorf("read chunk: %w", err)
+	}
+	return data, nil
+}
+
+// Open returns a reader over the blob stored for owner under name.
+func (b *FSBackend) Open(owner, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(b.ownerDir(owner), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, owner, name)
+	} else if err != nil {
+		return nil, fmt.Errorf("open chunk: %w", err)
+	}
+	return f, nil
+}
+
+// Has reports whether the blob exists for owner.
+func (b *FSBackend) Has(owner, name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(b.ownerDir(owner), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("stat chunk: %w", err)
+	}
+	return true, nil
+}
+
+// Delete removes the blob stored for owner under name. Deleting a
+// missing blob is not an error.
+func (b *FSBackend) Delete(owner, name string) error {
+	err := os.Remove(filepath.Join(b.ownerDir(owner), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("delete chunk: %w", err)
+	}
+	return nil
+}
+
+// List returns the names of owner's blobs starting with prefix, sorted,
+// skipping in-progress temp files.
+func (b *FSBackend) List(owner, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(b.ownerDir(owner))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("list owner %s: %w", owner, err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, tmpSuffix) || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Owners returns the owners with at least one stored blob.
+func (b *FSBackend) Owners() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list owners: %w", err)
+	}
+	var owners []string
+	for _, e := range entries {
+		if e.IsDir() {
+			owners = append(owners, e.Name())
+		}
+	}
+	return owners, nil
+}
+
+// RenameOwner moves the whole owner directory in one rename. An owner
+// with nothing stored has no directory, which is fine.
+func (b *FSBackend) RenameOwner(oldOwner, newOwner string) error {
+	err := os.Rename(b.ownerDir(oldOwner), b.ownerDir(newOwner))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Stat returns size and modification time of the blob.
+func (b *FSBackend) Stat(owner, name string) (BlobInfo, error) {
+	info, err := os.Stat(filepath.Join(b.ownerDir(owner), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlobInfo{}, fmt.Errorf("%w: %s/%s", ErrNotFound, owner, name)
+	} else if err != nil {
+		return BlobInfo{}, fmt.Errorf("stat chunk: %w", err)
+	}
+	return BlobInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// ReclaimStale deletes temp files older than ttl, left behind by
+// interrupted uploads, and reports how many files and bytes were
+// reclaimed. It walks one owner directory at a time, so it can run in
+// the background without holding anything up.
+func (b *FSBackend) ReclaimStale(ttl time.Duration) (files int, bytes int64, err error) {
+	owners, err := os.ReadDir(b.dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list owners: %w", err)
+	}
+	cutoff := time.Now().Add(-ttl)
+	for _, owner := range owners {
+		if !owner.IsDir() {
+			continue
+		}
+		dir := filepath.Join(b.dir, owner.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return files, bytes, fmt.Errorf("list %s: %w", owner.Name(), err)
+		}
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), tmpSuffix) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return files, bytes, fmt.Errorf("remove stale temp: %w", err)
+			}
+			files++
+			bytes += info.Size()
+		}
+	}
+	return files, bytes, nil
+}
+
+func (b *FSBackend) ownerDir(owner string) string {
+	return filepath.Join(b.dir, owner)
+}
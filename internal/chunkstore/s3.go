@@ -0,0 +1,294 @@
+package chunkstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3RequestTimeout bounds one request to the object store.
+const s3RequestTimeout = time.Minute
+
+// S3Config configures an S3-compatible backend (MinIO-style).
+type S3Config struct {
+	// Endpoint is the base URL of the object store, e.g.
+	// "https://minio.example.com:9000".
+	Endpoint string
+	// Bucket is the bucket blobs are stored in; it must already exist.
+	Bucket string
+	// AccessKey and SecretKey are the credentials.
+	AccessKey string
+	SecretKey string
+	// Region is the signing region; "us-east-1" when empty.
+	Region string
+}
+
+// S3Backend stores blobs as objects named "<owner>/<name>" in one
+// bucket, talking to the store directly with Signature Version 4
+// requests (path-style addressing).
+type S3Backend struct {
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+}
+
+// NewS3Backend creates a backend for cfg.
+func NewS3Backend(cfg S3Config) (*S3Backend, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 backend needs an endpoint and a bucket")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse s3 endpoint: %w", err)
+	}
+	return &S3Backend{
+		cfg:    cfg,
+		base:   base,
+		client: &http.Client{Timeout: s3RequestTimeout},
+	}, nil
+}
+
+// Put stores a blob for owner under name.
+func (b *S3Backend) Put(owner, name string, data []byte) error {
+	resp, err := b.do("PUT", b.objectKey(owner, name), nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return b.statusError("put", owner, name, resp)
+	}
+	return nil
+}
+
+// Get returns the blob stored for owner under name.
+func (b *S3Backend) Get(owner, name string) ([]byte, error) {
+	resp, err := b.do("GET", b.objectKey(owner, name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, owner, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, b.statusError("get", owner, name, resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read object body: %w", err)
+	}
+	return data, nil
+}
+
+// Has reports whether the blob exists for owner.
+func (b *S3Backend) Has(owner, name string) (bool, error) {
+	_, err := b.Stat(owner, name)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes the blob stored for owner under name. Deleting a
+// missing blob is not an error.
+func (b *S3Backend) Delete(owner, name string) error {
+	resp, err := b.do("DELETE", b.objectKey(owner, name), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return b.statusError("delete", owner, name, resp)
+}
+
+// listResult is the subset of the ListObjectsV2 response we read.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the names of owner's blobs starting with prefix, sorted.
+func (b *S3Backend) List(owner, prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {owner + "/" + prefix},
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := b.do("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := b.statusError("list", owner, prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode list response: %w", err)
+		}
+		for _, obj := range result.Contents {
+			names = append(names, strings.TrimPrefix(obj.Key, owner+"/"))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Stat returns size and modification time of the blob.
+func (b *S3Backend) Stat(owner, name string) (BlobInfo, error) {
+	resp, err := b.do("HEAD", b.objectKey(owner, name), nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return BlobInfo{}, fmt.Errorf("%w: %s/%s", ErrNotFound, owner, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return BlobInfo{}, b.statusError("stat", owner, name, resp)
+	}
+	info := BlobInfo{Size: resp.ContentLength}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			info.ModTime = t
+		}
+	}
+	return info, nil
+}
+
+func (b *S3Backend) objectKey(owner, name string) string {
+	return owner + "/" + name
+}
+
+func (b *S3Backend) statusError(op, owner, name string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s/%s: %s: %s", op, owner, name, resp.Status, bytes.TrimSpace(body))
+}
+
+// do sends one signed request for the object key (empty for the bucket
+// itself).
+func (b *S3Backend) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *b.base
+	u.Path = "/" + b.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build s3 request: %w", err)
+	}
+	b.sign(req, body, time.Now().UTC())
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request: %w", err)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (b *S3Backend) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + value + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHex,
+	}, "\n")
+
+	scope := strings.Join([]string{dateStamp, b.cfg.Region, "s3", "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(crHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+b.cfg.SecretKey), dateStamp)
+	key = hmacSHA256(key, b.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.cfg.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// canonicalQuery renders query parameters sorted by key, as SigV4
+// requires.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
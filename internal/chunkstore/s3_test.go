@@ -0,0 +1,194 @@
+package chunkstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory S3-compatible server covering the subset of
+// the API the backend uses: object PUT/GET/HEAD/DELETE and
+// ListObjectsV2, all path-style under one bucket.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, "missing signature", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket)
+	if !ok {
+		http.Error(w, "wrong bucket", http.StatusNotFound)
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.URL.Query().Get("list-type") == "2":
+		prefix := r.URL.Query().Get("prefix")
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", k)
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	case r.Method == http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "no such key", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+func startS3Store(t *testing.T) *Store {
+	t.Helper()
+	srv := httptest.NewServer(newFakeS3("chunks"))
+	t.Cleanup(srv.Close)
+	backend, err := NewS3Backend(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "chunks",
+		AccessKey: "test",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Backend: %v", err)
+	}
+	return New(backend)
+}
+
+func TestS3BackendRoundTrip(t *testing.T) {
+	s := startS3Store(t)
+	if err := s.Put("owner1", "aabb", []byte("data")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("owner1", "ccdd", []byte("more data")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !s.Has("owner1", "aabb") {
+		t.Error("Has = false after Put")
+	}
+	got, err := s.Get("owner1", "aabb")
+	if err != nil || string(got) != "data" {
+		t.Fatalf("Get: %q, %v", got, err)
+	}
+	names, err := s.List("owner1", "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(names) != 2 || names[0] != "aabb" || names[1] != "ccdd" {
+		t.Errorf("List = %v, want [aabb ccdd]", names)
+	}
+	if got := s.Usage("owner1"); got != int64(len("data")+len("more data")) {
+		t.Errorf("Usage = %d, want %d", got, len("data")+len("more data"))
+	}
+	if err := s.Delete("owner1", "aabb"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get("owner1", "aabb"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if got := s.Usage("owner1"); got != int64(len("more data")) {
+		t.Errorf("Usage after Delete = %d, want %d", got, len("more data"))
+	}
+}
+
+// flakyBackend fails every call until failures runs out.
+type flakyBackend struct {
+	*FSBackend
+	mu       sync.Mutex
+	failures int
+}
+
+func (b *flakyBackend) trip() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("transient backend error")
+	}
+	return nil
+}
+
+func (b *flakyBackend) Put(owner, name string, data []byte) error {
+	if err := b.trip(); err != nil {
+		return err
+	}
+	return b.FSBackend.Put(owner, name, data)
+}
+
+func (b *flakyBackend) Get(owner, name string) ([]byte, error) {
+	if err := b.trip(); err != nil {
+		return nil, err
+	}
+	return b.FSBackend.Get(owner, name)
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	fs, err := NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky := &flakyBackend{FSBackend: fs, failures: retryAttempts - 1}
+	s := New(flaky)
+	if err := s.Put("owner1", "aabb", []byte("data")); err != nil {
+		t.Fatalf("Put through flaky backend: %v", err)
+	}
+	flaky.mu.Lock()
+	flaky.failures = retryAttempts - 1
+	flaky.mu.Unlock()
+	if got, err := s.Get("owner1", "aabb"); err != nil || string(got) != "data" {
+		t.Fatalf("Get through flaky backend: %q, %v", got, err)
+	}
+	flaky.mu.Lock()
+	flaky.failures = retryAttempts
+	flaky.mu.Unlock()
+	if err := s.Put("owner1", "eeff", []byte("data")); err == nil {
+		t.Error("Put with persistent failures succeeded, want error")
+	}
+}
@@ -0,0 +1,334 @@
+// Package clitls manages the mutual-TLS credentials between the daemon
+// and bbcli. On startup the daemon generates fresh server and client
+// keys, writes the client's share into the cli-keys dir, and removes it
+// on shutdown; bbcli reads the dir to connect.
+package clitls
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+)
+
+const (
+	serverCertFile = "server.pub"
+	clientCertFile = "client.crt"
+	clientKeyFile  = "client.key"
+	endpointFile   = "endpoint"
+)
+
+// Roles a clirpc credential can carry, recorded in the client
+// certificate's common name. The admin credential is the cli-keys dir
+// the daemon writes at startup; readonly credentials are minted on
+// request for monitoring agents.
+const (
+	RoleAdmin    = "admin"
+	RoleReadonly = "readonly"
+)
+
+const (
+	adminCertCN    = "barterbackup-cli"
+	readonlyCertCN = "barterbackup-cli-readonly"
+)
+
+// RoleFromCert maps a clirpc client certificate to its role. Only the
+// daemon's own mints reach the trust pool, so an unexpected common name
+// can only mean a bug; it fails closed to readonly.
+func RoleFromCert(cert *x509.Certificate) string {
+	if cert.Subject.CommonName == adminCertCN {
+		return RoleAdmin
+	}
+	return RoleReadonly
+}
+
+// ServerKeys is the daemon's live clirpc TLS state. Besides the
+// credentials written at startup it tracks client certificates minted
+// later; the handshake consults the current trust pool every time.
+type ServerKeys struct {
+	cfg *tls.Config
+
+	mu   sync.Mutex
+	pool *x509.CertPool
+}
+
+// WriteKeys generates fresh daemon and client credentials, writes the
+// client's credentials and the server certificate into dir, and returns
+// the daemon's key state.
+func WriteKeys(dir string) (*ServerKeys, error) {
+	// Recreate the dir so credentials from a previous run never linger.
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("clean cli-keys dir: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cli-keys dir: %w", err)
+	}
+	// Another local user could slip a directory or symlink into the
+	// window between RemoveAll and MkdirAll and catch client.key;
+	// refuse to write into anything we did not just create ourselves.
+	if err := verifyPrivateDir(dir); err != nil {
+		return nil, err
+	}
+
+	serverCert, serverPEM, err := newCert("barterbackup-daemon")
+	if err != nil {
+		return nil, err
+	}
+	clientCert, clientPEM, err := newCert(adminCertCN)
+	if err != nil {
+		return nil, err
+	}
+	clientKeyPEM, err := keyPEM(clientCert)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{serverCertFile, serverPEM},
+		{clientCertFile, clientPEM},
+		{clientKeyFile, clientKeyPEM},
+	} {
+		path := filepath.Join(dir, f.name)
+		// O_EXCL: the dir was just verified empty and private, so
+		// anything already at the path is an attack, not state.
+		if err := atomicfile.WriteFileExclusive(path, f.data, 0o600); err != nil {
+			return nil, fmt.Errorf("write %s: %w", f.name, err)
+		}
+		if err := checkKeyFileMode(path); err != nil {
+			return nil, err
+		}
+	}
+
+	clientPool := x509.NewCertPool()
+	if !clientPool.AppendCertsFromPEM(clientPEM) {
+		return nil, fmt.Errorf("build client cert pool")
+	}
+	sk := &ServerKeys{pool: clientPool}
+	sk.cfg = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientPool,
+		MinVersion:   tls.VersionTLS13,
+		// Credentials minted after startup must be accepted without a
+		// listener restart, so each handshake sees the current pool.
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			sk.mu.Lock()
+			defer sk.mu.Unlock()
+			cfg := sk.cfg.Clone()
+			cfg.ClientCAs = sk.pool
+			return cfg, nil
+		},
+	}
+	return sk, nil
+}
+
+// TLSConfig returns the config for the daemon's clirpc listener.
+func (sk *ServerKeys) TLSConfig() *tls.Config {
+	return sk.cfg
+}
+
+// MintReadonly creates fresh readonly client credentials and adds them
+// to the trust pool. Like the admin credentials, they are valid until
+// the daemon restarts. It returns the certificate and key PEMs.
+func (sk *ServerKeys) MintReadonly() ([]byte, []byte, error) {
+	cert, certPEM, err := newCert(readonlyCertCN)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientKeyPEM, err := keyPEM(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	// Handshakes in flight hold a reference to the old pool; grow a copy
+	// instead of mutating it under them.
+	pool := sk.pool.Clone()
+	if !pool.AppendCertsFromPEM(certPEM) {
+		return nil, nil, fmt.Errorf("add minted certificate to pool")
+	}
+	sk.pool = pool
+	return certPEM, clientKeyPEM, nil
+}
+
+// ReadKeys loads the client credentials from dir and returns the TLS
+// config bbcli uses to dial the daemon.
+func ReadKeys(dir string) (*tls.Config, error) {
+	// A loose key silently grants every local user admin access to the
+	// daemon; refuse it with instructions instead of using it.
+	if err := checkKeyFileMode(filepath.Join(dir, clientKeyFile)); err != nil {
+		return nil, err
+	}
+	clientCert, err := tls.LoadX509KeyPair(
+		filepath.Join(dir, clientCertFile),
+		filepath.Join(dir, clientKeyFile),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load client credentials: %w", err)
+	}
+	serverPEM, err := os.ReadFile(filepath.Join(dir, serverCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("read server certificate: %w", err)
+	}
+	serverPool := x509.NewCertPool()
+	if !serverPool.AppendCertsFromPEM(serverPEM) {
+		return nil, fmt.Errorf("parse server certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      serverPool,
+		ServerName:   "barterbackup-daemon",
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// WriteEndpoint publishes the daemon's actual clirpc address next to
+// the credentials, so bbcli finds a daemon bound to an ephemeral port.
+// RemoveKeys cleans it up with the rest of the dir.
+func WriteEndpoint(dir, addr string) error {
+	if err := atomicfile.WriteFile(filepath.Join(dir, endpointFile), []byte(addr+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write endpoint: %w", err)
+	}
+	return nil
+}
+
+// ReadEndpoint returns the clirpc address the daemon published in dir.
+func ReadEndpoint(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, endpointFile))
+	if err != nil {
+		return "", fmt.Errorf("read endpoint: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// WriteMintedKeys writes credentials minted by the daemon into dir,
+// together with copies of the server certificate and the published
+// endpoint from srcDir, so dir works as a bbcli --keys-dir on its own.
+func WriteMintedKeys(dir, srcDir string, certPEM, keyPEM []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create keys dir: %w", err)
+	}
+	serverPEM, err := os.ReadFile(filepath.Join(srcDir, serverCertFile))
+	if err != nil {
+		return fmt.Errorf("read server certificate: %w", err)
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{serverCertFile, serverPEM},
+		{clientCertFile, certPEM},
+		{clientKeyFile, keyPEM},
+	}
+	// The endpoint copy is a convenience; without it the agent passes
+	// --daemon-addr itself.
+	if ep, err := os.ReadFile(filepath.Join(srcDir, endpointFile)); err == nil {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{endpointFile, ep})
+	}
+	for _, f := range files {
+		if err := atomicfile.WriteFile(filepath.Join(dir, f.name), f.data, 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// RemoveKeys deletes the cli-keys dir.
+func RemoveKeys(dir string) error {
+	return os.RemoveAll(dir)
+}
+
+// verifyPrivateDir ensures dir itself — not a symlink planted in its
+// place — is a directory owned by this user with mode 0700.
+func verifyPrivateDir(dir string) error {
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return fmt.Errorf("open cli-keys dir %s (a planted symlink?): %w", dir, err)
+	}
+	defer unix.Close(fd)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat cli-keys dir %s: %w", dir, err)
+	}
+	if int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("cli-keys dir %s is owned by uid %d, not this user (uid %d); remove it and restart", dir, st.Uid, os.Getuid())
+	}
+	if perm := st.Mode & 0o777; perm != 0o700 {
+		return fmt.Errorf("cli-keys dir %s has mode %#o, want 0700; remove it and restart", dir, perm)
+	}
+	return nil
+}
+
+// checkKeyFileMode rejects a credential file that is not a plain 0600
+// regular file, with instructions on how to fix it.
+func checkKeyFileMode(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file; remove it and restart the daemon", path)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("%s is accessible by other users (mode %#o); run: chmod 600 %s", path, perm, path)
+	}
+	return nil
+}
+
+// newCert generates an Ed25519 key pair and a self-signed certificate
+// for it.
+func newCert(commonName string) (tls.Certificate, []byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("serial: %w", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("create certificate: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}, certPEM, nil
+}
+
+// keyPEM encodes the certificate's private key as PKCS#8 PEM.
+func keyPEM(cert tls.Certificate) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
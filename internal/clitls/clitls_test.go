@@ -0,0 +1,83 @@
+package clitls
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteKeysTightModes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cli-keys")
+	if _, err := WriteKeys(dir); err != nil {
+		t.Fatalf("WriteKeys: %v", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("dir mode = %#o, want 0700", perm)
+	}
+	for _, name := range []string{serverCertFile, clientCertFile, clientKeyFile} {
+		info, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Errorf("%s is not a regular file", name)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("%s mode = %#o, want 0600", name, perm)
+		}
+	}
+	if _, err := ReadKeys(dir); err != nil {
+		t.Errorf("ReadKeys after WriteKeys: %v", err)
+	}
+}
+
+func TestVerifyPrivateDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPrivateDir(dir); err != nil {
+		t.Errorf("private dir: %v", err)
+	}
+
+	// A symlink planted where the cli-keys dir should be must not be
+	// followed, even when it points at a harmless directory.
+	link := filepath.Join(t.TempDir(), "cli-keys")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPrivateDir(link); err == nil {
+		t.Error("symlinked dir passed verification")
+	}
+
+	loose := t.TempDir()
+	if err := os.Chmod(loose, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPrivateDir(loose); err == nil {
+		t.Error("group/world-readable dir passed verification")
+	}
+}
+
+func TestReadKeysRejectsLooseKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cli-keys")
+	if _, err := WriteKeys(dir); err != nil {
+		t.Fatalf("WriteKeys: %v", err)
+	}
+	keyPath := filepath.Join(dir, clientKeyFile)
+	if err := os.Chmod(keyPath, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadKeys(dir)
+	if err == nil {
+		t.Fatal("ReadKeys accepted a world-readable client key")
+	}
+	if !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("error %q does not tell the user how to fix the mode", err)
+	}
+}
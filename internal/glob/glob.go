@@ -0,0 +1,94 @@
+// Package glob matches slash-separated relative paths against
+// gitignore-style patterns. Within one path segment '*' matches any
+// run of characters, '?' one character, and '[...]' a character class;
+// a segment of '**' matches any number of segments, including none,
+// except that a trailing '**' matches a directory's contents and not
+// the directory itself. A pattern containing a slash is anchored at
+// the root the paths are relative to; one without a slash matches the
+// base name at any depth.
+package glob
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Pattern is one compiled pattern.
+type Pattern struct {
+	raw      string
+	segments []string
+	anchored bool
+}
+
+// Compile validates raw and returns the pattern. Invalid syntax — an
+// empty pattern, empty segments, an unclosed character class, or '**'
+// glued to other characters — is reported here, so callers can reject
+// bad patterns before acting on any of them.
+func Compile(raw string) (*Pattern, error) {
+	trimmed := strings.TrimSuffix(raw, "/")
+	if trimmed == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	segments := strings.Split(trimmed, "/")
+	for _, seg := range segments {
+		if seg == "" {
+			return nil, fmt.Errorf("empty path segment")
+		}
+		if seg == "**" {
+			continue
+		}
+		if strings.Contains(seg, "**") {
+			return nil, fmt.Errorf("** must be a path segment of its own")
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	return &Pattern{raw: raw, segments: segments, anchored: len(segments) > 1}, nil
+}
+
+// String returns the pattern as given to Compile.
+func (p *Pattern) String() string { return p.raw }
+
+// Match reports whether the slash-separated relative path matches.
+func (p *Pattern) Match(rel string) bool {
+	parts := strings.Split(rel, "/")
+	if !p.anchored {
+		return matchSegment(p.segments[0], parts[len(parts)-1])
+	}
+	return matchSegments(p.segments, parts)
+}
+
+// matchSegments matches a segment-wise pattern against path parts,
+// letting '**' swallow zero or more parts.
+func matchSegments(pat, parts []string) bool {
+	if len(pat) == 0 {
+		return len(parts) == 0
+	}
+	if pat[0] == "**" {
+		if len(pat) == 1 {
+			// A trailing '**' means "everything inside": gitignore's
+			// 'dir/**' matches the dir's contents, not the dir itself.
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pat[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	return matchSegment(pat[0], parts[0]) && matchSegments(pat[1:], parts[1:])
+}
+
+// matchSegment matches one pattern segment against one path part.
+// Compile already rejected malformed segments, so path.Match cannot
+// fail here.
+func matchSegment(pat, part string) bool {
+	ok, _ := path.Match(pat, part)
+	return ok
+}
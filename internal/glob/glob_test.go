@@ -0,0 +1,53 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// Unanchored patterns match the base name at any depth.
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "deep/nested/a.tmp", true},
+		{"*.tmp", "a.tmp/inner", false},
+		{"node_modules", "node_modules", true},
+		{"node_modules", "pkg/node_modules", true},
+		{"file?.go", "file1.go", true},
+		{"file?.go", "file10.go", false},
+		// Anchored patterns match from the root.
+		{".cache/**", ".cache/a", true},
+		{".cache/**", ".cache/a/b/c", true},
+		{".cache/**", ".cache", false},
+		{".cache/**", "home/.cache/a", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**/*.md", "docs/a.md", true},
+		{"docs/**/*.md", "docs/sub/deep/a.md", true},
+		{"docs/**/*.md", "docs/a.txt", false},
+		{"**/build", "build", true},
+		{"**/build", "a/b/build", true},
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+		// A trailing slash (gitignore's directory marker) is tolerated.
+		{"vendor/", "vendor", true},
+	}
+	for _, c := range cases {
+		p, err := Compile(c.pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", c.pattern, err)
+		}
+		if got := p.Match(c.path); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, pattern := range []string{"", "/", "a//b", "a**", "**.iso", "[unclosed"} {
+		if _, err := Compile(pattern); err == nil {
+			t.Errorf("Compile(%q) succeeded, want error", pattern)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package hashid implements the multihash-style chunk identifiers used
+// in manifests, chunk blob names, and the peer RPCs: one algorithm id
+// byte followed by the digest, hex-encoded. Identifiers carry their own
+// algorithm, so stores mixing backups hashed with different algorithms
+// need no out-of-band negotiation. Bare 32-byte identifiers written
+// before prefixing existed are SHA-256; they parse unchanged, which is
+// the whole migration story — blob names are immutable once uploaded,
+// so on-disk data is never rewritten.
+package hashid
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"lukechampine.com/blake3"
+)
+
+// Algorithm ids, the first byte of a prefixed identifier.
+const (
+	AlgSHA256 byte = 0x01
+	AlgBLAKE3 byte = 0x02
+)
+
+// Algorithm names, as they appear in manifests and the backup options.
+const (
+	NameSHA256 = "sha256"
+	NameBLAKE3 = "blake3"
+)
+
+// digestSize is the digest length of every supported algorithm; both
+// SHA-256 and BLAKE3 produce 32 bytes.
+const digestSize = sha256.Size
+
+// ErrUnknownAlgorithm marks an identifier whose algorithm id this build
+// does not implement. It is distinct from corruption: the identifier is
+// well-formed, the binary is too old for it.
+var ErrUnknownAlgorithm = errors.New("unknown hash algorithm")
+
+// AlgByName resolves an algorithm name from a manifest or the backup
+// options. The empty name is SHA-256, the only algorithm that existed
+// before hashing was configurable.
+func AlgByName(name string) (byte, error) {
+	switch name {
+	case "", NameSHA256:
+		return AlgSHA256, nil
+	case NameBLAKE3:
+		return AlgBLAKE3, nil
+	default:
+		return 0, fmt.Errorf("%w: %q (want %s or %s)", ErrUnknownAlgorithm, name, NameSHA256, NameBLAKE3)
+	}
+}
+
+// NameOf returns the configuration name of alg.
+func NameOf(alg byte) (string, error) {
+	switch alg {
+	case AlgSHA256:
+		return NameSHA256, nil
+	case AlgBLAKE3:
+		return NameBLAKE3, nil
+	default:
+		return "", fmt.Errorf("%w: 0x%02x", ErrUnknownAlgorithm, alg)
+	}
+}
+
+// Sum returns the prefixed identifier of data under alg.
+func Sum(alg byte, data []byte) (string, error) {
+	digest, err := digest(alg, data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(append([]byte{alg}, digest...)), nil
+}
+
+func digest(alg byte, data []byte) ([]byte, error) {
+	switch alg {
+	case AlgSHA256:
+		sum := sha256.Sum256(data)
+		return sum[:], nil
+	case AlgBLAKE3:
+		sum := blake3.Sum256(data)
+		return sum[:], nil
+	default:
+		return nil, fmt.Errorf("%w: 0x%02x", ErrUnknownAlgorithm, alg)
+	}
+}
+
+// Parse splits an identifier into its algorithm and digest. A bare
+// digest-sized identifier from before prefixing is SHA-256. Unknown
+// algorithm ids are reported as ErrUnknownAlgorithm, not as corruption.
+func Parse(id string) (alg byte, dig []byte, err error) {
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("malformed chunk identifier %q: %v", id, err)
+	}
+	switch len(raw) {
+	case digestSize:
+		return AlgSHA256, raw, nil
+	case 1 + digestSize:
+		switch raw[0] {
+		case AlgSHA256, AlgBLAKE3:
+			return raw[0], raw[1:], nil
+		default:
+			return 0, nil, fmt.Errorf("chunk identifier %q: %w: 0x%02x", id, ErrUnknownAlgorithm, raw[0])
+		}
+	default:
+		return 0, nil, fmt.Errorf("malformed chunk identifier %q: %d bytes", id, len(raw))
+	}
+}
+
+// Matches reports whether data hashes to id under id's own algorithm.
+func Matches(id string, data []byte) (bool, error) {
+	alg, want, err := Parse(id)
+	if err != nil {
+		return false, err
+	}
+	got, err := digest(alg, data)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,76 @@
+package hashid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSumAndMatches(t *testing.T) {
+	data := []byte("chunk plaintext")
+	for _, alg := range []byte{AlgSHA256, AlgBLAKE3} {
+		id, err := Sum(alg, data)
+		if err != nil {
+			t.Fatalf("Sum(0x%02x): %v", alg, err)
+		}
+		if !strings.HasPrefix(id, hex.EncodeToString([]byte{alg})) {
+			t.Errorf("Sum(0x%02x) = %s, want algorithm prefix", alg, id)
+		}
+		if ok, err := Matches(id, data); err != nil || !ok {
+			t.Errorf("Matches(%s) = %v, %v", id, ok, err)
+		}
+		if ok, _ := Matches(id, []byte("other")); ok {
+			t.Errorf("Matches(%s, other) = true", id)
+		}
+	}
+	// The two algorithms must not collide on the same input.
+	a, _ := Sum(AlgSHA256, data)
+	b, _ := Sum(AlgBLAKE3, data)
+	if a[2:] == b[2:] {
+		t.Error("SHA-256 and BLAKE3 digests are equal")
+	}
+}
+
+func TestParseLegacyIdentifier(t *testing.T) {
+	// Unprefixed identifiers written before hash agility are SHA-256.
+	data := []byte("old chunk")
+	sum := sha256.Sum256(data)
+	legacy := hex.EncodeToString(sum[:])
+	alg, dig, err := Parse(legacy)
+	if err != nil {
+		t.Fatalf("Parse(legacy): %v", err)
+	}
+	if alg != AlgSHA256 || hex.EncodeToString(dig) != legacy {
+		t.Errorf("Parse(legacy) = 0x%02x, %x", alg, dig)
+	}
+	if ok, err := Matches(legacy, data); err != nil || !ok {
+		t.Errorf("Matches(legacy) = %v, %v", ok, err)
+	}
+}
+
+func TestParseRejectsUnknownAlgorithm(t *testing.T) {
+	id := "7f" + strings.Repeat("ab", 32)
+	if _, _, err := Parse(id); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Parse(unknown alg): %v, want ErrUnknownAlgorithm", err)
+	}
+	if _, _, err := Parse("zz"); err == nil || errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Parse(garbage): %v, want a malformed error", err)
+	}
+	if _, _, err := Parse("abcd"); err == nil || errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Parse(short): %v, want a malformed error", err)
+	}
+}
+
+func TestAlgByName(t *testing.T) {
+	if alg, err := AlgByName(""); err != nil || alg != AlgSHA256 {
+		t.Errorf("AlgByName(\"\") = 0x%02x, %v", alg, err)
+	}
+	if alg, err := AlgByName(NameBLAKE3); err != nil || alg != AlgBLAKE3 {
+		t.Errorf("AlgByName(blake3) = 0x%02x, %v", alg, err)
+	}
+	if _, err := AlgByName("md5"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("AlgByName(md5): %v, want ErrUnknownAlgorithm", err)
+	}
+}
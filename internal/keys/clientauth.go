@@ -0,0 +1,40 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"fmt"
+
+	"filippo.io/edwards25519"
+)
+
+// Tor v3 client authorization uses x25519 key pairs. A node's auth key
+// pair is the x25519 form of its Ed25519 onion key, so peers can compute
+// each other's auth public keys from onion addresses alone.
+
+// CurveAuthPrivFromOnionKey returns the x25519 secret scalar
+// corresponding to an Ed25519 onion key, for presenting ourselves to
+// services that require client authorization.
+func CurveAuthPrivFromOnionKey(key ed25519.PrivateKey) []byte {
+	h := sha512.Sum512(key.Seed())
+	s := h[:32]
+	s[0] &= 248
+	s[31] &= 127
+	s[31] |= 64
+	return s
+}
+
+// CurveAuthPubFromOnion returns the x25519 public key corresponding to
+// the Ed25519 key encoded in a v3 onion address, for authorizing that
+// peer on our onion service.
+func CurveAuthPubFromOnion(addr string) ([]byte, error) {
+	pub, err := PubKeyFromOnion(addr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := new(edwards25519.Point).SetBytes(pub)
+	if err != nil {
+		return nil, fmt.Errorf("onion key of %s is not a valid curve point: %w", addr, err)
+	}
+	return p.BytesMontgomery(), nil
+}
@@ -0,0 +1,88 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// MasterKeySize is the size of the master secret derived from the
+// password. Everything else (onion key, backup keys, ticket keys) is
+// derived from it via HKDF with distinct info strings.
+const MasterKeySize = 32
+
+// Argon2 parameters for the password KDF. Changing any of these changes
+// every user's onion address; see the frozen test vectors before touching.
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+)
+
+var argonSalt = []byte("barterbackup/master/v1")
+
+// DeriveMasterPriv derives the master secret from the password. It is
+// deliberately expensive (Argon2id, 64 MiB).
+func DeriveMasterPriv(password []byte) []byte {
+	return argon2.IDKey(password, argonSalt, argonTime, argonMemory, argonThreads, MasterKeySize)
+}
+
+// OnionKeyFromMaster derives the node's Ed25519 onion identity key from
+// the master secret.
+func OnionKeyFromMaster(master []byte) (ed25519.PrivateKey, error) {
+	seed, err := Expand(master, "barterbackup/onion/v1", ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// OnionKeyFromSeed derives the node's Ed25519 onion identity key
+// straight from the seed (the node password), running the whole
+// password → master → onion key chain.
+func OnionKeyFromSeed(seed string) (ed25519.PrivateKey, error) {
+	return OnionKeyFromMaster(DeriveMasterPriv([]byte(seed)))
+}
+
+// OnionAddressFromSeed returns the onion address a node with the given
+// seed is published at. It is the one implementation of the full
+// identity chain (Argon2 → HKDF → Ed25519 → v3 onion ID); the frozen
+// test vectors pin its output, because any change orphans every
+// existing identity.
+func OnionAddressFromSeed(seed string) (string, error) {
+	key, err := OnionKeyFromSeed(seed)
+	if err != nil {
+		return "", err
+	}
+	return OnionAddress(key.Public().(ed25519.PublicKey)), nil
+}
+
+// DHKeyFromMaster derives the node's X25519 key pair used to establish
+// per-agreement shared secrets with peers.
+func DHKeyFromMaster(master []byte) (priv, pub []byte, err error) {
+	priv, err = Expand(master, "barterbackup/agreement-dh/v1", curve25519.ScalarSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err = curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("derive dh public key: %w", err)
+	}
+	return priv, pub, nil
+}
+
+// Expand derives size bytes from the master secret for the given purpose.
+// Distinct info strings yield independent keys.
+func Expand(master []byte, info string, size int) ([]byte, error) {
+	r := hkdf.New(sha256.New, master, nil, []byte(info))
+	out := make([]byte, size)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, fmt.Errorf("hkdf expand %q: %w", info, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+// TestOnionAddressFromSeedVectors pins the full identity chain
+// (Argon2 → HKDF → Ed25519 → v3 onion ID) with frozen vectors. The
+// onion address IS the node's identity: if a refactor changes any of
+// these outputs, every existing user's identity is orphaned. Do not
+// update the expected values; fix the code instead.
+func TestOnionAddressFromSeedVectors(t *testing.T) {
+	vectors := []struct {
+		name string
+		seed string
+		want string
+	}{
+		{
+			name: "empty",
+			seed: "",
+			want: "35hufokungml63dmvgci3u3wsftb2ikxendlkvttfqz35exgzy6esaid.onion",
+		},
+		{
+			name: "ascii",
+			seed: "correct horse battery staple",
+			want: "oh3flpntphuoxuuvkh4537xehj5bv3gjehziglxce3gdlfgouwkp3wid.onion",
+		},
+		{
+			name: "unicode",
+			seed: "pässwört-密码-\U0001f511",
+			want: "u36c3ifedgqpwyejscdwddeusjtmkdbnph7c3yktgptc3o53ccwxnyyd.onion",
+		},
+	}
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			got, err := OnionAddressFromSeed(v.seed)
+			if err != nil {
+				t.Fatalf("OnionAddressFromSeed(%q): %v", v.seed, err)
+			}
+			if got != v.want {
+				t.Errorf("OnionAddressFromSeed(%q) = %s, want %s", v.seed, got, v.want)
+			}
+		})
+	}
+}
+
+// TestOnionAddressFromSeedConsistent checks the convenience wrapper
+// against the pieces it is built from.
+func TestOnionAddressFromSeedConsistent(t *testing.T) {
+	const seed = "some password"
+	addr, err := OnionAddressFromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := OnionKeyFromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := OnionAddress(key.Public().(ed25519.PublicKey)); got != addr {
+		t.Errorf("OnionAddress(pub) = %s, OnionAddressFromSeed = %s", got, addr)
+	}
+	pub, err := PubKeyFromOnion(addr)
+	if err != nil {
+		t.Fatalf("PubKeyFromOnion(%s): %v", addr, err)
+	}
+	if !pub.Equal(key.Public().(ed25519.PublicKey)) {
+		t.Error("public key recovered from the address does not match the derived key")
+	}
+}
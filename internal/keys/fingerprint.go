@@ -0,0 +1,168 @@
+package keys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+)
+
+// fingerprintInfo is the HKDF info string for the master-secret
+// fingerprint. Changing it orphans every recorded fingerprint file.
+const fingerprintInfo = "barterbackup/fingerprint/v1"
+
+// FingerprintSize is the size of the raw fingerprint in bytes.
+const FingerprintSize = 16
+
+// fingerprintSaltSize is the per-file salt length in the salted on-disk
+// format.
+const fingerprintSaltSize = 16
+
+// fingerprintHeader introduces the salted on-disk format:
+//
+//	barterbackup-fingerprint-v2 <salt-hex> <hmac-sha256(salt, fingerprint)-hex>
+//
+// The legacy format stored the bare fingerprint hex, a stable
+// identifier that linked data dirs belonging to the same password. The
+// salted form still detects a wrong password but the file by itself
+// identifies nothing.
+const fingerprintHeader = "barterbackup-fingerprint-v2"
+
+// A Fingerprint is a short stable identifier of a master secret, used
+// to check a password against a data dir without storing anything
+// secret in it.
+type Fingerprint struct {
+	raw [FingerprintSize]byte
+}
+
+// ComputeFingerprint derives the fingerprint of a master secret.
+func ComputeFingerprint(master []byte) Fingerprint {
+	var f Fingerprint
+	fp, _ := Expand(master, fingerprintInfo, FingerprintSize)
+	copy(f.raw[:], fp)
+	return f
+}
+
+// FingerprintFromHex parses the hex form returned by Hex. Upper-case
+// hex is accepted: fingerprint files get pasted around by hand.
+func FingerprintFromHex(s string) (Fingerprint, error) {
+	var f Fingerprint
+	raw, err := hex.DecodeString(strings.ToLower(strings.TrimSpace(s)))
+	if err != nil || len(raw) != FingerprintSize {
+		return f, fmt.Errorf("malformed fingerprint %q", s)
+	}
+	copy(f.raw[:], raw)
+	return f, nil
+}
+
+// Hex returns the lower-case hex form of the fingerprint.
+func (f Fingerprint) Hex() string {
+	return hex.EncodeToString(f.raw[:])
+}
+
+// A FingerprintOutcome is the result of checking a fingerprint against
+// the file recorded in a data dir. The zero value is reserved for "the
+// check did not complete"; callers must branch on the returned error
+// then.
+type FingerprintOutcome int
+
+const (
+	// FingerprintMatch: the file exists and records this fingerprint.
+	FingerprintMatch FingerprintOutcome = iota + 1
+	// FingerprintMismatch: the file is well-formed but records a
+	// different fingerprint — the wrong-password case.
+	FingerprintMismatch
+	// FingerprintCreated: no file existed; this fingerprint was
+	// recorded as the dir's first.
+	FingerprintCreated
+	// FingerprintFormatError: the file exists but is neither the
+	// salted nor the legacy format, so no comparison is possible.
+	FingerprintFormatError
+)
+
+// String returns the outcome name for logs and errors.
+func (o FingerprintOutcome) String() string {
+	switch o {
+	case FingerprintMatch:
+		return "match"
+	case FingerprintMismatch:
+		return "mismatch"
+	case FingerprintCreated:
+		return "created"
+	case FingerprintFormatError:
+		return "format error"
+	}
+	return "unknown"
+}
+
+// VerifyAgainstFile checks the fingerprint against the file at path,
+// recording it there on first use and rewriting a matching legacy file
+// (bare fingerprint hex) in the salted format. Trailing whitespace and
+// CRLF line endings are tolerated: the legacy file was plain enough to
+// invite hand edits. A zero outcome with a non-nil error means the file
+// could not be read or written, which says nothing about the password.
+func (f Fingerprint) VerifyAgainstFile(path string) (FingerprintOutcome, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := f.WriteFile(path); err != nil {
+			return 0, err
+		}
+		return FingerprintCreated, nil
+	} else if err != nil {
+		return 0, err
+	}
+	line := strings.TrimSpace(string(data))
+	if fields := strings.Fields(line); len(fields) > 0 && fields[0] == fingerprintHeader {
+		if len(fields) != 3 {
+			return FingerprintFormatError, fmt.Errorf("fingerprint file %s: want 3 fields, got %d", path, len(fields))
+		}
+		salt, err1 := hex.DecodeString(fields[1])
+		digest, err2 := hex.DecodeString(fields[2])
+		if err1 != nil || err2 != nil || len(salt) != fingerprintSaltSize || len(digest) != sha256.Size {
+			return FingerprintFormatError, fmt.Errorf("fingerprint file %s: malformed salt or digest", path)
+		}
+		if !hmac.Equal(digest, saltedFingerprint(salt, f.raw[:])) {
+			return FingerprintMismatch, nil
+		}
+		return FingerprintMatch, nil
+	}
+	// Legacy format: the bare fingerprint hex written by early builds.
+	recorded, err := FingerprintFromHex(line)
+	if err != nil {
+		return FingerprintFormatError, fmt.Errorf("fingerprint file %s: neither salted nor legacy format", path)
+	}
+	if !hmac.Equal(recorded.raw[:], f.raw[:]) {
+		return FingerprintMismatch, nil
+	}
+	// A matching legacy file is upgraded in place; failing to rewrite
+	// it would leave the linkable form on disk indefinitely.
+	if err := f.WriteFile(path); err != nil {
+		return 0, fmt.Errorf("upgrade fingerprint file: %w", err)
+	}
+	return FingerprintMatch, nil
+}
+
+// WriteFile records the fingerprint at path in the salted format,
+// replacing whatever was there. Each call picks a fresh salt, so two
+// data dirs with the same password still get distinct files.
+func (f Fingerprint) WriteFile(path string) error {
+	salt := make([]byte, fingerprintSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("generate fingerprint salt: %w", err)
+	}
+	line := fmt.Sprintf("%s %x %x\n", fingerprintHeader, salt, saltedFingerprint(salt, f.raw[:]))
+	return atomicfile.WriteFile(path, []byte(line), 0o600)
+}
+
+func saltedFingerprint(salt, fp []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(fp)
+	return mac.Sum(nil)
+}
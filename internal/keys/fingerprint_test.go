@@ -0,0 +1,172 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintHexRoundTrip(t *testing.T) {
+	f := ComputeFingerprint([]byte("some master secret"))
+	got, err := FingerprintFromHex(f.Hex())
+	if err != nil {
+		t.Fatalf("FingerprintFromHex(%q): %v", f.Hex(), err)
+	}
+	if got != f {
+		t.Errorf("round trip changed fingerprint: %s != %s", got.Hex(), f.Hex())
+	}
+	if _, err := FingerprintFromHex("abcd1234"); err == nil {
+		t.Error("FingerprintFromHex accepted a truncated fingerprint")
+	}
+	if _, err := FingerprintFromHex("not hex at all"); err == nil {
+		t.Error("FingerprintFromHex accepted garbage")
+	}
+}
+
+func TestFingerprintVerifyAgainstFile(t *testing.T) {
+	f := ComputeFingerprint([]byte("the right master secret"))
+	other := ComputeFingerprint([]byte("a different master secret"))
+	path := filepath.Join(t.TempDir(), "fingerprint.txt")
+
+	// First use records the fingerprint in the salted format.
+	outcome, err := f.VerifyAgainstFile(path)
+	if err != nil || outcome != FingerprintCreated {
+		t.Fatalf("first verify = %v, %v; want created", outcome, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), fingerprintHeader+" ") {
+		t.Fatalf("created file %q is not in the salted format", data)
+	}
+	if strings.Contains(string(data), f.Hex()) {
+		t.Errorf("salted file %q contains the bare fingerprint", data)
+	}
+
+	// The same fingerprint matches; a different one does not.
+	if outcome, err := f.VerifyAgainstFile(path); err != nil || outcome != FingerprintMatch {
+		t.Errorf("second verify = %v, %v; want match", outcome, err)
+	}
+	if outcome, err := other.VerifyAgainstFile(path); err != nil || outcome != FingerprintMismatch {
+		t.Errorf("wrong-password verify = %v, %v; want mismatch", outcome, err)
+	}
+}
+
+func TestFingerprintVerifyLegacyFile(t *testing.T) {
+	f := ComputeFingerprint([]byte("legacy master secret"))
+	other := ComputeFingerprint([]byte("another master secret"))
+
+	// Hand-written variants of the legacy bare-hex format: early
+	// builds wrote no newline, and users pasted the value with CRLF,
+	// trailing whitespace, or upper-case hex.
+	variants := []struct {
+		name string
+		body string
+	}{
+		{"bare", f.Hex()},
+		{"newline", f.Hex() + "\n"},
+		{"crlf", f.Hex() + "\r\n"},
+		{"trailing space", f.Hex() + " \t\n"},
+		{"upper case", strings.ToUpper(f.Hex()) + "\n"},
+	}
+	for _, v := range variants {
+		t.Run(v.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fingerprint.txt")
+			if err := os.WriteFile(path, []byte(v.body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			outcome, err := f.VerifyAgainstFile(path)
+			if err != nil || outcome != FingerprintMatch {
+				t.Fatalf("verify = %v, %v; want match", outcome, err)
+			}
+			// A matching legacy file is upgraded in place.
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), fingerprintHeader+" ") {
+				t.Errorf("file %q was not upgraded to the salted format", data)
+			}
+			if outcome, err := f.VerifyAgainstFile(path); err != nil || outcome != FingerprintMatch {
+				t.Errorf("verify after upgrade = %v, %v; want match", outcome, err)
+			}
+		})
+	}
+
+	// A mismatching legacy file is reported but left alone: rewriting
+	// it would destroy the evidence of which identity owns the dir.
+	path := filepath.Join(t.TempDir(), "fingerprint.txt")
+	if err := os.WriteFile(path, []byte(f.Hex()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if outcome, err := other.VerifyAgainstFile(path); err != nil || outcome != FingerprintMismatch {
+		t.Fatalf("legacy mismatch verify = %v, %v; want mismatch", outcome, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != f.Hex()+"\n" {
+		t.Errorf("mismatch rewrote the file to %q", data)
+	}
+}
+
+func TestFingerprintVerifyCorruptedFile(t *testing.T) {
+	f := ComputeFingerprint([]byte("master secret"))
+	bodies := []struct {
+		name string
+		body string
+	}{
+		{"garbage", "this is not a fingerprint\n"},
+		{"truncated hex", "abcd1234\n"},
+		{"wrong field count", fingerprintHeader + " deadbeef\n"},
+		{"bad salt hex", fingerprintHeader + " nothex " + strings.Repeat("ab", 32) + "\n"},
+		{"short digest", fingerprintHeader + " " + strings.Repeat("ab", 16) + " abcd\n"},
+	}
+	for _, b := range bodies {
+		t.Run(b.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fingerprint.txt")
+			if err := os.WriteFile(path, []byte(b.body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			outcome, err := f.VerifyAgainstFile(path)
+			if outcome != FingerprintFormatError {
+				t.Errorf("verify = %v, %v; want format error", outcome, err)
+			}
+			if err == nil {
+				t.Error("format error came with a nil error")
+			}
+		})
+	}
+}
+
+func TestFingerprintWriteFileFreshSalt(t *testing.T) {
+	f := ComputeFingerprint([]byte("master secret"))
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := f.WriteFile(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.WriteFile(b); err != nil {
+		t.Fatal(err)
+	}
+	da, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := os.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(da) == string(db) {
+		t.Errorf("two writes produced identical files %q; salts must differ", da)
+	}
+	for _, p := range []string{a, b} {
+		if outcome, err := f.VerifyAgainstFile(p); err != nil || outcome != FingerprintMatch {
+			t.Errorf("verify %s = %v, %v; want match", p, outcome, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package keys derives node identity material: the master secret from a
+// password, the Ed25519 onion key from the master secret, and the v3 onion
+// address from the public key.
+package keys
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// onionVersion is the v3 onion service version byte appended to the
+// address payload before base32 encoding.
+const onionVersion = 0x03
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// OnionAddress returns the v3 onion hostname (including the ".onion"
+// suffix) for an Ed25519 public key, per rend-spec-v3 appendix A.2.
+func OnionAddress(pub ed25519.PublicKey) string {
+	checksum := onionChecksum(pub)
+	payload := make([]byte, 0, ed25519.PublicKeySize+3)
+	payload = append(payload, pub...)
+	payload = append(payload, checksum[:2]...)
+	payload = append(payload, onionVersion)
+	return strings.ToLower(b32.EncodeToString(payload)) + ".onion"
+}
+
+// PubKeyFromOnion recovers the Ed25519 public key encoded in a v3 onion
+// address, verifying the embedded checksum and version byte.
+func PubKeyFromOnion(addr string) (ed25519.PublicKey, error) {
+	host := strings.TrimSuffix(addr, ".onion")
+	payload, err := b32.DecodeString(strings.ToUpper(host))
+	if err != nil {
+		return nil, fmt.Errorf("decode onion address %q: %w", addr, err)
+	}
+	if len(payload) != ed25519.PublicKeySize+3 {
+		return nil, fmt.Errorf("onion address %q: wrong length", addr)
+	}
+	pub := ed25519.PublicKey(payload[:ed25519.PublicKeySize])
+	if payload[ed25519.PublicKeySize+2] != onionVersion {
+		return nil, fmt.Errorf("onion address %q: unsupported version %d", addr, payload[ed25519.PublicKeySize+2])
+	}
+	checksum := onionChecksum(pub)
+	if !bytes.Equal(payload[ed25519.PublicKeySize:ed25519.PublicKeySize+2], checksum[:2]) {
+		return nil, fmt.Errorf("onion address %q: bad checksum", addr)
+	}
+	return pub, nil
+}
+
+func onionChecksum(pub ed25519.PublicKey) [32]byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pub)
+	h.Write([]byte{onionVersion})
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
@@ -0,0 +1,29 @@
+package keys
+
+import "crypto/ed25519"
+
+// onionProofDomain separates onion ownership proofs from every other
+// signature the identity key makes (TLS handshakes, address-change
+// notices), so a proof can never be replayed as something else.
+const onionProofDomain = "barterbackup/onion-proof/v1\n"
+
+// SignOnionProof signs a server-issued challenge nonce with the onion
+// identity key, proving the signer controls the onion address derived
+// from that key.
+func SignOnionProof(priv ed25519.PrivateKey, nonce []byte) []byte {
+	return ed25519.Sign(priv, onionProofMessage(nonce))
+}
+
+// VerifyOnionProof reports whether sig proves control of the identity
+// key behind the onion address addr over the challenge nonce.
+func VerifyOnionProof(addr string, nonce, sig []byte) bool {
+	pub, err := PubKeyFromOnion(addr)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, onionProofMessage(nonce), sig)
+}
+
+func onionProofMessage(nonce []byte) []byte {
+	return append([]byte(onionProofDomain), nonce...)
+}
@@ -0,0 +1,47 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestOnionProofRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := OnionAddress(pub)
+	nonce := []byte("0123456789abcdef0123456789abcdef")
+	sig := SignOnionProof(priv, nonce)
+	if !VerifyOnionProof(addr, nonce, sig) {
+		t.Error("valid proof did not verify")
+	}
+	if VerifyOnionProof(addr, []byte("another nonce another nonce here"), sig) {
+		t.Error("proof verified against a different nonce")
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyOnionProof(OnionAddress(otherPub), nonce, sig) {
+		t.Error("proof verified against a different onion")
+	}
+	if VerifyOnionProof("not-an-onion", nonce, sig) {
+		t.Error("proof verified against a malformed onion")
+	}
+}
+
+func TestOnionProofDomainSeparation(t *testing.T) {
+	// A raw signature over the bare nonce — as a naive or malicious
+	// implementation might produce from some other protocol — must not
+	// pass as an ownership proof.
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("0123456789abcdef0123456789abcdef")
+	raw := ed25519.Sign(priv, nonce)
+	if VerifyOnionProof(OnionAddress(pub), nonce, raw) {
+		t.Error("signature without the domain tag verified as a proof")
+	}
+}
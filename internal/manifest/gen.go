@@ -0,0 +1,3 @@
+package manifest
+
+//go:generate protoc --go_out=pb --go_opt=paths=source_relative manifest.proto
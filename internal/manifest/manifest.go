@@ -0,0 +1,178 @@
+// Package manifest defines the backup manifest format: a Header frame
+// followed by one frame per file entry, each frame a uvarint length
+// prefix and a serialized protobuf message. Manifests are written and
+// read as streams, so a million-file tree never has to fit in memory.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/starius/barterbackup/internal/manifest/pb"
+)
+
+// maxFrameSize bounds a single frame, as a guard against corrupted
+// length prefixes.
+const maxFrameSize = 16 * 1024 * 1024
+
+// Writer serializes a manifest onto an io.Writer.
+type Writer struct {
+	bw *bufio.Writer
+}
+
+// NewWriter starts a manifest stream on w with the given header.
+func NewWriter(w io.Writer, hdr *pb.Header) (*Writer, error) {
+	mw := &Writer{bw: bufio.NewWriter(w)}
+	if err := mw.writeFrame(hdr); err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+// Add appends one file entry to the manifest.
+func (w *Writer) Add(e *pb.FileEntry) error {
+	return w.writeFrame(e)
+}
+
+// Flush writes out any buffered frames. It must be called after the
+// last Add.
+func (w *Writer) Flush() error {
+	return w.bw.Flush()
+}
+
+func (w *Writer) writeFrame(m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal manifest frame: %w", err)
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(data)))
+	if _, err := w.bw.Write(lenBuf[:n]); err != nil {
+		return fmt.Errorf("write manifest frame: %w", err)
+	}
+	if _, err := w.bw.Write(data); err != nil {
+		return fmt.Errorf("write manifest frame: %w", err)
+	}
+	return nil
+}
+
+// Reader reads a manifest stream.
+type Reader struct {
+	br  *bufio.Reader
+	hdr *pb.Header
+}
+
+// NewReader opens a manifest stream and reads its header.
+func NewReader(r io.Reader) (*Reader, error) {
+	mr := &Reader{br: bufio.NewReader(r)}
+	hdr := &pb.Header{}
+	if err := mr.readFrame(hdr); err != nil {
+		return nil, fmt.Errorf("read manifest header: %w", err)
+	}
+	mr.hdr = hdr
+	return mr, nil
+}
+
+// Header returns the manifest header.
+func (r *Reader) Header() *pb.Header {
+	return r.hdr
+}
+
+// Next returns the next file entry, or io.EOF after the last one.
+func (r *Reader) Next() (*pb.FileEntry, error) {
+	e := &pb.FileEntry{}
+	if err := r.readFrame(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *Reader) readFrame(m proto.Message) error {
+	size, err := binary.ReadUvarint(r.br)
+	if err == io.EOF {
+		return io.EOF
+	} else if err != nil {
+		return fmt.Errorf("read manifest frame length: %w", err)
+	}
+	if size > maxFrameSize {
+		return fmt.Errorf("manifest frame of %d bytes exceeds limit", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.br, data); err != nil {
+		return fmt.Errorf("read manifest frame: %w", err)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("unmarshal manifest frame: %w", err)
+	}
+	return nil
+}
+
+// Changes is the result of diffing two manifests. Added and Modified
+// hold the entries from the new manifest; Deleted holds paths present
+// only in the old one.
+type Changes struct {
+	Added    []*pb.FileEntry
+	Modified []*pb.FileEntry
+	Deleted  []string
+}
+
+// DiffManifests compares two manifest streams and returns what changed
+// from old to new. The old manifest's entries are indexed in memory;
+// the new one is streamed.
+func DiffManifests(old, new *Reader) (*Changes, error) {
+	oldEntries := make(map[string]*pb.FileEntry)
+	for {
+		e, err := old.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		oldEntries[e.Path] = e
+	}
+	c := &Changes{}
+	for {
+		e, err := new.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		o, ok := oldEntries[e.Path]
+		if !ok {
+			c.Added = append(c.Added, e)
+			continue
+		}
+		delete(oldEntries, e.Path)
+		if EntryChanged(o, e) {
+			c.Modified = append(c.Modified, e)
+		}
+	}
+	for path := range oldEntries {
+		c.Deleted = append(c.Deleted, path)
+	}
+	sort.Strings(c.Deleted)
+	return c, nil
+}
+
+// EntryChanged reports whether two entries for the same path differ in
+// content or metadata. File hashes are compared only when both sides
+// have one, so a metadata-only manifest still diffs usefully.
+func EntryChanged(a, b *pb.FileEntry) bool {
+	if a.Size != b.Size || a.Mode != b.Mode || a.MtimeUnix != b.MtimeUnix || a.MtimeNsec != b.MtimeNsec {
+		return true
+	}
+	if a.SymlinkTarget != b.SymlinkTarget {
+		return true
+	}
+	if len(a.FileHash) > 0 && len(b.FileHash) > 0 && !bytes.Equal(a.FileHash, b.FileHash) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package manifest
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/starius/barterbackup/internal/manifest/pb"
+)
+
+func writeManifest(t *testing.T, entries []*pb.FileEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, &pb.Header{BackupId: "test", SourceDir: "/src"})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, e := range entries {
+		if err := w.Add(e); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	entries := []*pb.FileEntry{
+		{Path: "dir", Mode: 0o755},
+		{Path: "dir/file", Size: 42, Mode: 0o644, MtimeUnix: 1700000000,
+			Chunks:   []*pb.ChunkRef{{Hash: "abc", Size: 42}},
+			FileHash: []byte{1, 2, 3}},
+		{Path: "link", SymlinkTarget: "dir/file"},
+	}
+	r, err := NewReader(bytes.NewReader(writeManifest(t, entries)))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.Header().BackupId != "test" || r.Header().SourceDir != "/src" {
+		t.Errorf("header = %v", r.Header())
+	}
+	for i, want := range entries {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next %d: %v", i, err)
+		}
+		if got.Path != want.Path || got.Size != want.Size || got.SymlinkTarget != want.SymlinkTarget {
+			t.Errorf("entry %d = %v, want %v", i, got, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next after last entry = %v, want io.EOF", err)
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	old := []*pb.FileEntry{
+		{Path: "same", Size: 1, MtimeUnix: 10},
+		{Path: "grown", Size: 1, MtimeUnix: 10},
+		{Path: "touched", Size: 1, MtimeUnix: 10},
+		{Path: "gone", Size: 1},
+	}
+	new := []*pb.FileEntry{
+		{Path: "same", Size: 1, MtimeUnix: 10},
+		{Path: "grown", Size: 2, MtimeUnix: 11},
+		{Path: "touched", Size: 1, MtimeUnix: 12},
+		{Path: "fresh", Size: 3},
+	}
+	oldR, err := NewReader(bytes.NewReader(writeManifest(t, old)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newR, err := NewReader(bytes.NewReader(writeManifest(t, new)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DiffManifests(oldR, newR)
+	if err != nil {
+		t.Fatalf("DiffManifests: %v", err)
+	}
+	if len(c.Added) != 1 || c.Added[0].Path != "fresh" {
+		t.Errorf("Added = %v", c.Added)
+	}
+	if len(c.Modified) != 2 || c.Modified[0].Path != "grown" || c.Modified[1].Path != "touched" {
+		t.Errorf("Modified = %v", c.Modified)
+	}
+	if len(c.Deleted) != 1 || c.Deleted[0] != "gone" {
+		t.Errorf("Deleted = %v", c.Deleted)
+	}
+}
+
+func TestEntryChanged(t *testing.T) {
+	base := &pb.FileEntry{Path: "f", Size: 1, Mode: 0o644, MtimeUnix: 10, FileHash: []byte{1}}
+	same := &pb.FileEntry{Path: "f", Size: 1, Mode: 0o644, MtimeUnix: 10, FileHash: []byte{1}}
+	if EntryChanged(base, same) {
+		t.Error("identical entries reported changed")
+	}
+	// A side without a file hash compares by metadata only.
+	noHash := &pb.FileEntry{Path: "f", Size: 1, Mode: 0o644, MtimeUnix: 10}
+	if EntryChanged(base, noHash) {
+		t.Error("missing hash should not count as a change")
+	}
+	// A rewrite within the same second moves only the nanoseconds.
+	otherNsec := &pb.FileEntry{Path: "f", Size: 1, Mode: 0o644, MtimeUnix: 10, MtimeNsec: 5, FileHash: []byte{1}}
+	if !EntryChanged(base, otherNsec) {
+		t.Error("sub-second mtime change not detected")
+	}
+	otherHash := &pb.FileEntry{Path: "f", Size: 1, Mode: 0o644, MtimeUnix: 10, FileHash: []byte{2}}
+	if !EntryChanged(base, otherHash) {
+		t.Error("hash change not detected")
+	}
+	otherLink := &pb.FileEntry{Path: "f", Size: 1, Mode: 0o644, MtimeUnix: 10, FileHash: []byte{1}, SymlinkTarget: "x"}
+	if !EntryChanged(base, otherLink) {
+		t.Error("symlink target change not detected")
+	}
+}
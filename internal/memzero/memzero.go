@@ -0,0 +1,12 @@
+// Package memzero overwrites sensitive byte slices in place. It cannot
+// reach copies the GC or the runtime may have made, but it keeps key
+// material from lingering in live heap memory after its owner is done
+// with it.
+package memzero
+
+// Bytes overwrites b with zeros.
+func Bytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
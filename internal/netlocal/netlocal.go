@@ -0,0 +1,193 @@
+// Package netlocal implements the node Network over plain TCP on
+// 127.0.0.1, for development without Tor. Register listens on an
+// ephemeral loopback port and records onion address → host:port in a
+// shared JSON registry file; Dial looks the mapping up and connects
+// directly. Everything above the transport — TLS with pinned identity
+// keys, gRPC, the whole node — runs its real code path, so two daemons
+// pointed at the same registry file can peer on one machine.
+//
+// It is unsafe for production on purpose: there is no onion layer, so
+// anyone on the machine sees and can connect to the ports, and the
+// registry file is plain text. The daemon refuses to select it without
+// an explicit insecurity acknowledgement.
+package netlocal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// Sentinel errors callers branch on with errors.Is instead of matching
+// message strings.
+var (
+	// ErrInvalidOnionAddr reports that an address is not a v3 onion
+	// address, so it can never appear in the registry.
+	ErrInvalidOnionAddr = errors.New("netlocal: not a v3 onion address")
+	// ErrUnknownAddress is returned by Dial when the registry has no
+	// entry for the address — the peer daemon is not running, or uses a
+	// different registry file.
+	ErrUnknownAddress = errors.New("netlocal: address not in the registry")
+)
+
+// lock acquisition parameters for the registry file. A crashed holder
+// leaves a stale lock behind; anything older than lockStale is broken.
+const (
+	lockRetryInterval = 10 * time.Millisecond
+	lockStale         = 10 * time.Second
+)
+
+// LocalNetwork publishes and dials through a shared registry file on
+// the local machine. See the package comment.
+type LocalNetwork struct {
+	registry string
+}
+
+// New returns a LocalNetwork backed by the registry file at path. The
+// file is created on first Register; daemons that should see each other
+// must use the same path.
+func New(path string) (*LocalNetwork, error) {
+	if path == "" {
+		return nil, fmt.Errorf("netlocal: registry file path is required")
+	}
+	return &LocalNetwork{registry: path}, nil
+}
+
+// Register listens on an ephemeral loopback port and maps the node's
+// onion address to it in the registry. Closing the listener removes the
+// mapping. An existing mapping is overwritten, so a daemon that crashed
+// without cleaning up does not block its own restart.
+func (l *LocalNetwork) Register(ctx context.Context, onionKey ed25519.PrivateKey) (string, net.Listener, error) {
+	addr := keys.OnionAddress(onionKey.Public().(ed25519.PublicKey))
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("netlocal: listen: %w", err)
+	}
+	err = l.updateRegistry(func(m map[string]string) {
+		m[addr] = ln.Addr().String()
+	})
+	if err != nil {
+		ln.Close()
+		return "", nil, err
+	}
+	return addr, &localListener{Listener: ln, network: l, addr: addr}, nil
+}
+
+// Dial connects to the loopback port the registry maps addr to.
+func (l *LocalNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if _, err := keys.PubKeyFromOnion(addr); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOnionAddr, addr)
+	}
+	m, err := l.readRegistry()
+	if err != nil {
+		return nil, err
+	}
+	tcpAddr, ok := m[addr]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAddress, addr)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", tcpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("netlocal: dial %s at %s: %w", addr, tcpAddr, err)
+	}
+	return conn, nil
+}
+
+// localListener removes the node's registry entry when closed.
+type localListener struct {
+	net.Listener
+	network *LocalNetwork
+	addr    string
+}
+
+func (ln *localListener) Close() error {
+	// Best effort: a stale entry only costs the next dialler a refused
+	// connection, and Register overwrites it on restart.
+	ln.network.updateRegistry(func(m map[string]string) {
+		delete(m, ln.addr)
+	})
+	return ln.Listener.Close()
+}
+
+// readRegistry loads the registry file; a missing file is an empty
+// registry.
+func (l *LocalNetwork) readRegistry() (map[string]string, error) {
+	data, err := os.ReadFile(l.registry)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("netlocal: read registry: %w", err)
+	}
+	m := map[string]string{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("netlocal: parse registry %s: %w", l.registry, err)
+	}
+	return m, nil
+}
+
+// updateRegistry applies fn to the registry under the file lock and
+// writes the result back atomically (temp file + rename), so concurrent
+// daemons never see a torn file or lose each other's entries.
+func (l *LocalNetwork) updateRegistry(fn func(map[string]string)) error {
+	unlock, err := l.lockRegistry()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	m, err := l.readRegistry()
+	if err != nil {
+		return err
+	}
+	fn(m)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(l.registry, data, 0o600); err != nil {
+		return fmt.Errorf("netlocal: write registry: %w", err)
+	}
+	return nil
+}
+
+// lockRegistry takes the cross-process lock guarding registry updates —
+// a lock file created exclusively, the portable lowest common
+// denominator. Readers do not lock; they only ever see a complete file
+// thanks to the rename.
+func (l *LocalNetwork) lockRegistry() (func(), error) {
+	lockPath := l.registry + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o700); err != nil {
+		return nil, fmt.Errorf("netlocal: create registry dir: %w", err)
+	}
+	deadline := time.Now().Add(lockStale)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("netlocal: lock registry: %w", err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockStale {
+			// The holder crashed; break the lock and retry.
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("netlocal: registry %s stayed locked for %v", l.registry, lockStale)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
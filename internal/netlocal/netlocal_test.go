@@ -0,0 +1,124 @@
+package netlocal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestRegisterAndDial(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "netlocal.json")
+	n1, err := New(registry)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// A second network value over the same file, as a second daemon
+	// process would have.
+	n2, err := New(registry)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	addr, ln, err := n1.Register(context.Background(), testKey(t))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	conn, err := n2.Dial(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	server := <-accepted
+	defer server.Close()
+
+	// The connection is a plain TCP pipe.
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := server.Read(buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read: %q, %v", buf, err)
+	}
+}
+
+func TestDialUnknownAddress(t *testing.T) {
+	n, err := New(filepath.Join(t.TempDir(), "netlocal.json"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	onion, _, err := n.Register(context.Background(), testKey(t))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	_ = onion
+
+	other := testKey(t)
+	otherAddr, ln, err := n.Register(context.Background(), other)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	// Closing the listener removes the registry entry.
+	ln.Close()
+	if _, err := n.Dial(context.Background(), otherAddr); !errors.Is(err, ErrUnknownAddress) {
+		t.Fatalf("Dial after close: got %v, want ErrUnknownAddress", err)
+	}
+
+	if _, err := n.Dial(context.Background(), "not-an-onion"); !errors.Is(err, ErrInvalidOnionAddr) {
+		t.Fatalf("Dial bad address: got %v, want ErrInvalidOnionAddr", err)
+	}
+}
+
+func TestReRegisterOverwritesStaleEntry(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "netlocal.json")
+	n, err := New(registry)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	key := testKey(t)
+	_, ln1, err := n.Register(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	// A crashed daemon closes nothing; only the raw listener dies. The
+	// restart must still be able to register.
+	ln1.(*localListener).Listener.Close()
+
+	addr, ln2, err := n.Register(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Register after crash: %v", err)
+	}
+	defer ln2.Close()
+	go func() {
+		if conn, err := ln2.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := n.Dial(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("Dial after re-register: %v", err)
+	}
+	conn.Close()
+}
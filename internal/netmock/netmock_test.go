@@ -0,0 +1,108 @@
+package netmock
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func testKey(t *testing.T, seed byte) ed25519.PrivateKey {
+	t.Helper()
+	var s [ed25519.SeedSize]byte
+	s[0] = seed
+	return ed25519.NewKeyFromSeed(s[:])
+}
+
+func TestRegisterAndDial(t *testing.T) {
+	ctx := context.Background()
+	n := New()
+	addr, ln, err := n.Register(ctx, testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		conn.Close()
+		done <- nil
+	}()
+	conn, err := n.Dial(ctx, addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	conn.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	ctx := context.Background()
+	n := New()
+	_, ln, err := n.Register(ctx, testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	defer ln.Close()
+	if _, _, err := n.Register(ctx, testKey(t, 1)); !errors.Is(err, ErrAddressInUse) {
+		t.Errorf("Register duplicate: got %v, want ErrAddressInUse", err)
+	}
+}
+
+func TestDialUnknown(t *testing.T) {
+	n := New()
+	if _, err := n.Dial(context.Background(), "nonexistent.onion"); !errors.Is(err, ErrUnknownAddress) {
+		t.Errorf("Dial: got %v, want ErrUnknownAddress", err)
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	ctx := context.Background()
+	n := New()
+	a := n.Namespace("cluster-a")
+	b := n.Namespace("cluster-b")
+
+	// The same identity can live in both namespaces.
+	addrA, lnA, err := a.Register(ctx, testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Register in a: %v", err)
+	}
+	defer lnA.Close()
+	addrB, lnB, err := b.Register(ctx, testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Register in b: %v", err)
+	}
+	defer lnB.Close()
+	if addrA != addrB {
+		t.Errorf("addresses differ between namespaces: %q vs %q", addrA, addrB)
+	}
+
+	// Dial does not cross namespaces.
+	c := n.Namespace("cluster-c")
+	if _, err := c.Dial(ctx, addrA); !errors.Is(err, ErrUnknownAddress) {
+		t.Errorf("cross-namespace Dial: got %v, want ErrUnknownAddress", err)
+	}
+}
+
+func TestCloseUnregisters(t *testing.T) {
+	ctx := context.Background()
+	n := New()
+	addr, ln, err := n.Register(ctx, testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	ln.Close()
+	if _, err := n.Dial(ctx, addr); !errors.Is(err, ErrUnknownAddress) {
+		t.Errorf("Dial after Close: got %v, want ErrUnknownAddress", err)
+	}
+	if _, _, err := n.Register(ctx, testKey(t, 1)); err != nil {
+		t.Errorf("re-Register after Close: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Package netsocks implements the node Network over an externally
+// managed Tor, such as a Whonix gateway or a system tor daemon. Dial
+// goes through the configured SOCKS5 proxy and Register listens on a
+// plain local TCP port that the operator's own onion service forwards
+// to; the node never launches a tor process. The onion layer is out of
+// our control here, but the node's TLS identity is not: Register
+// refuses to publish under an onion hostname that does not match the
+// node's identity key, since every peer handshake pins that key.
+package netsocks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// onionPort is the virtual port peers connect to on the onion address.
+// The external onion service must map it to Config.ListenAddr.
+const onionPort = 443
+
+// Sentinel errors callers branch on with errors.Is instead of matching
+// message strings.
+var (
+	// ErrInvalidOnionAddr reports that an address is not a v3 onion
+	// address, so dialing it through the proxy can never work.
+	ErrInvalidOnionAddr = errors.New("netsocks: not a v3 onion address")
+	// ErrOnionMismatch reports that the configured onion hostname does
+	// not belong to the node's identity key.
+	ErrOnionMismatch = errors.New("netsocks: onion hostname does not match the identity key")
+)
+
+// Config configures a SocksNetwork. All fields are required.
+type Config struct {
+	// Proxy is the SOCKS5 endpoint dials go through, host:port.
+	Proxy string
+	// ListenAddr is the local TCP address inbound connections arrive
+	// on; the operator maps the onion service's port 443 to it.
+	ListenAddr string
+	// Onion is the public hostname of the externally-managed onion
+	// service. It must be the address of the node's identity key.
+	Onion string
+}
+
+// SocksNetwork publishes and dials through an external Tor. See the
+// package comment.
+type SocksNetwork struct {
+	cfg Config
+}
+
+// New validates cfg and returns a SocksNetwork. The onion hostname is
+// only checked against the identity key later, in Register, because the
+// key is not known yet.
+func New(cfg Config) (*SocksNetwork, error) {
+	if cfg.Proxy == "" {
+		return nil, fmt.Errorf("netsocks: proxy address is required")
+	}
+	if cfg.ListenAddr == "" {
+		return nil, fmt.Errorf("netsocks: listen address is required")
+	}
+	if _, err := keys.PubKeyFromOnion(cfg.Onion); err != nil {
+		return nil, fmt.Errorf("netsocks: onion hostname: %w", err)
+	}
+	return &SocksNetwork{cfg: cfg}, nil
+}
+
+// Register checks that the configured onion hostname belongs to
+// onionKey and starts listening on the local forward address. The
+// external onion service is assumed to already exist; Register only
+// provides the listener behind it.
+func (s *SocksNetwork) Register(ctx context.Context, onionKey ed25519.PrivateKey) (string, net.Listener, error) {
+	expected := keys.OnionAddress(onionKey.Public().(ed25519.PublicKey))
+	if s.cfg.Onion != expected {
+		return "", nil, fmt.Errorf("%w: configured %s, key gives %s", ErrOnionMismatch, s.cfg.Onion, expected)
+	}
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", s.cfg.ListenAddr)
+	if err != nil {
+		return "", nil, fmt.Errorf("listen on %s: %w", s.cfg.ListenAddr, err)
+	}
+	return expected, ln, nil
+}
+
+// Dial connects to a peer's onion service through the SOCKS5 proxy. The
+// hostname is passed to the proxy unresolved, as Tor SOCKS requires.
+func (s *SocksNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if _, err := keys.PubKeyFromOnion(addr); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOnionAddr, addr)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("connect to socks proxy %s: %w", s.cfg.Proxy, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := socksConnect(conn, addr, onionPort); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socksConnect performs an RFC 1928 handshake on conn — no
+// authentication, CONNECT to host:port with the hostname sent as a
+// domain name so the proxy resolves it. Hand-rolled because the proxy
+// side of the protocol is a page of code and the alternative is a new
+// dependency.
+func socksConnect(conn net.Conn, host string, port uint16) error {
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		return err
+	}
+	var method [2]byte
+	if _, err := io.ReadFull(conn, method[:]); err != nil {
+		return err
+	}
+	if method[0] != 5 || method[1] != 0 {
+		return fmt.Errorf("proxy rejected no-auth method (version %d, method %d)", method[0], method[1])
+	}
+	req := make([]byte, 0, 7+len(host))
+	req = append(req, 5, 1, 0, 3, byte(len(host)))
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, port)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("proxy replied %s", socksReplyString(reply[1]))
+	}
+	// Drain the bound address so application data starts at the right
+	// offset.
+	var boundLen int
+	switch reply[3] {
+	case 1:
+		boundLen = net.IPv4len
+	case 4:
+		boundLen = net.IPv6len
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		boundLen = int(n[0])
+	default:
+		return fmt.Errorf("proxy replied with unknown address type %d", reply[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, boundLen+2)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// socksReplyString names an RFC 1928 reply code. Tor maps onion-side
+// failures onto these, so the message is often the only clue.
+func socksReplyString(code byte) string {
+	names := []string{
+		"succeeded",
+		"general failure",
+		"connection not allowed",
+		"network unreachable",
+		"host unreachable",
+		"connection refused",
+		"TTL expired",
+		"command not supported",
+		"address type not supported",
+	}
+	if int(code) < len(names) {
+		return fmt.Sprintf("%q (code %d)", names[code], code)
+	}
+	return fmt.Sprintf("code %d", code)
+}
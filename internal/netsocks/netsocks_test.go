@@ -0,0 +1,147 @@
+package netsocks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// genOnion returns a fresh identity key and its onion address.
+func genOnion(t *testing.T) (ed25519.PrivateKey, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return priv, keys.OnionAddress(pub)
+}
+
+// startEchoProxy runs a minimal SOCKS5 server that accepts one CONNECT
+// and then echoes application data back, recording the requested host.
+func startEchoProxy(t *testing.T) (addr string, gotHost chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	gotHost = make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(conn, greeting); err != nil {
+			return
+		}
+		conn.Write([]byte{5, 0})
+		head := make([]byte, 5)
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		host := make([]byte, int(head[4])+2)
+		if _, err := io.ReadFull(conn, host); err != nil {
+			return
+		}
+		gotHost <- string(host[:len(host)-2])
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		io.Copy(conn, conn)
+	}()
+	return ln.Addr().String(), gotHost
+}
+
+func TestDialThroughProxy(t *testing.T) {
+	_, target := genOnion(t)
+	proxy, gotHost := startEchoProxy(t)
+	network, err := New(Config{Proxy: proxy, ListenAddr: "127.0.0.1:0", Onion: target})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := network.Dial(ctx, target)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if host := <-gotHost; host != target {
+		t.Errorf("proxy saw host %q, want %q", host, target)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("echo = %q, want hello", buf)
+	}
+}
+
+func TestDialInvalidAddr(t *testing.T) {
+	_, onion := genOnion(t)
+	network, err := New(Config{Proxy: "127.0.0.1:1", ListenAddr: "127.0.0.1:0", Onion: onion})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	_, err = network.Dial(context.Background(), "example.com")
+	if !errors.Is(err, ErrInvalidOnionAddr) {
+		t.Errorf("Dial(example.com): %v, want ErrInvalidOnionAddr", err)
+	}
+}
+
+func TestRegisterOnionMismatch(t *testing.T) {
+	priv, _ := genOnion(t)
+	_, otherOnion := genOnion(t)
+	network, err := New(Config{Proxy: "127.0.0.1:1", ListenAddr: "127.0.0.1:0", Onion: otherOnion})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, _, err := network.Register(context.Background(), priv); !errors.Is(err, ErrOnionMismatch) {
+		t.Errorf("Register: %v, want ErrOnionMismatch", err)
+	}
+}
+
+func TestRegisterListens(t *testing.T) {
+	priv, onion := genOnion(t)
+	network, err := New(Config{Proxy: "127.0.0.1:1", ListenAddr: "127.0.0.1:0", Onion: onion})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	addr, ln, err := network.Register(context.Background(), priv)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	defer ln.Close()
+	if addr != onion {
+		t.Errorf("Register address = %s, want %s", addr, onion)
+	}
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forward port: %v", err)
+	}
+	conn.Close()
+}
+
+func TestNewValidation(t *testing.T) {
+	_, onion := genOnion(t)
+	if _, err := New(Config{ListenAddr: "127.0.0.1:0", Onion: onion}); err == nil {
+		t.Error("New without proxy succeeded")
+	}
+	if _, err := New(Config{Proxy: "127.0.0.1:1", Onion: onion}); err == nil {
+		t.Error("New without listen address succeeded")
+	}
+	if _, err := New(Config{Proxy: "127.0.0.1:1", ListenAddr: "127.0.0.1:0", Onion: "nope.onion"}); err == nil {
+		t.Error("New with bad onion succeeded")
+	}
+}
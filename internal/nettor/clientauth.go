@@ -0,0 +1,135 @@
+package nettor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Client authorization support. When authorized client keys are
+// configured, the onion service is published with Tor's v3 client
+// authorization so only those x25519 keys can even fetch the
+// descriptor; on the dial side our own auth key is handed to Tor before
+// connecting to peers that require it.
+
+var b32upper = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// SetClientAuthKey sets the x25519 secret presented when dialing onion
+// services that require client authorization. It applies to subsequent
+// dials.
+func (t *TorNetwork) SetClientAuthKey(priv []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clientAuthKey = priv
+}
+
+// SetAuthorizedClients replaces the set of x25519 public keys allowed to
+// reach our onion service. With a nil or empty set the service is open.
+// If the service is already published, it is re-published with the new
+// set (the Tor process itself keeps running).
+func (t *TorNetwork) SetAuthorizedClients(ctx context.Context, pubs [][]byte) error {
+	t.mu.Lock()
+	t.authorizedClients = pubs
+	onion := t.activeOnion
+	key := t.activeKey
+	t.mu.Unlock()
+	if onion == nil {
+		return nil // applied on the next Register
+	}
+	// Re-publish the service with the new client set. Connections in
+	// flight on the old descriptor keep working until they close.
+	if err := onion.Close(); err != nil {
+		return fmt.Errorf("unpublish onion for auth update: %w", err)
+	}
+	_, _, err := t.Register(ctx, key)
+	if err != nil {
+		return fmt.Errorf("republish onion with updated client auth: %w", err)
+	}
+	return nil
+}
+
+// registerClientAuth hands our client auth key to the running Tor so
+// dials to auth-protected services succeed. Safe to call repeatedly.
+func (t *TorNetwork) registerClientAuth(addr string) error {
+	t.mu.Lock()
+	priv := t.clientAuthKey
+	instance := t.tor
+	t.mu.Unlock()
+	if priv == nil || instance == nil {
+		return nil
+	}
+	host := strings.TrimSuffix(addr, ".onion")
+	_, err := instance.Control.SendRequest("ONION_CLIENT_AUTH_ADD %s x25519:%s",
+		host, base64.StdEncoding.EncodeToString(priv))
+	if err != nil && !strings.Contains(err.Error(), "already") {
+		return fmt.Errorf("register client auth for %s: %w", addr, err)
+	}
+	return nil
+}
+
+// clientAuthLines renders the ClientAuthV3 arguments for ADD_ONION.
+func clientAuthLines(pubs [][]byte) string {
+	var sb strings.Builder
+	for _, pub := range pubs {
+		fmt.Fprintf(&sb, " ClientAuthV3=%s", b32upper.EncodeToString(pub))
+	}
+	return sb.String()
+}
+
+// ed25519Blob encodes an Ed25519 key in Tor's ED25519-V3 expanded form.
+func ed25519Blob(key ed25519.PrivateKey) string {
+	h := sha512.Sum512(key.Seed())
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// listenWithClientAuth publishes the onion service via a raw ADD_ONION
+// command, which (unlike bine's Listen) can carry ClientAuthV3 keys,
+// and returns a listener whose Close also removes the service. A nil
+// local listener means "bind an ephemeral loopback port here".
+func (t *TorNetwork) listenWithClientAuth(ctx context.Context, onionKey ed25519.PrivateKey, serviceID string, pubs [][]byte, local net.Listener) (net.Listener, error) {
+	if local == nil {
+		var err error
+		local, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("local listener for onion: %w", err)
+		}
+	}
+	t.mu.Lock()
+	instance := t.tor
+	t.mu.Unlock()
+	_, err := instance.Control.SendRequest("ADD_ONION ED25519-V3:%s Port=%d,%s%s",
+		ed25519Blob(onionKey), onionPort, local.Addr().String(), clientAuthLines(pubs))
+	if err != nil {
+		local.Close()
+		return nil, fmt.Errorf("publish onion service with client auth: %w", err)
+	}
+	return &authOnionListener{
+		Listener: local,
+		close: func() error {
+			_, err := instance.Control.SendRequest("DEL_ONION %s", serviceID)
+			return err
+		},
+	}, nil
+}
+
+// authOnionListener removes the onion service when closed.
+type authOnionListener struct {
+	net.Listener
+	close func() error
+}
+
+func (l *authOnionListener) Close() error {
+	err := l.Listener.Close()
+	if cerr := l.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package nettor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors callers branch on with errors.Is instead of matching
+// message strings.
+var (
+	// ErrTorNotStarted reports that the embedded Tor client could not
+	// be launched; nothing can be dialed or published until it is.
+	ErrTorNotStarted = errors.New("nettor: tor not started")
+	// ErrInvalidOnionAddr reports that an address is not a v3 onion
+	// address, so dialing it over Tor can never work.
+	ErrInvalidOnionAddr = errors.New("nettor: not a v3 onion address")
+	// ErrBootstrapTimeout reports that Tor did not finish bootstrapping
+	// within its Register budget — usually a blocked or very slow
+	// network, not a problem with this node's configuration.
+	ErrBootstrapTimeout = errors.New("nettor: tor bootstrap timed out")
+	// ErrPublishTimeout reports that Tor bootstrapped but publishing the
+	// onion descriptor did not finish within its budget.
+	ErrPublishTimeout = errors.New("nettor: onion publication timed out")
+)
+
+// DialError describes a failed Dial together with the phase it failed
+// in, so callers can tell a dead Tor client from a dead peer. It wraps
+// the underlying error for errors.Is and errors.As.
+type DialError struct {
+	// Phase is "start" (launching Tor), "auth" (registering client
+	// authorization), "dialer" (building the SOCKS dialer), or
+	// "connect" (the proxied connection itself).
+	Phase string
+	Addr  string
+	Err   error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("nettor: dial %s: %s: %v", e.Addr, e.Phase, e.Err)
+}
+
+func (e *DialError) Unwrap() error { return e.Err }
+
+// onionAddrOK reports whether addr is a well-formed v3 onion address:
+// 56 characters of lower-case base32 followed by ".onion".
+func onionAddrOK(addr string) bool {
+	const idLen = 56
+	id, ok := strings.CutSuffix(addr, ".onion")
+	if !ok || len(id) != idLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= '2' && r <= '7':
+		default:
+			return false
+		}
+	}
+	return true
+}
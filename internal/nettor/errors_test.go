@@ -0,0 +1,48 @@
+package nettor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDialRejectsInvalidAddress(t *testing.T) {
+	n := New(t.TempDir())
+	// All of these fail validation, so Dial returns before it would
+	// launch Tor.
+	bad := []string{
+		"",
+		"example.com",
+		"example.com:443",
+		"short.onion",
+		strings.Repeat("A", 56) + ".onion",  // wrong case
+		strings.Repeat("a", 55) + "1.onion", // 0/1 are not base32
+	}
+	for _, addr := range bad {
+		if _, err := n.Dial(context.Background(), addr); !errors.Is(err, ErrInvalidOnionAddr) {
+			t.Errorf("Dial(%q) = %v, want ErrInvalidOnionAddr", addr, err)
+		}
+	}
+	if good := strings.Repeat("a", 56) + ".onion"; !onionAddrOK(good) {
+		t.Errorf("onionAddrOK(%q) = false, want true", good)
+	}
+}
+
+func TestDialErrorWrapping(t *testing.T) {
+	cause := fmt.Errorf("%w: proxy exited", ErrTorNotStarted)
+	var err error = &DialError{Phase: "start", Addr: "x.onion", Err: cause}
+	err = fmt.Errorf("health check: %w", err)
+
+	if !errors.Is(err, ErrTorNotStarted) {
+		t.Errorf("errors.Is(ErrTorNotStarted) = false for %v", err)
+	}
+	var de *DialError
+	if !errors.As(err, &de) {
+		t.Fatalf("errors.As(*DialError) = false for %v", err)
+	}
+	if de.Phase != "start" || de.Addr != "x.onion" {
+		t.Errorf("DialError = %+v, want phase %q addr %q", de, "start", "x.onion")
+	}
+}
@@ -0,0 +1,64 @@
+package nettor
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// freePort reserves an ephemeral port and releases it so the test can
+// pin it. Racy in principle, but nothing else grabs ports here.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func TestPinnedListenerUsesPort(t *testing.T) {
+	port := freePort(t)
+	tn := New(t.TempDir(), WithLocalPort(port))
+	ln, err := tn.pinnedListener()
+	if err != nil {
+		t.Fatalf("pinnedListener: %v", err)
+	}
+	defer ln.Close()
+	if got := ln.Addr().(*net.TCPAddr).Port; got != port {
+		t.Errorf("listener bound port %d, want pinned %d", got, port)
+	}
+}
+
+func TestPinnedListenerEphemeralDefault(t *testing.T) {
+	tn := New(t.TempDir())
+	ln, err := tn.pinnedListener()
+	if err != nil {
+		t.Fatalf("pinnedListener: %v", err)
+	}
+	if ln != nil {
+		ln.Close()
+		t.Error("pinnedListener returned a listener without WithLocalPort")
+	}
+}
+
+func TestPinnedListenerConflict(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	tn := New(t.TempDir(), WithLocalPort(port))
+	ln, err := tn.pinnedListener()
+	if err == nil {
+		ln.Close()
+		t.Fatal("pinnedListener succeeded on an occupied port")
+	}
+	if !strings.Contains(err.Error(), "--tor-local-port") {
+		t.Errorf("error %q does not point at --tor-local-port", err)
+	}
+}
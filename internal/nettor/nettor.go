@@ -0,0 +1,384 @@
+// Package nettor implements the node Network over Tor: Register
+// publishes a v3 onion service for the node's identity key and Dial
+// reaches peers through the Tor SOCKS proxy.
+package nettor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cretz/bine/tor"
+
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// onionPort is the virtual port peers connect to on the onion address.
+const onionPort = 443
+
+// Default budgets for the two Register phases. Bootstrap covers
+// launching Tor and building circuits, which dominates on slow or
+// censored networks; publication of the onion descriptor is quick once
+// circuits exist, so its budget is tighter and a publish timeout points
+// at a different problem than a bootstrap one.
+const (
+	defaultBootstrapTimeout = 4 * time.Minute
+	defaultPublishTimeout   = 2 * time.Minute
+)
+
+// TorNetwork publishes and dials over a private Tor client. The Tor data
+// dir is persisted under dataDir so bootstrap state survives restarts.
+type TorNetwork struct {
+	dataDir          string
+	torBinary        string
+	localPort        int
+	bootstrapTimeout time.Duration
+	publishTimeout   time.Duration
+	maxTorRSS        int64
+	down             chan error
+
+	onionStateHook func(warning string)
+
+	mu                sync.Mutex
+	tor               *tor.Tor
+	torVersion        string
+	onionStateWarning string
+	localAddr         string
+	registerPhase     string
+
+	// Tor child process statistics; see torproc.go.
+	childPID int
+	childRSS int64
+	childCPU time.Duration
+
+	// Client authorization state; see clientauth.go.
+	clientAuthKey     []byte
+	authorizedClients [][]byte
+	activeOnion       net.Listener
+	activeKey         ed25519.PrivateKey
+}
+
+// Option configures a TorNetwork.
+type Option func(*TorNetwork)
+
+// WithTorBinary uses the tor executable at path instead of looking up
+// "tor" on PATH.
+func WithTorBinary(path string) Option {
+	return func(t *TorNetwork) {
+		t.torBinary = path
+	}
+}
+
+// WithLocalPort pins the onion service's local listener to the given
+// loopback port instead of an ephemeral one, for users who firewall by
+// port or audit listening sockets. Zero keeps the ephemeral default.
+func WithLocalPort(port int) Option {
+	return func(t *TorNetwork) {
+		t.localPort = port
+	}
+}
+
+// WithBootstrapTimeout overrides the budget for launching Tor and
+// building circuits during Register.
+func WithBootstrapTimeout(d time.Duration) Option {
+	return func(t *TorNetwork) {
+		t.bootstrapTimeout = d
+	}
+}
+
+// WithPublishTimeout overrides the budget for publishing the onion
+// descriptor during Register, once Tor is bootstrapped.
+func WithPublishTimeout(d time.Duration) Option {
+	return func(t *TorNetwork) {
+		t.publishTimeout = d
+	}
+}
+
+// WithMaxTorMemory restarts the Tor child when its resident set grows
+// beyond the given number of bytes, reusing the crash-recovery path:
+// the node sees Tor go down and republishes through a fresh instance.
+// Zero means no cap. The cap only bites where process sampling is
+// supported (Linux).
+func WithMaxTorMemory(bytes int64) Option {
+	return func(t *TorNetwork) {
+		if bytes > 0 {
+			t.maxTorRSS = bytes
+		}
+	}
+}
+
+// New creates a TorNetwork persisting Tor state under dataDir. Tor is
+// launched lazily on first use.
+func New(dataDir string, opts ...Option) *TorNetwork {
+	t := &TorNetwork{
+		dataDir:          dataDir,
+		bootstrapTimeout: defaultBootstrapTimeout,
+		publishTimeout:   defaultPublishTimeout,
+		down:             make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// ensureTor starts the Tor client if it is not running yet. The binary
+// is preflighted first, so a missing or too-old tor fails with an
+// actionable *TorBinaryError instead of a launch error from deep inside
+// bootstrap.
+func (t *TorNetwork) ensureTor(ctx context.Context) (*tor.Tor, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tor != nil {
+		return t.tor, nil
+	}
+	exePath, version, err := PreflightTor(t.torBinary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTorNotStarted, err)
+	}
+	instance, err := tor.Start(ctx, &tor.StartConf{
+		DataDir: t.dataDir,
+		ExePath: exePath,
+		// The custom creator puts the child in its own process group;
+		// see torproc.go.
+		ProcessCreator: &torProcessCreator{exePath: exePath},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTorNotStarted, err)
+	}
+	t.tor = instance
+	t.torVersion = version
+	t.childPID = 0
+	if p, ok := instance.Process.(*torProcess); ok {
+		t.childPID = p.Pid()
+	}
+	t.childRSS, t.childCPU = 0, 0
+	go t.watchTor(instance)
+	go t.monitorTor(instance, t.childPID)
+	return instance, nil
+}
+
+// TorVersion reports the version of the tor binary detected by the last
+// successful launch, empty before Tor has started.
+func (t *TorNetwork) TorVersion() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.torVersion
+}
+
+// Down reports Tor process crashes. Each crash delivers one error; the
+// node watches the channel and republishes through a fresh Tor instance,
+// which ensureTor launches lazily on the next Register or Dial.
+func (t *TorNetwork) Down() <-chan error {
+	return t.down
+}
+
+// watchTor waits for the Tor child process to exit. A deliberate Close
+// swaps t.tor out first and is not reported; anything else — OOM kill,
+// a crash, an operator stopping the wrong process — marks the instance
+// dead and signals Down.
+func (t *TorNetwork) watchTor(instance *tor.Tor) {
+	err := instance.Process.Wait()
+	t.mu.Lock()
+	if t.tor != instance {
+		t.mu.Unlock()
+		return
+	}
+	t.tor = nil
+	t.childPID = 0
+	onion := t.activeOnion
+	t.activeOnion = nil
+	t.mu.Unlock()
+	if onion != nil {
+		// The local forward listener outlives the Tor process; close it
+		// so a gRPC server behind it does not keep accepting
+		// connections nothing can reach.
+		onion.Close()
+	}
+	if err == nil {
+		err = fmt.Errorf("process exited")
+	}
+	select {
+	case t.down <- fmt.Errorf("tor died: %w", err):
+	default:
+	}
+}
+
+// Register publishes an onion service for onionKey and returns the onion
+// address and the local listener behind it.
+func (t *TorNetwork) Register(ctx context.Context, onionKey ed25519.PrivateKey) (string, net.Listener, error) {
+	defer t.setPhase("")
+	// A pinned local port is claimed before the expensive Tor launch, so
+	// a port conflict fails fast with the flag to fix.
+	local, err := t.pinnedListener()
+	if err != nil {
+		return "", nil, err
+	}
+	closeLocal := func() {
+		if local != nil {
+			local.Close()
+		}
+	}
+	t.setPhase(PhaseBootstrap)
+	bctx, bcancel := context.WithTimeout(ctx, t.bootstrapTimeout)
+	instance, err := t.ensureTor(bctx)
+	bcancel()
+	if err != nil {
+		closeLocal()
+		if bctx.Err() != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%w (budget %s): %w", ErrBootstrapTimeout, t.bootstrapTimeout, err)
+		}
+		return "", nil, err
+	}
+	addr := keys.OnionAddress(onionKey.Public().(ed25519.PublicKey))
+	// Leftover onion state from another identity confuses descriptor
+	// publication; clear it before publishing ours.
+	t.checkOnionState(addr)
+
+	t.mu.Lock()
+	authorized := t.authorizedClients
+	t.mu.Unlock()
+
+	t.setPhase(PhasePublish)
+	pctx, pcancel := context.WithTimeout(ctx, t.publishTimeout)
+	defer pcancel()
+	var onion net.Listener
+	if len(authorized) > 0 {
+		serviceID := strings.TrimSuffix(addr, ".onion")
+		onion, err = t.listenWithClientAuth(pctx, onionKey, serviceID, authorized, local)
+	} else {
+		onion, err = instance.Listen(pctx, &tor.ListenConf{
+			Key:           onionKey,
+			RemotePorts:   []int{onionPort},
+			Version3:      true,
+			LocalListener: local,
+		})
+	}
+	if err != nil {
+		closeLocal()
+		if pctx.Err() != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%w (budget %s): %w", ErrPublishTimeout, t.publishTimeout, err)
+		}
+		return "", nil, fmt.Errorf("publish onion service: %w", err)
+	}
+	localAddr := localListenerAddr(onion)
+	log.Printf("onion service %s published: local listener %s, remote port %d", addr, localAddr, onionPort)
+
+	t.mu.Lock()
+	t.activeOnion = onion
+	t.activeKey = onionKey
+	t.localAddr = localAddr
+	t.mu.Unlock()
+	return addr, onion, nil
+}
+
+// pinnedListener binds the configured local port, or returns nil when
+// the ephemeral default applies.
+func (t *TorNetwork) pinnedListener() (net.Listener, error) {
+	if t.localPort == 0 {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", t.localPort))
+	if err != nil {
+		return nil, fmt.Errorf("onion local port %d is unavailable (%v) — free it, or change or drop --tor-local-port", t.localPort, err)
+	}
+	return ln, nil
+}
+
+// localListenerAddr extracts the loopback address actually backing the
+// published onion service.
+func localListenerAddr(onion net.Listener) string {
+	if svc, ok := onion.(*tor.OnionService); ok && svc.LocalListener != nil {
+		return svc.LocalListener.Addr().String()
+	}
+	return onion.Addr().String()
+}
+
+// Register phase names, as reported by RegisterPhase.
+const (
+	PhaseBootstrap = "bootstrap"
+	PhasePublish   = "publish"
+)
+
+// setPhase records which Register phase is in flight, empty when none.
+func (t *TorNetwork) setPhase(phase string) {
+	t.mu.Lock()
+	t.registerPhase = phase
+	t.mu.Unlock()
+	if phase != "" {
+		log.Printf("tor register: %s phase", phase)
+	}
+}
+
+// RegisterPhase reports the Register phase currently in flight —
+// PhaseBootstrap or PhasePublish — or empty when no Register is
+// running, so status output can show what a slow unlock is waiting on.
+func (t *TorNetwork) RegisterPhase() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.registerPhase
+}
+
+// OnionPorts reports the loopback address behind the published onion
+// service and the virtual port peers connect to, for status output.
+// The local address is empty before the first Register.
+func (t *TorNetwork) OnionPorts() (localAddr string, remotePort int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.localAddr, onionPort
+}
+
+// Dial connects to a peer's onion service through the Tor SOCKS proxy.
+// Failures come back as a *DialError naming the phase that failed,
+// except for malformed addresses, which fail fast with
+// ErrInvalidOnionAddr.
+func (t *TorNetwork) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if !onionAddrOK(addr) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOnionAddr, addr)
+	}
+	instance, err := t.ensureTor(ctx)
+	if err != nil {
+		return nil, &DialError{Phase: "start", Addr: addr, Err: err}
+	}
+	if err := t.registerClientAuth(addr); err != nil {
+		return nil, &DialError{Phase: "auth", Addr: addr, Err: err}
+	}
+	dialer, err := instance.Dialer(ctx, nil)
+	if err != nil {
+		return nil, &DialError{Phase: "dialer", Addr: addr, Err: err}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", addr, onionPort))
+	if err != nil {
+		return nil, &DialError{Phase: "connect", Addr: addr, Err: err}
+	}
+	return conn, nil
+}
+
+// Close shuts the Tor client down. The orderly shutdown gets a bounded
+// wait; a child that ignores it is force-killed together with its
+// process group, so nothing Tor spawned outlives the daemon.
+func (t *TorNetwork) Close() error {
+	t.mu.Lock()
+	instance := t.tor
+	pid := t.childPID
+	t.tor = nil
+	t.childPID = 0
+	t.mu.Unlock()
+	if instance == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- instance.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(torShutdownTimeout):
+		killTorChild(pid)
+		return fmt.Errorf("tor did not exit within %s; killed process group %d", torShutdownTimeout, pid)
+	}
+}
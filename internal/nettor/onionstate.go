@@ -0,0 +1,83 @@
+package nettor
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hostnameFile is the file Tor writes into a hidden-service directory
+// with the service's onion address. Its presence marks a directory as
+// onion-service state.
+const hostnameFile = "hostname"
+
+// WithOnionStateHook calls fn whenever Register finds onion-service
+// state in the Tor data dir that belongs to a different identity than
+// the one being published. The daemon records the warning in the audit
+// log through this hook.
+func WithOnionStateHook(fn func(warning string)) Option {
+	return func(t *TorNetwork) {
+		t.onionStateHook = fn
+	}
+}
+
+// OnionStateWarning describes stale onion-service state the last
+// Register found in the Tor data dir, empty when the dir was clean.
+// GetStatus surfaces it the same way it surfaces TorVersion.
+func (t *TorNetwork) OnionStateWarning() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.onionStateWarning
+}
+
+// checkOnionState scans the Tor data dir for hidden-service directories
+// left over from a previous identity — typically a user who reset the
+// daemon state but kept tor/, or copied tor/ between installs. The node
+// publishes via the control port and derives its key from the password,
+// so such directories are never ours and only cause confusing descriptor
+// behavior; they are removed, which is safe because every key in play is
+// derivable. Failures to remove degrade to a warning.
+func (t *TorNetwork) checkOnionState(addr string) {
+	entries, err := os.ReadDir(t.dataDir)
+	if err != nil {
+		// Nothing cached yet (first run), or the dir is unreadable —
+		// either way there is no stale state to act on.
+		return
+	}
+	var warnings []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(t.dataDir, e.Name())
+		raw, err := os.ReadFile(filepath.Join(dir, hostnameFile))
+		if err != nil {
+			continue // not a hidden-service directory
+		}
+		found := strings.TrimSpace(string(raw))
+		if found == addr {
+			continue
+		}
+		w := fmt.Sprintf("tor data dir holds onion service state for %s in %s, but this node publishes %s", found, dir, addr)
+		if err := os.RemoveAll(dir); err != nil {
+			w += fmt.Sprintf("; removing it failed (%v) — remove it manually", err)
+		} else {
+			w += "; the stale state was removed"
+		}
+		warnings = append(warnings, w)
+	}
+	warning := strings.Join(warnings, "; ")
+	t.mu.Lock()
+	t.onionStateWarning = warning
+	hook := t.onionStateHook
+	t.mu.Unlock()
+	if warning == "" {
+		return
+	}
+	log.Printf("WARNING: %s", warning)
+	if hook != nil {
+		hook(warning)
+	}
+}
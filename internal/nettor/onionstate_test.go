@@ -0,0 +1,75 @@
+package nettor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeHSDir fakes a Tor hidden-service directory for onion.
+func writeHSDir(t *testing.T, dataDir, name, onion string) string {
+	t.Helper()
+	dir := filepath.Join(dataDir, name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, hostnameFile), []byte(onion+"\n"), 0o600); err != nil {
+		t.Fatalf("write hostname: %v", err)
+	}
+	return dir
+}
+
+func TestCheckOnionStateClearsStaleDirs(t *testing.T) {
+	dataDir := t.TempDir()
+	const current = "currentcurrentcurrentcurrentcurrentcurrentcurrentcurrent.onion"
+	const previous = "previouspreviouspreviouspreviouspreviouspreviousprevious.onion"
+	stale := writeHSDir(t, dataDir, "onion-old", previous)
+	ours := writeHSDir(t, dataDir, "onion-current", current)
+	// An unrelated directory without a hostname file is not onion state.
+	keys := filepath.Join(dataDir, "keys")
+	if err := os.MkdirAll(keys, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	var hooked []string
+	tn := New(dataDir, WithOnionStateHook(func(warning string) {
+		hooked = append(hooked, warning)
+	}))
+	tn.checkOnionState(current)
+
+	warning := tn.OnionStateWarning()
+	if !strings.Contains(warning, previous) {
+		t.Errorf("warning does not name the stale identity: %q", warning)
+	}
+	if len(hooked) != 1 || hooked[0] != warning {
+		t.Errorf("hook calls = %v, want the warning once", hooked)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale onion dir survived: %v", err)
+	}
+	if _, err := os.Stat(ours); err != nil {
+		t.Errorf("current identity's dir removed: %v", err)
+	}
+	if _, err := os.Stat(keys); err != nil {
+		t.Errorf("unrelated dir removed: %v", err)
+	}
+
+	// A clean dir clears the warning on the next publication.
+	tn.checkOnionState(current)
+	if got := tn.OnionStateWarning(); got != "" {
+		t.Errorf("warning after clean check = %q, want empty", got)
+	}
+	if len(hooked) != 1 {
+		t.Errorf("hook called on a clean dir: %v", hooked)
+	}
+}
+
+func TestCheckOnionStateMissingDataDir(t *testing.T) {
+	tn := New(filepath.Join(t.TempDir(), "never-created"))
+	// First run: Tor has not populated the data dir yet.
+	tn.checkOnionState("someaddress.onion")
+	if got := tn.OnionStateWarning(); got != "" {
+		t.Errorf("warning for a missing data dir = %q, want empty", got)
+	}
+}
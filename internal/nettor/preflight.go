@@ -0,0 +1,120 @@
+package nettor
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// defaultTorBinary is the executable looked up when no explicit path is
+// configured.
+const defaultTorBinary = "tor"
+
+// minTorVersion is the oldest Tor release supporting v3 onion services
+// with client authorization, which Register relies on.
+const minTorVersion = "0.4.6"
+
+// Test seams for binary discovery and version probing.
+var (
+	lookTorPath      = exec.LookPath
+	torVersionOutput = func(path string) ([]byte, error) { return exec.Command(path, "--version").Output() }
+)
+
+// TorBinaryError reports a failed tor executable preflight: a missing
+// binary, one that cannot run, or one too old for v3 onion client
+// authorization. The message tells the user what to do about it.
+type TorBinaryError struct {
+	// Binary is the executable name or path that was checked.
+	Binary string
+	// Version is the detected version, when the probe got that far.
+	Version string
+	Err     error
+}
+
+func (e *TorBinaryError) Error() string {
+	if e.Version != "" {
+		return fmt.Sprintf("nettor: tor binary %q is version %s, need %s or newer (v3 onion client auth); upgrade tor or pass --tor-binary", e.Binary, e.Version, minTorVersion)
+	}
+	return fmt.Sprintf("nettor: tor binary %q not found or not runnable; install tor or pass --tor-binary: %v", e.Binary, e.Err)
+}
+
+func (e *TorBinaryError) Unwrap() error { return e.Err }
+
+// PreflightTor locates the tor executable (binary, or "tor" from PATH
+// when empty), probes its version with `tor --version`, and rejects
+// versions older than minTorVersion. It returns the resolved path and
+// the detected version, so failures surface before Tor bootstrap
+// instead of as a cryptic exec error buried inside it.
+func PreflightTor(binary string) (path, version string, err error) {
+	name := binary
+	if name == "" {
+		name = defaultTorBinary
+	}
+	path, err = lookTorPath(name)
+	if err != nil {
+		return "", "", &TorBinaryError{Binary: name, Err: err}
+	}
+	out, err := torVersionOutput(path)
+	if err != nil {
+		return "", "", &TorBinaryError{Binary: name, Err: fmt.Errorf("run %s --version: %w", path, err)}
+	}
+	version = parseTorVersion(string(out))
+	if version == "" {
+		return "", "", &TorBinaryError{Binary: name, Err: fmt.Errorf("unrecognized %s --version output %q", path, firstLine(string(out)))}
+	}
+	if compareVersions(version, minTorVersion) < 0 {
+		return "", "", &TorBinaryError{Binary: name, Version: version, Err: fmt.Errorf("tor %s is older than %s", version, minTorVersion)}
+	}
+	return path, version, nil
+}
+
+// parseTorVersion extracts the dotted version from `tor --version`
+// output like "Tor version 0.4.8.10.". Only the first line counts: real
+// tor appends more lines about the build. Empty if the output has no
+// recognizable version.
+func parseTorVersion(out string) string {
+	_, rest, ok := strings.Cut(firstLine(out), "Tor version ")
+	if !ok {
+		return ""
+	}
+	version, _, _ := strings.Cut(rest, " ")
+	version = strings.TrimRight(strings.TrimSpace(version), ".")
+	if version == "" {
+		return ""
+	}
+	for _, field := range strings.Split(version, ".") {
+		if _, err := strconv.Atoi(field); err != nil {
+			return ""
+		}
+	}
+	return version
+}
+
+// compareVersions compares dotted numeric versions, treating missing
+// fields as zero.
+func compareVersions(a, b string) int {
+	af, bf := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(af) || i < len(bf); i++ {
+		var an, bn int
+		if i < len(af) {
+			an, _ = strconv.Atoi(af[i])
+		}
+		if i < len(bf) {
+			bn, _ = strconv.Atoi(bf[i])
+		}
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// firstLine truncates s to its first line, for error messages.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,99 @@
+package nettor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stubTorBinary replaces the binary lookup and version probe for the
+// duration of the test.
+func stubTorBinary(t *testing.T, lookErr error, versionOut string, versionErr error) {
+	t.Helper()
+	origLook, origVersion := lookTorPath, torVersionOutput
+	t.Cleanup(func() {
+		lookTorPath, torVersionOutput = origLook, origVersion
+	})
+	lookTorPath = func(name string) (string, error) {
+		if lookErr != nil {
+			return "", lookErr
+		}
+		return "/stub/" + name, nil
+	}
+	torVersionOutput = func(path string) ([]byte, error) {
+		return []byte(versionOut), versionErr
+	}
+}
+
+func TestPreflightTorMissingBinary(t *testing.T) {
+	stubTorBinary(t, fmt.Errorf("executable file not found in $PATH"), "", nil)
+	_, _, err := PreflightTor("")
+	var tbe *TorBinaryError
+	if !errors.As(err, &tbe) {
+		t.Fatalf("PreflightTor = %v, want *TorBinaryError", err)
+	}
+	if tbe.Binary != "tor" {
+		t.Errorf("Binary = %q, want %q", tbe.Binary, "tor")
+	}
+	// The message must tell the user what to do.
+	if !strings.Contains(err.Error(), "install tor or pass --tor-binary") {
+		t.Errorf("error %q lacks the install hint", err)
+	}
+}
+
+func TestPreflightTorTooOld(t *testing.T) {
+	stubTorBinary(t, nil, "Tor version 0.3.5.8.\n", nil)
+	_, _, err := PreflightTor("tor")
+	var tbe *TorBinaryError
+	if !errors.As(err, &tbe) {
+		t.Fatalf("PreflightTor = %v, want *TorBinaryError", err)
+	}
+	if tbe.Version != "0.3.5.8" {
+		t.Errorf("Version = %q, want %q", tbe.Version, "0.3.5.8")
+	}
+	if !strings.Contains(err.Error(), "need "+minTorVersion+" or newer") {
+		t.Errorf("error %q lacks the minimum version", err)
+	}
+}
+
+func TestPreflightTorOK(t *testing.T) {
+	stubTorBinary(t, nil, "Tor version 0.4.8.10.\nTor is running on Linux.\n", nil)
+	path, version, err := PreflightTor("tor")
+	if err != nil {
+		t.Fatalf("PreflightTor: %v", err)
+	}
+	if path != "/stub/tor" {
+		t.Errorf("path = %q, want %q", path, "/stub/tor")
+	}
+	if version != "0.4.8.10" {
+		t.Errorf("version = %q, want %q", version, "0.4.8.10")
+	}
+}
+
+func TestPreflightTorGarbageOutput(t *testing.T) {
+	stubTorBinary(t, nil, "not a tor binary\n", nil)
+	_, _, err := PreflightTor("")
+	var tbe *TorBinaryError
+	if !errors.As(err, &tbe) {
+		t.Fatalf("PreflightTor = %v, want *TorBinaryError", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"0.4.6", "0.4.6", 0},
+		{"0.4.6.1", "0.4.6", 1},
+		{"0.4.5.99", "0.4.6", -1},
+		{"0.10.0", "0.9.9", 1},
+		{"1", "0.4.6", 1},
+	}
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package nettor
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op here; there are no POSIX process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killTorChild force-kills the Tor child process itself.
+func killTorChild(pid int) {
+	if pid <= 0 {
+		return
+	}
+	if p, err := os.FindProcess(pid); err == nil {
+		p.Kill()
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package nettor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup puts the command in a process group of its own, so
+// killTorChild can take down everything Tor spawned in one signal.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killTorChild force-kills the Tor child's process group, falling back
+// to the process alone if the group signal fails.
+func killTorChild(pid int) {
+	if pid <= 0 {
+		return
+	}
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
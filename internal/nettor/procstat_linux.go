@@ -0,0 +1,47 @@
+//go:build linux
+
+package nettor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHz is the kernel's USER_HZ, the unit of the CPU time counters in
+// /proc/<pid>/stat. It has been 100 on every Linux configuration for
+// decades; Go offers no portable sysconf to ask.
+const userHz = 100
+
+// sampleProcStats reads the process's resident set size and cumulative
+// CPU time (user plus system) from /proc/<pid>/stat. It reports false
+// when the process is gone or the file cannot be parsed.
+func sampleProcStats(pid int) (rssBytes int64, cpu time.Duration, ok bool) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, false
+	}
+	// The comm field is parenthesized and may itself contain spaces and
+	// parens; counting fields is only safe after the last ')'.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	// After comm: state is field 0; utime and stime are fields 11 and
+	// 12 in clock ticks; rss is field 21 in pages.
+	if len(fields) < 22 {
+		return 0, 0, false
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	rssPages, err3 := strconv.ParseInt(fields[21], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, false
+	}
+	cpu = time.Duration(utime+stime) * time.Second / userHz
+	return rssPages * int64(os.Getpagesize()), cpu, true
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package nettor
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestSampleProcStats(t *testing.T) {
+	rss, cpu, ok := sampleProcStats(os.Getpid())
+	if !ok {
+		t.Fatal("sampleProcStats failed on the test process itself")
+	}
+	if rss <= 0 {
+		t.Errorf("rss = %d, want > 0", rss)
+	}
+	if cpu < 0 {
+		t.Errorf("cpu = %s, want >= 0", cpu)
+	}
+}
+
+func TestSampleProcStatsGone(t *testing.T) {
+	// PIDs cannot exceed 2^22 on Linux, so this one never exists.
+	if _, _, ok := sampleProcStats(1 << 23); ok {
+		t.Error("sampleProcStats reported a nonexistent process")
+	}
+}
+
+func TestKillTorChildGroup(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Skipf("start sleep: %v", err)
+	}
+	killTorChild(cmd.Process.Pid)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("Wait: %v, want a kill", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("child survived killTorChild")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package nettor
+
+import "time"
+
+// sampleProcStats has no /proc to read here; the Tor child runs
+// unmonitored and the memory cap never triggers.
+func sampleProcStats(pid int) (rssBytes int64, cpu time.Duration, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,52 @@
+package nettor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRegisterTimeoutDefaults(t *testing.T) {
+	tn := New(t.TempDir())
+	if tn.bootstrapTimeout != defaultBootstrapTimeout {
+		t.Errorf("bootstrap timeout = %s, want default %s", tn.bootstrapTimeout, defaultBootstrapTimeout)
+	}
+	if tn.publishTimeout != defaultPublishTimeout {
+		t.Errorf("publish timeout = %s, want default %s", tn.publishTimeout, defaultPublishTimeout)
+	}
+
+	tn = New(t.TempDir(), WithBootstrapTimeout(time.Minute), WithPublishTimeout(30*time.Second))
+	if tn.bootstrapTimeout != time.Minute || tn.publishTimeout != 30*time.Second {
+		t.Errorf("timeouts = %s/%s, want 1m0s/30s", tn.bootstrapTimeout, tn.publishTimeout)
+	}
+}
+
+func TestRegisterPhase(t *testing.T) {
+	tn := New(t.TempDir())
+	if got := tn.RegisterPhase(); got != "" {
+		t.Errorf("phase before Register = %q, want empty", got)
+	}
+	tn.setPhase(PhaseBootstrap)
+	if got := tn.RegisterPhase(); got != PhaseBootstrap {
+		t.Errorf("phase = %q, want %q", got, PhaseBootstrap)
+	}
+	tn.setPhase("")
+	if got := tn.RegisterPhase(); got != "" {
+		t.Errorf("phase after clear = %q, want empty", got)
+	}
+}
+
+func TestTimeoutErrorsDistinct(t *testing.T) {
+	// Wrapped the way Register wraps them, the two phases stay
+	// distinguishable with errors.Is.
+	berr := fmt.Errorf("%w (budget %s): %w", ErrBootstrapTimeout, defaultBootstrapTimeout, errors.New("deadline"))
+	perr := fmt.Errorf("publish onion service: %w",
+		fmt.Errorf("%w (budget %s): %w", ErrPublishTimeout, defaultPublishTimeout, errors.New("deadline")))
+	if !errors.Is(berr, ErrBootstrapTimeout) || errors.Is(berr, ErrPublishTimeout) {
+		t.Errorf("bootstrap error %v misclassified", berr)
+	}
+	if !errors.Is(perr, ErrPublishTimeout) || errors.Is(perr, ErrBootstrapTimeout) {
+		t.Errorf("publish error %v misclassified", perr)
+	}
+}
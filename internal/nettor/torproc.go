@@ -0,0 +1,96 @@
+package nettor
+
+import (
+	"context"
+	"log"
+	"net"
+	"os/exec"
+	"time"
+
+	"github.com/cretz/bine/process"
+	"github.com/cretz/bine/tor"
+)
+
+// procSampleInterval is how often the Tor child's RSS and CPU time are
+// sampled while it runs.
+const procSampleInterval = 30 * time.Second
+
+// torShutdownTimeout is how long Close waits for bine's orderly
+// shutdown before force-killing the Tor child's process group. Tor
+// normally exits promptly on a control-port shutdown; a child that does
+// not is wedged and must not outlive the daemon.
+const torShutdownTimeout = 10 * time.Second
+
+// torProcessCreator builds the Tor child the way bine's default
+// exec-based creator does, but in its own process group, so shutdown
+// can kill everything Tor spawned even when the orderly Close fails.
+type torProcessCreator struct {
+	exePath string
+}
+
+func (c *torProcessCreator) New(ctx context.Context, args ...string) (process.Process, error) {
+	cmd := exec.CommandContext(ctx, c.exePath, args...)
+	setProcessGroup(cmd)
+	return &torProcess{cmd: cmd}, nil
+}
+
+// torProcess adapts an exec.Cmd to bine's Process interface.
+type torProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p *torProcess) Start() error { return p.cmd.Start() }
+func (p *torProcess) Wait() error  { return p.cmd.Wait() }
+
+func (p *torProcess) EmbeddedControlConn() (net.Conn, error) {
+	return nil, process.ErrControlConnUnsupported
+}
+
+// Pid is not part of bine's Process interface; the monitor reaches it
+// through the concrete type.
+func (p *torProcess) Pid() int {
+	if p.cmd.Process == nil {
+		return -1
+	}
+	return p.cmd.Process.Pid
+}
+
+// TorProcStats reports the Tor child's process ID and its RSS and
+// cumulative CPU time from the latest sample. All zero while Tor is not
+// running, and RSS and CPU stay zero on platforms without process
+// sampling.
+func (t *TorNetwork) TorProcStats() (pid int, rssBytes int64, cpuSeconds float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.childPID, t.childRSS, t.childCPU.Seconds()
+}
+
+// monitorTor samples the Tor child periodically until the instance is
+// replaced or gone. A child whose resident set grows beyond the
+// configured cap is killed; the watcher then reports it down and the
+// node's crash recovery republishes through a fresh instance.
+func (t *TorNetwork) monitorTor(instance *tor.Tor, pid int) {
+	ticker := time.NewTicker(procSampleInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.mu.Lock()
+		current := t.tor == instance
+		t.mu.Unlock()
+		if !current {
+			return
+		}
+		rss, cpu, ok := sampleProcStats(pid)
+		if !ok {
+			continue
+		}
+		t.mu.Lock()
+		t.childRSS, t.childCPU = rss, cpu
+		t.mu.Unlock()
+		if t.maxTorRSS > 0 && rss > t.maxTorRSS {
+			log.Printf("tor process %d uses %d bytes RSS, above the %d byte cap; restarting tor",
+				pid, rss, t.maxTorRSS)
+			killTorChild(pid)
+			return
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package secstore is an encrypted key-value store under the data dir.
+// Values are sealed with XChaCha20-Poly1305 under a key derived from the
+// node's master secret, so everything in it is opaque without the
+// password. Keys look like slash-separated paths ("messages/<onion>").
+package secstore
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/starius/barterbackup/internal/atomicfile"
+	"github.com/starius/barterbackup/internal/keys"
+)
+
+// ErrNotFound is returned by Get for a key that has no value.
+var ErrNotFound = errors.New("secstore: not found")
+
+const fileSuffix = ".enc"
+
+// Store is an open secstore. It is safe for concurrent use; each value
+// is an independent file.
+type Store struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// Open opens (creating if needed) the secstore at dir, with the sealing
+// key derived from master.
+func Open(dir string, master []byte) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create secstore dir: %w", err)
+	}
+	key, err := keys.Expand(master, "barterbackup/secstore/v1", chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("init secstore cipher: %w", err)
+	}
+	return &Store{dir: dir, aead: aead}, nil
+}
+
+// Put seals value and stores it under key.
+func (s *Store) Put(key string, value []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("secstore put %q: %w", key, err)
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("secstore nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, value, []byte(key))
+	if err := atomicfile.WriteFile(path, sealed, 0o600); err != nil {
+		return fmt.Errorf("secstore put %q: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens the value stored under key.
+func (s *Store) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	} else if err != nil {
+		return nil, fmt.Errorf("secstore get %q: %w", key, err)
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("secstore get %q: truncated", key)
+	}
+	nonce, ct := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	value, err := s.aead.Open(nil, nonce, ct, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("secstore get %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// Delete removes the value stored under key. Deleting a missing key is
+// not an error.
+func (s *Store) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("secstore delete %q: %w", key, err)
+	}
+	return nil
+}
+
+// List returns the keys under prefix, in lexical order.
+func (s *Store) List(prefix string) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, fileSuffix) {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(filepath.ToSlash(rel), fileSuffix)
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("secstore list %q: %w", prefix, err)
+	}
+	return out, nil
+}
+
+// PutJSON marshals v and stores it under key.
+func (s *Store) PutJSON(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("secstore marshal %q: %w", key, err)
+	}
+	return s.Put(key, data)
+}
+
+// GetJSON reads the value under key and unmarshals it into v.
+func (s *Store) GetJSON(key string, v any) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("secstore unmarshal %q: %w", key, err)
+	}
+	return nil
+}
+
+// path maps a key to its file, rejecting keys that would escape the
+// store directory.
+func (s *Store) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "..") {
+		return "", fmt.Errorf("secstore: invalid key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)+fileSuffix), nil
+}
@@ -0,0 +1,82 @@
+package secstore
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testMaster = bytes.Repeat([]byte{7}, 32)
+
+func TestPutGetDelete(t *testing.T) {
+	s, err := Open(t.TempDir(), testMaster)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put("messages/abc", []byte("hello")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := s.Get("messages/abc")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("Get: got %q, want %q", got, "hello")
+	}
+	if err := s.Delete("messages/abc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get("messages/abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	s, err := Open(t.TempDir(), testMaster)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, key := range []string{"a/1", "a/2", "b/1"} {
+		if err := s.Put(key, []byte("x")); err != nil {
+			t.Fatalf("Put %q: %v", key, err)
+		}
+	}
+	got, err := s.List("a/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := []string{"a/1", "a/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List: got %v, want %v", got, want)
+	}
+}
+
+func TestWrongKeyFailsOpen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, testMaster)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put("k", []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	other, err := Open(dir, bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatalf("Open with other master: %v", err)
+	}
+	if _, err := other.Get("k"); err == nil {
+		t.Error("Get with wrong master succeeded, want authentication failure")
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	s, err := Open(t.TempDir(), testMaster)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, key := range []string{"", "/abs", "a/../b"} {
+		if err := s.Put(key, []byte("x")); err == nil {
+			t.Errorf("Put %q succeeded, want error", key)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package torserver runs a standalone gRPC server on a Tor onion service.
+// It is used by auxiliary tools that need to expose bbrpc services without
+// a full node (e.g. test fixtures and the protocol conformance harness).
+package torserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cretz/bine/tor"
+	"google.golang.org/grpc"
+
+	"github.com/starius/barterbackup/bbrpc"
+	"github.com/starius/barterbackup/internal/keys"
+	"github.com/starius/barterbackup/internal/nettor"
+)
+
+// onionPort is the virtual port the onion service exposes.
+const onionPort = 443
+
+// defaultBootstrapTimeout bounds Tor bootstrap plus onion publication
+// when Config.BootstrapTimeout is zero.
+const defaultBootstrapTimeout = 3 * time.Minute
+
+// ErrBadTorrcLine is returned by Start when an ExtraTorrcLines entry is
+// not a valid "Keyword value" torrc option.
+var ErrBadTorrcLine = errors.New("bad torrc line")
+
+// Config configures Start.
+type Config struct {
+	// Seed is the password-like seed the identity is derived from.
+	Seed string
+	// Register is called with the gRPC server so the caller can attach
+	// services before it starts accepting connections.
+	Register func(*grpc.Server)
+	// DataDir persists Tor state across restarts, like nettor does for
+	// the node. Empty means a throwaway temp dir and a full
+	// re-bootstrap on every start.
+	DataDir string
+	// DisableNetwork leaves the Tor network disabled and skips
+	// publishing the onion service, for tests that must not touch the
+	// real network. Address is still the derived address.
+	DisableNetwork bool
+	// ExtraTorrcLines are additional torrc options, one "Keyword value"
+	// line each, passed to Tor at launch.
+	ExtraTorrcLines []string
+	// BootstrapTimeout bounds Tor bootstrap plus onion publication.
+	// Zero means defaultBootstrapTimeout.
+	BootstrapTimeout time.Duration
+	// BootstrapProgress, if set, is called with bootstrap progress
+	// (0-100) and a short summary while Tor connects.
+	BootstrapProgress func(percent int, summary string)
+	// TorBinary is the tor executable to launch. Empty means "tor" from
+	// PATH.
+	TorBinary string
+}
+
+// Server is a running torserver instance.
+type Server struct {
+	// Address is the onion address the server is reachable at.
+	Address string
+
+	tor *tor.Tor
+	srv *grpc.Server
+}
+
+// Start bootstraps Tor, publishes an onion service for the identity
+// derived from cfg.Seed, and serves gRPC on it.
+func Start(ctx context.Context, cfg Config) (*Server, error) {
+	onionKey, err := keys.OnionKeyFromSeed(cfg.Seed)
+	if err != nil {
+		return nil, fmt.Errorf("derive onion key: %w", err)
+	}
+	extraArgs, err := torrcArgs(cfg.ExtraTorrcLines)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.BootstrapTimeout
+	if timeout == 0 {
+		timeout = defaultBootstrapTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	exePath, _, err := nettor.PreflightTor(cfg.TorBinary)
+	if err != nil {
+		return nil, err
+	}
+	t, err := tor.Start(ctx, &tor.StartConf{
+		DataDir:   cfg.DataDir,
+		ExePath:   exePath,
+		ExtraArgs: extraArgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("start tor: %w", err)
+	}
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(bbrpc.GRPCMaxMsgSize),
+		grpc.MaxSendMsgSize(bbrpc.GRPCMaxMsgSize),
+	)
+	if cfg.Register != nil {
+		cfg.Register(srv)
+	}
+	address := keys.OnionAddress(onionKey.Public().(ed25519.PublicKey))
+	if cfg.DisableNetwork {
+		return &Server{Address: address, tor: t, srv: srv}, nil
+	}
+
+	stopProgress := reportBootstrap(ctx, t, cfg.BootstrapProgress)
+	onion, err := t.Listen(ctx, &tor.ListenConf{
+		Key:         onionKey,
+		RemotePorts: []int{onionPort},
+		Version3:    true,
+	})
+	stopProgress()
+	if err != nil {
+		t.Close()
+		return nil, fmt.Errorf("listen onion: %w", err)
+	}
+
+	cert, err := selfSignedCert(onionKey)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+	}
+	go srv.Serve(tls.NewListener(onion, tlsCfg))
+
+	return &Server{
+		Address: address,
+		tor:     t,
+		srv:     srv,
+	}, nil
+}
+
+// torrcArgs converts "Keyword value" torrc lines into tor command line
+// arguments, rejecting lines that are not a keyword plus arguments.
+func torrcArgs(lines []string) ([]string, error) {
+	var args []string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !isTorrcKeyword(fields[0]) {
+			return nil, fmt.Errorf("%w: %q", ErrBadTorrcLine, line)
+		}
+		args = append(args, "--"+fields[0])
+		args = append(args, fields[1:]...)
+	}
+	return args, nil
+}
+
+// isTorrcKeyword reports whether s looks like a torrc option name:
+// letters and digits, starting with a letter.
+func isTorrcKeyword(s string) bool {
+	for i, r := range s {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// reportBootstrap polls Tor's bootstrap phase and feeds it to progress
+// until the returned stop function is called. A nil progress is a no-op.
+func reportBootstrap(ctx context.Context, t *tor.Tor, progress func(int, string)) (stop func()) {
+	if progress == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		last := -1
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := t.Control.GetInfo("status/bootstrap-phase")
+			if err != nil || len(info) == 0 {
+				continue
+			}
+			percent, summary := parseBootstrapPhase(info[0].Val)
+			if percent != last {
+				last = percent
+				progress(percent, summary)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// parseBootstrapPhase extracts PROGRESS and SUMMARY from a Tor
+// status/bootstrap-phase line.
+func parseBootstrapPhase(line string) (percent int, summary string) {
+	if _, rest, ok := strings.Cut(line, "PROGRESS="); ok {
+		field, _, _ := strings.Cut(rest, " ")
+		percent, _ = strconv.Atoi(field)
+	}
+	if _, rest, ok := strings.Cut(line, "SUMMARY=\""); ok {
+		summary, _, _ = strings.Cut(rest, "\"")
+	}
+	return percent, summary
+}
+
+// Stop shuts the server and the Tor client down.
+func (s *Server) Stop() {
+	s.srv.Stop()
+	s.tor.Close()
+}
+
+// selfSignedCert builds a self-signed certificate for the onion key.
+func selfSignedCert(key ed25519.PrivateKey) (tls.Certificate, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "barterbackup"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
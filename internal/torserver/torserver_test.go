@@ -0,0 +1,28 @@
+package torserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBadExtraTorrcLine(t *testing.T) {
+	_, err := Start(context.Background(), Config{
+		Seed:            "test seed",
+		ExtraTorrcLines: []string{"SocksPort auto", "no-such option!"},
+	})
+	if !errors.Is(err, ErrBadTorrcLine) {
+		t.Fatalf("Start with bad torrc line: %v, want ErrBadTorrcLine", err)
+	}
+}
+
+func TestParseBootstrapPhase(t *testing.T) {
+	line := `NOTICE BOOTSTRAP PROGRESS=85 TAG=ap_conn_done SUMMARY="Connected to a relay to build circuits"`
+	percent, summary := parseBootstrapPhase(line)
+	if percent != 85 {
+		t.Errorf("percent = %d, want 85", percent)
+	}
+	if summary != "Connected to a relay to build circuits" {
+		t.Errorf("summary = %q", summary)
+	}
+}
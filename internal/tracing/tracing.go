@@ -0,0 +1,192 @@
+// Package tracing wires optional OpenTelemetry tracing into the daemon
+// and the CLI. Nothing here runs unless an OTLP endpoint is configured:
+// the otel globals default to no-op implementations, so span calls on
+// the hot path cost a map-free interface call and no allocation.
+//
+// Trace context crosses process boundaries as W3C traceparent entries
+// in gRPC metadata. The traceparent header carries only random trace
+// and span IDs — no hostnames, addresses, or other identifying data —
+// but propagation to storage peers is still gated behind an explicit
+// feature flag; see bbrpc.FeatureTracing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// scopeName names the instrumentation scope on every span.
+const scopeName = "github.com/starius/barterbackup"
+
+// Setup installs a tracer provider exporting to the OTLP/gRPC endpoint
+// and returns a shutdown function that flushes buffered spans. An empty
+// endpoint leaves the no-op defaults in place and returns a no-op
+// shutdown, so callers need not branch.
+func Setup(ctx context.Context, endpoint, service string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exp, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName(service)))
+	if err != nil {
+		return nil, fmt.Errorf("otlp resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// Span wraps an otel span so instrumented packages do not import the
+// otel API surface directly.
+type Span struct {
+	s trace.Span
+}
+
+// StartSpan opens a span named name as a child of whatever trace ctx
+// carries, or a new root span when it carries none.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	ctx, s := otel.Tracer(scopeName).Start(ctx, name)
+	return ctx, &Span{s: s}
+}
+
+// SpanFromContext returns the span active in ctx; a no-op span when
+// there is none, so annotating call sites need no nil checks.
+func SpanFromContext(ctx context.Context) *Span {
+	return &Span{s: trace.SpanFromContext(ctx)}
+}
+
+// SetInt attaches an integer attribute, e.g. byte or chunk counts.
+func (sp *Span) SetInt(key string, v int64) {
+	sp.s.SetAttributes(attribute.Int64(key, v))
+}
+
+// SetString attaches a string attribute.
+func (sp *Span) SetString(key, v string) {
+	sp.s.SetAttributes(attribute.String(key, v))
+}
+
+// End closes the span, recording err as its status when non-nil.
+func (sp *Span) End(err error) {
+	if err != nil {
+		sp.s.SetStatus(codes.Error, err.Error())
+	}
+	sp.s.End()
+}
+
+// mdCarrier adapts gRPC metadata to the otel propagation interface.
+type mdCarrier metadata.MD
+
+func (c mdCarrier) Get(key string) string {
+	vs := metadata.MD(c).Get(key)
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+func (c mdCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c mdCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Inject copies the trace context from ctx into the outgoing gRPC
+// metadata, so the callee's Extract continues the same trace.
+func Inject(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, mdCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// Extract returns ctx extended with the trace context found in the
+// incoming gRPC metadata, if any.
+func Extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, mdCarrier(md))
+}
+
+// UnaryClientInterceptor spans each outgoing unary RPC and propagates
+// the trace context to the server.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, sp := StartSpan(ctx, method)
+		err := invoker(Inject(ctx), method, req, reply, cc, opts...)
+		sp.End(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor propagates the trace context on outgoing
+// streams. The stream itself is not spanned: it outlives the
+// interceptor, and the per-operation spans around it already account
+// for the time.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(Inject(ctx), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor continues the caller's trace (or starts a new
+// one) around each unary handler.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, sp := StartSpan(Extract(ctx), info.FullMethod)
+		resp, err := handler(ctx, req)
+		sp.End(err)
+		return resp, err
+	}
+}
+
+// tracedServerStream overrides the stream context with the extracted
+// trace context.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context { return s.ctx }
+
+// StreamServerInterceptor continues the caller's trace around each
+// streaming handler.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, sp := StartSpan(Extract(ss.Context()), info.FullMethod)
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+		sp.End(err)
+		return err
+	}
+}